@@ -121,6 +121,7 @@ type discoveredTable struct {
 	comment            string
 	createTableQuery   string
 	timestampFieldName string
+	sortingKey         string
 	virtualTable       bool
 }
 
@@ -27,6 +27,7 @@ type Table struct {
 	CreateTableQuery string
 
 	DiscoveredTimestampFieldName *string
+	SortingKey                   []string // columns of the ORDER BY key, empty if unknown
 
 	VirtualTable bool
 }
@@ -251,8 +251,9 @@ func (td *tableDiscovery) configureTables(tables map[string]map[string]columnMet
 			} else {
 				comment := td.tableComment(databaseName, table)
 				createTableQuery := td.createTableQuery(databaseName, table)
+				sortingKey := td.tableSortingKey(databaseName, table)
 				// we assume here that @timestamp field is always present in the table, or it's explicitly configured
-				configuredTables[table] = discoveredTable{table, databaseName, columns, indexConfig, comment, createTableQuery, "", false}
+				configuredTables[table] = discoveredTable{table, databaseName, columns, indexConfig, comment, createTableQuery, "", sortingKey, false}
 			}
 		} else {
 			notConfiguredTables = append(notConfiguredTables, table)
@@ -275,6 +276,7 @@ func (td *tableDiscovery) autoConfigureTables(tables map[string]map[string]colum
 	for table, columns := range tables {
 		comment := td.tableComment(databaseName, table)
 		createTableQuery := td.createTableQuery(databaseName, table)
+		sortingKey := td.tableSortingKey(databaseName, table)
 		var maybeTimestampField string
 		if td.cfg.Hydrolix.IsNonEmpty() {
 			maybeTimestampField = td.tableTimestampField(databaseName, table, Hydrolix)
@@ -282,7 +284,7 @@ func (td *tableDiscovery) autoConfigureTables(tables map[string]map[string]colum
 			maybeTimestampField = td.tableTimestampField(databaseName, table, ClickHouse)
 		}
 		const isVirtualTable = false
-		configuredTables[table] = discoveredTable{table, databaseName, columns, config.IndexConfiguration{}, comment, createTableQuery, maybeTimestampField, isVirtualTable}
+		configuredTables[table] = discoveredTable{table, databaseName, columns, config.IndexConfiguration{}, comment, createTableQuery, maybeTimestampField, sortingKey, isVirtualTable}
 
 	}
 	for tableName, table := range configuredTables {
@@ -335,6 +337,7 @@ func (td *tableDiscovery) populateTableDefinitions(configuredTables map[string]d
 				},
 				CreateTableQuery:             resTable.createTableQuery,
 				DiscoveredTimestampFieldName: timestampFieldName,
+				SortingKey:                   sortingKeyColumns(resTable.sortingKey, columnsMap),
 				VirtualTable:                 resTable.virtualTable,
 			}
 			if containsAttributes(resTable.columnTypes) {
@@ -577,6 +580,44 @@ func (td *tableDiscovery) getTimestampFieldForClickHouse(database, table string)
 	return timestampField
 }
 
+func (td *tableDiscovery) tableSortingKey(database, table string) (sortingKey string) {
+	// sorting_key is the table's ORDER BY expression list, e.g. "`@timestamp`, host"
+	if err := td.dbConnPool.QueryRow("SELECT sorting_key FROM system.tables WHERE database = ? and table = ?", database, table).Scan(&sortingKey); err != nil {
+		logger.Debug().Msgf("failed fetching sorting key for table %s: %v", table, err)
+	}
+	return sortingKey
+}
+
+// sortingKeyColumns returns plain columns of the sorting key, expressions (like `toStartOfHour(timestamp)`) are skipped
+func sortingKeyColumns(sortingKey string, columns map[string]*Column) []string {
+	var result []string
+	depth, start := 0, 0
+	for i := 0; i <= len(sortingKey); i++ {
+		if i < len(sortingKey) {
+			switch sortingKey[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		name := strings.Trim(strings.TrimSpace(sortingKey[start:i]), "`\"")
+		if _, ok := columns[name]; ok {
+			result = append(result, name)
+		}
+		start = i + 1
+	}
+	return result
+}
+
 func (td *tableDiscovery) tableComment(database, table string) (comment string) {
 
 	err := td.dbConnPool.QueryRow("SELECT comment FROM system.tables WHERE database = ? and table = ?", database, table).Scan(&comment)
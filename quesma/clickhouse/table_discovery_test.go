@@ -236,3 +236,22 @@ func Test_resolveColumn_Nullable(t *testing.T) {
 		})
 	}
 }
+
+func Test_sortingKeyColumns(t *testing.T) {
+	columns := map[string]*Column{"@timestamp": {Name: "@timestamp"}, "host": {Name: "host"}, "id": {Name: "id"}}
+	tests := []struct {
+		sortingKey string
+		want       []string
+	}{
+		{"", nil},
+		{"`@timestamp`", []string{"@timestamp"}},
+		{"host, `@timestamp`, id", []string{"host", "@timestamp", "id"}},
+		{"toStartOfHour(`@timestamp`), host, cityHash64(host, id), id", []string{"host", "id"}},
+		{"unknown, id", []string{"id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortingKey, func(t *testing.T) {
+			assert.Equal(t, tt.want, sortingKeyColumns(tt.sortingKey, columns))
+		})
+	}
+}
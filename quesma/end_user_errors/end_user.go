@@ -96,6 +96,7 @@ var ErrNoSuchTable = errorType(2002, "Missing table.")
 var ErrNoSuchSchema = errorType(2003, "Missing schema.")
 var ErrNoIngest = errorType(2004, "Ingest is not enabled.")
 var ErrNoConnector = errorType(2005, "No connector found.")
+var ErrNotSupportedScript = errorType(2006, "Not supported script.")
 
 var ErrDatabaseTableNotFound = errorType(3001, "Table not found in database.")
 var ErrDatabaseFieldNotFound = errorType(3002, "Field not found in database.")
@@ -77,5 +77,12 @@ func (s *EQL) Parse(query string) (parser.IQueryContext, error) {
 }
 
 func (s *EQL) IsSupported(ast parser.IQueryContext) bool {
-	return ast.SimpleQuery() != nil && len(ast.AllPipe()) == 0
+	for _, pipe := range ast.AllPipe() {
+		switch pipe.(type) {
+		case *parser.PipeHeadContext, *parser.PipeTailContext, *parser.PipeFilterContext, *parser.PipeUniqueContext:
+		default:
+			return false
+		}
+	}
+	return ast.SimpleQuery() != nil || ast.SequenceQuery() != nil || ast.SampleQuery() != nil
 }
@@ -40,9 +40,13 @@ func TestEQL_IsSupported(t *testing.T) {
 		supported bool
 	}{
 		{"simple where true", true},
-		{"process where true | head 3 ", false},
-		{"sequence [ simple where true] [ simple where true]", false},
-		{"sample by foo [ bar where true ]", false},
+		{"process where true | head 3 ", true},
+		{"process where true | filter foo == 1 | unique bar | tail 3 ", true},
+		{"process where true | count", false},
+		{"process where true | sort foo", false},
+		{"sequence [ simple where true] [ simple where true]", true},
+		{"sequence [ simple where true] [ simple where true] | head 3", true},
+		{"sample by foo [ bar where true ]", true},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,110 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"quesma/eql/transform"
+)
+
+// Pipes are pipe commands of a query transformed to Clickhouse.
+//
+// Clickhouse applies WHERE, then the unique filter, then LIMIT. So we accept pipes only in that order,
+// otherwise the result would be different from the Elasticsearch one (e.g. `| head 5 | filter ...`).
+type Pipes struct {
+	Filters []string // rendered conditions, ANDed with the WHERE clause
+	Unique  []string // translated field names, only the first event of each combination is returned
+	Head    int      // 0 if there's no `head`
+	Tail    int      // 0 if there's no `tail`
+}
+
+// TransformPipes transforms pipe commands of a query. Filter conditions are transformed as in TransformQuery,
+// but parameters are not extracted.
+func (t *Transformer) TransformPipes(query string) (*Pipes, error) {
+
+	query, _ = cutUntil(query)
+
+	p := NewEQL()
+	ast, err := p.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.IsSupported(ast) {
+		return nil, fmt.Errorf("unsupported query type") // TODO proper error message
+	}
+
+	isSimple := ast.SimpleQuery() != nil
+
+	result := &Pipes{}
+	previous := ""
+	for _, pipeCtx := range ast.AllPipe() {
+
+		eql2ExpTransformer := transform.NewEQLParseTreeToExpTransformer()
+		pipe := pipeCtx.Accept(eql2ExpTransformer).(*transform.Pipe)
+		if len(eql2ExpTransformer.Errors) > 0 {
+			return nil, fmt.Errorf("eql2exp conversion errors: count=%d, %v", len(eql2ExpTransformer.Errors), eql2ExpTransformer.Errors)
+		}
+
+		if !isSimple && (pipe.Name == "filter" || pipe.Name == "unique") {
+			return nil, fmt.Errorf("pipe '%s' is supported only in event queries", pipe.Name)
+		}
+
+		switch pipe.Name {
+		case "filter":
+			if previous != "" && previous != "filter" {
+				return nil, fmt.Errorf("unsupported pipe order: 'filter' after '%s'", previous)
+			}
+			condition, err := t.transformExp(pipe.Condition, nil)
+			if err != nil {
+				return nil, err
+			}
+			result.Filters = append(result.Filters, condition)
+
+		case "unique":
+			if previous != "" && previous != "filter" {
+				return nil, fmt.Errorf("unsupported pipe order: 'unique' after '%s'", previous)
+			}
+			for _, field := range pipe.Fields {
+				translated, err := t.FieldNameTranslator(field)
+				if err != nil {
+					return nil, fmt.Errorf("transforming unique field '%s' failed: %v", field.Name, err)
+				}
+				result.Unique = append(result.Unique, translated.Name)
+			}
+
+		case "head":
+			if result.Tail > 0 {
+				return nil, fmt.Errorf("unsupported pipe order: 'head' after 'tail'")
+			}
+			if result.Head == 0 || pipe.Number < result.Head {
+				result.Head = pipe.Number
+			}
+
+		case "tail":
+			if result.Head > 0 {
+				return nil, fmt.Errorf("unsupported pipe order: 'tail' after 'head'")
+			}
+			if result.Tail == 0 || pipe.Number < result.Tail {
+				result.Tail = pipe.Number
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported pipe: '%s'", pipe.Name)
+		}
+
+		previous = pipe.Name
+	}
+
+	return result, nil
+}
+
+// Limit returns the max number of results (events, sequences or samples) after `head`/`tail`.
+func (p *Pipes) Limit(size int) int {
+	for _, limit := range []int{p.Head, p.Tail} {
+		if limit > 0 && (size <= 0 || limit < size) {
+			size = limit
+		}
+	}
+	return size
+}
@@ -0,0 +1,78 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestTransformPipes(t *testing.T) {
+
+	tests := []struct {
+		eql      string
+		expected Pipes
+	}{
+		{`any where true`,
+			Pipes{}},
+		{`any where true | head 5 | head 3`,
+			Pipes{Head: 3}},
+		{`any where true | tail 5`,
+			Pipes{Tail: 5}},
+		{`any where true | filter process.pid > 1 | filter a == "b" | unique user.name, host | head 2`,
+			Pipes{Filters: []string{`(process.pid > 1)`, `(a = 'b')`}, Unique: []string{"user.name", "host"}, Head: 2}},
+		{`sequence [ a where true ] [ b where true ] until [ c where true ] | tail 2`,
+			Pipes{Tail: 2}},
+		{`sample by host [ a where true ] [ b where true ] | head 2`,
+			Pipes{Head: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eql, func(t *testing.T) {
+			pipes, err := NewTransformer().TransformPipes(tt.eql)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *pipes)
+		})
+	}
+}
+
+func TestTransformPipesErrors(t *testing.T) {
+
+	tests := []struct {
+		eql          string
+		errorPattern string
+	}{
+		{`any where true | count`,
+			"unsupported query type"},
+		{`any where true | sort a`,
+			"unsupported query type"},
+		{`any where true | head 5 | filter a == 1`,
+			"unsupported pipe order: 'filter' after 'head'"},
+		{`any where true | tail 5 | unique a`,
+			"unsupported pipe order: 'unique' after 'tail'"},
+		{`any where true | head 5 | tail 2`,
+			"unsupported pipe order: 'tail' after 'head'"},
+		{`sequence [ a where true ] [ b where true ] | unique a`,
+			"pipe 'unique' is supported only in event queries"},
+		{`sample by host [ a where true ] [ b where true ] | filter a == 1`,
+			"pipe 'filter' is supported only in event queries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eql, func(t *testing.T) {
+			_, err := NewTransformer().TransformPipes(tt.eql)
+			require.Error(t, err)
+			assert.True(t, strings.Contains(err.Error(), tt.errorPattern), "expected error: %s, got: %v", tt.errorPattern, err)
+		})
+	}
+}
+
+func TestPipes_Limit(t *testing.T) {
+	assert.Equal(t, 10, (&Pipes{}).Limit(10))
+	assert.Equal(t, 0, (&Pipes{}).Limit(0))
+	assert.Equal(t, 3, (&Pipes{Head: 3}).Limit(10))
+	assert.Equal(t, 3, (&Pipes{Head: 3}).Limit(0))
+	assert.Equal(t, 2, (&Pipes{Tail: 5}).Limit(2))
+}
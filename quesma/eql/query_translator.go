@@ -14,12 +14,16 @@ import (
 	"quesma/queryparser"
 	"quesma/queryparser/query_util"
 	"quesma/quesma/types"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 // It implements quesma.IQueryTranslator for EQL queries.
 
+// rankColumn is a helper column of `unique` and `sample` subqueries, it's not returned in `_source`
+const rankColumn = "__quesma_rank"
+
 type ClickhouseEQLQueryTranslator struct {
 	ClickhouseLM *clickhouse.LogManager
 	Table        *clickhouse.Table
@@ -27,12 +31,16 @@ type ClickhouseEQLQueryTranslator struct {
 }
 
 func (cw *ClickhouseEQLQueryTranslator) MakeSearchResponse(queries []*model.Query, ResultSets [][]model.QueryResultRow) *model.SearchResp {
-	// for now len(queries) should be 1, len(ResultSets) should be 1
+	// for now len(queries) should be 1, len(ResultSets) should be 1 (except for sequences)
 	if len(queries) < 1 || len(ResultSets) < 1 {
 		logger.WarnWithCtx(cw.Ctx).Msgf("queries or ResultSets are empty, queries=%+v, ResultSets=%+v", queries, ResultSets)
 		return &model.SearchResp{}
 	}
 
+	if step, ok := queries[0].Type.(*sequenceStepType); ok {
+		return cw.makeSequenceResponse(step, queries, ResultSets)
+	}
+
 	query := queries[0]
 	ResultSet := ResultSets[0]
 
@@ -44,7 +52,7 @@ func (cw *ClickhouseEQLQueryTranslator) MakeSearchResponse(queries []*model.Quer
 
 		hits[i].Fields = make(map[string][]interface{})
 		hits[i].Highlight = make(map[string][]string)
-		hits[i].Source = []byte(resultRow.String(cw.Ctx))
+		hits[i].Source = []byte(withoutColumns(resultRow, rankColumn).String(cw.Ctx))
 		hits[i].ID = strconv.Itoa(i + 1)
 		hits[i].Index = cw.Table.Name
 		hits[i].Score = 1
@@ -75,7 +83,16 @@ func (cw *ClickhouseEQLQueryTranslator) MakeSearchResponse(queries []*model.Quer
 }
 
 func (cw *ClickhouseEQLQueryTranslator) ParseQuery(body types.JSON) (*model.ExecutionPlan, error) {
-	simpleQuery, queryInfo, highlighter, err := cw.parseQuery(body)
+	if eqlQuery, ok := body["query"].(string); ok {
+		switch {
+		case IsSequence(eqlQuery):
+			return cw.parseSequenceQuery(body, eqlQuery)
+		case IsSample(eqlQuery):
+			return cw.parseSampleQuery(body, eqlQuery)
+		}
+	}
+
+	simpleQuery, queryInfo, highlighter, pipes, err := cw.parseQuery(body)
 
 	if err != nil {
 		logger.ErrorWithCtx(cw.Ctx).Msgf("error parsing query: %v", err)
@@ -92,6 +109,7 @@ func (cw *ClickhouseEQLQueryTranslator) ParseQuery(body types.JSON) (*model.Exec
 		query.Type = &queryType
 		query.Highlighter = highlighter
 		query.SelectCommand.OrderBy = simpleQuery.OrderBy
+		cw.applyPipes(&query.SelectCommand, pipes)
 		queries = append(queries, query)
 		return &model.ExecutionPlan{Queries: queries}, nil
 
@@ -100,7 +118,7 @@ func (cw *ClickhouseEQLQueryTranslator) ParseQuery(body types.JSON) (*model.Exec
 	return nil, fmt.Errorf("could not parse query")
 }
 
-func (cw *ClickhouseEQLQueryTranslator) parseQuery(queryAsMap types.JSON) (query model.SimpleQuery, searchQueryInfo model.HitsCountInfo, highlighter model.Highlighter, err error) {
+func (cw *ClickhouseEQLQueryTranslator) parseQuery(queryAsMap types.JSON) (query model.SimpleQuery, searchQueryInfo model.HitsCountInfo, highlighter model.Highlighter, pipes *Pipes, err error) {
 
 	// no highlighting here
 	highlighter = queryparser.NewEmptyHighlighter()
@@ -115,36 +133,107 @@ func (cw *ClickhouseEQLQueryTranslator) parseQuery(queryAsMap types.JSON) (query
 
 	if eqlQuery == "" {
 		query.CanParse = false
-		return query, model.NewEmptyHitsCountInfo(), highlighter, nil
-	}
-
-	// FIXME this is a naive translation.
-	// It should use the table schema to translate field names
-	translateName := func(name *transform.Symbol) (*transform.Symbol, error) {
-		res := strings.ReplaceAll(name.Name, ".", "::")
-		res = "\"" + res + "\"" // TODO proper escaping
-		return transform.NewSymbol(res), nil
+		return query, model.NewEmptyHitsCountInfo(), highlighter, nil, nil
 	}
 
 	trans := NewTransformer()
-	trans.FieldNameTranslator = translateName
+	trans.FieldNameTranslator = translateFieldName
 
 	// We don't extract parameters for now.
 	// Query execution does not support parameters yet.
 	trans.ExtractParameters = false
 	where, _, err := trans.TransformQuery(eqlQuery)
+	if err == nil {
+		pipes, err = trans.TransformPipes(eqlQuery)
+	}
 
 	if err != nil {
 		logger.ErrorWithCtx(cw.Ctx).Err(err).Msgf("error transforming EQL query: '%s'", eqlQuery)
 		query.CanParse = false
-		return query, model.NewEmptyHitsCountInfo(), highlighter, err
+		return query, model.NewEmptyHitsCountInfo(), highlighter, nil, err
+	}
+
+	for _, filter := range pipes.Filters {
+		if where == "" {
+			where = filter
+		} else {
+			where = "(" + where + " AND " + filter + ")"
+		}
 	}
 
 	query.WhereClause = model.NewLiteral(where) // @TODO that's to be fixed
 	query.CanParse = true
 	query.OrderBy = []model.OrderByExpr{model.NewSortColumn("@timestamp", model.DescOrder)}
 
-	return query, searchQueryInfo, highlighter, nil
+	return query, searchQueryInfo, highlighter, pipes, nil
+}
+
+// applyPipes maps `unique`, `head` and `tail` pipes to SQL. Filters are already in the WHERE clause.
+func (cw *ClickhouseEQLQueryTranslator) applyPipes(selectCommand *model.SelectCommand, pipes *Pipes) {
+
+	ascending := []model.OrderByExpr{model.NewSortColumn("@timestamp", model.AscOrder)}
+
+	if len(pipes.Unique) > 0 {
+		limitByKeys(selectCommand, pipes.Unique, ascending, 1)
+	}
+
+	switch {
+	case pipes.Head > 0:
+		selectCommand.OrderBy = ascending
+		selectCommand.Limit = pipes.Limit(selectCommand.Limit)
+
+	case pipes.Tail > 0:
+		// the last events, but still in ascending order
+		last := *selectCommand
+		last.OrderBy = []model.OrderByExpr{model.NewSortColumn("@timestamp", model.DescOrder)}
+		last.Limit = pipes.Limit(selectCommand.Limit)
+
+		*selectCommand = model.SelectCommand{
+			Columns:    []model.Expr{model.NewWildcardExpr},
+			FromClause: last,
+			OrderBy:    ascending,
+		}
+	}
+}
+
+// limitByKeys keeps only the first n rows (in orderBy order) for every combination of keys.
+// It's a subquery with ROW_NUMBER(), as SelectCommand can't have both LIMIT BY and LIMIT.
+func limitByKeys(selectCommand *model.SelectCommand, keys []string, orderBy []model.OrderByExpr, n int) {
+
+	partitionBy := make([]model.Expr, 0, len(keys))
+	for _, key := range keys {
+		partitionBy = append(partitionBy, model.NewLiteral(key))
+	}
+
+	ranked := model.SelectCommand{
+		Columns: []model.Expr{
+			model.NewWildcardExpr,
+			model.NewAliasedExpr(model.NewWindowFunction("ROW_NUMBER", []model.Expr{}, partitionBy, orderBy), rankColumn),
+		},
+		FromClause:  selectCommand.FromClause,
+		WhereClause: selectCommand.WhereClause,
+	}
+
+	selectCommand.FromClause = ranked
+	selectCommand.WhereClause = model.NewInfixExpr(model.NewLiteral(strconv.Quote(rankColumn)), "<=", model.NewLiteral(n))
+}
+
+func withoutColumns(row model.QueryResultRow, names ...string) *model.QueryResultRow {
+	result := &model.QueryResultRow{Index: row.Index}
+	for _, col := range row.Cols {
+		if !slices.Contains(names, col.ColName) {
+			result.Cols = append(result.Cols, col)
+		}
+	}
+	return result
+}
+
+// FIXME this is a naive translation.
+// It should use the table schema to translate field names
+func translateFieldName(name *transform.Symbol) (*transform.Symbol, error) {
+	res := strings.ReplaceAll(name.Name, ".", "::")
+	res = "\"" + res + "\"" // TODO proper escaping
+	return transform.NewSymbol(res), nil
 }
 
 // These methods are not supported by EQL. They are here to satisfy the interface.
@@ -0,0 +1,106 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/model"
+	"testing"
+)
+
+func TestClickhouseEQLQueryTranslator_ParseQuery(t *testing.T) {
+
+	tests := []struct {
+		eql          string
+		expectedSQLs []string
+	}{
+		{`process where a == 1`,
+			[]string{`SELECT * FROM logs WHERE (("a" = 1) AND ("event::category" = 'process')) ORDER BY "@timestamp" DESC`}},
+
+		{`process where a == 1 | head 5`,
+			[]string{`SELECT * FROM logs WHERE (("a" = 1) AND ("event::category" = 'process')) ORDER BY "@timestamp" ASC LIMIT 5`}},
+
+		{`process where a == 1 | filter b > 2 | unique user.name | tail 3`,
+			[]string{`SELECT * FROM (` +
+				`SELECT * FROM (` +
+				`SELECT *, ROW_NUMBER() OVER (PARTITION BY "user::name" ORDER BY "@timestamp" ASC) AS "__quesma_rank" ` +
+				`FROM logs WHERE ((("a" = 1) AND ("event::category" = 'process')) AND ("b" > 2))) ` +
+				`WHERE "__quesma_rank"<=1 ORDER BY "@timestamp" DESC LIMIT 3) ` +
+				`ORDER BY "@timestamp" ASC`}},
+
+		{`sequence by user.name [ process where true ] [ file where true ] until [ any where x == 1 ]`,
+			[]string{
+				`SELECT *, "@timestamp" AS "__quesma_sequence_timestamp", "user::name" AS "__quesma_sequence_join_key_0", ` +
+					`throwIf(count() OVER ()>1000,'more than 1000 candidate events in a step, increase fetch_size') AS "__quesma_sequence_fetch_check" ` +
+					`FROM logs WHERE (true AND ("event::category" = 'process')) ORDER BY "@timestamp" ASC LIMIT 1000`,
+				`SELECT *, "@timestamp" AS "__quesma_sequence_timestamp", "user::name" AS "__quesma_sequence_join_key_0", ` +
+					`throwIf(count() OVER ()>1000,'more than 1000 candidate events in a step, increase fetch_size') AS "__quesma_sequence_fetch_check" ` +
+					`FROM logs WHERE (true AND ("event::category" = 'file')) ORDER BY "@timestamp" ASC LIMIT 1000`,
+				`SELECT *, "@timestamp" AS "__quesma_sequence_timestamp", "user::name" AS "__quesma_sequence_join_key_0", ` +
+					`throwIf(count() OVER ()>1000,'more than 1000 candidate events in a step, increase fetch_size') AS "__quesma_sequence_fetch_check" ` +
+					`FROM logs WHERE ("x" = 1) ORDER BY "@timestamp" ASC LIMIT 1000`,
+			}},
+
+		{`sample by host [ a where true ] [ b where true ] | head 3`,
+			[]string{
+				`SELECT *, "@timestamp" AS "__quesma_sequence_timestamp", "host" AS "__quesma_sequence_join_key_0", ` +
+					`throwIf(count() OVER ()>1000,'more than 1000 candidate events in a step, increase fetch_size') AS "__quesma_sequence_fetch_check" ` +
+					`FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY "host" ORDER BY "@timestamp" ASC) AS "__quesma_rank" ` +
+					`FROM logs WHERE (true AND ("event::category" = 'a'))) ` +
+					`WHERE "__quesma_rank"<=1 ORDER BY "host" ASC, "@timestamp" ASC LIMIT 1000`,
+				`SELECT *, "@timestamp" AS "__quesma_sequence_timestamp", "host" AS "__quesma_sequence_join_key_0", ` +
+					`throwIf(count() OVER ()>1000,'more than 1000 candidate events in a step, increase fetch_size') AS "__quesma_sequence_fetch_check" ` +
+					`FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY "host" ORDER BY "@timestamp" ASC) AS "__quesma_rank" ` +
+					`FROM logs WHERE (true AND ("event::category" = 'b'))) ` +
+					`WHERE "__quesma_rank"<=1 ORDER BY "host" ASC, "@timestamp" ASC LIMIT 1000`,
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eql, func(t *testing.T) {
+			translator := &ClickhouseEQLQueryTranslator{Table: &clickhouse.Table{Name: "logs"}, Ctx: context.Background()}
+
+			plan, err := translator.ParseQuery(map[string]any{"query": tt.eql})
+			require.NoError(t, err)
+
+			var actualSQLs []string
+			for _, query := range plan.Queries {
+				actualSQLs = append(actualSQLs, model.AsString(query.SelectCommand))
+			}
+			assert.Equal(t, tt.expectedSQLs, actualSQLs)
+		})
+	}
+}
+
+func TestClickhouseEQLQueryTranslator_MakeSearchResponseSequences(t *testing.T) {
+
+	translator := &ClickhouseEQLQueryTranslator{Table: &clickhouse.Table{Name: "logs"}, Ctx: context.Background()}
+
+	plan, err := translator.ParseQuery(map[string]any{"query": `sequence by user [ a where true ] [ b where true ] | tail 1`})
+	require.NoError(t, err)
+	require.Len(t, plan.Queries, 2)
+
+	row := func(timestamp int64, user string) model.QueryResultRow {
+		return model.QueryResultRow{Cols: []model.QueryResultCol{
+			model.NewQueryResultCol("message", user),
+			model.NewQueryResultCol(sequenceTimestampColumn, timestamp),
+			model.NewQueryResultCol(sequenceJoinKeyColumnPrefix+"0", user),
+		}}
+	}
+
+	response := translator.MakeSearchResponse(plan.Queries, [][]model.QueryResultRow{
+		{row(1, "alice"), row(2, "bob")},
+		{row(3, "alice"), row(4, "bob")},
+	})
+
+	require.Len(t, response.Hits.Sequences, 1)
+	assert.Equal(t, 1, response.Hits.Total.Value)
+
+	sequence := response.Hits.Sequences[0]
+	assert.Equal(t, []any{"bob"}, sequence.JoinKeys)
+	require.Len(t, sequence.Events, 2)
+	assert.JSONEq(t, `{"message": "bob"}`, string(sequence.Events[0].Source))
+}
@@ -0,0 +1,422 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"quesma/eql/transform"
+	"quesma/model"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sequence is a `sequence` query transformed to Clickhouse.
+//
+// Clickhouse can't match ordered events joined by keys within a time span efficiently,
+// so (just like Elasticsearch does) every step is queried separately,
+// and candidate events are matched into sequences in memory by Match.
+type Sequence struct {
+	Steps      []SequenceStep
+	Until      *SequenceStep // nil if there's no `until` clause
+	MaxSpan    time.Duration // 0 if there's no `with maxspan=...`
+	Parameters map[string]interface{}
+}
+
+type SequenceStep struct {
+	WhereClause string   // empty if the step matches every event
+	JoinKeys    []string // translated field names, `sequence by` keys go first
+}
+
+// SequenceEvent is a candidate event for a step (or the `until` clause) of a sequence.
+type SequenceEvent struct {
+	Timestamp time.Time
+	JoinKeys  []any
+	Row       model.QueryResultRow
+}
+
+type MatchedSequence struct {
+	JoinKeys []any
+	Events   []SequenceEvent
+}
+
+// Sample is a `sample` query transformed to Clickhouse.
+// Steps are queried separately, just like in Sequence, and candidate events are grouped into samples by Match.
+type Sample struct {
+	Steps      []SequenceStep
+	Parameters map[string]interface{}
+}
+
+// IsSequence returns true if the query is a `sequence` query.
+func IsSequence(query string) bool {
+	query, _ = cutUntil(query)
+	ast, err := NewEQL().Parse(query)
+	return err == nil && ast.SequenceQuery() != nil
+}
+
+// IsSample returns true if the query is a `sample` query.
+func IsSample(query string) bool {
+	ast, err := NewEQL().Parse(query)
+	return err == nil && ast.SampleQuery() != nil
+}
+
+// TransformSequence transforms a `sequence` query. Each step is transformed as in TransformQuery.
+func (t *Transformer) TransformSequence(query string) (*Sequence, error) {
+
+	query, hasUntil := cutUntil(query)
+
+	p := NewEQL()
+	ast, err := p.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.IsSupported(ast) || ast.SequenceQuery() == nil {
+		return nil, fmt.Errorf("unsupported query type") // TODO proper error message
+	}
+
+	eql2ExpTransformer := transform.NewEQLParseTreeToExpTransformer()
+	sequence := ast.Accept(eql2ExpTransformer).(*transform.Sequence)
+	if len(eql2ExpTransformer.Errors) > 0 {
+		return nil, fmt.Errorf("eql2exp conversion errors: count=%d, %v", len(eql2ExpTransformer.Errors), eql2ExpTransformer.Errors)
+	}
+
+	steps := sequence.Steps
+	var until *transform.SequenceStep
+	if hasUntil {
+		until = steps[len(steps)-1]
+		steps = steps[:len(steps)-1]
+	}
+
+	if len(steps) < 2 {
+		return nil, fmt.Errorf("sequence requires a minimum of 2 queries, found [%d]", len(steps))
+	}
+
+	result := &Sequence{Parameters: make(map[string]interface{})}
+
+	if sequence.MaxSpan != "" {
+		if result.MaxSpan, err = parseMaxSpan(sequence.MaxSpan); err != nil {
+			return nil, err
+		}
+	}
+
+	var constTransformer *transform.ParametersExtractorTransformer
+	if t.ExtractParameters {
+		// shared by all steps, so parameter names are unique
+		constTransformer = transform.NewParametersExtractorTransformer()
+	}
+
+	for _, step := range steps {
+		transformed, err := t.transformSequenceStep(sequence.JoinKeys, step, constTransformer)
+		if err != nil {
+			return nil, err
+		}
+		result.Steps = append(result.Steps, *transformed)
+	}
+
+	if until != nil {
+		if result.Until, err = t.transformSequenceStep(sequence.JoinKeys, until, constTransformer); err != nil {
+			return nil, err
+		}
+	}
+
+	keyCount := len(result.Steps[0].JoinKeys)
+	for _, step := range result.Steps {
+		if len(step.JoinKeys) != keyCount {
+			return nil, fmt.Errorf("inconsistent number of join keys in sequence, expected [%d], found [%d]", keyCount, len(step.JoinKeys))
+		}
+	}
+	if result.Until != nil && len(result.Until.JoinKeys) != keyCount {
+		return nil, fmt.Errorf("inconsistent number of join keys in until, expected [%d], found [%d]", keyCount, len(result.Until.JoinKeys))
+	}
+
+	if constTransformer != nil {
+		result.Parameters = constTransformer.Parameters
+	}
+
+	return result, nil
+}
+
+// TransformSample transforms a `sample` query. Each step is transformed as in TransformQuery.
+func (t *Transformer) TransformSample(query string) (*Sample, error) {
+
+	p := NewEQL()
+	ast, err := p.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.IsSupported(ast) || ast.SampleQuery() == nil {
+		return nil, fmt.Errorf("unsupported query type") // TODO proper error message
+	}
+
+	eql2ExpTransformer := transform.NewEQLParseTreeToExpTransformer()
+	sample := ast.Accept(eql2ExpTransformer).(*transform.Sample)
+	if len(eql2ExpTransformer.Errors) > 0 {
+		return nil, fmt.Errorf("eql2exp conversion errors: count=%d, %v", len(eql2ExpTransformer.Errors), eql2ExpTransformer.Errors)
+	}
+
+	if len(sample.Steps) < 2 {
+		return nil, fmt.Errorf("sample requires a minimum of 2 queries, found [%d]", len(sample.Steps))
+	}
+
+	result := &Sample{Parameters: make(map[string]interface{})}
+
+	var constTransformer *transform.ParametersExtractorTransformer
+	if t.ExtractParameters {
+		// shared by all steps, so parameter names are unique
+		constTransformer = transform.NewParametersExtractorTransformer()
+	}
+
+	for _, step := range sample.Steps {
+		transformed, err := t.transformSequenceStep(sample.JoinKeys, step, constTransformer)
+		if err != nil {
+			return nil, err
+		}
+		result.Steps = append(result.Steps, *transformed)
+	}
+
+	if constTransformer != nil {
+		result.Parameters = constTransformer.Parameters
+	}
+
+	return result, nil
+}
+
+func (t *Transformer) transformSequenceStep(joinKeys []*transform.Symbol, step *transform.SequenceStep, constTransformer *transform.ParametersExtractorTransformer) (*SequenceStep, error) {
+
+	result := &SequenceStep{}
+
+	if step.Condition != nil {
+		whereClause, err := t.transformExp(step.Condition, constTransformer)
+		if err != nil {
+			return nil, err
+		}
+		result.WhereClause = whereClause
+	}
+
+	for _, key := range append(append([]*transform.Symbol{}, joinKeys...), step.JoinKeys...) {
+		translated, err := t.FieldNameTranslator(key)
+		if err != nil {
+			return nil, fmt.Errorf("transforming join key '%s' failed: %v", key.Name, err)
+		}
+		result.JoinKeys = append(result.JoinKeys, translated.Name)
+	}
+
+	return result, nil
+}
+
+// Match matches candidate events into sequences. events[i] are candidates for Steps[i],
+// until are candidates for the `until` clause. Every slice must be sorted by timestamp.
+//
+// Semantics follow Elasticsearch: events of a sequence are ordered by timestamp and share join keys,
+// there's at most one in-flight sequence per join keys and step (a newer one replaces an older one),
+// an `until` event drops all in-flight sequences with its join keys, and the whole sequence must fit in MaxSpan.
+// At most size sequences are returned, in order of completion.
+func (s *Sequence) Match(events [][]SequenceEvent, until []SequenceEvent, size int) []MatchedSequence {
+
+	type candidate struct {
+		event SequenceEvent
+		step  int // len(s.Steps) for `until`
+	}
+
+	var candidates []candidate
+	for step, stepEvents := range events {
+		for _, event := range stepEvents {
+			candidates = append(candidates, candidate{event: event, step: step})
+		}
+	}
+	for _, event := range until {
+		candidates = append(candidates, candidate{event: event, step: len(s.Steps)})
+	}
+
+	// For equal timestamps later steps go first, so an event can't extend a sequence it has just started.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].event.Timestamp.Equal(candidates[j].event.Timestamp) {
+			return candidates[i].step > candidates[j].step
+		}
+		return candidates[i].event.Timestamp.Before(candidates[j].event.Timestamp)
+	})
+
+	// inFlight[i] are sequences with i events matched, by join keys
+	inFlight := make([]map[string]MatchedSequence, len(s.Steps))
+	for i := range inFlight {
+		inFlight[i] = make(map[string]MatchedSequence)
+	}
+
+	var result []MatchedSequence
+	for _, c := range candidates {
+		if len(result) >= size {
+			break
+		}
+
+		key := fmt.Sprintf("%#v", c.event.JoinKeys)
+
+		switch {
+		case c.step == len(s.Steps):
+			for i := range inFlight {
+				delete(inFlight[i], key)
+			}
+
+		case c.step == 0:
+			inFlight[1][key] = MatchedSequence{JoinKeys: c.event.JoinKeys, Events: []SequenceEvent{c.event}}
+
+		default:
+			sequence, ok := inFlight[c.step][key]
+			if !ok {
+				continue
+			}
+			delete(inFlight[c.step], key)
+
+			if s.MaxSpan > 0 && c.event.Timestamp.Sub(sequence.Events[0].Timestamp) > s.MaxSpan {
+				continue
+			}
+
+			sequence.Events = append(append([]SequenceEvent{}, sequence.Events...), c.event)
+			if c.step == len(s.Steps)-1 {
+				result = append(result, sequence)
+			} else {
+				inFlight[c.step+1][key] = sequence
+			}
+		}
+	}
+
+	return result
+}
+
+// Match groups candidate events into samples. events[i] are candidates for Steps[i].
+//
+// A sample consists of one event of every step, all with the same join keys. The n-th sample for given join keys
+// is built from the n-th events of every step, up to maxSamplesPerKey samples. At most size samples are returned,
+// ordered by the first appearance of their join keys in candidates of the first step.
+func (s *Sample) Match(events [][]SequenceEvent, size, maxSamplesPerKey int) []MatchedSequence {
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	byKey := make([]map[string][]SequenceEvent, len(events))
+	for i, stepEvents := range events {
+		byKey[i] = make(map[string][]SequenceEvent)
+		for _, event := range stepEvents {
+			key := fmt.Sprintf("%#v", event.JoinKeys)
+			byKey[i][key] = append(byKey[i][key], event)
+		}
+	}
+
+	var result []MatchedSequence
+	seen := make(map[string]bool)
+	for _, first := range events[0] {
+		key := fmt.Sprintf("%#v", first.JoinKeys)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		count := maxSamplesPerKey
+		for _, stepEvents := range byKey {
+			count = min(count, len(stepEvents[key]))
+		}
+
+		for n := 0; n < count; n++ {
+			if len(result) >= size {
+				return result
+			}
+			sample := MatchedSequence{JoinKeys: first.JoinKeys}
+			for _, stepEvents := range byKey {
+				sample.Events = append(sample.Events, stepEvents[key][n])
+			}
+			result = append(result, sample)
+		}
+	}
+
+	return result
+}
+
+// cutUntil removes the top-level `until` keyword from a sequence query.
+//
+// The grammar doesn't know `until` (and we can't regenerate the parser easily),
+// but the `until` clause has the same syntax as a sequence step. Without the keyword
+// it's parsed as the last step, and TransformSequence takes it from there.
+func cutUntil(query string) (string, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(query), "sequence") {
+		return query, false
+	}
+
+	depth := 0
+	var quote string
+
+	for i := 0; i < len(query); i++ {
+		rest := query[i:]
+
+		if quote != "" {
+			if quote == `"` && rest[0] == '\\' {
+				i++
+			} else if len(rest) >= len(quote) && rest[:len(quote)] == quote {
+				i += len(quote) - 1
+				quote = ""
+			}
+			continue
+		}
+
+		switch {
+		case len(rest) >= 3 && rest[:3] == `"""`:
+			quote = `"""`
+			i += 2
+		case rest[0] == '"' || rest[0] == '\'':
+			quote = rest[:1]
+		case rest[0] == '[':
+			depth++
+		case rest[0] == ']':
+			depth--
+		case rest[0] == '|' && depth == 0:
+			return query, false
+		case depth == 0 && isKeywordAt(query, i, "until"):
+			return query[:i] + "     " + query[i+len("until"):], true
+		}
+	}
+	return query, false
+}
+
+func isKeywordAt(s string, i int, keyword string) bool {
+	if len(s) < i+len(keyword) || s[i:i+len(keyword)] != keyword {
+		return false
+	}
+	isWordChar := func(b byte) bool {
+		return b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+	}
+	if i > 0 && isWordChar(s[i-1]) {
+		return false
+	}
+	end := i + len(keyword)
+	return end == len(s) || !isWordChar(s[end])
+}
+
+var maxSpanRegexp = regexp.MustCompile(`^([0-9]+)([a-z]+)$`)
+
+var maxSpanUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+func parseMaxSpan(s string) (time.Duration, error) {
+	match := maxSpanRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("invalid maxspan: '%s'", s)
+	}
+	unit, ok := maxSpanUnits[match[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid maxspan unit: '%s'", s)
+	}
+	value, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid maxspan: '%s': %v", s, err)
+	}
+	return time.Duration(value) * unit, nil
+}
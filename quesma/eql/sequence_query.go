@@ -0,0 +1,315 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"fmt"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/queryparser"
+	"quesma/queryparser/query_util"
+	"quesma/quesma/types"
+	"quesma/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSequenceSize      = 10
+	defaultSequenceFetchSize = 1000
+	defaultMaxSamplesPerKey  = 1
+
+	// helper columns added to every step query, they are not returned in `_source`
+	sequenceTimestampColumn     = "__quesma_sequence_timestamp"
+	sequenceJoinKeyColumnPrefix = "__quesma_sequence_join_key_"
+	sequenceFetchCheckColumn    = "__quesma_sequence_fetch_check"
+)
+
+// sequenceStepType is a query type of queries, which fetch candidate events for a step of a sequence or a sample.
+// Sequences are matched from results of all steps together in MakeSearchResponse, so it doesn't render JSON itself.
+type sequenceStepType struct {
+	sequence         *Sequence // nil for samples
+	sample           *Sample   // nil for sequences
+	step             int       // len(sequence.Steps) for `until`
+	size             int       // max number of sequences (samples) returned
+	tail             bool      // return the last sequences (samples) instead of the first ones
+	maxSamplesPerKey int
+}
+
+func (s *sequenceStepType) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (s *sequenceStepType) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+func (s *sequenceStepType) String() string {
+	return fmt.Sprintf("sequence_step(%d)", s.step)
+}
+
+func (cw *ClickhouseEQLQueryTranslator) parseSequenceQuery(body types.JSON, eqlQuery string) (*model.ExecutionPlan, error) {
+
+	trans := NewTransformer()
+	trans.FieldNameTranslator = translateFieldName
+
+	// Query execution does not support parameters yet.
+	trans.ExtractParameters = false
+	sequence, err := trans.TransformSequence(eqlQuery)
+	if err != nil {
+		logger.ErrorWithCtx(cw.Ctx).Err(err).Msgf("error transforming EQL sequence query: '%s'", eqlQuery)
+		return nil, err
+	}
+
+	pipes, err := trans.TransformPipes(eqlQuery)
+	if err != nil {
+		logger.ErrorWithCtx(cw.Ctx).Err(err).Msgf("error transforming EQL sequence query pipes: '%s'", eqlQuery)
+		return nil, err
+	}
+
+	timestampField := sequenceTimestampField(body)
+	fetchSize := intParam(body, "fetch_size", defaultSequenceFetchSize)
+
+	steps := sequence.Steps
+	if sequence.Until != nil {
+		steps = append(steps[:len(steps):len(steps)], *sequence.Until)
+	}
+
+	var queries []*model.Query
+	for i, step := range steps {
+		query := cw.buildSequenceStepQuery(step, timestampField, fetchSize)
+		query.Type = &sequenceStepType{
+			sequence: sequence,
+			step:     i,
+			size:     pipes.Limit(intParam(body, "size", defaultSequenceSize)),
+			tail:     pipes.Tail > 0,
+		}
+		queries = append(queries, query)
+	}
+
+	return &model.ExecutionPlan{Queries: queries}, nil
+}
+
+func (cw *ClickhouseEQLQueryTranslator) parseSampleQuery(body types.JSON, eqlQuery string) (*model.ExecutionPlan, error) {
+
+	trans := NewTransformer()
+	trans.FieldNameTranslator = translateFieldName
+
+	// Query execution does not support parameters yet.
+	trans.ExtractParameters = false
+	sample, err := trans.TransformSample(eqlQuery)
+	if err != nil {
+		logger.ErrorWithCtx(cw.Ctx).Err(err).Msgf("error transforming EQL sample query: '%s'", eqlQuery)
+		return nil, err
+	}
+
+	pipes, err := trans.TransformPipes(eqlQuery)
+	if err != nil {
+		logger.ErrorWithCtx(cw.Ctx).Err(err).Msgf("error transforming EQL sample query pipes: '%s'", eqlQuery)
+		return nil, err
+	}
+
+	timestampField := sequenceTimestampField(body)
+	fetchSize := intParam(body, "fetch_size", defaultSequenceFetchSize)
+	maxSamplesPerKey := intParam(body, "max_samples_per_key", defaultMaxSamplesPerKey)
+
+	var queries []*model.Query
+	for i, step := range sample.Steps {
+		query := cw.buildSequenceStepQuery(step, timestampField, fetchSize)
+
+		// only maxSamplesPerKey events for every join keys, and grouped by join keys,
+		// so fetch_size covers as many join keys as possible
+		ascending := query.SelectCommand.OrderBy
+		limitByKeys(&query.SelectCommand, step.JoinKeys, ascending, maxSamplesPerKey)
+		var orderBy []model.OrderByExpr
+		for _, key := range step.JoinKeys {
+			orderBy = append(orderBy, model.NewOrderByExpr(model.NewLiteral(key), model.AscOrder))
+		}
+		query.SelectCommand.OrderBy = append(orderBy, ascending...)
+
+		query.Type = &sequenceStepType{
+			sample:           sample,
+			step:             i,
+			size:             pipes.Limit(intParam(body, "size", defaultSequenceSize)),
+			tail:             pipes.Tail > 0,
+			maxSamplesPerKey: maxSamplesPerKey,
+		}
+		queries = append(queries, query)
+	}
+
+	return &model.ExecutionPlan{Queries: queries}, nil
+}
+
+func sequenceTimestampField(body types.JSON) string {
+	if field, ok := body["timestamp_field"].(string); ok {
+		return field
+	}
+	return model.TimestampFieldName
+}
+
+func intParam(body types.JSON, name string, defaultValue int) int {
+	if value, ok := body[name].(float64); ok {
+		return int(value)
+	}
+	return defaultValue
+}
+
+// buildSequenceStepQuery fetches the oldest candidate events of a step,
+// with their timestamps and join keys in the helper columns.
+// Matching needs all candidates of every step, so the query fails if there are more than fetchSize of them,
+// instead of silently returning incomplete (or even wrong, e.g. for `until`) sequences.
+func (cw *ClickhouseEQLQueryTranslator) buildSequenceStepQuery(step SequenceStep, timestampField string, fetchSize int) *model.Query {
+
+	simpleQuery := model.SimpleQuery{
+		OrderBy:  []model.OrderByExpr{model.NewSortColumn(timestampField, model.AscOrder)},
+		CanParse: true,
+	}
+	if step.WhereClause != "" {
+		simpleQuery.WhereClause = model.NewLiteral(step.WhereClause) // @TODO that's to be fixed, same as in parseQuery
+	}
+
+	query := query_util.BuildHitsQuery(cw.Ctx, cw.Table.Name, []string{"*"}, &simpleQuery, fetchSize)
+
+	columns := query.SelectCommand.Columns
+	columns = append(columns, model.NewAliasedExpr(model.NewColumnRef(timestampField), sequenceTimestampColumn))
+	for i, key := range step.JoinKeys {
+		columns = append(columns, model.NewAliasedExpr(model.NewLiteral(key), sequenceJoinKeyColumnPrefix+strconv.Itoa(i)))
+	}
+	// count() OVER () is computed before LIMIT, so it's the number of all candidates
+	candidateCount := model.NewWindowFunction("count", []model.Expr{}, nil, nil)
+	tooManyCandidates := model.NewInfixExpr(candidateCount, ">", model.NewLiteral(fetchSize))
+	message := model.NewLiteral(fmt.Sprintf("'more than %d candidate events in a step, increase fetch_size'", fetchSize))
+	columns = append(columns, model.NewAliasedExpr(model.NewFunction("throwIf", tooManyCandidates, message), sequenceFetchCheckColumn))
+	query.SelectCommand.Columns = columns
+
+	query.Highlighter = queryparser.NewEmptyHighlighter()
+	return query
+}
+
+func (cw *ClickhouseEQLQueryTranslator) makeSequenceResponse(spec *sequenceStepType, queries []*model.Query, resultSets [][]model.QueryResultRow) *model.SearchResp {
+
+	stepCount := len(queries)
+	if spec.sequence != nil {
+		stepCount = len(spec.sequence.Steps)
+	}
+
+	events := make([][]SequenceEvent, stepCount)
+	var until []SequenceEvent
+	for i, query := range queries {
+		if i >= len(resultSets) {
+			logger.WarnWithCtx(cw.Ctx).Msgf("missing results of sequence step %d", i)
+			break
+		}
+		step, ok := query.Type.(*sequenceStepType)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("unexpected query type %T in sequence", query.Type)
+			continue
+		}
+		stepEvents := cw.sequenceEvents(resultSets[i])
+		if step.step < stepCount {
+			events[step.step] = stepEvents
+		} else {
+			until = stepEvents
+		}
+	}
+
+	size := spec.size
+	if spec.tail {
+		size = math.MaxInt
+	}
+
+	var matched []MatchedSequence
+	if spec.sequence != nil {
+		matched = spec.sequence.Match(events, until, size)
+	} else {
+		matched = spec.sample.Match(events, size, spec.maxSamplesPerKey)
+	}
+
+	if spec.tail && len(matched) > spec.size {
+		matched = matched[len(matched)-spec.size:]
+	}
+
+	id := 0
+	sequences := make([]model.SearchSequence, 0, len(matched))
+	for _, m := range matched {
+		hits := make([]model.SearchHit, 0, len(m.Events))
+		for _, event := range m.Events {
+			id++
+			hit := model.NewSearchHit(cw.Table.Name)
+			hit.Source = []byte(event.Row.String(cw.Ctx))
+			hit.ID = strconv.Itoa(id)
+			hit.Score = 1
+			hit.Version = 1
+			hits = append(hits, hit)
+		}
+		sequences = append(sequences, model.SearchSequence{JoinKeys: m.JoinKeys, Events: hits})
+	}
+
+	return &model.SearchResp{
+		Hits: model.SearchHits{
+			Total: &model.Total{
+				Value:    len(sequences),
+				Relation: "eq",
+			},
+			Sequences: sequences,
+		},
+		Shards: model.ResponseShards{
+			Total:      1,
+			Successful: 1,
+			Failed:     0,
+		},
+	}
+}
+
+// sequenceEvents extracts timestamps and join keys from the helper columns, and removes them from rows.
+func (cw *ClickhouseEQLQueryTranslator) sequenceEvents(rows []model.QueryResultRow) []SequenceEvent {
+	events := make([]SequenceEvent, 0, len(rows))
+	for _, row := range rows {
+		event := SequenceEvent{Row: model.QueryResultRow{Index: row.Index}}
+		hasTimestamp := false
+
+		for _, col := range row.Cols {
+			switch {
+			case col.ColName == sequenceTimestampColumn:
+				event.Timestamp, hasTimestamp = sequenceTimestamp(col.Value)
+			case strings.HasPrefix(col.ColName, sequenceJoinKeyColumnPrefix):
+				event.JoinKeys = append(event.JoinKeys, col.Value)
+			case col.ColName == rankColumn, col.ColName == sequenceFetchCheckColumn:
+			default:
+				event.Row.Cols = append(event.Row.Cols, col)
+			}
+		}
+
+		if !hasTimestamp {
+			logger.WarnWithCtx(cw.Ctx).Msgf("event without a valid timestamp skipped in sequence: %v", row)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func sequenceTimestamp(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05.999999999", v); err == nil {
+			return t, true
+		}
+	default:
+		if millis, ok := util.ExtractNumeric64Maybe(v); ok {
+			return time.UnixMilli(int64(millis)), true
+		}
+	}
+	return time.Time{}, false
+}
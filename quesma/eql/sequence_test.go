@@ -0,0 +1,238 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package eql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransformSequence(t *testing.T) {
+
+	tests := []struct {
+		eql      string
+		expected Sequence
+	}{
+		{`sequence [ process where true ] [ file where true ]`,
+			Sequence{Steps: []SequenceStep{
+				{WhereClause: `(true AND (event.category = 'process'))`},
+				{WhereClause: `(true AND (event.category = 'file'))`},
+			}}},
+
+		{`sequence by user.name with maxspan=5m [ process where process.pid == 1 ] [ any where true ]`,
+			Sequence{MaxSpan: 5 * time.Minute, Steps: []SequenceStep{
+				{WhereClause: `((process.pid = 1) AND (event.category = 'process'))`, JoinKeys: []string{"user.name"}},
+				{WhereClause: `true`, JoinKeys: []string{"user.name"}},
+			}}},
+
+		{`sequence by host.id [ process where true ] by process.pid [ file where true ] by process.ppid`,
+			Sequence{Steps: []SequenceStep{
+				{WhereClause: `(true AND (event.category = 'process'))`, JoinKeys: []string{"host.id", "process.pid"}},
+				{WhereClause: `(true AND (event.category = 'file'))`, JoinKeys: []string{"host.id", "process.ppid"}},
+			}}},
+
+		{`sequence by user.name [ process where true ] [ file where file.name == "until" ] until [ process where stop == true ]`,
+			Sequence{
+				Steps: []SequenceStep{
+					{WhereClause: `(true AND (event.category = 'process'))`, JoinKeys: []string{"user.name"}},
+					{WhereClause: `((file.name = 'until') AND (event.category = 'file'))`, JoinKeys: []string{"user.name"}},
+				},
+				Until: &SequenceStep{WhereClause: `((stop = true) AND (event.category = 'process'))`, JoinKeys: []string{"user.name"}},
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eql, func(t *testing.T) {
+			assert.True(t, IsSequence(tt.eql))
+
+			sequence, err := NewTransformer().TransformSequence(tt.eql)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected.Steps, sequence.Steps)
+			assert.Equal(t, tt.expected.Until, sequence.Until)
+			assert.Equal(t, tt.expected.MaxSpan, sequence.MaxSpan)
+		})
+	}
+}
+
+func TestTransformSequenceErrors(t *testing.T) {
+
+	tests := []struct {
+		eql          string
+		errorPattern string
+	}{
+		{`sequence [ process where true ] [ file where true ] | count`,
+			"unsupported query type"},
+		{`sequence [ process where true ] until [ file where true ]`,
+			"minimum of 2 queries"},
+		{`sequence [ process where true ] by a [ file where true ] by a, b`,
+			"inconsistent number of join keys"},
+		{`sequence with maxspan=5y [ process where true ] [ file where true ]`,
+			"invalid maxspan unit"},
+		{`any where true`,
+			"unsupported query type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eql, func(t *testing.T) {
+			_, err := NewTransformer().TransformSequence(tt.eql)
+			require.Error(t, err)
+			assert.True(t, strings.Contains(err.Error(), tt.errorPattern), "expected error: %s, got: %v", tt.errorPattern, err)
+		})
+	}
+}
+
+func TestSequenceMatch(t *testing.T) {
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(seconds int, key string) SequenceEvent {
+		return SequenceEvent{
+			Timestamp: start.Add(time.Duration(seconds) * time.Second),
+			JoinKeys:  []any{key},
+			Row:       model.QueryResultRow{Cols: []model.QueryResultCol{model.NewQueryResultCol("id", seconds)}},
+		}
+	}
+	ids := func(sequences []MatchedSequence) [][]int {
+		var result [][]int
+		for _, sequence := range sequences {
+			var sequenceIds []int
+			for _, e := range sequence.Events {
+				sequenceIds = append(sequenceIds, e.Row.Cols[0].Value.(int))
+			}
+			result = append(result, sequenceIds)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		maxSpan  time.Duration
+		events   [][]SequenceEvent
+		until    []SequenceEvent
+		size     int
+		expected [][]int
+	}{
+		{"simple",
+			0,
+			[][]SequenceEvent{{event(1, "a")}, {event(2, "a")}},
+			nil, 10,
+			[][]int{{1, 2}}},
+		{"wrong order",
+			0,
+			[][]SequenceEvent{{event(2, "a")}, {event(1, "a")}},
+			nil, 10,
+			nil},
+		{"join keys",
+			0,
+			[][]SequenceEvent{{event(1, "a"), event(2, "b")}, {event(3, "b"), event(4, "a")}},
+			nil, 10,
+			[][]int{{2, 3}, {1, 4}}},
+		{"newer sequence replaces older one",
+			0,
+			[][]SequenceEvent{{event(1, "a"), event(2, "a")}, {event(3, "a"), event(4, "a")}},
+			nil, 10,
+			[][]int{{2, 3}}},
+		{"maxspan",
+			5 * time.Second,
+			[][]SequenceEvent{{event(1, "a"), event(10, "b")}, {event(7, "a"), event(12, "b")}},
+			nil, 10,
+			[][]int{{10, 12}}},
+		{"until",
+			0,
+			[][]SequenceEvent{{event(1, "a"), event(2, "b")}, {event(5, "a"), event(6, "b")}},
+			[]SequenceEvent{event(3, "a")}, 10,
+			[][]int{{2, 6}}},
+		{"size",
+			0,
+			[][]SequenceEvent{{event(1, "a"), event(2, "b")}, {event(3, "a"), event(4, "b")}},
+			nil, 1,
+			[][]int{{1, 3}}},
+		{"same event matching two steps",
+			0,
+			[][]SequenceEvent{{event(1, "a"), event(2, "a")}, {event(2, "a")}, {event(3, "a")}},
+			nil, 10,
+			[][]int{{1, 2, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := make([]SequenceStep, len(tt.events))
+			sequence := &Sequence{Steps: steps, MaxSpan: tt.maxSpan}
+
+			assert.Equal(t, tt.expected, ids(sequence.Match(tt.events, tt.until, tt.size)))
+		})
+	}
+}
+
+func TestTransformSample(t *testing.T) {
+
+	assert.True(t, IsSample(`sample by host [ a where true ] [ b where x == 1 ]`))
+	assert.False(t, IsSample(`sequence [ a where true ] [ b where x == 1 ]`))
+
+	sample, err := NewTransformer().TransformSample(`sample by host, user.name [ a where true ] [ b where x == 1 ]`)
+	require.NoError(t, err)
+	assert.Equal(t, []SequenceStep{
+		{WhereClause: `(true AND (event.category = 'a'))`, JoinKeys: []string{"host", "user.name"}},
+		{WhereClause: `((x = 1) AND (event.category = 'b'))`, JoinKeys: []string{"host", "user.name"}},
+	}, sample.Steps)
+
+	_, err = NewTransformer().TransformSample(`sample by host [ a where true ]`)
+	assert.Error(t, err)
+}
+
+func TestSampleMatch(t *testing.T) {
+
+	event := func(id int, key string) SequenceEvent {
+		return SequenceEvent{
+			JoinKeys: []any{key},
+			Row:      model.QueryResultRow{Cols: []model.QueryResultCol{model.NewQueryResultCol("id", id)}},
+		}
+	}
+	ids := func(samples []MatchedSequence) [][]int {
+		var result [][]int
+		for _, sample := range samples {
+			var sampleIds []int
+			for _, e := range sample.Events {
+				sampleIds = append(sampleIds, e.Row.Cols[0].Value.(int))
+			}
+			result = append(result, sampleIds)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name             string
+		events           [][]SequenceEvent
+		size             int
+		maxSamplesPerKey int
+		expected         [][]int
+	}{
+		{"keys in all steps",
+			[][]SequenceEvent{{event(1, "a"), event(2, "b"), event(3, "c")}, {event(4, "c"), event(5, "a")}},
+			10, 1,
+			[][]int{{1, 5}, {3, 4}}},
+		{"order doesn't matter",
+			[][]SequenceEvent{{event(2, "a")}, {event(1, "a")}},
+			10, 1,
+			[][]int{{2, 1}}},
+		{"max samples per key",
+			[][]SequenceEvent{{event(1, "a"), event(2, "a"), event(3, "a")}, {event(4, "a"), event(5, "a")}},
+			10, 3,
+			[][]int{{1, 4}, {2, 5}}},
+		{"size",
+			[][]SequenceEvent{{event(1, "a"), event(2, "b")}, {event(3, "a"), event(4, "b")}},
+			1, 1,
+			[][]int{{1, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample := &Sample{Steps: make([]SequenceStep, len(tt.events))}
+			assert.Equal(t, tt.expected, ids(sample.Match(tt.events, tt.size, tt.maxSamplesPerKey)))
+		})
+	}
+}
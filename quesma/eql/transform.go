@@ -39,7 +39,7 @@ func (t *Transformer) TransformQuery(query string) (string, map[string]interface
 		return "", nil, err
 	}
 
-	if !p.IsSupported(ast) {
+	if !p.IsSupported(ast) || ast.SimpleQuery() == nil {
 		return "", nil, fmt.Errorf("unsupported query type") // TODO proper error message
 	}
 
@@ -57,32 +57,51 @@ func (t *Transformer) TransformQuery(query string) (string, map[string]interface
 		return "", nil, nil
 	}
 
+	var constTransformer *transform.ParametersExtractorTransformer
+	if t.ExtractParameters {
+		constTransformer = transform.NewParametersExtractorTransformer()
+	}
+
+	whereClause, err := t.transformExp(exp, constTransformer)
+	if err != nil {
+		return "", nil, err
+	}
+
+	parameters := make(map[string]interface{})
+	if constTransformer != nil {
+		parameters = constTransformer.Parameters
+	}
+
+	return whereClause, parameters, nil
+}
+
+// transformExp runs steps 3-6 of the transformation for a single condition.
+// Parameters are extracted only if constTransformer is not nil.
+func (t *Transformer) transformExp(exp transform.Exp, constTransformer *transform.ParametersExtractorTransformer) (string, error) {
+
 	// 3. Replace operators with clickhouse operators
 	transOp := &transform.ClickhouseTransformer{}
 	exp = exp.Accept(transOp).(transform.Exp)
 
 	if len(transOp.Errors) > 0 {
-		return "", nil, fmt.Errorf("transforming opertators failed: errors: count=%d message: %v", len(transOp.Errors), transOp.Errors)
+		return "", fmt.Errorf("transforming opertators failed: errors: count=%d message: %v", len(transOp.Errors), transOp.Errors)
 	}
 
+	// 4. Replace the field names with clickhouse field names
 	transFieldName := &transform.FieldNameTransformer{
 		Translate: t.FieldNameTranslator,
 	}
 	exp = exp.Accept(transFieldName).(transform.Exp)
 	if len(transFieldName.Errors) > 0 {
-		return "", nil, fmt.Errorf("transforming field names failed: errors: count=%d message: %v", len(transFieldName.Errors), transFieldName.Errors)
+		return "", fmt.Errorf("transforming field names failed: errors: count=%d message: %v", len(transFieldName.Errors), transFieldName.Errors)
 	}
 
-	parameters := make(map[string]interface{})
-	if t.ExtractParameters {
-		constTransformer := transform.NewParametersExtractorTransformer()
+	// 5. Extract parameters
+	if constTransformer != nil {
 		exp = exp.Accept(constTransformer).(transform.Exp)
-		parameters = constTransformer.Parameters
 	}
 
 	// 6. Render the expression as WHERE clause
 	renderer := &transform.Renderer{}
-	whereClause := exp.Accept(renderer).(string)
-
-	return whereClause, parameters, nil
+	return exp.Accept(renderer).(string), nil
 }
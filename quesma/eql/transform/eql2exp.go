@@ -62,9 +62,112 @@ func (v *EQLParseTreeToExpTransformer) evalFloat(s string) (float64, error) {
 }
 
 func (v *EQLParseTreeToExpTransformer) VisitQuery(ctx *parser.QueryContext) interface{} {
+	if ctx.SequenceQuery() != nil {
+		return ctx.SequenceQuery().Accept(v)
+	}
+	if ctx.SampleQuery() != nil {
+		return ctx.SampleQuery().Accept(v)
+	}
 	return ctx.SimpleQuery().Accept(v)
 }
 
+func (v *EQLParseTreeToExpTransformer) VisitSampleQuery(ctx *parser.SampleQueryContext) interface{} {
+
+	sample := &Sample{
+		JoinKeys: v.visitFieldList(ctx.FieldList()),
+	}
+
+	for _, step := range ctx.AllSimpleQuery() {
+		var condition Exp
+		if exp := step.Accept(v); exp != nil {
+			condition = exp.(Exp)
+		}
+		sample.Steps = append(sample.Steps, &SequenceStep{Condition: condition})
+	}
+
+	return sample
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeHead(ctx *parser.PipeHeadContext) interface{} {
+	return v.numberPipe("head", ctx.NUMBER().GetText())
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeTail(ctx *parser.PipeTailContext) interface{} {
+	return v.numberPipe("tail", ctx.NUMBER().GetText())
+}
+
+func (v *EQLParseTreeToExpTransformer) numberPipe(name, number string) *Pipe {
+	i, err := v.evalInteger(number)
+	if err != nil || i < 0 {
+		v.error(fmt.Sprintf("invalid number of events in %s: %s", name, number))
+	}
+	return &Pipe{Name: name, Number: i}
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeCount(ctx *parser.PipeCountContext) interface{} {
+	return &Pipe{Name: "count"}
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeUnique(ctx *parser.PipeUniqueContext) interface{} {
+	return &Pipe{Name: "unique", Fields: v.visitFieldList(ctx.FieldList())}
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeSort(ctx *parser.PipeSortContext) interface{} {
+	return &Pipe{Name: "sort", Fields: v.visitFieldList(ctx.FieldList())}
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitPipeFilter(ctx *parser.PipeFilterContext) interface{} {
+	return &Pipe{Name: "filter", Condition: ctx.Condition().Accept(v).(Exp)}
+}
+
+func (v *EQLParseTreeToExpTransformer) VisitSequenceQuery(ctx *parser.SequenceQueryContext) interface{} {
+
+	sequence := &Sequence{}
+
+	if ctx.Interval() != nil {
+		sequence.MaxSpan = ctx.Interval().GetText()
+	}
+
+	steps := ctx.AllSimpleQuery()
+	for _, step := range steps {
+		var condition Exp
+		if exp := step.Accept(v); exp != nil {
+			condition = exp.(Exp)
+		}
+		sequence.Steps = append(sequence.Steps, &SequenceStep{Condition: condition})
+	}
+
+	// Both `sequence by ...` and `[...] by ...` are field lists,
+	// so we tell them apart by their position in the query.
+	for _, fieldList := range ctx.AllFieldList() {
+		fields := v.visitFieldList(fieldList)
+		position := fieldList.GetStart().GetTokenIndex()
+
+		owner := -1
+		for i, step := range steps {
+			if step.GetStart().GetTokenIndex() < position {
+				owner = i
+			}
+		}
+
+		if owner < 0 {
+			sequence.JoinKeys = fields
+		} else {
+			sequence.Steps[owner].JoinKeys = fields
+		}
+	}
+
+	return sequence
+}
+
+func (v *EQLParseTreeToExpTransformer) visitFieldList(ctx parser.IFieldListContext) []*Symbol {
+	var fields []*Symbol
+	for _, field := range ctx.AllField() {
+		fields = append(fields, field.Accept(v).(*Symbol))
+	}
+	return fields
+}
+
 func (v *EQLParseTreeToExpTransformer) VisitSimpleQuery(ctx *parser.SimpleQueryContext) interface{} {
 
 	category := ctx.Category().Accept(v)
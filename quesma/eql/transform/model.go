@@ -151,3 +151,30 @@ type ExpVisitor interface {
 	VisitFunction(e *Function) interface{}
 	VisitArray(e *Array) interface{}
 }
+
+// Sequence is a `sequence` query. It's not an Exp, because it can't be rendered as a single condition.
+// Every step is transformed and rendered separately.
+type Sequence struct {
+	JoinKeys []*Symbol // `sequence by ...`, shared by all steps
+	MaxSpan  string    // `with maxspan=...`, empty if not set
+	Steps    []*SequenceStep
+}
+
+type SequenceStep struct {
+	Condition Exp       // nil if the step matches every event
+	JoinKeys  []*Symbol // `[...] by ...`, specific to this step
+}
+
+// Sample is a `sample` query. Just like Sequence, every step is transformed and rendered separately.
+type Sample struct {
+	JoinKeys []*Symbol // `sample by ...`
+	Steps    []*SequenceStep
+}
+
+// Pipe is a pipe command, e.g. `| head 5`.
+type Pipe struct {
+	Name      string    // head, tail, count, unique, filter or sort
+	Number    int       // head, tail
+	Fields    []*Symbol // unique, sort
+	Condition Exp       // filter
+}
@@ -306,7 +306,9 @@ func TestErrors(t *testing.T) {
 	}{
 		{`any where ?notexisting == true `,
 			`optional fields are not supported`},
-		{`any where true | head 1`,
+		{`any where true | count`,
+			"unsupported query type"},
+		{`sequence [ any where true ] [ any where true ]`,
 			"unsupported query type"},
 		{`any where between(file.path, "System32\\", ".exe")  == ""`,
 			`between function is not implemented`},
@@ -0,0 +1,288 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"fmt"
+	chLib "quesma/clickhouse"
+	"quesma/common_table"
+	"quesma/jsonprocessor"
+	"quesma/model"
+	"quesma/quesma/types"
+	"quesma/table_resolver"
+	"quesma/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mutations of already ingested documents (`delete` and `update` bulk operations).
+//
+// Documents are identified by the `_id` column. Ids we generate in search results are computed from
+// the document timestamp (see model.TimestampFromDocumentId), and they aren't unique, so we can't mutate
+// documents by them: all documents with the same timestamp would be deleted or updated.
+// Mutations of tables without the `_id` column are rejected.
+//
+// ClickHouse mutations are heavy (every one rewrites the affected parts), so all operations of a bulk
+// are applied with a single DELETE and a single ALTER TABLE ... UPDATE.
+
+const documentIdColumn = model.DocumentIdFieldName
+
+type mutationTarget struct {
+	table     *chLib.Table
+	condition string // additional condition, e.g. the index name in the common table
+}
+
+// DocumentUpdate is a partial document (`doc` of the `update` bulk operation) to apply to the document with the given id
+type DocumentUpdate struct {
+	Id  string
+	Doc types.JSON
+}
+
+// Delete removes documents with the given ids using ClickHouse lightweight deletes.
+// Returns ids of documents, which were found (and deleted).
+func (ip *IngestProcessor) Delete(ctx context.Context, tableName string, ids []string) (found map[string]bool, err error) {
+	targets, err := ip.resolveMutationTargets(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	found = make(map[string]bool)
+	for _, target := range targets {
+		existing, err := ip.existingDocumentIds(ctx, target, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+		where, err := documentIdsCondition(target, existing)
+		if err != nil {
+			return nil, err
+		}
+		err = ip.execute(ctx, fmt.Sprintf(`DELETE FROM "%s" WHERE %s`, target.table.Name, where))
+		if err != nil {
+			return nil, fmt.Errorf("error deleting documents from table %s: %w", target.table.Name, err)
+		}
+		for _, id := range existing {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+// Update applies partial documents to documents with their ids. Updates of the same document are merged,
+// later ones take precedence. Only fields, which already have columns in the table, can be updated.
+// Returns ids of documents, which were found (and updated), updates of other ones are skipped.
+func (ip *IngestProcessor) Update(ctx context.Context, tableName string, updates []DocumentUpdate) (found map[string]bool, err error) {
+	targets, err := ip.resolveMutationTargets(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	transformer := jsonprocessor.IngestTransformerFor(tableName, ip.cfg)
+	var ids []string
+	valuesById := make(map[string]types.JSON) // id -> flattened fields
+	for _, update := range updates {
+		flattened, err := transformer.Transform(update.Doc.Clone())
+		if err != nil {
+			return nil, fmt.Errorf("error transforming document %s: %w", update.Id, err)
+		}
+		if len(flattened) == 0 {
+			return nil, fmt.Errorf("no fields to update in document %s", update.Id)
+		}
+		if _, ok := valuesById[update.Id]; !ok {
+			ids = append(ids, update.Id)
+			valuesById[update.Id] = types.JSON{}
+		}
+		for field, value := range flattened {
+			valuesById[update.Id][field] = value
+		}
+	}
+
+	fieldSet := make(map[string]bool)
+	for _, values := range valuesById {
+		for field := range values {
+			fieldSet[field] = true
+		}
+	}
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	found = make(map[string]bool)
+	for _, target := range targets {
+		for _, field := range fields {
+			columnName := util.FieldToColumnEncoder(field)
+			if _, ok := target.table.Cols[columnName]; !ok || columnName == common_table.IndexNameColumn || columnName == documentIdColumn {
+				return nil, fmt.Errorf("field %s can't be updated, there is no such column in table %s", field, target.table.Name)
+			}
+		}
+		existing, err := ip.existingDocumentIds(ctx, target, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+
+		var assignments []string
+		for _, field := range fields {
+			columnName := util.FieldToColumnEncoder(field)
+			// a new value for every document, which sets the field, e.g. multiIf("_id" = 'a', 1, "_id" = 'b', 2, "count")
+			var cases []string
+			for _, id := range existing {
+				value, ok := valuesById[id][field]
+				if !ok {
+					continue
+				}
+				literal, err := sqlLiteral(value)
+				if err != nil {
+					return nil, fmt.Errorf("field %s can't be updated: %w", field, err)
+				}
+				cases = append(cases, fmt.Sprintf(`"%s" = %s`, documentIdColumn, quoteString(id)), literal)
+			}
+			if len(cases) > 0 {
+				assignments = append(assignments, fmt.Sprintf(`"%s" = multiIf(%s, "%s")`, columnName, strings.Join(cases, ", "), columnName))
+			}
+		}
+
+		where, err := documentIdsCondition(target, existing)
+		if err != nil {
+			return nil, err
+		}
+		err = ip.execute(ctx, fmt.Sprintf(`ALTER TABLE "%s" UPDATE %s WHERE %s`, target.table.Name, strings.Join(assignments, ", "), where))
+		if err != nil {
+			return nil, fmt.Errorf("error updating documents in table %s: %w", target.table.Name, err)
+		}
+		for _, id := range existing {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+// existingDocumentIds returns those of ids, which are ids of documents in the target, in the order of ids
+func (ip *IngestProcessor) existingDocumentIds(ctx context.Context, target mutationTarget, ids []string) ([]string, error) {
+	where, err := documentIdsCondition(target, ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ip.chDb.QueryContext(ctx, fmt.Sprintf(`SELECT DISTINCT "%s" FROM "%s" WHERE %s`, documentIdColumn, target.table.Name, where))
+	if err != nil {
+		return nil, fmt.Errorf("error looking for documents in table %s: %w", target.table.Name, err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error looking for documents in table %s: %w", target.table.Name, err)
+		}
+		existing[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error looking for documents in table %s: %w", target.table.Name, err)
+	}
+
+	result := make([]string, 0, len(existing))
+	for _, id := range ids {
+		if existing[id] {
+			result = append(result, id)
+			delete(existing, id) // ids may repeat
+		}
+	}
+	return result, nil
+}
+
+func (ip *IngestProcessor) resolveMutationTargets(tableName string) ([]mutationTarget, error) {
+	decision := ip.tableResolver.Resolve(table_resolver.IngestPipeline, tableName)
+
+	if decision.Err != nil {
+		return nil, decision.Err
+	}
+
+	if decision.IsEmpty || decision.IsClosed {
+		return nil, fmt.Errorf("table %s not found", tableName)
+	}
+
+	var targets []mutationTarget
+	for _, connectorDecision := range decision.UseConnectors {
+
+		clickhouseDecision, ok := connectorDecision.(*table_resolver.ConnectorDecisionClickhouse)
+		if !ok {
+			continue
+		}
+
+		target := mutationTarget{}
+		physicalTableName := clickhouseDecision.ClickhouseTableName
+		if clickhouseDecision.IsCommonTable {
+			physicalTableName = common_table.TableName
+			target.condition = fmt.Sprintf(`"%s" = %s`, common_table.IndexNameColumn, quoteString(tableName))
+		}
+
+		if target.table = ip.FindTable(physicalTableName); target.table == nil {
+			return nil, fmt.Errorf("table %s not found", physicalTableName)
+		}
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("table %s not found", tableName)
+	}
+	return targets, nil
+}
+
+func documentIdsCondition(target mutationTarget, ids []string) (string, error) {
+	if _, ok := target.table.Cols[documentIdColumn]; !ok {
+		return "", fmt.Errorf("table %s doesn't store document ids (no %s column), documents can't be identified by id", target.table.Name, documentIdColumn)
+	}
+
+	quotedIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quotedIds = append(quotedIds, quoteString(id))
+	}
+
+	where := fmt.Sprintf(`"%s" IN (%s)`, documentIdColumn, strings.Join(quotedIds, ", "))
+	if target.condition != "" {
+		where += " AND " + target.condition
+	}
+	return where, nil
+}
+
+func sqlLiteral(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quoteString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case []any:
+		elements := make([]string, 0, len(v))
+		for _, element := range v {
+			literal, err := sqlLiteral(element)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, literal)
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,178 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package ingest
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/common_table"
+	"quesma/quesma/config"
+	"quesma/quesma/types"
+	"quesma/table_resolver"
+	"testing"
+)
+
+func TestMutations(t *testing.T) {
+
+	tests := []struct {
+		name              string
+		commonTable       bool
+		mutate            func(ip *IngestProcessor) (map[string]bool, error)
+		existingIds       []string
+		expectedSelect    string
+		expectedStatement string
+	}{
+		{
+			name: "delete",
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Delete(context.Background(), "logs", []string{"1", "it's 2"})
+			},
+			existingIds:       []string{"1", "it's 2"},
+			expectedSelect:    `SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1', 'it\'s 2')`,
+			expectedStatement: `DELETE FROM "logs" WHERE "_id" IN ('1', 'it\'s 2')`,
+		},
+		{
+			name:        "delete from common table",
+			commonTable: true,
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Delete(context.Background(), "logs", []string{"1"})
+			},
+			existingIds:       []string{"1"},
+			expectedSelect:    `SELECT DISTINCT "_id" FROM "quesma_common_table" WHERE "_id" IN ('1') AND "__quesma_index_name" = 'logs'`,
+			expectedStatement: `DELETE FROM "quesma_common_table" WHERE "_id" IN ('1') AND "__quesma_index_name" = 'logs'`,
+		},
+		{
+			name: "update",
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Update(context.Background(), "logs", []DocumentUpdate{{Id: "1", Doc: types.JSON{
+					"message": "it's updated",
+					"host":    map[string]any{"name": "server-1"},
+					"count":   float64(5),
+				}}})
+			},
+			existingIds:    []string{"1"},
+			expectedSelect: `SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1')`,
+			expectedStatement: `ALTER TABLE "logs" UPDATE "count" = multiIf("_id" = '1', 5, "count"), "host_name" = multiIf("_id" = '1', 'server-1', "host_name"), ` +
+				`"message" = multiIf("_id" = '1', 'it\'s updated', "message") WHERE "_id" IN ('1')`,
+		},
+		{
+			name: "update of many documents",
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Update(context.Background(), "logs", []DocumentUpdate{
+					{Id: "1", Doc: types.JSON{"message": "first", "count": float64(1)}},
+					{Id: "2", Doc: types.JSON{"count": float64(2)}},
+					{Id: "1", Doc: types.JSON{"count": float64(3)}},
+				})
+			},
+			existingIds:    []string{"1", "2"},
+			expectedSelect: `SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1', '2')`,
+			expectedStatement: `ALTER TABLE "logs" UPDATE "count" = multiIf("_id" = '1', 3, "_id" = '2', 2, "count"), ` +
+				`"message" = multiIf("_id" = '1', 'first', "message") WHERE "_id" IN ('1', '2')`,
+		},
+		{
+			name: "delete of a missing document",
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Delete(context.Background(), "logs", []string{"1", "2"})
+			},
+			existingIds:       []string{"2"},
+			expectedSelect:    `SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1', '2')`,
+			expectedStatement: `DELETE FROM "logs" WHERE "_id" IN ('2')`,
+		},
+		{
+			name: "update of a missing document",
+			mutate: func(ip *IngestProcessor) (map[string]bool, error) {
+				return ip.Update(context.Background(), "logs", []DocumentUpdate{{Id: "1", Doc: types.JSON{"count": float64(1)}}})
+			},
+			expectedSelect: `SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1')`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableName := "logs"
+			if tt.commonTable {
+				tableName = common_table.TableName
+			}
+
+			tables := NewTableMap()
+			tables.Store(tableName, &clickhouse.Table{
+				Name: tableName,
+				Cols: map[string]*clickhouse.Column{
+					"@timestamp":                 {Name: "@timestamp", Type: clickhouse.BaseType{Name: "DateTime64"}},
+					"_id":                        {Name: "_id", Type: clickhouse.BaseType{Name: "String"}},
+					"message":                    {Name: "message", Type: clickhouse.BaseType{Name: "String"}},
+					"host_name":                  {Name: "host_name", Type: clickhouse.BaseType{Name: "String"}},
+					"count":                      {Name: "count", Type: clickhouse.BaseType{Name: "Int64"}},
+					common_table.IndexNameColumn: {Name: common_table.IndexNameColumn, Type: clickhouse.BaseType{Name: "String"}},
+				},
+				Config:  NewDefaultCHConfig(),
+				Created: true,
+			})
+
+			resolver := table_resolver.NewEmptyTableResolver()
+			resolver.Decisions["logs"] = &table_resolver.Decision{
+				UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{
+					ClickhouseTableName: tableName,
+					IsCommonTable:       tt.commonTable,
+				}}}
+
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+
+			ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+			ip.chDb = db
+			ip.tableResolver = resolver
+
+			rows := sqlmock.NewRows([]string{"_id"})
+			for _, id := range tt.existingIds {
+				rows.AddRow(id)
+			}
+			mock.ExpectQuery(tt.expectedSelect).WillReturnRows(rows)
+			if tt.expectedStatement != "" {
+				mock.ExpectExec(tt.expectedStatement).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			found, err := tt.mutate(ip)
+			require.NoError(t, err)
+			for _, id := range tt.existingIds {
+				assert.True(t, found[id], id)
+			}
+			assert.Len(t, found, len(tt.existingIds))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMutationErrors(t *testing.T) {
+
+	tables := NewTableMap()
+	tables.Store("logs", &clickhouse.Table{
+		Name: "logs",
+		Cols: map[string]*clickhouse.Column{
+			"@timestamp": {Name: "@timestamp", Type: clickhouse.BaseType{Name: "DateTime64"}},
+		},
+		Config:  NewDefaultCHConfig(),
+		Created: true,
+	})
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions["logs"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{
+			ClickhouseTableName: "logs",
+		}}}
+
+	ip := newIngestProcessorWithEmptyTableMap(tables, &config.QuesmaConfiguration{})
+	ip.tableResolver = resolver
+
+	// documents can't be identified without the _id column
+	_, err := ip.Delete(context.Background(), "logs", []string{"1"})
+	assert.ErrorContains(t, err, "doesn't store document ids")
+	_, err = ip.Update(context.Background(), "logs", []DocumentUpdate{{Id: "1", Doc: types.JSON{"@timestamp": "2024-05-06T07:08:09Z"}}})
+	assert.ErrorContains(t, err, "doesn't store document ids")
+	_, err = ip.Update(context.Background(), "logs", []DocumentUpdate{{Id: "1", Doc: types.JSON{"unknown": 1.0}}})
+	assert.ErrorContains(t, err, "no such column")
+}
@@ -677,7 +677,7 @@ func (ip *IngestProcessor) processInsertQuery(ctx context.Context,
 	}
 	tableConfig = table.Config
 	var jsonsReadyForInsertion []string
-	var alterCmd []string
+	alterCmd := ip.addDocumentIdColumn(table, jsonData)
 	var preprocessedJsons []types.JSON
 	var invalidJsons []types.JSON
 	preprocessedJsons, invalidJsons, err := ip.preprocessJsons(ctx, table.Name, jsonData, transformer)
@@ -806,6 +806,38 @@ func (ip *IngestProcessor) processInsertQueryInternal(ctx context.Context, table
 	return ip.executeStatements(ctx, statements)
 }
 
+// addDocumentIdColumn adds the document id column to a table created before we started storing ids, if documents
+// have ids. It's always a column (never an attribute), as mutations find documents by it.
+// Like generateNewColumns, it modifies table.Cols and returns ALTER TABLE commands.
+func (ip *IngestProcessor) addDocumentIdColumn(table *chLib.Table, jsonData []types.JSON) []string {
+	if _, exists := table.Cols[documentIdColumn]; exists {
+		return nil
+	}
+	hasIds := false
+	for _, jsonValue := range jsonData {
+		if _, hasIds = jsonValue[documentIdColumn]; hasIds {
+			break
+		}
+	}
+	if !hasIds {
+		return nil
+	}
+
+	newColumns := make(map[string]*chLib.Column, len(table.Cols)+1)
+	for k, v := range table.Cols {
+		newColumns[k] = v
+	}
+	newColumns[documentIdColumn] = &chLib.Column{Name: documentIdColumn, Type: chLib.NewBaseType("String"), Modifiers: "Nullable"}
+	table.Cols = newColumns
+
+	if table.VirtualTable {
+		if err := ip.storeVirtualTable(table); err != nil {
+			logger.Error().Msgf("error storing virtual table: %v", err)
+		}
+	}
+	return []string{fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS "%s" Nullable(String)`, table.Name, documentIdColumn)}
+}
+
 // This function removes fields that are part of anotherDoc from inputDoc
 func subtractInputJson(inputDoc types.JSON, anotherDoc types.JSON) types.JSON {
 	for key := range anotherDoc {
@@ -0,0 +1,173 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package kibana
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// namedDateFormats are Elastic's built-in formats, expressed as patterns (only the most popular ones)
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/mapping-date-format.html#built-in-date-formats
+var namedDateFormats = map[string]string{
+	"strict_date_optional_time":             "yyyy-MM-dd'T'HH:mm:ss.SSSXXX",
+	"date_optional_time":                    "yyyy-MM-dd'T'HH:mm:ss.SSSXXX",
+	"strict_date_time":                      "yyyy-MM-dd'T'HH:mm:ss.SSSXXX",
+	"date_time":                             "yyyy-MM-dd'T'HH:mm:ss.SSSXXX",
+	"strict_date_time_no_millis":            "yyyy-MM-dd'T'HH:mm:ssXXX",
+	"date_time_no_millis":                   "yyyy-MM-dd'T'HH:mm:ssXXX",
+	"strict_date":                           "yyyy-MM-dd",
+	"date":                                  "yyyy-MM-dd",
+	"basic_date":                            "yyyyMMdd",
+	"strict_date_hour_minute_second":        "yyyy-MM-dd'T'HH:mm:ss",
+	"date_hour_minute_second":               "yyyy-MM-dd'T'HH:mm:ss",
+	"strict_date_hour_minute":               "yyyy-MM-dd'T'HH:mm",
+	"date_hour_minute":                      "yyyy-MM-dd'T'HH:mm",
+	"strict_year_month":                     "yyyy-MM",
+	"year_month":                            "yyyy-MM",
+	"strict_year":                           "yyyy",
+	"year":                                  "yyyy",
+	"strict_hour_minute_second":             "HH:mm:ss",
+	"hour_minute_second":                    "HH:mm:ss",
+	"strict_date_hour_minute_second_millis": "yyyy-MM-dd'T'HH:mm:ss.SSS",
+	"date_hour_minute_second_millis":        "yyyy-MM-dd'T'HH:mm:ss.SSS",
+}
+
+// FormatDate formats date (in its location) according to Elastic's format, which is either a built-in one
+// (e.g. "epoch_millis", "strict_date"), or a Java DateTimeFormatter pattern (e.g. "yyyy-MM-dd HH:mm").
+// Alternatives (e.g. "yyyy-MM-dd||epoch_millis") are allowed, the first one is used for formatting, just like in Elastic.
+// Returns false if format isn't supported.
+func FormatDate(date time.Time, format string) (formatted string, ok bool) {
+	format, _, _ = strings.Cut(format, "||")
+	switch format {
+	case "epoch_millis":
+		return strconv.FormatInt(date.UnixMilli(), 10), true
+	case "epoch_second":
+		return strconv.FormatInt(date.Unix(), 10), true
+	}
+	if pattern, isNamed := namedDateFormats[format]; isNamed {
+		format = pattern
+	}
+	if format == "" {
+		return "", false
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(format); {
+		letter := format[i]
+		// quoted literal, '' is a single quote (both inside and outside of quoted literal)
+		if letter == '\'' {
+			if i+1 < len(format) && format[i+1] == '\'' {
+				result.WriteByte('\'')
+				i += 2
+				continue
+			}
+			for i++; ; i++ {
+				if i == len(format) {
+					return "", false
+				}
+				if format[i] == '\'' {
+					if i+1 < len(format) && format[i+1] == '\'' {
+						result.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				result.WriteByte(format[i])
+			}
+			i++
+			continue
+		}
+		if !isASCIILetter(letter) {
+			result.WriteByte(letter)
+			i++
+			continue
+		}
+
+		count := 1
+		for i+count < len(format) && format[i+count] == letter {
+			count++
+		}
+		i += count
+		field, fieldOk := formatDateField(date, letter, count)
+		if !fieldOk {
+			return "", false
+		}
+		result.WriteString(field)
+	}
+	return result.String(), true
+}
+
+// formatDateField formats a single pattern letter, repeated count times (e.g. 'M', 2 -> month as 2 digits)
+func formatDateField(date time.Time, letter byte, count int) (string, bool) {
+	padded := func(value, minDigits int) string {
+		return fmt.Sprintf("%0*d", max(count, minDigits), value)
+	}
+	switch letter {
+	case 'y', 'u':
+		if count == 2 {
+			return date.Format("06"), true
+		}
+		return padded(date.Year(), 0), true
+	case 'M', 'L':
+		switch count {
+		case 1, 2:
+			return padded(int(date.Month()), 0), true
+		case 3:
+			return date.Format("Jan"), true
+		default:
+			return date.Format("January"), true
+		}
+	case 'd':
+		return padded(date.Day(), 0), true
+	case 'D':
+		return padded(date.YearDay(), 0), true
+	case 'H':
+		return padded(date.Hour(), 0), true
+	case 'h':
+		hour := date.Hour() % 12
+		if hour == 0 {
+			hour = 12
+		}
+		return padded(hour, 0), true
+	case 'm':
+		return padded(date.Minute(), 0), true
+	case 's':
+		return padded(date.Second(), 0), true
+	case 'S':
+		if count > 9 {
+			return "", false
+		}
+		return fmt.Sprintf("%09d", date.Nanosecond())[:count], true
+	case 'a':
+		return date.Format("PM"), true
+	case 'E':
+		if count <= 3 {
+			return date.Format("Mon"), true
+		}
+		return date.Format("Monday"), true
+	case 'e':
+		return padded((int(date.Weekday())+6)%7+1, 0), true // ISO: Monday is 1
+	case 'X':
+		return date.Format([]string{"Z07", "Z0700", "Z07:00"}[min(count, 3)-1]), true
+	case 'x':
+		return date.Format([]string{"-07", "-0700", "-07:00"}[min(count, 3)-1]), true
+	case 'Z':
+		if count <= 3 {
+			return date.Format("-0700"), true
+		}
+		return date.Format("Z07:00"), true
+	case 'z':
+		return date.Format("MST"), true
+	case 'V':
+		return date.Location().String(), true
+	}
+	return "", false
+}
+
+func isASCIILetter(char byte) bool {
+	return ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+}
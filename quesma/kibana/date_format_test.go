@@ -0,0 +1,43 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package kibana
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	assert.NoError(t, err)
+	date := time.Date(2024, 4, 1, 6, 5, 9, 123_000_000, warsaw)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "strict_date_optional_time", want: "2024-04-01T06:05:09.123+02:00"},
+		{format: "epoch_millis", want: "1711944309123"},
+		{format: "epoch_second", want: "1711944309"},
+		{format: "strict_date||epoch_millis", want: "2024-04-01"},
+		{format: "yyyy-MM-dd HH:mm", want: "2024-04-01 06:05"},
+		{format: "dd/MM/yy h:m:s a", want: "01/04/24 6:5:9 AM"},
+		{format: "EEE, d MMM yyyy", want: "Mon, 1 Apr 2024"},
+		{format: "EEEE MMMM", want: "Monday April"},
+		{format: "yyyy-MM-dd'T'HH:mm:ss.SSSZ", want: "2024-04-01T06:05:09.123+0200"},
+		{format: "'week' e, 'it''s' D/DDD, ''yy", want: "week 1, it's 92/092, '24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, ok := FormatDate(date, tt.format)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, unsupported := range []string{"", "yyyy-MM-dd'T", "yyyy-qq"} {
+		_, ok := FormatDate(date, unsupported)
+		assert.False(t, ok, unsupported)
+	}
+}
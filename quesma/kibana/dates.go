@@ -3,9 +3,11 @@
 package kibana
 
 import (
+	"fmt"
 	"quesma/model"
 	"quesma/util"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,10 @@ func NewDateManager() DateManager {
 	return DateManager{}
 }
 
+// * When date is a single number >= 10000, it's already a unix timestamp (e.g. "10000" -> 10000th second after 01.01.1970)
+// * When date is a single number < 10000, it's a year, so "2345" -> 01.01.2345 00:00
+const yearOrTsDelimiter = 10000
+
 var acceptableDateTimeFormats = []string{"2006", "2006-01", "2006-01-02", "2006-01-02", "2006-01-02T15",
 	"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02T15:04:05Z07", "2006-01-02T15:04:05Z07:00"}
 
@@ -34,27 +40,30 @@ func (dm DateManager) parseStrictDateOptionalTimeOrEpochMillis(date any) (unixTi
 		return -1, false
 	}
 
-	// * When missing is a single number >= 10000, it's already a unix timestamp (e.g. "10000" -> 10000th second after 01.01.1970)
-	//   And we'll fall into one of the ifs below.
-	// * When missing is a single number < 10000, it's a year, so "2345" -> 01.01.2345 00:00
-	//   It'll be caught be one of the formats from the loop below.
-	const yearOrTsDelimiter = 10000
-
 	if asInt, err := strconv.ParseInt(asString, 10, 64); err == nil && asInt >= yearOrTsDelimiter {
 		return dm.parseStrictDateOptionalTimeOrEpochMillis(asInt)
 	} else if asFloat, err := strconv.ParseFloat(asString, 64); err == nil && asFloat >= yearOrTsDelimiter {
 		return dm.parseStrictDateOptionalTimeOrEpochMillis(asFloat)
 	}
 
+	if date, _, success := dm.parseStrictDateOptionalTime(asString); success {
+		return date.UnixMilli(), true
+	}
+
+	return -1, false
+}
+
+// parseStrictDateOptionalTime parses date in strict_date_optional_time format. hasOffset is true if the date has
+// an explicit time zone offset, e.g. 2024-02-25T13:00:00+05:00. If it doesn't, it's parsed as UTC.
+func (dm DateManager) parseStrictDateOptionalTime(date string) (result time.Time, hasOffset bool, parsingSucceeded bool) {
 	// It could be replaced with iso8601.ParseString() after the fixes to 1.4.0:
 	// https://github.com/relvacode/iso8601/pull/26
 	for _, format := range acceptableDateTimeFormats {
-		if date, err := time.Parse(format, asString); err == nil {
-			return date.UnixMilli(), true
+		if result, err := time.Parse(format, date); err == nil {
+			return result, strings.Contains(format, "Z07"), true
 		}
 	}
-
-	return -1, false
+	return time.Time{}, false, false
 }
 
 // ParseMissingInDateHistogram parses date_histogram's missing field.
@@ -67,9 +76,31 @@ func (dm DateManager) ParseMissingInDateHistogram(missing any) (unixTimestamp in
 // ParseRange parses range filter.
 // We assume it's in [strict_date_optional_time || epoch_millis] format (TODO: other formats)
 // (https://www.elastic.co/guide/en/elasticsearch/reference/current/mapping-date-format.html)
-func (dm DateManager) ParseRange(Range any) (timestampExpr model.Expr, parsingSucceeded bool) {
+//
+// If timeZone is not empty, dates without an explicit offset are in that time zone, just like in Elastic.
+// We leave the conversion to ClickHouse (toDateTime64(date, 3, timeZone)), so DST transitions are handled there.
+// Epoch millis and dates with an explicit offset don't depend on timeZone.
+func (dm DateManager) ParseRange(Range any, timeZone string) (timestampExpr model.Expr, parsingSucceeded bool) {
+	if asString, isString := Range.(string); isString && timeZone != "" && !dm.isEpochMillis(asString) {
+		if date, hasOffset, success := dm.parseStrictDateOptionalTime(asString); success && !hasOffset {
+			return DateTimeInTimeZone(date, timeZone), true
+		}
+	}
 	if timestamp, success := dm.parseStrictDateOptionalTimeOrEpochMillis(Range); success {
 		return model.NewFunction("fromUnixTimestamp64Milli", model.NewLiteral(timestamp)), true
 	}
 	return nil, false
 }
+
+// isEpochMillis returns true if date is a number, which parseStrictDateOptionalTimeOrEpochMillis treats as epoch millis (not a year)
+func (dm DateManager) isEpochMillis(date string) bool {
+	asFloat, err := strconv.ParseFloat(date, 64)
+	return err == nil && asFloat >= yearOrTsDelimiter
+}
+
+// DateTimeInTimeZone returns SQL for wall clock time 'date' (its location is ignored) in a given time zone,
+// e.g. toDateTime64('2024-03-31 02:30:00.000', 3, 'Europe/Warsaw')
+func DateTimeInTimeZone(date time.Time, timeZone string) model.Expr {
+	return model.NewFunction("toDateTime64", model.NewLiteral(fmt.Sprintf("'%s'", date.Format("2006-01-02 15:04:05.000"))),
+		model.NewLiteral(3), model.NewLiteral(fmt.Sprintf("'%s'", timeZone)))
+}
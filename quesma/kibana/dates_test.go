@@ -5,6 +5,7 @@ package kibana
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"quesma/model"
 	"testing"
 )
 
@@ -44,3 +45,26 @@ func TestDateManager_parseStrictDateOptionalTimeOrEpochMillis(t *testing.T) {
 		})
 	}
 }
+
+func TestDateManager_ParseRangeWithTimeZone(t *testing.T) {
+	tests := []struct {
+		date     any
+		timeZone string
+		wantSql  string
+	}{
+		{"2024-02-25T13:00:00", "", "fromUnixTimestamp64Milli(1708866000000)"},
+		{"2024-02-25T13:00:00", "Europe/Warsaw", "toDateTime64('2024-02-25 13:00:00.000',3,'Europe/Warsaw')"},
+		{"2024-03-31T02:30:00.123", "Europe/Warsaw", "toDateTime64('2024-03-31 02:30:00.123',3,'Europe/Warsaw')"},
+		{"2024", "America/New_York", "toDateTime64('2024-01-01 00:00:00.000',3,'America/New_York')"},
+		{"2024-02-25T13:00:00+05:00", "Europe/Warsaw", "fromUnixTimestamp64Milli(1708848000000)"},
+		{"1708866000000", "Europe/Warsaw", "fromUnixTimestamp64Milli(1708866000000)"},
+		{int64(1708866000000), "Europe/Warsaw", "fromUnixTimestamp64Milli(1708866000000)"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v %s", tt.date, tt.timeZone), func(t *testing.T) {
+			gotExpr, gotParsingSucceeded := NewDateManager().ParseRange(tt.date, tt.timeZone)
+			assert.True(t, gotParsingSucceeded)
+			assert.Equal(t, tt.wantSql, model.AsString(gotExpr))
+		})
+	}
+}
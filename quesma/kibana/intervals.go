@@ -12,6 +12,8 @@ func ParseInterval(fixedInterval string) (time.Duration, error) {
 	var unit time.Duration
 
 	switch fixedInterval {
+	case "second":
+		return time.Second, nil
 	case "minute":
 		return time.Minute, nil
 	case "hour":
@@ -46,3 +48,17 @@ func ParseInterval(fixedInterval string) (time.Duration, error) {
 
 	return time.Duration(value) * unit, nil
 }
+
+// ParseOffset parses date_histogram's offset, which is an interval preceded by an optional sign, e.g. "+6h", "-1d", "30m"
+func ParseOffset(offset string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(offset, "+"):
+		offset = offset[1:]
+	case strings.HasPrefix(offset, "-"):
+		sign = -1
+		offset = offset[1:]
+	}
+	duration, err := ParseInterval(offset)
+	return sign * duration, err
+}
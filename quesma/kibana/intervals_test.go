@@ -33,3 +33,24 @@ func Test_ParseInterval(t *testing.T) {
 		})
 	}
 }
+
+func Test_ParseOffset(t *testing.T) {
+	tests := []struct {
+		offset string
+		want   time.Duration
+	}{
+		{offset: "6h", want: 6 * time.Hour},
+		{offset: "+6h", want: 6 * time.Hour},
+		{offset: "-1d", want: -24 * time.Hour},
+		{offset: "-30m", want: -30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.offset, func(t *testing.T) {
+			got, err := ParseOffset(tt.offset)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := ParseOffset("+")
+	assert.Error(t, err)
+}
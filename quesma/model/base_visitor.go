@@ -19,6 +19,7 @@ type BaseExprVisitor struct {
 	OverrideVisitParenExpr      func(b *BaseExprVisitor, e ParenExpr) interface{}
 	OverrideVisitLambdaExpr     func(b *BaseExprVisitor, e LambdaExpr) interface{}
 	OverrideVisitJoinExpr       func(b *BaseExprVisitor, e JoinExpr) interface{}
+	OverrideVisitArrayJoinExpr  func(b *BaseExprVisitor, e ArrayJoinExpr) interface{}
 	OverrideVisitCTE            func(b *BaseExprVisitor, e CTE) interface{}
 }
 
@@ -132,6 +133,7 @@ func (v *BaseExprVisitor) VisitWindowFunction(f WindowFunction) interface{} {
 		Args:        v.VisitChildren(f.Args),
 		PartitionBy: v.VisitChildren(f.PartitionBy),
 		OrderBy:     orderBy,
+		Frame:       f.Frame,
 	}
 }
 
@@ -159,6 +161,10 @@ func (v *BaseExprVisitor) VisitSelectCommand(query SelectCommand) interface{} {
 	if query.WhereClause != nil {
 		where = query.WhereClause.Accept(v).(Expr)
 	}
+	having := query.HavingClause
+	if query.HavingClause != nil {
+		having = query.HavingClause.Accept(v).(Expr)
+	}
 
 	var namedCTEs []*CTE
 	if query.NamedCTEs != nil {
@@ -174,7 +180,7 @@ func (v *BaseExprVisitor) VisitSelectCommand(query SelectCommand) interface{} {
 		}
 	}
 
-	return NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+	return NewSelectCommand(columns, groupBy, orderBy, from, where, having, limitBy, query.Limit, query.Offset, query.SampleLimit, query.IsDistinct, namedCTEs)
 }
 
 func (v *BaseExprVisitor) VisitParenExpr(p ParenExpr) interface{} {
@@ -202,6 +208,17 @@ func (v *BaseExprVisitor) VisitJoinExpr(j JoinExpr) interface{} {
 	return NewJoinExpr(j.Lhs.Accept(v).(Expr), j.Rhs.Accept(v).(Expr), j.JoinType, j.On.Accept(v).(Expr))
 }
 
+func (v *BaseExprVisitor) VisitArrayJoinExpr(e ArrayJoinExpr) interface{} {
+	if v.OverrideVisitArrayJoinExpr != nil {
+		return v.OverrideVisitArrayJoinExpr(v, e)
+	}
+	arrays := make([]AliasedExpr, 0, len(e.Arrays))
+	for _, array := range e.Arrays {
+		arrays = append(arrays, array.Accept(v).(AliasedExpr))
+	}
+	return NewArrayJoinExpr(e.Lhs.Accept(v).(Expr), arrays)
+}
+
 func (v *BaseExprVisitor) VisitCTE(e CTE) interface{} {
 	if v.OverrideVisitCTE != nil {
 		return v.OverrideVisitCTE(v, e)
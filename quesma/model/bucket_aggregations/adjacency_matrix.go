@@ -0,0 +1,109 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/model"
+	"quesma/util"
+	"sort"
+)
+
+const (
+	AdjacencyMatrixDefaultSeparator = "&"
+	AdjacencyMatrixMaxFilters       = 100 // Elastic's default of index.max_adjacency_matrix_filters
+)
+
+// AdjacencyMatrix returns a bucket for every named filter (key "A") and for every pair of filters (key "A&B", intersection).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-adjacency-matrix-aggregation.html
+//
+// Buckets are sorted by key, and, just like in Elastic, empty ones are omitted.
+type AdjacencyMatrix struct {
+	ctx   context.Context
+	cells []adjacencyMatrixCell
+}
+
+type adjacencyMatrixCell struct {
+	key         string
+	whereClause model.Expr
+}
+
+// NewAdjacencyMatrix creates all cells of the matrix: filters themselves (diagonal) and intersections of every pair of them
+func NewAdjacencyMatrix(ctx context.Context, filters []Filter, separator string) AdjacencyMatrix {
+	sortedFilters := make([]Filter, len(filters))
+	copy(sortedFilters, filters)
+	sort.Slice(sortedFilters, func(i, j int) bool {
+		return sortedFilters[i].Name < sortedFilters[j].Name
+	})
+
+	cells := make([]adjacencyMatrixCell, 0, len(filters)*(len(filters)+1)/2)
+	for i, filter := range sortedFilters {
+		cells = append(cells, adjacencyMatrixCell{key: filter.Name, whereClause: filter.Sql.WhereClause})
+		for _, other := range sortedFilters[i+1:] {
+			cells = append(cells, adjacencyMatrixCell{
+				key:         filter.Name + separator + other.Name,
+				whereClause: model.And([]model.Expr{filter.Sql.WhereClause, other.Sql.WhereClause}),
+			})
+		}
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		return cells[i].key < cells[j].key
+	})
+	return AdjacencyMatrix{ctx: ctx, cells: cells}
+}
+
+func (query AdjacencyMatrix) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query AdjacencyMatrix) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query AdjacencyMatrix) String() string {
+	return fmt.Sprintf("adjacency_matrix(cells: %d)", len(query.cells))
+}
+
+func (query AdjacencyMatrix) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query AdjacencyMatrix) CombinatorGroups() (result []CombinatorGroup) {
+	for cellIdx, cell := range query.cells {
+		prefix := fmt.Sprintf("filter_%d__", cellIdx)
+		if len(query.cells) == 1 {
+			prefix = ""
+		}
+		result = append(result, CombinatorGroup{
+			idx:         cellIdx,
+			Prefix:      prefix,
+			Key:         cell.key,
+			WhereClause: cell.whereClause,
+		})
+	}
+	return
+}
+
+// CombinatorTranslateSqlResponseToJson returns nil for empty buckets, as they're not returned by Elastic
+func (query AdjacencyMatrix) CombinatorTranslateSqlResponseToJson(subGroup CombinatorGroup, rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		// occasionally we may not have count (e.g. top_hits) and it's ok
+		return model.JsonMap{}
+	}
+	count := rows[0].LastColValue()
+	if util.ExtractInt64(count) == 0 {
+		return nil
+	}
+	return model.JsonMap{
+		"doc_count": count,
+	}
+}
+
+func (query AdjacencyMatrix) CombinatorSplit() []model.QueryType {
+	result := make([]model.QueryType, 0, len(query.cells))
+	for _, cell := range query.cells {
+		result = append(result, AdjacencyMatrix{ctx: query.ctx, cells: []adjacencyMatrixCell{cell}})
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+	"strings"
+)
+
+// Composite aggregation returns buckets of all combinations of values of its sources, sorted by them.
+// It's a single GROUP BY over all sources. Pages after the first one are selected with `after`,
+// which is the key of the last bucket from the previous page (`after_key` in the response).
+type Composite struct {
+	ctx         context.Context
+	size        int
+	sources     []*CompositeSource
+	whereClause model.Expr // skips documents without values and the ones before `after`, nil if none
+}
+
+// CompositeSource is a single source (terms, histogram or date_histogram) of the composite aggregation
+type CompositeSource struct {
+	Name          string
+	Field         model.Expr
+	Expr          model.Expr // key of the source in SQL, e.g. Field or floor(Field/interval)*interval
+	Direction     model.OrderByDirection
+	dateHistogram *DateHistogram // nil if it's not a date_histogram source, its keys need conversion
+}
+
+func NewComposite(ctx context.Context, size int, sources []*CompositeSource, whereClause model.Expr) *Composite {
+	return &Composite{ctx: ctx, size: size, sources: sources, whereClause: whereClause}
+}
+
+func NewCompositeSource(name string, field, expr model.Expr, direction model.OrderByDirection) *CompositeSource {
+	return &CompositeSource{Name: name, Field: field, Expr: expr, Direction: direction}
+}
+
+func NewCompositeDateHistogramSource(name string, dateHistogram *DateHistogram, direction model.OrderByDirection) *CompositeSource {
+	return &CompositeSource{Name: name, Field: dateHistogram.field, Expr: dateHistogram.GenerateSQL(),
+		Direction: direction, dateHistogram: dateHistogram}
+}
+
+// OriginalKey converts a key of our response (e.g. a value from `after`) to the value of Expr
+func (source *CompositeSource) OriginalKey(key any) (any, error) {
+	if source.dateHistogram == nil {
+		return key, nil
+	}
+	var responseKey int64
+	switch keyTyped := key.(type) {
+	case float64:
+		responseKey = int64(keyTyped)
+	case int64:
+		responseKey = keyTyped
+	case int:
+		responseKey = int64(keyTyped)
+	default:
+		return nil, fmt.Errorf("date_histogram key of source %s must be a number of milliseconds, got: %v (%T)", source.Name, key, key)
+	}
+	return source.dateHistogram.responseKeyToOriginalKey(responseKey), nil
+}
+
+func (source *CompositeSource) responseKey(originalKey any) any {
+	if source.dateHistogram == nil {
+		return originalKey
+	}
+	if key, ok := originalKey.(int64); ok {
+		return source.dateHistogram.calculateResponseKey(key)
+	}
+	logger.WarnWithCtx(source.dateHistogram.ctx).Msgf("unexpected type of date_histogram key in composite: %T, value: %v", originalKey, originalKey)
+	return originalKey
+}
+
+func (query *Composite) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query *Composite) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	minimumExpectedColNr := len(query.sources) + 1 // +1 for doc_count
+	if len(rows) > 0 && len(rows[0].Cols) < minimumExpectedColNr {
+		logger.ErrorWithCtx(query.ctx).Msgf(
+			"unexpected number of columns in composite aggregation response, len: %d, expected (at least): %d, rows[0]: %v", len(rows[0].Cols), minimumExpectedColNr, rows[0])
+		return model.JsonMap{}
+	}
+
+	buckets := make([]model.JsonMap, 0, len(rows))
+	for _, row := range rows {
+		keyColumns := row.Cols[len(row.Cols)-minimumExpectedColNr : len(row.Cols)-1] // last col isn't a key, it's doc_count
+		key := make(model.JsonMap, len(query.sources))
+		for i, source := range query.sources {
+			key[source.Name] = source.responseKey(keyColumns[i].Value)
+		}
+		buckets = append(buckets, model.JsonMap{
+			"key":       key,
+			"doc_count": row.Cols[len(row.Cols)-1].Value,
+		})
+	}
+
+	response := model.JsonMap{"buckets": buckets}
+	if len(buckets) > 0 {
+		response["after_key"] = buckets[len(buckets)-1]["key"]
+	}
+	return response
+}
+
+func (query *Composite) String() string {
+	names := make([]string, 0, len(query.sources))
+	for _, source := range query.sources {
+		names = append(names, source.Name)
+	}
+	return fmt.Sprintf("composite(size: %d, sources: %s)", query.size, strings.Join(names, ", "))
+}
+
+// WhereClause returns the condition for documents of the current page, nil if there is none.
+// Composite is always a top level aggregation, so it can be simply added to the query's WHERE clause.
+func (query *Composite) WhereClause() model.Expr {
+	return query.whereClause
+}
@@ -37,6 +37,8 @@ type DateHistogram struct {
 	interval          string
 	timezone          string
 	wantedTimezone    *time.Location // key is in `timezone` time, and we need it to be UTC
+	offset            int64          // in milliseconds, shifts start of every bucket, e.g. "+6h" -> days start at 6:00
+	format            string         // format of key_as_string, "" means default
 	extendedBoundsMin int64
 	extendedBoundsMax int64
 	minDocCount       int
@@ -44,7 +46,7 @@ type DateHistogram struct {
 	fieldDateTimeType clickhouse.DateTimeType
 }
 
-func NewDateHistogram(ctx context.Context, field model.Expr, interval, timezone string, minDocCount int,
+func NewDateHistogram(ctx context.Context, field model.Expr, interval, timezone string, offset int64, format string, minDocCount int,
 	extendedBoundsMin, extendedBoundsMax int64, intervalType DateHistogramIntervalType, fieldDateTimeType clickhouse.DateTimeType) *DateHistogram {
 
 	wantedTimezone, err := time.LoadLocation(timezone)
@@ -52,10 +54,16 @@ func NewDateHistogram(ctx context.Context, field model.Expr, interval, timezone
 		logger.ErrorWithCtx(ctx).Msgf("time.LoadLocation error: %v", err)
 		wantedTimezone = time.UTC
 	}
+	if format != "" {
+		if _, ok := kibana.FormatDate(time.Now(), format); !ok {
+			logger.WarnWithCtx(ctx).Msgf("unsupported date_histogram format: %s. Using default one.", format)
+			format = ""
+		}
+	}
 
 	return &DateHistogram{ctx: ctx, field: field, interval: interval, timezone: timezone, wantedTimezone: wantedTimezone,
-		minDocCount: minDocCount, extendedBoundsMin: extendedBoundsMin, extendedBoundsMax: extendedBoundsMax,
-		intervalType: intervalType, fieldDateTimeType: fieldDateTimeType}
+		offset: offset, format: format, minDocCount: minDocCount, extendedBoundsMin: extendedBoundsMin,
+		extendedBoundsMax: extendedBoundsMax, intervalType: intervalType, fieldDateTimeType: fieldDateTimeType}
 }
 
 func (typ DateHistogramIntervalType) String(ctx context.Context) string {
@@ -114,8 +122,8 @@ func (query *DateHistogram) TranslateSqlResponseToJson(rows []model.QueryResultR
 }
 
 func (query *DateHistogram) String() string {
-	return fmt.Sprintf("date_histogram(field: %v, interval: %v, min_doc_count: %v, timezone: %v",
-		query.field, query.interval, query.minDocCount, query.timezone)
+	return fmt.Sprintf("date_histogram(field: %v, interval: %v, min_doc_count: %v, timezone: %v, offset: %v",
+		query.field, query.interval, query.minDocCount, query.timezone, query.offset)
 }
 
 // only intervals <= days are needed
@@ -159,25 +167,49 @@ func (query *DateHistogram) generateSQLForFixedInterval() model.Expr {
 		logger.ErrorWithCtx(query.ctx).Msgf("invalid date type for DateHistogram %+v. Using DateTime64 as default.", query)
 		dateTimeType = defaultDateTimeType
 	}
-	return clickhouse.TimestampGroupByWithTimezone(query.field, dateTimeType, interval, query.timezone)
+	return clickhouse.TimestampGroupByWithTimezone(query.fieldWithOffset(), dateTimeType, interval, query.timezone)
+}
+
+// fieldWithOffset returns the field moved back by offset, so that buckets computed for it start at (interval's start + offset).
+// Like in Elastic, the time zone's rules are applied to the moved timestamp.
+func (query *DateHistogram) fieldWithOffset() model.Expr {
+	if query.offset == 0 {
+		return query.field
+	}
+	funcNamePrefix, offset := "subtract", query.offset
+	if offset < 0 {
+		funcNamePrefix, offset = "add", -offset
+	}
+	if offset%1000 == 0 {
+		return model.NewFunction(funcNamePrefix+"Seconds", query.field, model.NewLiteral(offset/1000))
+	}
+	return model.NewFunction(funcNamePrefix+"Milliseconds", query.field, model.NewLiteral(offset))
 }
 
 func (query *DateHistogram) generateSQLForCalendarInterval() model.Expr {
 	const defaultTimezone = "UTC"
-	exprForBiggerIntervals := func(toIntervalStartFuncName string) model.Expr {
+	exprForBiggerIntervals := func(toIntervalStartFuncName string, args ...model.Expr) model.Expr {
 		// returned expr as string:
 		// 1000 * toInt64(toUnixTimestamp(toStartOf[Week|Month|Quarter|Year](toTimeZone(timestamp, timezone)))
+		// (+ offset, with timestamp moved back by offset, if offset != 0)
 
 		timezone := query.timezone
 		if timezone == "" {
 			timezone = defaultTimezone
 		}
-		timestampFieldWithOffset := model.NewFunction("toTimezone", query.field, model.NewLiteral(fmt.Sprintf("'%s'", timezone)))
-
-		toStartOf := model.NewFunction(toIntervalStartFuncName, timestampFieldWithOffset) // toStartOfMonth(...) or toStartOfWeek(...)
-		toUnixTimestamp := model.NewFunction("toUnixTimestamp", toStartOf)                // toUnixTimestamp(toStartOf...)
-		toInt64 := model.NewFunction("toInt64", toUnixTimestamp)                          // toInt64(toUnixTimestamp(...))
-		return model.NewInfixExpr(toInt64, "*", model.NewLiteral(1000))                   // toInt64(...)*1000
+		timestampFieldWithOffset := model.NewFunction("toTimezone", query.fieldWithOffset(), model.NewLiteral(fmt.Sprintf("'%s'", timezone)))
+
+		toStartOf := model.NewFunction(toIntervalStartFuncName, append([]model.Expr{timestampFieldWithOffset}, args...)...) // toStartOfMonth(...) or toStartOfWeek(...)
+		toUnixTimestamp := model.NewFunction("toUnixTimestamp", toStartOf)                                                  // toUnixTimestamp(toStartOf...)
+		toInt64 := model.NewFunction("toInt64", toUnixTimestamp)                                                            // toInt64(toUnixTimestamp(...))
+		result := model.NewInfixExpr(toInt64, "*", model.NewLiteral(1000))                                                  // toInt64(...)*1000
+		switch {
+		case query.offset > 0:
+			result = model.NewInfixExpr(result, "+", model.NewLiteral(query.offset))
+		case query.offset < 0:
+			result = model.NewInfixExpr(result, "-", model.NewLiteral(-query.offset))
+		}
+		return result
 	}
 
 	// calendar_interval: minute/hour/day are the same as fixed_interval: 1m/1h/1d
@@ -195,7 +227,7 @@ func (query *DateHistogram) generateSQLForCalendarInterval() model.Expr {
 		query.intervalType = DateHistogramFixedInterval
 		return query.generateSQLForFixedInterval()
 	case "week", "1w":
-		return exprForBiggerIntervals("toStartOfWeek")
+		return exprForBiggerIntervals("toStartOfWeek", model.NewLiteral(1)) // mode 1: weeks start on Monday, like in Elastic
 	case "month", "1M":
 		return exprForBiggerIntervals("toStartOfMonth")
 	case "quarter", "1q":
@@ -212,35 +244,106 @@ func (query *DateHistogram) getKey(row model.QueryResultRow) int64 {
 	return row.Cols[len(row.Cols)-2].Value.(int64)
 }
 
-func (query *DateHistogram) calculateResponseKeyInUTC(originalKey int64) int64 {
+// Keys in "local" time (localKey below) are numbers of milliseconds since epoch of bucket's start wall clock time
+// in query's time zone, as if it was UTC. They're easy to increment and round, without caring about e.g. DST changes.
+
+// originalKeyToLocalKey converts key as it came from our SQL request (e.g. returned by query.getKey) to local time
+func (query *DateHistogram) originalKeyToLocalKey(originalKey int64) int64 {
 	if query.intervalType == DateHistogramCalendarInterval {
 		return originalKey
 	}
 	intervalInMilliseconds := query.intervalAsDuration().Milliseconds()
-	return originalKey * intervalInMilliseconds
+	return originalKey*intervalInMilliseconds + query.offset
+}
+
+// localKeyToOriginalKey is the inverse of originalKeyToLocalKey
+func (query *DateHistogram) localKeyToOriginalKey(localKey int64) int64 {
+	if query.intervalType == DateHistogramCalendarInterval {
+		return localKey
+	}
+	intervalInMilliseconds := query.intervalAsDuration().Milliseconds()
+	if intervalInMilliseconds == 0 {
+		return localKey
+	}
+	return (localKey - query.offset) / intervalInMilliseconds
+}
+
+// localKeyToUTC converts wall clock time in query's time zone to a real timestamp
+func (query *DateHistogram) localKeyToUTC(localKey int64) int64 {
+	ts := time.UnixMilli(localKey).UTC()
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), query.wantedTimezone).UnixMilli()
 }
 
 // originalKey is the key as it came from our SQL request (e.g. returned by query.getKey)
 func (query *DateHistogram) calculateResponseKey(originalKey int64) int64 {
-	keyInUTC := query.calculateResponseKeyInUTC(originalKey)
-
-	ts := time.UnixMilli(keyInUTC)
-	intervalStartNotUTC := time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), query.wantedTimezone)
+	return query.localKeyToUTC(query.originalKeyToLocalKey(originalKey))
+}
 
-	_, timezoneOffsetInSeconds := intervalStartNotUTC.Zone()
-	return keyInUTC - int64(timezoneOffsetInSeconds*1000) // seconds -> milliseconds
+// responseKeyToOriginalKey is the inverse of calculateResponseKey, e.g. for keys sent back to us in composite's `after`
+func (query *DateHistogram) responseKeyToOriginalKey(responseKey int64) int64 {
+	return query.localKeyToOriginalKey(query.fromUTCToWantedTimezone(responseKey))
 }
 
+// fromUTCToWantedTimezone converts a real timestamp to wall clock time in query's time zone (inverse of localKeyToUTC)
 func (query *DateHistogram) fromUTCToWantedTimezone(tsUTC int64) int64 {
-	dateUTC := time.UnixMilli(tsUTC)
-	date := time.Date(dateUTC.Year(), dateUTC.Month(), dateUTC.Day(), dateUTC.Hour(), dateUTC.Minute(), dateUTC.Second(), dateUTC.Nanosecond(), query.wantedTimezone)
-
-	_, timezoneOffsetInSeconds := date.Zone()
+	_, timezoneOffsetInSeconds := time.UnixMilli(tsUTC).In(query.wantedTimezone).Zone()
 	return tsUTC + int64(timezoneOffsetInSeconds*1000) // seconds -> milliseconds
 }
 
+// nextLocalKey returns start of the bucket after the one starting at localKey (both in local time).
+// Month-based calendar intervals have different lengths, so we can't simply add a fixed duration for them.
+func (query *DateHistogram) nextLocalKey(localKey int64) int64 {
+	months, duration, _ := query.MonthsOrDurationOfInterval()
+	if months > 0 {
+		return time.UnixMilli(localKey-query.offset).UTC().AddDate(0, months, 0).UnixMilli() + query.offset
+	}
+	return localKey + duration.Milliseconds()
+}
+
+// firstLocalKeyNotBefore returns start of the first bucket, which starts at localTs or later (both in local time)
+func (query *DateHistogram) firstLocalKeyNotBefore(localTs int64) int64 {
+	months, duration, _ := query.MonthsOrDurationOfInterval()
+	if months > 0 {
+		ts := time.UnixMilli(localTs - query.offset).UTC()
+		firstMonth := time.Month((int(ts.Month())-1)/months*months + 1)
+		key := time.Date(ts.Year(), firstMonth, 1, 0, 0, 0, 0, time.UTC).UnixMilli() + query.offset
+		if key < localTs {
+			key = query.nextLocalKey(key)
+		}
+		return key
+	}
+
+	intervalInMilliseconds := duration.Milliseconds()
+	origin := query.offset
+	if query.intervalType == DateHistogramCalendarInterval && (query.interval == "week" || query.interval == "1w") {
+		origin -= 3 * 24 * time.Hour.Milliseconds() // calendar weeks start on Monday, and 01.01.1970 was Thursday
+	}
+	bucketsFromOrigin := (localTs - origin) / intervalInMilliseconds
+	if (localTs-origin)%intervalInMilliseconds > 0 {
+		bucketsFromOrigin++
+	}
+	return origin + bucketsFromOrigin*intervalInMilliseconds
+}
+
+// canFillGaps returns true if we know how to generate keys of buckets (so that we can add empty ones)
+func (query *DateHistogram) canFillGaps() bool {
+	months, duration, err := query.MonthsOrDurationOfInterval()
+	return err == nil && (months > 0 || duration > 0)
+}
+
+// calculateKeyAsString returns key (timestamp in UTC) in query's time zone, in query's format.
+// Default format is the same as Elastic's, except for UTC, when we skip the time zone.
 func (query *DateHistogram) calculateKeyAsString(key int64) string {
-	return time.UnixMilli(key).UTC().Format("2006-01-02T15:04:05.000") // TODO: check if this necessary Format("2006/01/02 15:04:05")
+	ts := time.UnixMilli(key).In(query.wantedTimezone)
+	if query.format != "" {
+		if keyAsString, ok := kibana.FormatDate(ts, query.format); ok {
+			return keyAsString
+		}
+	}
+	if query.wantedTimezone == time.UTC {
+		return ts.Format("2006-01-02T15:04:05.000")
+	}
+	return ts.Format("2006-01-02T15:04:05.000Z07:00")
 }
 
 func (query *DateHistogram) OriginalKeyToKeyAsString(originalKey any) string {
@@ -248,43 +351,67 @@ func (query *DateHistogram) OriginalKeyToKeyAsString(originalKey any) string {
 	return query.calculateKeyAsString(responseKey)
 }
 
+// OriginalKeyToKey returns the key we return to the user, for the key as it came from our SQL request
+func (query *DateHistogram) OriginalKeyToKey(originalKey int64) int64 {
+	return query.calculateResponseKey(originalKey)
+}
+
+// Field returns the histogram's field, e.g. timestamp
+func (query *DateHistogram) Field() model.Expr {
+	return query.field
+}
+
+// Location returns the time zone of buckets (UTC, if not specified)
+func (query *DateHistogram) Location() *time.Location {
+	return query.wantedTimezone
+}
+
+// MonthsOrDurationOfInterval returns number of months in the interval, if it's a month-based calendar one (month, quarter, year),
+// or duration of the interval otherwise.
+func (query *DateHistogram) MonthsOrDurationOfInterval() (months int, duration time.Duration, err error) {
+	if query.intervalType == DateHistogramCalendarInterval {
+		switch query.interval {
+		case "month", "1M":
+			return 1, 0, nil
+		case "quarter", "1q":
+			return 3, 0, nil
+		case "year", "1y":
+			return 12, 0, nil
+		}
+	}
+	duration, err = kibana.ParseInterval(query.interval)
+	return 0, duration, err
+}
+
 func (query *DateHistogram) SetMinDocCountToZero() {
 	query.minDocCount = 0
 }
 
 func (query *DateHistogram) NewRowsTransformer() model.QueryRowsTransformer {
-	duration, err := kibana.ParseInterval(query.interval)
-	var differenceBetweenTwoNextKeys int64
-	if err == nil {
-		differenceBetweenTwoNextKeys = duration.Milliseconds()
-	} else {
-		// 0 is fine value for differenceBetweenTwoNextKeys, as it means we don't add keys
-		logger.ErrorWithCtx(query.ctx).Err(err)
-	}
-	return &DateHistogramRowsTransformer{dateHistogram: query, MinDocCount: query.minDocCount,
-		differenceBetweenTwoNextKeys: differenceBetweenTwoNextKeys, EmptyValue: 0,
+	return &DateHistogramRowsTransformer{dateHistogram: query, MinDocCount: query.minDocCount, EmptyValue: 0,
 		extendedBoundsMin: query.extendedBoundsMin, extendedBoundsMax: query.extendedBoundsMax}
 }
 
 // we're sure len(row.Cols) >= 2
 
 type DateHistogramRowsTransformer struct {
-	dateHistogram                *DateHistogram
-	differenceBetweenTwoNextKeys int64 // if 0, we don't add keys
-	extendedBoundsMin            int64 // simply copied from DateHistogram
-	extendedBoundsMax            int64 // simply copied from DateHistogram
-	MinDocCount                  int
-	EmptyValue                   any
+	dateHistogram     *DateHistogram
+	extendedBoundsMin int64 // simply copied from DateHistogram
+	extendedBoundsMax int64 // simply copied from DateHistogram
+	MinDocCount       int
+	EmptyValue        any
 }
 
 // if MinDocCount == 0, and we have buckets e.g. [key, value1], [key+10, value2], we need to insert [key+1, 0], [key+2, 0]...
 // Also if extendedBounds are present, we need to add all keys between them.
+// Keys are generated in local time (see DateHistogram.nextLocalKey), so e.g. daily or monthly buckets stay aligned
+// to midnight/month's start in query's time zone, even across DST changes.
 // CAUTION: a different kind of postprocessing is needed for MinDocCount > 1, but I haven't seen any query with that yet, so not implementing it now.
 func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromDB []model.QueryResultRow) []model.QueryResultRow {
-	if qt.MinDocCount != 0 || qt.differenceBetweenTwoNextKeys == 0 {
+	if qt.MinDocCount != 0 || !qt.dateHistogram.canFillGaps() {
 		// we only add empty rows, when
 		// a) MinDocCount == 0
-		// b) we have valid differenceBetweenTwoNextKeys (>0)
+		// b) we know how to generate next keys
 		return rowsFromDB
 	}
 	if qt.MinDocCount < 0 {
@@ -292,6 +419,7 @@ func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromD
 		return rowsFromDB
 	}
 
+	dh := qt.dateHistogram
 	emptyRowsAdded := 0
 	postprocessedRows := make([]model.QueryResultRow, 0, len(rowsFromDB))
 	if len(rowsFromDB) > 0 {
@@ -307,19 +435,11 @@ func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromD
 				i-1, rowsFromDB[i-1], i, rowsFromDB[i],
 			)
 		}
-		lastKey := qt.dateHistogram.calculateResponseKeyInUTC(qt.getKey(rowsFromDB[i-1]))
-		currentKey := qt.dateHistogram.calculateResponseKeyInUTC(qt.getKey(rowsFromDB[i]))
-
-		// ugly, but works, will do for now
-		doWeDivide := (currentKey/qt.getKey(rowsFromDB[i])) >= 100 || (float64(currentKey)/float64(qt.getKey(rowsFromDB[i]))) <= 0.01
-
-		for midKey := lastKey + qt.differenceBetweenTwoNextKeys; midKey < currentKey && emptyRowsAdded < maxEmptyBucketsAdded; midKey += qt.differenceBetweenTwoNextKeys {
+		lastKey := dh.originalKeyToLocalKey(qt.getKey(rowsFromDB[i-1]))
+		currentKey := dh.originalKeyToLocalKey(qt.getKey(rowsFromDB[i]))
+		for midKey := dh.nextLocalKey(lastKey); midKey < currentKey && emptyRowsAdded < maxEmptyBucketsAdded; midKey = dh.nextLocalKey(midKey) {
 			midRow := rowsFromDB[i-1].Copy()
-			divideBy := int64(1)
-			if doWeDivide {
-				divideBy = qt.differenceBetweenTwoNextKeys
-			}
-			midRow.Cols[len(midRow.Cols)-2].Value = midKey / divideBy
+			midRow.Cols[len(midRow.Cols)-2].Value = dh.localKeyToOriginalKey(midKey)
 			midRow.Cols[len(midRow.Cols)-1].Value = qt.EmptyValue
 
 			postprocessedRows = append(postprocessedRows, midRow)
@@ -329,19 +449,14 @@ func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromD
 	}
 
 	// some cases where we don't need to add anything more
-	switch {
-	case qt.extendedBoundsMax == NoExtendedBound && qt.extendedBoundsMin == NoExtendedBound:
-	case len(postprocessedRows) == 0 && (qt.extendedBoundsMax == NoExtendedBound || qt.extendedBoundsMin == NoExtendedBound):
-		return postprocessedRows
-
-	}
 	noBounds := qt.extendedBoundsMax == NoExtendedBound && qt.extendedBoundsMin == NoExtendedBound
 	noRowsAndNotFullyBounded := len(postprocessedRows) == 0 && (qt.extendedBoundsMax == NoExtendedBound || qt.extendedBoundsMin == NoExtendedBound)
 	if noBounds || noRowsAndNotFullyBounded {
 		return postprocessedRows
 	}
 
-	newRow := func(key int64) model.QueryResultRow {
+	newRow := func(localKey int64) model.QueryResultRow {
+		key := dh.localKeyToOriginalKey(localKey)
 		var row model.QueryResultRow
 		if len(postprocessedRows) > 0 {
 			row = postprocessedRows[0].Copy()
@@ -358,21 +473,20 @@ func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromD
 		return row
 	}
 
-	// add "pre" keys, so any needed key between [extendedBoundsMin, first_row_key]
+	// add "pre" keys, so any needed key between [extendedBoundsMin, first_row_key)
 	if qt.extendedBoundsMin != NoExtendedBound {
-		firstRequiredKey := (qt.dateHistogram.fromUTCToWantedTimezone(qt.extendedBoundsMin) + qt.differenceBetweenTwoNextKeys - 1) / qt.differenceBetweenTwoNextKeys
-		var lastRequiredKey int64
+		var isRequired func(localKey int64) bool
 		if len(postprocessedRows) > 0 {
-			lastRequiredKey = qt.getKey(postprocessedRows[0])
-			if qt.dateHistogram.intervalType == DateHistogramCalendarInterval {
-				lastRequiredKey /= qt.differenceBetweenTwoNextKeys
-			}
+			firstRowKey := dh.originalKeyToLocalKey(qt.getKey(postprocessedRows[0]))
+			isRequired = func(localKey int64) bool { return localKey < firstRowKey }
 		} else {
 			// we know qt.extendedBoundsMax != NoExtendedBound, because we would've returned earlier - line below is safe
-			lastRequiredKey = qt.dateHistogram.fromUTCToWantedTimezone(qt.extendedBoundsMax) / qt.differenceBetweenTwoNextKeys
+			lastRequiredKey := dh.fromUTCToWantedTimezone(qt.extendedBoundsMax)
+			isRequired = func(localKey int64) bool { return localKey <= lastRequiredKey }
 		}
-		preRows := make([]model.QueryResultRow, 0, max(0, int(lastRequiredKey-firstRequiredKey)))
-		for preKey := firstRequiredKey; preKey < lastRequiredKey && emptyRowsAdded < maxEmptyBucketsAdded; preKey++ {
+		preRows := make([]model.QueryResultRow, 0)
+		firstRequiredKey := dh.firstLocalKeyNotBefore(dh.fromUTCToWantedTimezone(qt.extendedBoundsMin))
+		for preKey := firstRequiredKey; isRequired(preKey) && emptyRowsAdded < maxEmptyBucketsAdded; preKey = dh.nextLocalKey(preKey) {
 			preRows = append(preRows, newRow(preKey))
 			emptyRowsAdded++
 		}
@@ -380,11 +494,11 @@ func (qt *DateHistogramRowsTransformer) Transform(ctx context.Context, rowsFromD
 		postprocessedRows = append(preRows, postprocessedRows...)
 	}
 
-	// add "post" keys, so any needed key between [last_row_key, extendedBoundsMax]
-	if qt.extendedBoundsMax != NoExtendedBound {
-		firstRequiredKey := qt.dateHistogram.calculateResponseKeyInUTC(qt.getKey(postprocessedRows[len(postprocessedRows)-1]))/qt.differenceBetweenTwoNextKeys + 1
-		lastRequiredKey := qt.dateHistogram.fromUTCToWantedTimezone(qt.extendedBoundsMax) / qt.differenceBetweenTwoNextKeys
-		for postKey := firstRequiredKey; postKey <= lastRequiredKey && emptyRowsAdded < maxEmptyBucketsAdded; postKey++ {
+	// add "post" keys, so any needed key between (last_row_key, extendedBoundsMax]
+	if qt.extendedBoundsMax != NoExtendedBound && len(postprocessedRows) > 0 {
+		firstRequiredKey := dh.nextLocalKey(dh.originalKeyToLocalKey(qt.getKey(postprocessedRows[len(postprocessedRows)-1])))
+		lastRequiredKey := dh.fromUTCToWantedTimezone(qt.extendedBoundsMax)
+		for postKey := firstRequiredKey; postKey <= lastRequiredKey && emptyRowsAdded < maxEmptyBucketsAdded; postKey = dh.nextLocalKey(postKey) {
 			postprocessedRows = append(postprocessedRows, newRow(postKey))
 			emptyRowsAdded++
 		}
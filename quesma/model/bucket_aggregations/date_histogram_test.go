@@ -3,7 +3,9 @@
 package bucket_aggregations
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
+	"quesma/clickhouse"
 	"quesma/model"
 	"testing"
 	"time"
@@ -25,3 +27,27 @@ func TestTranslateSqlResponseToJson(t *testing.T) {
 		intervalType: DateHistogramFixedInterval, wantedTimezone: time.UTC}).TranslateSqlResponseToJson(resultRows)
 	assert.Equal(t, expectedResponse, response)
 }
+
+func TestDateHistogramRowsTransformer_CalendarWeekExtendedBounds(t *testing.T) {
+	const (
+		monday20240325 = int64(1711324800000) // keys are wall clock times in Europe/Warsaw, as if in UTC
+		monday20240401 = int64(1711929600000)
+		monday20240408 = int64(1712534400000)
+	)
+	extendedBoundsMin := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC).UnixMilli() // Wednesday
+	extendedBoundsMax := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC).UnixMilli() // Wednesday
+
+	dateHistogram := NewDateHistogram(context.Background(), model.NewColumnRef("timestamp"), "week", "Europe/Warsaw", 0, "",
+		0, extendedBoundsMin, extendedBoundsMax, DateHistogramCalendarInterval, clickhouse.DateTime64)
+	rows := dateHistogram.NewRowsTransformer().Transform(context.Background(), []model.QueryResultRow{})
+
+	var keys []int64
+	for _, row := range rows {
+		keys = append(keys, row.Cols[0].Value.(int64))
+	}
+	assert.Equal(t, []int64{monday20240325, monday20240401, monday20240408}, keys)
+
+	// 2024-03-31 is the day of DST change in Warsaw, so bucket's start has a different offset than the previous one's
+	assert.Equal(t, "2024-03-25T00:00:00.000+01:00", dateHistogram.OriginalKeyToKeyAsString(monday20240325))
+	assert.Equal(t, "2024-04-01T00:00:00.000+02:00", dateHistogram.OriginalKeyToKeyAsString(monday20240401))
+}
@@ -0,0 +1,41 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/model"
+)
+
+// GeoDistance is a range aggregation over distance of points from the origin, e.g. to draw distance rings.
+// Its Expr is the distance, already expressed in requested unit, so it behaves (almost) exactly like Range.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-geodistance-aggregation.html
+type GeoDistance struct {
+	Range
+}
+
+func NewGeoDistance(ctx context.Context, distance model.Expr, intervals []Interval, keyed bool) GeoDistance {
+	return GeoDistance{Range: NewRange(ctx, distance, intervals, keyed)}
+}
+
+func (query GeoDistance) String() string {
+	return "geo_distance, intervals: " + fmt.Sprintf("%v", query.Intervals)
+}
+
+func (query GeoDistance) CombinatorTranslateSqlResponseToJson(subGroup CombinatorGroup, rows []model.QueryResultRow) model.JsonMap {
+	response := query.Range.CombinatorTranslateSqlResponseToJson(subGroup, rows)
+	if _, exists := response["from"]; !exists {
+		// distance is never negative, and Elastic returns 0 instead of an unbounded 'from'
+		response["from"] = 0.0
+	}
+	return response
+}
+
+func (query GeoDistance) CombinatorSplit() []model.QueryType {
+	result := make([]model.QueryType, 0, len(query.Intervals))
+	for _, interval := range query.Intervals {
+		result = append(result, NewGeoDistance(query.ctx, query.Expr, []Interval{interval}, query.Keyed))
+	}
+	return result
+}
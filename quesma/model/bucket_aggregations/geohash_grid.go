@@ -0,0 +1,63 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"quesma/logger"
+	"quesma/model"
+)
+
+const (
+	GeoHashGridDefaultPrecision = 5
+	GeoHashGridMaxPrecision     = 12
+	GeoGridDefaultSize          = 10000
+)
+
+// GeoHashGrid groups points into cells of a geohash grid. Keys are geohashes of length 'precision', e.g. "u17".
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-geohashgrid-aggregation.html
+type GeoHashGrid struct {
+	ctx       context.Context
+	precision int
+}
+
+func NewGeoHashGrid(ctx context.Context, precision int) GeoHashGrid {
+	return GeoHashGrid{ctx: ctx, precision: precision}
+}
+
+func (query GeoHashGrid) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+// SqlKey returns a SQL expression, which is the key of a bucket: geohash of the point
+func (query GeoHashGrid) SqlKey(lat, lon model.Expr) model.Expr {
+	return model.NewFunction("geohashEncode", model.NewFunction("toFloat64", lon), model.NewFunction("toFloat64", lat),
+		model.NewLiteral(query.precision))
+}
+
+func (query GeoHashGrid) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return geoGridResponse(query.ctx, "geohash_grid", rows)
+}
+
+func (query GeoHashGrid) String() string {
+	return "geohash_grid"
+}
+
+// geoGridResponse returns response for grid aggregations with a single string key (cell's id) per bucket
+func geoGridResponse(ctx context.Context, aggregationName string, rows []model.QueryResultRow) model.JsonMap {
+	var response []model.JsonMap
+	for _, row := range rows {
+		if len(row.Cols) < 2 {
+			logger.ErrorWithCtx(ctx).Msgf("unexpected number of columns in %s aggregation response, len(row.Cols): %d",
+				aggregationName, len(row.Cols))
+			continue
+		}
+		response = append(response, model.JsonMap{
+			"key":       row.Cols[len(row.Cols)-2].Value,
+			"doc_count": row.LastColValue(),
+		})
+	}
+	return model.JsonMap{
+		"buckets": response,
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"quesma/model"
+)
+
+const (
+	GeoHexGridDefaultPrecision = 6
+	GeoHexGridMaxPrecision     = 15
+)
+
+// GeoHexGrid groups points into cells of Uber's H3 hexagonal grid. Keys are H3 indexes as hex strings, e.g. "861f8d797ffffff".
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-geohexgrid-aggregation.html
+type GeoHexGrid struct {
+	ctx       context.Context
+	precision int
+}
+
+func NewGeoHexGrid(ctx context.Context, precision int) GeoHexGrid {
+	return GeoHexGrid{ctx: ctx, precision: precision}
+}
+
+func (query GeoHexGrid) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+// SqlKey returns a SQL expression, which is the key of a bucket: H3 index of the point
+func (query GeoHexGrid) SqlKey(lat, lon model.Expr) model.Expr {
+	h3Index := model.NewFunction("geoToH3", model.NewFunction("toFloat64", lon), model.NewFunction("toFloat64", lat),
+		model.NewLiteral(query.precision))
+	return model.NewFunction("h3ToString", h3Index)
+}
+
+func (query GeoHexGrid) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return geoGridResponse(query.ctx, "geohex_grid", rows)
+}
+
+func (query GeoHexGrid) String() string {
+	return "geohex_grid"
+}
@@ -0,0 +1,41 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"quesma/logger"
+	"quesma/model"
+)
+
+// Global is a single bucket of all documents in the index, regardless of the query.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-global-aggregation.html
+//
+// It can only be a top level aggregation. It gets its own pancake, which doesn't have the query's WHERE clause.
+type Global struct {
+	ctx context.Context
+}
+
+func NewGlobal(ctx context.Context) Global {
+	return Global{ctx: ctx}
+}
+
+func (query Global) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query Global) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for global aggregation")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query Global) String() string {
+	return "global"
+}
+
+func (query Global) DoesNotHaveGroupBy() bool {
+	return true
+}
@@ -4,19 +4,75 @@ package bucket_aggregations
 
 import (
 	"context"
+	"math"
 	"quesma/logger"
 	"quesma/model"
 	"quesma/util"
 )
 
 type Histogram struct {
-	ctx         context.Context
-	interval    float64
-	minDocCount int
+	ctx            context.Context
+	interval       float64
+	offset         float64
+	minDocCount    int
+	extendedBounds HistogramBounds
+	hardBounds     HistogramBounds
 }
 
-func NewHistogram(ctx context.Context, interval float64, minDocCount int) *Histogram {
-	return &Histogram{ctx: ctx, interval: interval, minDocCount: minDocCount}
+// HistogramBounds are histogram's extended_bounds or hard_bounds. Infinities mean no bound.
+type HistogramBounds struct {
+	Min, Max float64
+}
+
+var NoHistogramBounds = HistogramBounds{Min: math.Inf(-1), Max: math.Inf(1)}
+
+func (b HistogramBounds) isUnbounded() bool {
+	return math.IsInf(b.Min, -1) && math.IsInf(b.Max, 1)
+}
+
+func NewHistogram(ctx context.Context, interval, offset float64, minDocCount int, extendedBounds, hardBounds HistogramBounds) *Histogram {
+	return &Histogram{ctx: ctx, interval: interval, offset: offset, minDocCount: minDocCount,
+		extendedBounds: extendedBounds, hardBounds: hardBounds}
+}
+
+// SqlKey returns bucket's key: floor((field - offset) / interval) * interval + offset.
+// If there are hard_bounds, key is NULL outside of them (like in Elastic, we check the key before adding offset),
+// so such documents end up in the empty key bucket, which is filtered out.
+func (query *Histogram) SqlKey(field model.Expr) model.Expr {
+	if query.interval == 1.0 && query.offset == 0 && query.hardBounds.isUnbounded() {
+		return field
+	}
+
+	shiftedField := field
+	if query.offset != 0 {
+		shiftedField = model.NewParenExpr(model.NewInfixExpr(field, "-", model.NewLiteral(query.offset)))
+	}
+	keyWithoutOffset := model.NewInfixExpr(
+		model.NewFunction("floor", model.NewInfixExpr(shiftedField, "/", model.NewLiteral(query.interval))),
+		"*",
+		model.NewLiteral(query.interval),
+	)
+	var key model.Expr = keyWithoutOffset
+	if query.offset != 0 {
+		key = model.NewInfixExpr(keyWithoutOffset, "+", model.NewLiteral(query.offset))
+	}
+
+	if query.hardBounds.isUnbounded() {
+		return key
+	}
+	var inBounds []model.Expr
+	if !math.IsInf(query.hardBounds.Min, -1) {
+		inBounds = append(inBounds, model.NewInfixExpr(keyWithoutOffset, ">=", model.NewLiteral(query.hardBounds.Min)))
+	}
+	if !math.IsInf(query.hardBounds.Max, 1) {
+		inBounds = append(inBounds, model.NewInfixExpr(keyWithoutOffset, "<=", model.NewLiteral(query.hardBounds.Max)))
+	}
+	return model.NewFunction("if", model.And(inBounds), key, model.NewLiteral("NULL"))
+}
+
+// HasEnoughDocs returns true if a bucket with given doc_count should be returned (it's not the case if doc_count < min_doc_count)
+func (query *Histogram) HasEnoughDocs(docCount any) bool {
+	return util.ExtractInt64(docCount) >= int64(query.minDocCount)
 }
 
 func (query *Histogram) AggregationType() model.AggregationType {
@@ -56,28 +112,38 @@ func (query *Histogram) SetMinDocCountToZero() {
 }
 
 func (query *Histogram) NewRowsTransformer() model.QueryRowsTransformer {
+	// extended_bounds can't extend the histogram past hard_bounds
+	extendedBounds := HistogramBounds{
+		Min: max(query.extendedBounds.Min, query.hardBounds.Min),
+		Max: min(query.extendedBounds.Max, query.hardBounds.Max),
+	}
 	return &HistogramRowsTransformer{
-		interval:    query.interval,
-		MinDocCount: query.minDocCount,
+		interval:       query.interval,
+		offset:         query.offset,
+		extendedBounds: extendedBounds,
+		MinDocCount:    query.minDocCount,
 	}
 }
 
 type HistogramRowsTransformer struct {
-	interval    float64
-	MinDocCount int
+	interval       float64
+	offset         float64
+	extendedBounds HistogramBounds
+	MinDocCount    int
 }
 
 // if minDocCount == 0, and we have buckets e.g. [key, value1], [key+2*interval, value2], we need to insert [key+1*interval, 0]
-// CAUTION: a different kind of postprocessing is needed for MinDocCount > 1, but I haven't seen any query with that yet, so not implementing it now.
+// Also if extendedBounds are present, we need to add all keys between them.
+// Buckets with doc_count < MinDocCount (for MinDocCount > 1) are removed later, during JSON rendering (see HasEnoughDocs).
 func (query *HistogramRowsTransformer) Transform(ctx context.Context, rowsFromDB []model.QueryResultRow) []model.QueryResultRow {
-	if query.MinDocCount != 0 || len(rowsFromDB) < 2 {
-		// we only add empty rows, when
-		// a) MinDocCount == 0
-		// b) we have > 1 rows, with < 2 rows we can't add anything in between
+	if query.MinDocCount != 0 {
+		// we only add empty rows, when MinDocCount == 0
 		return rowsFromDB
 	}
 	postprocessedRows := make([]model.QueryResultRow, 0, len(rowsFromDB))
-	postprocessedRows = append(postprocessedRows, rowsFromDB[0])
+	if len(rowsFromDB) > 0 {
+		postprocessedRows = append(postprocessedRows, rowsFromDB[0])
+	}
 
 	getKey := query.getKeyFloat64
 	if query.interval == 1.0 {
@@ -105,7 +171,77 @@ func (query *HistogramRowsTransformer) Transform(ctx context.Context, rowsFromDB
 		}
 		postprocessedRows = append(postprocessedRows, rowsFromDB[i])
 	}
-	return postprocessedRows
+
+	return query.addExtendedBoundsRows(postprocessedRows, getKey)
+}
+
+// addExtendedBoundsRows adds empty rows for all keys between extended bounds' min and the first row,
+// and between the last row and extended bounds' max
+func (query *HistogramRowsTransformer) addExtendedBoundsRows(rows []model.QueryResultRow,
+	getKey func(model.QueryResultRow) (float64, bool)) []model.QueryResultRow {
+
+	minDefined, maxDefined := !math.IsInf(query.extendedBounds.Min, -1), !math.IsInf(query.extendedBounds.Max, 1)
+	if (!minDefined && !maxDefined) || (len(rows) == 0 && (!minDefined || !maxDefined)) {
+		return rows
+	}
+
+	newRow := func(key float64) model.QueryResultRow {
+		if len(rows) == 0 {
+			return model.QueryResultRow{Cols: []model.QueryResultCol{model.NewQueryResultCol("", key), model.NewQueryResultCol("", 0)}}
+		}
+		row := rows[0].Copy()
+		row.Cols[len(row.Cols)-2].Value = key
+		row.Cols[len(row.Cols)-1].Value = 0
+		return row
+	}
+
+	var firstKey, lastKey float64
+	if len(rows) > 0 {
+		var okFirst, okLast bool
+		firstKey, okFirst = getKey(rows[0])
+		lastKey, okLast = getKey(rows[len(rows)-1])
+		if !okFirst || !okLast {
+			return rows
+		}
+	} else {
+		// no rows: all keys from [min, max] are needed, we pretend there's a single bucket just after max
+		firstKey = query.roundKey(query.extendedBounds.Max) + query.interval
+		lastKey = firstKey
+	}
+
+	emptyRowsAdded := 0
+	var preRows []model.QueryResultRow
+	if minDefined {
+		start := query.roundKey(query.extendedBounds.Min)
+		for i := 0; emptyRowsAdded < maxEmptyBucketsAdded; i++ {
+			key := start + float64(i)*query.interval
+			if !util.IsSmaller(key, firstKey) {
+				break
+			}
+			preRows = append(preRows, newRow(key))
+			emptyRowsAdded++
+		}
+	}
+
+	var postRows []model.QueryResultRow
+	if maxDefined && len(rows) > 0 {
+		end := query.roundKey(query.extendedBounds.Max)
+		for i := 1; emptyRowsAdded < maxEmptyBucketsAdded; i++ {
+			key := lastKey + float64(i)*query.interval
+			if util.IsSmaller(end, key) {
+				break
+			}
+			postRows = append(postRows, newRow(key))
+			emptyRowsAdded++
+		}
+	}
+
+	return append(append(preRows, rows...), postRows...)
+}
+
+// roundKey returns key of the bucket, to which value belongs
+func (query *HistogramRowsTransformer) roundKey(value float64) float64 {
+	return math.Floor((value-query.offset)/query.interval)*query.interval + query.offset
 }
 
 // we're sure key is float64
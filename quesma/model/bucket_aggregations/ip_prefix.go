@@ -0,0 +1,127 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+	"strconv"
+)
+
+const (
+	IpPrefixMaxPrefixLengthIpv4 = 32
+	IpPrefixMaxPrefixLengthIpv6 = 128
+)
+
+// IpPrefix groups IP addresses by their network prefix.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-ipprefix-aggregation.html
+//
+// For IPv4 the key is computed as toIPv4(field) bit-and'ed with the netmask (UInt32),
+// for IPv6 as a hex of the first address from IPv6CIDRToRange (fixed length, so ordering is preserved).
+type IpPrefix struct {
+	ctx                context.Context
+	prefixLength       int
+	isIpv6             bool
+	appendPrefixLength bool
+	minDocCount        int
+}
+
+func NewIpPrefix(ctx context.Context, prefixLength int, isIpv6, appendPrefixLength bool, minDocCount int) *IpPrefix {
+	return &IpPrefix{ctx: ctx, prefixLength: prefixLength, isIpv6: isIpv6,
+		appendPrefixLength: appendPrefixLength, minDocCount: minDocCount}
+}
+
+func (query *IpPrefix) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+// SqlKey returns a SQL expression, which is the key of a bucket (network address of the field's value)
+func (query *IpPrefix) SqlKey(field model.Expr) model.Expr {
+	if query.isIpv6 {
+		cidrRange := model.NewFunction("IPv6CIDRToRange", model.NewFunction("toIPv6OrNull", field), model.NewLiteral(query.prefixLength))
+		return model.NewFunction("hex", model.NewFunction("tupleElement", cidrRange, model.NewLiteral(1)))
+	}
+	ip := model.NewFunction("toUInt32", model.NewFunction("toIPv4OrNull", field))
+	return model.NewFunction("bitAnd", ip, model.NewLiteral(query.netmaskIpv4()))
+}
+
+func (query *IpPrefix) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	var response []model.JsonMap
+	for _, row := range rows {
+		if len(row.Cols) < 2 {
+			logger.ErrorWithCtx(query.ctx).Msgf("unexpected number of columns in ip_prefix aggregation response, len: %d", len(row.Cols))
+			continue
+		}
+		docCount := row.LastColValue()
+		if util.ExtractInt64(docCount) < int64(query.minDocCount) {
+			continue
+		}
+		originalKey := row.Cols[len(row.Cols)-2].Value
+		key, ok := query.keyToIp(originalKey)
+		if !ok {
+			logger.WarnWithCtx(query.ctx).Msgf("unexpected key in ip_prefix aggregation: %v (type %T). Skipping bucket.", originalKey, originalKey)
+			continue
+		}
+		bucket := model.JsonMap{
+			OriginalKeyName: originalKey,
+			"key":           key,
+			"doc_count":     docCount,
+			"is_ipv6":       query.isIpv6,
+			"prefix_length": query.prefixLength,
+		}
+		if query.appendPrefixLength {
+			bucket["key"] = key + "/" + strconv.Itoa(query.prefixLength)
+		}
+		if !query.isIpv6 {
+			bucket["netmask"] = query.uint32ToIpv4(query.netmaskIpv4()).String()
+		}
+		response = append(response, bucket)
+	}
+	return model.JsonMap{
+		"buckets": response,
+	}
+}
+
+func (query *IpPrefix) String() string {
+	return fmt.Sprintf("ip_prefix(prefix_length: %d, is_ipv6: %v, append_prefix_length: %v, min_doc_count: %d)",
+		query.prefixLength, query.isIpv6, query.appendPrefixLength, query.minDocCount)
+}
+
+func (query *IpPrefix) netmaskIpv4() uint32 {
+	if query.prefixLength <= 0 {
+		return 0
+	}
+	return ^uint32(0) << (IpPrefixMaxPrefixLengthIpv4 - query.prefixLength)
+}
+
+func (query *IpPrefix) uint32ToIpv4(ip uint32) netip.Addr {
+	var bytes [4]byte
+	binary.BigEndian.PutUint32(bytes[:], ip)
+	return netip.AddrFrom4(bytes)
+}
+
+// keyToIp converts key, as returned from ClickHouse, to IP's string representation
+func (query *IpPrefix) keyToIp(key any) (string, bool) {
+	if query.isIpv6 {
+		keyAsString, ok := key.(string)
+		if !ok {
+			return "", false
+		}
+		bytes, err := hex.DecodeString(keyAsString)
+		if err != nil || len(bytes) != 16 {
+			return "", false
+		}
+		return netip.AddrFrom16([16]byte(bytes)).String(), true
+	}
+	keyAsInt, ok := util.ExtractInt64Maybe(key)
+	if !ok {
+		return "", false
+	}
+	return query.uint32ToIpv4(uint32(keyAsInt)).String(), true
+}
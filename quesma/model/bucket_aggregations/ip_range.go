@@ -0,0 +1,197 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"quesma/logger"
+	"quesma/model"
+)
+
+const ipRangeUnbounded = "*"
+
+// IpInterval is a single range of ip_range aggregation. It's either defined by [From, To) (both may be unbounded),
+// or by Mask (CIDR), in which case From and To are computed from it and only used in the response.
+type IpInterval struct {
+	From string // "" if unbounded
+	To   string // "" if unbounded
+	Mask string // "" if not specified
+	key  string // custom key, "" if not specified
+}
+
+// NewIpInterval creates an interval [from, to). Empty from/to mean unbounded, otherwise they must be IP addresses.
+func NewIpInterval(from, to, key string) (IpInterval, error) {
+	for _, bound := range []string{from, to} {
+		if bound == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(bound)
+		if err != nil {
+			return IpInterval{}, err
+		}
+		if addr.Zone() != "" {
+			return IpInterval{}, fmt.Errorf("IPv6 zone isn't allowed: %s", bound)
+		}
+	}
+	return IpInterval{From: from, To: to, key: key}, nil
+}
+
+// NewIpIntervalFromMask creates an interval from a CIDR mask, e.g. "10.0.0.0/25" or "2001:db8::/32".
+func NewIpIntervalFromMask(mask, key string) (IpInterval, error) {
+	prefix, err := netip.ParsePrefix(mask)
+	if err != nil {
+		return IpInterval{}, err
+	}
+	prefix = prefix.Masked()
+	interval := IpInterval{From: prefix.Addr().String(), Mask: mask, key: key}
+	if next := lastAddrInPrefix(prefix).Next(); next.IsValid() {
+		interval.To = next.String()
+	}
+	return interval, nil
+}
+
+// Key returns key of the bucket in the response, e.g. "10.0.0.0/25", "*-10.0.0.5", or custom one, if specified.
+func (interval IpInterval) Key() string {
+	switch {
+	case interval.key != "":
+		return interval.key
+	case interval.Mask != "":
+		return interval.Mask
+	}
+	from, to := interval.From, interval.To
+	if from == "" {
+		from = ipRangeUnbounded
+	}
+	if to == "" {
+		to = ipRangeUnbounded
+	}
+	return from + "-" + to
+}
+
+// ToWhereClause returns a condition for the interval, just like we want it in SQL's WHERE
+func (interval IpInterval) ToWhereClause(field model.Expr) model.Expr {
+	if interval.Mask != "" {
+		return model.NewFunction("isIPAddressInRange", field, model.NewLiteral(fmt.Sprintf("'%s'", interval.Mask)))
+	}
+
+	// toIPv6 maps IPv4 addresses into ::ffff:0:0/96, so comparisons work for both IPv4 and IPv6
+	ip := model.NewFunction("toIPv6OrNull", field)
+	var sqlLeft, sqlRight model.Expr
+	if interval.From != "" {
+		sqlLeft = model.NewInfixExpr(ip, ">=", model.NewFunction("toIPv6", model.NewLiteral(fmt.Sprintf("'%s'", interval.From))))
+	}
+	if interval.To != "" {
+		sqlRight = model.NewInfixExpr(ip, "<", model.NewFunction("toIPv6", model.NewLiteral(fmt.Sprintf("'%s'", interval.To))))
+	}
+	switch {
+	case sqlLeft != nil && sqlRight != nil:
+		return model.NewInfixExpr(sqlLeft, "AND", sqlRight)
+	case sqlLeft != nil:
+		return sqlLeft
+	case sqlRight != nil:
+		return sqlRight
+	default:
+		return model.NewInfixExpr(field, "IS", model.NewLiteral("NOT NULL"))
+	}
+}
+
+func lastAddrInPrefix(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 1 << (7 - bit%8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+type IpRange struct {
+	ctx       context.Context
+	field     model.Expr
+	intervals []IpInterval
+	// defines what response should look like
+	// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-iprange-aggregation.html#_keyed_response_2
+	Keyed bool
+}
+
+func NewIpRange(ctx context.Context, field model.Expr, intervals []IpInterval, keyed bool) IpRange {
+	return IpRange{ctx: ctx, field: field, intervals: intervals, Keyed: keyed}
+}
+
+func (query IpRange) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query IpRange) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) != 1 || len(rows[0].Cols) < len(query.intervals) {
+		logger.ErrorWithCtx(query.ctx).Msgf("unexpected response in ip_range aggregation: %d rows, expected 1 with %d columns",
+			len(rows), len(query.intervals))
+		return model.JsonMap{}
+	}
+	countCols := rows[0].Cols[len(rows[0].Cols)-len(query.intervals):]
+	var buckets []model.JsonMap
+	for i, interval := range query.intervals {
+		bucket := query.responseForInterval(interval, countCols[i].Value)
+		bucket["key"] = interval.Key()
+		buckets = append(buckets, bucket)
+	}
+	return model.JsonMap{
+		"buckets": buckets,
+	}
+}
+
+func (query IpRange) String() string {
+	return fmt.Sprintf("ip_range(field: %v, intervals: %v, keyed: %v)", query.field, query.intervals, query.Keyed)
+}
+
+func (query IpRange) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query IpRange) CombinatorGroups() (result []CombinatorGroup) {
+	for intervalIdx, interval := range query.intervals {
+		prefix := fmt.Sprintf("range_%d__", intervalIdx)
+		if len(query.intervals) == 1 {
+			prefix = ""
+		}
+		result = append(result, CombinatorGroup{
+			idx:         intervalIdx,
+			Prefix:      prefix,
+			Key:         interval.Key(),
+			WhereClause: interval.ToWhereClause(query.field),
+		})
+	}
+	return
+}
+
+func (query IpRange) CombinatorTranslateSqlResponseToJson(subGroup CombinatorGroup, rows []model.QueryResultRow) model.JsonMap {
+	var count any
+	if len(rows) > 0 && len(rows[0].Cols) > 0 {
+		// occasionally we may not have count (e.g. top_hits) and it's ok
+		count = rows[0].Cols[len(rows[0].Cols)-1].Value
+	}
+	return query.responseForInterval(query.intervals[subGroup.idx], count)
+}
+
+func (query IpRange) responseForInterval(interval IpInterval, count any) model.JsonMap {
+	response := model.JsonMap{}
+	if count != nil {
+		response["doc_count"] = count
+	}
+	if interval.From != "" {
+		response["from"] = interval.From
+	}
+	if interval.To != "" {
+		response["to"] = interval.To
+	}
+	return response
+}
+
+func (query IpRange) CombinatorSplit() []model.QueryType {
+	result := make([]model.QueryType, 0, len(query.intervals))
+	for _, interval := range query.intervals {
+		result = append(result, NewIpRange(query.ctx, query.field, []IpInterval{interval}, query.Keyed))
+	}
+	return result
+}
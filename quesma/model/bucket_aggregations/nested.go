@@ -0,0 +1,69 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+	"slices"
+	"strings"
+)
+
+// Nested is a single bucket of nested objects (arrays of objects, see ADR 5) under given path.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-nested-aggregation.html
+//
+// It can only be a top level aggregation. It gets its own pancake, in which arrays under the path are unfolded
+// with ARRAY JOIN, so every nested object is a separate row, and doc_count is the number of nested objects.
+// Arrays of different fields may have different lengths, so they're zipped (and padded with NULLs) into a single array.
+type Nested struct {
+	ctx  context.Context
+	path string
+	// internal names of nested objects' fields (from schema), sorted
+	fields []string
+}
+
+func NewNested(ctx context.Context, path string, fields []string) Nested {
+	return Nested{ctx: ctx, path: path, fields: fields}
+}
+
+func (query Nested) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query Nested) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for nested aggregation")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query Nested) String() string {
+	return fmt.Sprintf("nested(path: %s)", query.path)
+}
+
+func (query Nested) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+func (query Nested) Path() string {
+	return query.path
+}
+
+// Fields returns internal names of nested objects' fields known from schema
+func (query Nested) Fields() []string {
+	return query.fields
+}
+
+// IsUnderPath returns true if the field is a field of the nested objects, e.g. "resellers.price" for path "resellers".
+// Fields not found in schema are referred to by their original names, so we check the prefix as well.
+func (query Nested) IsUnderPath(fieldName string) bool {
+	return slices.Contains(query.fields, fieldName) || strings.HasPrefix(fieldName, query.path+".")
+}
+
+// ArrayJoinAlias returns the alias, under which nested object's field is available after ARRAY JOIN
+func (query Nested) ArrayJoinAlias(fieldName string) string {
+	return "nested__" + fieldName
+}
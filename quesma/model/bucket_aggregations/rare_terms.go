@@ -0,0 +1,65 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+)
+
+const (
+	RareTermsDefaultMaxDocCount = 1
+	RareTermsMaxMaxDocCount     = 100
+)
+
+// RareTerms returns terms which appear in at most maxDocCount documents, sorted by (doc_count ASC, key ASC).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-rare-terms-aggregation.html
+//
+// It's a terms aggregation with 'HAVING count() <= maxDocCount' (or equivalent WHERE in the outer query, if there are
+// more bucket aggregations). Unlike in Elastic, where it's approximate, our results are exact.
+type RareTerms struct {
+	ctx         context.Context
+	maxDocCount int
+}
+
+func NewRareTerms(ctx context.Context, maxDocCount int) RareTerms {
+	return RareTerms{ctx: ctx, maxDocCount: maxDocCount}
+}
+
+func (query RareTerms) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+// CountCondition returns a condition, which bucket's count has to satisfy to be returned
+func (query RareTerms) CountCondition(count model.Expr) model.Expr {
+	return model.NewInfixExpr(count, "<=", model.NewLiteral(query.maxDocCount))
+}
+
+// IsRare returns true if a bucket with given doc_count should be returned
+func (query RareTerms) IsRare(docCount any) bool {
+	return util.ExtractInt64(docCount) <= int64(query.maxDocCount)
+}
+
+func (query RareTerms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	var response []model.JsonMap
+	for _, row := range rows {
+		if len(row.Cols) < 2 {
+			logger.ErrorWithCtx(query.ctx).Msgf("unexpected number of columns in rare_terms aggregation response, len(row.Cols): %d", len(row.Cols))
+			continue
+		}
+		response = append(response, model.JsonMap{
+			"key":       row.Cols[len(row.Cols)-2].Value,
+			"doc_count": row.LastColValue(),
+		})
+	}
+	return model.JsonMap{
+		"buckets": response,
+	}
+}
+
+func (query RareTerms) String() string {
+	return fmt.Sprintf("rare_terms(max_doc_count: %d)", query.maxDocCount)
+}
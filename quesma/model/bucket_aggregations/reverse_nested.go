@@ -0,0 +1,49 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"quesma/logger"
+	"quesma/model"
+)
+
+// ReverseNested is a single bucket of parent documents of nested objects from the enclosing nested aggregation.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-reverse-nested-aggregation.html
+//
+// After ARRAY JOIN every nested object is a separate row, so here (and in bucket aggregations below) we count
+// distinct parent rows instead, identified by ClickHouse's virtual columns _part and _part_offset.
+// Metric aggregations below aren't supported: they'd still see the unfolded rows, so e.g. sum would take
+// a parent's value once for every of its matching nested objects.
+type ReverseNested struct {
+	ctx context.Context
+}
+
+func NewReverseNested(ctx context.Context) ReverseNested {
+	return ReverseNested{ctx: ctx}
+}
+
+func (query ReverseNested) AggregationType() model.AggregationType {
+	return model.BucketAggregation
+}
+
+func (query ReverseNested) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 {
+		logger.WarnWithCtx(query.ctx).Msg("no rows returned for reverse_nested aggregation")
+		return make(model.JsonMap, 0)
+	}
+	return model.JsonMap{"doc_count": rows[0].Cols[0].Value}
+}
+
+func (query ReverseNested) String() string {
+	return "reverse_nested"
+}
+
+func (query ReverseNested) DoesNotHaveGroupBy() bool {
+	return true
+}
+
+// CountParentsExpr returns expression counting distinct parent documents, used instead of count(*)
+func (query ReverseNested) CountParentsExpr() model.Expr {
+	return model.NewFunction("uniqExact", model.NewFunction("tuple", model.NewLiteral("_part"), model.NewLiteral("_part_offset")))
+}
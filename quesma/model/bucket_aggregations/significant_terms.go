@@ -0,0 +1,240 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+	"sort"
+)
+
+// SignificanceHeuristic scores a term by comparing its frequency in the foreground set (subset)
+// with its frequency in the background set (superset).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-significantterms-aggregation.html#_parameters_5
+type SignificanceHeuristic interface {
+	Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64
+	String() string
+}
+
+// JLH is the default heuristic: absolute change in popularity * relative change in popularity
+type JLH struct{}
+
+func (JLH) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	if subsetSize == 0 || supersetSize == 0 {
+		return 0
+	}
+	if supersetFreq == 0 {
+		supersetFreq = 1 // avoid division by zero, like Elastic does
+	}
+	subsetProbability := float64(subsetFreq) / float64(subsetSize)
+	supersetProbability := float64(supersetFreq) / float64(supersetSize)
+	absoluteProbabilityChange := subsetProbability - supersetProbability
+	if absoluteProbabilityChange <= 0 {
+		return 0
+	}
+	return absoluteProbabilityChange * (subsetProbability / supersetProbability)
+}
+
+func (JLH) String() string {
+	return "jlh"
+}
+
+// ChiSquare and MutualInformation are computed from the contingency table of (term present, document in subset).
+type ChiSquare struct {
+	IncludeNegatives     bool // if false, terms less frequent in the subset than outside of it get -Inf
+	BackgroundIsSuperset bool // if false, the background set doesn't contain the subset
+}
+
+func (h ChiSquare) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	f := newSignificanceFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize, h.BackgroundIsSuperset)
+	if !h.IncludeNegatives && f.n11/f.nX1 < f.n10/f.nX0 {
+		return math.Inf(-1)
+	}
+	return f.n * math.Pow(f.n11*f.n00-f.n01*f.n10, 2) / (f.nX1 * f.n1X * f.n0X * f.nX0)
+}
+
+func (h ChiSquare) String() string {
+	return "chi_square"
+}
+
+type MutualInformation struct {
+	IncludeNegatives     bool // if false, terms less frequent in the subset than outside of it get -Inf
+	BackgroundIsSuperset bool // if false, the background set doesn't contain the subset
+}
+
+func (h MutualInformation) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	f := newSignificanceFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize, h.BackgroundIsSuperset)
+	term := func(nXY, nXAny, nAnyY float64) float64 {
+		numerator := math.Abs(f.n * nXY)
+		denominator := math.Abs(nXAny * nAnyY)
+		factor := math.Abs(nXY / f.n)
+		if numerator < 1e-7 && factor < 1e-7 {
+			return 0
+		}
+		return factor * math.Log(numerator/denominator)
+	}
+	score := (term(f.n00, f.n0X, f.nX0) + term(f.n01, f.n0X, f.nX1) + term(f.n10, f.n1X, f.nX0) + term(f.n11, f.n1X, f.nX1)) / math.Log(2)
+	if math.IsNaN(score) || (!h.IncludeNegatives && f.n11/f.nX1 < f.n10/f.nX0) {
+		return math.Inf(-1)
+	}
+	return score
+}
+
+func (h MutualInformation) String() string {
+	return "mutual_information"
+}
+
+// GND is Google Normalized Distance, https://arxiv.org/pdf/cs/0412098v3.pdf
+type GND struct {
+	BackgroundIsSuperset bool // if false, the background set doesn't contain the subset
+}
+
+func (h GND) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	fx, fy, fxy, n := float64(supersetFreq), float64(subsetSize), float64(subsetFreq), float64(supersetSize)
+	if !h.BackgroundIsSuperset {
+		fx += float64(subsetFreq)
+		n += float64(subsetSize)
+	}
+	if fxy == 0 || fx == 0 || fy == 0 {
+		return 0
+	}
+	numerator := math.Max(math.Log(fx), math.Log(fy)) - math.Log(fxy)
+	denominator := math.Log(n) - math.Min(math.Log(fx), math.Log(fy))
+	if denominator == 0 {
+		return 0
+	}
+	// GND is a distance, so it's low for significant terms, we need to invert it
+	return math.Exp(-numerator / denominator)
+}
+
+func (h GND) String() string {
+	return "gnd"
+}
+
+// Percentage is the number of documents with the term in the subset divided by the number of them in the background
+type Percentage struct{}
+
+func (Percentage) Score(subsetFreq, subsetSize, supersetFreq, supersetSize int64) float64 {
+	if supersetFreq == 0 {
+		return 0
+	}
+	return float64(subsetFreq) / float64(supersetFreq)
+}
+
+func (Percentage) String() string {
+	return "percentage"
+}
+
+// significanceFrequencies is the contingency table: nXY - number of documents with (X: term present, Y: in subset),
+// with 0X/X0 etc. being sums over the other dimension, and n - number of all documents
+type significanceFrequencies struct {
+	n00, n01, n10, n11, n0X, n1X, nX0, nX1, n float64
+}
+
+func newSignificanceFrequencies(subsetFreq, subsetSize, supersetFreq, supersetSize int64, backgroundIsSuperset bool) significanceFrequencies {
+	subFreq, subSize, superFreq, superSize := float64(subsetFreq), float64(subsetSize), float64(supersetFreq), float64(supersetSize)
+	if backgroundIsSuperset {
+		return significanceFrequencies{
+			n00: superSize - superFreq - (subSize - subFreq),
+			n01: subSize - subFreq,
+			n10: superFreq - subFreq,
+			n11: subFreq,
+			n0X: superSize - superFreq,
+			n1X: superFreq,
+			nX0: superSize - subSize,
+			nX1: subSize,
+			n:   superSize,
+		}
+	}
+	return significanceFrequencies{
+		n00: superSize - superFreq,
+		n01: subSize - subFreq,
+		n10: superFreq,
+		n11: subFreq,
+		n0X: superSize - superFreq + subSize - subFreq,
+		n1X: superFreq + subFreq,
+		nX0: superSize,
+		nX1: subSize,
+		n:   superSize + subSize,
+	}
+}
+
+// SignificantTermsBackground is shared by a significant_terms aggregation (Terms) and the additional query,
+// which fetches frequencies of its terms in the background set (it's that query's Type).
+// Results of the additional query have to be set (SetBackgroundRows) before foreground buckets are rendered.
+type SignificantTermsBackground struct {
+	ctx              context.Context
+	heuristic        SignificanceHeuristic
+	size             int
+	minDocCount      int64
+	backgroundFilter model.Expr // nil <=> background is the whole index
+
+	fetched      bool
+	frequencies  map[string]int64 // key (as string) -> number of documents with it in the background set
+	supersetSize int64
+}
+
+func NewSignificantTermsBackground(ctx context.Context, heuristic SignificanceHeuristic, size, minDocCount int,
+	backgroundFilter model.Expr) *SignificantTermsBackground {
+	return &SignificantTermsBackground{ctx: ctx, heuristic: heuristic, size: size, minDocCount: int64(minDocCount),
+		backgroundFilter: backgroundFilter}
+}
+
+func (query *SignificantTermsBackground) AggregationType() model.AggregationType {
+	return model.TypicalAggregation
+}
+
+// TranslateSqlResponseToJson returns nothing, background frequencies are only a part of significant_terms response
+func (query *SignificantTermsBackground) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query *SignificantTermsBackground) String() string {
+	return fmt.Sprintf("significant_terms background(heuristic: %s)", query.heuristic)
+}
+
+func (query *SignificantTermsBackground) BackgroundFilter() model.Expr {
+	return query.backgroundFilter
+}
+
+// SetBackgroundRows sets results of the background query. Each row is: key, its count, count of all documents.
+func (query *SignificantTermsBackground) SetBackgroundRows(rows []model.QueryResultRow) {
+	query.fetched = true
+	query.frequencies = make(map[string]int64, len(rows))
+	query.supersetSize = 0
+	for _, row := range rows {
+		if len(row.Cols) < 3 {
+			logger.ErrorWithCtx(query.ctx).Msgf("unexpected number of columns in significant_terms background row: %v", row)
+			continue
+		}
+		query.frequencies[fmt.Sprint(row.Cols[0].Value)] = util.ExtractInt64(row.Cols[1].Value)
+		query.supersetSize = util.ExtractInt64(row.Cols[2].Value)
+	}
+}
+
+type significantBucket struct {
+	rowIdx       int
+	score        float64
+	supersetFreq int64
+}
+
+// scoredBuckets returns buckets which should be in the response: significant enough, sorted by score, at most `size`
+func (query *SignificantTermsBackground) scoredBuckets(subsetSize int64, keys []any, docCounts []int64) []significantBucket {
+	buckets := make([]significantBucket, 0, len(keys))
+	for i, key := range keys {
+		supersetFreq := query.frequencies[fmt.Sprint(key)]
+		score := query.heuristic.Score(docCounts[i], subsetSize, supersetFreq, query.supersetSize)
+		if score > 0 && docCounts[i] >= query.minDocCount {
+			buckets = append(buckets, significantBucket{rowIdx: i, score: score, supersetFreq: supersetFreq})
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].score > buckets[j].score })
+	if len(buckets) > query.size {
+		buckets = buckets[:query.size]
+	}
+	return buckets
+}
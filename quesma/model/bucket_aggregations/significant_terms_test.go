@@ -0,0 +1,57 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"quesma/model"
+	"testing"
+)
+
+func TestSignificanceHeuristics(t *testing.T) {
+	// term is in 30 of 100 foreground documents, and in 40 of 1000 background documents
+	const subsetFreq, subsetSize, supersetFreq, supersetSize = 30, 100, 40, 1000
+	testcases := []struct {
+		heuristic     SignificanceHeuristic
+		expectedScore float64
+	}{
+		{JLH{}, 1.95},
+		{ChiSquare{BackgroundIsSuperset: true}, 195.60185185185185},
+		{GND{BackgroundIsSuperset: true}, 0.687952707992964},
+		{Percentage{}, 0.75},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.heuristic.String(), func(t *testing.T) {
+			assert.InDelta(t, tc.expectedScore, tc.heuristic.Score(subsetFreq, subsetSize, supersetFreq, supersetSize), 1e-9)
+		})
+	}
+
+	// term less frequent in the foreground than in the background isn't significant
+	assert.Equal(t, 0.0, JLH{}.Score(10, 100, 500, 1000))
+	assert.Equal(t, math.Inf(-1), ChiSquare{BackgroundIsSuperset: true}.Score(10, 100, 500, 1000))
+	assert.Equal(t, math.Inf(-1), MutualInformation{BackgroundIsSuperset: true}.Score(10, 100, 500, 1000))
+	assert.Greater(t, ChiSquare{IncludeNegatives: true, BackgroundIsSuperset: true}.Score(10, 100, 500, 1000), 0.0)
+	assert.Greater(t, MutualInformation{BackgroundIsSuperset: true}.Score(subsetFreq, subsetSize, supersetFreq, supersetSize), 0.0)
+}
+
+func TestSignificantTermsBackgroundScoredBuckets(t *testing.T) {
+	background := NewSignificantTermsBackground(context.Background(), JLH{}, 2, 3, nil)
+	background.SetBackgroundRows([]model.QueryResultRow{
+		{Cols: []model.QueryResultCol{model.NewQueryResultCol("key", "a"), model.NewQueryResultCol("bg_count", int64(300)), model.NewQueryResultCol("bg_total", int64(1000))}},
+		{Cols: []model.QueryResultCol{model.NewQueryResultCol("key", "b"), model.NewQueryResultCol("bg_count", int64(40)), model.NewQueryResultCol("bg_total", int64(1000))}},
+		{Cols: []model.QueryResultCol{model.NewQueryResultCol("key", "c"), model.NewQueryResultCol("bg_count", int64(2)), model.NewQueryResultCol("bg_total", int64(1000))}},
+		{Cols: []model.QueryResultCol{model.NewQueryResultCol("key", "d"), model.NewQueryResultCol("bg_count", int64(5)), model.NewQueryResultCol("bg_total", int64(1000))}},
+		{Cols: []model.QueryResultCol{model.NewQueryResultCol("key", "e"), model.NewQueryResultCol("bg_count", int64(600)), model.NewQueryResultCol("bg_total", int64(1000))}},
+	})
+
+	// "c" has too low doc_count, "e" isn't significant, and only 2 best of the remaining ones are returned
+	buckets := background.scoredBuckets(100, []any{"a", "b", "c", "d", "e"}, []int64{50, 30, 2, 10, 8})
+	rowIndexes := make([]int, 0, len(buckets))
+	for _, bucket := range buckets {
+		rowIndexes = append(rowIndexes, bucket.rowIdx)
+	}
+	assert.Equal(t, []int{1, 3}, rowIndexes)
+	assert.Equal(t, int64(40), buckets[0].supersetFreq)
+}
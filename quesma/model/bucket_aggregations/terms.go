@@ -13,12 +13,17 @@ type Terms struct {
 	ctx         context.Context
 	significant bool // true <=> significant_terms, false <=> terms
 	OrderByExpr model.Expr
+	background  *SignificantTermsBackground // only for significant_terms, nil if we don't score buckets
 }
 
 func NewTerms(ctx context.Context, significant bool, orderByExpr model.Expr) Terms {
 	return Terms{ctx: ctx, significant: significant, OrderByExpr: orderByExpr}
 }
 
+func NewSignificantTerms(ctx context.Context, orderByExpr model.Expr, background *SignificantTermsBackground) Terms {
+	return Terms{ctx: ctx, significant: true, OrderByExpr: orderByExpr, background: background}
+}
+
 func (query Terms) AggregationType() model.AggregationType {
 	return model.BucketAggregation
 }
@@ -31,6 +36,9 @@ func (query Terms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model
 	if len(rows) == 0 {
 		return model.JsonMap{}
 	}
+	if query.significant && query.background != nil && query.background.fetched {
+		return query.significantTermsResponse(rows)
+	}
 
 	var response []model.JsonMap
 	for _, row := range rows {
@@ -63,6 +71,55 @@ func (query Terms) TranslateSqlResponseToJson(rows []model.QueryResultRow) model
 	}
 }
 
+// significantTermsResponse scores buckets with background frequencies, so it's different than plain terms:
+// insignificant buckets are skipped and the remaining ones are sorted by score.
+func (query Terms) significantTermsResponse(rows []model.QueryResultRow) model.JsonMap {
+	subsetSize := util.ExtractInt64(query.parentCount(rows[0]))
+	response := make([]model.JsonMap, 0, len(rows))
+	for _, bucket := range query.significantBuckets(rows) {
+		row := rows[bucket.rowIdx]
+		response = append(response, model.JsonMap{
+			"key":       query.key(row),
+			"doc_count": query.docCount(row),
+			"score":     bucket.score,
+			"bg_count":  bucket.supersetFreq,
+		})
+	}
+	return model.JsonMap{
+		"buckets":   response,
+		"doc_count": subsetSize,
+		"bg_count":  query.background.supersetSize,
+	}
+}
+
+func (query Terms) significantBuckets(rows []model.QueryResultRow) []significantBucket {
+	keys := make([]any, 0, len(rows))
+	docCounts := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, query.key(row))
+		docCounts = append(docCounts, util.ExtractInt64(query.docCount(row)))
+	}
+	return query.background.scoredBuckets(util.ExtractInt64(query.parentCount(rows[0])), keys, docCounts)
+}
+
+// SignificantBucketsOrder returns indexes of rows, which are buckets in the response, in the response's order.
+// Needed to match buckets with their subaggregations, as significant_terms reorders them.
+// Returns false if there's no reordering (it's not significant_terms or there are no background frequencies).
+func (query Terms) SignificantBucketsOrder(rows []model.QueryResultRow) (order []int, reordered bool) {
+	if !query.significant || query.background == nil || !query.background.fetched || len(rows) == 0 {
+		return nil, false
+	}
+	for _, bucket := range query.significantBuckets(rows) {
+		order = append(order, bucket.rowIdx)
+	}
+	return order, true
+}
+
+// Background returns the background of significant_terms, nil for terms
+func (query Terms) Background() *SignificantTermsBackground {
+	return query.background
+}
+
 func (query Terms) String() string {
 	if !query.significant {
 		return "terms"
@@ -0,0 +1,91 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package bucket_aggregations
+
+import (
+	"context"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"reflect"
+)
+
+const VariableWidthHistogramDefaultBuckets = 10
+
+// VariableWidthHistogram returns (at most) 'buckets' buckets of different widths, adapted to the data.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-variablewidthhistogram-aggregation.html
+//
+// We use ClickHouse's histogram(buckets)(field), which returns an array of (lower, upper, height) tuples.
+// It's a single aggregate function (no GROUP BY), so we treat this aggregation as a metric one - and that's also why
+// subaggregations aren't supported. Differences from Elastic: bucket's key is the middle of the bucket, not its centroid,
+// and doc_count is approximate (ClickHouse returns fractional heights, which we round).
+type VariableWidthHistogram struct {
+	ctx context.Context
+}
+
+func NewVariableWidthHistogram(ctx context.Context) VariableWidthHistogram {
+	return VariableWidthHistogram{ctx: ctx}
+}
+
+func (query VariableWidthHistogram) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query VariableWidthHistogram) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	buckets := make([]model.JsonMap, 0)
+	if len(rows) == 0 || len(rows[0].Cols) == 0 {
+		logger.WarnWithCtx(query.ctx).Msgf("no rows returned for variable_width_histogram aggregation")
+		return model.JsonMap{"buckets": buckets}
+	}
+	histogram, ok := query.parseHistogram(rows[0].LastColValue())
+	if !ok {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected histogram in variable_width_histogram aggregation: %v (type %T)",
+			rows[0].LastColValue(), rows[0].LastColValue())
+	}
+	for _, bin := range histogram {
+		lower, upper, height := bin[0], bin[1], bin[2]
+		docCount := int64(math.Round(height))
+		if docCount == 0 {
+			continue
+		}
+		buckets = append(buckets, model.JsonMap{
+			"min":       lower,
+			"key":       (lower + upper) / 2,
+			"max":       upper,
+			"doc_count": docCount,
+		})
+	}
+	return model.JsonMap{"buckets": buckets}
+}
+
+func (query VariableWidthHistogram) String() string {
+	return "variable_width_histogram"
+}
+
+// parseHistogram parses result of ClickHouse's histogram: an array of (lower, upper, height) tuples
+func (query VariableWidthHistogram) parseHistogram(value any) (bins [][3]float64, ok bool) {
+	if value == nil {
+		return nil, true
+	}
+	array := reflect.ValueOf(value)
+	if array.Kind() != reflect.Slice {
+		return nil, false
+	}
+	bins = make([][3]float64, 0, array.Len())
+	for i := 0; i < array.Len(); i++ {
+		tuple := reflect.Indirect(reflect.ValueOf(array.Index(i).Interface()))
+		if tuple.Kind() != reflect.Slice || tuple.Len() != 3 {
+			return nil, false
+		}
+		var bin [3]float64
+		for j := range bin {
+			element := reflect.Indirect(reflect.ValueOf(tuple.Index(j).Interface()))
+			if !element.CanFloat() {
+				return nil, false
+			}
+			bin[j] = element.Float()
+		}
+		bins = append(bins, bin)
+	}
+	return bins, true
+}
@@ -0,0 +1,27 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package model
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DocumentIdFieldName is the column with Elasticsearch document ids (`_id`), if the table stores them.
+// It's the only column we know to be unique, so it's used as the tiebreaker of sort.
+const DocumentIdFieldName = "_id"
+
+// TimestampFromDocumentId returns the timestamp (in ClickHouse format, without timezone) our generated document ID
+// was computed from.
+//
+// Our generated ID looks like this: `1d<TRUNCATED>0b8q1`, where the hex part (before `q`) is the document timestamp
+// and the digits after `q` just make it unique in search results. At database level we only compare timestamps.
+func TimestampFromDocumentId(id string) (string, error) {
+	idInHex := strings.Split(id, "q")[0]
+	idAsStr, err := hex.DecodeString(idInHex)
+	if err != nil {
+		return "", fmt.Errorf("error parsing document id %s: %v", id, err)
+	}
+	return strings.TrimSuffix(string(idAsStr), " +0000 UTC"), nil
+}
@@ -207,6 +207,7 @@ type WindowFunction struct {
 	Args        []Expr
 	PartitionBy []Expr
 	OrderBy     []OrderByExpr
+	Frame       string // e.g. `ROWS BETWEEN 2 PRECEDING AND CURRENT ROW`, empty for the default frame
 }
 
 func NewWindowFunction(name string, args, partitionBy []Expr, orderBy []OrderByExpr) WindowFunction {
@@ -262,6 +263,21 @@ func (e JoinExpr) Accept(v ExprVisitor) interface{} {
 	return v.VisitJoinExpr(e)
 }
 
+// ArrayJoinExpr represents an ARRAY JOIN clause, e.g. `table ARRAY JOIN arr1 AS a1, arr2 AS a2`.
+// It unfolds arrays (all of the same length), so every element becomes a separate row. Elements are available under aliases.
+type ArrayJoinExpr struct {
+	Lhs    Expr
+	Arrays []AliasedExpr
+}
+
+func NewArrayJoinExpr(lhs Expr, arrays []AliasedExpr) ArrayJoinExpr {
+	return ArrayJoinExpr{Lhs: lhs, Arrays: arrays}
+}
+
+func (e ArrayJoinExpr) Accept(v ExprVisitor) interface{} {
+	return v.VisitArrayJoinExpr(e)
+}
+
 type CTE struct {
 	Name          string
 	SelectCommand *SelectCommand
@@ -292,5 +308,6 @@ type ExprVisitor interface {
 	VisitParenExpr(e ParenExpr) interface{}
 	VisitLambdaExpr(e LambdaExpr) interface{}
 	VisitJoinExpr(e JoinExpr) interface{}
+	VisitArrayJoinExpr(e ArrayJoinExpr) interface{}
 	VisitCTE(e CTE) interface{}
 }
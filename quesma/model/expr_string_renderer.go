@@ -217,6 +217,10 @@ func (v *renderer) VisitSelectCommand(c SelectCommand) interface{} {
 		fullGroupBy := groupBy
 		sb.WriteString(strings.Join(fullGroupBy, ", "))
 	}
+	if c.HavingClause != nil {
+		sb.WriteString(" HAVING ")
+		sb.WriteString(AsString(c.HavingClause))
+	}
 
 	orderBy := make([]string, 0, len(c.OrderBy))
 	for _, col := range c.OrderBy {
@@ -238,6 +242,9 @@ func (v *renderer) VisitSelectCommand(c SelectCommand) interface{} {
 			sb.WriteString(fmt.Sprintf(" LIMIT %d BY %s", c.Limit, strings.Join(limitBys, ", ")))
 		}
 	}
+	if c.Offset > 0 {
+		sb.WriteString(fmt.Sprintf(" OFFSET %d", c.Offset))
+	}
 
 	return sb.String()
 }
@@ -273,6 +280,12 @@ func (v *renderer) VisitWindowFunction(f WindowFunction) interface{} {
 		}
 		sb.WriteString(strings.Join(orderByStr, ", "))
 	}
+	if f.Frame != "" {
+		if len(f.PartitionBy) > 0 || len(f.OrderBy) > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(f.Frame)
+	}
 	sb.WriteString(")")
 	return sb.String()
 }
@@ -325,6 +338,14 @@ func (v *renderer) VisitJoinExpr(j JoinExpr) interface{} {
 	return sb.String()
 }
 
+func (v *renderer) VisitArrayJoinExpr(e ArrayJoinExpr) interface{} {
+	arrays := make([]string, 0, len(e.Arrays))
+	for _, array := range e.Arrays {
+		arrays = append(arrays, array.Accept(v).(string))
+	}
+	return fmt.Sprintf("%s ARRAY JOIN %s", e.Lhs.Accept(v).(string), strings.Join(arrays, ", "))
+}
+
 func (v *renderer) VisitCTE(c CTE) interface{} {
 	return fmt.Sprintf("%s AS (%s) ", c.Name, AsString(c.SelectCommand))
 }
@@ -14,3 +14,11 @@ func TestParenExpr(t *testing.T) {
 			"+", NewLiteral(2.5))), "/", NewLiteral(3.5))
 	assert.Equal(t, "(floor(1.5)+2.5)/3.5", AsString(parenExpr))
 }
+
+func TestArrayJoinExpr(t *testing.T) {
+	arrayJoin := NewArrayJoinExpr(NewTableRef("logs"), []AliasedExpr{
+		NewAliasedExpr(NewColumnRef("tags.name"), "nested__tags.name"),
+		NewAliasedExpr(NewColumnRef("tags.count"), "nested__tags.count"),
+	})
+	assert.Equal(t, `logs ARRAY JOIN "tags.name" AS "nested__tags.name", "tags.count" AS "nested__tags.count"`, AsString(arrayJoin))
+}
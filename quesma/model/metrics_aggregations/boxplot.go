@@ -0,0 +1,71 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"quesma/logger"
+	"quesma/model"
+)
+
+// Boxplot returns min, max, quartiles and whiskers of the field.
+// Whiskers are the lowest/highest values within [q1 - 1.5 * IQR, q3 + 1.5 * IQR], where IQR = q3 - q1.
+// We select min, max and quantiles of a t-digest (see DigestQuantilesCount), and compute the rest from them.
+// Elastic takes whiskers from the digest's centroids, we take them from its quantiles, which is the same up to the digest's resolution.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-boxplot-aggregation.html
+type Boxplot struct {
+	ctx context.Context
+}
+
+const boxplotColumnsNr = 3 // min, max, digest's quantiles
+
+func NewBoxplot(ctx context.Context) Boxplot {
+	return Boxplot{ctx: ctx}
+}
+
+func (query Boxplot) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query Boxplot) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < boxplotColumnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected response in boxplot aggregation: %v", rows)
+		return model.JsonMap{}
+	}
+	cols := rows[0].Cols[len(rows[0].Cols)-boxplotColumnsNr:]
+	response := model.JsonMap{"min": nil, "max": nil, "q1": nil, "q2": nil, "q3": nil, "lower": nil, "upper": nil}
+
+	quantiles, ok := parseDigestQuantiles(cols[2].Value)
+	if !ok {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected quantiles in boxplot aggregation: %v (type %T)", cols[2].Value, cols[2].Value)
+	}
+	if cols[0].Value == nil || len(quantiles) == 0 { // min is null only if there are no values
+		return response
+	}
+
+	quartile := func(i int) float64 { return quantiles[i*DigestQuantilesCount/4] }
+	q1, q3 := quartile(1), quartile(3)
+	lowerFence, upperFence := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	lower, upper := q1, q3
+	for _, quantile := range quantiles {
+		if quantile >= lowerFence {
+			lower = min(lower, quantile)
+		}
+		if quantile <= upperFence {
+			upper = max(upper, quantile)
+		}
+	}
+
+	response["min"] = cols[0].Value
+	response["max"] = cols[1].Value
+	response["q1"] = q1
+	response["q2"] = quartile(2)
+	response["q3"] = q3
+	response["lower"] = lower
+	response["upper"] = upper
+	return response
+}
+
+func (query Boxplot) String() string {
+	return "boxplot"
+}
@@ -4,12 +4,19 @@ package metrics_aggregations
 
 import (
 	"context"
+	"math"
 	"quesma/clickhouse"
 	"quesma/logger"
 	"quesma/model"
+	"quesma/util"
+	"reflect"
 	"time"
 )
 
+// DigestQuantilesCount is the number of equally spaced quantiles (0, 1/DigestQuantilesCount, ..., 1) of a t-digest,
+// which we select to represent all values of a field, e.g. in Boxplot
+const DigestQuantilesCount = 100
+
 func metricsTranslateSqlResponseToJson(ctx context.Context, rows []model.QueryResultRow) model.JsonMap {
 	var value any = nil
 	if resultRowsAreNonEmpty(ctx, rows) {
@@ -58,3 +65,39 @@ func resultRowsAreNonEmpty(ctx context.Context, rows []model.QueryResultRow) boo
 	}
 	return true
 }
+
+// nanToNil returns nil for NaN (e.g. quantile of no values), as Elastic returns null in such cases
+func nanToNil(value any) any {
+	switch valueTyped := value.(type) {
+	case float64:
+		if math.IsNaN(valueTyped) {
+			return nil
+		}
+	case *float64:
+		if valueTyped == nil || math.IsNaN(*valueTyped) {
+			return nil
+		}
+	}
+	return value
+}
+
+// parseDigestQuantiles parses result of quantilesTDigest(0, 1/DigestQuantilesCount, ..., 1).
+// Returns nil quantiles (and ok) if there were no values, as then all quantiles are NaN.
+func parseDigestQuantiles(value any) (quantiles []float64, ok bool) {
+	array := reflect.ValueOf(value)
+	if array.Kind() != reflect.Slice || array.Len() != DigestQuantilesCount+1 {
+		return nil, false
+	}
+	quantiles = make([]float64, 0, array.Len())
+	for i := 0; i < array.Len(); i++ {
+		quantile, isNumber := util.ExtractNumeric64Maybe(array.Index(i).Interface())
+		if !isNumber {
+			return nil, false
+		}
+		if math.IsNaN(quantile) {
+			return nil, true
+		}
+		quantiles = append(quantiles, quantile)
+	}
+	return quantiles, true
+}
@@ -0,0 +1,87 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+)
+
+// GeoBounds computes the bounding box containing all points.
+// We select 6 columns: max(lat), min(lat), and min/max of longitude, separately for non-negative and negative longitudes.
+// Thanks to that we can (just like Elastic) return a box crossing the dateline, if it's narrower than the one which doesn't.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-geobounds-aggregation.html
+type GeoBounds struct {
+	ctx           context.Context
+	wrapLongitude bool
+}
+
+const geoBoundsColumnsNr = 6
+
+func NewGeoBounds(ctx context.Context, wrapLongitude bool) GeoBounds {
+	return GeoBounds{ctx: ctx, wrapLongitude: wrapLongitude}
+}
+
+func (query GeoBounds) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query GeoBounds) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < geoBoundsColumnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected response in geo_bounds aggregation: %v", rows)
+		return model.JsonMap{}
+	}
+	cols := rows[0].Cols[len(rows[0].Cols)-geoBoundsColumnsNr:]
+	top, bottom := cols[0].Value, cols[1].Value
+	if top == nil || bottom == nil {
+		// no points, Elastic returns empty response
+		return model.JsonMap{}
+	}
+	// +-Inf means there are no points with non-negative/negative longitude
+	valueOr := func(value any, defaultValue float64) float64 {
+		if value == nil {
+			return defaultValue
+		}
+		return util.ExtractFloat64(value)
+	}
+	posLeft, posRight := valueOr(cols[2].Value, math.Inf(1)), valueOr(cols[3].Value, math.Inf(-1))
+	negLeft, negRight := valueOr(cols[4].Value, math.Inf(1)), valueOr(cols[5].Value, math.Inf(-1))
+
+	var left, right float64
+	switch {
+	case math.IsInf(posLeft, 1):
+		left, right = negLeft, negRight
+	case math.IsInf(negRight, -1):
+		left, right = posLeft, posRight
+	case query.wrapLongitude:
+		unwrappedWidth := posRight - negLeft
+		wrappedWidth := (180 - posLeft) - (-180 - negRight)
+		if unwrappedWidth <= wrappedWidth {
+			left, right = negLeft, posRight
+		} else {
+			left, right = posLeft, negRight
+		}
+	default:
+		left, right = negLeft, posRight
+	}
+
+	return model.JsonMap{
+		"bounds": model.JsonMap{
+			"top_left": model.JsonMap{
+				"lat": top,
+				"lon": left,
+			},
+			"bottom_right": model.JsonMap{
+				"lat": bottom,
+				"lon": right,
+			},
+		},
+	}
+}
+
+func (query GeoBounds) String() string {
+	return "geo_bounds"
+}
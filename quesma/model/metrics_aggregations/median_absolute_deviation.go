@@ -0,0 +1,53 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"slices"
+)
+
+// MedianAbsoluteDeviation is median(|x - median(x)|). Like Elastic, we approximate it with a t-digest:
+// we select its quantiles (see DigestQuantilesCount), and take the median of their deviations from the median,
+// as the quantiles are (bounded number of) representatives of all values of the field.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-median-absolute-deviation-aggregation.html
+type MedianAbsoluteDeviation struct {
+	ctx context.Context
+}
+
+func NewMedianAbsoluteDeviation(ctx context.Context) MedianAbsoluteDeviation {
+	return MedianAbsoluteDeviation{ctx: ctx}
+}
+
+func (query MedianAbsoluteDeviation) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query MedianAbsoluteDeviation) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if !resultRowsAreNonEmpty(query.ctx, rows) {
+		return model.JsonMap{"value": nil}
+	}
+	quantilesRaw := rows[0].LastColValue()
+	quantiles, ok := parseDigestQuantiles(quantilesRaw)
+	if !ok {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected quantiles in median_absolute_deviation aggregation: %v (type %T)", quantilesRaw, quantilesRaw)
+	}
+	if len(quantiles) == 0 {
+		return model.JsonMap{"value": nil}
+	}
+
+	median := quantiles[DigestQuantilesCount/2]
+	deviations := make([]float64, len(quantiles))
+	for i, quantile := range quantiles {
+		deviations[i] = math.Abs(quantile - median)
+	}
+	slices.Sort(deviations)
+	return model.JsonMap{"value": deviations[len(deviations)/2]}
+}
+
+func (query MedianAbsoluteDeviation) String() string {
+	return "median_absolute_deviation"
+}
@@ -0,0 +1,122 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+	"time"
+)
+
+// Rate is a sum of the field's values (or a number of documents/values) in a date_histogram's bucket, per given unit of time.
+// It needs to be a direct child of date_histogram, we get parent's interval with SetParentInterval.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-rate-aggregation.html
+type Rate struct {
+	ctx  context.Context
+	unit string // "" means: per bucket, so the value is not scaled
+	// parent's interval, set in SetParentInterval
+	parentIntervalSet    bool
+	parentMonths         int           // for month-based (calendar month, quarter, year) intervals, else 0
+	parentDuration       time.Duration // for other intervals
+	parentLocation       *time.Location
+	needsBucketTimestamp bool // month-based interval and not month-based unit, so we need to know how many days the bucket has
+}
+
+var rateFixedUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+var rateMonthUnits = map[string]int{
+	"month":   1,
+	"quarter": 3,
+	"year":    12,
+}
+
+func NewRate(ctx context.Context, unit string) *Rate {
+	return &Rate{ctx: ctx, unit: unit}
+}
+
+// IsValidRateUnit returns whether unit (e.g. "day", "month") can be used in rate aggregation
+func IsValidRateUnit(unit string) bool {
+	_, isFixed := rateFixedUnits[unit]
+	_, isMonthBased := rateMonthUnits[unit]
+	return isFixed || isMonthBased
+}
+
+func (query *Rate) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+// SetParentInterval sets interval of the parent date_histogram: either months (for month, quarter or year), or duration.
+// It returns whether we need an additional column with any timestamp from the bucket, to compute bucket's length.
+func (query *Rate) SetParentInterval(months int, duration time.Duration, location *time.Location) (needsBucketTimestamp bool, err error) {
+	_, isUnitMonthBased := rateMonthUnits[query.unit]
+	if months == 0 && isUnitMonthBased {
+		return false, fmt.Errorf("rate with month-based unit %s needs a month-based calendar interval of date_histogram", query.unit)
+	}
+	if months == 0 && duration <= 0 {
+		return false, fmt.Errorf("invalid interval of date_histogram for rate: %v", duration)
+	}
+	query.parentIntervalSet = true
+	query.parentMonths, query.parentDuration, query.parentLocation = months, duration, location
+	query.needsBucketTimestamp = months > 0 && query.unit != "" && !isUnitMonthBased
+	return query.needsBucketTimestamp, nil
+}
+
+func (query *Rate) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if !query.parentIntervalSet {
+		logger.ErrorWithCtx(query.ctx).Msg("rate aggregation without parent date_histogram")
+		return model.JsonMap{"value": nil}
+	}
+	columnsNr := 1
+	if query.needsBucketTimestamp {
+		columnsNr = 2
+	}
+	if len(rows) == 0 || len(rows[0].Cols) < columnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected response in rate aggregation: %v", rows)
+		return model.JsonMap{"value": nil}
+	}
+	cols := rows[0].Cols[len(rows[0].Cols)-columnsNr:]
+	value, ok := util.ExtractNumeric64Maybe(cols[0].Value)
+	if !ok {
+		// no values in the bucket, sum is null
+		return model.JsonMap{"value": 0.0}
+	}
+
+	var multiplier float64
+	switch {
+	case query.unit == "":
+		multiplier = 1
+	case query.needsBucketTimestamp:
+		bucketTimestamp, ok := cols[1].Value.(time.Time)
+		if !ok {
+			logger.WarnWithCtx(query.ctx).Msgf("unexpected bucket timestamp in rate aggregation: %v (type %T)", cols[1].Value, cols[1].Value)
+			return model.JsonMap{"value": nil}
+		}
+		multiplier = float64(rateFixedUnits[query.unit]) / float64(query.bucketDuration(bucketTimestamp))
+	case query.parentMonths > 0:
+		multiplier = float64(rateMonthUnits[query.unit]) / float64(query.parentMonths)
+	default:
+		multiplier = float64(rateFixedUnits[query.unit]) / float64(query.parentDuration)
+	}
+	return model.JsonMap{"value": value * multiplier}
+}
+
+func (query *Rate) String() string {
+	return fmt.Sprintf("rate(unit: %s)", query.unit)
+}
+
+// bucketDuration returns the real length of the month-based bucket containing the timestamp (e.g. 29 days for February 2024)
+func (query *Rate) bucketDuration(timestamp time.Time) time.Duration {
+	timestamp = timestamp.In(query.parentLocation)
+	startMonth := time.Month((int(timestamp.Month())-1)/query.parentMonths*query.parentMonths + 1)
+	start := time.Date(timestamp.Year(), startMonth, 1, 0, 0, 0, 0, query.parentLocation)
+	return start.AddDate(0, query.parentMonths, 0).Sub(start)
+}
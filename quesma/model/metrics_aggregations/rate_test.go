@@ -0,0 +1,47 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"quesma/model"
+	"testing"
+	"time"
+)
+
+func TestRate_monthBasedIntervalWithFixedUnit(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	assert.NoError(t, err)
+	tests := []struct {
+		months          int
+		location        *time.Location
+		bucketTimestamp time.Time
+		expectedDays    float64
+	}{
+		{1, time.UTC, time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC), 29},
+		{1, time.UTC, time.Date(2023, 2, 28, 23, 59, 0, 0, time.UTC), 28},
+		{1, warsaw, time.Date(2024, 3, 31, 23, 30, 0, 0, time.UTC), 30}, // already April in Warsaw
+		{3, time.UTC, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), 91},
+		{12, time.UTC, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), 366},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucketTimestamp.String(), func(t *testing.T) {
+			rate := NewRate(context.Background(), "day")
+			needsBucketTimestamp, err := rate.SetParentInterval(tt.months, 0, tt.location)
+			assert.NoError(t, err)
+			assert.True(t, needsBucketTimestamp)
+			rows := []model.QueryResultRow{{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__rate_col_0", tt.expectedDays*10),
+				model.NewQueryResultCol("metric__rate_col_1", tt.bucketTimestamp),
+			}}}
+			assert.InDelta(t, 10.0, rate.TranslateSqlResponseToJson(rows)["value"], 1e-9)
+		})
+	}
+}
+
+func TestRate_monthBasedUnitNeedsMonthBasedInterval(t *testing.T) {
+	rate := NewRate(context.Background(), "month")
+	_, err := rate.SetParentInterval(0, time.Hour, time.UTC)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/util"
+	"reflect"
+)
+
+// StringStats computes statistics over string values: count, min/max/avg length, and Shannon entropy of characters.
+// We select count, length stats, and sumMap of occurrences of every character - entropy (and optional distribution) are computed from it.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-string-stats-aggregation.html
+type StringStats struct {
+	ctx              context.Context
+	showDistribution bool
+}
+
+const stringStatsColumnsNr = 5 // count, min length, max length, avg length, character occurrences
+
+func NewStringStats(ctx context.Context, showDistribution bool) StringStats {
+	return StringStats{ctx: ctx, showDistribution: showDistribution}
+}
+
+func (query StringStats) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query StringStats) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	if len(rows) == 0 || len(rows[0].Cols) < stringStatsColumnsNr {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected response in string_stats aggregation: %v", rows)
+		return model.JsonMap{}
+	}
+	cols := rows[0].Cols[len(rows[0].Cols)-stringStatsColumnsNr:]
+	response := model.JsonMap{
+		"count":      cols[0].Value,
+		"min_length": cols[1].Value,
+		"max_length": cols[2].Value,
+		"avg_length": nanToNil(cols[3].Value),
+	}
+
+	chars, occurrences, ok := query.parseCharOccurrences(cols[4].Value)
+	if !ok {
+		logger.WarnWithCtx(query.ctx).Msgf("unexpected character occurrences in string_stats aggregation: %v (type %T)", cols[4].Value, cols[4].Value)
+	}
+	var total float64
+	for _, occurrence := range occurrences {
+		total += occurrence
+	}
+	entropy := 0.0
+	distribution := make(model.JsonMap, len(chars))
+	for i, char := range chars {
+		if occurrences[i] == 0 {
+			continue
+		}
+		probability := occurrences[i] / total
+		entropy -= probability * math.Log2(probability)
+		distribution[char] = probability
+	}
+	response["entropy"] = entropy
+	if query.showDistribution {
+		response["distribution"] = distribution
+	}
+	return response
+}
+
+func (query StringStats) String() string {
+	return "string_stats"
+}
+
+// parseCharOccurrences parses result of sumMap: a tuple of 2 arrays, with characters and their number of occurrences
+func (query StringStats) parseCharOccurrences(value any) (chars []string, occurrences []float64, ok bool) {
+	if value == nil {
+		return nil, nil, true
+	}
+	tuple := reflect.ValueOf(value)
+	if tuple.Kind() != reflect.Slice || tuple.Len() != 2 {
+		return nil, nil, false
+	}
+	charsRaw, occurrencesRaw := reflect.ValueOf(tuple.Index(0).Interface()), reflect.ValueOf(tuple.Index(1).Interface())
+	if charsRaw.Kind() != reflect.Slice || occurrencesRaw.Kind() != reflect.Slice || charsRaw.Len() != occurrencesRaw.Len() {
+		return nil, nil, false
+	}
+	for i := 0; i < charsRaw.Len(); i++ {
+		char, isString := charsRaw.Index(i).Interface().(string)
+		occurrence, isNumber := util.ExtractNumeric64Maybe(occurrencesRaw.Index(i).Interface())
+		if !isString || !isNumber {
+			return nil, nil, false
+		}
+		chars = append(chars, char)
+		occurrences = append(occurrences, occurrence)
+	}
+	return chars, occurrences, true
+}
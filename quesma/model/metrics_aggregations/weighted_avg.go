@@ -0,0 +1,32 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package metrics_aggregations
+
+import (
+	"context"
+	"quesma/model"
+)
+
+// WeightedAvg is computed with ClickHouse's avgWeighted: sum(value * weight) / sum(weight)
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-weight-avg-aggregation.html
+type WeightedAvg struct {
+	ctx context.Context
+}
+
+func NewWeightedAvg(ctx context.Context) WeightedAvg {
+	return WeightedAvg{ctx: ctx}
+}
+
+func (query WeightedAvg) AggregationType() model.AggregationType {
+	return model.MetricsAggregation
+}
+
+func (query WeightedAvg) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	response := metricsTranslateSqlResponseToJson(query.ctx, rows)
+	response["value"] = nanToNil(response["value"]) // avgWeighted returns NaN if all weights are 0
+	return response
+}
+
+func (query WeightedAvg) String() string {
+	return "weighted_avg"
+}
@@ -22,3 +22,4 @@ func (NoOpVisitor) VisitWindowFunction(f WindowFunction) interface{} { return f
 func (NoOpVisitor) VisitParenExpr(e ParenExpr) interface{}           { return e }
 func (NoOpVisitor) VisitLambdaExpr(e LambdaExpr) interface{}         { return e }
 func (NoOpVisitor) VisitJoinExpr(e JoinExpr) interface{}             { return e }
+func (NoOpVisitor) VisitArrayJoinExpr(e ArrayJoinExpr) interface{}   { return e }
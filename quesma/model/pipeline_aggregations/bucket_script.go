@@ -7,17 +7,20 @@ import (
 	"fmt"
 	"quesma/logger"
 	"quesma/model"
+	"quesma/queryparser/painless"
 	"quesma/util"
 	"strings"
 )
 
 type BucketScript struct {
 	*PipelineAggregation
-	script string
+	script    string
+	variables map[string]string // variable name -> buckets_path
+	expr      model.Expr        // script lowered by painless.ParseScript, variables are column references
 }
 
-func NewBucketScript(ctx context.Context, path, script string) BucketScript {
-	return BucketScript{script: script, PipelineAggregation: newPipelineAggregation(ctx, path)}
+func NewBucketScript(ctx context.Context, path, script string, variables map[string]string, expr model.Expr) BucketScript {
+	return BucketScript{script: script, variables: variables, expr: expr, PipelineAggregation: newPipelineAggregation(ctx, path)}
 }
 
 func (query BucketScript) AggregationType() model.AggregationType {
@@ -27,25 +30,16 @@ func (query BucketScript) AggregationType() model.AggregationType {
 func (query BucketScript) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
 	const defaultValue = 0.
 	switch {
-	case query.script == "params.numerator != null && params.denominator != null && params.denominator != 0 ? params.numerator / params.denominator : 0":
-		parent := query.GetPathToParent()
-		if len(parent) != 1 {
-			// TODO: research if this limitation can be removed, and do so if possible.
-			logger.WarnWithCtx(query.ctx).Msgf("unexpected parent path in bucket_script: %s. Returning default.", query.String())
-			return model.JsonMap{"value": defaultValue}
+	case len(query.variables) > 1:
+		// each variable is a different aggregation, so we need to find its column by name
+		variables := make(map[string]any, len(query.variables))
+		for name, path := range query.variables {
+			variables[name] = query.findFilterValue(rows, pathToColumnNameSuffix(path))
 		}
-
-		// replaceAll - hack but get the job done for the customer's case, and won't break anything in any other case.
-		numerator := query.findFilterValue(rows, strings.ReplaceAll(parent[0], "denominator", "numerator"))
-		denominator := query.findFilterValue(rows, strings.ReplaceAll(parent[0], "numerator", "denominator"))
-		if denominator == 0 {
-			return model.JsonMap{"value": defaultValue}
-		}
-		return model.JsonMap{"value": numerator / denominator}
+		return model.JsonMap{"value": query.evaluate(variables)}
 	case len(rows) == 1:
-		for _, row := range rows {
-			return model.JsonMap{"value": util.ExtractNumeric64(row.LastColValue())}
-		}
+		// single variable was already evaluated in CalculateResultWhenMissing
+		return model.JsonMap{"value": rows[0].LastColValue()}
 	}
 
 	logger.WarnWithCtx(query.ctx).Msgf("unexpected result in bucket_script: %s, len(rows): %d. Returning default.", query.String(), len(rows))
@@ -57,7 +51,7 @@ func (query BucketScript) CalculateResultWhenMissing(parentRows []model.QueryRes
 	for _, parentRow := range parentRows {
 		resultRow := parentRow.Copy()
 		if len(resultRow.Cols) != 0 {
-			resultRow.Cols[len(resultRow.Cols)-1].Value = util.ExtractNumeric64(parentRow.LastColValue())
+			resultRow.Cols[len(resultRow.Cols)-1].Value = query.evaluateSingleVariable(parentRow.LastColValue())
 		} else {
 			logger.ErrorWithCtx(query.ctx).Msgf("unexpected empty parent row in bucket_script: %s", query.String())
 		}
@@ -66,6 +60,38 @@ func (query BucketScript) CalculateResultWhenMissing(parentRows []model.QueryRes
 	return resultRows
 }
 
+// evaluateSingleVariable evaluates the script if it uses at most one variable, whose value is the parent's value.
+// Otherwise, it returns the numeric value, and the script is evaluated in TranslateSqlResponseToJson.
+func (query BucketScript) evaluateSingleVariable(parentValue any) any {
+	if len(query.variables) != 1 {
+		return util.ExtractNumeric64(parentValue)
+	}
+	variables := make(map[string]any, 1)
+	for name := range query.variables {
+		variables[name] = util.ExtractNumeric64(parentValue)
+	}
+	return query.evaluate(variables)
+}
+
+func (query BucketScript) evaluate(variables map[string]any) any {
+	if query.expr == nil {
+		return nil
+	}
+	result, err := painless.Evaluate(query.expr, variables)
+	if err != nil {
+		logger.WarnWithCtx(query.ctx).Msgf("can't evaluate bucket_script: %s, error: %v. Returning null.", query.String(), err)
+		return nil
+	}
+	return result
+}
+
+// pathToColumnNameSuffix converts buckets_path to the suffix of its column name (without _col_0/__count),
+// e.g. "a>b>_count" -> "__a__b"
+func pathToColumnNameSuffix(path string) string {
+	path = strings.TrimSuffix(path, ">"+BucketsPathCount)
+	return "__" + strings.ReplaceAll(path, ">", "__")
+}
+
 func (query BucketScript) String() string {
 	return fmt.Sprintf("bucket_script(isCount: %v, parent: %s, pathToParent: %v, parentBucketAggregation: %v, script: %v)",
 		query.isCount, query.Parent, query.PathToParent, query.parentBucketAggregation, query.script)
@@ -0,0 +1,67 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/queryparser/painless"
+)
+
+// BucketSelector keeps only those buckets of its parent, for which the script evaluates to true
+type BucketSelector struct {
+	*PipelineAggregation
+	script    string
+	variables map[string]string // variable name -> buckets_path
+	expr      model.Expr        // script lowered by painless.ParseScript, variables are column references
+	gapPolicy GapPolicy
+}
+
+func NewBucketSelector(ctx context.Context, script string, variables map[string]string, expr model.Expr, gapPolicy GapPolicy) BucketSelector {
+	// parent is always the bucket aggregation right above, paths in variables are relative to its buckets
+	return BucketSelector{script: script, variables: variables, expr: expr, gapPolicy: gapPolicy,
+		PipelineAggregation: newPipelineAggregation(ctx, BucketsPathCount)}
+}
+
+func (query BucketSelector) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+// TranslateSqlResponseToJson returns nothing, bucket_selector doesn't add anything to the response, it only removes buckets
+func (query BucketSelector) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query BucketSelector) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return parentRows
+}
+
+func (query BucketSelector) ModifyBuckets(buckets []model.JsonMap) []model.JsonMap {
+	selected := make([]model.JsonMap, 0, len(buckets))
+	for _, bucket := range buckets {
+		variables := make(map[string]any, len(query.variables))
+		for name, path := range query.variables {
+			variables[name] = bucketsPathValue(bucket, path, query.gapPolicy)
+		}
+		result, err := painless.Evaluate(query.expr, variables)
+		if err != nil {
+			logger.WarnWithCtx(query.ctx).Msgf("can't evaluate bucket_selector: %s, error: %v. Skipping bucket.", query.String(), err)
+			continue
+		}
+		if keep, ok := result.(bool); ok && keep {
+			selected = append(selected, bucket)
+		}
+	}
+	return selected
+}
+
+func (query BucketSelector) String() string {
+	return fmt.Sprintf("bucket_selector(parent: %s, pathToParent: %v, parentBucketAggregation: %v, script: %v)",
+		query.Parent, query.PathToParent, query.parentBucketAggregation, query.script)
+}
+
+func (query BucketSelector) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
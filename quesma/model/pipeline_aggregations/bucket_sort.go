@@ -0,0 +1,115 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/model"
+	"sort"
+	"strings"
+)
+
+// BucketSort sorts buckets of its parent by the values at given buckets paths, and/or truncates them (from, size)
+type BucketSort struct {
+	*PipelineAggregation
+	sortFields []BucketSortField
+	from       int
+	size       int // BucketSortNoSize if there's no limit
+	gapPolicy  GapPolicy
+}
+
+type BucketSortField struct {
+	Path      string
+	Direction model.OrderByDirection
+}
+
+const BucketSortNoSize = -1
+
+func NewBucketSort(ctx context.Context, sortFields []BucketSortField, from, size int, gapPolicy GapPolicy) BucketSort {
+	// parent is always the bucket aggregation right above, paths in sortFields are relative to its buckets
+	return BucketSort{sortFields: sortFields, from: from, size: size, gapPolicy: gapPolicy,
+		PipelineAggregation: newPipelineAggregation(ctx, BucketsPathCount)}
+}
+
+func (query BucketSort) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+// TranslateSqlResponseToJson returns nothing, bucket_sort doesn't add anything to the response, it only reorders buckets
+func (query BucketSort) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return model.JsonMap{}
+}
+
+func (query BucketSort) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return parentRows
+}
+
+func (query BucketSort) ModifyBuckets(buckets []model.JsonMap) []model.JsonMap {
+	type sortedBucket struct {
+		bucket model.JsonMap
+		values []any
+	}
+	sortedBuckets := make([]sortedBucket, 0, len(buckets))
+BUCKETS:
+	for _, bucket := range buckets {
+		values := make([]any, 0, len(query.sortFields))
+		for _, field := range query.sortFields {
+			value := bucketsPathValue(bucket, field.Path, query.gapPolicy)
+			if value == nil { // only possible for skip gap policy
+				continue BUCKETS
+			}
+			values = append(values, value)
+		}
+		sortedBuckets = append(sortedBuckets, sortedBucket{bucket: bucket, values: values})
+	}
+
+	sort.SliceStable(sortedBuckets, func(i, j int) bool {
+		for fieldIdx, field := range query.sortFields {
+			cmp := compareBucketValues(sortedBuckets[i].values[fieldIdx], sortedBuckets[j].values[fieldIdx])
+			if cmp != 0 {
+				return (cmp < 0) == (field.Direction != model.DescOrder)
+			}
+		}
+		return false
+	})
+
+	from := min(query.from, len(sortedBuckets))
+	to := len(sortedBuckets)
+	if query.size != BucketSortNoSize {
+		to = min(from+query.size, to)
+	}
+	result := make([]model.JsonMap, 0, to-from)
+	for _, sorted := range sortedBuckets[from:to] {
+		result = append(result, sorted.bucket)
+	}
+	return result
+}
+
+// compareBucketValues compares numbers, or strings (e.g. terms' keys)
+func compareBucketValues(a, b any) int {
+	aFloat, aIsFloat := a.(float64)
+	bFloat, bIsFloat := b.(float64)
+	switch {
+	case aIsFloat && bIsFloat:
+		if aFloat < bFloat {
+			return -1
+		} else if aFloat > bFloat {
+			return 1
+		}
+		return 0
+	case aIsFloat: // numbers before strings
+		return -1
+	case bIsFloat:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func (query BucketSort) String() string {
+	return fmt.Sprintf("bucket_sort(sort: %v, from: %d, size: %d)", query.sortFields, query.from, query.size)
+}
+
+func (query BucketSort) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
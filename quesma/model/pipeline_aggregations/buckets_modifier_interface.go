@@ -0,0 +1,14 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import "quesma/model"
+
+// BucketsModifierInterface is a special case of parent pipeline aggregation, which doesn't add any value to buckets,
+// but filters or reorders buckets of its parent. Examples: bucket_selector, bucket_sort.
+//
+// It works on already rendered buckets (with all their subaggregations), not on SQL rows, as that's when Elastic applies it:
+// e.g. terms' sum_other_doc_count or histogram's empty buckets are computed before, so we can't push it down to SQL.
+type BucketsModifierInterface interface {
+	ModifyBuckets(buckets []model.JsonMap) []model.JsonMap
+}
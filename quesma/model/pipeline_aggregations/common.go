@@ -4,9 +4,12 @@ package pipeline_aggregations
 
 import (
 	"context"
+	"math"
 	"quesma/logger"
 	"quesma/model"
+	"quesma/queryprocessor"
 	"quesma/util"
+	"strings"
 )
 
 // translateSqlResponseToJsonCommon translates rows from DB (maybe postprocessed later), into JSON's format in which
@@ -103,3 +106,125 @@ func calculateResultWhenMissingCommonForDiffAggregations(ctx context.Context, pa
 	}
 	return resultRows
 }
+
+type GapPolicy int
+
+const (
+	GapPolicySkip        GapPolicy = iota // buckets with missing values are skipped
+	GapPolicyInsertZeros                  // missing values are replaced with 0
+)
+
+// bucketsPathValue returns the value at buckets_path in a rendered bucket, e.g. for "_count", "_key", "avg_price",
+// "stats.max", "percentiles[99.0]" or "filter>avg_price". Returns nil if there's no (numeric) value at that path.
+func bucketsPathValue(bucket model.JsonMap, path string, gapPolicy GapPolicy) any {
+	value := bucketsPathRawValue(bucket, path)
+	if numeric, ok := util.ExtractNumeric64Maybe(value); ok && !math.IsNaN(numeric) {
+		return numeric
+	}
+	if path == "_key" && value != nil { // e.g. terms' string key
+		return value
+	}
+	if gapPolicy == GapPolicyInsertZeros {
+		return 0.0
+	}
+	return nil
+}
+
+func bucketsPathRawValue(bucket model.JsonMap, path string) any {
+	const delimiter = ">"
+	switch path {
+	case BucketsPathCount:
+		return bucket["doc_count"]
+	case "_key":
+		return bucket["key"]
+	}
+
+	aggregations := strings.Split(path, delimiter)
+	current := bucket
+	for _, aggregation := range aggregations[:len(aggregations)-1] {
+		next, ok := current[aggregation].(model.JsonMap)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+
+	last := aggregations[len(aggregations)-1]
+	if last == BucketsPathCount {
+		return current["doc_count"]
+	}
+	name, metric := last, "value"
+	if bracketIdx := strings.Index(last, "["); bracketIdx != -1 && strings.HasSuffix(last, "]") {
+		name, metric = last[:bracketIdx], last[bracketIdx+1:len(last)-1]
+	} else if dotIdx := strings.Index(last, "."); dotIdx != -1 {
+		name, metric = last[:dotIdx], last[dotIdx+1:]
+	}
+	aggregation, ok := current[name].(model.JsonMap)
+	if !ok {
+		return nil
+	}
+	if value, exists := aggregation[metric]; exists {
+		return value
+	}
+	// percentiles-like metrics keep their values in a "values" map
+	if values, ok := aggregation["values"].(model.JsonMap); ok {
+		return values[metric]
+	}
+	return nil
+}
+
+// calculateResultWhenMissingCommonForStatsAggregations is common for stats/extended_stats/percentiles_bucket aggregations.
+// It splits parentRows into parent's buckets (row is [parent_cols..., current_key, current_value]),
+// and for each of them puts calculate(values of the bucket) into the last column of the result row.
+func calculateResultWhenMissingCommonForStatsAggregations(ctx context.Context, parentRows []model.QueryResultRow,
+	gapPolicy GapPolicy, calculate func(values []float64) model.JsonMap) []model.QueryResultRow {
+
+	resultRows := make([]model.QueryResultRow, 0)
+	if len(parentRows) == 0 {
+		return resultRows
+	}
+	qp := queryprocessor.NewQueryProcessor(ctx)
+	parentFieldsCnt := len(parentRows[0].Cols) - 2 // -2, because row is [parent_cols..., current_key, current_value]
+	if parentFieldsCnt < 0 {
+		logger.WarnWithCtx(ctx).Msgf("parentFieldsCnt is less than 0: %d", parentFieldsCnt)
+	}
+	for _, parentRowsOneBucket := range qp.SplitResultSetIntoBuckets(parentRows, parentFieldsCnt) {
+		if len(parentRowsOneBucket) == 0 {
+			continue
+		}
+		resultRow := parentRowsOneBucket[0].Copy()
+		resultRow.Cols[len(resultRow.Cols)-1].Value = calculate(siblingPipelineValues(parentRowsOneBucket, gapPolicy))
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+// siblingPipelineValues returns numeric values from the last column of rows.
+// Missing (nil or NaN) values are skipped or replaced with 0, depending on gapPolicy.
+func siblingPipelineValues(rows []model.QueryResultRow, gapPolicy GapPolicy) []float64 {
+	values := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		if value, ok := util.ExtractNumeric64Maybe(row.LastColValue()); ok && !math.IsNaN(value) {
+			values = append(values, value)
+		} else if gapPolicy == GapPolicyInsertZeros {
+			values = append(values, 0)
+		}
+	}
+	return values
+}
+
+// translateSqlResponseToJsonMapCommon returns the JsonMap stored in the last column by CalculateResultWhenMissing
+func translateSqlResponseToJsonMapCommon(ctx context.Context, rows []model.QueryResultRow, aggregationName string) model.JsonMap {
+	if len(rows) == 0 {
+		logger.WarnWithCtx(ctx).Msgf("no rows returned for %s aggregation", aggregationName)
+		return model.JsonMap{}
+	}
+	if len(rows) > 1 {
+		logger.WarnWithCtx(ctx).Msgf("More than one row returned for %s aggregation", aggregationName)
+	}
+	if result, ok := rows[0].LastColValue().(model.JsonMap); ok {
+		return result
+	}
+	logger.WarnWithCtx(ctx).Msgf("could not convert value to JsonMap: %v, type: %T", rows[0].LastColValue(), rows[0].LastColValue())
+	return model.JsonMap{}
+}
@@ -0,0 +1,44 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+)
+
+// CumulativeCardinality is like cumulative_sum, but over a cardinality aggregation, e.g. "distinct users seen so far".
+// It can't be computed from parent's results (cardinalities don't sum up), so pancake transformer replaces it
+// with a cardinality metric aggregation, computed with a window function over all previous buckets in SQL.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-cumulative-cardinality-aggregation.html
+type CumulativeCardinality struct {
+	*PipelineAggregation
+}
+
+func NewCumulativeCardinality(ctx context.Context, bucketsPath string) CumulativeCardinality {
+	return CumulativeCardinality{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath)}
+}
+
+func (query CumulativeCardinality) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query CumulativeCardinality) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	logger.WarnWithCtx(query.ctx).Msgf("%s should've been replaced by a metric aggregation", query.String())
+	return model.JsonMap{}
+}
+
+func (query CumulativeCardinality) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	logger.WarnWithCtx(query.ctx).Msgf("%s should've been replaced by a metric aggregation", query.String())
+	return parentRows
+}
+
+func (query CumulativeCardinality) String() string {
+	return fmt.Sprintf("cumulative_cardinality(%s)", query.Parent)
+}
+
+func (query CumulativeCardinality) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
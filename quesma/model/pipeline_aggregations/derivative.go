@@ -6,18 +6,27 @@ import (
 	"context"
 	"fmt"
 	"quesma/model"
+	"quesma/model/bucket_aggregations"
+	"quesma/util"
+	"strings"
+	"time"
 )
 
 // Derivative is just Serial Diff, with lag = 1
+// If unit is specified, we also return "normalized_value": derivative per unit of the histogram's key (e.g. per second).
 
 const derivativeLag = 1
 
 type Derivative struct {
 	*PipelineAggregation
+	unit time.Duration // 0 if not specified
+	// normalizedValues are kept aside of result rows (keyed by derivativeRowKey), as other pipelines may use our rows,
+	// and they need them to have the same columns as their parent rows (e.g. max_bucket groups them by all but the last 2 columns)
+	normalizedValues map[string]any
 }
 
-func NewDerivative(ctx context.Context, bucketsPath string) Derivative {
-	return Derivative{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath)}
+func NewDerivative(ctx context.Context, bucketsPath string, unit time.Duration) Derivative {
+	return Derivative{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), unit: unit, normalizedValues: make(map[string]any)}
 }
 
 func (query Derivative) AggregationType() model.AggregationType {
@@ -25,14 +34,61 @@ func (query Derivative) AggregationType() model.AggregationType {
 }
 
 func (query Derivative) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
-	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+	result := translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+	if query.unit != 0 && len(rows) > 0 {
+		if normalizedValue, ok := query.normalizedValues[derivativeRowKey(rows[0])]; ok {
+			result["normalized_value"] = normalizedValue
+		}
+	}
+	return result
 }
 
 func (query Derivative) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
-	return calculateResultWhenMissingCommonForDiffAggregations(query.ctx, parentRows, derivativeLag)
+	resultRows := calculateResultWhenMissingCommonForDiffAggregations(query.ctx, parentRows, derivativeLag)
+	if query.unit == 0 {
+		return resultRows
+	}
+
+	for i, resultRow := range resultRows {
+		var normalizedValue any
+		derivative, isNumeric := util.ExtractNumeric64Maybe(resultRow.LastColValue())
+		if i > 0 && isNumeric && len(parentRows[i].Cols) >= 2 {
+			key, okKey := query.keyInMilliseconds(parentRows[i])
+			previousKey, okPreviousKey := query.keyInMilliseconds(parentRows[i-1])
+			if okKey && okPreviousKey && key != previousKey {
+				normalizedValue = derivative / ((key - previousKey) / float64(query.unit.Milliseconds()))
+			}
+		}
+		query.normalizedValues[derivativeRowKey(resultRow)] = normalizedValue
+	}
+	return resultRows
+}
+
+// derivativeRowKey identifies the bucket of the row: all columns but the last one (value) are keys of it and its parent buckets
+func derivativeRowKey(row model.QueryResultRow) string {
+	var key strings.Builder
+	for _, col := range row.Cols[:max(len(row.Cols)-1, 0)] {
+		key.WriteString(fmt.Sprintf("%v\x00", col.Value))
+	}
+	return key.String()
+}
+
+// keyInMilliseconds returns the histogram's key of the row, as it's returned to the user (for date_histogram in ms)
+func (query Derivative) keyInMilliseconds(row model.QueryResultRow) (float64, bool) {
+	keyRaw := row.Cols[len(row.Cols)-2].Value
+	if dateHistogram, isDateHistogram := query.parentBucketAggregation.(*bucket_aggregations.DateHistogram); isDateHistogram {
+		if key, ok := keyRaw.(int64); ok {
+			return float64(dateHistogram.OriginalKeyToKey(key)), true
+		}
+		return 0, false
+	}
+	return util.ExtractNumeric64Maybe(keyRaw)
 }
 
 func (query Derivative) String() string {
+	if query.unit != 0 {
+		return fmt.Sprintf("derivative(%s, unit: %v)", query.Parent, query.unit)
+	}
 	return fmt.Sprintf("derivative(%s)", query.Parent)
 }
 
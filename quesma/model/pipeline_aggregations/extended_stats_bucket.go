@@ -0,0 +1,82 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"quesma/model"
+)
+
+// ExtendedStatsBucket is stats_bucket with additional variance/standard deviation statistics,
+// like extended_stats metric aggregation. std_deviation_bounds are avg +/- sigma * std_deviation.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-extended-stats-bucket-aggregation.html
+type ExtendedStatsBucket struct {
+	*PipelineAggregation
+	gapPolicy GapPolicy
+	sigma     float64
+}
+
+func NewExtendedStatsBucket(ctx context.Context, bucketsPath string, gapPolicy GapPolicy, sigma float64) ExtendedStatsBucket {
+	return ExtendedStatsBucket{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), gapPolicy: gapPolicy, sigma: sigma}
+}
+
+func (query ExtendedStatsBucket) AggregationType() model.AggregationType {
+	return model.PipelineMetricsAggregation
+}
+
+func (query ExtendedStatsBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonMapCommon(query.ctx, rows, query.String())
+}
+
+func (query ExtendedStatsBucket) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return calculateResultWhenMissingCommonForStatsAggregations(query.ctx, parentRows, query.gapPolicy, query.calculateExtendedStats)
+}
+
+func (query ExtendedStatsBucket) String() string {
+	return fmt.Sprintf("extended_stats_bucket(%s, sigma=%f)", query.Parent, query.sigma)
+}
+
+func (query ExtendedStatsBucket) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineSiblingAggregation
+}
+
+func (query ExtendedStatsBucket) calculateExtendedStats(values []float64) model.JsonMap {
+	result := calculateStats(values)
+
+	count := float64(len(values))
+	sum, sumOfSquares := 0.0, 0.0
+	for _, value := range values {
+		sum += value
+		sumOfSquares += value * value
+	}
+	variance := (sumOfSquares - sum*sum/count) / count
+	varianceSampling := (sumOfSquares - sum*sum/count) / (count - 1)
+	stdDeviation, stdDeviationSampling := math.Sqrt(variance), math.Sqrt(varianceSampling)
+	avg := sum / count
+
+	// NaN (e.g. no values, or sampling variance of 1 value) is rendered as null, like in Elastic
+	nullIfNaN := func(value float64) any {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil
+		}
+		return value
+	}
+	result["sum_of_squares"] = sumOfSquares
+	result["variance"] = nullIfNaN(variance)
+	result["variance_population"] = nullIfNaN(variance)
+	result["variance_sampling"] = nullIfNaN(varianceSampling)
+	result["std_deviation"] = nullIfNaN(stdDeviation)
+	result["std_deviation_population"] = nullIfNaN(stdDeviation)
+	result["std_deviation_sampling"] = nullIfNaN(stdDeviationSampling)
+	result["std_deviation_bounds"] = model.JsonMap{
+		"upper":            nullIfNaN(avg + query.sigma*stdDeviation),
+		"lower":            nullIfNaN(avg - query.sigma*stdDeviation),
+		"upper_population": nullIfNaN(avg + query.sigma*stdDeviation),
+		"lower_population": nullIfNaN(avg - query.sigma*stdDeviation),
+		"upper_sampling":   nullIfNaN(avg + query.sigma*stdDeviationSampling),
+		"lower_sampling":   nullIfNaN(avg - query.sigma*stdDeviationSampling),
+	}
+	return result
+}
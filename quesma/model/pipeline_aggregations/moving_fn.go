@@ -0,0 +1,82 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"quesma/model"
+	"quesma/util"
+)
+
+// MovingFn is a parent pipeline aggregation, which slides a window over the values of its parent histogram
+// and computes a function of the values in the window.
+// For bucket with index i (only buckets with a value count), the window is [i - window + shift, i + shift),
+// so by default (shift == 0) it doesn't include the current bucket.
+// It's also used for (deprecated) moving_avg, which is moving_fn with a fixed function and shift == 0.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-movfn-aggregation.html
+type MovingFn struct {
+	*PipelineAggregation
+	aggregationName string // moving_fn or moving_avg
+	function        MovingFunction
+	functionName    string
+	window          int
+	shift           int
+}
+
+func NewMovingFn(ctx context.Context, bucketsPath string, function MovingFunction, functionName string, window, shift int) MovingFn {
+	return MovingFn{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), aggregationName: "moving_fn",
+		function: function, functionName: functionName, window: window, shift: shift}
+}
+
+func NewMovingAvg(ctx context.Context, bucketsPath string, function MovingFunction, model string, window int) MovingFn {
+	return MovingFn{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), aggregationName: "moving_avg",
+		function: function, functionName: model, window: window}
+}
+
+func (query MovingFn) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query MovingFn) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+}
+
+func (query MovingFn) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	values := make([]float64, 0, len(parentRows))
+	for _, parentRow := range parentRows {
+		if value, ok := util.ExtractNumeric64Maybe(parentRow.LastColValue()); ok && !math.IsNaN(value) {
+			values = append(values, value)
+		}
+	}
+
+	clamp := func(index int) int {
+		return max(0, min(index, len(values)))
+	}
+	resultRows := make([]model.QueryResultRow, 0, len(parentRows))
+	index := 0
+	for _, parentRow := range parentRows {
+		resultRow := parentRow.Copy()
+		var resultValue any
+		if value, ok := util.ExtractNumeric64Maybe(parentRow.LastColValue()); ok && !math.IsNaN(value) {
+			result := query.function(values[clamp(index-query.window+query.shift):clamp(index+query.shift)])
+			if !math.IsNaN(result) && !math.IsInf(result, 0) {
+				resultValue = result
+			}
+			index++
+		}
+		resultRow.Cols[len(resultRow.Cols)-1].Value = resultValue
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query MovingFn) String() string {
+	return fmt.Sprintf("%s(parent: %s, function: %s, window: %d, shift: %d)",
+		query.aggregationName, query.Parent, query.functionName, query.window, query.shift)
+}
+
+func (query MovingFn) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
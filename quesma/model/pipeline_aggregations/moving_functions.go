@@ -0,0 +1,108 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import "math"
+
+// MovingFunction computes a single value from the values in the window, like Elastic's MovingFunctions.
+// Returns NaN if it can't be computed (e.g. the window is empty), which is rendered as null.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-movfn-aggregation.html#_pre_built_functions
+type MovingFunction func(values []float64) float64
+
+func MovingMax(values []float64) float64 {
+	result := math.NaN()
+	for _, v := range values {
+		if math.IsNaN(result) || v > result {
+			result = v
+		}
+	}
+	return result
+}
+
+func MovingMin(values []float64) float64 {
+	result := math.NaN()
+	for _, v := range values {
+		if math.IsNaN(result) || v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+// MovingSum returns 0 for an empty window, like Elastic
+func MovingSum(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func MovingUnweightedAvg(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	return MovingSum(values) / float64(len(values))
+}
+
+// MovingStdDev is the population standard deviation
+func MovingStdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	avg := MovingUnweightedAvg(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - avg) * (v - avg)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// MovingLinearWeightedAvg assigns weight 1 to the oldest value, 2 to the next one, etc.
+func MovingLinearWeightedAvg(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	avg, totalWeight := 0.0, 0.0
+	for i, v := range values {
+		weight := float64(i + 1)
+		avg += v * weight
+		totalWeight += weight
+	}
+	return avg / totalWeight
+}
+
+// MovingEwma is the exponentially weighted moving average, alpha is the decay (0 <= alpha <= 1)
+func MovingEwma(alpha float64) MovingFunction {
+	return func(values []float64) float64 {
+		avg := math.NaN()
+		for i, v := range values {
+			if i == 0 {
+				avg = v
+			} else {
+				avg = v*alpha + avg*(1-alpha)
+			}
+		}
+		return avg
+	}
+}
+
+// MovingHolt is the double exponential moving average, with level (alpha) and trend (beta) decays
+func MovingHolt(alpha, beta float64) MovingFunction {
+	return func(values []float64) float64 {
+		if len(values) == 0 {
+			return math.NaN()
+		}
+		var level, trend, lastLevel, lastTrend float64
+		for i, v := range values {
+			if i == 0 {
+				level, trend = v, 0
+			} else {
+				level = alpha*v + (1-alpha)*(lastLevel+lastTrend)
+				trend = beta*(level-lastLevel) + (1-beta)*lastTrend
+			}
+			lastLevel, lastTrend = level, trend
+		}
+		return level
+	}
+}
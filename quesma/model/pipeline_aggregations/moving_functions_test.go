@@ -0,0 +1,37 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestMovingFunctions(t *testing.T) {
+	values := []float64{1, 2, 4, 8}
+	testcases := []struct {
+		name     string
+		function MovingFunction
+		expected float64
+	}{
+		{"max", MovingMax, 8},
+		{"min", MovingMin, 1},
+		{"sum", MovingSum, 15},
+		{"unweightedAvg", MovingUnweightedAvg, 3.75},
+		{"linearWeightedAvg", MovingLinearWeightedAvg, 4.9},
+		{"stdDev", MovingStdDev, 2.680951323690902},
+		{"ewma", MovingEwma(0.5), 5.375},
+		{"holt", MovingHolt(0.5, 0.5), 5.84375},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, tc.function(values), 1e-9)
+			if tc.name == "sum" {
+				assert.Equal(t, 0.0, tc.function([]float64{}))
+			} else {
+				assert.True(t, math.IsNaN(tc.function([]float64{})))
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/logger"
+	"quesma/model"
+)
+
+// MovingPercentiles is like moving_fn, but over a percentiles aggregation, so it can't be computed from
+// parent's results (percentiles of the window aren't a function of percentiles of the buckets).
+// Pancake transformer replaces it with a percentiles metric aggregation, computed with a window function in SQL.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-moving-percentiles-aggregation.html
+type MovingPercentiles struct {
+	*PipelineAggregation
+	window int
+	shift  int
+}
+
+func NewMovingPercentiles(ctx context.Context, bucketsPath string, window, shift int) MovingPercentiles {
+	return MovingPercentiles{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), window: window, shift: shift}
+}
+
+func (query MovingPercentiles) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query MovingPercentiles) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	logger.WarnWithCtx(query.ctx).Msgf("%s should've been replaced by a metric aggregation", query.String())
+	return model.JsonMap{}
+}
+
+func (query MovingPercentiles) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	logger.WarnWithCtx(query.ctx).Msgf("%s should've been replaced by a metric aggregation", query.String())
+	return parentRows
+}
+
+func (query MovingPercentiles) String() string {
+	return fmt.Sprintf("moving_percentiles(parent: %s, window: %d, shift: %d)", query.Parent, query.window, query.shift)
+}
+
+func (query MovingPercentiles) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
+
+func (query MovingPercentiles) Window() int {
+	return query.window
+}
+
+func (query MovingPercentiles) Shift() int {
+	return query.shift
+}
@@ -0,0 +1,93 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"quesma/model"
+	"quesma/util"
+)
+
+// Normalize is a parent pipeline aggregation, which normalizes values of its parent histogram's buckets.
+// Buckets without a value are skipped (and get null).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-normalize-aggregation.html
+type Normalize struct {
+	*PipelineAggregation
+	method NormalizeMethod
+}
+
+type NormalizeMethod string
+
+const (
+	NormalizeRescale01    NormalizeMethod = "rescale_0_1"
+	NormalizeRescale0100  NormalizeMethod = "rescale_0_100"
+	NormalizePercentOfSum NormalizeMethod = "percent_of_sum"
+	NormalizeMean         NormalizeMethod = "mean"
+	NormalizeZScore       NormalizeMethod = "z-score"
+	NormalizeSoftmax      NormalizeMethod = "softmax"
+)
+
+func NewNormalize(ctx context.Context, bucketsPath string, method NormalizeMethod) Normalize {
+	return Normalize{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), method: method}
+}
+
+func (query Normalize) AggregationType() model.AggregationType {
+	return model.PipelineBucketAggregation
+}
+
+func (query Normalize) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonCommon(query.ctx, rows, query.String())
+}
+
+func (query Normalize) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	values := siblingPipelineValues(parentRows, GapPolicySkip)
+	stats := calculateStats(values)
+	sum := stats["sum"].(float64)
+	minValue, _ := stats["min"].(float64)
+	maxValue, _ := stats["max"].(float64)
+	mean := sum / float64(len(values))
+	stdDev := MovingStdDev(values)
+	expSum := 0.0
+	for _, value := range values {
+		expSum += math.Exp(value)
+	}
+
+	resultRows := make([]model.QueryResultRow, 0, len(parentRows))
+	for _, parentRow := range parentRows {
+		resultRow := parentRow.Copy()
+		var resultValue any
+		if value, ok := util.ExtractNumeric64Maybe(parentRow.LastColValue()); ok && !math.IsNaN(value) {
+			var normalized float64
+			switch query.method {
+			case NormalizeRescale01:
+				normalized = (value - minValue) / (maxValue - minValue)
+			case NormalizeRescale0100:
+				normalized = 100 * (value - minValue) / (maxValue - minValue)
+			case NormalizePercentOfSum:
+				normalized = value / sum
+			case NormalizeMean:
+				normalized = (value - mean) / (maxValue - minValue)
+			case NormalizeZScore:
+				normalized = (value - mean) / stdDev
+			case NormalizeSoftmax:
+				normalized = math.Exp(value) / expSum
+			}
+			if !math.IsNaN(normalized) && !math.IsInf(normalized, 0) {
+				resultValue = normalized
+			}
+		}
+		resultRow.Cols[len(resultRow.Cols)-1].Value = resultValue
+		resultRows = append(resultRows, resultRow)
+	}
+	return resultRows
+}
+
+func (query Normalize) String() string {
+	return fmt.Sprintf("normalize(%s, method: %s)", query.Parent, query.method)
+}
+
+func (query Normalize) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineParentAggregation
+}
@@ -0,0 +1,80 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"quesma/model"
+	"slices"
+	"strconv"
+)
+
+// PercentilesBucket is a sibling pipeline aggregation, which computes percentiles of the values
+// at buckets_path in all buckets of the sibling aggregation.
+// Like in Elastic, percentiles aren't interpolated: p-th percentile is the value at index round(p/100 * (n-1)).
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-percentiles-bucket-aggregation.html
+type PercentilesBucket struct {
+	*PipelineAggregation
+	gapPolicy GapPolicy
+	percents  []float64
+	keyed     bool
+}
+
+var PercentilesBucketDefaultPercents = []float64{1, 5, 25, 50, 75, 95, 99}
+
+func NewPercentilesBucket(ctx context.Context, bucketsPath string, gapPolicy GapPolicy, percents []float64, keyed bool) PercentilesBucket {
+	return PercentilesBucket{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), gapPolicy: gapPolicy,
+		percents: percents, keyed: keyed}
+}
+
+func (query PercentilesBucket) AggregationType() model.AggregationType {
+	return model.PipelineMetricsAggregation
+}
+
+func (query PercentilesBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonMapCommon(query.ctx, rows, query.String())
+}
+
+func (query PercentilesBucket) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return calculateResultWhenMissingCommonForStatsAggregations(query.ctx, parentRows, query.gapPolicy, query.calculatePercentiles)
+}
+
+func (query PercentilesBucket) String() string {
+	return fmt.Sprintf("percentiles_bucket(%s, percents=%v, keyed=%v)", query.Parent, query.percents, query.keyed)
+}
+
+func (query PercentilesBucket) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineSiblingAggregation
+}
+
+func (query PercentilesBucket) calculatePercentiles(values []float64) model.JsonMap {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	keyedValues := make(model.JsonMap, len(query.percents))
+	listValues := make([]model.JsonMap, 0, len(query.percents))
+	for _, percent := range query.percents {
+		var value any
+		if len(sorted) > 0 {
+			value = sorted[int(math.Round(percent/100*float64(len(sorted)-1)))]
+		}
+		keyedValues[query.percentName(percent)] = value
+		listValues = append(listValues, model.JsonMap{"key": percent, "value": value})
+	}
+
+	if query.keyed {
+		return model.JsonMap{"values": keyedValues}
+	}
+	return model.JsonMap{"values": listValues}
+}
+
+// percentName returns percent as Elastic (Java) renders doubles, e.g. "99.0" or "99.9"
+func (query PercentilesBucket) percentName(percent float64) string {
+	name := strconv.FormatFloat(percent, 'f', -1, 64)
+	if percent == math.Trunc(percent) {
+		name += ".0"
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package pipeline_aggregations
+
+import (
+	"context"
+	"fmt"
+	"quesma/model"
+)
+
+// StatsBucket is a sibling pipeline aggregation, which computes count, min, max, avg and sum of the values
+// at buckets_path in all buckets of the sibling aggregation.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-pipeline-stats-bucket-aggregation.html
+type StatsBucket struct {
+	*PipelineAggregation
+	gapPolicy GapPolicy
+}
+
+func NewStatsBucket(ctx context.Context, bucketsPath string, gapPolicy GapPolicy) StatsBucket {
+	return StatsBucket{PipelineAggregation: newPipelineAggregation(ctx, bucketsPath), gapPolicy: gapPolicy}
+}
+
+func (query StatsBucket) AggregationType() model.AggregationType {
+	return model.PipelineMetricsAggregation
+}
+
+func (query StatsBucket) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.JsonMap {
+	return translateSqlResponseToJsonMapCommon(query.ctx, rows, query.String())
+}
+
+func (query StatsBucket) CalculateResultWhenMissing(parentRows []model.QueryResultRow) []model.QueryResultRow {
+	return calculateResultWhenMissingCommonForStatsAggregations(query.ctx, parentRows, query.gapPolicy, calculateStats)
+}
+
+func (query StatsBucket) String() string {
+	return fmt.Sprintf("stats_bucket(%s)", query.Parent)
+}
+
+func (query StatsBucket) PipelineAggregationType() model.PipelineAggregationType {
+	return model.PipelineSiblingAggregation
+}
+
+// calculateStats returns stats like Elastic: min/max/avg are null for no values, sum is 0.
+func calculateStats(values []float64) model.JsonMap {
+	var minValue, maxValue, avg any
+	sum := 0.0
+	for i, value := range values {
+		if i == 0 || value < minValue.(float64) {
+			minValue = value
+		}
+		if i == 0 || value > maxValue.(float64) {
+			maxValue = value
+		}
+		sum += value
+	}
+	if len(values) > 0 {
+		avg = sum / float64(len(values))
+	}
+	return model.JsonMap{
+		"count": len(values),
+		"min":   minValue,
+		"max":   maxValue,
+		"avg":   avg,
+		"sum":   sum,
+	}
+}
@@ -98,6 +98,9 @@ type ExecutionPlan struct {
 
 	IndexPattern string
 
+	PointInTimeId string // id of the point in time the search is run in, returned in the response
+	ScrollId      string // id of the scroll the search is a page of, returned in the response
+
 	Queries []*Query
 
 	QueryRowsTransformers []QueryRowsTransformer
@@ -131,7 +134,7 @@ func (q *Query) NewSelectExprWithRowNumber(selectFields []Expr, groupByFields []
 		"ROW_NUMBER", nil, groupByFields, orderBy,
 	), RowNumberColumnName))
 
-	return *NewSelectCommand(selectFields, nil, nil, q.SelectCommand.FromClause, whereClause, []Expr{}, 0, 0, false, []*CTE{})
+	return *NewSelectCommand(selectFields, nil, nil, q.SelectCommand.FromClause, whereClause, nil, []Expr{}, 0, 0, 0, false, []*CTE{})
 }
 
 type HitsInfo int // TODO/warning: right now difference between ListByField/ListAllFields/Normal is not very clear. It probably should be merged into 1 type.
@@ -155,8 +158,10 @@ func (queryType HitsInfo) String() string {
 type HitsCountInfo struct {
 	Typ             HitsInfo
 	RequestedFields []string
-	Size            int // how many hits to return
-	TrackTotalHits  int // >= 0: we want this nr of total hits, TrackTotalHitsTrue: it was "true", TrackTotalHitsFalse: it was "false", in the request
+	Size            int   // how many hits to return
+	From            int   // how many hits to skip
+	SearchAfter     []any // sort values of the last hit from the previous page, empty if not requested
+	TrackTotalHits  int   // >= 0: we want this nr of total hits, TrackTotalHitsTrue: it was "true", TrackTotalHitsFalse: it was "false", in the request
 }
 
 func NewEmptyHitsCountInfo() HitsCountInfo {
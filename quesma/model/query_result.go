@@ -83,8 +83,8 @@ func (r *QueryResultRow) String(ctx context.Context) string {
 	str.WriteString(util.Indent(1) + "{\n")
 	i := 0
 	for _, col := range r.Cols {
-		// skip internal columns
-		if col.ColName == common_table.IndexNameColumn {
+		// skip internal columns, document id isn't a part of the document
+		if col.ColName == common_table.IndexNameColumn || col.ColName == DocumentIdFieldName {
 			continue
 		}
 
@@ -44,10 +44,16 @@ func NewSearchHit(index string) SearchHit {
 }
 
 type SearchHits struct {
-	Total    *Total      `json:"total,omitempty"`
-	MaxScore *float32    `json:"max_score"`
-	Hits     []SearchHit `json:"hits"`
-	Events   []SearchHit `json:"events,omitempty"` // this one is used by EQL
+	Total     *Total           `json:"total,omitempty"`
+	MaxScore  *float32         `json:"max_score"`
+	Hits      []SearchHit      `json:"hits"`
+	Events    []SearchHit      `json:"events,omitempty"`    // this one is used by EQL
+	Sequences []SearchSequence `json:"sequences,omitempty"` // this one is used by EQL sequence queries
+}
+
+type SearchSequence struct {
+	JoinKeys []any       `json:"join_keys,omitempty"`
+	Events   []SearchHit `json:"events"`
 }
 
 type Total struct {
@@ -63,6 +69,7 @@ type SearchResp struct {
 	Hits              SearchHits     `json:"hits"`
 	Aggregations      JsonMap        `json:"aggregations,omitempty"`
 	ScrollID          *string        `json:"_scroll_id,omitempty"`
+	PitID             *string        `json:"pit_id,omitempty"`
 }
 
 func (response *SearchResp) Marshal() ([]byte, error) {
@@ -5,32 +5,36 @@ package model
 type SelectCommand struct {
 	IsDistinct bool // true <=> query is SELECT DISTINCT
 
-	Columns     []Expr        // Columns to select
-	FromClause  Expr          // usually just "tableName", or databaseName."tableName". Sometimes a subquery e.g. (SELECT ...)
-	WhereClause Expr          // "WHERE ..." until next clause like GROUP BY/ORDER BY, etc.
-	GroupBy     []Expr        // if not empty, we do GROUP BY GroupBy...
-	OrderBy     []OrderByExpr // if not empty, we do ORDER BY OrderBy...
+	Columns      []Expr        // Columns to select
+	FromClause   Expr          // usually just "tableName", or databaseName."tableName". Sometimes a subquery e.g. (SELECT ...)
+	WhereClause  Expr          // "WHERE ..." until next clause like GROUP BY/ORDER BY, etc.
+	GroupBy      []Expr        // if not empty, we do GROUP BY GroupBy...
+	HavingClause Expr          // "HAVING ...", filters groups, nil if none
+	OrderBy      []OrderByExpr // if not empty, we do ORDER BY OrderBy...
 
 	LimitBy     []Expr // LIMIT BY clause (empty => maybe LIMIT, but no LIMIT BY)
 	Limit       int    // LIMIT clause, noLimit (0) means no limit
+	Offset      int    // OFFSET clause, 0 means no offset
 	SampleLimit int    // LIMIT, but before grouping, 0 means no limit
 
 	NamedCTEs []*CTE // Named Common Table Expressions, so these parts of query: WITH cte_1 AS SELECT ..., cte_2 AS SELECT ...
 }
 
-func NewSelectCommand(columns, groupBy []Expr, orderBy []OrderByExpr, from, where Expr, limitBy []Expr,
-	limit, sampleLimit int, isDistinct bool, namedCTEs []*CTE) *SelectCommand {
+func NewSelectCommand(columns, groupBy []Expr, orderBy []OrderByExpr, from, where, having Expr, limitBy []Expr,
+	limit, offset, sampleLimit int, isDistinct bool, namedCTEs []*CTE) *SelectCommand {
 	return &SelectCommand{
-		IsDistinct:  isDistinct,
-		Columns:     columns,
-		GroupBy:     groupBy,
-		OrderBy:     orderBy,
-		FromClause:  from,
-		WhereClause: where,
-		LimitBy:     limitBy,
-		Limit:       limit,
-		SampleLimit: sampleLimit,
-		NamedCTEs:   namedCTEs,
+		IsDistinct:   isDistinct,
+		Columns:      columns,
+		GroupBy:      groupBy,
+		OrderBy:      orderBy,
+		FromClause:   from,
+		WhereClause:  where,
+		HavingClause: having,
+		LimitBy:      limitBy,
+		Limit:        limit,
+		Offset:       offset,
+		SampleLimit:  sampleLimit,
+		NamedCTEs:    namedCTEs,
 	}
 }
 
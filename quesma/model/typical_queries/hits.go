@@ -90,9 +90,16 @@ func (query Hits) TranslateSqlResponseToJson(rows []model.QueryResultRow) model.
 		}
 		query.addAndHighlightHit(&hit, &row)
 
-		hit.ID = query.computeIdForDocument(hit, strconv.Itoa(i+1))
+		storedId, hasStoredId := documentId(row)
+		if hasStoredId {
+			hit.ID = storedId
+		} else {
+			hit.ID = query.computeIdForDocument(hit, strconv.Itoa(i+1))
+		}
 		for _, fieldName := range query.sortFieldNames {
-			if val, ok := hit.Fields[fieldName]; ok {
+			if fieldName == model.DocumentIdFieldName && hasStoredId {
+				hit.Sort = append(hit.Sort, storedId)
+			} else if val, ok := hit.Fields[fieldName]; ok {
 				hit.Sort = append(hit.Sort, elasticsearch.FormatSortValue(val[0]))
 			} else {
 				logger.WarnWithCtx(query.ctx).Msgf("field %s not found in fields", fieldName)
@@ -133,8 +140,8 @@ func (query Hits) addAndHighlightHit(hit *model.SearchHit, resultRow *model.Quer
 
 	for _, col := range resultRow.Cols {
 
-		// skip internal columns
-		if col.ColName == common_table.IndexNameColumn {
+		// skip internal columns, document id is returned as the hit's id
+		if col.ColName == common_table.IndexNameColumn || col.ColName == model.DocumentIdFieldName {
 			continue
 		}
 
@@ -171,6 +178,23 @@ func (query Hits) addAndHighlightHit(hit *model.SearchHit, resultRow *model.Quer
 	}
 }
 
+// documentId returns the document id stored in the row, if there is one (it's missing for documents ingested before we started storing ids)
+func documentId(row model.QueryResultRow) (string, bool) {
+	for _, cell := range row.Cols {
+		if cell.ColName == model.DocumentIdFieldName {
+			switch id := cell.Value.(type) {
+			case string:
+				return id, id != ""
+			case *string:
+				if id != nil {
+					return *id, *id != ""
+				}
+			}
+		}
+	}
+	return "", false
+}
+
 func (query Hits) WithTimestampField(fieldName string) Hits {
 	query.timestampFieldName = fieldName
 	return query
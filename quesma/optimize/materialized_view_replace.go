@@ -165,7 +165,7 @@ func (s *materializedViewReplace) replace(rule materializedViewReplaceRule, quer
 					if whereReplaced {
 						replaced = true
 						from = model.NewTableRef(rule.materializedView) // config param
-						return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, newWhere, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+						return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, newWhere, query.HavingClause, query.LimitBy, query.Limit, query.Offset, query.SampleLimit, query.IsDistinct, namedCTEs)
 					}
 				}
 			} else {
@@ -176,7 +176,7 @@ func (s *materializedViewReplace) replace(rule materializedViewReplaceRule, quer
 		if query.WhereClause != nil {
 			where = query.WhereClause.Accept(v).(model.Expr)
 		}
-		return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, where, query.LimitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		return model.NewSelectCommand(query.Columns, query.GroupBy, query.OrderBy, from, where, query.HavingClause, query.LimitBy, query.Limit, query.Offset, query.SampleLimit, query.IsDistinct, namedCTEs)
 
 	}
 
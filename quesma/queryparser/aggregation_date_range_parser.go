@@ -3,8 +3,11 @@
 package queryparser
 
 import (
+	"quesma/kibana"
 	"quesma/logger"
+	"quesma/model"
 	"quesma/model/bucket_aggregations"
+	"time"
 	"unicode"
 )
 
@@ -21,6 +24,7 @@ func (cw *ClickhouseQueryTranslator) parseDateRangeAggregation(dateRange QueryMa
 	} else {
 		logger.WarnWithCtx(cw.Ctx).Msgf("no field specified for date range aggregation. Using empty. Querymap: %v", dateRange)
 	}
+	timeZone := cw.parseTimeZone(dateRange)
 	var ranges []any
 	var ok bool
 	if formatRaw, exists := dateRange["format"]; exists {
@@ -45,7 +49,7 @@ func (cw *ClickhouseQueryTranslator) parseDateRangeAggregation(dateRange QueryMa
 		from, exists := rangeMap["from"]
 		if exists {
 			if fromRaw, ok := from.(string); ok {
-				intervalBegin, err = cw.parseDateTimeInClickhouseMathLanguage(fromRaw)
+				intervalBegin, err = cw.parseDateTimeInClickhouseMathLanguage(fromRaw, timeZone)
 				if err != nil {
 					return bucket_aggregations.DateRange{}, err
 				}
@@ -61,7 +65,7 @@ func (cw *ClickhouseQueryTranslator) parseDateRangeAggregation(dateRange QueryMa
 		to, exists := rangeMap["to"]
 		if exists {
 			if toRaw, ok := to.(string); ok {
-				intervalEnd, err = cw.parseDateTimeInClickhouseMathLanguage(toRaw)
+				intervalEnd, err = cw.parseDateTimeInClickhouseMathLanguage(toRaw, timeZone)
 				if err != nil {
 					return bucket_aggregations.DateRange{}, err
 				}
@@ -82,14 +86,20 @@ func (cw *ClickhouseQueryTranslator) parseDateRangeAggregation(dateRange QueryMa
 // parseDateTimeInClickhouseMathLanguage parses dateTime from Clickhouse's format
 // It's described here: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-daterange-aggregation.html
 // Maybe not 100% of it is implemented, not sure.
-func (cw *ClickhouseQueryTranslator) parseDateTimeInClickhouseMathLanguage(dateTime string) (string, error) {
+// timeZone (may be empty) is date_range's time_zone parameter, used both for simple dates and date math.
+func (cw *ClickhouseQueryTranslator) parseDateTimeInClickhouseMathLanguage(dateTime, timeZone string) (string, error) {
 	// So far we've seen only either:
 	// 1. 2024-01-01 format
 	if cw.isSimpleDate(dateTime) {
+		if timeZone != "" {
+			if date, err := time.Parse(time.DateOnly, dateTime); err == nil {
+				return model.AsString(kibana.DateTimeInTimeZone(date, timeZone)), nil
+			}
+		}
 		return "'" + dateTime + "'", nil
 	}
 	// 2. expressions like now() or now()-1d
-	res, err := cw.parseDateMathExpression(dateTime)
+	res, err := cw.parseDateMathExpression(dateTime, timeZone)
 	if err != nil {
 		return "", err
 	}
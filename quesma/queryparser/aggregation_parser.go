@@ -7,7 +7,8 @@ import (
 	"quesma/logger"
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
-	"regexp"
+	"quesma/model/metrics_aggregations"
+	"quesma/queryparser/painless"
 	"slices"
 	"strconv"
 )
@@ -27,6 +28,11 @@ type metricsAggregation struct {
 	Order               string                  // Only for top_metrics
 	IsFieldNameCompound bool                    // Only for a few aggregations, where we have only 1 field. It's a compound, so e.g. toHour(timestamp), not just "timestamp"
 	sigma               float64                 // only for standard deviation
+	wrapLongitude       bool                    // only for geo_bounds
+	showDistribution    bool                    // only for string_stats
+	rateUnit            string                  // only for rate
+	rateMode            string                  // only for rate
+	buckets             int                     // only for variable_width_histogram
 }
 
 const metricsAggregationDefaultFieldType = clickhouse.Invalid
@@ -155,9 +161,144 @@ func (cw *ClickhouseQueryTranslator) tryMetricsAggregation(queryMap QueryMap) (m
 		}, true
 	}
 
+	if geoBoundsRaw, exists := queryMap["geo_bounds"]; exists {
+		geoBounds, ok := geoBoundsRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("geo_bounds is not a map, but %T, value: %v. Skipping.", geoBoundsRaw, geoBoundsRaw)
+			return metricsAggregation{}, false
+		}
+		return metricsAggregation{
+			AggrType:      "geo_bounds",
+			Fields:        []model.Expr{cw.parseFieldField(geoBounds, "geo_bounds")},
+			wrapLongitude: cw.parseBoolField(geoBounds, "wrap_longitude", true),
+		}, true
+	}
+
+	if weightedAvgRaw, exists := queryMap["weighted_avg"]; exists {
+		weightedAvg, ok := weightedAvgRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("weighted_avg is not a map, but %T, value: %v. Skipping.", weightedAvgRaw, weightedAvgRaw)
+			return metricsAggregation{}, false
+		}
+		value, okValue := cw.parseWeightedAvgSource(weightedAvg, "value")
+		weight, okWeight := cw.parseWeightedAvgSource(weightedAvg, "weight")
+		if !okValue || !okWeight {
+			return metricsAggregation{}, false
+		}
+		return metricsAggregation{
+			AggrType: "weighted_avg",
+			Fields:   []model.Expr{value, weight},
+		}, true
+	}
+
+	for _, aggrType := range []string{"boxplot", "median_absolute_deviation", "string_stats"} {
+		paramsRaw, exists := queryMap[aggrType]
+		if !exists {
+			continue
+		}
+		params, ok := paramsRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("%s is not a map, but %T, value: %v. Skipping.", aggrType, paramsRaw, paramsRaw)
+			return metricsAggregation{}, false
+		}
+		field := cw.parseFieldField(params, aggrType)
+		if field == nil {
+			return metricsAggregation{}, false
+		}
+		return metricsAggregation{
+			AggrType:         aggrType,
+			Fields:           []model.Expr{field},
+			showDistribution: cw.parseBoolField(params, "show_distribution", false),
+		}, true
+	}
+
+	if histogramRaw, exists := queryMap["variable_width_histogram"]; exists {
+		histogram, ok := histogramRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("variable_width_histogram is not a map, but %T, value: %v. Skipping.", histogramRaw, histogramRaw)
+			return metricsAggregation{}, false
+		}
+		field := cw.parseFieldField(histogram, "variable_width_histogram")
+		if field == nil {
+			return metricsAggregation{}, false
+		}
+		buckets := cw.parseIntField(histogram, "buckets", bucket_aggregations.VariableWidthHistogramDefaultBuckets)
+		if buckets <= 0 {
+			logger.WarnWithCtx(cw.Ctx).Msgf("buckets in variable_width_histogram must be positive, got: %d. Skipping.", buckets)
+			return metricsAggregation{}, false
+		}
+		for _, param := range []string{"shard_size", "initial_buffer"} {
+			if _, exists := histogram[param]; exists {
+				logger.WarnWithCtx(cw.Ctx).Msgf("%s in variable_width_histogram is not supported, ignoring it", param)
+			}
+		}
+		return metricsAggregation{
+			AggrType: "variable_width_histogram",
+			Fields:   []model.Expr{field},
+			buckets:  buckets,
+		}, true
+	}
+
+	if rateRaw, exists := queryMap["rate"]; exists {
+		rate, ok := rateRaw.(QueryMap)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("rate is not a map, but %T, value: %v. Skipping.", rateRaw, rateRaw)
+			return metricsAggregation{}, false
+		}
+		unit := cw.parseStringField(rate, "unit", "")
+		if unit != "" && !metrics_aggregations.IsValidRateUnit(unit) {
+			logger.WarnWithCtx(cw.Ctx).Msgf("unsupported unit in rate aggregation: %s. Skipping.", unit)
+			return metricsAggregation{}, false
+		}
+		var fields []model.Expr
+		if _, hasField := rate["field"]; hasField {
+			field := cw.parseFieldField(rate, "rate")
+			if field == nil {
+				return metricsAggregation{}, false
+			}
+			fields = append(fields, field)
+		}
+		mode := cw.parseStringField(rate, "mode", "sum")
+		if mode != "sum" && mode != "value_count" {
+			logger.WarnWithCtx(cw.Ctx).Msgf("unsupported mode in rate aggregation: %s. Skipping.", mode)
+			return metricsAggregation{}, false
+		}
+		return metricsAggregation{
+			AggrType: "rate",
+			Fields:   fields,
+			rateUnit: unit,
+			rateMode: mode,
+		}, true
+	}
+
 	return metricsAggregation{}, false
 }
 
+// parseWeightedAvgSource parses "value" or "weight" of weighted_avg: {"field": "grade", "missing": 2}
+func (cw *ClickhouseQueryTranslator) parseWeightedAvgSource(weightedAvg QueryMap, sourceName string) (model.Expr, bool) {
+	sourceRaw, exists := weightedAvg[sourceName]
+	if !exists {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no %s in weighted_avg: %v. Skipping.", sourceName, weightedAvg)
+		return nil, false
+	}
+	source, ok := sourceRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("%s in weighted_avg is not a map, but %T, value: %v. Skipping.", sourceName, sourceRaw, sourceRaw)
+		return nil, false
+	}
+	field := cw.parseFieldField(source, "weighted_avg")
+	if field == nil {
+		return nil, false
+	}
+	if missing, exists := source["missing"]; exists {
+		if missingAsFloat, ok := missing.(float64); ok {
+			return model.NewFunction("COALESCE", field, model.NewLiteral(missingAsFloat)), true
+		}
+		logger.WarnWithCtx(cw.Ctx).Msgf("missing in %s of weighted_avg is not a number, but %T, value: %v. Ignoring it.", sourceName, missing, missing)
+	}
+	return field, true
+}
+
 func (cw *ClickhouseQueryTranslator) parseTopHits(queryMap QueryMap) (parsedTopHits metricsAggregation, success bool) {
 	paramsRaw, ok := queryMap["top_hits"]
 	if !ok {
@@ -284,6 +425,16 @@ func (cw *ClickhouseQueryTranslator) parseStringField(queryMap QueryMap, fieldNa
 	return defaultValue
 }
 
+func (cw *ClickhouseQueryTranslator) parseBoolField(queryMap QueryMap, fieldName string, defaultValue bool) bool {
+	if valueRaw, exists := queryMap[fieldName]; exists {
+		if asBool, ok := valueRaw.(bool); ok {
+			return asBool
+		}
+		logger.WarnWithCtx(cw.Ctx).Msgf("%s is not a bool, but %T, value: %v. Using default: %v", fieldName, valueRaw, valueRaw, defaultValue)
+	}
+	return defaultValue
+}
+
 // parseFieldFieldMaybeScript is basically almost a copy of parseFieldField above, but it also handles a basic script, if "field" is missing.
 func (cw *ClickhouseQueryTranslator) parseFieldFieldMaybeScript(shouldBeMap any, aggregationType string) (field model.Expr, isFromScript bool) {
 	Map, ok := shouldBeMap.(QueryMap)
@@ -327,15 +478,16 @@ func (cw *ClickhouseQueryTranslator) parseFieldFromScriptField(queryMap QueryMap
 	source, ok := sourceRaw.(string)
 	if !ok {
 		logger.WarnWithCtx(cw.Ctx).Msgf("source is not a string, but %T, value: %v", sourceRaw, sourceRaw)
+		return
 	}
 
-	// source must look like "doc['field_name'].value.getHour()" or "doc['field_name'].value.hourOfDay"
-	wantedRegex := regexp.MustCompile(`^doc\['(\w+)']\.value\.(?:getHour\(\)|hourOfDay)$`)
-	matches := wantedRegex.FindStringSubmatch(source)
-	if len(matches) == 2 {
-		return model.NewFunction("toHour", model.NewColumnRef(matches[1])), true
+	params, _ := script["params"].(QueryMap)
+	field, err := painless.ParseScript(source, painless.LiteralParams(params), cw.Schema)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't parse script: %v", err)
+		return nil, false
 	}
-	return
+	return field, true
 }
 
 func (cw *ClickhouseQueryTranslator) parseMinDocCount(queryMap QueryMap) int {
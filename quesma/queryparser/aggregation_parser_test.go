@@ -699,10 +699,14 @@ func Test_parseFieldFromScriptField(t *testing.T) {
 		expectedSuccess bool
 	}{
 		{goodQueryMap("doc['field1'].value.getHour()"), model.NewFunction("toHour", model.NewColumnRef("field1")), true},
-		{goodQueryMap("doc['field1'].value.getHour() + doc['field2'].value.getHour()"), nil, false},
+		{goodQueryMap("doc['field1'].value.getHour() + doc['field2'].value.getHour()"), model.NewParenExpr(model.NewInfixExpr(
+			model.NewFunction("toHour", model.NewColumnRef("field1")), "+", model.NewFunction("toHour", model.NewColumnRef("field2")))), true},
 		{goodQueryMap("doc['field1'].value.hourOfDay"), model.NewFunction("toHour", model.NewColumnRef("field1")), true},
-		{goodQueryMap("doc['field1'].value"), nil, false},
+		{goodQueryMap("doc['field1'].value"), model.NewColumnRef("field1"), true},
 		{goodQueryMap("value.getHour() + doc['field2'].value.getHour()"), nil, false},
+		{goodQueryMap("doc['field1']"), nil, false},
+		{QueryMap{"script": QueryMap{"source": "doc['field1'].value * params.factor", "params": QueryMap{"factor": 2.0}}},
+			model.NewParenExpr(model.NewInfixExpr(model.NewColumnRef("field1"), "*", model.NewLiteral(2.0))), true},
 		{QueryMap{}, nil, false},
 		{QueryMap{"script": QueryMap{}}, nil, false},
 		{QueryMap{"script": QueryMap{"source": nil}}, nil, false},
@@ -2,7 +2,10 @@
 // SPDX-License-Identifier: Elastic-2.0
 package queryparser
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 func BadRequestParseError(err error) []byte {
 	serialized, _ := json.Marshal(DashboardErrorResponse{
@@ -40,6 +43,25 @@ func InternalQuesmaError(msg string) []byte {
 	return serialized
 }
 
+func IndexNotFoundError(index string) []byte {
+	reason := fmt.Sprintf("no such index [%s]", index)
+	serialized, _ := json.Marshal(DashboardErrorResponse{
+		Error: Error{
+			RootCause: []RootCause{
+				{
+					Type:   "index_not_found_exception",
+					Reason: reason,
+				},
+			},
+			Type:   "index_not_found_exception",
+			Reason: reason,
+		},
+		Status: 404,
+	},
+	)
+	return serialized
+}
+
 type (
 	DashboardErrorResponse struct {
 		Error  `json:"error"`
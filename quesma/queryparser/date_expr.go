@@ -106,28 +106,37 @@ const DateMathExpressionFormatLiteral = "literal"
 const DateMathExpressionFormatClickhouse = "clickhouse_intervals"
 const DateMathExpressionFormatLiteralTest = "test"
 
-func DateMathExpressionRendererFactory(format string) DateMathExpressionRenderer {
+// DateMathExpressionRendererFactory returns a renderer for given format.
+// timeZone (e.g. "Europe/Warsaw", empty means UTC) is used for date math, just like Elastic's time_zone parameter:
+// "now-1d/d" is the start of yesterday in that time zone.
+func DateMathExpressionRendererFactory(format, timeZone string) DateMathExpressionRenderer {
 	switch format {
 	case "":
-		return &DateMathAsClickhouseIntervals{}
+		return &DateMathAsClickhouseIntervals{timeZone: timeZone}
 	case DateMathExpressionFormatClickhouse:
-		return &DateMathAsClickhouseIntervals{}
+		return &DateMathAsClickhouseIntervals{timeZone: timeZone}
 	case DateMathExpressionFormatLiteral:
-		return &DateMathExpressionAsLiteral{now: time.Now()}
+		return &DateMathExpressionAsLiteral{now: time.Now(), timeZone: timeZone}
 	case DateMathExpressionFormatLiteralTest:
-		return &DateMathExpressionAsLiteral{now: time.Date(2024, 5, 17, 12, 1, 2, 3, time.UTC)}
+		return &DateMathExpressionAsLiteral{now: time.Date(2024, 5, 17, 12, 1, 2, 3, time.UTC), timeZone: timeZone}
 	default:
 		return nil
 	}
 }
 
-type DateMathAsClickhouseIntervals struct{}
+type DateMathAsClickhouseIntervals struct {
+	timeZone string
+}
 
 func (b *DateMathAsClickhouseIntervals) RenderSQL(expression *DateMathExpression) (string, error) {
 
 	var result string
 
 	result = "now()"
+	if b.timeZone != "" {
+		// now() in the time zone, so that adding days/months/years and rounding is done there (e.g. across DST transitions)
+		result = fmt.Sprintf("now('%s')", b.timeZone)
+	}
 
 	for _, interval := range expression.intervals {
 
@@ -163,7 +172,15 @@ func (b *DateMathAsClickhouseIntervals) RenderSQL(expression *DateMathExpression
 	if expression.rounding != "" {
 
 		if function, ok := roundingFunction[string(expression.rounding)]; ok {
-			result = fmt.Sprintf("%s(%s)", function, result)
+			switch {
+			case b.timeZone == "":
+				result = fmt.Sprintf("%s(%s)", function, result)
+			case function == "toStartOfDay":
+				result = fmt.Sprintf("%s(%s, '%s')", function, result, b.timeZone)
+			default:
+				// toStartOfWeek/Month/Year return Date, we need midnight in the time zone, not in the server's one
+				result = fmt.Sprintf("toDateTime(%s(%s), '%s')", function, result, b.timeZone)
+			}
 		} else {
 			return "", fmt.Errorf("invalid rounding unit: %s", expression.rounding)
 		}
@@ -194,7 +211,8 @@ func (b *DateMathAsClickhouseIntervals) parseTimeUnit(timeUnit timeUnit) (string
 }
 
 type DateMathExpressionAsLiteral struct {
-	now time.Time
+	now      time.Time
+	timeZone string
 }
 
 func (b *DateMathExpressionAsLiteral) RenderSQL(expression *DateMathExpression) (string, error) {
@@ -202,6 +220,14 @@ func (b *DateMathExpressionAsLiteral) RenderSQL(expression *DateMathExpression)
 	const format = "2006-01-02 15:04:05"
 
 	result := b.now
+	if b.timeZone != "" {
+		location, err := time.LoadLocation(b.timeZone)
+		if err != nil {
+			return "", fmt.Errorf("invalid time zone: %s", b.timeZone)
+		}
+		// we compute everything in the time zone, but the literal is in now's location, like without it
+		result = result.In(location)
+	}
 
 	for _, interval := range expression.intervals {
 
@@ -257,5 +283,5 @@ func (b *DateMathExpressionAsLiteral) RenderSQL(expression *DateMathExpression)
 		return "", fmt.Errorf("unsupported rounding unit: %s", expression.rounding)
 	}
 
-	return fmt.Sprintf("'%s'", result.Format(format)), nil
+	return fmt.Sprintf("'%s'", result.In(b.now.Location()).Format(format)), nil
 }
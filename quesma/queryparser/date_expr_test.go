@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestParseDateMathExpression(t *testing.T) {
@@ -99,7 +100,7 @@ func Test_DateMathExpressionAsLiteral(t *testing.T) {
 			}
 
 			// this renderer is single use, so we can't reuse it
-			renderer := DateMathExpressionRendererFactory(DateMathExpressionFormatLiteralTest)
+			renderer := DateMathExpressionRendererFactory(DateMathExpressionFormatLiteralTest, "")
 
 			resultExpr, err := renderer.RenderSQL(dt)
 			assert.NoError(t, err)
@@ -112,3 +113,39 @@ func Test_DateMathExpressionAsLiteral(t *testing.T) {
 		})
 	}
 }
+
+func Test_DateMathExpressionWithTimeZone(t *testing.T) {
+	// Warsaw: 2024-03-31 02:00 CET -> 03:00 CEST, 2024-10-27 03:00 CEST -> 02:00 CET
+	springDST := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	autumnDST := time.Date(2024, 10, 27, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input           string
+		now             time.Time
+		expectedLiteral string
+		expectedSQL     string
+	}{
+		{"now/d", springDST, "'2024-03-30 23:00:00'", "toStartOfDay(now('Europe/Warsaw'), 'Europe/Warsaw')"},
+		{"now-1d/d", springDST, "'2024-03-29 23:00:00'", "toStartOfDay(subDate(now('Europe/Warsaw'), INTERVAL 1 day), 'Europe/Warsaw')"},
+		{"now-1d", springDST, "'2024-03-30 13:00:00'", "subDate(now('Europe/Warsaw'), INTERVAL 1 day)"}, // 23h earlier
+		{"now-24h", springDST, "'2024-03-30 12:00:00'", "subDate(now('Europe/Warsaw'), INTERVAL 24 hour)"},
+		{"now/d", autumnDST, "'2024-10-26 22:00:00'", "toStartOfDay(now('Europe/Warsaw'), 'Europe/Warsaw')"},
+		{"now-1d", autumnDST, "'2024-10-26 11:00:00'", "subDate(now('Europe/Warsaw'), INTERVAL 1 day)"}, // 25h earlier
+		{"now/M", autumnDST, "'2024-09-30 22:00:00'", "toDateTime(toStartOfMonth(now('Europe/Warsaw')), 'Europe/Warsaw')"},
+		{"now/Y", autumnDST, "'2023-12-31 23:00:00'", "toDateTime(toStartOfYear(now('Europe/Warsaw')), 'Europe/Warsaw')"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input+" "+test.now.String(), func(t *testing.T) {
+			dt, err := ParseDateMathExpression(test.input)
+			require.NoError(t, err)
+
+			literal, err := (&DateMathExpressionAsLiteral{now: test.now, timeZone: "Europe/Warsaw"}).RenderSQL(dt)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedLiteral, literal)
+
+			sql, err := DateMathExpressionRendererFactory(DateMathExpressionFormatClickhouse, "Europe/Warsaw").RenderSQL(dt)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedSQL, sql)
+		})
+	}
+}
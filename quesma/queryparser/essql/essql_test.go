@@ -0,0 +1,133 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package essql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/model"
+	"quesma/schema"
+	"testing"
+)
+
+var testSchema = schema.Schema{Fields: map[schema.FieldName]schema.Field{
+	"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	"host.name":  {PropertyName: "host.name", InternalPropertyName: "host_name", Type: schema.QuesmaTypeKeyword},
+	"bytes":      {PropertyName: "bytes", InternalPropertyName: "bytes", Type: schema.QuesmaTypeLong},
+	"price":      {PropertyName: "price", InternalPropertyName: "price", Type: schema.QuesmaTypeFloat},
+	"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+}}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		params          []any
+		expectedIndex   string
+		expectedSql     string
+		expectedColumns []Column
+	}{
+		{
+			name:          "select star",
+			query:         `SELECT * FROM logs LIMIT 5`,
+			expectedIndex: "logs",
+			expectedSql: `SELECT "@timestamp", "bytes", "host.name", "message", "price" FROM __quesma_table_name ` +
+				`ORDER BY "@timestamp" ASC, "bytes" ASC, "host.name" ASC, "message" ASC, "price" ASC LIMIT 5`,
+			expectedColumns: []Column{{"@timestamp", "datetime"}, {"bytes", "long"}, {"host.name", "keyword"},
+				{"message", "text"}, {"price", "double"}},
+		},
+		{
+			name:            "where with parameters",
+			query:           `select message, "host.name" from "logs-*" where bytes > ? and message like 'err%' order by @timestamp desc`,
+			params:          []any{100.0},
+			expectedIndex:   "logs-*",
+			expectedSql:     `SELECT "message", "host.name" FROM __quesma_table_name WHERE ("bytes">100 AND "message" LIKE 'err%') ORDER BY "@timestamp" DESC, "message" ASC, "host.name" ASC`,
+			expectedColumns: []Column{{"message", "text"}, {"host.name", "keyword"}},
+		},
+		{
+			name:          "group by with aliases",
+			query:         `SELECT host.name AS host, COUNT(*) AS c, AVG(bytes) FROM logs GROUP BY host HAVING c > 10 ORDER BY c DESC`,
+			expectedIndex: "logs",
+			expectedSql: `SELECT "host.name" AS "host", count(*) AS "c", avg("bytes") FROM __quesma_table_name ` +
+				`GROUP BY "host" HAVING "c">10 ORDER BY "c" DESC, "host" ASC`,
+			expectedColumns: []Column{{"host", "keyword"}, {"c", "long"}, {"AVG(bytes)", "double"}},
+		},
+		{
+			name:            "dates, in and between",
+			query:           `SELECT COUNT(DISTINCT bytes) FROM logs l WHERE l.@timestamp >= '2024-01-01' AND bytes NOT IN (1, 2) AND price BETWEEN 1 AND 2.5`,
+			expectedIndex:   "logs",
+			expectedSql:     `SELECT count(DISTINCT "bytes") FROM __quesma_table_name WHERE (("@timestamp">=parseDateTime64BestEffort('2024-01-01') AND NOT ("bytes" IN tuple(1,2))) AND ("price">=1 AND "price"<=2.5))`,
+			expectedColumns: []Column{{"COUNT(DISTINCT bytes)", "long"}},
+		},
+		{
+			name:          "functions and arithmetic",
+			query:         `SELECT TOP 3 UPPER(message), bytes / 2, CASE WHEN bytes IS NULL THEN 'none' ELSE 'some' END, DATE_TRUNC('days', @timestamp) FROM logs`,
+			expectedIndex: "logs",
+			expectedSql: `SELECT upperUTF8("message"), intDiv("bytes",2), multiIf("bytes" IS NULL,'none','some'), dateTrunc('day',"@timestamp") FROM __quesma_table_name ` +
+				`ORDER BY upperUTF8("message") ASC, intDiv("bytes",2) ASC, multiIf("bytes" IS NULL,'none','some') ASC, dateTrunc('day',"@timestamp") ASC LIMIT 3`,
+			expectedColumns: []Column{{"UPPER(message)", "keyword"}, {"bytes / 2", "long"}, {"CASE WHEN bytes IS NULL THEN 'none' ELSE 'some' END", "keyword"}, {"DATE_TRUNC('days', @timestamp)", "datetime"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Parse(tt.query, tt.params)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedIndex, stmt.Index())
+
+			query, err := stmt.Translate(testSchema)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSql, model.AsString(query.SelectCommand))
+			assert.Equal(t, tt.expectedColumns, query.Columns)
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"no from", `SELECT 1`, "expected FROM but got end of query at position 8"},
+		{"unterminated string", `SELECT * FROM logs WHERE message = 'abc`, "unterminated quote ' at position 35"},
+		{"unknown column", `SELECT foo FROM logs`, "unknown column [foo]"},
+		{"unknown function", `SELECT FOO(bytes) FROM logs`, "unknown function [FOO]"},
+		{"missing parameter", `SELECT * FROM logs WHERE bytes > ?`, "not enough parameters"},
+		{"trailing tokens", `SELECT * FROM logs LIMIT 1 2`, "unexpected 2 at position 27"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Parse(tt.query, nil)
+			if err == nil {
+				_, err = stmt.Translate(testSchema)
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestTranslateTiebreakerDocumentId(t *testing.T) {
+	schemaWithIds := schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"_id":     {PropertyName: "_id", InternalPropertyName: "_id", Type: schema.QuesmaTypeKeyword},
+		"message": {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"bytes":   {PropertyName: "bytes", InternalPropertyName: "bytes", Type: schema.QuesmaTypeLong},
+	}}
+	tests := []struct {
+		query       string
+		expectedSql string
+	}{
+		{`SELECT message FROM logs ORDER BY bytes`, `SELECT "message" FROM __quesma_table_name ORDER BY "bytes" ASC, "_id" ASC`},
+		{`SELECT DISTINCT message FROM logs`, `SELECT DISTINCT "message" FROM __quesma_table_name ORDER BY "message" ASC`},
+		{`SELECT COUNT(*), MAX(bytes) FROM logs`, `SELECT count(*), max("bytes") FROM __quesma_table_name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := Parse(tt.query, nil)
+			require.NoError(t, err)
+			query, err := stmt.Translate(schemaWithIds)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSql, model.AsString(query.SelectCommand))
+		})
+	}
+}
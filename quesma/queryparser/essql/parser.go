@@ -0,0 +1,812 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package essql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parser for the subset of Elasticsearch SQL (https://www.elastic.co/guide/en/elasticsearch/reference/current/sql-spec.html)
+// used by BI tools and the SQL CLI.
+//
+// We support a single SELECT [DISTINCT | TOP n] ... FROM index [WHERE ...] [GROUP BY ...] [HAVING ...] [ORDER BY ...] [LIMIT n]
+// with arithmetic, comparisons, AND/OR/NOT, IS [NOT] NULL, [NOT] BETWEEN, [NOT] IN, [NOT] LIKE, RLIKE,
+// CASE WHEN, CAST/CONVERT/::, function calls and `?` parameters.
+//
+// We don't support joins, subqueries, PIVOT, INTERVAL literals, or full-text functions (MATCH, QUERY, SCORE).
+
+type (
+	node interface {
+		isNode()
+	}
+	literalNode struct {
+		value any // int64, float64, string, bool or nil
+	}
+	fieldNode struct {
+		name string // dotted path, e.g. host.name
+	}
+	starNode     struct{} // * in SELECT * or COUNT(*)
+	functionNode struct {
+		name     string // upper case
+		distinct bool   // e.g. COUNT(DISTINCT x)
+		args     []node
+	}
+	unaryNode struct {
+		op  string // "-" or "NOT"
+		arg node
+	}
+	binaryNode struct {
+		op          string // upper case for keywords, e.g. AND, LIKE
+		left, right node
+	}
+	isNullNode struct {
+		arg node
+		not bool
+	}
+	betweenNode struct {
+		arg, from, to node
+		not           bool
+	}
+	inNode struct {
+		arg    node
+		values []node
+		not    bool
+	}
+	caseNode struct {
+		conditions, results []node
+		otherwise           node // nil if there is no ELSE
+	}
+	castNode struct {
+		arg      node
+		typeName string // upper case
+	}
+)
+
+func (literalNode) isNode()  {}
+func (fieldNode) isNode()    {}
+func (starNode) isNode()     {}
+func (functionNode) isNode() {}
+func (unaryNode) isNode()    {}
+func (binaryNode) isNode()   {}
+func (isNullNode) isNode()   {}
+func (betweenNode) isNode()  {}
+func (inNode) isNode()       {}
+func (caseNode) isNode()     {}
+func (castNode) isNode()     {}
+
+type selectItem struct {
+	expr  node
+	alias string // "" if none
+	text  string // the item as written in the query, it's the column name if there is no alias
+}
+
+type orderItem struct {
+	expr node
+	desc bool
+}
+
+// NoLimit is the limit of a statement without LIMIT (or TOP)
+const NoLimit = -1
+
+// Statement is a parsed SELECT query
+type Statement struct {
+	distinct   bool
+	items      []selectItem
+	index      string
+	tableAlias string
+	where      node
+	groupBy    []node
+	having     node
+	orderBy    []orderItem
+	limit      int
+}
+
+// Index returns the index pattern the query selects from
+func (s *Statement) Index() string {
+	return s.index
+}
+
+// reserved keywords can't be used as unquoted identifiers
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"AS": true, "AND": true, "OR": true, "NOT": true, "IS": true, "NULL": true, "IN": true, "LIKE": true, "RLIKE": true,
+	"BETWEEN": true, "ASC": true, "DESC": true, "DISTINCT": true, "TRUE": true, "FALSE": true, "CASE": true, "WHEN": true,
+	"THEN": true, "ELSE": true, "END": true, "NULLS": true, "TOP": true, "ALL": true,
+}
+
+type parser struct {
+	query  []rune
+	tokens []token
+	pos    int
+	params []any
+	param  int // index of the next `?` parameter
+}
+
+// Parse parses the query, `?` placeholders are replaced with params (in order)
+func Parse(query string, params []any) (*Statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: []rune(query), tokens: tokens, params: params}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, value string) bool {
+	if p.peek().is(kind, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.peek().isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	if t := p.next(); !t.is(kind, value) {
+		return fmt.Errorf("expected '%s' but got %s at position %d", value, t, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if t := p.next(); !t.isKeyword(keyword) {
+		return fmt.Errorf("expected %s but got %s at position %d", keyword, t, t.pos)
+	}
+	return nil
+}
+
+// isIdentifier checks if the token can be used as a name (of a field, alias, function)
+func isIdentifier(t token) bool {
+	return t.kind == tokenQuotedIdentifier || (t.kind == tokenIdentifier && !reserved[strings.ToUpper(t.value)])
+}
+
+func (p *parser) expectIdentifier() (string, error) {
+	t := p.next()
+	if !isIdentifier(t) {
+		return "", fmt.Errorf("expected identifier but got %s at position %d", t, t.pos)
+	}
+	return t.value, nil
+}
+
+func (p *parser) expectInt() (int, error) {
+	t := p.next()
+	if t.kind == tokenParameter {
+		value, err := p.nextParam()
+		if err != nil {
+			return 0, err
+		}
+		if number, ok := value.(literalNode).value.(int64); ok && number >= 0 {
+			return int(number), nil
+		}
+		return 0, fmt.Errorf("expected non-negative integer parameter but got %v", value.(literalNode).value)
+	}
+	number, err := strconv.Atoi(t.value)
+	if t.kind != tokenNumber || err != nil || number < 0 {
+		return 0, fmt.Errorf("expected non-negative integer but got %s at position %d", t, t.pos)
+	}
+	return number, nil
+}
+
+// textFrom returns the query text from the token at position `start` to the last consumed token
+func (p *parser) textFrom(start int) string {
+	return string(p.query[p.tokens[start].pos:p.tokens[p.pos-1].end])
+}
+
+func (p *parser) parseSelect() (*Statement, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &Statement{limit: NoLimit}
+	if p.acceptKeyword("DISTINCT") {
+		stmt.distinct = true
+	} else {
+		p.acceptKeyword("ALL")
+	}
+	if p.acceptKeyword("TOP") {
+		limit, err := p.expectInt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = limit
+	}
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.items = append(stmt.items, item)
+		if !p.accept(tokenOperator, ",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	index, err := p.parseIndex()
+	if err != nil {
+		return nil, err
+	}
+	stmt.index = index
+	if p.acceptKeyword("AS") {
+		if stmt.tableAlias, err = p.expectIdentifier(); err != nil {
+			return nil, err
+		}
+	} else if isIdentifier(p.peek()) {
+		stmt.tableAlias = p.next().value
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			stmt.groupBy = append(stmt.groupBy, expr)
+			if !p.accept(tokenOperator, ",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("HAVING") {
+		if stmt.having, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			item, err := p.parseOrderItem()
+			if err != nil {
+				return nil, err
+			}
+			stmt.orderBy = append(stmt.orderBy, item)
+			if !p.accept(tokenOperator, ",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if !p.acceptKeyword("ALL") {
+			limit, err := p.expectInt()
+			if err != nil {
+				return nil, err
+			}
+			if stmt.limit == NoLimit || limit < stmt.limit {
+				stmt.limit = limit
+			}
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseSelectItem() (selectItem, error) {
+	start := p.pos
+	var expr node
+	if p.accept(tokenOperator, "*") {
+		expr = starNode{}
+	} else {
+		var err error
+		if expr, err = p.parseExpression(); err != nil {
+			return selectItem{}, err
+		}
+	}
+	item := selectItem{expr: expr, text: p.textFrom(start)}
+
+	if p.acceptKeyword("AS") {
+		alias, err := p.expectIdentifier()
+		if err != nil {
+			return selectItem{}, err
+		}
+		item.alias = alias
+	} else if isIdentifier(p.peek()) {
+		item.alias = p.next().value
+	}
+	return item, nil
+}
+
+func (p *parser) parseOrderItem() (orderItem, error) {
+	expr, err := p.parseExpression()
+	if err != nil {
+		return orderItem{}, err
+	}
+	item := orderItem{expr: expr}
+	if p.acceptKeyword("DESC") {
+		item.desc = true
+	} else {
+		p.acceptKeyword("ASC")
+	}
+	// NULLS FIRST/LAST is accepted, but we keep ClickHouse's default (NULLs last)
+	if p.acceptKeyword("NULLS") {
+		if !p.acceptKeyword("FIRST") && !p.acceptKeyword("LAST") {
+			t := p.peek()
+			return orderItem{}, fmt.Errorf("expected FIRST or LAST but got %s at position %d", t, t.pos)
+		}
+	}
+	return item, nil
+}
+
+// parseIndex parses the index pattern after FROM. Unquoted patterns may contain `-`, `*` and `.`, e.g. logs-*
+func (p *parser) parseIndex() (string, error) {
+	t := p.peek()
+	if t.kind == tokenQuotedIdentifier || t.kind == tokenString {
+		p.next()
+		return t.value, nil
+	}
+	if t.kind != tokenIdentifier && !t.is(tokenOperator, "*") {
+		return "", fmt.Errorf("expected index name but got %s at position %d", t, t.pos)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(p.next().value)
+	for {
+		t = p.peek()
+		adjacent := t.pos == p.tokens[p.pos-1].end
+		partOfName := t.kind == tokenIdentifier || t.kind == tokenNumber ||
+			t.is(tokenOperator, "-") || t.is(tokenOperator, "*") || t.is(tokenOperator, ".")
+		if !adjacent || !partOfName {
+			break
+		}
+		sb.WriteString(p.next().value)
+	}
+	return sb.String(), nil
+}
+
+func (p *parser) parseExpression() (node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.acceptKeyword("NOT") {
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "NOT", arg: arg}, nil
+	}
+	return p.parsePredicate()
+}
+
+var comparisonOperators = map[string]string{"=": "=", "==": "=", "<>": "!=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (p *parser) parsePredicate() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if op, ok := comparisonOperators[t.value]; ok && t.kind == tokenOperator {
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{op: op, left: left, right: right}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return isNullNode{arg: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("BETWEEN"):
+		from, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		to, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return betweenNode{arg: left, from: from, to: to, not: not}, nil
+
+	case p.acceptKeyword("IN"):
+		values, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("IN requires at least one value at position %d", t.pos)
+		}
+		return inNode{arg: left, values: values, not: not}, nil
+
+	case p.peek().isKeyword("LIKE") || p.peek().isKeyword("RLIKE"):
+		op := strings.ToUpper(p.next().value)
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var result node = binaryNode{op: op, left: left, right: pattern}
+		if not {
+			result = unaryNode{op: "NOT", arg: result}
+		}
+		return result, nil
+	}
+
+	if not {
+		t = p.peek()
+		return nil, fmt.Errorf("expected BETWEEN, IN, LIKE or RLIKE after NOT but got %s at position %d", t, t.pos)
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is(tokenOperator, "+") && !t.is(tokenOperator, "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.value, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is(tokenOperator, "*") && !t.is(tokenOperator, "/") && !t.is(tokenOperator, "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.value, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept(tokenOperator, "-") {
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// negative numbers are literals
+		if literal, ok := arg.(literalNode); ok {
+			switch value := literal.value.(type) {
+			case int64:
+				return literalNode{value: -value}, nil
+			case float64:
+				return literalNode{value: -value}, nil
+			}
+		}
+		return unaryNode{op: "-", arg: arg}, nil
+	}
+	if p.accept(tokenOperator, "+") {
+		return p.parseUnary()
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "::") {
+		typeName, err := p.expectIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		expr = castNode{arg: expr, typeName: strings.ToUpper(typeName)}
+	}
+	return expr, nil
+}
+
+func (p *parser) nextParam() (node, error) {
+	if p.param >= len(p.params) {
+		return nil, fmt.Errorf("not enough parameters, expected at least %d", p.param+1)
+	}
+	value := p.params[p.param]
+	p.param++
+	// parameters are either plain values or {"type": "...", "value": ...}
+	if typed, ok := value.(map[string]any); ok {
+		value = typed["value"]
+	}
+	switch value := value.(type) {
+	case nil, string, bool, int64:
+		return literalNode{value: value}, nil
+	case int:
+		return literalNode{value: int64(value)}, nil
+	case float64:
+		if value == float64(int64(value)) {
+			return literalNode{value: int64(value)}, nil
+		}
+		return literalNode{value: value}, nil
+	default:
+		return nil, fmt.Errorf("unsupported parameter value: %v (%T)", value, value)
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenNumber:
+		if number, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+			return literalNode{value: number}, nil
+		}
+		number, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at position %d", t.value, t.pos)
+		}
+		return literalNode{value: number}, nil
+
+	case t.kind == tokenString:
+		return literalNode{value: t.value}, nil
+
+	case t.kind == tokenParameter:
+		return p.nextParam()
+
+	case t.isKeyword("TRUE"):
+		return literalNode{value: true}, nil
+
+	case t.isKeyword("FALSE"):
+		return literalNode{value: false}, nil
+
+	case t.isKeyword("NULL"):
+		return literalNode{value: nil}, nil
+
+	case t.is(tokenOperator, "("):
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokenOperator, ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+
+	case t.isKeyword("CASE"):
+		return p.parseCase()
+
+	case t.isKeyword("CAST") && p.peek().is(tokenOperator, "("):
+		p.next()
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		typeName, err := p.expectIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokenOperator, ")"); err != nil {
+			return nil, err
+		}
+		return castNode{arg: arg, typeName: strings.ToUpper(typeName)}, nil
+
+	case t.isKeyword("CONVERT") && p.peek().is(tokenOperator, "("):
+		args, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("CONVERT expects an expression and a type at position %d", t.pos)
+		}
+		typeName, ok := args[1].(fieldNode)
+		if !ok {
+			return nil, fmt.Errorf("CONVERT expects a type name at position %d", t.pos)
+		}
+		// ODBC style type names are accepted too, e.g. SQL_INTEGER
+		return castNode{arg: args[0], typeName: strings.TrimPrefix(strings.ToUpper(typeName.name), "SQL_")}, nil
+
+	case isIdentifier(t) && t.kind == tokenIdentifier && p.peek().is(tokenOperator, "("):
+		return p.parseFunction(strings.ToUpper(t.value))
+
+	case t.isKeyword("CURRENT_TIMESTAMP") || t.isKeyword("CURRENT_DATE") || t.isKeyword("CURRENT_TIME"):
+		return functionNode{name: strings.ToUpper(t.value)}, nil
+
+	case isIdentifier(t):
+		name := t.value
+		for p.peek().is(tokenOperator, ".") && isIdentifier(p.peekAt(1)) {
+			p.next()
+			name += "." + p.next().value
+		}
+		return fieldNode{name: name}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
+
+// parseArguments parses a parenthesized, comma separated list of expressions
+func (p *parser) parseArguments() ([]node, error) {
+	if err := p.expect(tokenOperator, "("); err != nil {
+		return nil, err
+	}
+	var args []node
+	if p.accept(tokenOperator, ")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(tokenOperator, ")") {
+			return args, nil
+		}
+		if err = p.expect(tokenOperator, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseFunction(name string) (node, error) {
+	function := functionNode{name: name}
+	// COUNT(*) and COUNT(DISTINCT x)
+	if p.peekAt(1).is(tokenOperator, "*") && p.peekAt(2).is(tokenOperator, ")") {
+		p.pos += 3
+		function.args = []node{starNode{}}
+		return function, nil
+	}
+	if p.peekAt(1).isKeyword("DISTINCT") {
+		p.next()
+		p.next()
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokenOperator, ")"); err != nil {
+			return nil, err
+		}
+		function.distinct = true
+		function.args = []node{arg}
+		return function, nil
+	}
+
+	args, err := p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	function.args = args
+	return function, nil
+}
+
+func (p *parser) parseCase() (node, error) {
+	var result caseNode
+	// simple form, CASE x WHEN 1 THEN ... is rewritten to CASE WHEN x = 1 THEN ...
+	var operand node
+	if !p.peek().isKeyword("WHEN") {
+		var err error
+		if operand, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("WHEN") {
+		condition, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if operand != nil {
+			condition = binaryNode{op: "=", left: operand, right: condition}
+		}
+		if err = p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		result.conditions = append(result.conditions, condition)
+		result.results = append(result.results, value)
+	}
+	if len(result.conditions) == 0 {
+		t := p.peek()
+		return nil, fmt.Errorf("expected WHEN but got %s at position %d", t, t.pos)
+	}
+	if p.acceptKeyword("ELSE") {
+		otherwise, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		result.otherwise = otherwise
+	}
+	if err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
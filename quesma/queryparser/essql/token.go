@@ -0,0 +1,156 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package essql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenQuotedIdentifier // "name" or `name`
+	tokenNumber
+	tokenString
+	tokenParameter // ?
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int // position in the query (first rune)
+	end   int // position in the query after the last rune
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+// isKeyword checks (case-insensitively) if the token is the given keyword, keywords are unquoted identifiers
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenIdentifier && strings.EqualFold(t.value, keyword)
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return fmt.Sprintf("'%s'", t.value)
+	case tokenQuotedIdentifier:
+		return fmt.Sprintf(`"%s"`, t.value)
+	default:
+		return t.value
+	}
+}
+
+// operators sorted so that longer ones are matched first
+var operators = []string{
+	"<=", ">=", "<>", "!=", "==", "::",
+	"(", ")", ",", ".", "*", "+", "-", "/", "%", "<", ">", "=",
+}
+
+// tokenize splits an Elasticsearch SQL query into tokens. The last token is always tokenEOF.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-': // line comment
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*': // block comment
+			start := i
+			for i += 2; i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/'); i++ {
+			}
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("unterminated comment at position %d", start)
+			}
+			i += 2
+
+		case unicode.IsLetter(r) || r == '_' || r == '@':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '@') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, value: string(runes[start:i]), pos: start, end: i})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: string(runes[start:i]), pos: start, end: i})
+
+		case r == '\'' || r == '"' || r == '`':
+			// a doubled quote inside is an escaped quote, e.g. 'it''s'
+			start := i
+			quote := r
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated quote %c at position %d", quote, start)
+				}
+				if runes[i] == quote {
+					if i+1 < len(runes) && runes[i+1] == quote {
+						sb.WriteRune(quote)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			kind := tokenQuotedIdentifier
+			if quote == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, token{kind: kind, value: sb.String(), pos: start, end: i})
+
+		case r == '?':
+			tokens = append(tokens, token{kind: tokenParameter, value: "?", pos: i, end: i + 1})
+			i++
+
+		default:
+			matched := false
+			rest := string(runes[i:])
+			for _, op := range operators {
+				if strings.HasPrefix(rest, op) {
+					tokens = append(tokens, token{kind: tokenOperator, value: op, pos: i, end: i + len([]rune(op))})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes), end: len(runes)}), nil
+}
@@ -0,0 +1,639 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package essql
+
+import (
+	"fmt"
+	"quesma/model"
+	"quesma/schema"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Elasticsearch SQL types of result columns
+const (
+	typeKeyword  = "keyword"
+	typeText     = "text"
+	typeLong     = "long"
+	typeInteger  = "integer"
+	typeDouble   = "double"
+	typeBoolean  = "boolean"
+	typeDatetime = "datetime"
+	typeIp       = "ip"
+	typeGeoPoint = "geo_point"
+	typeObject   = "object"
+	typeNull     = "null"
+)
+
+// Column describes a column of the result, the same way as Elasticsearch SQL does
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Query is the translated statement. Fields are public (schema) names, so the query has to go
+// through the transformation pipeline, like any other query, before it's run.
+type Query struct {
+	SelectCommand *model.SelectCommand
+	Columns       []Column
+	Limit         int // LIMIT of the statement, NoLimit if there is none (SelectCommand.Limit is used for paging)
+}
+
+type typedExpr struct {
+	expr model.Expr
+	typ  string
+}
+
+type translator struct {
+	schema     schema.Schema
+	tableAlias string
+	aliases    map[string]typedExpr // select aliases, they can be used in GROUP BY, HAVING and ORDER BY
+	aggregated bool                 // an aggregate function is used, so without GROUP BY the result is a single row
+}
+
+// Translate translates the statement to ClickHouse, resolving fields through the index schema
+func (s *Statement) Translate(indexSchema schema.Schema) (*Query, error) {
+	t := &translator{schema: indexSchema, tableAlias: s.tableAlias, aliases: make(map[string]typedExpr)}
+	query := &Query{SelectCommand: &model.SelectCommand{
+		IsDistinct: s.distinct,
+		FromClause: model.NewTableRef(model.SingleTableNamePlaceHolder),
+	}, Limit: s.limit}
+	if s.limit != NoLimit {
+		query.SelectCommand.Limit = s.limit
+	}
+
+	for _, item := range s.items {
+		if _, ok := item.expr.(starNode); ok {
+			for _, field := range t.allFields() {
+				query.SelectCommand.Columns = append(query.SelectCommand.Columns, model.NewColumnRef(field.PropertyName.AsString()))
+				query.Columns = append(query.Columns, Column{Name: field.PropertyName.AsString(), Type: fieldType(field)})
+			}
+			continue
+		}
+		column, err := t.lower(item.expr, false)
+		if err != nil {
+			return nil, err
+		}
+		name := item.text
+		if item.alias != "" {
+			name = item.alias
+			t.aliases[item.alias] = column
+			column.expr = model.NewAliasedExpr(column.expr, item.alias)
+		} else if field, ok := item.expr.(fieldNode); ok {
+			name = t.fieldName(field.name)
+		}
+		query.SelectCommand.Columns = append(query.SelectCommand.Columns, column.expr)
+		query.Columns = append(query.Columns, Column{Name: name, Type: column.typ})
+	}
+	if len(query.SelectCommand.Columns) == 0 {
+		return nil, fmt.Errorf("no columns to select")
+	}
+
+	if s.where != nil {
+		where, err := t.lower(s.where, false)
+		if err != nil {
+			return nil, err
+		}
+		query.SelectCommand.WhereClause = where.expr
+	}
+	for _, groupBy := range s.groupBy {
+		expr, err := t.lower(groupBy, true)
+		if err != nil {
+			return nil, err
+		}
+		query.SelectCommand.GroupBy = append(query.SelectCommand.GroupBy, expr.expr)
+	}
+	if s.having != nil {
+		having, err := t.lower(s.having, true)
+		if err != nil {
+			return nil, err
+		}
+		query.SelectCommand.HavingClause = having.expr
+	}
+	for _, orderBy := range s.orderBy {
+		expr, err := t.lower(orderBy.expr, true)
+		if err != nil {
+			return nil, err
+		}
+		direction := model.AscOrder
+		if orderBy.desc {
+			direction = model.DescOrder
+		}
+		query.SelectCommand.OrderBy = append(query.SelectCommand.OrderBy, model.NewOrderByExpr(expr.expr, direction))
+	}
+	query.SelectCommand.OrderBy = append(query.SelectCommand.OrderBy, t.tiebreakers(query)...)
+	return query, nil
+}
+
+// tiebreakers make the order of rows total, so that paging with OFFSET is deterministic: group keys
+// for GROUP BY, the document id if the table stores it, or else all selected columns (rows equal
+// on all of them are indistinguishable, so their order doesn't matter)
+func (t *translator) tiebreakers(query *Query) []model.OrderByExpr {
+	var keys []model.Expr
+	switch {
+	case len(query.SelectCommand.GroupBy) > 0:
+		keys = query.SelectCommand.GroupBy
+	case t.aggregated:
+		return nil
+	default:
+		if field, ok := t.schema.ResolveFieldByInternalName(model.DocumentIdFieldName); ok && !query.SelectCommand.IsDistinct {
+			keys = []model.Expr{model.NewColumnRef(field.PropertyName.AsString())}
+			break
+		}
+		for i, column := range query.SelectCommand.Columns {
+			if query.Columns[i].Type == typeObject || query.Columns[i].Type == typeGeoPoint {
+				continue // not comparable in ClickHouse
+			}
+			if aliased, ok := column.(model.AliasedExpr); ok {
+				column = aliased.AliasRef()
+			}
+			keys = append(keys, column)
+		}
+	}
+
+	ordered := make(map[string]bool)
+	for _, orderBy := range query.SelectCommand.OrderBy {
+		ordered[model.AsString(orderBy.Expr)] = true
+	}
+	var tiebreakers []model.OrderByExpr
+	for _, key := range keys {
+		if !ordered[model.AsString(key)] {
+			ordered[model.AsString(key)] = true
+			tiebreakers = append(tiebreakers, model.NewOrderByExpr(key, model.AscOrder))
+		}
+	}
+	return tiebreakers
+}
+
+// allFields returns fields selected by `*`, sorted by name
+func (t *translator) allFields() []schema.Field {
+	var fields []schema.Field
+	for _, field := range t.schema.Fields {
+		if field.Origin == schema.FieldSourceIngest {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].PropertyName < fields[j].PropertyName
+	})
+	return fields
+}
+
+// fieldName strips the table alias, e.g. l.message -> message for FROM logs AS l
+func (t *translator) fieldName(name string) string {
+	if t.tableAlias != "" {
+		return strings.TrimPrefix(name, t.tableAlias+".")
+	}
+	return name
+}
+
+func fieldType(field schema.Field) string {
+	switch field.Type.Name {
+	case schema.QuesmaTypeDate.Name, schema.QuesmaTypeTimestamp.Name:
+		return typeDatetime
+	case schema.QuesmaTypeFloat.Name:
+		return typeDouble
+	case schema.QuesmaTypePoint.Name:
+		return typeGeoPoint
+	case schema.QuesmaTypeMap.Name, schema.QuesmaTypeArray.Name, schema.QuesmaTypeUnknown.Name:
+		return typeObject
+	default:
+		return field.Type.Name
+	}
+}
+
+func isNumeric(typ string) bool {
+	return typ == typeLong || typ == typeInteger || typ == typeDouble || typ == schema.QuesmaTypeUnsignedLong.Name
+}
+
+func isString(typ string) bool {
+	return typ == typeKeyword || typ == typeText
+}
+
+func stringLiteral(s string) model.Expr {
+	escaped := strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`)
+	return model.NewLiteral("'" + escaped + "'")
+}
+
+// lower translates an expression, withAliases allows references to select aliases (in GROUP BY, HAVING, ORDER BY)
+func (t *translator) lower(n node, withAliases bool) (typedExpr, error) {
+	switch n := n.(type) {
+	case literalNode:
+		switch value := n.value.(type) {
+		case nil:
+			return typedExpr{model.NewLiteral("NULL"), typeNull}, nil
+		case string:
+			return typedExpr{stringLiteral(value), typeKeyword}, nil
+		case bool:
+			return typedExpr{model.NewLiteral(strconv.FormatBool(value)), typeBoolean}, nil
+		case int64:
+			if value == int64(int32(value)) {
+				return typedExpr{model.NewLiteral(value), typeInteger}, nil
+			}
+			return typedExpr{model.NewLiteral(value), typeLong}, nil
+		case float64:
+			return typedExpr{model.NewLiteral(strconv.FormatFloat(value, 'f', -1, 64)), typeDouble}, nil
+		}
+		return typedExpr{}, fmt.Errorf("unsupported literal %v", n.value)
+
+	case fieldNode:
+		name := t.fieldName(n.name)
+		if withAliases {
+			if aliased, ok := t.aliases[name]; ok {
+				return typedExpr{model.NewAliasedExpr(aliased.expr, name).AliasRef(), aliased.typ}, nil
+			}
+		}
+		field, ok := t.schema.ResolveField(name)
+		if !ok {
+			return typedExpr{}, fmt.Errorf("unknown column [%s]", name)
+		}
+		return typedExpr{model.NewColumnRef(field.PropertyName.AsString()), fieldType(field)}, nil
+
+	case starNode:
+		return typedExpr{}, fmt.Errorf("* can only be selected or counted")
+
+	case unaryNode:
+		arg, err := t.lower(n.arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if n.op == "NOT" {
+			return typedExpr{model.NewPrefixExpr("NOT", []model.Expr{arg.expr}), typeBoolean}, nil
+		}
+		return typedExpr{model.NewFunction("negate", arg.expr), arg.typ}, nil
+
+	case binaryNode:
+		return t.lowerBinary(n, withAliases)
+
+	case isNullNode:
+		arg, err := t.lower(n.arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		null := "NULL"
+		if n.not {
+			null = "NOT NULL"
+		}
+		return typedExpr{model.NewInfixExpr(arg.expr, "IS", model.NewLiteral(null)), typeBoolean}, nil
+
+	case betweenNode:
+		arg, err := t.lower(n.arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		from, err := t.lowerComparedTo(n.from, arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		to, err := t.lowerComparedTo(n.to, arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		var between model.Expr = model.And([]model.Expr{
+			model.NewInfixExpr(arg.expr, ">=", from.expr),
+			model.NewInfixExpr(arg.expr, "<=", to.expr),
+		})
+		if n.not {
+			between = model.NewPrefixExpr("NOT", []model.Expr{between})
+		}
+		return typedExpr{between, typeBoolean}, nil
+
+	case inNode:
+		arg, err := t.lower(n.arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		values := make([]model.Expr, 0, len(n.values))
+		for _, value := range n.values {
+			lowered, err := t.lowerComparedTo(value, arg, withAliases)
+			if err != nil {
+				return typedExpr{}, err
+			}
+			values = append(values, lowered.expr)
+		}
+		var in model.Expr = model.NewInfixExpr(arg.expr, "IN", model.NewFunction("tuple", values...))
+		if n.not {
+			in = model.NewPrefixExpr("NOT", []model.Expr{in})
+		}
+		return typedExpr{in, typeBoolean}, nil
+
+	case caseNode:
+		var args []model.Expr
+		typ := typeNull
+		for i := range n.conditions {
+			condition, err := t.lower(n.conditions[i], withAliases)
+			if err != nil {
+				return typedExpr{}, err
+			}
+			result, err := t.lower(n.results[i], withAliases)
+			if err != nil {
+				return typedExpr{}, err
+			}
+			args = append(args, condition.expr, result.expr)
+			typ = commonType(typ, result.typ)
+		}
+		otherwise := typedExpr{model.NewLiteral("NULL"), typeNull}
+		if n.otherwise != nil {
+			var err error
+			if otherwise, err = t.lower(n.otherwise, withAliases); err != nil {
+				return typedExpr{}, err
+			}
+		}
+		args = append(args, otherwise.expr)
+		return typedExpr{model.NewFunction("multiIf", args...), commonType(typ, otherwise.typ)}, nil
+
+	case castNode:
+		arg, err := t.lower(n.arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		cast, ok := casts[n.typeName]
+		if !ok {
+			return typedExpr{}, fmt.Errorf("unsupported type in cast: %s", n.typeName)
+		}
+		return typedExpr{model.NewFunction(cast.function, arg.expr), cast.typ}, nil
+
+	case functionNode:
+		return t.lowerFunction(n, withAliases)
+	}
+	return typedExpr{}, fmt.Errorf("unsupported expression %T", n)
+}
+
+var casts = map[string]struct{ function, typ string }{
+	"INT":       {"toInt32OrNull", typeInteger},
+	"INTEGER":   {"toInt32OrNull", typeInteger},
+	"LONG":      {"toInt64OrNull", typeLong},
+	"BIGINT":    {"toInt64OrNull", typeLong},
+	"DOUBLE":    {"toFloat64OrNull", typeDouble},
+	"FLOAT":     {"toFloat64OrNull", typeDouble},
+	"REAL":      {"toFloat64OrNull", typeDouble},
+	"KEYWORD":   {"toString", typeKeyword},
+	"TEXT":      {"toString", typeKeyword},
+	"VARCHAR":   {"toString", typeKeyword},
+	"BOOLEAN":   {"toBool", typeBoolean},
+	"DATETIME":  {"toDateTime", typeDatetime},
+	"TIMESTAMP": {"toDateTime", typeDatetime},
+	"DATE":      {"toDate", typeDatetime},
+}
+
+// lowerComparedTo translates an expression compared to `other`. Strings compared to dates are parsed as dates.
+func (t *translator) lowerComparedTo(n node, other typedExpr, withAliases bool) (typedExpr, error) {
+	lowered, err := t.lower(n, withAliases)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	if literal, ok := n.(literalNode); ok && other.typ == typeDatetime {
+		if _, isString := literal.value.(string); isString {
+			return typedExpr{model.NewFunction("parseDateTime64BestEffort", lowered.expr), typeDatetime}, nil
+		}
+	}
+	return lowered, nil
+}
+
+func (t *translator) lowerBinary(n binaryNode, withAliases bool) (typedExpr, error) {
+	left, err := t.lower(n.left, withAliases)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	right, err := t.lowerComparedTo(n.right, left, withAliases)
+	if err != nil {
+		return typedExpr{}, err
+	}
+	if _, ok := n.left.(literalNode); ok && right.typ == typeDatetime {
+		if left, err = t.lowerComparedTo(n.left, right, withAliases); err != nil {
+			return typedExpr{}, err
+		}
+	}
+
+	switch n.op {
+	case "AND":
+		return typedExpr{model.And([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	case "OR":
+		return typedExpr{model.Or([]model.Expr{left.expr, right.expr}), typeBoolean}, nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return typedExpr{model.NewInfixExpr(left.expr, n.op, right.expr), typeBoolean}, nil
+	case "LIKE":
+		return typedExpr{model.NewInfixExpr(left.expr, "LIKE", right.expr), typeBoolean}, nil
+	case "RLIKE":
+		return typedExpr{model.NewFunction("match", left.expr, right.expr), typeBoolean}, nil
+	case "+", "-", "*", "%":
+		return typedExpr{model.NewInfixExpr(left.expr, n.op, right.expr), commonType(left.typ, right.typ)}, nil
+	case "/":
+		// Elasticsearch SQL divides integers as integers
+		if commonType(left.typ, right.typ) == typeDouble {
+			return typedExpr{model.NewInfixExpr(left.expr, "/", right.expr), typeDouble}, nil
+		}
+		return typedExpr{model.NewFunction("intDiv", left.expr, right.expr), commonType(left.typ, right.typ)}, nil
+	}
+	return typedExpr{}, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+// commonType returns the type of an expression combining values of both types, e.g. long + double is double
+func commonType(a, b string) string {
+	switch {
+	case a == typeNull:
+		return b
+	case b == typeNull || a == b:
+		return a
+	case isNumeric(a) && isNumeric(b):
+		if a == typeDouble || b == typeDouble {
+			return typeDouble
+		}
+		return typeLong
+	case isString(a) && isString(b):
+		return typeKeyword
+	}
+	return a
+}
+
+type function struct {
+	name      string // ClickHouse function
+	minArgs   int
+	maxArgs   int                        // -1 for any number
+	typ       func(args []string) string // result type, given types of arguments
+	aggregate bool
+}
+
+func fixedType(typ string) func([]string) string {
+	return func([]string) string { return typ }
+}
+
+func firstArgType(args []string) string {
+	if len(args) == 0 {
+		return typeNull
+	}
+	return args[0]
+}
+
+func commonArgsType(args []string) string {
+	typ := typeNull
+	for _, arg := range args {
+		typ = commonType(typ, arg)
+	}
+	return typ
+}
+
+func sumType(args []string) string {
+	if firstArgType(args) == typeDouble {
+		return typeDouble
+	}
+	return typeLong
+}
+
+// functions maps Elasticsearch SQL functions to ClickHouse ones. COUNT, HISTOGRAM and the current time functions are handled separately.
+var functions = map[string]function{
+	// aggregates
+	"SUM":         {name: "sum", minArgs: 1, maxArgs: 1, typ: sumType, aggregate: true},
+	"AVG":         {name: "avg", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble), aggregate: true},
+	"MIN":         {name: "min", minArgs: 1, maxArgs: 1, typ: firstArgType, aggregate: true},
+	"MAX":         {name: "max", minArgs: 1, maxArgs: 1, typ: firstArgType, aggregate: true},
+	"STDDEV_POP":  {name: "stddevPop", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble), aggregate: true},
+	"STDDEV_SAMP": {name: "stddevSamp", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble), aggregate: true},
+	"VAR_POP":     {name: "varPop", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble), aggregate: true},
+	"VAR_SAMP":    {name: "varSamp", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble), aggregate: true},
+
+	// math
+	"ABS":      {name: "abs", minArgs: 1, maxArgs: 1, typ: firstArgType},
+	"CEIL":     {name: "ceil", minArgs: 1, maxArgs: 1, typ: firstArgType},
+	"CEILING":  {name: "ceil", minArgs: 1, maxArgs: 1, typ: firstArgType},
+	"FLOOR":    {name: "floor", minArgs: 1, maxArgs: 1, typ: firstArgType},
+	"ROUND":    {name: "round", minArgs: 1, maxArgs: 2, typ: firstArgType},
+	"TRUNCATE": {name: "trunc", minArgs: 1, maxArgs: 2, typ: firstArgType},
+	"SQRT":     {name: "sqrt", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble)},
+	"POWER":    {name: "pow", minArgs: 2, maxArgs: 2, typ: fixedType(typeDouble)},
+	"EXP":      {name: "exp", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble)},
+	"LOG":      {name: "log", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble)},
+	"LOG10":    {name: "log10", minArgs: 1, maxArgs: 1, typ: fixedType(typeDouble)},
+	"SIGN":     {name: "sign", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"MOD":      {name: "modulo", minArgs: 2, maxArgs: 2, typ: commonArgsType},
+
+	// strings
+	"LENGTH":           {name: "lengthUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"CHAR_LENGTH":      {name: "lengthUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"CHARACTER_LENGTH": {name: "lengthUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"LOWER":            {name: "lowerUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"LCASE":            {name: "lowerUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"UPPER":            {name: "upperUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"UCASE":            {name: "upperUTF8", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"CONCAT":           {name: "concat", minArgs: 2, maxArgs: 2, typ: fixedType(typeKeyword)},
+	"SUBSTRING":        {name: "substringUTF8", minArgs: 2, maxArgs: 3, typ: fixedType(typeKeyword)},
+	"LEFT":             {name: "leftUTF8", minArgs: 2, maxArgs: 2, typ: fixedType(typeKeyword)},
+	"RIGHT":            {name: "rightUTF8", minArgs: 2, maxArgs: 2, typ: fixedType(typeKeyword)},
+	"LTRIM":            {name: "trimLeft", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"RTRIM":            {name: "trimRight", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"TRIM":             {name: "trimBoth", minArgs: 1, maxArgs: 1, typ: fixedType(typeKeyword)},
+	"REPLACE":          {name: "replaceAll", minArgs: 3, maxArgs: 3, typ: fixedType(typeKeyword)},
+	"STARTS_WITH":      {name: "startsWith", minArgs: 2, maxArgs: 2, typ: fixedType(typeBoolean)},
+
+	// dates
+	"YEAR":          {name: "toYear", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"MONTH":         {name: "toMonth", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"MONTH_OF_YEAR": {name: "toMonth", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"DAY":           {name: "toDayOfMonth", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"DAY_OF_MONTH":  {name: "toDayOfMonth", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"DAY_OF_YEAR":   {name: "toDayOfYear", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"HOUR":          {name: "toHour", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"HOUR_OF_DAY":   {name: "toHour", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"MINUTE":        {name: "toMinute", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"SECOND":        {name: "toSecond", minArgs: 1, maxArgs: 1, typ: fixedType(typeInteger)},
+	"DATE_TRUNC":    {name: "dateTrunc", minArgs: 2, maxArgs: 2, typ: fixedType(typeDatetime)},
+
+	// conditionals
+	"COALESCE": {name: "coalesce", minArgs: 1, maxArgs: -1, typ: commonArgsType},
+	"IFNULL":   {name: "ifNull", minArgs: 2, maxArgs: 2, typ: commonArgsType},
+	"ISNULL":   {name: "ifNull", minArgs: 2, maxArgs: 2, typ: commonArgsType},
+	"NULLIF":   {name: "nullIf", minArgs: 2, maxArgs: 2, typ: firstArgType},
+	"GREATEST": {name: "greatest", minArgs: 1, maxArgs: -1, typ: commonArgsType},
+	"LEAST":    {name: "least", minArgs: 1, maxArgs: -1, typ: commonArgsType},
+}
+
+func (t *translator) lowerFunction(n functionNode, withAliases bool) (typedExpr, error) {
+	switch n.name {
+	case "COUNT":
+		t.aggregated = true
+		if len(n.args) != 1 {
+			return typedExpr{}, fmt.Errorf("COUNT expects exactly one argument")
+		}
+		if _, ok := n.args[0].(starNode); ok {
+			return typedExpr{model.NewCountFunc(), typeLong}, nil
+		}
+		arg, err := t.lower(n.args[0], withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if n.distinct {
+			return typedExpr{model.NewCountFunc(model.NewDistinctExpr(arg.expr)), typeLong}, nil
+		}
+		return typedExpr{model.NewCountFunc(arg.expr), typeLong}, nil
+	case "CURRENT_TIMESTAMP", "NOW":
+		return typedExpr{model.NewFunction("now64"), typeDatetime}, nil
+	case "CURRENT_DATE", "CURDATE", "TODAY":
+		return typedExpr{model.NewFunction("today"), typeDatetime}, nil
+	case "CURRENT_TIME", "CURTIME":
+		return typedExpr{model.NewFunction("now"), typeDatetime}, nil
+	case "IIF", "IF":
+		if len(n.args) != 2 && len(n.args) != 3 {
+			return typedExpr{}, fmt.Errorf("%s expects 2 or 3 arguments", n.name)
+		}
+		args := n.args
+		if len(args) == 2 {
+			args = append(args, literalNode{})
+		}
+		return t.lower(caseNode{conditions: args[:1], results: args[1:2], otherwise: args[2]}, withAliases)
+	case "HISTOGRAM":
+		// numeric histogram only, date histograms use INTERVAL literals which we don't support
+		if len(n.args) != 2 {
+			return typedExpr{}, fmt.Errorf("HISTOGRAM expects 2 arguments")
+		}
+		arg, err := t.lower(n.args[0], withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		interval, err := t.lower(n.args[1], withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if !isNumeric(arg.typ) || !isNumeric(interval.typ) {
+			return typedExpr{}, fmt.Errorf("HISTOGRAM is supported only for numeric fields and intervals")
+		}
+		bucket := model.NewInfixExpr(model.NewFunction("floor", model.NewInfixExpr(arg.expr, "/", interval.expr)), "*", interval.expr)
+		return typedExpr{bucket, commonType(arg.typ, interval.typ)}, nil
+	}
+
+	f, ok := functions[n.name]
+	if !ok {
+		return typedExpr{}, fmt.Errorf("unknown function [%s]", n.name)
+	}
+	if len(n.args) < f.minArgs || (f.maxArgs >= 0 && len(n.args) > f.maxArgs) {
+		return typedExpr{}, fmt.Errorf("function [%s] called with a wrong number of arguments: %d", n.name, len(n.args))
+	}
+	if f.aggregate {
+		t.aggregated = true
+	}
+	if n.distinct && !f.aggregate {
+		return typedExpr{}, fmt.Errorf("DISTINCT is allowed only in aggregate functions, not in [%s]", n.name)
+	}
+	args := make([]model.Expr, 0, len(n.args))
+	types := make([]string, 0, len(n.args))
+	for _, arg := range n.args {
+		lowered, err := t.lower(arg, withAliases)
+		if err != nil {
+			return typedExpr{}, err
+		}
+		if n.distinct {
+			lowered.expr = model.NewDistinctExpr(lowered.expr)
+		}
+		args = append(args, lowered.expr)
+		types = append(types, lowered.typ)
+	}
+	if n.name == "DATE_TRUNC" {
+		// Elasticsearch SQL accepts plural units, e.g. 'days', ClickHouse doesn't
+		if unit, ok := n.args[0].(literalNode); ok {
+			if unitName, ok := unit.value.(string); ok {
+				args[0] = stringLiteral(strings.TrimSuffix(strings.ToLower(unitName), "s"))
+			}
+		}
+	}
+	return typedExpr{model.NewFunction(f.name, args...), f.typ(types)}, nil
+}
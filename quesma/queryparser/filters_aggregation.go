@@ -3,6 +3,7 @@
 package queryparser
 
 import (
+	"fmt"
 	"quesma/logger"
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
@@ -32,8 +33,13 @@ func (cw *ClickhouseQueryTranslator) parseFilters(queryMap QueryMap) (success bo
 		return
 	}
 
-	filters := make([]bucket_aggregations.Filter, 0, len(nestedMap))
-	for name, filterRaw := range nestedMap {
+	return true, bucket_aggregations.NewFilters(cw.Ctx, cw.parseNamedFilters(nestedMap))
+}
+
+// parseNamedFilters parses a map: filter's name -> query, e.g. filters of filters or adjacency_matrix aggregation
+func (cw *ClickhouseQueryTranslator) parseNamedFilters(filtersMap QueryMap) []bucket_aggregations.Filter {
+	filters := make([]bucket_aggregations.Filter, 0, len(filtersMap))
+	for name, filterRaw := range filtersMap {
 		filterMap, ok := filterRaw.(QueryMap)
 		if !ok {
 			logger.WarnWithCtx(cw.Ctx).Msgf("filter is not a map, but %T, value: %v. Skipping.", filterRaw, filterRaw)
@@ -46,5 +52,19 @@ func (cw *ClickhouseQueryTranslator) parseFilters(queryMap QueryMap) (success bo
 		}
 		filters = append(filters, bucket_aggregations.NewFilter(name, filter))
 	}
-	return true, bucket_aggregations.NewFilters(cw.Ctx, filters)
+	return filters
+}
+
+func (cw *ClickhouseQueryTranslator) parseAdjacencyMatrix(adjacencyMatrix QueryMap) (bucket_aggregations.AdjacencyMatrix, error) {
+	filtersMap, ok := adjacencyMatrix["filters"].(QueryMap)
+	if !ok {
+		return bucket_aggregations.AdjacencyMatrix{}, fmt.Errorf("filters in adjacency_matrix is not a map, but %T, value: %v",
+			adjacencyMatrix["filters"], adjacencyMatrix["filters"])
+	}
+	if len(filtersMap) > bucket_aggregations.AdjacencyMatrixMaxFilters {
+		return bucket_aggregations.AdjacencyMatrix{}, fmt.Errorf("number of filters in adjacency_matrix is too large: %d, max: %d",
+			len(filtersMap), bucket_aggregations.AdjacencyMatrixMaxFilters)
+	}
+	separator := cw.parseStringField(adjacencyMatrix, "separator", bucket_aggregations.AdjacencyMatrixDefaultSeparator)
+	return bucket_aggregations.NewAdjacencyMatrix(cw.Ctx, cw.parseNamedFilters(filtersMap), separator), nil
 }
@@ -0,0 +1,237 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"fmt"
+	"math"
+	"quesma/model"
+	"quesma/util"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	earthEquatorInMeters       = 2 * math.Pi * 6378137.0
+	earthPolarDistanceInMeters = math.Pi * 6356752.314245
+)
+
+// distanceUnitsInMeters are all distance units Elastic accepts
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/api-conventions.html#distance-units
+var distanceUnitsInMeters = map[string]float64{
+	"mi": 1609.344, "miles": 1609.344,
+	"yd": 0.9144, "yards": 0.9144,
+	"ft": 0.3048, "feet": 0.3048,
+	"in": 0.0254, "inch": 0.0254,
+	"km": 1000, "kilometers": 1000,
+	"m": 1, "meters": 1,
+	"cm": 0.01, "centimeters": 0.01,
+	"mm": 0.001, "millimeters": 0.001,
+	"NM": 1852, "nmi": 1852, "nauticalmiles": 1852,
+}
+
+var distanceRegex = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)\s*([a-zA-Z]*)\s*$`)
+
+// parseDistance parses Elastic's distance, e.g. "12km" or "200", and returns it in meters.
+// If no unit is specified, defaultUnit is used.
+func parseDistance(distance string, defaultUnit string) (meters float64, err error) {
+	matches := distanceRegex.FindStringSubmatch(distance)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid distance: %s", distance)
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid distance: %s, err: %v", distance, err)
+	}
+	unit := matches[2]
+	if unit == "" {
+		unit = defaultUnit
+	}
+	unitInMeters, err := distanceUnitInMeters(unit)
+	if err != nil {
+		return 0, err
+	}
+	return value * unitInMeters, nil
+}
+
+func distanceUnitInMeters(unit string) (float64, error) {
+	if unitInMeters, ok := distanceUnitsInMeters[unit]; ok {
+		return unitInMeters, nil
+	}
+	if unitInMeters, ok := distanceUnitsInMeters[strings.ToLower(unit)]; ok {
+		return unitInMeters, nil
+	}
+	return 0, fmt.Errorf("unknown distance unit: %s", unit)
+}
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// decodeGeohash returns center of the geohash's cell
+func decodeGeohash(geohash string) (lat, lon float64, err error) {
+	latInterval, lonInterval := [2]float64{-90, 90}, [2]float64{-180, 180}
+	isLonBit := true
+	for _, char := range strings.ToLower(geohash) {
+		value := strings.IndexRune(geohashBase32, char)
+		if value == -1 {
+			return 0, 0, fmt.Errorf("invalid character '%c' in geohash: %s", char, geohash)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			interval := &latInterval
+			if isLonBit {
+				interval = &lonInterval
+			}
+			mid := (interval[0] + interval[1]) / 2
+			if value&(1<<bit) != 0 {
+				interval[0] = mid
+			} else {
+				interval[1] = mid
+			}
+			isLonBit = !isLonBit
+		}
+	}
+	return (latInterval[0] + latInterval[1]) / 2, (lonInterval[0] + lonInterval[1]) / 2, nil
+}
+
+var wktPointRegex = regexp.MustCompile(`(?i)^\s*POINT\s*\(\s*(\S+)\s+(\S+)\s*\)\s*$`)
+
+// parseGeoPoint parses a geo point in any of the formats Elastic accepts:
+// {"lat": 41.12, "lon": -71.34}, GeoJSON {"type": "Point", "coordinates": [-71.34, 41.12]}, [-71.34, 41.12],
+// "41.12,-71.34", "POINT (-71.34 41.12)", or a geohash, e.g. "drm3btev3e86".
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/geo-point.html
+func parseGeoPoint(pointRaw any) (lat, lon float64, err error) {
+	toFloat := func(valueRaw any) (float64, error) {
+		switch value := valueRaw.(type) {
+		case float64:
+			return value, nil
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(value), 64)
+		default:
+			return 0, fmt.Errorf("coordinate is not a number, but %T, value: %v", valueRaw, valueRaw)
+		}
+	}
+	fromLatLon := func(latRaw, lonRaw any) (float64, float64, error) {
+		lat, errLat := toFloat(latRaw)
+		lon, errLon := toFloat(lonRaw)
+		if errLat != nil || errLon != nil {
+			return 0, 0, fmt.Errorf("invalid geo point: %v", pointRaw)
+		}
+		return lat, lon, nil
+	}
+
+	switch point := pointRaw.(type) {
+	case QueryMap:
+		if coordinates, ok := point["coordinates"].([]any); ok {
+			return parseGeoPoint(coordinates)
+		}
+		latRaw, latExists := point["lat"]
+		lonRaw, lonExists := point["lon"]
+		if !latExists || !lonExists {
+			return 0, 0, fmt.Errorf("geo point needs both lat and lon: %v", point)
+		}
+		return fromLatLon(latRaw, lonRaw)
+	case []any:
+		if len(point) < 2 || len(point) > 3 {
+			return 0, 0, fmt.Errorf("geo point as an array needs to have 2 or 3 elements: %v", point)
+		}
+		return fromLatLon(point[1], point[0]) // [lon, lat], like in GeoJSON
+	case string:
+		if matches := wktPointRegex.FindStringSubmatch(point); matches != nil {
+			return fromLatLon(matches[2], matches[1])
+		}
+		if latRaw, lonRaw, found := strings.Cut(point, ","); found {
+			return fromLatLon(latRaw, lonRaw)
+		}
+		return decodeGeohash(point)
+	default:
+		return 0, 0, fmt.Errorf("unknown format of geo point: %v (type %T)", pointRaw, pointRaw)
+	}
+}
+
+// geoLatLon returns expressions for latitude and longitude of a geo_point field.
+// They're resolved to proper columns later, in schema transformations (see applyGeoTransformations).
+func geoLatLon(field model.Expr) (lat, lon model.Expr, err error) {
+	col, ok := field.(model.ColumnRef)
+	if !ok {
+		return nil, nil, fmt.Errorf("geo field is not a column: %s", model.AsString(field))
+	}
+	// TODO this is internalPropertyName and should be taken from schema
+	colName := util.FieldToColumnEncoder(col.ColumnName)
+	return model.NewGeoLat(colName), model.NewGeoLon(colName), nil
+}
+
+// geoDistanceExpr returns SQL expression for distance (in meters) between points from 'field' and origin.
+// For 'arc' distance type (default) we use geoDistance (WGS-84 ellipsoid), for 'plane' faster, but less accurate greatCircleDistance.
+func geoDistanceExpr(field model.Expr, originLat, originLon float64, distanceType string) (model.Expr, error) {
+	lat, lon, err := geoLatLon(field)
+	if err != nil {
+		return nil, err
+	}
+	var function string
+	switch strings.ToLower(distanceType) {
+	case "", "arc":
+		function = "geoDistance"
+	case "plane":
+		function = "greatCircleDistance"
+	default:
+		return nil, fmt.Errorf("unknown distance_type: %s", distanceType)
+	}
+	return model.NewFunction(function, model.NewFunction("toFloat64", lon), model.NewFunction("toFloat64", lat),
+		geoCoordinateLiteral(originLon), geoCoordinateLiteral(originLat)), nil
+}
+
+func geoCoordinateLiteral(coordinate float64) model.Expr {
+	return model.NewLiteral(strconv.FormatFloat(coordinate, 'f', -1, 64))
+}
+
+// geoPolygonLiteral returns a polygon in ClickHouse's format: [(lon1, lat1), (lon2, lat2), ...]
+func geoPolygonLiteral(points []any) (model.Expr, error) {
+	if len(points) < 3 {
+		return nil, fmt.Errorf("polygon needs at least 3 points, got: %v", points)
+	}
+	var polygon strings.Builder
+	polygon.WriteString("[")
+	for i, pointRaw := range points {
+		lat, lon, err := parseGeoPoint(pointRaw)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			polygon.WriteString(", ")
+		}
+		polygon.WriteString(fmt.Sprintf("(%s, %s)", strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64)))
+	}
+	polygon.WriteString("]")
+	return model.NewLiteral(polygon.String()), nil
+}
+
+// geoPolygonWithHoles parses GeoJSON polygon's coordinates: first ring is the outer one, next ones are holes.
+func geoPolygonWithHoles(rings []any) ([]model.Expr, error) {
+	if len(rings) == 0 {
+		return nil, fmt.Errorf("polygon needs at least one ring")
+	}
+	polygon := make([]model.Expr, 0, len(rings))
+	for _, ringRaw := range rings {
+		ring, ok := ringRaw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("polygon's ring is not an array, but %T, value: %v", ringRaw, ringRaw)
+		}
+		ringLiteral, err := geoPolygonLiteral(ring)
+		if err != nil {
+			return nil, err
+		}
+		polygon = append(polygon, ringLiteral)
+	}
+	return polygon, nil
+}
+
+// geoPointInPolygon returns a condition checking if point from 'field' lies within the polygon.
+// polygon[0] is the outer ring, polygon[1:] (optional) are holes, just like in ClickHouse's pointInPolygon.
+func geoPointInPolygon(field model.Expr, polygon []model.Expr) (model.Expr, error) {
+	lat, lon, err := geoLatLon(field)
+	if err != nil {
+		return nil, err
+	}
+	point := model.NewFunction("tuple", model.NewFunction("toFloat64", lon), model.NewFunction("toFloat64", lat))
+	return model.NewFunction("pointInPolygon", append([]model.Expr{point}, polygon...)...), nil
+}
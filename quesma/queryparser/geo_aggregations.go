@@ -0,0 +1,145 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"fmt"
+	"math"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/model/bucket_aggregations"
+	"strconv"
+)
+
+// geoHashPrecisionForDistance returns the smallest geohash precision (length), for which cells are not larger than given distance.
+// It's a port of Elastic's GeoUtils.geoHashLevelsForPrecision.
+func geoHashPrecisionForDistance(meters float64) int {
+	if meters <= 0 {
+		return bucket_aggregations.GeoHashGridMaxPrecision
+	}
+	const ratio = 1 + earthPolarDistanceInMeters/earthEquatorInMeters // cell ratio
+	width := math.Sqrt(meters * meters / (ratio * ratio))             // convert to cell width
+	part := math.Ceil(earthEquatorInMeters / width)
+	if part <= 1 {
+		return 1
+	}
+	bits := int(math.Ceil(math.Log2(part)))
+	full := bits / 5 // number of 5 bit subdivisions
+	left := bits - full*5
+	even, odd := full, full
+	if left > 0 {
+		even++
+	}
+	if left > 3 {
+		odd++
+	}
+	return min(even+odd, bucket_aggregations.GeoHashGridMaxPrecision)
+}
+
+// parseGeoPrecision parses 'precision' of a grid aggregation. For geohash_grid it can also be a distance, e.g. "1km".
+func (cw *ClickhouseQueryTranslator) parseGeoPrecision(params QueryMap, aggregationType string,
+	defaultPrecision, minPrecision, maxPrecision int, acceptsDistance bool) (int, error) {
+	precisionRaw, exists := params["precision"]
+	if !exists {
+		return defaultPrecision, nil
+	}
+	var precision int
+	switch precisionTyped := precisionRaw.(type) {
+	case float64:
+		precision = int(precisionTyped)
+	case string:
+		if asInt, err := strconv.Atoi(precisionTyped); err == nil {
+			precision = asInt
+		} else if !acceptsDistance {
+			return 0, fmt.Errorf("precision in %s must be an integer, got: %s", aggregationType, precisionTyped)
+		} else {
+			meters, err := parseDistance(precisionTyped, "m")
+			if err != nil {
+				return 0, err
+			}
+			precision = geoHashPrecisionForDistance(meters)
+		}
+	default:
+		return 0, fmt.Errorf("precision in %s is not a number, but %T, value: %v", aggregationType, precisionRaw, precisionRaw)
+	}
+	if precision < minPrecision || precision > maxPrecision {
+		return 0, fmt.Errorf("precision in %s must be in [%d, %d], got: %d", aggregationType, minPrecision, maxPrecision, precision)
+	}
+	return precision, nil
+}
+
+// parseGeoGrid parses geohash_grid or geohex_grid aggregation and sets everything needed in the tree node.
+// Buckets are sorted by doc_count (descending), just like in Elastic.
+func (cw *ClickhouseQueryTranslator) parseGeoGrid(aggregation *pancakeAggregationTreeNode, params QueryMap, aggregationType string) error {
+	field := cw.parseFieldField(params, aggregationType)
+	if field == nil {
+		return fmt.Errorf("no field in %s aggregation: %v", aggregationType, params)
+	}
+	lat, lon, err := geoLatLon(field)
+	if err != nil {
+		return err
+	}
+	if _, exists := params["bounds"]; exists {
+		logger.WarnWithCtx(cw.Ctx).Msgf("bounds in %s aggregation are not supported, ignoring them", aggregationType)
+	}
+
+	var key model.Expr
+	switch aggregationType {
+	case "geohash_grid":
+		precision, err := cw.parseGeoPrecision(params, aggregationType,
+			bucket_aggregations.GeoHashGridDefaultPrecision, 1, bucket_aggregations.GeoHashGridMaxPrecision, true)
+		if err != nil {
+			return err
+		}
+		geoHashGrid := bucket_aggregations.NewGeoHashGrid(cw.Ctx, precision)
+		aggregation.queryType = geoHashGrid
+		key = geoHashGrid.SqlKey(lat, lon)
+	case "geohex_grid":
+		precision, err := cw.parseGeoPrecision(params, aggregationType,
+			bucket_aggregations.GeoHexGridDefaultPrecision, 0, bucket_aggregations.GeoHexGridMaxPrecision, false)
+		if err != nil {
+			return err
+		}
+		geoHexGrid := bucket_aggregations.NewGeoHexGrid(cw.Ctx, precision)
+		aggregation.queryType = geoHexGrid
+		key = geoHexGrid.SqlKey(lat, lon)
+	default:
+		return fmt.Errorf("unknown geo grid aggregation: %s", aggregationType)
+	}
+
+	aggregation.selectedColumns = append(aggregation.selectedColumns, key)
+	aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExpr(model.NewCountFunc(), model.DescOrder),
+		model.NewOrderByExpr(key, model.AscOrder))
+	aggregation.limit = cw.parseSize(params, bucket_aggregations.GeoGridDefaultSize)
+	aggregation.filterOutEmptyKeyBucket = true
+	return nil
+}
+
+func (cw *ClickhouseQueryTranslator) parseGeoDistanceAggregation(geoDistance QueryMap) (bucket_aggregations.GeoDistance, error) {
+	field := cw.parseFieldField(geoDistance, "geo_distance")
+	if field == nil {
+		return bucket_aggregations.GeoDistance{}, fmt.Errorf("no field in geo_distance aggregation: %v", geoDistance)
+	}
+	originRaw, exists := geoDistance["origin"]
+	if !exists {
+		return bucket_aggregations.GeoDistance{}, fmt.Errorf("no origin in geo_distance aggregation: %v", geoDistance)
+	}
+	originLat, originLon, err := parseGeoPoint(originRaw)
+	if err != nil {
+		return bucket_aggregations.GeoDistance{}, err
+	}
+	distance, err := geoDistanceExpr(field, originLat, originLon, cw.parseStringField(geoDistance, "distance_type", "arc"))
+	if err != nil {
+		return bucket_aggregations.GeoDistance{}, err
+	}
+	unitInMeters, err := distanceUnitInMeters(cw.parseStringField(geoDistance, "unit", "m"))
+	if err != nil {
+		return bucket_aggregations.GeoDistance{}, err
+	}
+	if unitInMeters != 1 {
+		distance = model.NewInfixExpr(distance, "/", model.NewLiteral(unitInMeters))
+	}
+	intervals := cw.parseRangeIntervals(geoDistance)
+	keyed := cw.parseBoolField(geoDistance, "keyed", false)
+	return bucket_aggregations.NewGeoDistance(cw.Ctx, distance, intervals, keyed), nil
+}
@@ -0,0 +1,88 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseDistance(t *testing.T) {
+	tests := []struct {
+		distance       string
+		expectedMeters float64
+		expectedErr    bool
+	}{
+		{"12km", 12000, false},
+		{"200", 200, false},
+		{"1.5 mi", 2414.016, false},
+		{"10NM", 18520, false},
+		{"3 Kilometers", 3000, false},
+		{"km", 0, true},
+		{"5 parsecs", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.distance, func(t *testing.T) {
+			meters, err := parseDistance(tt.distance, "m")
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedMeters, meters, 1e-9)
+		})
+	}
+}
+
+func Test_geoHashPrecisionForDistance(t *testing.T) {
+	tests := []struct {
+		meters            float64
+		expectedPrecision int
+	}{
+		{10_000_000, 1},
+		{5_000_000, 2},
+		{5000, 6},
+		{1000, 7},
+		{100, 8},
+		{1, 11},
+		{0.01, 12},
+		{0, 12},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expectedPrecision, geoHashPrecisionForDistance(tt.meters), "distance: %f", tt.meters)
+	}
+}
+
+func Test_parseGeoPoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		point       any
+		expectedLat float64
+		expectedLon float64
+		expectedErr bool
+	}{
+		{"object", QueryMap{"lat": 41.12, "lon": -71.34}, 41.12, -71.34, false},
+		{"object with strings", QueryMap{"lat": "41.12", "lon": "-71.34"}, 41.12, -71.34, false},
+		{"GeoJSON", QueryMap{"type": "Point", "coordinates": []any{-71.34, 41.12}}, 41.12, -71.34, false},
+		{"array", []any{-71.34, 41.12}, 41.12, -71.34, false},
+		{"string", "41.12,-71.34", 41.12, -71.34, false},
+		{"WKT", "POINT (-71.34 41.12)", 41.12, -71.34, false},
+		{"geohash", "drm3btev3e86", 41.12, -71.34, false},
+		{"object without lon", QueryMap{"lat": 41.12}, 0, 0, true},
+		{"array too short", []any{-71.34}, 0, 0, true},
+		{"invalid geohash", "drm3a", 0, 0, true},
+		{"number", 41.12, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, err := parseGeoPoint(tt.point)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedLat, lat, 1e-5)
+			assert.InDelta(t, tt.expectedLon, lon, 1e-5)
+		})
+	}
+}
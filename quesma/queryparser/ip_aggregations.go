@@ -0,0 +1,73 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"fmt"
+	"quesma/model"
+	"quesma/model/bucket_aggregations"
+)
+
+func (cw *ClickhouseQueryTranslator) parseIpRangeAggregation(ipRange QueryMap) (bucket_aggregations.IpRange, error) {
+	field := cw.parseFieldField(ipRange, "ip_range")
+	if field == nil {
+		return bucket_aggregations.IpRange{}, fmt.Errorf("no field in ip_range aggregation: %v", ipRange)
+	}
+	rangesRaw, ok := ipRange["ranges"].([]any)
+	if !ok {
+		return bucket_aggregations.IpRange{}, fmt.Errorf("ranges is not an array, but %T, value: %v", ipRange["ranges"], ipRange["ranges"])
+	}
+	intervals := make([]bucket_aggregations.IpInterval, 0, len(rangesRaw))
+	for _, rangeRaw := range rangesRaw {
+		rangeMap, ok := rangeRaw.(QueryMap)
+		if !ok {
+			return bucket_aggregations.IpRange{}, fmt.Errorf("range is not a map, but %T, value: %v", rangeRaw, rangeRaw)
+		}
+		key := cw.parseStringField(rangeMap, "key", "")
+		if mask := cw.parseStringField(rangeMap, "mask", ""); mask != "" {
+			interval, err := bucket_aggregations.NewIpIntervalFromMask(mask, key)
+			if err != nil {
+				return bucket_aggregations.IpRange{}, fmt.Errorf("invalid mask in ip_range aggregation: %s, err: %v", mask, err)
+			}
+			intervals = append(intervals, interval)
+		} else {
+			from := cw.parseStringField(rangeMap, "from", "")
+			to := cw.parseStringField(rangeMap, "to", "")
+			interval, err := bucket_aggregations.NewIpInterval(from, to, key)
+			if err != nil {
+				return bucket_aggregations.IpRange{}, fmt.Errorf("invalid from/to in ip_range aggregation: %s-%s, err: %v", from, to, err)
+			}
+			intervals = append(intervals, interval)
+		}
+	}
+	keyed := cw.parseBoolField(ipRange, "keyed", false)
+	return bucket_aggregations.NewIpRange(cw.Ctx, field, intervals, keyed), nil
+}
+
+// parseIpPrefix sets everything needed for ip_prefix aggregation in the tree node: its query type, selected column, etc.
+func (cw *ClickhouseQueryTranslator) parseIpPrefix(aggregation *pancakeAggregationTreeNode, ipPrefix QueryMap) error {
+	field := cw.parseFieldField(ipPrefix, "ip_prefix")
+	if field == nil {
+		return fmt.Errorf("no field in ip_prefix aggregation: %v", ipPrefix)
+	}
+	isIpv6 := cw.parseBoolField(ipPrefix, "is_ipv6", false)
+	prefixLength := cw.parseIntField(ipPrefix, "prefix_length", -1)
+	maxPrefixLength := bucket_aggregations.IpPrefixMaxPrefixLengthIpv4
+	if isIpv6 {
+		maxPrefixLength = bucket_aggregations.IpPrefixMaxPrefixLengthIpv6
+	}
+	if prefixLength < 0 || prefixLength > maxPrefixLength {
+		return fmt.Errorf("prefix_length in ip_prefix aggregation must be in [0, %d], got: %v", maxPrefixLength, ipPrefix["prefix_length"])
+	}
+	appendPrefixLength := cw.parseBoolField(ipPrefix, "append_prefix_length", false)
+	minDocCount := cw.parseIntField(ipPrefix, "min_doc_count", bucket_aggregations.DefaultMinDocCount)
+
+	ipPrefixAggr := bucket_aggregations.NewIpPrefix(cw.Ctx, prefixLength, isIpv6, appendPrefixLength, minDocCount)
+	key := ipPrefixAggr.SqlKey(field)
+	aggregation.queryType = ipPrefixAggr
+	aggregation.selectedColumns = append(aggregation.selectedColumns, key)
+	aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExprWithoutOrder(key))
+	aggregation.filterOutEmptyKeyBucket = true
+	aggregation.isKeyed = cw.parseBoolField(ipPrefix, "keyed", false)
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"quesma/model"
+	"quesma/schema"
+	"testing"
+)
+
+func Test_parseIpRangeAggregation(t *testing.T) {
+	cw := ClickhouseQueryTranslator{Ctx: context.Background(), Schema: schema.Schema{}}
+	tests := []struct {
+		name          string
+		rangeMap      QueryMap
+		expectedWhere string // "" <=> error expected
+	}{
+		{"ipv4", QueryMap{"from": "10.0.0.5", "to": "10.0.0.10"},
+			`(toIPv6OrNull("clientip")>=toIPv6('10.0.0.5') AND toIPv6OrNull("clientip")<toIPv6('10.0.0.10'))`},
+		{"ipv6, unbounded", QueryMap{"from": "2001:db8::"}, `toIPv6OrNull("clientip")>=toIPv6('2001:db8::')`},
+		{"mask", QueryMap{"mask": "10.0.0.0/25"}, `isIPAddressInRange("clientip",'10.0.0.0/25')`},
+		{"invalid from", QueryMap{"from": "10.0.0.5') OR 1=1 --"}, ""},
+		{"invalid to", QueryMap{"to": "not an ip"}, ""},
+		{"ipv6 with zone", QueryMap{"from": "fe80::1%eth0'"}, ""},
+		{"invalid mask", QueryMap{"mask": "10.0.0.0/33"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipRange, err := cw.parseIpRangeAggregation(QueryMap{"field": "clientip", "ranges": []any{tt.rangeMap}})
+			if tt.expectedWhere == "" {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			groups := ipRange.CombinatorGroups()
+			assert.Len(t, groups, 1)
+			assert.Equal(t, tt.expectedWhere, model.AsString(groups[0].WhereClause))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"fmt"
+	"quesma/clickhouse"
+	"quesma/kibana"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/quesma/errors"
+)
+
+// parseFrom returns the number of hits to skip ("from" parameter), 0 if it's missing or invalid
+func (cw *ClickhouseQueryTranslator) parseFrom(queryMap QueryMap) int {
+	// we can reuse parseSize, as "from" has the same format as "size"
+	from := cw.parseSize(QueryMap{"size": queryMap["from"]}, 0)
+	if from < 0 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid from value: %d, using 0", from)
+		return 0
+	}
+	return from
+}
+
+// parseSearchAfter returns "search_after" values, which are sort values of the last hit from the previous page
+func (cw *ClickhouseQueryTranslator) parseSearchAfter(queryMap QueryMap) ([]any, error) {
+	searchAfterRaw, ok := queryMap["search_after"]
+	if !ok {
+		return nil, nil
+	}
+	searchAfter, ok := searchAfterRaw.([]any)
+	if !ok || len(searchAfter) == 0 {
+		return nil, fmt.Errorf("%w: search_after must be a non-empty array, got: %v", quesma_errors.ErrCouldNotParseRequest(), searchAfterRaw)
+	}
+	return searchAfter, nil
+}
+
+// searchAfterCondition returns a condition selecting rows, which come after `searchAfter` values in `orderBy` order.
+// For `ORDER BY a ASC, b DESC` it's `a > a0 OR (a = a0 AND b < b0)`.
+// There may be more values than sort columns, e.g. when Elastic's internal fields (like `_score`) were skipped in sort.
+// There may be fewer, if the previous page wasn't sorted by total order tiebreakers (it had no search_after), then
+// only the first sort columns are compared.
+//
+// Like in Elastic, rows with the same values of compared sort columns as the last hit are skipped,
+// but sort columns are followed by total order tiebreakers (see totalOrderTiebreakers), so normally there are no such rows.
+func (cw *ClickhouseQueryTranslator) searchAfterCondition(orderBy []model.OrderByExpr, searchAfter []any) (model.Expr, error) {
+	if len(orderBy) == 0 {
+		return nil, fmt.Errorf("%w: search_after requires sort", quesma_errors.ErrCouldNotParseRequest())
+	}
+	if len(searchAfter) < len(orderBy) {
+		orderBy = orderBy[:len(searchAfter)]
+	}
+
+	var alternatives []model.Expr
+	var equalities []model.Expr
+	for i, sortColumn := range orderBy {
+		value, err := cw.searchAfterValue(sortColumn.Expr, searchAfter[i])
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if sortColumn.Direction == model.DescOrder {
+			op = "<"
+		}
+		comparison := model.NewInfixExpr(sortColumn.Expr, op, value)
+		alternatives = append(alternatives, model.And(append(equalities[:len(equalities):len(equalities)], comparison)))
+		equalities = append(equalities, model.NewInfixExpr(sortColumn.Expr, "=", value))
+	}
+	return model.Or(alternatives), nil
+}
+
+// searchAfterValue converts a sort value from our response (SearchHit.Sort) back to SQL. Dates are returned there as epoch millis.
+func (cw *ClickhouseQueryTranslator) searchAfterValue(sortExpr model.Expr, value any) (model.Expr, error) {
+	if column, ok := sortExpr.(model.ColumnRef); ok {
+		switch cw.Table.GetDateTimeType(cw.Ctx, column.ColumnName) {
+		case clickhouse.DateTime, clickhouse.DateTime64:
+			if timestamp, ok := kibana.NewDateManager().ParseRange(value, ""); ok {
+				return timestamp, nil
+			}
+			return nil, fmt.Errorf("%w: invalid search_after date value: %v", quesma_errors.ErrCouldNotParseRequest(), value)
+		}
+	}
+
+	switch value.(type) {
+	case string, bool, float64, float32, int, int64, int32, int16, int8, uint64, uint32, uint16, uint8:
+		return model.NewLiteral(sprint(value)), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported search_after value: %v (%T)", quesma_errors.ErrCouldNotParseRequest(), value, value)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package queryparser
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/model"
+	"quesma/model/typical_queries"
+	"quesma/quesma/config"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	table, err := clickhouse.NewTable(`CREATE TABLE logs
+		( "message" String, "count" Int64, "@timestamp" DateTime64(3, 'UTC'), "_id" String )
+		ENGINE = Memory`,
+		clickhouse.NewNoTimestampOnlyStringAttrCHConfig(),
+	)
+	require.NoError(t, err)
+	tableSchema := schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeKeyword},
+		"count":      {PropertyName: "count", InternalPropertyName: "count", Type: schema.QuesmaTypeLong},
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+		"_id":        {PropertyName: "_id", InternalPropertyName: "_id", Type: schema.QuesmaTypeKeyword},
+	}}
+	cw := ClickhouseQueryTranslator{Table: table, Ctx: context.Background(), Config: &config.QuesmaConfiguration{}, Schema: tableSchema}
+
+	tests := []struct {
+		name        string
+		query       string
+		expectedSql string
+	}{
+		{
+			name:        "from",
+			query:       `{"size": 20, "from": 40, "track_total_hits": false}`,
+			expectedSql: `SELECT * FROM __quesma_table_name LIMIT 20 OFFSET 40`,
+		},
+		{
+			name: "search_after",
+			query: `{"size": 10, "track_total_hits": false, "query": {"term": {"message": "error"}},
+				"sort": [{"@timestamp": {"order": "desc"}}, {"_id": "asc"}], "search_after": [1706745600000, "a1"]}`,
+			expectedSql: `SELECT * FROM __quesma_table_name WHERE ("message"='error' AND ("@timestamp"<fromUnixTimestamp64Milli(1706745600000) OR ` +
+				`("@timestamp"=fromUnixTimestamp64Milli(1706745600000) AND "_id">'a1'))) ORDER BY "@timestamp" DESC, "_id" ASC LIMIT 10`,
+		},
+		{
+			name: "search_after with a sort, which isn't unique",
+			query: `{"size": 10, "track_total_hits": false,
+				"sort": [{"count": "asc"}], "search_after": [5, "a1"]}`,
+			expectedSql: `SELECT * FROM __quesma_table_name WHERE ("count">5 OR ("count"=5 AND "_id">'a1')) ORDER BY "count" ASC, "_id" ASC LIMIT 10`,
+		},
+		{
+			name: "search_after without values of tiebreakers",
+			query: `{"size": 10, "track_total_hits": false,
+				"sort": [{"count": "asc"}], "search_after": [5]}`,
+			expectedSql: `SELECT * FROM __quesma_table_name WHERE "count">5 ORDER BY "count" ASC, "_id" ASC LIMIT 10`,
+		},
+		{
+			name: "search_after with many sort fields and a tiebreaker",
+			query: `{"size": 10, "track_total_hits": false,
+				"sort": [{"count": "asc"}, {"message": "desc"}, {"_doc": "asc"}], "search_after": [5, "abc", "a1"]}`,
+			expectedSql: `SELECT * FROM __quesma_table_name WHERE (("count">5 OR ("count"=5 AND "message"<'abc')) OR (("count"=5 AND "message"='abc') AND "_id">'a1')) ` +
+				`ORDER BY "count" ASC, "message" DESC, "_id" ASC LIMIT 10`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := cw.ParseQuery(types.MustJSON(tt.query))
+			require.NoError(t, err)
+
+			var hitsQuery *model.Query
+			for _, query := range plan.Queries {
+				if _, ok := query.Type.(*typical_queries.Hits); ok {
+					hitsQuery = query
+				}
+			}
+			require.NotNil(t, hitsQuery)
+			assert.Equal(t, tt.expectedSql, hitsQuery.SelectCommand.String())
+		})
+	}
+
+	for _, query := range []string{
+		`{"search_after": [1]}`,
+		`{"sort": [{"count": "asc"}], "search_after": 1}`,
+	} {
+		_, err := cw.ParseQuery(types.MustJSON(query))
+		assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest(), query)
+	}
+
+	// without document ids, the tiebreaker is all other comparable columns
+	tableWithoutIds, err := clickhouse.NewTable(`CREATE TABLE logs ( "message" String, "count" Int64, "host" Map(String, String) ) ENGINE = Memory`,
+		clickhouse.NewNoTimestampOnlyStringAttrCHConfig())
+	require.NoError(t, err)
+	cw.Table = tableWithoutIds
+	cw.Schema = schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"message": {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeKeyword},
+		"count":   {PropertyName: "count", InternalPropertyName: "count", Type: schema.QuesmaTypeLong},
+		"host":    {PropertyName: "host", InternalPropertyName: "host", Type: schema.QuesmaTypeMap},
+	}}
+	plan, err := cw.ParseQuery(types.MustJSON(`{"size": 10, "track_total_hits": false, "sort": [{"count": "desc"}], "search_after": [1, "abc"]}`))
+	require.NoError(t, err)
+	require.Len(t, plan.Queries, 1)
+	assert.Equal(t, `SELECT * FROM __quesma_table_name WHERE ("count"<1 OR ("count"=1 AND "message">'abc')) ORDER BY "count" DESC, "message" ASC LIMIT 10`,
+		plan.Queries[0].SelectCommand.String())
+}
@@ -0,0 +1,237 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painless
+
+import (
+	"fmt"
+	"math"
+	"quesma/model"
+	"quesma/util"
+)
+
+// Evaluate computes a script lowered by ParseScript in Go, e.g. for pipeline aggregations,
+// which are calculated from results of other aggregations, not in SQL.
+// Column references are looked up in variables. Only numeric and boolean expressions are supported.
+// Result is float64, bool or nil (e.g. for NULL, or division by zero).
+func Evaluate(expr model.Expr, variables map[string]any) (any, error) {
+	switch e := expr.(type) {
+	case model.LiteralExpr:
+		switch v := e.Value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if v == "NULL" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("string values are not supported: %s", v)
+		default:
+			return toNumber(v), nil
+		}
+
+	case model.ColumnRef:
+		v, ok := variables[e.ColumnName]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable '%s'", e.ColumnName)
+		}
+		if v == nil {
+			return nil, nil
+		}
+		if b, isBool := v.(bool); isBool {
+			return b, nil
+		}
+		return toNumber(v), nil
+
+	case model.ParenExpr:
+		if len(e.Exprs) != 1 {
+			return nil, fmt.Errorf("unexpected parenthesized expression with %d elements", len(e.Exprs))
+		}
+		return Evaluate(e.Exprs[0], variables)
+
+	case model.PrefixExpr:
+		if len(e.Args) != 1 {
+			return nil, fmt.Errorf("unexpected %s with %d arguments", e.Op, len(e.Args))
+		}
+		arg, err := Evaluate(e.Args[0], variables)
+		if err != nil || arg == nil {
+			return nil, err
+		}
+		switch e.Op {
+		case "NOT":
+			return !asBool(arg), nil
+		case "-":
+			return -asNumber(arg), nil
+		}
+		return nil, fmt.Errorf("unsupported operator %s", e.Op)
+
+	case model.InfixExpr:
+		return evaluateInfix(e, variables)
+
+	case model.FunctionExpr:
+		return evaluateFunction(e, variables)
+	}
+
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func evaluateInfix(e model.InfixExpr, variables map[string]any) (any, error) {
+	left, err := Evaluate(e.Left, variables)
+	if err != nil {
+		return nil, err
+	}
+	right, err := Evaluate(e.Right, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case "AND":
+		return asBool(left) && asBool(right), nil
+	case "OR":
+		return asBool(left) || asBool(right), nil
+	}
+
+	if left == nil || right == nil {
+		if e.Op == "=" || e.Op == "!=" || e.Op == "<" || e.Op == "<=" || e.Op == ">" || e.Op == ">=" {
+			return false, nil
+		}
+		return nil, nil
+	}
+	l, r := asNumber(left), asNumber(right)
+
+	switch e.Op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, nil
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, nil
+		}
+		return math.Mod(l, r), nil
+	case "=":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// oneArgFunctions are Clickhouse functions (generated by ParseScript) with their Go counterparts
+var oneArgFunctions = map[string]func(float64) float64{
+	"abs": math.Abs, "floor": math.Floor, "ceil": math.Ceil, "round": math.Round, "sqrt": math.Sqrt, "cbrt": math.Cbrt,
+	"exp": math.Exp, "log": math.Log, "log10": math.Log10, "sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"toInt64": math.Trunc, "toFloat64": func(x float64) float64 { return x },
+	"sign": func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	},
+}
+
+func evaluateFunction(e model.FunctionExpr, variables map[string]any) (any, error) {
+	args := make([]any, len(e.Args))
+	for i, arg := range e.Args {
+		var err error
+		if args[i], err = Evaluate(arg, variables); err != nil {
+			return nil, err
+		}
+	}
+
+	switch e.Name {
+	case "if":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("if expects 3 arguments, got %d", len(args))
+		}
+		if asBool(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "isNull":
+		return args[0] == nil, nil
+	case "isNotNull":
+		return args[0] != nil, nil
+	}
+
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	switch e.Name {
+	case "pow":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("pow expects 2 arguments, got %d", len(args))
+		}
+		return math.Pow(asNumber(args[0]), asNumber(args[1])), nil
+	case "least", "greatest":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s expects at least 1 argument", e.Name)
+		}
+		result := asNumber(args[0])
+		for _, arg := range args[1:] {
+			if e.Name == "least" {
+				result = math.Min(result, asNumber(arg))
+			} else {
+				result = math.Max(result, asNumber(arg))
+			}
+		}
+		return result, nil
+	}
+
+	if function, ok := oneArgFunctions[e.Name]; ok {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", e.Name, len(args))
+		}
+		return function(asNumber(args[0])), nil
+	}
+	return nil, fmt.Errorf("unsupported function %s", e.Name)
+}
+
+func toNumber(v any) any {
+	if f, ok := util.ExtractNumeric64Maybe(v); ok {
+		return f
+	}
+	return nil
+}
+
+func asNumber(v any) float64 {
+	switch val := v.(type) {
+	case float64:
+		return val
+	case bool:
+		if val {
+			return 1
+		}
+	}
+	return 0
+}
+
+func asBool(v any) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	}
+	return false
+}
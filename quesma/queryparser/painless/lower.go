@@ -0,0 +1,725 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painless
+
+import (
+	"fmt"
+	"math"
+	"quesma/end_user_errors"
+	"quesma/model"
+	"quesma/schema"
+	"slices"
+	"strings"
+)
+
+// ParseScript parses a Painless script and lowers it to an SQL expression.
+// params are values for `params.name` (and bare `name`) references, e.g. literals from script's "params",
+// or variables from bucket_script's "buckets_path".
+// fields is the schema of the queried index, it tells which document fields are integral (e.g. long),
+// so that `/` and `%` on them are integer operations, as in Java. It may be empty, e.g. if script uses no fields.
+// Returned error is an end user error, which describes the unsupported construct.
+func ParseScript(source string, params map[string]model.Expr, fields schema.Schema) (model.Expr, error) {
+	expr, err := parseScript(source, params, fields)
+	if err != nil {
+		return nil, end_user_errors.ErrNotSupportedScript.New(err).Details("Script: '%s', reason: %v", source, err)
+	}
+	return expr, nil
+}
+
+func parseScript(source string, params map[string]model.Expr, fields schema.Schema) (model.Expr, error) {
+	statements, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lowerer{params: params, fields: fields, variables: make(map[string]value)}
+	result, err := l.lowerStatements(statements)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("script doesn't emit or return any value")
+	}
+	return l.toSql(*result)
+}
+
+// ParseUpdateScript parses an update script (e.g. from _update_by_query), which modifies fields of a document,
+// like `ctx._source.count += params.n`. It returns new values of modified fields, by field name.
+// Returned error is an end user error, same as in ParseScript.
+func ParseUpdateScript(source string, params map[string]model.Expr, fields schema.Schema) (map[string]model.Expr, error) {
+	updated, err := parseUpdateScript(source, params, fields)
+	if err != nil {
+		return nil, end_user_errors.ErrNotSupportedScript.New(err).Details("Script: '%s', reason: %v", source, err)
+	}
+	return updated, nil
+}
+
+func parseUpdateScript(source string, params map[string]model.Expr, fields schema.Schema) (map[string]model.Expr, error) {
+	statements, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lowerer{params: params, fields: fields, variables: make(map[string]value), source: make(map[string]value)}
+	if _, err = l.lowerStatements(statements); err != nil {
+		return nil, err
+	}
+	if len(l.source) == 0 {
+		return nil, fmt.Errorf("script doesn't modify any field of ctx._source")
+	}
+
+	updated := make(map[string]model.Expr, len(l.source))
+	for field, v := range l.source {
+		if updated[field], err = l.toSql(v); err != nil {
+			return nil, err
+		}
+	}
+	return updated, nil
+}
+
+// LiteralParams converts script's "params" JSON object to expressions, which can be passed to ParseScript
+func LiteralParams(params map[string]any) map[string]model.Expr {
+	result := make(map[string]model.Expr, len(params))
+	for name, param := range params {
+		switch p := param.(type) {
+		case string:
+			result[name] = stringLiteral(p)
+		case float64, int, int64, bool:
+			result[name] = model.NewLiteral(p)
+		case nil:
+			result[name] = model.NewLiteral("NULL")
+		}
+		// other types (arrays, objects) can't be used in SQL, so referencing them will fail with "unknown param"
+	}
+	return result
+}
+
+type valueKind int
+
+const (
+	kindUnknown valueKind = iota
+	kindNumber            // floating point, or not known to be integral
+	kindInteger           // integral number, `/` and `%` on two of them are integer operations (as in Java)
+	kindString
+	kindBool
+)
+
+// value is a partially lowered expression. Most values are plain SQL expressions, but e.g. `doc` or `doc['field']`
+// have no SQL counterpart on their own, only after applying `['field']` or `.value`.
+type value struct {
+	expr      model.Expr
+	kind      valueKind
+	namespace string // doc, params, Math, ... (expr is nil then)
+	docField  string // doc['docField'] (expr is nil then)
+}
+
+var namespaces = []string{"doc", "params", "Math", "Integer", "Long", "Double", "Float", "String"}
+
+// ctx and ctx._source are namespaces available only in update scripts
+const (
+	ctxNamespace    = "ctx"
+	sourceNamespace = "ctx._source"
+)
+
+type lowerer struct {
+	params    map[string]model.Expr
+	fields    schema.Schema
+	variables map[string]value
+	source    map[string]value // modified fields of ctx._source, nil if it's not an update script
+	inherited map[string]value // fields of ctx._source modified before the current if's branch
+}
+
+// fork returns a lowerer for a branch of the script, which can't affect variables and fields of the original one
+func (l *lowerer) fork() *lowerer {
+	forked := &lowerer{params: l.params, fields: l.fields, variables: cloneVariables(l.variables)}
+	if l.source != nil {
+		forked.source = make(map[string]value)
+		forked.inherited = cloneVariables(l.inherited)
+		for field, v := range l.source {
+			forked.inherited[field] = v
+		}
+	}
+	return forked
+}
+
+// lowerStatements returns the emitted/returned value, or nil if the statements don't emit or return anything.
+func (l *lowerer) lowerStatements(statements []statement) (*value, error) {
+	for i, stmt := range statements {
+		switch s := stmt.(type) {
+		case assignmentStatement:
+			v, err := l.lowerNode(s.expr)
+			if err != nil {
+				return nil, err
+			}
+			l.variables[s.name] = v
+
+		case targetAssignmentStatement:
+			v, err := l.lowerNode(s.expr)
+			if err != nil {
+				return nil, err
+			}
+			if name, ok := s.target.(identifierNode); ok {
+				l.variables[name.name] = v
+			} else if field, ok := l.sourceField(s.target); ok {
+				l.source[field] = v
+			} else if l.source != nil {
+				return nil, fmt.Errorf("assignments are supported only to local variables and ctx._source fields")
+			} else {
+				return nil, fmt.Errorf("assignments are supported only to local variables")
+			}
+
+		case returnStatement:
+			if s.expr == nil {
+				return nil, nil
+			}
+			v, err := l.lowerNode(s.expr)
+			return &v, err
+
+		case expressionStatement:
+			call, ok := s.expr.(callNode)
+			if !ok || call.target != nil || call.method != "emit" {
+				// value of the last statement is the implicit result, e.g. for "script": "doc['x'].value * 2"
+				if i == len(statements)-1 {
+					v, err := l.lowerNode(s.expr)
+					return &v, err
+				}
+				return nil, fmt.Errorf("unsupported statement, only assignments, if, return and emit are supported")
+			}
+			if len(call.args) != 1 {
+				return nil, fmt.Errorf("emit expects 1 argument, got %d", len(call.args))
+			}
+			v, err := l.lowerNode(call.args[0])
+			return &v, err
+
+		case ifStatement:
+			// Both branches continue with the rest of the script, so that e.g. `if (x) { return 1; } return 2;`
+			// or `def y = 0; if (x) { y = 1; } emit(y);` work. The result is a single `if(condition, then, else)`.
+			condition, err := l.lowerNode(s.condition)
+			if err != nil {
+				return nil, err
+			}
+			conditionSql, err := l.toSql(condition)
+			if err != nil {
+				return nil, err
+			}
+			rest := statements[i+1:]
+			thenBranch, otherwiseBranch := l.fork(), l.fork()
+			then, err := thenBranch.lowerStatements(slices.Concat(s.then, rest))
+			if err != nil {
+				return nil, err
+			}
+			otherwise, err := otherwiseBranch.lowerStatements(slices.Concat(s.otherwise, rest))
+			if err != nil {
+				return nil, err
+			}
+			if err = l.mergeSource(conditionSql, thenBranch.source, otherwiseBranch.source); err != nil {
+				return nil, err
+			}
+			if then == nil && otherwise == nil {
+				return nil, nil
+			}
+			result, err := l.conditional(conditionSql, then, otherwise)
+			return &result, err
+		}
+	}
+	return nil, nil
+}
+
+// mergeSource sets fields modified in any of if's branches to if(condition, then, otherwise)
+func (l *lowerer) mergeSource(condition model.Expr, then, otherwise map[string]value) error {
+	modified := make(map[string]bool)
+	for field := range then {
+		modified[field] = true
+	}
+	for field := range otherwise {
+		modified[field] = true
+	}
+	for field := range modified {
+		current := l.sourceValue(field)
+		thenValue, otherwiseValue := current, current
+		if v, ok := then[field]; ok {
+			thenValue = v
+		}
+		if v, ok := otherwise[field]; ok {
+			otherwiseValue = v
+		}
+		merged, err := l.conditional(condition, &thenValue, &otherwiseValue)
+		if err != nil {
+			return err
+		}
+		l.source[field] = merged
+	}
+	return nil
+}
+
+// sourceValue returns the current value of ctx._source's field: the assigned one, or the stored one
+func (l *lowerer) sourceValue(field string) value {
+	if v, ok := l.source[field]; ok {
+		return v
+	}
+	if v, ok := l.inherited[field]; ok {
+		return v
+	}
+	return l.fieldValue(field)
+}
+
+// fieldValue returns the stored value of a document's field, integral if the schema says so
+func (l *lowerer) fieldValue(field string) value {
+	v := value{expr: model.NewColumnRef(field)}
+	if resolved, ok := l.fields.ResolveField(field); ok && isIntegral(resolved.Type) {
+		v.kind = kindInteger
+	}
+	return v
+}
+
+func isIntegral(t schema.QuesmaType) bool {
+	return t.Equal(schema.QuesmaTypeInteger) || t.Equal(schema.QuesmaTypeLong) || t.Equal(schema.QuesmaTypeUnsignedLong)
+}
+
+// sourceField returns the field name if n is `ctx._source.field` or `ctx._source['field']`
+func (l *lowerer) sourceField(n node) (string, bool) {
+	if l.source == nil {
+		return "", false
+	}
+	var target node
+	var field string
+	switch e := n.(type) {
+	case memberNode:
+		target, field = e.target, e.name
+	case indexNode:
+		index, ok := e.index.(literalNode)
+		if !ok {
+			return "", false
+		}
+		target = e.target
+		field, _ = index.value.(string)
+	}
+	if target == nil || field == "" {
+		return "", false
+	}
+	v, err := l.lowerNode(target)
+	return field, err == nil && v.namespace == sourceNamespace
+}
+
+func cloneVariables(variables map[string]value) map[string]value {
+	result := make(map[string]value, len(variables))
+	for name, v := range variables {
+		result[name] = v
+	}
+	return result
+}
+
+// conditional returns if(condition, then, otherwise). Missing branch means NULL.
+func (l *lowerer) conditional(condition model.Expr, then, otherwise *value) (value, error) {
+	null := value{expr: model.NewLiteral("NULL")}
+	if then == nil {
+		then = &null
+	}
+	if otherwise == nil {
+		otherwise = &null
+	}
+	thenSql, err := l.toSql(*then)
+	if err != nil {
+		return value{}, err
+	}
+	otherwiseSql, err := l.toSql(*otherwise)
+	if err != nil {
+		return value{}, err
+	}
+	kind := then.kind
+	if kind == kindUnknown {
+		kind = otherwise.kind
+	} else if kind == kindInteger && otherwise.kind == kindNumber {
+		kind = kindNumber
+	}
+	return value{expr: model.NewFunction("if", condition, thenSql, otherwiseSql), kind: kind}, nil
+}
+
+// toSql returns SQL expression for a fully lowered value
+func (l *lowerer) toSql(v value) (model.Expr, error) {
+	switch {
+	case v.docField != "":
+		return nil, fmt.Errorf("doc['%s'] must be followed by .value", v.docField)
+	case v.namespace != "":
+		return nil, fmt.Errorf("'%s' can't be used as a value", v.namespace)
+	}
+	return v.expr, nil
+}
+
+func (l *lowerer) lowerSql(n node) (model.Expr, valueKind, error) {
+	v, err := l.lowerNode(n)
+	if err != nil {
+		return nil, kindUnknown, err
+	}
+	expr, err := l.toSql(v)
+	return expr, v.kind, err
+}
+
+func (l *lowerer) lowerNode(n node) (value, error) {
+	switch e := n.(type) {
+	case literalNode:
+		return literal(e.value), nil
+
+	case identifierNode:
+		if v, ok := l.variables[e.name]; ok {
+			return v, nil
+		}
+		if slices.Contains(namespaces, e.name) || (e.name == ctxNamespace && l.source != nil) {
+			return value{namespace: e.name}, nil
+		}
+		// expression language (lang: expression) scripts use bare names instead of params.name
+		if param, ok := l.params[e.name]; ok {
+			return value{expr: param}, nil
+		}
+		return value{}, fmt.Errorf("unknown variable '%s'", e.name)
+
+	case memberNode:
+		return l.lowerMember(e)
+
+	case indexNode:
+		target, err := l.lowerNode(e.target)
+		if err != nil {
+			return value{}, err
+		}
+		index, isLiteral := e.index.(literalNode)
+		name, _ := index.value.(string)
+		if !isLiteral || name == "" {
+			return value{}, fmt.Errorf("only string literals are supported as index, e.g. doc['field']")
+		}
+		switch target.namespace {
+		case "doc":
+			return value{docField: name}, nil
+		case "params":
+			return l.param(name)
+		case sourceNamespace:
+			return l.sourceValue(name), nil
+		}
+		return value{}, fmt.Errorf("indexing is supported only for doc and params, e.g. doc['%s']", name)
+
+	case callNode:
+		return l.lowerCall(e)
+
+	case unaryNode:
+		if lit, ok := e.arg.(literalNode); ok && e.op == "-" {
+			switch number := lit.value.(type) {
+			case int64:
+				return literal(-number), nil
+			case float64:
+				return literal(-number), nil
+			}
+		}
+		arg, kind, err := l.lowerSql(e.arg)
+		if err != nil {
+			return value{}, err
+		}
+		if e.op == "!" {
+			return value{expr: model.NewPrefixExpr("NOT", []model.Expr{arg}), kind: kindBool}, nil
+		}
+		return value{expr: model.NewPrefixExpr(e.op, []model.Expr{arg}), kind: kind}, nil
+
+	case binaryNode:
+		return l.lowerBinary(e)
+
+	case ternaryNode:
+		condition, _, err := l.lowerSql(e.condition)
+		if err != nil {
+			return value{}, err
+		}
+		then, err := l.lowerNode(e.then)
+		if err != nil {
+			return value{}, err
+		}
+		otherwise, err := l.lowerNode(e.otherwise)
+		if err != nil {
+			return value{}, err
+		}
+		return l.conditional(condition, &then, &otherwise)
+
+	case castNode:
+		arg, kind, err := l.lowerSql(e.arg)
+		if err != nil {
+			return value{}, err
+		}
+		switch e.typeName {
+		case "byte", "short", "int", "long":
+			return value{expr: model.NewFunction("toInt64", arg), kind: kindInteger}, nil
+		case "float", "double":
+			return value{expr: model.NewFunction("toFloat64", arg), kind: kindNumber}, nil
+		case "String":
+			return value{expr: model.NewFunction("toString", arg), kind: kindString}, nil
+		case "boolean":
+			return value{expr: arg, kind: kindBool}, nil
+		}
+		return value{expr: arg, kind: kind}, nil
+	}
+
+	return value{}, fmt.Errorf("unsupported expression %T", n)
+}
+
+func (l *lowerer) param(name string) (value, error) {
+	if param, ok := l.params[name]; ok {
+		return value{expr: param}, nil
+	}
+	return value{}, fmt.Errorf("unknown param '%s'", name)
+}
+
+func literal(v any) value {
+	switch val := v.(type) {
+	case nil:
+		return value{expr: model.NewLiteral("NULL")}
+	case string:
+		return value{expr: stringLiteral(val), kind: kindString}
+	case bool:
+		return value{expr: model.NewLiteral(val), kind: kindBool}
+	case int64:
+		return value{expr: model.NewLiteral(val), kind: kindInteger}
+	default:
+		return value{expr: model.NewLiteral(val), kind: kindNumber}
+	}
+}
+
+func stringLiteral(s string) model.Expr {
+	escaped := strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`)
+	return model.NewLiteral("'" + escaped + "'")
+}
+
+// dateGetters maps Painless (java.time and deprecated Joda) date getters to Clickhouse functions
+var dateGetters = map[string]string{
+	"getYear": "toYear", "year": "toYear",
+	"getMonthValue": "toMonth", "getMonthOfYear": "toMonth", "monthOfYear": "toMonth",
+	"getDayOfMonth": "toDayOfMonth", "dayOfMonth": "toDayOfMonth",
+	"getDayOfYear": "toDayOfYear", "dayOfYear": "toDayOfYear",
+	"getDayOfWeek": "toDayOfWeek", "getDayOfWeekEnum": "toDayOfWeek", "dayOfWeek": "toDayOfWeek", // 1 (Monday) - 7 (Sunday) in both
+	"getHour": "toHour", "getHourOfDay": "toHour", "hourOfDay": "toHour",
+	"getMinute": "toMinute", "getMinuteOfHour": "toMinute", "minuteOfHour": "toMinute",
+	"getSecond": "toSecond", "getSecondOfMinute": "toSecond", "secondOfMinute": "toSecond",
+	"getMillis": "toUnixTimestamp64Milli", "toEpochMilli": "toUnixTimestamp64Milli", "millis": "toUnixTimestamp64Milli",
+}
+
+func (l *lowerer) lowerMember(e memberNode) (value, error) {
+	target, err := l.lowerNode(e.target)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch {
+	case target.namespace == "params":
+		return l.param(e.name)
+	case target.namespace == ctxNamespace && e.name == "_source":
+		return value{namespace: sourceNamespace}, nil
+	case target.namespace == sourceNamespace:
+		return l.sourceValue(e.name), nil
+	case target.namespace == "Math" && e.name == "PI":
+		return value{expr: model.NewLiteral(math.Pi), kind: kindNumber}, nil
+	case target.namespace == "Math" && e.name == "E":
+		return value{expr: model.NewLiteral(math.E), kind: kindNumber}, nil
+	case target.namespace != "":
+		return value{}, fmt.Errorf("unsupported field %s.%s", target.namespace, e.name)
+	case target.docField != "":
+		column := model.NewColumnRef(target.docField)
+		switch e.name {
+		case "value":
+			return l.fieldValue(target.docField), nil
+		case "empty":
+			return value{expr: model.NewFunction("isNull", column), kind: kindBool}, nil
+		}
+		return value{}, fmt.Errorf("unsupported field doc['%s'].%s", target.docField, e.name)
+	}
+
+	if function, ok := dateGetters[e.name]; ok {
+		return value{expr: model.NewFunction(function, target.expr), kind: kindInteger}, nil
+	}
+	return value{}, fmt.Errorf("unsupported field '%s'", e.name)
+}
+
+func (l *lowerer) lowerCall(e callNode) (value, error) {
+	if e.target == nil {
+		if e.method == "emit" {
+			return value{}, fmt.Errorf("emit can only be used as a statement")
+		}
+		return value{}, fmt.Errorf("unsupported function '%s'", e.method)
+	}
+
+	target, err := l.lowerNode(e.target)
+	if err != nil {
+		return value{}, err
+	}
+	args := make([]model.Expr, 0, len(e.args))
+	for _, arg := range e.args {
+		argSql, _, err := l.lowerSql(arg)
+		if err != nil {
+			return value{}, err
+		}
+		args = append(args, argSql)
+	}
+	expectArgs := func(n ...int) error {
+		if !slices.Contains(n, len(args)) {
+			return fmt.Errorf("%s expects %v arguments, got %d", e.method, n, len(args))
+		}
+		return nil
+	}
+
+	switch {
+	case target.namespace != "":
+		return l.lowerStaticCall(target.namespace, e, args, expectArgs)
+	case target.docField != "":
+		column := model.NewColumnRef(target.docField)
+		switch e.method {
+		case "getValue":
+			return l.fieldValue(target.docField), nil
+		case "size":
+			return value{expr: model.NewFunction("if", model.NewFunction("isNull", column), model.NewLiteral(0), model.NewLiteral(1)), kind: kindInteger}, nil
+		case "isEmpty":
+			return value{expr: model.NewFunction("isNull", column), kind: kindBool}, nil
+		}
+		return value{}, fmt.Errorf("unsupported method doc['%s'].%s()", target.docField, e.method)
+	}
+
+	self := target.expr
+	if function, ok := dateGetters[e.method]; ok {
+		return value{expr: model.NewFunction(function, self), kind: kindInteger}, expectArgs(0)
+	}
+
+	switch e.method {
+	// getDayOfWeekEnum().getValue(), toInstant().toEpochMilli(), Integer and Double unboxing etc. are no-ops for us
+	case "getValue", "toInstant", "intValue", "longValue":
+		return target, expectArgs(0)
+	case "doubleValue", "floatValue":
+		return value{expr: model.NewFunction("toFloat64", self), kind: kindNumber}, expectArgs(0)
+	case "toString":
+		return value{expr: model.NewFunction("toString", self), kind: kindString}, expectArgs(0)
+	case "toLowerCase":
+		return value{expr: model.NewFunction("lower", self), kind: kindString}, expectArgs(0)
+	case "toUpperCase":
+		return value{expr: model.NewFunction("upper", self), kind: kindString}, expectArgs(0)
+	case "trim":
+		return value{expr: model.NewFunction("trimBoth", self), kind: kindString}, expectArgs(0)
+	case "length":
+		return value{expr: model.NewFunction("lengthUTF8", self), kind: kindInteger}, expectArgs(0)
+	case "isEmpty":
+		return value{expr: model.NewFunction("empty", self), kind: kindBool}, expectArgs(0)
+	case "equals":
+		return value{expr: model.NewInfixExpr(self, "=", argOrNil(args, 0)), kind: kindBool}, expectArgs(1)
+	case "contains":
+		return value{expr: model.NewInfixExpr(model.NewFunction("position", self, argOrNil(args, 0)), ">", model.NewLiteral(0)), kind: kindBool}, expectArgs(1)
+	case "startsWith", "endsWith":
+		return value{expr: model.NewFunction(e.method, self, argOrNil(args, 0)), kind: kindBool}, expectArgs(1)
+	case "indexOf": // Java indexes are 0-based, Clickhouse's are 1-based
+		return value{expr: model.NewParenExpr(model.NewInfixExpr(model.NewFunction("positionUTF8", self, argOrNil(args, 0)), "-", model.NewLiteral(1))), kind: kindInteger}, expectArgs(1)
+	case "replace":
+		return value{expr: model.NewFunction("replaceAll", self, argOrNil(args, 0), argOrNil(args, 1)), kind: kindString}, expectArgs(2)
+	case "substring":
+		if err = expectArgs(1, 2); err != nil {
+			return value{}, err
+		}
+		start := model.NewParenExpr(model.NewInfixExpr(args[0], "+", model.NewLiteral(1)))
+		if len(args) == 1 {
+			return value{expr: model.NewFunction("substringUTF8", self, start), kind: kindString}, nil
+		}
+		length := model.NewParenExpr(model.NewInfixExpr(args[1], "-", args[0]))
+		return value{expr: model.NewFunction("substringUTF8", self, start, length), kind: kindString}, nil
+	}
+
+	return value{}, fmt.Errorf("unsupported method '%s'", e.method)
+}
+
+func argOrNil(args []model.Expr, i int) model.Expr {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// mathFunctions maps Math.* functions to Clickhouse functions
+var mathFunctions = map[string]string{
+	"abs": "abs", "floor": "floor", "ceil": "ceil", "round": "round", "sqrt": "sqrt", "cbrt": "cbrt",
+	"pow": "pow", "exp": "exp", "log": "log", "log10": "log10", "min": "least", "max": "greatest",
+	"sin": "sin", "cos": "cos", "tan": "tan", "signum": "sign",
+}
+
+func (l *lowerer) lowerStaticCall(namespace string, e callNode, args []model.Expr, expectArgs func(n ...int) error) (value, error) {
+	switch {
+	case namespace == "doc" && e.method == "containsKey":
+		// every field from the table exists in every document (possibly as NULL), and Clickhouse will fail
+		// on non-existing ones anyway, so we can't do any better here
+		return value{expr: model.NewLiteral(true), kind: kindBool}, expectArgs(1)
+	case namespace == "Math":
+		if function, ok := mathFunctions[e.method]; ok {
+			return value{expr: model.NewFunction(function, args...), kind: kindNumber}, nil
+		}
+	case namespace == "Integer" || namespace == "Long":
+		if e.method == "parseInt" || e.method == "parseLong" || e.method == "valueOf" {
+			return value{expr: model.NewFunction("toInt64", args...), kind: kindInteger}, expectArgs(1)
+		}
+	case namespace == "Double" || namespace == "Float":
+		if e.method == "parseDouble" || e.method == "parseFloat" || e.method == "valueOf" {
+			return value{expr: model.NewFunction("toFloat64", args...), kind: kindNumber}, expectArgs(1)
+		}
+	case namespace == "String" && e.method == "valueOf":
+		return value{expr: model.NewFunction("toString", args...), kind: kindString}, expectArgs(1)
+	}
+	return value{}, fmt.Errorf("unsupported method %s.%s()", namespace, e.method)
+}
+
+func (l *lowerer) lowerBinary(e binaryNode) (value, error) {
+	left, leftKind, err := l.lowerSql(e.left)
+	if err != nil {
+		return value{}, err
+	}
+	right, rightKind, err := l.lowerSql(e.right)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch e.op {
+	case "&&", "||":
+		op := map[string]string{"&&": "AND", "||": "OR"}[e.op]
+		return value{expr: model.NewInfixExpr(left, op, right), kind: kindBool}, nil
+
+	case "==", "!=":
+		// x == null must be IS NULL in SQL
+		if isNullLiteral(e.right) || isNullLiteral(e.left) {
+			arg := left
+			if isNullLiteral(e.left) {
+				arg = right
+			}
+			function := map[string]string{"==": "isNull", "!=": "isNotNull"}[e.op]
+			return value{expr: model.NewFunction(function, arg), kind: kindBool}, nil
+		}
+		op := map[string]string{"==": "=", "!=": "!="}[e.op]
+		return value{expr: model.NewParenExpr(model.NewInfixExpr(left, op, right)), kind: kindBool}, nil
+
+	case "<", "<=", ">", ">=":
+		return value{expr: model.NewParenExpr(model.NewInfixExpr(left, e.op, right)), kind: kindBool}, nil
+
+	case "+":
+		// in Java `+` with a string operand means concatenation
+		if leftKind == kindString || rightKind == kindString {
+			return value{expr: model.NewFunction("concat", asString(left, leftKind), asString(right, rightKind)), kind: kindString}, nil
+		}
+	}
+
+	if leftKind == kindInteger && rightKind == kindInteger {
+		// Clickhouse's `/` always returns Float64, and Java's integer division truncates
+		switch e.op {
+		case "/":
+			return value{expr: model.NewFunction("intDiv", left, right), kind: kindInteger}, nil
+		case "%":
+			return value{expr: model.NewFunction("modulo", left, right), kind: kindInteger}, nil
+		}
+		return value{expr: model.NewParenExpr(model.NewInfixExpr(left, e.op, right)), kind: kindInteger}, nil
+	}
+	return value{expr: model.NewParenExpr(model.NewInfixExpr(left, e.op, right)), kind: kindNumber}, nil
+}
+
+func isNullLiteral(n node) bool {
+	lit, ok := n.(literalNode)
+	return ok && lit.value == nil
+}
+
+func asString(expr model.Expr, kind valueKind) model.Expr {
+	if kind == kindString {
+		return expr
+	}
+	return model.NewFunction("toString", expr)
+}
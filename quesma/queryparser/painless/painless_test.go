@@ -0,0 +1,157 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painless
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/end_user_errors"
+	"quesma/model"
+	"quesma/schema"
+	"testing"
+)
+
+// testSchema has integral fields `long_a`, `long_b` and `count`, and a floating point `price`
+var testSchema = schema.NewSchema(map[schema.FieldName]schema.Field{
+	"long_a": {PropertyName: "long_a", InternalPropertyName: "long_a", Type: schema.QuesmaTypeLong},
+	"long_b": {PropertyName: "long_b", InternalPropertyName: "long_b", Type: schema.QuesmaTypeLong},
+	"count":  {PropertyName: "count", InternalPropertyName: "count", Type: schema.QuesmaTypeInteger},
+	"price":  {PropertyName: "price", InternalPropertyName: "price", Type: schema.QuesmaTypeFloat},
+}, true, "")
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		script   string
+		params   map[string]any
+		expected string
+	}{
+		{"emit(doc['timestamp'].value.getHour());", nil, `toHour("timestamp")`},
+		{"emit(doc['@timestamp'].value.hourOfDay)", nil, `toHour("@timestamp")`},
+		{"doc['bytes'].value / 1024", nil, `("bytes"/1024)`},
+		{"(long) doc['bytes'].value / 1024", nil, `intDiv(toInt64("bytes"),1024)`},
+		{"emit(doc['@timestamp'].value.getMinute() % 15)", nil, `modulo(toMinute("@timestamp"),15)`},
+		{"emit(doc['@timestamp'].value.getHour() / 6 * 6)", nil, `(intDiv(toHour("@timestamp"),6)*6)`},
+		{"emit(7 / 2.5)", nil, `(7/2.5)`},
+		{"emit(doc['a'].value + doc['b'].value * 2)", nil, `("a"+("b"*2))`},
+		{"emit((doc['a'].value + doc['b'].value) * 2)", nil, `(("a"+"b")*2)`},
+		{"emit(doc['name'].value.toLowerCase() + '-' + doc['id'].value)", nil, `concat(concat(lower("name"),'-'),toString("id"))`},
+		{"emit(doc['name'].value.substring(0, 3))", nil, `substringUTF8("name",(0+1),(3-0))`},
+		{"emit(doc['bytes'].value > params.limit ? 'big' : 'small')", map[string]any{"limit": 1000.0}, `if(("bytes">1000),'big','small')`},
+		{"emit(doc['bytes'].value * params['factor'])", map[string]any{"factor": 2.5}, `("bytes"*2.5)`},
+		{"if (doc['bytes'].size() == 0) { emit(0) } else { emit(doc['bytes'].value) }", nil, `if((if(isNull("bytes"),0,1)=0),0,"bytes")`},
+		{"def x = 0; if (doc['ok'].value == true) { x = 1; } return x;", nil, `if(("ok"=true),1,0)`},
+		{"if (doc['a'].value == null) return -1; return doc['a'].value;", nil, `if(isNull("a"),-1,"a")`},
+		{"String s = doc['msg'].value; emit(s.contains('err') && !s.startsWith('warn'))", nil, `(position("msg",'err')>0 AND NOT (startsWith("msg",'warn')))`},
+		{"emit(Math.max(doc['a'].value, (double) doc['b'].value))", nil, `greatest("a",toFloat64("b"))`},
+		{"// comment\nemit(doc['a'].value.getDayOfWeekEnum().getValue()) /* end */", nil, `toDayOfWeek("a")`},
+		{`emit("it's")`, nil, `'it\'s'`},
+		{"emit(doc['long_a'].value / doc['long_b'].value)", nil, `intDiv("long_a","long_b")`},
+		{"emit(doc['long_a'].getValue() % doc['count'].value)", nil, `modulo("long_a","count")`},
+		{"emit(doc['long_a'].value / 2)", nil, `intDiv("long_a",2)`},
+		{"emit(doc['long_a'].value / doc['price'].value)", nil, `("long_a"/"price")`},
+		{"emit(doc['long_a'].value / 2.5)", nil, `("long_a"/2.5)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			expr, err := ParseScript(tt.script, LiteralParams(tt.params), testSchema)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, model.AsString(expr))
+		})
+	}
+}
+
+func TestParseScriptUnsupported(t *testing.T) {
+	scripts := []string{
+		"for (int i = 0; i < 10; i++) { emit(i) }",
+		"emit(new ArrayList())",
+		"emit(doc['a'])",
+		"emit(params.missing)",
+		"emit(unknown)",
+		"emit(doc['a'].value.someMethod())",
+		"def x = 1;",
+		"emit('unterminated)",
+		"emit(doc['a'].value",
+	}
+	for _, script := range scripts {
+		t.Run(script, func(t *testing.T) {
+			_, err := ParseScript(script, nil, testSchema)
+			require.Error(t, err)
+
+			var endUserError *end_user_errors.EndUserError
+			require.True(t, errors.As(err, &endUserError))
+			assert.Equal(t, end_user_errors.ErrNotSupportedScript, endUserError.ErrorType())
+		})
+	}
+}
+
+func TestParseUpdateScript(t *testing.T) {
+	tests := []struct {
+		script   string
+		params   map[string]any
+		expected map[string]string
+	}{
+		{"ctx._source.status = 'done'", nil, map[string]string{"status": `'done'`}},
+		{"ctx._source['count'] += params.n;", map[string]any{"n": 2.0}, map[string]string{"count": `("count"+2)`}},
+		{"ctx._source.a = 1; ctx._source.b = ctx._source.a * 2", nil, map[string]string{"a": `1`, "b": `(1*2)`}},
+		{"def tag = ctx._source.tag.toUpperCase(); ctx._source.tag = tag", nil, map[string]string{"tag": `upper("tag")`}},
+		{"if (ctx._source.count > 10) { ctx._source.level = 'high' } else { ctx._source.count++ ; }", nil, nil},
+		{"if (ctx._source.count > 10) { ctx._source.level = 'high' }", nil, map[string]string{"level": `if(("count">10),'high',"level")`}},
+		{"if (ctx._source.count > 10) { return; } ctx._source.count -= 1", nil, map[string]string{"count": `if(("count">10),"count",("count"-1))`}},
+		{"ctx._source.count = ctx._source.count / 2", nil, map[string]string{"count": `intDiv("count",2)`}},
+		{"ctx._source.price = ctx._source.price / 2", nil, map[string]string{"price": `("price"/2)`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			fields, err := ParseUpdateScript(tt.script, LiteralParams(tt.params), testSchema)
+			if tt.expected == nil {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			actual := make(map[string]string, len(fields))
+			for field, expr := range fields {
+				actual[field] = model.AsString(expr)
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	_, err := ParseScript("ctx._source.status = 'done'", nil, testSchema)
+	assert.Error(t, err)
+	_, err = ParseUpdateScript("emit(doc['a'].value)", nil, testSchema)
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		script    string
+		variables map[string]any
+		expected  any
+	}{
+		{"count * 1", map[string]any{"count": int64(5)}, 5.0},
+		{"_value", map[string]any{"_value": uint64(7)}, 7.0},
+		{"params.tShirtSales / params.totalSales * 100", map[string]any{"tShirtSales": 200.0, "totalSales": 550.0}, 200.0 / 550.0 * 100},
+		{"params.numerator != null && params.denominator != null && params.denominator != 0 ? params.numerator / params.denominator : 0",
+			map[string]any{"numerator": 3.0, "denominator": 4.0}, 0.75},
+		{"params.numerator != null && params.denominator != null && params.denominator != 0 ? params.numerator / params.denominator : 0",
+			map[string]any{"numerator": 3.0, "denominator": 0.0}, 0.0},
+		{"params.a / params.b", map[string]any{"a": 1.0, "b": 0.0}, nil},
+		{"Math.max(params.a, params.b) - Math.abs(-2)", map[string]any{"a": 1.0, "b": 5.0}, 3.0},
+		{"params.a == null ? 1 : 2", map[string]any{"a": nil}, 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			params := make(map[string]model.Expr)
+			for name := range tt.variables {
+				params[name] = model.NewColumnRef(name)
+			}
+			expr, err := ParseScript(tt.script, params, schema.Schema{})
+			require.NoError(t, err)
+
+			result, err := Evaluate(expr, tt.variables)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
@@ -0,0 +1,497 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package painless
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parser for the subset of Painless (https://www.elastic.co/guide/en/elasticsearch/painless/current/index.html)
+// which Kibana generates for runtime fields, scripted fields and pipeline aggregations.
+//
+// We support:
+// - literals (numbers, strings, true/false/null), local variables (def x = ...;), assignments
+// - arithmetic, comparison, logical operators, ternary operator, casts like (int) or (double)
+// - if/else statements, return and emit
+// - doc['field'].value, doc['field'].size(), doc['field'].empty, doc.containsKey('field')
+// - params.name and params['name']
+// - method calls on values, e.g. date getters or string methods, and static calls like Math.abs
+//
+// We don't support loops, lambdas, `new`, arrays, or user defined functions.
+
+type (
+	node interface {
+		isNode()
+	}
+	literalNode struct {
+		value any // int64, float64, string, bool or nil
+	}
+	identifierNode struct {
+		name string
+	}
+	memberNode struct { // target.name
+		target node
+		name   string
+	}
+	indexNode struct { // target[index]
+		target node
+		index  node
+	}
+	callNode struct { // target.method(args...) or method(args...) if target is nil
+		target node
+		method string
+		args   []node
+	}
+	unaryNode struct {
+		op  string
+		arg node
+	}
+	binaryNode struct {
+		op          string
+		left, right node
+	}
+	ternaryNode struct {
+		condition, then, otherwise node
+	}
+	castNode struct {
+		typeName string
+		arg      node
+	}
+)
+
+func (literalNode) isNode()    {}
+func (identifierNode) isNode() {}
+func (memberNode) isNode()     {}
+func (indexNode) isNode()      {}
+func (callNode) isNode()       {}
+func (unaryNode) isNode()      {}
+func (binaryNode) isNode()     {}
+func (ternaryNode) isNode()    {}
+func (castNode) isNode()       {}
+
+type (
+	statement interface {
+		isStatement()
+	}
+	expressionStatement struct {
+		expr node
+	}
+	returnStatement struct {
+		expr node // nil for bare `return;`
+	}
+	assignmentStatement struct { // both `def x = 1;` and `x = 1;`
+		name string
+		expr node
+	}
+	targetAssignmentStatement struct { // e.g. `ctx._source.count = 1;` or `x += 1;`, compound assignments are expanded
+		target node
+		expr   node
+	}
+	ifStatement struct {
+		condition node
+		then      []statement
+		otherwise []statement
+	}
+)
+
+func (expressionStatement) isStatement()       {}
+func (returnStatement) isStatement()           {}
+func (assignmentStatement) isStatement()       {}
+func (targetAssignmentStatement) isStatement() {}
+func (ifStatement) isStatement()               {}
+
+// castTypes are type names which can be used in casts, e.g. (int) x
+var castTypes = map[string]bool{
+	"byte": true, "short": true, "int": true, "long": true, "float": true, "double": true,
+	"boolean": true, "String": true, "def": true,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(source string) ([]statement, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var statements []statement
+	for p.peek().kind != tokenEOF {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, value string) bool {
+	if p.peek().is(kind, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	if t := p.next(); !t.is(kind, value) {
+		return fmt.Errorf("expected '%s' but got %s at position %d", value, t, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) expectIdentifier() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier {
+		return "", fmt.Errorf("expected identifier but got %s at position %d", t, t.pos)
+	}
+	return t.value, nil
+}
+
+// skipSemicolons allows optional semicolons after statements, as `emit(x)` without `;` is common in Kibana
+func (p *parser) skipSemicolons() {
+	for p.accept(tokenOperator, ";") {
+	}
+}
+
+func (p *parser) parseStatement() (statement, error) {
+	defer p.skipSemicolons()
+
+	t := p.peek()
+	switch {
+	case t.is(tokenIdentifier, "if"):
+		return p.parseIf()
+
+	case t.is(tokenIdentifier, "return"):
+		p.next()
+		if p.peek().is(tokenOperator, ";") || p.peek().is(tokenOperator, "}") || p.peek().kind == tokenEOF {
+			return returnStatement{}, nil
+		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return returnStatement{expr: expr}, nil
+
+	case t.is(tokenIdentifier, "for"), t.is(tokenIdentifier, "while"), t.is(tokenIdentifier, "do"):
+		return nil, fmt.Errorf("loops are not supported (position %d)", t.pos)
+
+	case t.kind == tokenIdentifier && p.peekAt(1).kind == tokenIdentifier: // declaration, e.g. `def x = 1;` or `String s;`
+		p.next()
+		name := p.next().value
+		if !p.accept(tokenOperator, "=") {
+			return assignmentStatement{name: name, expr: literalNode{value: nil}}, nil
+		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return assignmentStatement{name: name, expr: expr}, nil
+
+	case t.kind == tokenIdentifier && p.peekAt(1).is(tokenOperator, "=") && !p.peekAt(2).is(tokenOperator, "="):
+		p.next()
+		p.next()
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return assignmentStatement{name: t.value, expr: expr}, nil
+	}
+
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"=", "+=", "-=", "*=", "/="} {
+		if p.accept(tokenOperator, op) {
+			value, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if op != "=" {
+				value = binaryNode{op: op[:1], left: expr, right: value}
+			}
+			return targetAssignmentStatement{target: expr, expr: value}, nil
+		}
+	}
+	return expressionStatement{expr: expr}, nil
+}
+
+func (p *parser) parseIf() (statement, error) {
+	p.next() // if
+	if err := p.expect(tokenOperator, "("); err != nil {
+		return nil, err
+	}
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(tokenOperator, ")"); err != nil {
+		return nil, err
+	}
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var otherwise []statement
+	if p.accept(tokenIdentifier, "else") {
+		if otherwise, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	return ifStatement{condition: condition, then: then, otherwise: otherwise}, nil
+}
+
+// parseBlock parses either `{ statements... }` or a single statement
+func (p *parser) parseBlock() ([]statement, error) {
+	if !p.accept(tokenOperator, "{") {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		return []statement{stmt}, nil
+	}
+
+	var statements []statement
+	for !p.accept(tokenOperator, "}") {
+		if p.peek().kind == tokenEOF {
+			return nil, fmt.Errorf("expected '}' but got end of script")
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+func (p *parser) parseExpression() (node, error) {
+	return p.parseTernary()
+}
+
+func (p *parser) parseTernary() (node, error) {
+	condition, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(tokenOperator, "?") {
+		return condition, nil
+	}
+	then, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(tokenOperator, ":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return ternaryNode{condition: condition, then: then, otherwise: otherwise}, nil
+}
+
+// binaryOperatorsByPrecedence lists binary operators from the lowest precedence to the highest
+var binaryOperatorsByPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryOperatorsByPrecedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || !slices.Contains(binaryOperatorsByPrecedence[level], t.value) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.value, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.is(tokenOperator, "!") || t.is(tokenOperator, "-") || t.is(tokenOperator, "+") {
+		p.next()
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if t.value == "+" {
+			return arg, nil
+		}
+		return unaryNode{op: t.value, arg: arg}, nil
+	}
+
+	// cast, e.g. (int) x
+	if t.is(tokenOperator, "(") && p.peekAt(1).kind == tokenIdentifier && castTypes[p.peekAt(1).value] && p.peekAt(2).is(tokenOperator, ")") {
+		p.next()
+		typeName := p.next().value
+		p.next()
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return castNode{typeName: typeName, arg: arg}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept(tokenOperator, "."):
+			name, err := p.expectIdentifier()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek().is(tokenOperator, "(") {
+				args, err := p.parseArguments()
+				if err != nil {
+					return nil, err
+				}
+				expr = callNode{target: expr, method: name, args: args}
+			} else {
+				expr = memberNode{target: expr, name: name}
+			}
+		case p.accept(tokenOperator, "["):
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokenOperator, "]"); err != nil {
+				return nil, err
+			}
+			expr = indexNode{target: expr, index: index}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) parseArguments() ([]node, error) {
+	if err := p.expect(tokenOperator, "("); err != nil {
+		return nil, err
+	}
+	var args []node
+	if p.accept(tokenOperator, ")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(tokenOperator, ")") {
+			return args, nil
+		}
+		if err = p.expect(tokenOperator, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if !strings.ContainsAny(t.value, ".eE") {
+			if i, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+				return literalNode{value: i}, nil
+			}
+		}
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at position %d", t.value, t.pos)
+		}
+		return literalNode{value: f}, nil
+
+	case tokenString:
+		return literalNode{value: t.value}, nil
+
+	case tokenIdentifier:
+		switch t.value {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		case "new":
+			return nil, fmt.Errorf("'new' is not supported (position %d)", t.pos)
+		}
+		if p.peek().is(tokenOperator, "(") {
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			return callNode{method: t.value, args: args}, nil
+		}
+		return identifierNode{name: t.value}, nil
+
+	case tokenOperator:
+		if t.value == "(" {
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokenOperator, ")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
@@ -8,6 +8,7 @@ import (
 	"quesma/logger"
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
+	"quesma/model/metrics_aggregations"
 	"quesma/model/typical_queries"
 	"quesma/quesma/types"
 )
@@ -45,6 +46,9 @@ func (cw *ClickhouseQueryTranslator) PancakeParseAggregationJson(body types.JSON
 			if err != nil {
 				return nil, err
 			}
+			if err = cw.pancakeSetRatesParentInterval(nil, subAggregations); err != nil {
+				return nil, err
+			}
 			topLevel.children = subAggregations
 		} else {
 			logger.WarnWithCtx(cw.Ctx).Msgf("aggs is not a map, but %T, aggs: %v", aggsRaw, aggsRaw)
@@ -64,6 +68,15 @@ func (cw *ClickhouseQueryTranslator) PancakeParseAggregationJson(body types.JSON
 	}
 
 	if addCount {
+		if pancakeQueries[0].whereClauseNarrowed {
+			// total count needs the original WHERE clause, so we count in a separate query
+			countPancake := &pancakeModel{
+				layers:      []*pancakeModelLayer{newPancakeModelLayer(nil)},
+				whereClause: topLevel.whereClause,
+				sampleLimit: noSampleLimit,
+			}
+			pancakeQueries = append([]*pancakeModel{countPancake}, pancakeQueries...)
+		}
 
 		// use our building blocks to add count
 		augmentedCountAggregation := &pancakeModelMetricAggregation{
@@ -87,6 +100,7 @@ func (cw *ClickhouseQueryTranslator) PancakeParseAggregationJson(body types.JSON
 
 		aggregationQueries = append(aggregationQueries, dbQuery)
 	}
+	aggregationQueries = append(aggregationQueries, newPancakeSqlQueryGeneratorr(cw.Ctx).generateSignificantTermsBackgroundQueries(pancakeQueries)...)
 
 	return aggregationQueries, nil
 }
@@ -179,6 +193,10 @@ func (cw *ClickhouseQueryTranslator) pancakeParseAggregation(aggregationName str
 	}
 	delete(queryMap, "aggs") // no-op if no "aggs"
 
+	if err = cw.pancakeSetRatesParentInterval(aggregation.queryType, aggregation.children); err != nil {
+		return nil, err
+	}
+
 	for k, v := range queryMap {
 		// should be empty by now. If it's not, it's an unsupported/unrecognized type of aggregation.
 		logger.ErrorWithCtxAndReason(cw.Ctx, logger.ReasonUnsupportedQuery(k)).
@@ -189,3 +207,34 @@ func (cw *ClickhouseQueryTranslator) pancakeParseAggregation(aggregationName str
 
 	return aggregation, nil
 }
+
+// pancakeSetRatesParentInterval sets parent's interval in all rate aggregations among children.
+// Rate has to be a direct child of date_histogram.
+func (cw *ClickhouseQueryTranslator) pancakeSetRatesParentInterval(parentQueryType model.QueryType, children []*pancakeAggregationTreeNode) error {
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		rate, isRate := child.queryType.(*metrics_aggregations.Rate)
+		if !isRate {
+			continue
+		}
+		dateHistogram, isDateHistogram := parentQueryType.(*bucket_aggregations.DateHistogram)
+		if !isDateHistogram {
+			return fmt.Errorf("rate aggregation %s must be a direct child of date_histogram", child.name)
+		}
+		months, duration, err := dateHistogram.MonthsOrDurationOfInterval()
+		if err != nil {
+			return err
+		}
+		needsBucketTimestamp, err := rate.SetParentInterval(months, duration, dateHistogram.Location())
+		if err != nil {
+			return err
+		}
+		if needsBucketTimestamp {
+			// any timestamp from the bucket is enough to compute its length
+			child.selectedColumns = append(child.selectedColumns, model.NewFunction("minOrNull", dateHistogram.Field()))
+		}
+	}
+	return nil
+}
@@ -18,6 +18,10 @@ import (
 func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pancakeAggregationTreeNode, queryMap QueryMap) (success bool, err error) {
 
 	success = true // returned in most cases
+	if _, ok := queryMap["variable_width_histogram"]; ok {
+		// without subaggregations it's parsed as a metrics aggregation, see VariableWidthHistogram
+		return false, fmt.Errorf("variable_width_histogram with subaggregations is not supported")
+	}
 	if histogramRaw, ok := queryMap["histogram"]; ok {
 		histogram, ok := histogramRaw.(QueryMap)
 		if !ok {
@@ -44,27 +48,21 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 			interval = 1.0
 			logger.WarnWithCtx(cw.Ctx).Msgf("unexpected type of interval: %T, value: %v. Will use 1.0.", intervalTyped, intervalTyped)
 		}
+		offset := cw.parseFloatField(histogram, "offset", 0)
 		minDocCount := cw.parseMinDocCount(histogram)
-		aggregation.queryType = bucket_aggregations.NewHistogram(cw.Ctx, interval, minDocCount)
+		extendedBounds := cw.parseHistogramBounds(histogram, "extended_bounds")
+		hardBounds := cw.parseHistogramBounds(histogram, "hard_bounds")
+		histogramAggr := bucket_aggregations.NewHistogram(cw.Ctx, interval, offset, minDocCount, extendedBounds, hardBounds)
+		aggregation.queryType = histogramAggr
 
 		field, _ := cw.parseFieldFieldMaybeScript(histogram, "histogram")
 		field, didWeAddMissing := cw.addMissingParameterIfPresent(field, histogram)
-		if !didWeAddMissing {
+		if !didWeAddMissing || hardBounds != bucket_aggregations.NoHistogramBounds {
+			// keys outside of hard_bounds are NULL, so we need to filter them out, even if we added missing
 			aggregation.filterOutEmptyKeyBucket = true
 		}
 
-		var col model.Expr
-		if interval != 1.0 {
-			// col as string is: fmt.Sprintf("floor(%s / %f) * %f", fieldNameProperlyQuoted, interval, interval)
-			col = model.NewInfixExpr(
-				model.NewFunction("floor", model.NewInfixExpr(field, "/", model.NewLiteral(interval))),
-				"*",
-				model.NewLiteral(interval),
-			)
-		} else {
-			col = field
-		}
-
+		col := histogramAggr.SqlKey(field)
 		aggregation.selectedColumns = append(aggregation.selectedColumns, col)
 		aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExprWithoutOrder(col))
 
@@ -105,8 +103,13 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		}
 
 		minDocCount := cw.parseMinDocCount(dateHistogram)
-		timezone := cw.parseStringField(dateHistogram, "time_zone", "")
+		timezone := cw.parseTimeZone(dateHistogram)
 		interval, intervalType := cw.extractInterval(dateHistogram)
+		offset, err := cw.parseDateHistogramOffset(dateHistogram)
+		if err != nil {
+			return false, err
+		}
+		format := cw.parseStringField(dateHistogram, "format", "")
 		// TODO  GetDateTimeTypeFromExpr can be moved and it should take cw.Schema as an argument
 		dateTimeType := cw.Table.GetDateTimeTypeFromExpr(cw.Ctx, field)
 
@@ -115,7 +118,7 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		}
 
 		dateHistogramAggr := bucket_aggregations.NewDateHistogram(
-			cw.Ctx, field, interval, timezone, minDocCount, ebMin, ebMax, intervalType, dateTimeType)
+			cw.Ctx, field, interval, timezone, offset, format, minDocCount, ebMin, ebMax, intervalType, dateTimeType)
 		aggregation.queryType = dateHistogramAggr
 
 		sqlQuery := dateHistogramAggr.GenerateSQL()
@@ -125,6 +128,17 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		delete(queryMap, "date_histogram")
 		return success, nil
 	}
+	if compositeRaw, ok := queryMap["composite"]; ok {
+		composite, ok := compositeRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("composite is not a map, but %T, value: %v", compositeRaw, compositeRaw)
+		}
+		if err = cw.parseComposite(aggregation, composite); err != nil {
+			return false, err
+		}
+		delete(queryMap, "composite")
+		return success, nil
+	}
 	if autoDateHistogram := cw.parseAutoDateHistogram(queryMap["auto_date_histogram"]); autoDateHistogram != nil {
 		aggregation.queryType = autoDateHistogram
 		delete(queryMap, "auto_date_histogram")
@@ -149,7 +163,17 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		const defaultSize = 10
 		size := cw.parseSize(terms, defaultSize)
 		orderBy := cw.parseOrder(terms, queryMap, []model.Expr{fieldExpression})
-		aggregation.queryType = bucket_aggregations.NewTerms(cw.Ctx, termsType == "significant_terms", orderBy[0]) // TODO probably full, not [0]
+		if termsType == "significant_terms" {
+			background, err := cw.parseSignificantTermsBackground(terms, size)
+			if err != nil {
+				return false, err
+			}
+			aggregation.queryType = bucket_aggregations.NewSignificantTerms(cw.Ctx, orderBy[0], background)
+			// we fetch more candidates than `size`, as buckets are sorted by score, not by doc_count
+			size = cw.parseIntField(terms, "shard_size", size*3/2+10)
+		} else {
+			aggregation.queryType = bucket_aggregations.NewTerms(cw.Ctx, false, orderBy[0]) // TODO probably full, not [0]
+		}
 		aggregation.selectedColumns = append(aggregation.selectedColumns, fieldExpression)
 		aggregation.limit = size
 		aggregation.orderBy = orderBy
@@ -157,6 +181,17 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		delete(queryMap, termsType)
 		return success, nil
 	}
+	if rareTermsRaw, ok := queryMap["rare_terms"]; ok {
+		rareTerms, ok := rareTermsRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("rare_terms is not a map, but %T, value: %v", rareTermsRaw, rareTermsRaw)
+		}
+		if err = cw.parseRareTerms(aggregation, rareTerms); err != nil {
+			return false, err
+		}
+		delete(queryMap, "rare_terms")
+		return success, nil
+	}
 	if multiTermsRaw, exists := queryMap["multi_terms"]; exists {
 		multiTerms, ok := multiTermsRaw.(QueryMap)
 		if !ok {
@@ -232,6 +267,31 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		delete(queryMap, "date_range")
 		return success, nil
 	}
+	if ipRangeRaw, ok := queryMap["ip_range"]; ok {
+		ipRange, ok := ipRangeRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("ip_range is not a map, but %T, value: %v", ipRangeRaw, ipRangeRaw)
+		}
+		ipRangeParsed, err := cw.parseIpRangeAggregation(ipRange)
+		if err != nil {
+			return false, err
+		}
+		aggregation.queryType = ipRangeParsed
+		aggregation.isKeyed = ipRangeParsed.Keyed
+		delete(queryMap, "ip_range")
+		return success, nil
+	}
+	if ipPrefixRaw, ok := queryMap["ip_prefix"]; ok {
+		ipPrefix, ok := ipPrefixRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("ip_prefix is not a map, but %T, value: %v", ipPrefixRaw, ipPrefixRaw)
+		}
+		if err = cw.parseIpPrefix(aggregation, ipPrefix); err != nil {
+			return false, err
+		}
+		delete(queryMap, "ip_prefix")
+		return success, nil
+	}
 	if geoTileGridRaw, ok := queryMap["geotile_grid"]; ok {
 		geoTileGrid, ok := geoTileGridRaw.(QueryMap)
 		if !ok {
@@ -299,6 +359,35 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		delete(queryMap, "geotile_grid")
 		return success, err
 	}
+	if geoDistanceRaw, ok := queryMap["geo_distance"]; ok {
+		geoDistance, ok := geoDistanceRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("geo_distance is not a map, but %T, value: %v", geoDistanceRaw, geoDistanceRaw)
+		}
+		geoDistanceParsed, err := cw.parseGeoDistanceAggregation(geoDistance)
+		if err != nil {
+			return false, err
+		}
+		aggregation.queryType = geoDistanceParsed
+		aggregation.isKeyed = geoDistanceParsed.Keyed
+		delete(queryMap, "geo_distance")
+		return success, nil
+	}
+	for _, geoGridType := range []string{"geohash_grid", "geohex_grid"} {
+		geoGridRaw, ok := queryMap[geoGridType]
+		if !ok {
+			continue
+		}
+		geoGrid, ok := geoGridRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("%s is not a map, but %T, value: %v", geoGridType, geoGridRaw, geoGridRaw)
+		}
+		if err = cw.parseGeoGrid(aggregation, geoGrid, geoGridType); err != nil {
+			return false, err
+		}
+		delete(queryMap, geoGridType)
+		return success, nil
+	}
 	if sampler, ok := queryMap["sampler"]; ok {
 		aggregation.queryType = cw.parseSampler(sampler)
 		delete(queryMap, "sampler")
@@ -309,6 +398,60 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 		delete(queryMap, "random_sampler")
 		return
 	}
+	if missingRaw, ok := queryMap["missing"]; ok {
+		missing, ok := missingRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("missing is not a map, but %T, value: %v", missingRaw, missingRaw)
+		}
+		field := cw.parseFieldField(missing, "missing")
+		if field == nil {
+			return false, fmt.Errorf("no field in missing aggregation: %v", missing)
+		}
+		// missing is just a filter bucket of documents without a value
+		aggregation.queryType = bucket_aggregations.NewFilterAgg(cw.Ctx, model.NewInfixExpr(field, "IS", model.NewLiteral("NULL")))
+		delete(queryMap, "missing")
+		return
+	}
+	if _, ok := queryMap["global"]; ok {
+		aggregation.queryType = bucket_aggregations.NewGlobal(cw.Ctx)
+		delete(queryMap, "global")
+		return
+	}
+	if nestedRaw, ok := queryMap["nested"]; ok {
+		nested, ok := nestedRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("nested is not a map, but %T, value: %v", nestedRaw, nestedRaw)
+		}
+		path := cw.parseStringField(nested, "path", "")
+		if path == "" {
+			return false, fmt.Errorf("no path in nested aggregation: %v", nested)
+		}
+		aggregation.queryType = bucket_aggregations.NewNested(cw.Ctx, path, cw.nestedFieldsInternalNames(path))
+		delete(queryMap, "nested")
+		return success, nil
+	}
+	if reverseNestedRaw, ok := queryMap["reverse_nested"]; ok {
+		if reverseNested, ok := reverseNestedRaw.(QueryMap); ok && cw.parseStringField(reverseNested, "path", "") != "" {
+			// we only join back to the root document, not to an intermediate nested object
+			logger.WarnWithCtx(cw.Ctx).Msgf("path in reverse_nested aggregation is not supported, ignoring it: %v", reverseNested)
+		}
+		aggregation.queryType = bucket_aggregations.NewReverseNested(cw.Ctx)
+		delete(queryMap, "reverse_nested")
+		return
+	}
+	if adjacencyMatrixRaw, ok := queryMap["adjacency_matrix"]; ok {
+		adjacencyMatrix, ok := adjacencyMatrixRaw.(QueryMap)
+		if !ok {
+			return false, fmt.Errorf("adjacency_matrix is not a map, but %T, value: %v", adjacencyMatrixRaw, adjacencyMatrixRaw)
+		}
+		adjacencyMatrixParsed, err := cw.parseAdjacencyMatrix(adjacencyMatrix)
+		if err != nil {
+			return false, err
+		}
+		aggregation.queryType = adjacencyMatrixParsed
+		delete(queryMap, "adjacency_matrix")
+		return success, nil
+	}
 	if isFilters, filterAggregation := cw.parseFilters(queryMap); isFilters {
 		sort.Slice(filterAggregation.Filters, func(i, j int) bool { // stable order is required for tests and caching
 			return filterAggregation.Filters[i].Name < filterAggregation.Filters[j].Name
@@ -322,6 +465,98 @@ func (cw *ClickhouseQueryTranslator) pancakeTryBucketAggregation(aggregation *pa
 	return
 }
 
+// nestedFieldsInternalNames returns internal names of all fields of nested objects under given path, sorted
+func (cw *ClickhouseQueryTranslator) nestedFieldsInternalNames(path string) []string {
+	var fields []string
+	for _, field := range cw.Schema.Fields {
+		if strings.HasPrefix(field.PropertyName.AsString(), path+".") {
+			fields = append(fields, field.InternalPropertyName.AsString())
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// parseRareTerms sets everything needed for rare_terms aggregation in the tree node: its query type, selected column, etc.
+// Buckets are sorted by doc_count (ascending), then by key, just like in Elastic.
+func (cw *ClickhouseQueryTranslator) parseRareTerms(aggregation *pancakeAggregationTreeNode, rareTerms QueryMap) error {
+	field := cw.parseFieldField(rareTerms, "rare_terms")
+	if field == nil {
+		return fmt.Errorf("no field in rare_terms aggregation: %v", rareTerms)
+	}
+	field, didWeAddMissing := cw.addMissingParameterIfPresent(field, rareTerms)
+	if !didWeAddMissing {
+		aggregation.filterOutEmptyKeyBucket = true
+	}
+	maxDocCount := cw.parseIntField(rareTerms, "max_doc_count", bucket_aggregations.RareTermsDefaultMaxDocCount)
+	if maxDocCount < 1 || maxDocCount > bucket_aggregations.RareTermsMaxMaxDocCount {
+		return fmt.Errorf("max_doc_count in rare_terms must be in [1, %d], got: %d", bucket_aggregations.RareTermsMaxMaxDocCount, maxDocCount)
+	}
+	for _, unsupported := range []string{"include", "exclude"} {
+		if _, exists := rareTerms[unsupported]; exists {
+			logger.WarnWithCtx(cw.Ctx).Msgf("%s in rare_terms aggregation is not supported, ignoring it", unsupported)
+		}
+	}
+
+	aggregation.queryType = bucket_aggregations.NewRareTerms(cw.Ctx, maxDocCount)
+	aggregation.selectedColumns = append(aggregation.selectedColumns, field)
+	aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExpr(model.NewCountFunc(), model.AscOrder),
+		model.NewOrderByExpr(field, model.AscOrder))
+	return nil
+}
+
+// parseSignificantTermsBackground parses parameters of significant_terms, which are needed to score its buckets:
+// significance heuristic (jlh by default), min_doc_count and background_filter.
+func (cw *ClickhouseQueryTranslator) parseSignificantTermsBackground(significantTerms QueryMap, size int) (*bucket_aggregations.SignificantTermsBackground, error) {
+	const defaultMinDocCount = 3
+
+	var heuristic bucket_aggregations.SignificanceHeuristic = bucket_aggregations.JLH{}
+	for _, heuristicName := range []string{"jlh", "chi_square", "gnd", "mutual_information", "percentage"} {
+		paramsRaw, exists := significantTerms[heuristicName]
+		if !exists {
+			continue
+		}
+		params, ok := paramsRaw.(QueryMap)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a map, but %T, value: %v", heuristicName, paramsRaw, paramsRaw)
+		}
+		includeNegatives, _ := params["include_negatives"].(bool)
+		backgroundIsSuperset := true
+		if value, ok := params["background_is_superset"].(bool); ok {
+			backgroundIsSuperset = value
+		}
+		switch heuristicName {
+		case "chi_square":
+			heuristic = bucket_aggregations.ChiSquare{IncludeNegatives: includeNegatives, BackgroundIsSuperset: backgroundIsSuperset}
+		case "gnd":
+			heuristic = bucket_aggregations.GND{BackgroundIsSuperset: backgroundIsSuperset}
+		case "mutual_information":
+			heuristic = bucket_aggregations.MutualInformation{IncludeNegatives: includeNegatives, BackgroundIsSuperset: backgroundIsSuperset}
+		case "percentage":
+			heuristic = bucket_aggregations.Percentage{}
+		}
+	}
+	if _, exists := significantTerms["script_heuristic"]; exists {
+		return nil, fmt.Errorf("script_heuristic is not supported in significant_terms")
+	}
+
+	var backgroundFilter model.Expr
+	if backgroundFilterRaw, exists := significantTerms["background_filter"]; exists {
+		backgroundFilterMap, ok := backgroundFilterRaw.(QueryMap)
+		if !ok {
+			return nil, fmt.Errorf("background_filter is not a map, but %T, value: %v", backgroundFilterRaw, backgroundFilterRaw)
+		}
+		simpleQuery := cw.parseQueryMap(backgroundFilterMap)
+		if !simpleQuery.CanParse {
+			return nil, fmt.Errorf("cannot parse background_filter: %v", backgroundFilterMap)
+		}
+		backgroundFilter = simpleQuery.WhereClause
+	}
+
+	minDocCount := cw.parseIntField(significantTerms, "min_doc_count", defaultMinDocCount)
+	return bucket_aggregations.NewSignificantTermsBackground(cw.Ctx, heuristic, size, minDocCount, backgroundFilter), nil
+}
+
 // samplerRaw - in a proper request should be of QueryMap type.
 func (cw *ClickhouseQueryTranslator) parseSampler(samplerRaw any) bucket_aggregations.Sampler {
 	const defaultSize = 100
@@ -365,6 +600,164 @@ func (cw *ClickhouseQueryTranslator) parseAutoDateHistogram(paramsRaw any) *buck
 	return bucket_aggregations.NewAutoDateHistogram(cw.Ctx, field, bucketsNr)
 }
 
+// parseComposite sets up composite aggregation: its sources are GROUP BY columns, sorted by them,
+// and the page condition (without nulls, after `after`) is kept in Composite, to be added to the WHERE clause later.
+func (cw *ClickhouseQueryTranslator) parseComposite(aggregation *pancakeAggregationTreeNode, composite QueryMap) error {
+	const defaultSize = 10
+	sourcesRaw, ok := composite["sources"].([]any)
+	if !ok || len(sourcesRaw) == 0 {
+		return fmt.Errorf("composite sources must be a non-empty array, got: %v", composite["sources"])
+	}
+
+	sources := make([]*bucket_aggregations.CompositeSource, 0, len(sourcesRaw))
+	whereClauses := make([]model.Expr, 0, len(sourcesRaw)+1)
+	for _, sourceRaw := range sourcesRaw {
+		source, err := cw.parseCompositeSource(sourceRaw)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source)
+		whereClauses = append(whereClauses, model.NewInfixExpr(source.Field, "IS", model.NewLiteral("NOT NULL")))
+	}
+
+	if afterRaw, exists := composite["after"]; exists {
+		after, ok := afterRaw.(QueryMap)
+		if !ok {
+			return fmt.Errorf("composite after is not a map, but %T, value: %v", afterRaw, afterRaw)
+		}
+		afterCondition, err := cw.compositeAfterCondition(sources, after)
+		if err != nil {
+			return err
+		}
+		whereClauses = append(whereClauses, afterCondition)
+	}
+
+	size := cw.parseSize(composite, defaultSize)
+	aggregation.queryType = bucket_aggregations.NewComposite(cw.Ctx, size, sources, model.And(whereClauses))
+	for _, source := range sources {
+		aggregation.selectedColumns = append(aggregation.selectedColumns, source.Expr)
+		aggregation.orderBy = append(aggregation.orderBy, model.NewOrderByExpr(source.Expr, source.Direction))
+	}
+	aggregation.limit = size
+	return nil
+}
+
+// parseCompositeSource parses a single source, e.g. {"name": {"terms": {"field": "host.name"}}}
+func (cw *ClickhouseQueryTranslator) parseCompositeSource(sourceRaw any) (*bucket_aggregations.CompositeSource, error) {
+	source, ok := sourceRaw.(QueryMap)
+	if !ok || len(source) != 1 {
+		return nil, fmt.Errorf("composite source must be a map with a single key, got: %v", sourceRaw)
+	}
+	for name, valuesSourceRaw := range source {
+		valuesSource, ok := valuesSourceRaw.(QueryMap)
+		if !ok || len(valuesSource) != 1 {
+			return nil, fmt.Errorf("composite source %s must be a map with a single key, got: %v", name, valuesSourceRaw)
+		}
+		for sourceType, paramsRaw := range valuesSource {
+			params, ok := paramsRaw.(QueryMap)
+			if !ok {
+				return nil, fmt.Errorf("composite source %s is not a map, but %T, value: %v", name, paramsRaw, paramsRaw)
+			}
+			if missingBucket, _ := params["missing_bucket"].(bool); missingBucket {
+				return nil, fmt.Errorf("missing_bucket is not supported (composite source %s)", name)
+			}
+			direction := model.AscOrder
+			if strings.ToLower(cw.parseStringField(params, "order", "asc")) == "desc" {
+				direction = model.DescOrder
+			}
+			field := cw.parseFieldField(params, sourceType)
+			if field == nil {
+				return nil, fmt.Errorf("field not found in composite source %s", name)
+			}
+
+			switch sourceType {
+			case "terms":
+				return bucket_aggregations.NewCompositeSource(name, field, field, direction), nil
+			case "histogram":
+				interval := cw.parseFloatField(params, "interval", 1.0)
+				if interval <= 0 {
+					return nil, fmt.Errorf("interval of composite source %s must be positive, got: %v", name, params["interval"])
+				}
+				key := field
+				if interval != 1.0 {
+					key = model.NewInfixExpr(
+						model.NewFunction("floor", model.NewInfixExpr(field, "/", model.NewLiteral(interval))),
+						"*",
+						model.NewLiteral(interval),
+					)
+				}
+				return bucket_aggregations.NewCompositeSource(name, field, key, direction), nil
+			case "date_histogram":
+				interval, intervalType := cw.extractInterval(params)
+				timezone := cw.parseTimeZone(params)
+				offset, err := cw.parseDateHistogramOffset(params)
+				if err != nil {
+					return nil, err
+				}
+				format := cw.parseStringField(params, "format", "")
+				dateHistogram := bucket_aggregations.NewDateHistogram(cw.Ctx, field, interval, timezone, offset, format,
+					bucket_aggregations.DefaultMinDocCount, bucket_aggregations.NoExtendedBound, bucket_aggregations.NoExtendedBound,
+					intervalType, cw.Table.GetDateTimeTypeFromExpr(cw.Ctx, field))
+				return bucket_aggregations.NewCompositeDateHistogramSource(name, dateHistogram, direction), nil
+			default:
+				return nil, fmt.Errorf("unsupported composite source type: %s (source %s)", sourceType, name)
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid composite source: %v", sourceRaw)
+}
+
+// compositeAfterCondition returns a condition selecting buckets after `after` (in sources' order).
+// If all sources have the same order it's a tuple comparison, e.g. tuple(a, b) > tuple(a0, b0),
+// otherwise it's expanded, e.g. a > a0 OR (a = a0 AND b < b0).
+func (cw *ClickhouseQueryTranslator) compositeAfterCondition(sources []*bucket_aggregations.CompositeSource, after QueryMap) (model.Expr, error) {
+	if len(after) != len(sources) {
+		return nil, fmt.Errorf("composite after must have a value for each of %d source(s), got: %v", len(sources), after)
+	}
+	keys := make([]model.Expr, 0, len(sources))
+	values := make([]model.Expr, 0, len(sources))
+	sameDirection := true
+	for _, source := range sources {
+		afterValue, exists := after[source.Name]
+		if !exists {
+			return nil, fmt.Errorf("composite after has no value for source %s: %v", source.Name, after)
+		}
+		originalKey, err := source.OriginalKey(afterValue)
+		if err != nil {
+			return nil, err
+		}
+		switch originalKey.(type) {
+		case string, bool, float64, int64:
+		default:
+			return nil, fmt.Errorf("unsupported composite after value of source %s: %v (%T)", source.Name, afterValue, afterValue)
+		}
+		keys = append(keys, source.Expr)
+		values = append(values, model.NewLiteral(sprint(originalKey)))
+		sameDirection = sameDirection && source.Direction == sources[0].Direction
+	}
+
+	operator := func(source *bucket_aggregations.CompositeSource) string {
+		if source.Direction == model.DescOrder {
+			return "<"
+		}
+		return ">"
+	}
+	if len(sources) == 1 {
+		return model.NewInfixExpr(keys[0], operator(sources[0]), values[0]), nil
+	}
+	if sameDirection {
+		return model.NewInfixExpr(model.NewFunction("tuple", keys...), operator(sources[0]), model.NewFunction("tuple", values...)), nil
+	}
+
+	var alternatives, equalities []model.Expr
+	for i, source := range sources {
+		comparison := model.NewInfixExpr(keys[i], operator(source), values[i])
+		alternatives = append(alternatives, model.And(append(equalities[:len(equalities):len(equalities)], comparison)))
+		equalities = append(equalities, model.NewInfixExpr(keys[i], "=", values[i]))
+	}
+	return model.Or(alternatives), nil
+}
+
 func (cw *ClickhouseQueryTranslator) parseOrder(terms, queryMap QueryMap, fieldExpressions []model.Expr) []model.OrderByExpr {
 	defaultDirection := model.DescOrder
 	defaultOrderBy := model.NewOrderByExpr(model.NewCountFunc(), defaultDirection)
@@ -445,3 +838,37 @@ func (cw *ClickhouseQueryTranslator) addMissingParameterIfPresent(field model.Ex
 
 	return model.NewFunction("COALESCE", field, value), true
 }
+
+// parseHistogramBounds parses histogram's extended_bounds or hard_bounds: {"min": x, "max": y}, both optional
+func (cw *ClickhouseQueryTranslator) parseHistogramBounds(histogram QueryMap, boundsName string) bucket_aggregations.HistogramBounds {
+	bounds := bucket_aggregations.NoHistogramBounds
+	boundsRaw, exists := histogram[boundsName]
+	if !exists {
+		return bounds
+	}
+	boundsMap, ok := boundsRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("%s in histogram is not a map, but %T, value: %v. Ignoring it.", boundsName, boundsRaw, boundsRaw)
+		return bounds
+	}
+	bounds.Min = cw.parseFloatField(boundsMap, "min", bounds.Min)
+	bounds.Max = cw.parseFloatField(boundsMap, "max", bounds.Max)
+	return bounds
+}
+
+// parseDateHistogramOffset returns date_histogram's offset (e.g. "+6h", "-1d") in milliseconds, 0 if it's not present
+func (cw *ClickhouseQueryTranslator) parseDateHistogramOffset(dateHistogram QueryMap) (int64, error) {
+	offsetRaw, exists := dateHistogram["offset"]
+	if !exists {
+		return 0, nil
+	}
+	offsetAsString, ok := offsetRaw.(string)
+	if !ok {
+		return 0, fmt.Errorf("offset of date_histogram is not a string, but %T, value: %v", offsetRaw, offsetRaw)
+	}
+	offset, err := kibana.ParseOffset(offsetAsString)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset of date_histogram: %s, err: %v", offsetAsString, err)
+	}
+	return offset.Milliseconds(), nil
+}
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"quesma/logger"
 	"quesma/model"
+	"quesma/model/bucket_aggregations"
 	"quesma/model/metrics_aggregations"
 	"quesma/util"
 	"strconv"
+	"strings"
 )
 
 func generateMetricSelectedColumns(ctx context.Context, metricsAggr metricsAggregation) (result []model.Expr, err error) {
@@ -118,6 +120,61 @@ func generateMetricSelectedColumns(ctx context.Context, metricsAggr metricsAggre
 			result = append(result, model.NewFunction("avgOrNull", castLon))
 			result = append(result, model.NewCountFunc())
 		}
+	case "geo_bounds":
+		lat, lon, err := geoLatLon(getFirstExpression())
+		if err != nil {
+			return nil, err
+		}
+		lat, lon = model.NewFunction("toFloat64", lat), model.NewFunction("toFloat64", lon)
+		isLonNonNegative := model.NewInfixExpr(lon, ">=", model.NewLiteral(0))
+		isLonNegative := model.NewInfixExpr(lon, "<", model.NewLiteral(0))
+		result = []model.Expr{
+			model.NewFunction("maxOrNull", lat),
+			model.NewFunction("minOrNull", lat),
+			model.NewFunction("minOrNullIf", lon, isLonNonNegative),
+			model.NewFunction("maxOrNullIf", lon, isLonNonNegative),
+			model.NewFunction("minOrNullIf", lon, isLonNegative),
+			model.NewFunction("maxOrNullIf", lon, isLonNegative),
+		}
+	case "weighted_avg":
+		if len(metricsAggr.Fields) != 2 {
+			return nil, fmt.Errorf("weighted_avg needs value and weight, got: %v", metricsAggr.Fields)
+		}
+		result = []model.Expr{model.NewFunction("avgWeightedOrNull", metricsAggr.Fields[0], metricsAggr.Fields[1])}
+	case "boxplot":
+		// like in Elastic, everything is computed from a t-digest, so memory is bounded, whatever the number of values.
+		// Quartiles and whiskers are computed from digest's quantiles in Boxplot.
+		expr := getFirstExpression()
+		result = []model.Expr{model.NewFunction("minOrNull", expr), model.NewFunction("maxOrNull", expr), digestQuantiles(expr)}
+	case "median_absolute_deviation":
+		// computed from digest's quantiles in MedianAbsoluteDeviation
+		result = []model.Expr{digestQuantiles(getFirstExpression())}
+	case "string_stats":
+		expr := getFirstExpression()
+		length := model.NewFunction("lengthUTF8", expr)
+		nonNullExpr := model.NewFunction("COALESCE", expr, model.NewLiteral("''"))
+		// sumMap(characters, [1, 1, ...]) = (characters, their numbers of occurrences)
+		charOccurrences := model.NewFunction("sumMap", model.NewFunction("ngrams", nonNullExpr, model.NewLiteral(1)),
+			model.NewFunction("arrayWithConstant", model.NewFunction("lengthUTF8", nonNullExpr), model.NewLiteral(1)))
+		result = []model.Expr{
+			model.NewCountFunc(expr),
+			model.NewFunction("minOrNull", length),
+			model.NewFunction("maxOrNull", length),
+			model.NewFunction("avgOrNull", length),
+			charOccurrences,
+		}
+	case "rate":
+		switch {
+		case len(metricsAggr.Fields) == 0:
+			result = []model.Expr{model.NewCountFunc()}
+		case metricsAggr.rateMode == "value_count":
+			result = []model.Expr{model.NewCountFunc(getFirstExpression())}
+		default:
+			result = []model.Expr{model.NewFunction("sumOrNull", getFirstExpression())}
+		}
+	case "variable_width_histogram":
+		// histogram(buckets)(x), like quantiles above
+		result = []model.Expr{model.FunctionExpr{Name: fmt.Sprintf("histogram(%d)", metricsAggr.buckets), Args: []model.Expr{getFirstExpression()}}}
 	default:
 		logger.WarnWithCtx(ctx).Msgf("unknown metrics aggregation: %s", metricsAggr.AggrType)
 		return nil, fmt.Errorf("unknown metrics aggregation %s", metricsAggr.AggrType)
@@ -153,6 +210,30 @@ func generateMetricsType(ctx context.Context, metricsAggr metricsAggregation) mo
 		return metrics_aggregations.NewPercentileRanks(ctx, metricsAggr.CutValues, metricsAggr.Keyed)
 	case "geo_centroid":
 		return metrics_aggregations.NewGeoCentroid(ctx)
+	case "geo_bounds":
+		return metrics_aggregations.NewGeoBounds(ctx, metricsAggr.wrapLongitude)
+	case "weighted_avg":
+		return metrics_aggregations.NewWeightedAvg(ctx)
+	case "boxplot":
+		return metrics_aggregations.NewBoxplot(ctx)
+	case "median_absolute_deviation":
+		return metrics_aggregations.NewMedianAbsoluteDeviation(ctx)
+	case "string_stats":
+		return metrics_aggregations.NewStringStats(ctx, metricsAggr.showDistribution)
+	case "rate":
+		return metrics_aggregations.NewRate(ctx, metricsAggr.rateUnit)
+	case "variable_width_histogram":
+		return bucket_aggregations.NewVariableWidthHistogram(ctx)
 	}
 	return nil
 }
+
+// digestQuantiles returns quantilesTDigest(0, 0.01, ..., 1)(expr): an array of values, which approximates
+// distribution of expr with bounded memory (unlike groupArray(expr))
+func digestQuantiles(expr model.Expr) model.Expr {
+	levels := make([]string, 0, metrics_aggregations.DigestQuantilesCount+1)
+	for i := 0; i <= metrics_aggregations.DigestQuantilesCount; i++ {
+		levels = append(levels, strconv.FormatFloat(float64(i)/metrics_aggregations.DigestQuantilesCount, 'f', -1, 64))
+	}
+	return model.FunctionExpr{Name: fmt.Sprintf("quantilesTDigest(%s)", strings.Join(levels, ",")), Args: []model.Expr{expr}}
+}
@@ -9,6 +9,7 @@ import (
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
 	"quesma/model/metrics_aggregations"
+	"quesma/model/pipeline_aggregations"
 	"quesma/util"
 	"strconv"
 	"strings"
@@ -169,10 +170,57 @@ func (p *pancakeJSONRenderer) potentiallyRemoveExtraBucket(layer *pancakeModelLa
 	return bucketRows, subAggrRows
 }
 
+// significant_terms skips insignificant buckets and sorts the rest by score, so rows (and their subaggregations) need the same order
+func (p *pancakeJSONRenderer) potentiallyReorderSignificantBuckets(layer *pancakeModelLayer, bucketRows []model.QueryResultRow,
+	subAggrRows [][]model.QueryResultRow) ([]model.QueryResultRow, [][]model.QueryResultRow) {
+	terms, isTerms := layer.nextBucketAggregation.queryType.(bucket_aggregations.Terms)
+	if !isTerms {
+		return bucketRows, subAggrRows
+	}
+	order, reordered := terms.SignificantBucketsOrder(bucketRows)
+	if !reordered {
+		return bucketRows, subAggrRows
+	}
+	newBucketRows := make([]model.QueryResultRow, 0, len(order))
+	newSubAggrRows := make([][]model.QueryResultRow, 0, len(order))
+	for _, rowIdx := range order {
+		newBucketRows = append(newBucketRows, bucketRows[rowIdx])
+		newSubAggrRows = append(newSubAggrRows, subAggrRows[rowIdx])
+	}
+	return newBucketRows, newSubAggrRows
+}
+
+// rare_terms' doc_count condition isn't in SQL, if there's a combinator (e.g. filters) above it, so we need to check it here
+// potentiallyRemoveBucketsByDocCount removes buckets, which don't satisfy aggregation's doc_count condition:
+// too frequent ones for rare_terms, or ones with doc_count < min_doc_count for histogram.
+func (p *pancakeJSONRenderer) potentiallyRemoveBucketsByDocCount(layer *pancakeModelLayer, bucketRows []model.QueryResultRow,
+	subAggrRows [][]model.QueryResultRow) ([]model.QueryResultRow, [][]model.QueryResultRow) {
+	var keepBucket func(docCount any) bool
+	switch queryType := layer.nextBucketAggregation.queryType.(type) {
+	case bucket_aggregations.RareTerms:
+		keepBucket = queryType.IsRare
+	case *bucket_aggregations.Histogram:
+		keepBucket = queryType.HasEnoughDocs
+	default:
+		return bucketRows, subAggrRows
+	}
+	newBucketRows := make([]model.QueryResultRow, 0, len(bucketRows))
+	newSubAggrRows := make([][]model.QueryResultRow, 0, len(subAggrRows))
+	for i, row := range bucketRows {
+		if docCount, found := p.valueForColumn([]model.QueryResultRow{row}, layer.nextBucketAggregation.InternalNameForCount()); found && !keepBucket(docCount) {
+			continue
+		}
+		newBucketRows = append(newBucketRows, row)
+		newSubAggrRows = append(newSubAggrRows, subAggrRows[i])
+	}
+	return newBucketRows, newSubAggrRows
+}
+
 func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeModelLayer, rows []model.QueryResultRow) (model.JsonMap, error) {
 	layer := remainingLayers[0]
 	switch queryType := layer.nextBucketAggregation.queryType.(type) {
-	case bucket_aggregations.SamplerInterface, bucket_aggregations.FilterAgg:
+	case bucket_aggregations.SamplerInterface, bucket_aggregations.FilterAgg, bucket_aggregations.Global,
+		bucket_aggregations.Nested, bucket_aggregations.ReverseNested:
 		selectedRows := p.selectMetricRows(layer.nextBucketAggregation.InternalNameForCount(), rows)
 		aggJson := layer.nextBucketAggregation.queryType.TranslateSqlResponseToJson(selectedRows)
 		subAggr, err := p.layerToJSON(remainingLayers[1:], rows)
@@ -181,18 +229,21 @@ func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeM
 		}
 		return util.MergeMaps(p.ctx, aggJson, subAggr), nil
 	case bucket_aggregations.CombinatorAggregationInterface:
-		var bucketArray []model.JsonMap
+		bucketArray := make([]model.JsonMap, 0)
 		for _, subGroup := range queryType.CombinatorGroups() {
 			selectedRowsWithoutPrefix := p.selectPrefixRows(subGroup.Prefix, rows)
 
+			selectedRows := p.selectMetricRows(layer.nextBucketAggregation.InternalNameForCount(), selectedRowsWithoutPrefix)
+			aggJson := queryType.CombinatorTranslateSqlResponseToJson(subGroup, selectedRows)
+			if aggJson == nil { // bucket is omitted, e.g. empty bucket of adjacency_matrix
+				continue
+			}
+
 			subAggr, err := p.layerToJSON(remainingLayers[1:], selectedRowsWithoutPrefix)
 			if err != nil {
 				return nil, err
 			}
 
-			selectedRows := p.selectMetricRows(layer.nextBucketAggregation.InternalNameForCount(), selectedRowsWithoutPrefix)
-			aggJson := queryType.CombinatorTranslateSqlResponseToJson(subGroup, selectedRows)
-
 			bucketArray = append(bucketArray, util.MergeMaps(p.ctx, aggJson, subAggr))
 			bucketArray[len(bucketArray)-1]["key"] = subGroup.Key
 		}
@@ -200,14 +251,9 @@ func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeM
 		if !layer.nextBucketAggregation.isKeyed {
 			bucketsJson = bucketArray
 		} else {
-			buckets := model.JsonMap{}
-			for _, bucket := range bucketArray {
-				if key, ok := bucket["key"]; ok {
-					delete(bucket, "key")
-					buckets[key.(string)] = bucket
-				} else {
-					return nil, fmt.Errorf("no key in bucket json, layer: %s", layer.nextBucketAggregation.name)
-				}
+			buckets, err := p.keyedBuckets(layer, bucketArray)
+			if err != nil {
+				return nil, err
 			}
 			bucketsJson = buckets
 		}
@@ -219,6 +265,20 @@ func (p *pancakeJSONRenderer) combinatorBucketToJSON(remainingLayers []*pancakeM
 	}
 }
 
+// keyedBuckets converts an array of buckets into a map: bucket's key -> bucket (without the key), as returned for `keyed: true`
+func (p *pancakeJSONRenderer) keyedBuckets(layer *pancakeModelLayer, bucketArray []model.JsonMap) (model.JsonMap, error) {
+	buckets := make(model.JsonMap, len(bucketArray))
+	for _, bucket := range bucketArray {
+		key, ok := bucket["key"]
+		if !ok {
+			return nil, fmt.Errorf("no key in bucket json, layer: %s", layer.nextBucketAggregation.name)
+		}
+		delete(bucket, "key")
+		buckets[fmt.Sprintf("%v", key)] = bucket
+	}
+	return buckets, nil
+}
+
 func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer, rows []model.QueryResultRow) (model.JsonMap, error) {
 	result := model.JsonMap{}
 	if len(remainingLayers) == 0 {
@@ -241,8 +301,13 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 		// TODO: maybe add metadata also here? probably not needed
 	}
 
+	var nextLayer *pancakeModelLayer
+	if len(remainingLayers) > 1 {
+		nextLayer = remainingLayers[1]
+	}
+
 	// pipeline aggregations of metric type behave just like metric
-	for metricPipelineAggrName, metricPipelineAggrResult := range p.pipeline.currentPipelineMetricAggregations(layer, rows) {
+	for metricPipelineAggrName, metricPipelineAggrResult := range p.pipeline.currentPipelineMetricAggregations(layer, nextLayer, rows) {
 		result[metricPipelineAggrName] = metricPipelineAggrResult
 		// TODO: maybe add metadata also here? probably not needed
 	}
@@ -261,15 +326,14 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 			return result, nil
 		}
 
-		hasSubaggregations := len(remainingLayers) > 1
-		var nextLayer *pancakeModelLayer
+		hasSubaggregations := nextLayer != nil
 		if hasSubaggregations {
 			// If we have pipeline parent aggregation, we need to *always* set min_doc_count to 0 in the parent bucket aggregation
 			// Important to do that early, before processing it after this if.
-			nextLayer = remainingLayers[1]
 			anyPipelineParentAggregation := false
 			for _, pipeline := range nextLayer.childrenPipelineAggregations {
-				if pipeline.queryType.PipelineAggregationType() == model.PipelineParentAggregation {
+				_, isBucketsModifier := pipeline.queryType.(pipeline_aggregations.BucketsModifierInterface)
+				if pipeline.queryType.PipelineAggregationType() == model.PipelineParentAggregation && !isBucketsModifier {
 					anyPipelineParentAggregation = true
 					break
 				}
@@ -286,6 +350,8 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 
 		bucketRows, subAggrRows := p.splitBucketRows(layer.nextBucketAggregation, rows)
 		bucketRows, subAggrRows = p.potentiallyRemoveExtraBucket(layer, bucketRows, subAggrRows)
+		bucketRows, subAggrRows = p.potentiallyReorderSignificantBuckets(layer, bucketRows, subAggrRows)
+		bucketRows, subAggrRows = p.potentiallyRemoveBucketsByDocCount(layer, bucketRows, subAggrRows)
 
 		buckets := layer.nextBucketAggregation.queryType.TranslateSqlResponseToJson(bucketRows)
 
@@ -298,7 +364,10 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 		}
 
 		if hasSubaggregations {
-			pipelineBucketsPerAggregation := p.pipeline.currentPipelineBucketAggregations(layer, nextLayer, bucketRows, subAggrRows)
+			pipelineBucketsPerAggregation, metricPipelinesOverThem := p.pipeline.currentPipelineBucketAggregations(layer, nextLayer, bucketRows, subAggrRows)
+			for metricPipelineAggrName, metricPipelineAggrResult := range metricPipelinesOverThem {
+				result[metricPipelineAggrName] = metricPipelineAggrResult
+			}
 
 			// Add subAggregations (both normal and pipeline)
 			bucketArrRaw, ok := buckets["buckets"]
@@ -364,9 +433,21 @@ func (p *pancakeJSONRenderer) layerToJSON(remainingLayers []*pancakeModelLayer,
 				}
 			}
 
+			bucketArr = p.pipeline.applyBucketsModifiers(nextLayer, bucketArr)
+			buckets["buckets"] = bucketArr
+		}
+
+		if bucketArr, ok := buckets["buckets"].([]model.JsonMap); ok {
 			for i := 0; i < len(bucketArr); i++ {
 				delete(bucketArr[i], bucket_aggregations.OriginalKeyName)
 			}
+			if layer.nextBucketAggregation.isKeyed {
+				keyedBuckets, err := p.keyedBuckets(layer, bucketArr)
+				if err != nil {
+					return nil, err
+				}
+				buckets["buckets"] = keyedBuckets
+			}
 		}
 
 		if layer.nextBucketAggregation.metadata != nil {
@@ -18,6 +18,9 @@ type pancakeModel struct {
 
 	whereClause model.Expr
 	sampleLimit int
+	// rows differ from the query's documents, e.g. whereClause has composite's `after`, it's global's (no WHERE at all),
+	// or rows are nested's unfolded objects, so total count can't be computed here
+	whereClauseNarrowed bool
 }
 
 // Clone isn't a shallow copy, isn't also a full deep copy, but it's enough for our purposes.
@@ -30,9 +33,10 @@ func (p *pancakeModel) Clone() *pancakeModel {
 		layers[i].childrenPipelineAggregations = p.layers[i].childrenPipelineAggregations
 	}
 	return &pancakeModel{
-		layers:      layers,
-		whereClause: p.whereClause,
-		sampleLimit: p.sampleLimit,
+		layers:              layers,
+		whereClause:         p.whereClause,
+		sampleLimit:         p.sampleLimit,
+		whereClauseNarrowed: p.whereClauseNarrowed,
 	}
 }
 
@@ -59,9 +63,20 @@ type pancakeModelMetricAggregation struct {
 	queryType       model.QueryType // it has to be metric aggregation
 	selectedColumns []model.Expr
 
+	// only for moving_percentiles/cumulative_cardinality, which are metrics computed over a window of parent's buckets
+	movingWindow *pancakeModelMovingWindow
+
 	metadata model.JsonMap
 }
 
+// pancakeModelMovingWindow is a window [i - window + shift, i + shift) of histogram buckets, like in moving_fn,
+// or all buckets up to the current one (inclusive), if cumulative
+type pancakeModelMovingWindow struct {
+	window     int
+	shift      int
+	cumulative bool
+}
+
 type pancakeModelBucketAggregation struct {
 	name            string          // as originally appeared in Query DSL
 	internalName    string          // full name with path, e.g. metric__byCountry__byCity__population or aggr__byCountry
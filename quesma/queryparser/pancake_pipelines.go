@@ -8,6 +8,7 @@ import (
 	"quesma/logger"
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
+	"quesma/model/pipeline_aggregations"
 	"quesma/util"
 )
 
@@ -40,7 +41,7 @@ func (p pancakePipelinesProcessor) selectPipelineRows(pipeline model.PipelineQue
 	return
 }
 
-func (p pancakePipelinesProcessor) currentPipelineMetricAggregations(layer *pancakeModelLayer,
+func (p pancakePipelinesProcessor) currentPipelineMetricAggregations(layer, nextLayer *pancakeModelLayer,
 	rows []model.QueryResultRow) (resultPerPipeline map[string]model.JsonMap) {
 
 	resultPerPipeline = make(map[string]model.JsonMap)
@@ -49,6 +50,9 @@ func (p pancakePipelinesProcessor) currentPipelineMetricAggregations(layer *panc
 		if pipeline.queryType.AggregationType() != model.PipelineMetricsAggregation {
 			continue
 		}
+		if p.isOverBucketPipeline(pipeline, nextLayer) {
+			continue // calculated from its parent's results, in currentPipelineBucketAggregations
+		}
 
 		thisPipelineResults := p.calcSingleMetricPipeline(layer, pipeline, rows)
 
@@ -78,16 +82,35 @@ func (p pancakePipelinesProcessor) calcSingleMetricPipeline(layer *pancakeModelL
 	return
 }
 
+// isOverBucketPipeline returns true if pipeline (of metric type, e.g. max_bucket) refers to a pipeline of bucket type
+// (e.g. "histogram>derivative"), which is calculated for nextLayer.
+func (p pancakePipelinesProcessor) isOverBucketPipeline(pipeline *pancakeModelPipelineAggregation, nextLayer *pancakeModelLayer) bool {
+	if nextLayer == nil || len(pipeline.queryType.GetPathToParent()) == 0 {
+		return false
+	}
+	for _, maybeParent := range nextLayer.childrenPipelineAggregations {
+		if maybeParent.name == pipeline.queryType.GetParent() && maybeParent.queryType.AggregationType() == model.PipelineBucketAggregation {
+			return true
+		}
+	}
+	return false
+}
+
 // input parameters: bucketRows is a subset of rows (it both has <= columns, and <= rows).
+// Besides results for every bucket, it returns results of this layer's metric pipelines which refer to them (see isOverBucketPipeline).
 func (p pancakePipelinesProcessor) currentPipelineBucketAggregations(layer, nextLayer *pancakeModelLayer, bucketRows []model.QueryResultRow,
-	subAggrRows [][]model.QueryResultRow) (resultRowsPerPipeline map[string][]model.JsonMap) {
+	subAggrRows [][]model.QueryResultRow) (resultRowsPerPipeline map[string][]model.JsonMap, resultPerMetricPipeline map[string]model.JsonMap) {
 
 	resultRowsPerPipeline = make(map[string][]model.JsonMap)
+	resultPerMetricPipeline = make(map[string]model.JsonMap)
 
 	for _, childPipeline := range nextLayer.childrenPipelineAggregations {
 		if childPipeline.queryType.AggregationType() != model.PipelineBucketAggregation {
 			continue
 		}
+		if _, isBucketsModifier := childPipeline.queryType.(pipeline_aggregations.BucketsModifierInterface); isBucketsModifier {
+			continue // they don't add anything to buckets, they're applied later, in applyBucketsModifiers
+		}
 
 		bucketRowsWithRightLastColumn := bucketRows
 		needToAddProperMetricColumn := !childPipeline.queryType.IsCount() // If count, last column of bucketRows is already count we need.
@@ -114,12 +137,30 @@ func (p pancakePipelinesProcessor) currentPipelineBucketAggregations(layer, next
 				jsonResults[i] = childPipeline.queryType.TranslateSqlResponseToJson([]model.QueryResultRow{pipelineResult})
 			}
 			resultRowsPerPipeline[pipelineName] = jsonResults
+
+			for _, metricPipeline := range layer.childrenPipelineAggregations {
+				if metricPipeline.queryType.GetParent() == pipelineName && p.isOverBucketPipeline(metricPipeline, nextLayer) {
+					errorMsg := fmt.Sprintf("currentPipelineBucketAggregations, pipeline: %s", metricPipeline.internalName)
+					resultPerMetricPipeline = util.Merge(p.ctx, resultPerMetricPipeline,
+						p.calcSingleMetricPipeline(layer, metricPipeline, pipelineResults), errorMsg)
+				}
+			}
 		}
 	}
 
 	return
 }
 
+// applyBucketsModifiers applies bucket_selector/bucket_sort to already rendered buckets
+func (p pancakePipelinesProcessor) applyBucketsModifiers(nextLayer *pancakeModelLayer, buckets []model.JsonMap) []model.JsonMap {
+	for _, childPipeline := range nextLayer.childrenPipelineAggregations {
+		if modifier, isBucketsModifier := childPipeline.queryType.(pipeline_aggregations.BucketsModifierInterface); isBucketsModifier {
+			buckets = modifier.ModifyBuckets(buckets)
+		}
+	}
+	return buckets
+}
+
 func (p pancakePipelinesProcessor) calcSinglePipelineBucket(layer *pancakeModelLayer, pipeline *pancakeModelPipelineAggregation,
 	bucketRows []model.QueryResultRow) (resultRowsPerPipeline map[string][]model.QueryResultRow) {
 
@@ -10,6 +10,7 @@ import (
 	"quesma/model/bucket_aggregations"
 	"quesma/model/metrics_aggregations"
 	"quesma/queryparser/query_util"
+	"slices"
 	"strings"
 )
 
@@ -52,17 +53,20 @@ func (p *pancakeSqlQueryGenerator) generateAccumAggrFunctions(origExpr model.Exp
 		switch origFunc.Name {
 		case "sum", "sumOrNull", "min", "minOrNull", "max", "maxOrNull":
 			return origExpr, origFunc.Name, nil
+		case "sumIf", "sumOrNullIf", "minIf", "minOrNullIf", "maxIf", "maxOrNullIf":
+			return origExpr, strings.TrimSuffix(origFunc.Name, "If"), nil
 		case "count", "countIf":
 			return model.NewFunction(origFunc.Name, origFunc.Args...), "sum", nil
-		case "avg", "avgOrNull", "varPop", "varSamp", "stddevPop", "stddevSamp", "uniq":
+		case "avg", "avgOrNull", "avgWeighted", "avgWeightedOrNull", "varPop", "varSamp", "stddevPop", "stddevSamp", "uniq", "uniqExact", "sumMap":
 			// TODO: I debate whether make that default
 			// This is ClickHouse specific: https://clickhouse.com/docs/en/sql-reference/aggregate-functions/combinators
 			return model.NewFunction(origFunc.Name+"State", origFunc.Args...), origFunc.Name + "Merge", nil
 		}
 
-		if strings.HasPrefix(origFunc.Name, "quantiles") {
-			return model.NewFunction(strings.Replace(origFunc.Name, "quantiles", "quantilesState", 1), origFunc.Args...),
-				strings.Replace(origFunc.Name, "quantiles", "quantilesMerge", 1), nil
+		if strings.HasPrefix(origFunc.Name, "quantiles") || strings.HasPrefix(origFunc.Name, "histogram(") {
+			// parametric functions, e.g. quantilesTDigest(0.5)(x): combinator goes before parameters
+			nameWithoutParams, params, _ := strings.Cut(origFunc.Name, "(")
+			return model.NewFunction(nameWithoutParams+"State("+params, origFunc.Args...), nameWithoutParams + "Merge(" + params, nil
 		}
 	}
 	debugQueryType := "<nil>"
@@ -77,7 +81,22 @@ func (p *pancakeSqlQueryGenerator) generateMetricSelects(metric *pancakeModelMet
 	for columnId, column := range metric.selectedColumns {
 		finalColumn := column
 
-		if hasMoreBucketAggregations {
+		if metric.movingWindow != nil {
+			// moving_percentiles/cumulative_cardinality: merge states of the window of rows, ordered by the last group by (histogram's key)
+			if len(groupByColumns) == 0 {
+				return nil, fmt.Errorf("moving window of %s requires a parent bucket aggregation", metric.name)
+			}
+			partColumn, aggFunctionName, err := p.generateAccumAggrFunctions(column, metric.queryType)
+			if err != nil {
+				return nil, err
+			}
+			lastGroupBy := groupByColumns[len(groupByColumns)-1]
+			windowFunction := model.NewWindowFunction(aggFunctionName, []model.Expr{partColumn},
+				p.generatePartitionBy(groupByColumns[:len(groupByColumns)-1]),
+				[]model.OrderByExpr{model.NewOrderByExpr(lastGroupBy.AliasRef(), model.AscOrder)})
+			windowFunction.Frame = p.generateMovingWindowFrame(metric.movingWindow)
+			finalColumn = windowFunction
+		} else if hasMoreBucketAggregations {
 			partColumn, aggFunctionName, err := p.generateAccumAggrFunctions(column, metric.queryType)
 			if err != nil {
 				return nil, err
@@ -91,6 +110,26 @@ func (p *pancakeSqlQueryGenerator) generateMetricSelects(metric *pancakeModelMet
 	return
 }
 
+// generateMovingWindowFrame returns frame of rows [i - window + shift, i + shift), e.g. for shift == 0
+// it's ROWS BETWEEN <window> PRECEDING AND 1 PRECEDING
+func (p *pancakeSqlQueryGenerator) generateMovingWindowFrame(movingWindow *pancakeModelMovingWindow) string {
+	if movingWindow.cumulative {
+		return "ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW"
+	}
+	frameBound := func(offset int) string {
+		switch {
+		case offset < 0:
+			return fmt.Sprintf("%d PRECEDING", -offset)
+		case offset > 0:
+			return fmt.Sprintf("%d FOLLOWING", offset)
+		default:
+			return "CURRENT ROW"
+		}
+	}
+	return fmt.Sprintf("ROWS BETWEEN %s AND %s",
+		frameBound(movingWindow.shift-movingWindow.window), frameBound(movingWindow.shift-1))
+}
+
 func (p *pancakeSqlQueryGenerator) isPartOf(column model.Expr, aliasedColumns []model.AliasedExpr) *model.AliasedExpr {
 	for _, aliasedColumn := range aliasedColumns {
 		if model.PartlyImplementedIsEqual(column, aliasedColumn) {
@@ -111,22 +150,49 @@ func (p *pancakeSqlQueryGenerator) isPartOfOrderBy(alias model.AliasedExpr, orde
 	return false
 }
 
-func (p *pancakeSqlQueryGenerator) addPotentialParentCount(bucketAggregation *pancakeModelBucketAggregation, groupByColumns []model.AliasedExpr) []model.AliasedExpr {
+func (p *pancakeSqlQueryGenerator) addPotentialParentCount(bucketAggregation *pancakeModelBucketAggregation, groupByColumns []model.AliasedExpr, docCount model.Expr) ([]model.AliasedExpr, error) {
 	if query_util.IsAnyKindOfTerms(bucketAggregation.queryType) {
-		parentCountColumn := model.NewWindowFunction("sum",
-			[]model.Expr{model.NewCountFunc()},
+		partCountColumn, aggFunctionName, err := p.generateAccumAggrFunctions(docCount, bucketAggregation.queryType)
+		if err != nil {
+			return nil, err
+		}
+		parentCountColumn := model.NewWindowFunction(aggFunctionName,
+			[]model.Expr{partCountColumn},
 			p.generatePartitionBy(groupByColumns), []model.OrderByExpr{})
 		parentCountAliasedColumn := model.NewAliasedExpr(parentCountColumn, bucketAggregation.InternalNameForParentCount())
-		return []model.AliasedExpr{parentCountAliasedColumn}
+		return []model.AliasedExpr{parentCountAliasedColumn}, nil
 	}
-	return []model.AliasedExpr{}
+	return []model.AliasedExpr{}, nil
+}
+
+// docCountExpr returns expression counting documents in a bucket: count(*), or for reverse_nested and bucket
+// aggregations below it, number of distinct parent documents (rows are nested objects there)
+func (p *pancakeSqlQueryGenerator) docCountExpr(query *pancakeModel, bucketAggregation *pancakeModelBucketAggregation) model.Expr {
+	for _, layer := range query.layers {
+		if layer.nextBucketAggregation == nil {
+			break
+		}
+		if reverseNested, isReverseNested := layer.nextBucketAggregation.queryType.(bucket_aggregations.ReverseNested); isReverseNested {
+			return reverseNested.CountParentsExpr()
+		}
+		if layer.nextBucketAggregation == bucketAggregation {
+			break
+		}
+	}
+	return model.NewCountFunc()
 }
 
 func (p *pancakeSqlQueryGenerator) generateBucketSqlParts(query *pancakeModel, bucketAggregation *pancakeModelBucketAggregation, groupByColumns []model.AliasedExpr, hasMoreBucketAggregations bool) (
 	addSelectColumns, addGroupBys, addRankColumns []model.AliasedExpr, addRankWheres []model.Expr, addRankOrderBys []model.OrderByExpr, err error) {
 
+	docCount := p.docCountExpr(query, bucketAggregation)
+
 	// For some group by such as terms, we need total count. We add it in this method.
-	addSelectColumns = append(addSelectColumns, p.addPotentialParentCount(bucketAggregation, groupByColumns)...)
+	parentCountColumns, err := p.addPotentialParentCount(bucketAggregation, groupByColumns, docCount)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+	addSelectColumns = append(addSelectColumns, parentCountColumns...)
 
 	for columnId, column := range bucketAggregation.selectedColumns {
 		aliasedColumn := model.NewAliasedExpr(column, bucketAggregation.InternalNameForKey(columnId))
@@ -135,14 +201,15 @@ func (p *pancakeSqlQueryGenerator) generateBucketSqlParts(query *pancakeModel, b
 	}
 
 	// build count for aggr
-	var countColumn model.Expr
+	countColumn := docCount
 	if hasMoreBucketAggregations {
-		partCountColumn := model.NewCountFunc()
+		partCountColumn, aggFunctionName, err := p.generateAccumAggrFunctions(docCount, bucketAggregation.queryType)
+		if err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
 
-		countColumn = model.NewWindowFunction("sum", []model.Expr{partCountColumn},
+		countColumn = model.NewWindowFunction(aggFunctionName, []model.Expr{partCountColumn},
 			p.generatePartitionBy(append(groupByColumns, addGroupBys...)), []model.OrderByExpr{})
-	} else {
-		countColumn = model.NewCountFunc()
 	}
 	countAliasedColumn := model.NewAliasedExpr(countColumn, bucketAggregation.InternalNameForCount())
 	addSelectColumns = append(addSelectColumns, countAliasedColumn)
@@ -252,6 +319,7 @@ func (p *pancakeSqlQueryGenerator) addIfCombinator(column model.Expr, whereClaus
 			Args:        newArgs,
 			PartitionBy: function.PartitionBy,
 			OrderBy:     function.OrderBy,
+			Frame:       function.Frame,
 		}
 		return newWindow, nil
 	default:
@@ -284,6 +352,7 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 	rankWheres := make([]model.Expr, 0)
 	rankOrderBys := make([]model.OrderByExpr, 0)
 	groupBys := make([]model.AliasedExpr, 0)
+	countConditions := make([]model.Expr, 0) // e.g. rare_terms' doc_count <= max_doc_count
 
 	type addIfCombinator struct {
 		selectNr  int
@@ -334,6 +403,12 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 			rankColumns = append(rankColumns, addRankColumns...)
 			rankWheres = append(rankWheres, addRankWheres...)
 			rankOrderBys = append(rankOrderBys, addRankOrderBys...)
+
+			// with combinators above, counts are split into many columns, so we check the condition only in the response
+			if rareTerms, isRareTerms := layer.nextBucketAggregation.queryType.(bucket_aggregations.RareTerms); isRareTerms && len(addIfCombinators) == 0 {
+				countAlias := model.NewAliasedExpr(model.NewCountFunc(), layer.nextBucketAggregation.InternalNameForCount())
+				countConditions = append(countConditions, rareTerms.CountCondition(countAlias.AliasRef()))
+			}
 		}
 	}
 
@@ -390,13 +465,14 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 		rankColumns = []model.AliasedExpr{} // needed if there would be top hits
 
 		resultQuery = &model.SelectCommand{
-			Columns:     p.aliasedExprArrayToExpr(selectColumns),
-			GroupBy:     p.aliasedExprArrayToExpr(groupBys),
-			WhereClause: aggregation.whereClause,
-			FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
-			OrderBy:     orderBy,
-			Limit:       limit,
-			SampleLimit: aggregation.sampleLimit,
+			Columns:      p.aliasedExprArrayToExpr(selectColumns),
+			GroupBy:      p.aliasedExprArrayToExpr(groupBys),
+			WhereClause:  aggregation.whereClause,
+			HavingClause: model.And(countConditions),
+			FromClause:   model.NewTableRef(model.SingleTableNamePlaceHolder),
+			OrderBy:      orderBy,
+			Limit:        limit,
+			SampleLimit:  aggregation.sampleLimit,
 		}
 		optimizerName = PancakeOptimizerName + "(half)"
 	} else {
@@ -416,12 +492,21 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 		resultQuery = &model.SelectCommand{
 			Columns:     p.aliasedExprArrayToLiteralExpr(selectColumns),
 			FromClause:  rankCte,
-			WhereClause: model.And(rankWheres),
+			WhereClause: model.And(append(rankWheres, countConditions...)),
 			OrderBy:     rankOrderBys,
 		}
 		optimizerName = PancakeOptimizerName
 	}
 
+	if firstBucketAggregation := aggregation.layers[0].nextBucketAggregation; firstBucketAggregation != nil {
+		if nested, isNested := firstBucketAggregation.queryType.(bucket_aggregations.Nested); isNested {
+			resultQuery, err = p.arrayJoinNestedObjects(*resultQuery, nested)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
 	if optTopHitsOrMetrics != nil {
 		resultQuery.Columns = append(resultQuery.Columns, p.aliasedExprArrayToLiteralExpr(rankColumns)...)
 		resultQuery, err = p.generateTopHitsQuery(aggregation, combinatorWhere, optTopHitsOrMetrics, groupBys, selectColumns, resultQuery)
@@ -431,6 +516,82 @@ func (p *pancakeSqlQueryGenerator) generateSelectCommand(aggregation *pancakeMod
 	return
 }
 
+// arrayJoinNestedObjects unfolds arrays of nested objects with ARRAY JOIN, so every nested object is a separate row.
+// Fields of nested objects are replaced with ARRAY JOIN's aliases everywhere except WHERE, where they still refer to
+// whole arrays, so the query filters documents, just like in Elastic.
+func (p *pancakeSqlQueryGenerator) arrayJoinNestedObjects(query model.SelectCommand, nested bucket_aggregations.Nested) (*model.SelectCommand, error) {
+	var fields []string
+	collectFields := model.NewBaseVisitor()
+	collectFields.OverrideVisitColumnRef = func(b *model.BaseExprVisitor, e model.ColumnRef) interface{} {
+		if nested.IsUnderPath(e.ColumnName) && !slices.Contains(fields, e.ColumnName) {
+			fields = append(fields, e.ColumnName)
+		}
+		return e
+	}
+	for currentQuery, isSelect := query, true; isSelect; currentQuery, isSelect = currentQuery.FromClause.(model.SelectCommand) {
+		withoutWhereAndFrom := currentQuery
+		withoutWhereAndFrom.WhereClause, withoutWhereAndFrom.FromClause = nil, nil
+		withoutWhereAndFrom.Accept(collectFields)
+	}
+	if len(fields) == 0 {
+		// e.g. only doc_count is needed: any array of nested objects is enough to unfold them
+		if len(nested.Fields()) == 0 {
+			return nil, fmt.Errorf("nested aggregation: no fields found under path %s", nested.Path())
+		}
+		fields = nested.Fields()[:1]
+	}
+
+	// Arrays of different fields may have different lengths (e.g. if some nested objects miss a field), and ARRAY JOIN
+	// of several arrays requires equal ones. So we join a single array: of tuples of all fields, padded with NULLs.
+	var arrayJoined model.AliasedExpr
+	fieldRefs := make(map[string]model.Expr, len(fields))
+	if len(fields) == 1 {
+		arrayJoined = model.NewAliasedExpr(model.NewColumnRef(fields[0]), nested.ArrayJoinAlias(fields[0]))
+		fieldRefs[fields[0]] = arrayJoined.AliasRef()
+	} else {
+		lengths := make([]model.Expr, 0, len(fields))
+		for _, field := range fields {
+			lengths = append(lengths, model.NewFunction("length", model.NewColumnRef(field)))
+		}
+		maxLength := model.NewFunction("greatest", lengths...)
+		paddedArrays := make([]model.Expr, 0, len(fields))
+		for _, field := range fields {
+			paddedArrays = append(paddedArrays, model.NewFunction("arrayResize", model.NewColumnRef(field), maxLength, model.NewLiteral("NULL")))
+		}
+		arrayJoined = model.NewAliasedExpr(model.NewFunction("arrayZip", paddedArrays...), nested.ArrayJoinAlias(nested.Path()))
+		for i, field := range fields {
+			fieldRefs[field] = model.NewFunction("tupleElement", arrayJoined.AliasRef(), model.NewLiteral(i+1))
+		}
+	}
+	return p.replaceNestedFields(query, nested, fieldRefs, arrayJoined), nil
+}
+
+// replaceNestedFields replaces fields of nested objects with references to arrayJoined (see arrayJoinNestedObjects),
+// and adds ARRAY JOIN of it to the innermost query.
+func (p *pancakeSqlQueryGenerator) replaceNestedFields(query model.SelectCommand, nested bucket_aggregations.Nested,
+	fieldRefs map[string]model.Expr, arrayJoined model.AliasedExpr) *model.SelectCommand {
+
+	toArrayJoinRefs := model.NewBaseVisitor()
+	toArrayJoinRefs.OverrideVisitColumnRef = func(b *model.BaseExprVisitor, e model.ColumnRef) interface{} {
+		if ref, isNestedField := fieldRefs[e.ColumnName]; isNestedField {
+			return ref
+		}
+		return e
+	}
+
+	whereClause, fromClause := query.WhereClause, query.FromClause
+	query.WhereClause, query.FromClause = nil, nil
+	result := query.Accept(toArrayJoinRefs).(*model.SelectCommand)
+	result.WhereClause = whereClause
+
+	if innerQuery, isInnerQuery := fromClause.(model.SelectCommand); isInnerQuery {
+		result.FromClause = *p.replaceNestedFields(innerQuery, nested, fieldRefs, arrayJoined)
+	} else {
+		result.FromClause = model.NewArrayJoinExpr(fromClause, []model.AliasedExpr{arrayJoined})
+	}
+	return result
+}
+
 func (p *pancakeSqlQueryGenerator) generateQuery(aggregation *pancakeModel) (*model.Query, error) {
 	if aggregation == nil {
 		return nil, errors.New("aggregation is nil in generateQuery")
@@ -451,3 +612,75 @@ func (p *pancakeSqlQueryGenerator) generateQuery(aggregation *pancakeModel) (*mo
 
 	return resultQuery, nil
 }
+
+// generateSignificantTermsBackgroundQueries generates an additional query for each significant_terms aggregation.
+// It counts documents with the aggregation's (foreground) terms in the background set (whole index or background_filter),
+// and the size of the background set, both needed to score the terms. Only candidate terms are counted, i.e. top
+// shard_size foreground terms in each parent bucket, the same ones the foreground query returns.
+func (p *pancakeSqlQueryGenerator) generateSignificantTermsBackgroundQueries(aggregations []*pancakeModel) []*model.Query {
+	backgroundQueries := make([]*model.Query, 0)
+	alreadyGenerated := make(map[*bucket_aggregations.SignificantTermsBackground]struct{})
+	for _, aggregation := range aggregations {
+		var parentKeys []model.Expr
+		for _, layer := range aggregation.layers {
+			if layer.nextBucketAggregation == nil || len(layer.nextBucketAggregation.selectedColumns) == 0 {
+				continue
+			}
+			keysSoFar := parentKeys
+			parentKeys = append(slices.Clone(parentKeys), layer.nextBucketAggregation.selectedColumns...)
+			terms, isTerms := layer.nextBucketAggregation.queryType.(bucket_aggregations.Terms)
+			if !isTerms || terms.Background() == nil {
+				continue
+			}
+			background := terms.Background()
+			if _, exists := alreadyGenerated[background]; exists {
+				continue
+			}
+			alreadyGenerated[background] = struct{}{}
+
+			bucket := layer.nextBucketAggregation
+			key := bucket.selectedColumns[0]
+			// LimitBy's last expression isn't rendered, so it's LIMIT shard_size BY parent keys (or just LIMIT, with no parents)
+			keysWithParents := append(slices.Clone(keysSoFar), key)
+			foregroundKeys := model.SelectCommand{
+				Columns:     []model.Expr{key},
+				FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+				WhereClause: aggregation.whereClause,
+				GroupBy:     keysWithParents,
+				OrderBy: []model.OrderByExpr{
+					model.NewOrderByExpr(model.NewCountFunc(), model.DescOrder),
+					model.NewOrderByExpr(key, model.AscOrder),
+				},
+				LimitBy: keysWithParents,
+				Limit:   bucket.limit,
+			}
+			backgroundSize := model.SelectCommand{
+				Columns:     []model.Expr{model.NewCountFunc()},
+				FromClause:  model.NewTableRef(model.SingleTableNamePlaceHolder),
+				WhereClause: background.BackgroundFilter(),
+			}
+			selectCommand := model.SelectCommand{
+				Columns: []model.Expr{
+					model.NewAliasedExpr(key, bucket.InternalNameForKey(0)),
+					model.NewAliasedExpr(model.NewCountFunc(), bucket.internalName+"bg_count"),
+					model.NewAliasedExpr(model.NewParenExpr(backgroundSize), bucket.internalName+"bg_total"),
+				},
+				GroupBy:    []model.Expr{key},
+				FromClause: model.NewTableRef(model.SingleTableNamePlaceHolder),
+				WhereClause: model.And([]model.Expr{
+					background.BackgroundFilter(),
+					model.NewInfixExpr(key, "IN", model.NewParenExpr(foregroundKeys)),
+				}),
+			}
+
+			backgroundQuery := &model.Query{
+				SelectCommand: selectCommand,
+				Type:          background,
+				OptimizeHints: model.NewQueryExecutionHints(),
+			}
+			backgroundQuery.OptimizeHints.OptimizationsPerformed = append(backgroundQuery.OptimizeHints.OptimizationsPerformed, PancakeOptimizerName+"(significant_terms background)")
+			backgroundQueries = append(backgroundQueries, backgroundQuery)
+		}
+	}
+	return backgroundQueries
+}
@@ -113,8 +113,9 @@ func TestPancakeQueryGeneration(t *testing.T) {
 
 				util.AssertSqlEqual(t, prettyExpectedSql, prettyPancakeSql)
 
-				_, ok := pancakeSql.Type.(PancakeQueryType)
-				if !ok {
+				switch pancakeSql.Type.(type) {
+				case PancakeQueryType, *bucket_aggregations.SignificantTermsBackground:
+				default:
 					assert.Fail(t, "Expected pancake query type")
 				}
 			}
@@ -315,3 +316,98 @@ LIMIT 4`, // we increased limit by 1 to allow filtering of nulls druing json ren
 	}
 
 }
+
+func TestPancakeQueryGeneration_significantTermsBackgroundPerParentBucket(t *testing.T) {
+	table := clickhouse.Table{
+		Cols: map[string]*clickhouse.Column{
+			"host.name": {Name: "host.name", Type: clickhouse.NewBaseType("String")},
+			"message":   {Name: "message", Type: clickhouse.NewBaseType("String")},
+		},
+		Name:   tableName,
+		Config: clickhouse.NewDefaultCHConfig(),
+	}
+	lm := clickhouse.NewLogManager(concurrent.NewMapWith(tableName, &table), &config.QuesmaConfiguration{})
+	cw := ClickhouseQueryTranslator{ClickhouseLM: lm, Table: &table, Ctx: context.Background(), Schema: schema.Schema{}}
+
+	jsonp, err := types.ParseJSON(`
+{
+  "aggs": {
+    "hosts": {
+      "terms": {"field": "host.name", "size": 3},
+      "aggs": {
+        "sig": {"significant_terms": {"field": "message", "size": 2, "shard_size": 5}}
+      }
+    }
+  }
+}`)
+	assert.NoError(t, err)
+	pancakeSqls, err := cw.PancakeParseAggregationJson(jsonp, false)
+	assert.NoError(t, err)
+	if !assert.Len(t, pancakeSqls, 2) {
+		return
+	}
+	// candidates are top shard_size terms in each parent bucket, like in the foreground query
+	expectedSql := `
+SELECT "message" AS "aggr__hosts__sig__key_0",
+  count(*) AS "aggr__hosts__sig__bg_count", (
+  SELECT count(*)
+  FROM ` + TableName + `) AS "aggr__hosts__sig__bg_total"
+FROM ` + TableName + `
+WHERE "message" IN (
+  SELECT "message"
+  FROM ` + TableName + `
+  GROUP BY "host.name", "message"
+  ORDER BY count(*) DESC, "message" ASC
+  LIMIT 5 BY "host.name")
+GROUP BY "message"`
+	prettyPancakeSql := util.SqlPrettyPrint([]byte(model.AsString(pancakeSqls[1].SelectCommand)))
+	assert.Equal(t, strings.TrimSpace(expectedSql), strings.TrimSpace(prettyPancakeSql))
+}
+
+func TestPancakeQueryGeneration_unsupportedNesting(t *testing.T) {
+	table := clickhouse.Table{
+		Cols: map[string]*clickhouse.Column{
+			"comments": {Name: "comments", Type: clickhouse.NewBaseType("Array(Tuple(username String))")},
+			"tags":     {Name: "tags", Type: clickhouse.NewBaseType("String")},
+			"likes":    {Name: "likes", Type: clickhouse.NewBaseType("UInt64")},
+		},
+		Name:   tableName,
+		Config: clickhouse.NewDefaultCHConfig(),
+	}
+	lm := clickhouse.NewLogManager(concurrent.NewMapWith(tableName, &table), &config.QuesmaConfiguration{})
+	cw := ClickhouseQueryTranslator{ClickhouseLM: lm, Table: &table, Ctx: context.Background(), Schema: schema.Schema{}}
+
+	aggs := func(reverseNestedAggs, usersAggs string) string {
+		return `{"aggs": {"comments": {"nested": {"path": "comments"}, "aggs": {"users": {
+			"terms": {"field": "comments.username"},
+			"aggs": {"issues": {"reverse_nested": {}, "aggs": {` + reverseNestedAggs + `}}` + usersAggs + `}}}}}}`
+	}
+	// nested is supported only as a top level aggregation, and metrics only outside of reverse_nested
+	tests := []struct {
+		name        string
+		json        string
+		expectedErr string // empty if no error expected
+	}{
+		{"bucket inside reverse_nested", aggs(`"tags": {"terms": {"field": "tags"}}`, ""), ""},
+		{"metric next to reverse_nested", aggs(`"tags": {"terms": {"field": "tags"}}`, `, "max": {"max": {"field": "comments.likes"}}`), ""},
+		{"metric inside reverse_nested", aggs(`"likes": {"sum": {"field": "likes"}}`, ""), "inside reverse_nested aggregation is not supported"},
+		{"metric deeper inside reverse_nested", aggs(`"tags": {"terms": {"field": "tags"}, "aggs": {"likes": {"avg": {"field": "likes"}}}}`, ""),
+			"inside reverse_nested aggregation is not supported"},
+		{"nested inside terms, with metric inside reverse_nested", `{"aggs": {"tags": {"terms": {"field": "tags"}, "aggs": {
+			"comments": {"nested": {"path": "comments"}, "aggs": {
+				"issues": {"reverse_nested": {}, "aggs": {"likes": {"sum": {"field": "likes"}}}}}}}}}}`,
+			"nested aggregation comments is supported only as a top level aggregation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonp, err := types.ParseJSON(tt.json)
+			assert.NoError(t, err)
+			_, err = cw.PancakeParseAggregationJson(jsonp, false)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"quesma/model"
 	"quesma/model/bucket_aggregations"
 	"quesma/model/metrics_aggregations"
+	"quesma/model/pipeline_aggregations"
 	"reflect"
 	"sort"
 	"strings"
@@ -242,6 +243,57 @@ func (a *pancakeTransformer) aggregationChildrenToLayers(aggrNames []string, chi
 func (a *pancakeTransformer) checkIfSupported(layers []*pancakeModelLayer) error {
 	// Let's say we support everything. That'll be true when I add support for filters/date_range/range in the middle of aggregation tree (@trzysiek)
 	// Erase this function by then.
+	for _, layer := range layers[1:] {
+		if layer.nextBucketAggregation == nil {
+			continue
+		}
+		// composite narrows the WHERE clause of the whole query, so it has to be a top level aggregation (like in Elastic)
+		if _, isComposite := layer.nextBucketAggregation.queryType.(*bucket_aggregations.Composite); isComposite {
+			return fmt.Errorf("composite aggregation %s must be a top level aggregation", layer.nextBucketAggregation.name)
+		}
+		// global ignores the query, so it has to be a top level aggregation (like in Elastic)
+		if _, isGlobal := layer.nextBucketAggregation.queryType.(bucket_aggregations.Global); isGlobal {
+			return fmt.Errorf("global aggregation %s must be a top level aggregation", layer.nextBucketAggregation.name)
+		}
+		// nested unfolds arrays for the whole pancake, so we support it only as a top level aggregation
+		if _, isNested := layer.nextBucketAggregation.queryType.(bucket_aggregations.Nested); isNested {
+			return fmt.Errorf("nested aggregation %s is supported only as a top level aggregation", layer.nextBucketAggregation.name)
+		}
+	}
+
+	isNestedPancake := false
+	if layers[0].nextBucketAggregation != nil {
+		_, isNestedPancake = layers[0].nextBucketAggregation.queryType.(bucket_aggregations.Nested)
+	}
+	if !isNestedPancake {
+		for _, layer := range layers {
+			if layer.nextBucketAggregation == nil {
+				continue
+			}
+			if _, isReverseNested := layer.nextBucketAggregation.queryType.(bucket_aggregations.ReverseNested); isReverseNested {
+				return fmt.Errorf("reverse_nested aggregation %s must be inside a nested aggregation", layer.nextBucketAggregation.name)
+			}
+		}
+		return nil
+	}
+	underReverseNested := false
+	for _, layer := range layers[1:] { // metrics from the first layer are nested's siblings, they get a separate pancake
+		for _, metric := range layer.currentMetricAggregations {
+			switch metric.queryType.(type) {
+			case *metrics_aggregations.TopMetrics, *metrics_aggregations.TopHits:
+				return fmt.Errorf("top_hits/top_metrics aggregation %s inside nested aggregation is not supported", metric.name)
+			}
+			// rows are still unfolded nested objects there, so a metric would take a parent's value once per its nested object
+			if underReverseNested {
+				return fmt.Errorf("metric aggregation %s inside reverse_nested aggregation is not supported", metric.name)
+			}
+		}
+		if layer.nextBucketAggregation != nil {
+			if _, isReverseNested := layer.nextBucketAggregation.queryType.(bucket_aggregations.ReverseNested); isReverseNested {
+				underReverseNested = true
+			}
+		}
+	}
 	return nil
 }
 
@@ -263,6 +315,74 @@ func (a *pancakeTransformer) connectPipelineAggregations(layers []*pancakeModelL
 	}
 }
 
+// transformWindowPipelines replaces moving_percentiles and cumulative_cardinality pipelines with percentiles/cardinality
+// metric aggregations, which are computed over a window of (histogram) buckets in SQL.
+// Only buckets present in the result count to the window, so empty buckets (gaps) aren't taken into account.
+func (a *pancakeTransformer) transformWindowPipelines(layers []*pancakeModelLayer) error {
+	for i, layer := range layers {
+		pipelinesLeft := make([]*pancakeModelPipelineAggregation, 0, len(layer.currentPipelineAggregations))
+		for _, pipeline := range layer.currentPipelineAggregations {
+			var window *pancakeModelMovingWindow
+			var isParentTypeValid func(model.QueryType) bool
+			switch queryType := pipeline.queryType.(type) {
+			case pipeline_aggregations.MovingPercentiles:
+				window = &pancakeModelMovingWindow{window: queryType.Window(), shift: queryType.Shift()}
+				isParentTypeValid = func(parentType model.QueryType) bool {
+					_, isPercentiles := parentType.(metrics_aggregations.Quantile)
+					return isPercentiles
+				}
+			case pipeline_aggregations.CumulativeCardinality:
+				window = &pancakeModelMovingWindow{cumulative: true}
+				isParentTypeValid = func(parentType model.QueryType) bool {
+					_, isCardinality := parentType.(metrics_aggregations.Cardinality)
+					return isCardinality
+				}
+			default:
+				pipelinesLeft = append(pipelinesLeft, pipeline)
+				continue
+			}
+
+			if i == 0 || len(pipeline.queryType.GetPathToParent()) > 0 {
+				return fmt.Errorf("%s must be a direct child of histogram or date_histogram", pipeline.queryType.String())
+			}
+			switch layers[i-1].nextBucketAggregation.queryType.(type) {
+			case *bucket_aggregations.Histogram, *bucket_aggregations.DateHistogram:
+			default:
+				return fmt.Errorf("%s must be a direct child of histogram or date_histogram", pipeline.queryType.String())
+			}
+			// window is over histogram buckets, so they have to be the last group by
+			if layer.nextBucketAggregation != nil {
+				return fmt.Errorf("%s can't have sibling bucket aggregations", pipeline.queryType.String())
+			}
+
+			var parent *pancakeModelMetricAggregation
+			for _, metric := range layer.currentMetricAggregations {
+				if metric.name == pipeline.queryType.GetParent() && isParentTypeValid(metric.queryType) {
+					parent = metric
+				}
+			}
+			if parent == nil {
+				return fmt.Errorf("%s: parent %s not found or has a wrong type", pipeline.queryType.String(), pipeline.queryType.GetParent())
+			}
+
+			previousAggrNames := make([]string, 0, i)
+			for _, previousLayer := range layers[:i] {
+				previousAggrNames = append(previousAggrNames, previousLayer.nextBucketAggregation.name)
+			}
+			layer.currentMetricAggregations = append(layer.currentMetricAggregations, &pancakeModelMetricAggregation{
+				name:            pipeline.name,
+				internalName:    a.generateMetricInternalName(append(previousAggrNames, pipeline.name), parent.queryType),
+				queryType:       parent.queryType,
+				selectedColumns: parent.selectedColumns,
+				movingWindow:    window,
+				metadata:        pipeline.metadata,
+			})
+		}
+		layer.currentPipelineAggregations = pipelinesLeft
+	}
+	return nil
+}
+
 // returns nil if no parent bucket layer found
 
 func (a *pancakeTransformer) findParentBucketLayer(layers []*pancakeModelLayer, queryType model.QueryType) (
@@ -395,6 +515,9 @@ func (a *pancakeTransformer) aggregationTreeToPancakes(topLevel pancakeAggregati
 			return nil, err
 		}
 
+		if err := a.transformWindowPipelines(layers); err != nil {
+			return nil, err
+		}
 		a.connectPipelineAggregations(layers)
 		a.transformAutoDateHistogram(layers, topLevel.whereClause)
 
@@ -403,6 +526,15 @@ func (a *pancakeTransformer) aggregationTreeToPancakes(topLevel pancakeAggregati
 			whereClause: topLevel.whereClause,
 			sampleLimit: sampleLimit,
 		}
+		if compositeMetricsPancake := a.createCompositePancakes(&newPancake); compositeMetricsPancake != nil {
+			pancakeResults = append(pancakeResults, compositeMetricsPancake)
+		}
+		if globalMetricsPancake := a.createGlobalPancakes(&newPancake); globalMetricsPancake != nil {
+			pancakeResults = append(pancakeResults, globalMetricsPancake)
+		}
+		if nestedMetricsPancake := a.createNestedPancakes(&newPancake); nestedMetricsPancake != nil {
+			pancakeResults = append(pancakeResults, nestedMetricsPancake)
+		}
 		pancakeResults = append(pancakeResults, &newPancake)
 
 		// TODO: if both top_hits/top_metrics, and filters, it probably won't work...
@@ -421,6 +553,81 @@ func (a *pancakeTransformer) aggregationTreeToPancakes(topLevel pancakeAggregati
 	return
 }
 
+// createCompositePancakes only does something, if first layer aggregation is Composite.
+// It adds composite's page condition to `pancake`'s WHERE clause. Metrics from the first layer (composite's siblings)
+// need the original WHERE clause, so they're moved to a new pancake, which is returned (nil if there are none).
+func (a *pancakeTransformer) createCompositePancakes(pancake *pancakeModel) (metricsPancake *pancakeModel) {
+	if len(pancake.layers) == 0 || pancake.layers[0].nextBucketAggregation == nil {
+		return
+	}
+
+	firstLayer := pancake.layers[0]
+	composite, isComposite := firstLayer.nextBucketAggregation.queryType.(*bucket_aggregations.Composite)
+	if !isComposite {
+		return
+	}
+
+	metricsPancake = a.moveFirstLayerMetricsToNewPancake(pancake)
+	pancake.whereClause = model.And([]model.Expr{pancake.whereClause, composite.WhereClause()})
+	pancake.whereClauseNarrowed = true
+	return
+}
+
+// createGlobalPancakes only does something, if first layer aggregation is Global.
+// It removes the query's WHERE clause from `pancake`. Metrics from the first layer (global's siblings)
+// need the original WHERE clause, so they're moved to a new pancake, which is returned (nil if there are none).
+func (a *pancakeTransformer) createGlobalPancakes(pancake *pancakeModel) (metricsPancake *pancakeModel) {
+	if len(pancake.layers) == 0 || pancake.layers[0].nextBucketAggregation == nil {
+		return
+	}
+
+	firstLayer := pancake.layers[0]
+	if _, isGlobal := firstLayer.nextBucketAggregation.queryType.(bucket_aggregations.Global); !isGlobal {
+		return
+	}
+
+	metricsPancake = a.moveFirstLayerMetricsToNewPancake(pancake)
+	pancake.whereClause = nil
+	pancake.whereClauseNarrowed = true
+	return
+}
+
+// createNestedPancakes only does something, if first layer aggregation is Nested.
+// Rows of `pancake` are going to be nested objects, not documents (see generateSelectCommand). Metrics from the first layer
+// (nested's siblings) need documents, so they're moved to a new pancake, which is returned (nil if there are none).
+func (a *pancakeTransformer) createNestedPancakes(pancake *pancakeModel) (metricsPancake *pancakeModel) {
+	if len(pancake.layers) == 0 || pancake.layers[0].nextBucketAggregation == nil {
+		return
+	}
+
+	if _, isNested := pancake.layers[0].nextBucketAggregation.queryType.(bucket_aggregations.Nested); !isNested {
+		return
+	}
+
+	metricsPancake = a.moveFirstLayerMetricsToNewPancake(pancake)
+	pancake.whereClauseNarrowed = true
+	return
+}
+
+// moveFirstLayerMetricsToNewPancake moves metrics from the first layer of `pancake` to a new pancake with the same
+// WHERE clause, and returns it (nil if there are no such metrics)
+func (a *pancakeTransformer) moveFirstLayerMetricsToNewPancake(pancake *pancakeModel) (metricsPancake *pancakeModel) {
+	firstLayer := pancake.layers[0]
+	if len(firstLayer.currentMetricAggregations) == 0 {
+		return nil
+	}
+
+	metricsLayer := newPancakeModelLayer(nil)
+	metricsLayer.currentMetricAggregations = firstLayer.currentMetricAggregations
+	metricsPancake = &pancakeModel{
+		layers:      []*pancakeModelLayer{metricsLayer},
+		whereClause: pancake.whereClause,
+		sampleLimit: pancake.sampleLimit,
+	}
+	firstLayer.currentMetricAggregations = make([]*pancakeModelMetricAggregation, 0)
+	return metricsPancake
+}
+
 // createFiltersPancakes only does something, if first layer aggregation is Filters.
 // It creates new pancakes for each filter in that aggregation, and updates `pancake` to have only first filter.
 func (a *pancakeTransformer) createFiltersPancakes(pancake *pancakeModel) (newPancakes []*pancakeModel) {
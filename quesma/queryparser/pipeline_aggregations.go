@@ -3,17 +3,23 @@
 package queryparser
 
 import (
+	"quesma/kibana"
 	"quesma/logger"
 	"quesma/model"
 	"quesma/model/pipeline_aggregations"
+	"quesma/queryparser/painless"
+	"quesma/schema"
 	"quesma/util"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // CAUTION: maybe "return" everywhere isn't corrent, as maybe there can be multiple pipeline aggregations at one level.
 // But I've tested some complex queries and it seems to not be the case. So let's keep it this way for now.
 func (cw *ClickhouseQueryTranslator) parsePipelineAggregations(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
-	if aggregationType, success = cw.parseBucketScriptBasic(queryMap); success {
+	if aggregationType, success = cw.parseBucketScript(queryMap); success {
 		delete(queryMap, "bucket_script")
 		return
 	}
@@ -21,6 +27,14 @@ func (cw *ClickhouseQueryTranslator) parsePipelineAggregations(queryMap QueryMap
 		delete(queryMap, "cumulative_sum")
 		return
 	}
+	if aggregationType, success = cw.parseCumulativeCardinality(queryMap); success {
+		delete(queryMap, "cumulative_cardinality")
+		return
+	}
+	if aggregationType, success = cw.parseNormalize(queryMap); success {
+		delete(queryMap, "normalize")
+		return
+	}
 	if aggregationType, success = cw.parseDerivative(queryMap); success {
 		delete(queryMap, "derivative")
 		return
@@ -45,6 +59,38 @@ func (cw *ClickhouseQueryTranslator) parsePipelineAggregations(queryMap QueryMap
 		delete(queryMap, "sum_bucket")
 		return
 	}
+	if aggregationType, success = cw.parseStatsBucket(queryMap); success {
+		delete(queryMap, "stats_bucket")
+		return
+	}
+	if aggregationType, success = cw.parseExtendedStatsBucket(queryMap); success {
+		delete(queryMap, "extended_stats_bucket")
+		return
+	}
+	if aggregationType, success = cw.parsePercentilesBucket(queryMap); success {
+		delete(queryMap, "percentiles_bucket")
+		return
+	}
+	if aggregationType, success = cw.parseBucketSelector(queryMap); success {
+		delete(queryMap, "bucket_selector")
+		return
+	}
+	if aggregationType, success = cw.parseBucketSort(queryMap); success {
+		delete(queryMap, "bucket_sort")
+		return
+	}
+	if aggregationType, success = cw.parseMovingFn(queryMap); success {
+		delete(queryMap, "moving_fn")
+		return
+	}
+	if aggregationType, success = cw.parseMovingAvg(queryMap); success {
+		delete(queryMap, "moving_avg")
+		return
+	}
+	if aggregationType, success = cw.parseMovingPercentiles(queryMap); success {
+		delete(queryMap, "moving_percentiles")
+		return
+	}
 	return
 }
 
@@ -60,6 +106,37 @@ func (cw *ClickhouseQueryTranslator) parseCumulativeSum(queryMap QueryMap) (aggr
 	return pipeline_aggregations.NewCumulativeSum(cw.Ctx, bucketsPath), true
 }
 
+func (cw *ClickhouseQueryTranslator) parseCumulativeCardinality(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	cumulativeCardinalityRaw, exists := queryMap["cumulative_cardinality"]
+	if !exists {
+		return
+	}
+	bucketsPath, ok := cw.parseBucketsPath(cumulativeCardinalityRaw, "cumulative_cardinality")
+	if !ok {
+		return
+	}
+	return pipeline_aggregations.NewCumulativeCardinality(cw.Ctx, bucketsPath), true
+}
+
+func (cw *ClickhouseQueryTranslator) parseNormalize(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	normalizeRaw, exists := queryMap["normalize"]
+	if !exists {
+		return
+	}
+	bucketsPath, ok := cw.parseBucketsPath(normalizeRaw, "normalize")
+	if !ok {
+		return
+	}
+	method := pipeline_aggregations.NormalizeMethod(cw.parseStringField(normalizeRaw.(QueryMap), "method", "")) // parseBucketsPath already checked it's a map
+	switch method {
+	case pipeline_aggregations.NormalizeRescale01, pipeline_aggregations.NormalizeRescale0100, pipeline_aggregations.NormalizePercentOfSum,
+		pipeline_aggregations.NormalizeMean, pipeline_aggregations.NormalizeZScore, pipeline_aggregations.NormalizeSoftmax:
+		return pipeline_aggregations.NewNormalize(cw.Ctx, bucketsPath, method), true
+	}
+	logger.WarnWithCtx(cw.Ctx).Msgf("unsupported method in normalize: %s. Skipping this aggregation", method)
+	return
+}
+
 func (cw *ClickhouseQueryTranslator) parseDerivative(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
 	derivativeRaw, exists := queryMap["derivative"]
 	if !exists {
@@ -69,7 +146,22 @@ func (cw *ClickhouseQueryTranslator) parseDerivative(queryMap QueryMap) (aggrega
 	if !ok {
 		return
 	}
-	return pipeline_aggregations.NewDerivative(cw.Ctx, bucketsPath), true
+
+	// unit, e.g. "1s" or "day": derivative is additionally normalized to this unit of the histogram's key
+	var unit time.Duration
+	if unitRaw, exists := derivativeRaw.(QueryMap)["unit"]; exists { // parseBucketsPath already checked it's a map
+		unitStr, isString := unitRaw.(string)
+		if !isString {
+			logger.WarnWithCtx(cw.Ctx).Msgf("unit in derivative is not a string, but %T, value: %v. Skipping this aggregation", unitRaw, unitRaw)
+			return
+		}
+		var err error
+		if unit, err = kibana.ParseInterval(unitStr); err != nil || unit <= 0 {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid unit in derivative: %s. Skipping this aggregation", unitStr)
+			return
+		}
+	}
+	return pipeline_aggregations.NewDerivative(cw.Ctx, bucketsPath, unit), true
 }
 
 func (cw *ClickhouseQueryTranslator) parseAverageBucket(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
@@ -120,6 +212,88 @@ func (cw *ClickhouseQueryTranslator) parseSumBucket(queryMap QueryMap) (aggregat
 	return pipeline_aggregations.NewSumBucket(cw.Ctx, bucketsPath), true
 }
 
+func (cw *ClickhouseQueryTranslator) parseStatsBucket(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	statsBucketRaw, exists := queryMap["stats_bucket"]
+	if !exists {
+		return
+	}
+	bucketsPath, ok := cw.parseBucketsPath(statsBucketRaw, "stats_bucket")
+	if !ok {
+		return
+	}
+	gapPolicy, ok := cw.parseGapPolicy(statsBucketRaw.(QueryMap)) // parseBucketsPath already checked it's a map
+	if !ok {
+		return
+	}
+	return pipeline_aggregations.NewStatsBucket(cw.Ctx, bucketsPath, gapPolicy), true
+}
+
+func (cw *ClickhouseQueryTranslator) parseExtendedStatsBucket(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	extendedStatsBucketRaw, exists := queryMap["extended_stats_bucket"]
+	if !exists {
+		return
+	}
+	bucketsPath, ok := cw.parseBucketsPath(extendedStatsBucketRaw, "extended_stats_bucket")
+	if !ok {
+		return
+	}
+	extendedStatsBucket := extendedStatsBucketRaw.(QueryMap) // parseBucketsPath already checked it's a map
+	gapPolicy, ok := cw.parseGapPolicy(extendedStatsBucket)
+	if !ok {
+		return
+	}
+	const defaultSigma = 2.0
+	sigma := cw.parseFloatField(extendedStatsBucket, "sigma", defaultSigma)
+	if sigma < 0 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("sigma in extended_stats_bucket must be non-negative, got: %f. Skipping this aggregation", sigma)
+		return
+	}
+	return pipeline_aggregations.NewExtendedStatsBucket(cw.Ctx, bucketsPath, gapPolicy, sigma), true
+}
+
+func (cw *ClickhouseQueryTranslator) parsePercentilesBucket(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	percentilesBucketRaw, exists := queryMap["percentiles_bucket"]
+	if !exists {
+		return
+	}
+	bucketsPath, ok := cw.parseBucketsPath(percentilesBucketRaw, "percentiles_bucket")
+	if !ok {
+		return
+	}
+	percentilesBucket := percentilesBucketRaw.(QueryMap) // parseBucketsPath already checked it's a map
+	gapPolicy, ok := cw.parseGapPolicy(percentilesBucket)
+	if !ok {
+		return
+	}
+
+	percents := pipeline_aggregations.PercentilesBucketDefaultPercents
+	if percentsRaw, exists := percentilesBucket["percents"]; exists {
+		percentsList, ok := percentsRaw.([]any)
+		if !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("percents in percentiles_bucket is not an array, but %T, value: %v. Skipping this aggregation", percentsRaw, percentsRaw)
+			return
+		}
+		percents = make([]float64, 0, len(percentsList))
+		for _, percentRaw := range percentsList {
+			percent, ok := percentRaw.(float64)
+			if !ok || percent < 0 || percent > 100 {
+				logger.WarnWithCtx(cw.Ctx).Msgf("invalid percent in percentiles_bucket: %v. Skipping this aggregation", percentRaw)
+				return
+			}
+			percents = append(percents, percent)
+		}
+	}
+
+	keyed := true
+	if keyedRaw, exists := percentilesBucket["keyed"]; exists {
+		if keyed, ok = keyedRaw.(bool); !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("keyed in percentiles_bucket is not a boolean, but %T, value: %v. Skipping this aggregation", keyedRaw, keyedRaw)
+			return
+		}
+	}
+	return pipeline_aggregations.NewPercentilesBucket(cw.Ctx, bucketsPath, gapPolicy, percents, keyed), true
+}
+
 func (cw *ClickhouseQueryTranslator) parseSerialDiff(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
 	serialDiffRaw, exists := queryMap["serial_diff"]
 	if !exists {
@@ -151,13 +325,12 @@ func (cw *ClickhouseQueryTranslator) parseSerialDiff(queryMap QueryMap) (aggrega
 	return
 }
 
-func (cw *ClickhouseQueryTranslator) parseBucketScriptBasic(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+func (cw *ClickhouseQueryTranslator) parseBucketScript(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
 	bucketScriptRaw, exists := queryMap["bucket_script"]
 	if !exists {
 		return
 	}
 
-	// so far we only handle "count" here :D
 	delete(queryMap, "bucket_script")
 	bucketScript, ok := bucketScriptRaw.(QueryMap)
 	if !ok {
@@ -165,47 +338,189 @@ func (cw *ClickhouseQueryTranslator) parseBucketScriptBasic(queryMap QueryMap) (
 		return
 	}
 
-	// if ["buckets_path"] != "_count", skip the aggregation
-	bucketsPath, ok := cw.parseBucketsPath(bucketScript, "bucket_script")
+	variables, ok := cw.parseBucketScriptVariables(bucketScript["buckets_path"])
+	if !ok {
+		return
+	}
+
+	source, expr, ok := cw.parsePipelineScript(bucketScript["script"], variables, "bucket_script")
 	if !ok {
 		return
 	}
-	if !strings.HasSuffix(bucketsPath, pipeline_aggregations.BucketsPathCount) {
-		logger.WarnWithCtx(cw.Ctx).Msgf("buckets_path is not '_count', but %s. Skipping this aggregation", bucketsPath)
+
+	// We return just 1 path as the parent (for the smallest key, for determinism). Other variables are found by name in the rows.
+	bucketsPath := variables[util.MapKeysSorted(variables)[0]]
+	return pipeline_aggregations.NewBucketScript(cw.Ctx, bucketsPath, source, variables, expr), true
+}
+
+// parsePipelineScript parses script of bucket_script/bucket_selector. buckets_path variables are passed to the script
+// as column references, their values are taken from rows (or buckets) later.
+func (cw *ClickhouseQueryTranslator) parsePipelineScript(scriptRaw any, variables map[string]string, aggregationName string) (
+	source string, expr model.Expr, success bool) {
+
+	var params QueryMap
+	switch script := scriptRaw.(type) {
+	case string:
+		source = script
+	case QueryMap:
+		var ok bool
+		if source, ok = script["source"].(string); !ok {
+			logger.WarnWithCtx(cw.Ctx).Msgf("source is not a string, but %T, value: %v. Skipping this aggregation", script["source"], script["source"])
+			return
+		}
+		params, _ = script["params"].(QueryMap)
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("script is not a string or a map, but %T, value: %v. Skipping this aggregation", script, script)
+		return
+	}
+
+	scriptParams := painless.LiteralParams(params)
+	for name := range variables {
+		scriptParams[name] = model.NewColumnRef(name)
+	}
+	expr, err := painless.ParseScript(source, scriptParams, schema.Schema{})
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't parse %s: %v. Skipping this aggregation", aggregationName, err)
 		return
 	}
+	return source, expr, true
+}
 
-	scriptRaw, exists := bucketScript["script"]
+func (cw *ClickhouseQueryTranslator) parseBucketSelector(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	bucketSelectorRaw, exists := queryMap["bucket_selector"]
 	if !exists {
-		logger.WarnWithCtx(cw.Ctx).Msg("no script in bucket_script. Skipping this aggregation")
 		return
 	}
-	if script, ok := scriptRaw.(string); ok {
-		return pipeline_aggregations.NewBucketScript(cw.Ctx, bucketsPath, script), true
+
+	delete(queryMap, "bucket_selector")
+	bucketSelector, ok := bucketSelectorRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("bucket_selector is not a map, but %T, value: %v. Skipping this aggregation", bucketSelectorRaw, bucketSelectorRaw)
+		return
 	}
 
-	script, ok := scriptRaw.(QueryMap)
+	variables, ok := cw.parseBucketScriptVariables(bucketSelector["buckets_path"])
+	if !ok {
+		return
+	}
+	source, expr, ok := cw.parsePipelineScript(bucketSelector["script"], variables, "bucket_selector")
+	if !ok {
+		return
+	}
+	gapPolicy, ok := cw.parseGapPolicy(bucketSelector)
 	if !ok {
-		logger.WarnWithCtx(cw.Ctx).Msgf("script is not a map, but %T, value: %v. Skipping this aggregation", scriptRaw, scriptRaw)
 		return
 	}
-	if sourceRaw, exists := script["source"]; exists {
-		if source, ok := sourceRaw.(string); ok {
-			if source != "_value" && source != "count * 1" {
-				logger.WarnWithCtx(cw.Ctx).Msgf("source is not '_value'/'count * 1', but %s. Skipping this aggregation", source)
+	return pipeline_aggregations.NewBucketSelector(cw.Ctx, source, variables, expr, gapPolicy), true
+}
+
+func (cw *ClickhouseQueryTranslator) parseBucketSort(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	bucketSortRaw, exists := queryMap["bucket_sort"]
+	if !exists {
+		return
+	}
+
+	delete(queryMap, "bucket_sort")
+	bucketSort, ok := bucketSortRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("bucket_sort is not a map, but %T, value: %v. Skipping this aggregation", bucketSortRaw, bucketSortRaw)
+		return
+	}
+
+	var sortFields []pipeline_aggregations.BucketSortField
+	sortRaw, exists := bucketSort["sort"]
+	if exists {
+		sortList, isList := sortRaw.([]any)
+		if !isList {
+			sortList = []any{sortRaw} // single sort field doesn't need to be in a list
+		}
+		for _, sortFieldRaw := range sortList {
+			sortField, ok := cw.parseBucketSortField(sortFieldRaw)
+			if !ok {
 				return
 			}
-		} else {
-			logger.WarnWithCtx(cw.Ctx).Msgf("source is not a string, but %T, value: %v. Skipping this aggregation", sourceRaw, sourceRaw)
-			return
+			sortFields = append(sortFields, sortField)
 		}
-	} else {
-		logger.WarnWithCtx(cw.Ctx).Msg("no source in script. Skipping this aggregation")
+	}
+
+	from := cw.parseIntField(bucketSort, "from", 0)
+	size := cw.parseIntField(bucketSort, "size", pipeline_aggregations.BucketSortNoSize)
+	if from < 0 || (size < 0 && size != pipeline_aggregations.BucketSortNoSize) {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid from: %d or size: %d in bucket_sort. Skipping this aggregation", from, size)
+		return
+	}
+	gapPolicy, ok := cw.parseGapPolicy(bucketSort)
+	if !ok {
 		return
 	}
+	return pipeline_aggregations.NewBucketSort(cw.Ctx, sortFields, from, size, gapPolicy), true
+}
+
+// parseBucketSortField parses a single sort field: "path", {"path": "desc"} or {"path": {"order": "desc"}}. Default order is asc.
+func (cw *ClickhouseQueryTranslator) parseBucketSortField(sortFieldRaw any) (sortField pipeline_aggregations.BucketSortField, success bool) {
+	switch field := sortFieldRaw.(type) {
+	case string:
+		return pipeline_aggregations.BucketSortField{Path: field, Direction: model.AscOrder}, true
+	case QueryMap:
+		if len(field) != 1 {
+			break
+		}
+		for path, orderRaw := range field {
+			order := orderRaw
+			if orderMap, isMap := orderRaw.(QueryMap); isMap {
+				order = orderMap["order"]
+			}
+			switch order {
+			case "asc", nil:
+				return pipeline_aggregations.BucketSortField{Path: path, Direction: model.AscOrder}, true
+			case "desc":
+				return pipeline_aggregations.BucketSortField{Path: path, Direction: model.DescOrder}, true
+			}
+		}
+	}
+
+	logger.WarnWithCtx(cw.Ctx).Msgf("invalid sort field in bucket_sort: %v (type: %T). Skipping this aggregation", sortFieldRaw, sortFieldRaw)
+	return
+}
+
+func (cw *ClickhouseQueryTranslator) parseGapPolicy(pipeline QueryMap) (gapPolicy pipeline_aggregations.GapPolicy, success bool) {
+	gapPolicyRaw, exists := pipeline["gap_policy"]
+	if !exists {
+		return pipeline_aggregations.GapPolicySkip, true
+	}
+	switch gapPolicyRaw {
+	case "skip", "keep_values":
+		return pipeline_aggregations.GapPolicySkip, true
+	case "insert_zeros":
+		return pipeline_aggregations.GapPolicyInsertZeros, true
+	}
+	logger.WarnWithCtx(cw.Ctx).Msgf("unsupported gap_policy: %v. Skipping this aggregation", gapPolicyRaw)
+	return
+}
+
+// parseBucketScriptVariables returns variable name -> buckets path. For a single string path the variable is `_value`.
+func (cw *ClickhouseQueryTranslator) parseBucketScriptVariables(bucketsPathRaw any) (variables map[string]string, success bool) {
+	switch bucketsPath := bucketsPathRaw.(type) {
+	case string:
+		return map[string]string{"_value": bucketsPath}, true
+	case QueryMap:
+		if len(bucketsPath) == 0 {
+			break
+		}
+		variables = make(map[string]string, len(bucketsPath))
+		for name, pathRaw := range bucketsPath {
+			path, ok := pathRaw.(string)
+			if !ok {
+				logger.WarnWithCtx(cw.Ctx).Msgf("buckets_path is not a map with string values, but %T. Skipping this aggregation", pathRaw)
+				return nil, false
+			}
+			variables[name] = path
+		}
+		return variables, true
+	}
 
-	// okay, we've checked everything, it's indeed a simple count
-	return pipeline_aggregations.NewBucketScript(cw.Ctx, bucketsPath, ""), true
+	logger.WarnWithCtx(cw.Ctx).Msgf("buckets_path in wrong format, type: %T, value: %v. Skipping this aggregation", bucketsPathRaw, bucketsPathRaw)
+	return nil, false
 }
 
 func (cw *ClickhouseQueryTranslator) parseBucketsPath(shouldBeQueryMap any, aggregationName string) (bucketsPathStr string, success bool) {
@@ -245,3 +560,164 @@ func (cw *ClickhouseQueryTranslator) parseBucketsPath(shouldBeQueryMap any, aggr
 	logger.WarnWithCtx(cw.Ctx).Msgf("buckets_path in wrong format, type: %T, value: %v", bucketsPathRaw, bucketsPathRaw)
 	return
 }
+
+func (cw *ClickhouseQueryTranslator) parseMovingFn(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	movingFnRaw, exists := queryMap["moving_fn"]
+	if !exists {
+		return
+	}
+
+	bucketsPath, ok := cw.parseBucketsPath(movingFnRaw, "moving_fn")
+	if !ok {
+		return
+	}
+	movingFn := movingFnRaw.(QueryMap) // parseBucketsPath already checked it's a map
+	window := cw.parseIntField(movingFn, "window", 0)
+	if window <= 0 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("window in moving_fn must be a positive integer, got: %v. Skipping this aggregation", movingFn["window"])
+		return
+	}
+	shift := cw.parseIntField(movingFn, "shift", 0)
+
+	var params QueryMap
+	var source string
+	switch script := movingFn["script"].(type) {
+	case string:
+		source = script
+	case QueryMap:
+		source, _ = script["source"].(string)
+		params, _ = script["params"].(QueryMap)
+	}
+	function, functionName, ok := cw.parseMovingFunction(source, params)
+	if !ok {
+		return
+	}
+	return pipeline_aggregations.NewMovingFn(cw.Ctx, bucketsPath, function, functionName, window, shift), true
+}
+
+// movingFunctionRegex matches e.g. "MovingFunctions.ewma(values, 0.3)" or "return MovingFunctions.max(values);"
+var movingFunctionRegex = regexp.MustCompile(`^\s*(?:return\s+)?MovingFunctions\.(\w+)\(\s*values\s*(?:,(.*))?\)\s*;?\s*$`)
+
+// parseMovingFunction parses moving_fn's script. We support only calls of Elastic's pre-built MovingFunctions,
+// not arbitrary scripts. Arguments (after values) can be numbers or params.
+func (cw *ClickhouseQueryTranslator) parseMovingFunction(source string, params QueryMap) (
+	function pipeline_aggregations.MovingFunction, functionName string, success bool) {
+
+	match := movingFunctionRegex.FindStringSubmatch(source)
+	if match == nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported script in moving_fn: %s. Only MovingFunctions are supported. Skipping this aggregation", source)
+		return
+	}
+	functionName = match[1]
+	var args []string
+	if strings.TrimSpace(match[2]) != "" {
+		args = strings.Split(match[2], ",")
+	}
+	numericArgs := make([]float64, 0, len(args))
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "MovingFunctions.unweightedAvg(values)" {
+			// stdDev's 2nd argument, MovingStdDev computes the average itself
+			continue
+		}
+		if paramName, isParam := strings.CutPrefix(arg, "params."); isParam {
+			if value, ok := params[paramName].(float64); ok {
+				numericArgs = append(numericArgs, value)
+				continue
+			}
+		} else if value, err := strconv.ParseFloat(arg, 64); err == nil {
+			numericArgs = append(numericArgs, value)
+			continue
+		}
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported argument: %s of MovingFunctions.%s. Skipping this aggregation", arg, functionName)
+		return
+	}
+
+	argsCount := map[string]int{"max": 0, "min": 0, "sum": 0, "unweightedAvg": 0, "linearWeightedAvg": 0, "stdDev": 0, "ewma": 1, "holt": 2}
+	if expectedCount, supported := argsCount[functionName]; !supported || expectedCount != len(numericArgs) {
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported function: MovingFunctions.%s with arguments: %v. Skipping this aggregation", functionName, args)
+		return
+	}
+	switch functionName {
+	case "max":
+		function = pipeline_aggregations.MovingMax
+	case "min":
+		function = pipeline_aggregations.MovingMin
+	case "sum":
+		function = pipeline_aggregations.MovingSum
+	case "unweightedAvg":
+		function = pipeline_aggregations.MovingUnweightedAvg
+	case "linearWeightedAvg":
+		function = pipeline_aggregations.MovingLinearWeightedAvg
+	case "stdDev":
+		function = pipeline_aggregations.MovingStdDev
+	case "ewma":
+		function = pipeline_aggregations.MovingEwma(numericArgs[0])
+	case "holt":
+		function = pipeline_aggregations.MovingHolt(numericArgs[0], numericArgs[1])
+	}
+	return function, functionName, true
+}
+
+// parseMovingAvg parses deprecated moving_avg, which is moving_fn with one of a few fixed models.
+func (cw *ClickhouseQueryTranslator) parseMovingAvg(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	movingAvgRaw, exists := queryMap["moving_avg"]
+	if !exists {
+		return
+	}
+
+	bucketsPath, ok := cw.parseBucketsPath(movingAvgRaw, "moving_avg")
+	if !ok {
+		return
+	}
+	movingAvg := movingAvgRaw.(QueryMap) // parseBucketsPath already checked it's a map
+	const defaultWindow = 5
+	window := cw.parseIntField(movingAvg, "window", defaultWindow)
+	if window <= 0 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("window in moving_avg must be a positive integer, got: %v. Skipping this aggregation", movingAvg["window"])
+		return
+	}
+	if _, exists = movingAvg["predict"]; exists {
+		logger.WarnWithCtx(cw.Ctx).Msg("predict in moving_avg is not supported. Skipping this aggregation")
+		return
+	}
+
+	settings, _ := movingAvg["settings"].(QueryMap)
+	const defaultAlpha, defaultBeta = 0.3, 0.1
+	var function pipeline_aggregations.MovingFunction
+	modelName := cw.parseStringField(movingAvg, "model", "simple")
+	switch modelName {
+	case "simple":
+		function = pipeline_aggregations.MovingUnweightedAvg
+	case "linear":
+		function = pipeline_aggregations.MovingLinearWeightedAvg
+	case "ewma":
+		function = pipeline_aggregations.MovingEwma(cw.parseFloatField(settings, "alpha", defaultAlpha))
+	case "holt":
+		function = pipeline_aggregations.MovingHolt(cw.parseFloatField(settings, "alpha", defaultAlpha), cw.parseFloatField(settings, "beta", defaultBeta))
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported model in moving_avg: %s. Skipping this aggregation", modelName)
+		return
+	}
+	return pipeline_aggregations.NewMovingAvg(cw.Ctx, bucketsPath, function, modelName, window), true
+}
+
+func (cw *ClickhouseQueryTranslator) parseMovingPercentiles(queryMap QueryMap) (aggregationType model.QueryType, success bool) {
+	movingPercentilesRaw, exists := queryMap["moving_percentiles"]
+	if !exists {
+		return
+	}
+
+	bucketsPath, ok := cw.parseBucketsPath(movingPercentilesRaw, "moving_percentiles")
+	if !ok {
+		return
+	}
+	movingPercentiles := movingPercentilesRaw.(QueryMap) // parseBucketsPath already checked it's a map
+	window := cw.parseIntField(movingPercentiles, "window", 0)
+	if window <= 0 {
+		logger.WarnWithCtx(cw.Ctx).Msgf("window in moving_percentiles must be a positive integer, got: %v. Skipping this aggregation", movingPercentiles["window"])
+		return
+	}
+	shift := cw.parseIntField(movingPercentiles, "shift", 0)
+	return pipeline_aggregations.NewMovingPercentiles(cw.Ctx, bucketsPath, window, shift), true
+}
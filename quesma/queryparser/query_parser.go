@@ -4,7 +4,6 @@ package queryparser
 
 import (
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/k0kubun/pp"
@@ -18,8 +17,10 @@ import (
 	"quesma/quesma/types"
 	"quesma/schema"
 	"quesma/util"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -67,11 +68,18 @@ func (cw *ClickhouseQueryTranslator) ParseQuery(body types.JSON) (*model.Executi
 		queries = append(queries, countQuery)
 	}
 
-	if listQuery := cw.buildListQueryIfNeeded(simpleQuery, hitsInfo, highlighter); listQuery != nil {
+	listQuery, err := cw.buildListQueryIfNeeded(simpleQuery, hitsInfo, highlighter)
+	if err != nil {
+		return &model.ExecutionPlan{}, err
+	}
+	if listQuery != nil {
 		queries = append(queries, listQuery)
 	}
 
-	runtimeMappings := ParseRuntimeMappings(body) // we apply post query transformer for certain aggregation types
+	runtimeMappings, err := ParseRuntimeMappings(body, cw.Schema)
+	if err != nil {
+		return &model.ExecutionPlan{}, err
+	}
 
 	// we apply post query transformer for certain aggregation types
 	// this should be a part of the query parsing process
@@ -102,8 +110,33 @@ func (cw *ClickhouseQueryTranslator) ParseQuery(body types.JSON) (*model.Executi
 	return plan, err
 }
 
+// ParseWhereClause translates only the "query" part of the request body, e.g. for _delete_by_query.
+// Missing query means all documents, so nil is returned then.
+func (cw *ClickhouseQueryTranslator) ParseWhereClause(body types.JSON) (model.Expr, error) {
+	simpleQuery, _, _, err := cw.parseQueryInternal(body)
+	if err != nil {
+		return nil, err
+	}
+	if !simpleQuery.CanParse {
+		return nil, fmt.Errorf("can't parse query: %v", body["query"])
+	}
+	return simpleQuery.WhereClause, nil
+}
+
 func (cw *ClickhouseQueryTranslator) buildListQueryIfNeeded(
-	simpleQuery *model.SimpleQuery, queryInfo model.HitsCountInfo, highlighter model.Highlighter) *model.Query {
+	simpleQuery *model.SimpleQuery, queryInfo model.HitsCountInfo, highlighter model.Highlighter) (*model.Query, error) {
+
+	// search_after narrows down only hits, total count and aggregations are computed for the whole query
+	if len(queryInfo.SearchAfter) > 0 {
+		condition, err := cw.searchAfterCondition(simpleQuery.OrderBy, queryInfo.SearchAfter)
+		if err != nil {
+			return nil, err
+		}
+		simpleQueryAfter := *simpleQuery
+		simpleQueryAfter.WhereClause = model.And([]model.Expr{simpleQuery.WhereClause, condition})
+		simpleQuery = &simpleQueryAfter
+	}
+
 	var fullQuery *model.Query
 	switch queryInfo.Typ {
 	case model.ListByField:
@@ -119,9 +152,10 @@ func (cw *ClickhouseQueryTranslator) buildListQueryIfNeeded(
 		queryType := typical_queries.NewHits(cw.Ctx, cw.Table, &highlighter, fullQuery.SelectCommand.OrderByFieldNames(), true, false, false, cw.Indexes)
 		fullQuery.Type = &queryType
 		fullQuery.Highlighter = highlighter
+		fullQuery.SelectCommand.Offset = queryInfo.From
 	}
 
-	return fullQuery
+	return fullQuery, nil
 }
 
 func (cw *ClickhouseQueryTranslator) buildCountQueryIfNeeded(simpleQuery *model.SimpleQuery, queryInfo model.HitsCountInfo) *model.Query {
@@ -152,6 +186,12 @@ func (cw *ClickhouseQueryTranslator) parseQueryInternal(body types.JSON) (*model
 
 	if sortPart, ok := queryAsMap["sort"]; ok {
 		parsedQuery.OrderBy = cw.parseSortFields(sortPart)
+		// pages of search_after (or point in time) paging must be sorted in a total order
+		_, searchAfter := queryAsMap["search_after"]
+		_, pointInTime := queryAsMap["pit"]
+		if searchAfter || pointInTime {
+			parsedQuery.OrderBy = append(parsedQuery.OrderBy, cw.totalOrderTiebreakers(parsedQuery.OrderBy)...)
+		}
 	}
 	size := cw.parseSize(queryAsMap, defaultQueryResultSize)
 
@@ -172,8 +212,16 @@ func (cw *ClickhouseQueryTranslator) parseQueryInternal(body types.JSON) (*model
 		}
 	}
 
+	from := cw.parseFrom(queryAsMap)
+	searchAfter, err := cw.parseSearchAfter(queryAsMap)
+	if err != nil {
+		return &parsedQuery, model.NewEmptyHitsCountInfo(), highlighter, err
+	}
+
 	queryInfo := cw.tryProcessSearchMetadata(queryAsMap)
 	queryInfo.Size = size
+	queryInfo.From = from
+	queryInfo.SearchAfter = searchAfter
 	queryInfo.TrackTotalHits = trackTotalHits
 
 	return &parsedQuery, queryInfo, highlighter, nil
@@ -307,6 +355,9 @@ func (cw *ClickhouseQueryTranslator) parseQueryMap(queryMap QueryMap) model.Simp
 		"simple_query_string": cw.parseQueryString,
 		"regexp":              cw.parseRegexp,
 		"geo_bounding_box":    cw.parseGeoBoundingBox,
+		"geo_distance":        cw.parseGeoDistance,
+		"geo_polygon":         cw.parseGeoPolygon,
+		"geo_shape":           cw.parseGeoShape,
 	}
 	for k, v := range queryMap {
 		if f, ok := parseMap[k]; ok {
@@ -363,19 +414,35 @@ func (cw *ClickhouseQueryTranslator) parseIds(queryMap QueryMap) model.SimpleQue
 		return model.NewSimpleQuery(nil, false)
 	}
 
+	// ids of documents ingested with their ids are stored in the _id column
+	var storedIdsStmt model.Expr
+	if cw.Table.HasColumn(cw.Ctx, model.DocumentIdFieldName) {
+		quotedIds := make([]string, len(ids))
+		for i, id := range ids {
+			quotedIds[i] = "'" + strings.ReplaceAll(strings.ReplaceAll(id, `\`, `\\`), "'", `\'`) + "'"
+		}
+		storedIdsStmt = model.NewInfixExpr(model.NewColumnRef(model.DocumentIdFieldName), " IN ", model.NewLiteral("("+strings.Join(quotedIds, ", ")+")"))
+	}
+
 	// when our generated ID appears in query looks like this: `1d<TRUNCATED>0b8q1`
 	// therefore we need to strip the hex part (before `q`) and convert it to decimal
 	// then we can query at DB level
-	for i, id := range ids {
-		idInHex := strings.Split(id, "q")[0]
-		if idAsStr, err := hex.DecodeString(idInHex); err != nil {
-			logger.Error().Msgf("error parsing document id %s: %v", id, err)
+	var generatedIds []string
+	for _, id := range ids {
+		if tsWithoutTZ, err := model.TimestampFromDocumentId(id); err != nil {
+			if storedIdsStmt != nil { // it's a stored id
+				continue
+			}
+			logger.Error().Msg(err.Error())
 			return model.NewSimpleQuery(nil, true)
 		} else {
-			tsWithoutTZ := strings.TrimSuffix(string(idAsStr), " +0000 UTC")
-			ids[i] = fmt.Sprintf("'%s'", tsWithoutTZ)
+			generatedIds = append(generatedIds, fmt.Sprintf("'%s'", tsWithoutTZ))
 		}
 	}
+	if len(generatedIds) == 0 {
+		return model.NewSimpleQuery(storedIdsStmt, true)
+	}
+	ids = generatedIds
 
 	var whereStmt model.Expr
 	// TODO replace with cw.Schema
@@ -401,10 +468,10 @@ func (cw *ClickhouseQueryTranslator) parseIds(queryMap QueryMap) model.SimpleQue
 			}
 		default:
 			logger.Warn().Msgf("timestamp field of unsupported type %s", v.Type.String())
-			return model.NewSimpleQuery(nil, true)
+			return model.NewSimpleQuery(storedIdsStmt, true)
 		}
 	}
-	return model.NewSimpleQuery(whereStmt, true)
+	return model.NewSimpleQuery(model.Or([]model.Expr{storedIdsStmt, whereStmt}), true)
 }
 
 // Parses each model.SimpleQuery separately, returns list of translated SQLs
@@ -754,7 +821,8 @@ func (cw *ClickhouseQueryTranslator) parseNested(queryMap QueryMap) model.Simple
 	return model.NewSimpleQuery(nil, false)
 }
 
-func (cw *ClickhouseQueryTranslator) parseDateMathExpression(expr string) (string, error) {
+// parseDateMathExpression parses date math, e.g. now-1d/d. timeZone (may be empty) is Elastic's time_zone parameter.
+func (cw *ClickhouseQueryTranslator) parseDateMathExpression(expr, timeZone string) (string, error) {
 	expr = strings.ReplaceAll(expr, "'", "")
 
 	exp, err := ParseDateMathExpression(expr)
@@ -762,7 +830,7 @@ func (cw *ClickhouseQueryTranslator) parseDateMathExpression(expr string) (strin
 		return "", err
 	}
 
-	builder := DateMathExpressionRendererFactory(cw.DateMathRenderer)
+	builder := DateMathExpressionRendererFactory(cw.DateMathRenderer, timeZone)
 	if builder == nil {
 		return "", fmt.Errorf("no date math expression renderer found: %s", cw.DateMathRenderer)
 	}
@@ -794,6 +862,7 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 			continue
 		}
 
+		timeZone := cw.parseTimeZone(v.(QueryMap))
 		keysSorted := util.MapKeysSorted(v.(QueryMap))
 		for _, op := range keysSorted {
 			valueRaw := v.(QueryMap)[op]
@@ -812,11 +881,10 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 			doneParsing, isQuoted := false, len(value) > 2 && value[0] == '\'' && value[len(value)-1] == '\''
 			switch fieldType {
 			case clickhouse.DateTime, clickhouse.DateTime64:
-				// TODO add support for "time_zone" parameter in ParseRange
-				finalValue, doneParsing = dateManager.ParseRange(value) // stage 1
+				finalValue, doneParsing = dateManager.ParseRange(value, timeZone) // stage 1
 
 				if !doneParsing && (op == "gte" || op == "lte" || op == "gt" || op == "lt") { // stage 2
-					parsed, err := cw.parseDateMathExpression(value)
+					parsed, err := cw.parseDateMathExpression(value, timeZone)
 					if err == nil {
 						doneParsing = true
 						finalValue = model.NewLiteral(parsed)
@@ -824,7 +892,7 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 				}
 
 				if !doneParsing && isQuoted { // stage 3
-					finalValue, doneParsing = dateManager.ParseRange(value[1 : len(value)-1])
+					finalValue, doneParsing = dateManager.ParseRange(value[1:len(value)-1], timeZone)
 				}
 			case clickhouse.Invalid:
 				if isQuoted {
@@ -861,8 +929,8 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 			case "lt":
 				stmt := model.NewInfixExpr(field, "<", finalValue)
 				stmts = append(stmts, stmt)
-			case "format":
-				// ignored
+			case "format", "time_zone":
+				// ignored (time_zone is already parsed)
 			default:
 				logger.WarnWithCtx(cw.Ctx).Msgf("invalid range operator: %s", op)
 			}
@@ -875,6 +943,20 @@ func (cw *ClickhouseQueryTranslator) parseRange(queryMap QueryMap) model.SimpleQ
 	return model.NewSimpleQuery(nil, false)
 }
 
+// parseTimeZone returns time_zone parameter (e.g. of range query), or empty string if it's missing or invalid.
+// Only IANA time zones (e.g. "Europe/Warsaw") are supported, not offsets like "+01:00".
+func (cw *ClickhouseQueryTranslator) parseTimeZone(queryMap QueryMap) string {
+	timeZone := cw.parseStringField(queryMap, "time_zone", "")
+	if timeZone == "" {
+		return ""
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("unsupported time_zone: %s, err: %v. Using UTC.", timeZone, err)
+		return ""
+	}
+	return timeZone
+}
+
 // TODO: not supported:
 // - The field has "index" : false and "doc_values" : false set in the mapping
 // - The length of the field value exceeded an ignore_above setting in the mapping
@@ -1130,8 +1212,53 @@ func (cw *ClickhouseQueryTranslator) extractInterval(queryMap QueryMap) (interva
 	return defaultInterval, defaultIntervalType
 }
 
+// sortTiebreakers are Elastic's sort fields with the index order of documents, they make the sort unique.
+// We sort by the document id column instead, if the table has it.
+var sortTiebreakers = []string{"_doc", "_shard_doc"}
+
+// sortTiebreaker returns the document id column, if fieldName is a tiebreaker and the table stores document ids
+func (cw *ClickhouseQueryTranslator) sortTiebreaker(fieldName string) (string, bool) {
+	if slices.Contains(sortTiebreakers, fieldName) && cw.Table.HasColumn(cw.Ctx, model.DocumentIdFieldName) {
+		return model.DocumentIdFieldName, true
+	}
+	return "", false
+}
+
+// totalOrderTiebreakers returns sort columns, which make the order total, so that paging with search_after neither skips
+// nor repeats hits: the document id column, if the table stores document ids, or else all comparable columns
+// (rows equal on all of them are indistinguishable). Columns already in orderBy are skipped.
+// Like Elastic's implicit `_shard_doc` tiebreaker in point in time searches.
+func (cw *ClickhouseQueryTranslator) totalOrderTiebreakers(orderBy []model.OrderByExpr) []model.OrderByExpr {
+	var columns []string
+	if cw.Table.HasColumn(cw.Ctx, model.DocumentIdFieldName) {
+		columns = []string{model.DocumentIdFieldName}
+	} else {
+		for _, field := range cw.Schema.Fields {
+			if field.Type.IsComparable() && cw.Table.HasColumn(cw.Ctx, field.InternalPropertyName.AsString()) {
+				columns = append(columns, field.InternalPropertyName.AsString())
+			}
+		}
+		slices.Sort(columns)
+	}
+
+	sorted := make(map[string]bool)
+	for _, sortColumn := range orderBy {
+		if columnRef, ok := sortColumn.Expr.(model.ColumnRef); ok {
+			sorted[columnRef.ColumnName] = true
+		}
+	}
+	var tiebreakers []model.OrderByExpr
+	for _, column := range columns {
+		if !sorted[column] {
+			tiebreakers = append(tiebreakers, model.NewSortColumn(column, model.AscOrder))
+		}
+	}
+	return tiebreakers
+}
+
 // parseSortFields parses sort fields from the query
 // We're skipping ELK internal fields, like "_doc", "_id", etc. (we only accept field starting with "_" if it exists in our table)
+// Tiebreakers ("_doc", "_shard_doc") are replaced with the document id column, see sortTiebreaker.
 func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns []model.OrderByExpr) {
 	sortColumns = make([]model.OrderByExpr, 0)
 	switch sortMaps := sortMaps.(type) {
@@ -1145,12 +1272,15 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 
 			// sortMap has only 1 key, so we can just iterate over it
 			for k, v := range sortMap {
+				fieldName, isTiebreaker := cw.sortTiebreaker(k)
 				// TODO replace cw.Table.GetFieldInfo with schema.Field[]
-				if strings.HasPrefix(k, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, k)) == clickhouse.NotExists {
+				if !isTiebreaker && strings.HasPrefix(k, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, k)) == clickhouse.NotExists {
 					// we're skipping ELK internal fields, like "_doc", "_id", etc.
 					continue
 				}
-				fieldName := cw.ResolveField(cw.Ctx, k)
+				if !isTiebreaker {
+					fieldName = cw.ResolveField(cw.Ctx, k)
+				}
 				switch v := v.(type) {
 				case QueryMap:
 					if order, ok := v["order"]; ok {
@@ -1180,7 +1310,9 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 		return sortColumns
 	case map[string]interface{}:
 		for fieldName, fieldValue := range sortMaps {
-			if strings.HasPrefix(fieldName, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, fieldName)) == clickhouse.NotExists {
+			if tiebreaker, ok := cw.sortTiebreaker(fieldName); ok {
+				fieldName = tiebreaker
+			} else if strings.HasPrefix(fieldName, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, fieldName)) == clickhouse.NotExists {
 				// TODO Elastic internal fields will need to be supported in the future
 				continue
 			}
@@ -1197,7 +1329,9 @@ func (cw *ClickhouseQueryTranslator) parseSortFields(sortMaps any) (sortColumns
 
 	case map[string]string:
 		for fieldName, fieldValue := range sortMaps {
-			if strings.HasPrefix(fieldName, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, fieldName)) == clickhouse.NotExists {
+			if tiebreaker, ok := cw.sortTiebreaker(fieldName); ok {
+				fieldName = tiebreaker
+			} else if strings.HasPrefix(fieldName, "_") && cw.Table.GetFieldInfo(cw.Ctx, cw.ResolveField(cw.Ctx, fieldName)) == clickhouse.NotExists {
 				// TODO Elastic internal fields will need to be supported in the future
 				continue
 			}
@@ -1322,3 +1456,210 @@ func (cw *ClickhouseQueryTranslator) parseGeoBoundingBox(queryMap QueryMap) mode
 	}
 	return model.NewSimpleQuery(model.And(stmts), true)
 }
+
+// geoQueryParams are parameters of geo queries, which aren't field names
+var geoQueryParams = []string{"distance", "distance_type", "validation_method", "ignore_unmapped", "_name", "boost"}
+
+// geoQueryField returns the only field of a geo query (e.g. {"location": ..., "distance": "12km"} -> "location")
+func (cw *ClickhouseQueryTranslator) geoQueryField(queryMap QueryMap, queryType string) (field model.Expr, value any, ok bool) {
+	for k, v := range queryMap {
+		if slices.Contains(geoQueryParams, k) {
+			continue
+		}
+		if field != nil {
+			logger.WarnWithCtx(cw.Ctx).Msgf("more than one field in %s query: %v", queryType, queryMap)
+			return nil, nil, false
+		}
+		field, value = model.NewColumnRef(cw.ResolveField(cw.Ctx, k)), v
+	}
+	if field == nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no field in %s query: %v", queryType, queryMap)
+		return nil, nil, false
+	}
+	return field, value, true
+}
+
+// parseGeoDistance parses geo_distance query, which matches points within 'distance' from the given one.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-geo-distance-query.html
+func (cw *ClickhouseQueryTranslator) parseGeoDistance(queryMap QueryMap) model.SimpleQuery {
+	field, origin, ok := cw.geoQueryField(queryMap, "geo_distance")
+	if !ok {
+		return model.NewSimpleQuery(nil, false)
+	}
+	var meters float64
+	switch distance := queryMap["distance"].(type) {
+	case string:
+		var err error
+		if meters, err = parseDistance(distance, "m"); err != nil {
+			logger.WarnWithCtx(cw.Ctx).Msgf("invalid distance in geo_distance query: %v", err)
+			return model.NewSimpleQuery(nil, false)
+		}
+	case float64:
+		meters = distance
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("distance in geo_distance query is missing or invalid: %v", queryMap)
+		return model.NewSimpleQuery(nil, false)
+	}
+	originLat, originLon, err := parseGeoPoint(origin)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid point in geo_distance query: %v", err)
+		return model.NewSimpleQuery(nil, false)
+	}
+	distanceExpr, err := geoDistanceExpr(field, originLat, originLon, cw.parseStringField(queryMap, "distance_type", "arc"))
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't parse geo_distance query: %v", err)
+		return model.NewSimpleQuery(nil, false)
+	}
+	return model.NewSimpleQuery(model.NewInfixExpr(distanceExpr, "<=", geoCoordinateLiteral(meters)), true)
+}
+
+// parseGeoPolygon parses (deprecated, but still used) geo_polygon query.
+// https://www.elastic.co/guide/en/elasticsearch/reference/7.17/query-dsl-geo-polygon-query.html
+func (cw *ClickhouseQueryTranslator) parseGeoPolygon(queryMap QueryMap) model.SimpleQuery {
+	field, paramsRaw, ok := cw.geoQueryField(queryMap, "geo_polygon")
+	if !ok {
+		return model.NewSimpleQuery(nil, false)
+	}
+	params, ok := paramsRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_polygon's field is not a map, but %T, value: %v", paramsRaw, paramsRaw)
+		return model.NewSimpleQuery(nil, false)
+	}
+	points, ok := params["points"].([]any)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no points in geo_polygon query: %v", params)
+		return model.NewSimpleQuery(nil, false)
+	}
+	polygon, err := geoPolygonLiteral(points)
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("invalid polygon in geo_polygon query: %v", err)
+		return model.NewSimpleQuery(nil, false)
+	}
+	pointInPolygon, err := geoPointInPolygon(field, []model.Expr{polygon})
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't parse geo_polygon query: %v", err)
+		return model.NewSimpleQuery(nil, false)
+	}
+	return model.NewSimpleQuery(pointInPolygon, true)
+}
+
+// parseGeoShape parses geo_shape query over geo_point fields. Supported shapes: point, envelope, polygon and multipolygon.
+// For points all of 'intersects', 'within' relations are the same, 'disjoint' is their negation,
+// and 'contains' makes sense only for a point shape.
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-geo-shape-query.html
+func (cw *ClickhouseQueryTranslator) parseGeoShape(queryMap QueryMap) model.SimpleQuery {
+	field, paramsRaw, ok := cw.geoQueryField(queryMap, "geo_shape")
+	if !ok {
+		return model.NewSimpleQuery(nil, false)
+	}
+	params, ok := paramsRaw.(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_shape's field is not a map, but %T, value: %v", paramsRaw, paramsRaw)
+		return model.NewSimpleQuery(nil, false)
+	}
+	shape, ok := params["shape"].(QueryMap)
+	if !ok {
+		logger.WarnWithCtx(cw.Ctx).Msgf("no shape in geo_shape query (indexed_shape is not supported): %v", params)
+		return model.NewSimpleQuery(nil, false)
+	}
+	shapeType := strings.ToLower(cw.parseStringField(shape, "type", ""))
+	relation := strings.ToLower(cw.parseStringField(params, "relation", "intersects"))
+	if relation == "contains" && shapeType != "point" {
+		logger.WarnWithCtx(cw.Ctx).Msgf("geo_shape query with 'contains' relation is supported only for point shape, got: %s", shapeType)
+		return model.NewSimpleQuery(nil, false)
+	}
+
+	condition, err := cw.geoShapeCondition(field, shapeType, shape["coordinates"])
+	if err != nil {
+		logger.WarnWithCtx(cw.Ctx).Msgf("can't parse geo_shape query: %v", err)
+		return model.NewSimpleQuery(nil, false)
+	}
+	switch relation {
+	case "intersects", "within", "contains":
+		return model.NewSimpleQuery(condition, true)
+	case "disjoint":
+		return model.NewSimpleQuery(model.NewPrefixExpr("NOT", []model.Expr{condition}), true)
+	default:
+		logger.WarnWithCtx(cw.Ctx).Msgf("unknown relation in geo_shape query: %s", relation)
+		return model.NewSimpleQuery(nil, false)
+	}
+}
+
+// geoShapeCondition returns a condition checking if point from 'field' lies within a shape (GeoJSON-like coordinates: [lon, lat])
+func (cw *ClickhouseQueryTranslator) geoShapeCondition(field model.Expr, shapeType string, coordinatesRaw any) (model.Expr, error) {
+	lat, lon, err := geoLatLon(field)
+	if err != nil {
+		return nil, err
+	}
+	lat, lon = model.NewFunction("toFloat64", lat), model.NewFunction("toFloat64", lon)
+	coordinates, ok := coordinatesRaw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("coordinates are not an array, but %T, value: %v", coordinatesRaw, coordinatesRaw)
+	}
+
+	switch shapeType {
+	case "point":
+		pointLat, pointLon, err := parseGeoPoint(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return model.And([]model.Expr{
+			model.NewInfixExpr(lat, "=", geoCoordinateLiteral(pointLat)),
+			model.NewInfixExpr(lon, "=", geoCoordinateLiteral(pointLon)),
+		}), nil
+	case "envelope":
+		// [[minLon, maxLat], [maxLon, minLat]]
+		if len(coordinates) != 2 {
+			return nil, fmt.Errorf("envelope needs 2 points, got: %v", coordinates)
+		}
+		maxLat, minLon, err := parseGeoPoint(coordinates[0])
+		if err != nil {
+			return nil, err
+		}
+		minLat, maxLon, err := parseGeoPoint(coordinates[1])
+		if err != nil {
+			return nil, err
+		}
+		lonCondition := model.And([]model.Expr{
+			model.NewInfixExpr(lon, ">=", geoCoordinateLiteral(minLon)),
+			model.NewInfixExpr(lon, "<=", geoCoordinateLiteral(maxLon)),
+		})
+		if minLon > maxLon { // envelope crosses the dateline
+			lonCondition = model.Or([]model.Expr{
+				model.NewInfixExpr(lon, ">=", geoCoordinateLiteral(minLon)),
+				model.NewInfixExpr(lon, "<=", geoCoordinateLiteral(maxLon)),
+			})
+		}
+		return model.And([]model.Expr{
+			model.NewInfixExpr(lat, ">=", geoCoordinateLiteral(minLat)),
+			model.NewInfixExpr(lat, "<=", geoCoordinateLiteral(maxLat)),
+			lonCondition,
+		}), nil
+	case "polygon":
+		polygon, err := geoPolygonWithHoles(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return geoPointInPolygon(field, polygon)
+	case "multipolygon":
+		conditions := make([]model.Expr, 0, len(coordinates))
+		for _, polygonRaw := range coordinates {
+			polygonCoordinates, ok := polygonRaw.([]any)
+			if !ok {
+				return nil, fmt.Errorf("polygon in multipolygon is not an array, but %T, value: %v", polygonRaw, polygonRaw)
+			}
+			polygon, err := geoPolygonWithHoles(polygonCoordinates)
+			if err != nil {
+				return nil, err
+			}
+			condition, err := geoPointInPolygon(field, polygon)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		return model.Or(conditions), nil
+	default:
+		return nil, fmt.Errorf("unsupported shape type: %s", shapeType)
+	}
+}
@@ -74,6 +74,63 @@ var parseRangeTests = []parseRangeTest{
 		ENGINE = Memory`,
 		`("timestamp">=fromUnixTimestamp64Milli(1706881636000) AND "timestamp"<=fromUnixTimestamp64Milli(1707486436000))`,
 	},
+	{
+		"DateTime64 with time_zone, 02:30 doesn't exist in Warsaw (DST transition)",
+		QueryMap{
+			"timestamp": QueryMap{
+				"gte":       "2024-03-31T02:30:00",
+				"lt":        "2024-04-01",
+				"time_zone": "Europe/Warsaw",
+			},
+		},
+		`CREATE TABLE ` + tableName + `
+		( "message" String, "timestamp" DateTime64(3, 'UTC') )
+		ENGINE = Memory`,
+		`("timestamp">=toDateTime64('2024-03-31 02:30:00.000',3,'Europe/Warsaw') AND ` +
+			`"timestamp"<toDateTime64('2024-04-01 00:00:00.000',3,'Europe/Warsaw'))`,
+	},
+	{
+		"DateTime64 with time_zone, but explicit offset and epoch millis",
+		QueryMap{
+			"timestamp": QueryMap{
+				"gte":       "2024-02-02T13:47:16.029Z",
+				"lte":       "1707486436029",
+				"time_zone": "Europe/Warsaw",
+			},
+		},
+		`CREATE TABLE ` + tableName + `
+		( "message" String, "timestamp" DateTime64(3, 'UTC') )
+		ENGINE = Memory`,
+		`("timestamp">=fromUnixTimestamp64Milli(1706881636029) AND "timestamp"<=fromUnixTimestamp64Milli(1707486436029))`,
+	},
+	{
+		"date math with time_zone",
+		QueryMap{
+			"timestamp": QueryMap{
+				"gte":       "now-1d/d",
+				"lt":        "now/M",
+				"time_zone": "America/New_York",
+			},
+		},
+		`CREATE TABLE ` + tableName + `
+		( "message" String, "timestamp" DateTime64(3, 'UTC') )
+		ENGINE = Memory`,
+		`("timestamp">=toStartOfDay(subDate(now('America/New_York'), INTERVAL 1 day), 'America/New_York') AND ` +
+			`"timestamp"<toDateTime(toStartOfMonth(now('America/New_York')), 'America/New_York'))`,
+	},
+	{
+		"invalid time_zone is ignored",
+		QueryMap{
+			"timestamp": QueryMap{
+				"gte":       "2024-02-02T13:47:16",
+				"time_zone": "Mars/Olympus_Mons",
+			},
+		},
+		`CREATE TABLE ` + tableName + `
+		( "message" String, "timestamp" DateTime64(3, 'UTC') )
+		ENGINE = Memory`,
+		`"timestamp">=fromUnixTimestamp64Milli(1706881636000)`,
+	},
 }
 
 func Test_parseRange(t *testing.T) {
@@ -7,6 +7,7 @@ import (
 	"quesma/clickhouse"
 	"quesma/logger"
 	"quesma/model"
+	"quesma/model/bucket_aggregations"
 	"quesma/model/typical_queries"
 	"quesma/queryparser/query_util"
 	"quesma/quesma/config"
@@ -85,6 +86,13 @@ func (cw *ClickhouseQueryTranslator) MakeAsyncSearchResponse(ResultSet []model.Q
 func (cw *ClickhouseQueryTranslator) MakeAggregationPartOfResponse(queries []*model.Query, ResultSets [][]model.QueryResultRow) (model.JsonMap, error) {
 	aggregations := model.JsonMap{}
 
+	// background frequencies of significant_terms are needed to render their pancakes, so they go first
+	for i, query := range queries {
+		if background, isBackground := query.Type.(*bucket_aggregations.SignificantTermsBackground); isBackground && i < len(ResultSets) {
+			background.SetBackgroundRows(ResultSets[i])
+		}
+	}
+
 	for i, query := range queries {
 		if pancake, isPancake := query.Type.(PancakeQueryType); isPancake {
 			if i >= len(ResultSets) {
@@ -280,8 +288,10 @@ func (cw *ClickhouseQueryTranslator) BuildCountQuery(whereClause model.Expr, sam
 			nil,
 			model.NewTableRef(model.SingleTableNamePlaceHolder),
 			whereClause,
+			nil,
 			[]model.Expr{},
 			0,
+			0,
 			sampleLimit,
 			false,
 			nil,
@@ -302,9 +312,11 @@ func (cw *ClickhouseQueryTranslator) BuildAutocompleteQuery(fieldName, tableName
 			nil,
 			model.NewTableRef(tableName),
 			whereClause,
+			nil,
 			[]model.Expr{},
 			limit,
 			0,
+			0,
 			true,
 			nil,
 		),
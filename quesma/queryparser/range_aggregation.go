@@ -9,6 +9,19 @@ import (
 
 func (cw *ClickhouseQueryTranslator) parseRangeAggregation(rangePart QueryMap) bucket_aggregations.Range {
 	field := cw.parseFieldField(rangePart, "range")
+	intervals := cw.parseRangeIntervals(rangePart)
+	if keyedRaw, exists := rangePart["keyed"]; exists {
+		if keyed, ok := keyedRaw.(bool); ok {
+			return bucket_aggregations.NewRange(cw.Ctx, field, intervals, keyed)
+		} else {
+			logger.WarnWithCtx(cw.Ctx).Msgf("keyed is not a bool, but %T, value: %v", keyedRaw, keyedRaw)
+		}
+	}
+	return bucket_aggregations.NewRangeWithDefaultKeyed(cw.Ctx, field, intervals)
+}
+
+// parseRangeIntervals parses 'ranges' of range-like aggregations (range, geo_distance)
+func (cw *ClickhouseQueryTranslator) parseRangeIntervals(rangePart QueryMap) []bucket_aggregations.Interval {
 	var ranges []any
 	if rangesRaw, ok := rangePart["ranges"]; ok {
 		ranges, ok = rangesRaw.([]any)
@@ -42,12 +55,5 @@ func (cw *ClickhouseQueryTranslator) parseRangeAggregation(rangePart QueryMap) b
 		}
 		intervals = append(intervals, bucket_aggregations.NewInterval(from, to))
 	}
-	if keyedRaw, exists := rangePart["keyed"]; exists {
-		if keyed, ok := keyedRaw.(bool); ok {
-			return bucket_aggregations.NewRange(cw.Ctx, field, intervals, keyed)
-		} else {
-			logger.WarnWithCtx(cw.Ctx).Msgf("keyed is not a bool, but %T, value: %v", keyedRaw, keyedRaw)
-		}
-	}
-	return bucket_aggregations.NewRangeWithDefaultKeyed(cw.Ctx, field, intervals)
+	return intervals
 }
@@ -4,10 +4,14 @@ package queryparser
 
 import (
 	"quesma/model"
+	"quesma/queryparser/painless"
 	"quesma/quesma/types"
+	"quesma/schema"
 )
 
-func ParseRuntimeMappings(body types.JSON) map[string]model.RuntimeMapping {
+// ParseRuntimeMappings parses "runtime_mappings" of the request. Scripts are lowered to SQL expressions,
+// and the error is returned if any of them uses unsupported Painless constructs.
+func ParseRuntimeMappings(body types.JSON, currentSchema schema.Schema) (map[string]model.RuntimeMapping, error) {
 
 	result := make(map[string]model.RuntimeMapping)
 
@@ -27,7 +31,12 @@ func ParseRuntimeMappings(body types.JSON) map[string]model.RuntimeMapping {
 						if scriptAsMap, ok := script.(map[string]interface{}); ok {
 							if source, ok := scriptAsMap["source"]; ok {
 								if sourceAsString, ok := source.(string); ok {
-									mapping.Expr = ParseScript(sourceAsString)
+									params, _ := scriptAsMap["params"].(map[string]interface{})
+									expr, err := painless.ParseScript(sourceAsString, painless.LiteralParams(params), currentSchema)
+									if err != nil {
+										return nil, err
+									}
+									mapping.Expr = expr
 								}
 							}
 						}
@@ -39,16 +48,5 @@ func ParseRuntimeMappings(body types.JSON) map[string]model.RuntimeMapping {
 			}
 		}
 	}
-	return result
-}
-
-func ParseScript(s string) model.Expr {
-
-	// TODO: add a real parser here
-	if s == "emit(doc['timestamp'].value.getHour());" {
-		return model.NewFunction(model.DateHourFunction, model.NewColumnRef(model.TimestampFieldName))
-	}
-
-	// harmless default
-	return model.NewLiteral("NULL")
+	return result, nil
 }
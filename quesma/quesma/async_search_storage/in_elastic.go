@@ -2,4 +2,443 @@
 // SPDX-License-Identifier: Elastic-2.0
 package async_search_storage
 
-// TODO :(
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"quesma/elasticsearch"
+	"quesma/logger"
+	"quesma/quesma/config"
+	"sync"
+	"time"
+)
+
+const AsyncSearchElasticIndexName = "quesma_async_search_storage"
+const ScrollContextElasticIndexName = "quesma_scroll_storage"
+const PointInTimeElasticIndexName = "quesma_point_in_time_storage"
+
+// rangeLimit is the max number of results visited by Range
+const rangeLimit = 10000
+
+// statsCacheTTL is how long Size and SpaceInUse are cached. They're checked before every async search,
+// so without the cache every async search would wait for an additional round trip to Elasticsearch.
+const statsCacheTTL = 10 * time.Second
+
+// AsyncSearchStorageInElastic keeps async search results in an Elasticsearch index,
+// so they survive a restart and are available to all Quesma instances behind a load balancer.
+type AsyncSearchStorageInElastic struct {
+	indexName string
+	client    *elasticsearch.SimpleClient
+	stats     *storageStats
+}
+
+// storageStats caches the number and total size of stored results. Results stored by this instance
+// are added right away, the ones of other instances are visible after the refresh.
+type storageStats struct {
+	mu         sync.Mutex
+	size       int
+	spaceInUse int64
+	fetchedAt  time.Time // zero if stats need to be fetched
+}
+
+// elasticAsyncRequestResult is a document in the index. Only `added` and `size` are indexed.
+type elasticAsyncRequestResult struct {
+	ResponseBody []byte    `json:"responseBody"`
+	Added        time.Time `json:"added"`
+	IsCompressed bool      `json:"isCompressed"`
+	Err          string    `json:"err,omitempty"`
+	Size         int       `json:"size"`
+}
+
+func NewAsyncSearchStorageInElastic(cfg config.ElasticsearchConfiguration, indexName string) AsyncSearchStorageInElastic {
+	s := AsyncSearchStorageInElastic{
+		indexName: indexName,
+		client:    elasticsearch.NewSimpleClient(&cfg),
+		stats:     &storageStats{},
+	}
+	s.createIndex()
+	return s
+}
+
+func (s AsyncSearchStorageInElastic) createIndex() {
+	mapping := `{
+		"mappings": {
+			"dynamic": false,
+			"properties": {
+				"added": {"type": "date"},
+				"size":  {"type": "long"}
+			}
+		}
+	}`
+	resp, err := s.client.Request(context.Background(), "PUT", s.indexName, []byte(mapping))
+	if err != nil {
+		logger.Error().Msgf("failed to create async search storage index %s: %v", s.indexName, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// 400 means that the index already exists
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		logger.Error().Msgf("failed to create async search storage index %s: %s", s.indexName, resp.Status)
+	}
+}
+
+func (s AsyncSearchStorageInElastic) Store(id string, result *AsyncRequestResult) {
+	doc := elasticAsyncRequestResult{
+		ResponseBody: result.responseBody,
+		Added:        result.added,
+		IsCompressed: result.isCompressed,
+		Size:         len(result.responseBody),
+	}
+	if result.err != nil {
+		doc.Err = result.err.Error()
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		logger.Error().Msgf("failed to marshal async search result %s: %v", id, err)
+		return
+	}
+
+	// refresh, so the result is counted by other instances right away
+	_, err = s.request("PUT", fmt.Sprintf("%s/_doc/%s?refresh=true", s.indexName, id), body)
+	if err != nil {
+		logger.Error().Msgf("failed to store async search result %s: %v", id, err)
+		return
+	}
+
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.size++
+	s.stats.spaceInUse += int64(doc.Size)
+}
+
+func (s AsyncSearchStorageInElastic) Load(id string) (*AsyncRequestResult, bool) {
+	body, err := s.request("GET", fmt.Sprintf("%s/_source/%s", s.indexName, id), nil)
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Msgf("failed to load async search result %s: %v", id, err)
+		}
+		return nil, false
+	}
+
+	var doc elasticAsyncRequestResult
+	if err = json.Unmarshal(body, &doc); err != nil {
+		logger.Error().Msgf("failed to unmarshal async search result %s: %v", id, err)
+		return nil, false
+	}
+	return doc.toResult(), true
+}
+
+func (s AsyncSearchStorageInElastic) Delete(id string) {
+	_, err := s.request("DELETE", fmt.Sprintf("%s/_doc/%s?refresh=true", s.indexName, id), nil)
+	if err != nil && !errors.Is(err, errNotFound) {
+		logger.Error().Msgf("failed to delete async search result %s: %v", id, err)
+	}
+	s.invalidateStats()
+}
+
+func (s AsyncSearchStorageInElastic) Range(f func(key string, value *AsyncRequestResult) bool) {
+	query := fmt.Sprintf(`{"size": %d, "query": {"match_all": {}}}`, rangeLimit)
+	body, err := s.request("POST", fmt.Sprintf("%s/_search", s.indexName), []byte(query))
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Msgf("failed to list async search results: %v", err)
+		}
+		return
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				ID     string                    `json:"_id"`
+				Source elasticAsyncRequestResult `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		logger.Error().Msgf("failed to unmarshal async search results: %v", err)
+		return
+	}
+
+	for _, hit := range response.Hits.Hits {
+		if !f(hit.ID, hit.Source.toResult()) {
+			return
+		}
+	}
+}
+
+func (s AsyncSearchStorageInElastic) Size() int {
+	size, _ := s.cachedStats()
+	return size
+}
+
+func (s AsyncSearchStorageInElastic) SpaceInUse() int64 {
+	_, spaceInUse := s.cachedStats()
+	return spaceInUse
+}
+
+func (s AsyncSearchStorageInElastic) cachedStats() (size int, spaceInUse int64) {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+
+	if time.Since(s.stats.fetchedAt) > statsCacheTTL {
+		if size, spaceInUse, err := s.fetchStats(); err == nil {
+			s.stats.size, s.stats.spaceInUse, s.stats.fetchedAt = size, spaceInUse, time.Now()
+		} else if !errors.Is(err, errNotFound) {
+			logger.Error().Msgf("failed to fetch async search results stats: %v", err)
+		}
+	}
+	return s.stats.size, s.stats.spaceInUse
+}
+
+func (s AsyncSearchStorageInElastic) invalidateStats() {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.fetchedAt = time.Time{}
+}
+
+// fetchStats returns the number and total size of stored results in a single request
+func (s AsyncSearchStorageInElastic) fetchStats() (size int, spaceInUse int64, err error) {
+	query := `{"size": 0, "track_total_hits": true, "aggs": {"size": {"sum": {"field": "size"}}}}`
+	body, err := s.request("POST", fmt.Sprintf("%s/_search", s.indexName), []byte(query))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Size struct {
+				Value float64 `json:"value"`
+			} `json:"size"`
+		} `json:"aggregations"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return 0, 0, err
+	}
+	return response.Hits.Total.Value, int64(response.Aggregations.Size.Value), nil
+}
+
+func (s AsyncSearchStorageInElastic) evict(timeFun func(time.Time) time.Duration) {
+	// timeFun is the time elapsed since its argument, so results added before cutoff are older than EvictionInterval
+	now := time.Now()
+	cutoff := now.Add(timeFun(now) - EvictionInterval)
+
+	query, err := json.Marshal(map[string]any{"query": map[string]any{"range": map[string]any{
+		"added": map[string]any{"lt": cutoff.UnixMilli(), "format": "epoch_millis"},
+	}}})
+	if err != nil {
+		logger.Error().Msgf("failed to marshal async search results eviction query: %v", err)
+		return
+	}
+
+	// every instance runs its evictor, deleting the same documents twice is fine
+	body, err := s.request("POST", fmt.Sprintf("%s/_delete_by_query?refresh=true&conflicts=proceed", s.indexName), query)
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Msgf("failed to evict async search results: %v", err)
+		}
+		return
+	}
+	s.invalidateStats()
+
+	var response struct {
+		Deleted int `json:"deleted"`
+	}
+	if err = json.Unmarshal(body, &response); err == nil && response.Deleted > 0 {
+		logger.Info().Msgf("Evicted %d async search results", response.Deleted)
+	}
+}
+
+var errNotFound = errors.New("not found")
+
+func (s AsyncSearchStorageInElastic) request(method, endpoint string, body []byte) ([]byte, error) {
+	return elasticRequest(s.client, method, endpoint, body)
+}
+
+func elasticRequest(client *elasticsearch.SimpleClient, method, endpoint string, body []byte) ([]byte, error) {
+	resp, err := client.Request(context.Background(), method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return respBody, nil
+	case http.StatusNotFound:
+		return nil, errNotFound
+	default:
+		return nil, fmt.Errorf("%s %s failed: %s, %s", method, endpoint, resp.Status, string(respBody))
+	}
+}
+
+func (doc elasticAsyncRequestResult) toResult() *AsyncRequestResult {
+	var err error
+	if doc.Err != "" {
+		err = errors.New(doc.Err)
+	}
+	return NewAsyncRequestResult(doc.ResponseBody, err, doc.Added, doc.IsCompressed)
+}
+
+// ScrollContextStorageInElastic keeps scroll contexts in an Elasticsearch index,
+// so scrolls survive a restart and can be continued by any Quesma instance behind a load balancer.
+type ScrollContextStorageInElastic struct {
+	contexts expiringDocumentsInElastic[ScrollContext]
+}
+
+func NewScrollContextStorageInElastic(cfg config.ElasticsearchConfiguration, indexName string) ScrollContextStorageInElastic {
+	return ScrollContextStorageInElastic{contexts: newExpiringDocumentsInElastic[ScrollContext](cfg, indexName, "scroll context")}
+}
+
+func (s ScrollContextStorageInElastic) Store(id string, context ScrollContext) {
+	s.contexts.store(id, context)
+}
+
+// Load returns the scroll context, if it hasn't expired yet
+func (s ScrollContextStorageInElastic) Load(id string) (ScrollContext, bool) {
+	context, ok := s.contexts.load(id)
+	if !ok || time.Now().After(context.ExpiresAt) {
+		return ScrollContext{}, false
+	}
+	return context, true
+}
+
+func (s ScrollContextStorageInElastic) Delete(id string) bool {
+	return s.contexts.delete(id)
+}
+
+func (s ScrollContextStorageInElastic) evict(now time.Time) {
+	s.contexts.evict(now)
+}
+
+// PointInTimeStorageInElastic keeps points in time in an Elasticsearch index,
+// so they survive a restart and can be used by any Quesma instance behind a load balancer.
+type PointInTimeStorageInElastic struct {
+	contexts expiringDocumentsInElastic[PointInTimeContext]
+}
+
+func NewPointInTimeStorageInElastic(cfg config.ElasticsearchConfiguration, indexName string) PointInTimeStorageInElastic {
+	return PointInTimeStorageInElastic{contexts: newExpiringDocumentsInElastic[PointInTimeContext](cfg, indexName, "point in time")}
+}
+
+func (s PointInTimeStorageInElastic) Store(id string, context PointInTimeContext) {
+	s.contexts.store(id, context)
+}
+
+// Load returns the point in time, if it hasn't expired yet
+func (s PointInTimeStorageInElastic) Load(id string) (PointInTimeContext, bool) {
+	context, ok := s.contexts.load(id)
+	if !ok || time.Now().After(context.ExpiresAt) {
+		return PointInTimeContext{}, false
+	}
+	return context, true
+}
+
+func (s PointInTimeStorageInElastic) Delete(id string) bool {
+	return s.contexts.delete(id)
+}
+
+func (s PointInTimeStorageInElastic) evict(now time.Time) {
+	s.contexts.evict(now)
+}
+
+// expiringDocumentsInElastic stores documents of type T, which have an `expiresAt` (indexed) field, in an Elasticsearch index
+type expiringDocumentsInElastic[T any] struct {
+	indexName string
+	client    *elasticsearch.SimpleClient
+	name      string // what the documents are, for logs
+}
+
+func newExpiringDocumentsInElastic[T any](cfg config.ElasticsearchConfiguration, indexName, name string) expiringDocumentsInElastic[T] {
+	d := expiringDocumentsInElastic[T]{indexName: indexName, client: elasticsearch.NewSimpleClient(&cfg), name: name}
+	d.createIndex()
+	return d
+}
+
+func (d expiringDocumentsInElastic[T]) createIndex() {
+	mapping := `{
+		"mappings": {
+			"dynamic": false,
+			"properties": {
+				"expiresAt": {"type": "date"}
+			}
+		}
+	}`
+	resp, err := d.client.Request(context.Background(), "PUT", d.indexName, []byte(mapping))
+	if err != nil {
+		logger.Error().Msgf("failed to create %s storage index %s: %v", d.name, d.indexName, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// 400 means that the index already exists
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		logger.Error().Msgf("failed to create %s storage index %s: %s", d.name, d.indexName, resp.Status)
+	}
+}
+
+func (d expiringDocumentsInElastic[T]) store(id string, doc T) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		logger.Error().Msgf("failed to marshal %s %s: %v", d.name, id, err)
+		return
+	}
+	// refresh, so the document is visible to other instances right away
+	_, err = elasticRequest(d.client, "PUT", fmt.Sprintf("%s/_doc/%s?refresh=true", d.indexName, id), body)
+	if err != nil {
+		logger.Error().Msgf("failed to store %s %s: %v", d.name, id, err)
+	}
+}
+
+func (d expiringDocumentsInElastic[T]) load(id string) (doc T, ok bool) {
+	body, err := elasticRequest(d.client, "GET", fmt.Sprintf("%s/_source/%s", d.indexName, id), nil)
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Msgf("failed to load %s %s: %v", d.name, id, err)
+		}
+		return doc, false
+	}
+	if err = json.Unmarshal(body, &doc); err != nil {
+		logger.Error().Msgf("failed to unmarshal %s %s: %v", d.name, id, err)
+		return doc, false
+	}
+	return doc, true
+}
+
+func (d expiringDocumentsInElastic[T]) delete(id string) bool {
+	_, err := elasticRequest(d.client, "DELETE", fmt.Sprintf("%s/_doc/%s?refresh=true", d.indexName, id), nil)
+	if err != nil && !errors.Is(err, errNotFound) {
+		logger.Error().Msgf("failed to delete %s %s: %v", d.name, id, err)
+	}
+	return err == nil
+}
+
+func (d expiringDocumentsInElastic[T]) evict(now time.Time) {
+	query, err := json.Marshal(map[string]any{"query": map[string]any{"range": map[string]any{
+		"expiresAt": map[string]any{"lt": now.UnixMilli(), "format": "epoch_millis"},
+	}}})
+	if err != nil {
+		logger.Error().Msgf("failed to marshal %s eviction query: %v", d.name, err)
+		return
+	}
+
+	// every instance runs its evictor, deleting the same documents twice is fine
+	_, err = elasticRequest(d.client, "POST", fmt.Sprintf("%s/_delete_by_query?refresh=true&conflicts=proceed", d.indexName), query)
+	if err != nil && !errors.Is(err, errNotFound) {
+		logger.Error().Msgf("failed to evict expired %ss: %v", d.name, err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package async_search_storage
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"quesma/quesma/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeElastic implements the small subset of the Elasticsearch API used by AsyncSearchStorageInElastic
+type fakeElastic struct {
+	mu       sync.Mutex
+	docs     map[string]json.RawMessage
+	searches int
+}
+
+func (f *fakeElastic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(path) == 1 && r.Method == "PUT":
+		if f.docs != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.docs = make(map[string]json.RawMessage)
+	case len(path) == 3 && path[1] == "_doc" && r.Method == "PUT":
+		f.docs[path[2]] = body
+		w.WriteHeader(http.StatusCreated)
+	case len(path) == 3 && path[1] == "_source" && r.Method == "GET":
+		doc, ok := f.docs[path[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(doc)
+	case len(path) == 3 && path[1] == "_doc" && r.Method == "DELETE":
+		if _, ok := f.docs[path[2]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.docs, path[2])
+	case len(path) == 2 && path[1] == "_search":
+		f.searches++
+		var hits []map[string]any
+		size := 0
+		for id, doc := range f.docs {
+			var source elasticAsyncRequestResult
+			_ = json.Unmarshal(doc, &source)
+			size += source.Size
+			hits = append(hits, map[string]any{"_id": id, "_source": doc})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"hits":         map[string]any{"total": map[string]any{"value": len(hits)}, "hits": hits},
+			"aggregations": map[string]any{"size": map[string]any{"value": size}},
+		})
+	case len(path) == 2 && path[1] == "_delete_by_query":
+		var query struct {
+			Query struct {
+				Range map[string]struct {
+					Lt int64 `json:"lt"`
+				} `json:"range"`
+			} `json:"query"`
+		}
+		_ = json.Unmarshal(body, &query)
+		deleted := 0
+		for field, bound := range query.Query.Range {
+			for id, doc := range f.docs {
+				var source map[string]any
+				_ = json.Unmarshal(doc, &source)
+				value, _ := source[field].(string)
+				if date, err := time.Parse(time.RFC3339Nano, value); err == nil && date.UnixMilli() < bound.Lt {
+					delete(f.docs, id)
+					deleted++
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"deleted": deleted})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeElastic) searchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.searches
+}
+
+func newTestStorageInElastic(t *testing.T) (AsyncSearchStorageInElastic, *fakeElastic) {
+	cfg, fake := newFakeElastic(t)
+	return NewAsyncSearchStorageInElastic(cfg, AsyncSearchElasticIndexName), fake
+}
+
+func newFakeElastic(t *testing.T) (config.ElasticsearchConfiguration, *fakeElastic) {
+	fake := &fakeElastic{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	serverUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return config.ElasticsearchConfiguration{Url: (*config.Url)(serverUrl)}, fake
+}
+
+func TestAsyncSearchStorageInElastic(t *testing.T) {
+	storage, _ := newTestStorageInElastic(t)
+	added := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	storage.Store("1", NewAsyncRequestResult([]byte(`{"a":1}`), nil, added, false))
+	storage.Store("2", NewAsyncRequestResult([]byte(`compressed`), errors.New("query failed"), added, true))
+
+	result, ok := storage.Load("1")
+	require.True(t, ok)
+	assert.Equal(t, []byte(`{"a":1}`), result.GetResponseBody())
+	assert.NoError(t, result.GetErr())
+	assert.False(t, result.IsCompressed())
+	assert.True(t, added.Equal(result.added))
+
+	result, ok = storage.Load("2")
+	require.True(t, ok)
+	assert.Equal(t, []byte(`compressed`), result.GetResponseBody())
+	assert.EqualError(t, result.GetErr(), "query failed")
+	assert.True(t, result.IsCompressed())
+
+	assert.Equal(t, 2, storage.Size())
+	assert.Equal(t, int64(17), storage.SpaceInUse())
+
+	storage.Delete("1")
+	_, ok = storage.Load("1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, storage.Size())
+}
+
+func TestAsyncQueriesEvictorInElastic(t *testing.T) {
+	storage, _ := newTestStorageInElastic(t)
+	storage.Store("1", &AsyncRequestResult{added: time.Now().Add(-20 * time.Minute)})
+	storage.Store("2", &AsyncRequestResult{added: time.Now()})
+
+	evictor := NewAsyncQueriesEvictor(storage, NewAsyncQueryContextStorageInMemory(), NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
+	evictor.tryEvictAsyncRequests(elapsedTime)
+
+	_, ok := storage.Load("1")
+	assert.False(t, ok)
+	_, ok = storage.Load("2")
+	assert.True(t, ok)
+	assert.Equal(t, 1, storage.Size())
+}
+
+func TestAsyncSearchStorageInElasticStatsCached(t *testing.T) {
+	storage, fake := newTestStorageInElastic(t)
+	storage.Store("1", NewAsyncRequestResult([]byte(`{"a":1}`), nil, time.Now(), false))
+
+	assert.Equal(t, 1, storage.Size())
+	assert.Equal(t, int64(7), storage.SpaceInUse())
+	storage.Store("2", NewAsyncRequestResult([]byte(`{}`), nil, time.Now(), false))
+	assert.Equal(t, 2, storage.Size())
+	assert.Equal(t, int64(9), storage.SpaceInUse())
+	assert.Equal(t, 1, fake.searchCount())
+
+	storage.Delete("1")
+	assert.Equal(t, 1, storage.Size())
+	assert.Equal(t, int64(2), storage.SpaceInUse())
+	assert.Equal(t, 2, fake.searchCount())
+}
+
+func TestScrollContextStorageInElastic(t *testing.T) {
+	cfg, _ := newFakeElastic(t)
+	storage := NewScrollContextStorageInElastic(cfg, ScrollContextElasticIndexName)
+	openedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	storage.Store("alive", ScrollContext{
+		IndexPattern: "logs",
+		Body:         map[string]any{"size": float64(2)},
+		SearchAfter:  []any{float64(1706745660000), "a1"},
+		From:         2,
+		OpenedAt:     openedAt,
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+	storage.Store("expired", ScrollContext{ExpiresAt: time.Now().Add(-time.Second)})
+
+	// another instance sees the same scroll
+	context, ok := NewScrollContextStorageInElastic(cfg, ScrollContextElasticIndexName).Load("alive")
+	require.True(t, ok)
+	assert.Equal(t, "logs", context.IndexPattern)
+	assert.Equal(t, map[string]any{"size": float64(2)}, map[string]any(context.Body))
+	assert.Equal(t, []any{float64(1706745660000), "a1"}, context.SearchAfter)
+	assert.Equal(t, 2, context.From)
+	assert.True(t, openedAt.Equal(context.OpenedAt))
+
+	_, ok = storage.Load("expired")
+	assert.False(t, ok)
+
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), NewAsyncQueryContextStorageInMemory(), storage, NewPointInTimeStorageInMemory())
+	evictor.tryEvictAsyncRequests(elapsedTime)
+	assert.False(t, storage.Delete("expired"))
+	assert.True(t, storage.Delete("alive"))
+	_, ok = storage.Load("alive")
+	assert.False(t, ok)
+}
+
+func TestPointInTimeStorageInElastic(t *testing.T) {
+	cfg, _ := newFakeElastic(t)
+	storage := NewPointInTimeStorageInElastic(cfg, PointInTimeElasticIndexName)
+	openedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	storage.Store("alive", PointInTimeContext{IndexPattern: "logs-*", OpenedAt: openedAt, ExpiresAt: time.Now().Add(time.Minute)})
+	storage.Store("expired", PointInTimeContext{IndexPattern: "logs-*", ExpiresAt: time.Now().Add(-time.Second)})
+
+	// another instance sees the same point in time
+	context, ok := NewPointInTimeStorageInElastic(cfg, PointInTimeElasticIndexName).Load("alive")
+	require.True(t, ok)
+	assert.Equal(t, "logs-*", context.IndexPattern)
+	assert.True(t, openedAt.Equal(context.OpenedAt))
+
+	_, ok = storage.Load("expired")
+	assert.False(t, ok)
+
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), NewAsyncQueryContextStorageInMemory(), NewScrollContextStorageInMemory(), storage)
+	evictor.tryEvictAsyncRequests(elapsedTime)
+	assert.False(t, storage.Delete("expired"))
+	assert.True(t, storage.Delete("alive"))
+}
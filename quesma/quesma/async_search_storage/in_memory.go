@@ -45,6 +45,28 @@ func (s AsyncSearchStorageInMemory) Size() int {
 	return s.idToResult.Size()
 }
 
+func (s AsyncSearchStorageInMemory) SpaceInUse() int64 {
+	size := int64(0)
+	s.Range(func(key string, value *AsyncRequestResult) bool {
+		size += int64(len(value.GetResponseBody()))
+		return true
+	})
+	return size
+}
+
+func (s AsyncSearchStorageInMemory) evict(timeFun func(time.Time) time.Duration) {
+	var ids []asyncQueryIdWithTime
+	s.Range(func(key string, value *AsyncRequestResult) bool {
+		if timeFun(value.added) > EvictionInterval {
+			ids = append(ids, asyncQueryIdWithTime{id: key, time: value.added})
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.idToResult.Delete(id.id)
+	}
+}
+
 type AsyncQueryContextStorageInMemory struct {
 	idToContext *concurrent.Map[string, *AsyncQueryContext]
 }
@@ -59,16 +81,100 @@ func (s AsyncQueryContextStorageInMemory) Store(id string, context *AsyncQueryCo
 	s.idToContext.Store(id, context)
 }
 
+type ScrollContextStorageInMemory struct {
+	idToContext *concurrent.Map[string, ScrollContext]
+}
+
+func NewScrollContextStorageInMemory() ScrollContextStorageInMemory {
+	return ScrollContextStorageInMemory{
+		idToContext: concurrent.NewMap[string, ScrollContext](),
+	}
+}
+
+func (s ScrollContextStorageInMemory) Store(id string, context ScrollContext) {
+	s.idToContext.Store(id, context)
+}
+
+// Load returns the scroll context, if it hasn't expired yet
+func (s ScrollContextStorageInMemory) Load(id string) (ScrollContext, bool) {
+	context, ok := s.idToContext.Load(id)
+	if !ok || time.Now().After(context.ExpiresAt) {
+		return ScrollContext{}, false
+	}
+	return context, true
+}
+
+func (s ScrollContextStorageInMemory) Delete(id string) bool {
+	_, ok := s.idToContext.LoadAndDelete(id)
+	return ok
+}
+
+func (s ScrollContextStorageInMemory) evict(now time.Time) {
+	var ids []string
+	s.idToContext.Range(func(key string, value ScrollContext) bool {
+		if now.After(value.ExpiresAt) {
+			ids = append(ids, key)
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.idToContext.Delete(id)
+	}
+}
+
+type PointInTimeStorageInMemory struct {
+	idToContext *concurrent.Map[string, PointInTimeContext]
+}
+
+func NewPointInTimeStorageInMemory() PointInTimeStorageInMemory {
+	return PointInTimeStorageInMemory{
+		idToContext: concurrent.NewMap[string, PointInTimeContext](),
+	}
+}
+
+func (s PointInTimeStorageInMemory) Store(id string, context PointInTimeContext) {
+	s.idToContext.Store(id, context)
+}
+
+// Load returns the point in time, if it hasn't expired yet
+func (s PointInTimeStorageInMemory) Load(id string) (PointInTimeContext, bool) {
+	context, ok := s.idToContext.Load(id)
+	if !ok || time.Now().After(context.ExpiresAt) {
+		return PointInTimeContext{}, false
+	}
+	return context, true
+}
+
+func (s PointInTimeStorageInMemory) Delete(id string) bool {
+	_, ok := s.idToContext.LoadAndDelete(id)
+	return ok
+}
+
+func (s PointInTimeStorageInMemory) evict(now time.Time) {
+	var ids []string
+	s.idToContext.Range(func(key string, value PointInTimeContext) bool {
+		if now.After(value.ExpiresAt) {
+			ids = append(ids, key)
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.idToContext.Delete(id)
+	}
+}
+
 type AsyncQueriesEvictor struct {
 	ctx                  context.Context
 	cancel               context.CancelFunc
-	AsyncRequestStorage  AsyncSearchStorageInMemory
+	AsyncRequestStorage  AsyncRequestResultStorage
 	AsyncQueriesContexts AsyncQueryContextStorageInMemory
+	ScrollContexts       ScrollContextStorage
+	PointsInTime         PointInTimeStorage
 }
 
-func NewAsyncQueriesEvictor(AsyncRequestStorage AsyncSearchStorageInMemory, AsyncQueriesContexts AsyncQueryContextStorageInMemory) *AsyncQueriesEvictor {
+func NewAsyncQueriesEvictor(AsyncRequestStorage AsyncRequestResultStorage, AsyncQueriesContexts AsyncQueryContextStorageInMemory, ScrollContexts ScrollContextStorage, PointsInTime PointInTimeStorage) *AsyncQueriesEvictor {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &AsyncQueriesEvictor{ctx: ctx, cancel: cancel, AsyncRequestStorage: AsyncRequestStorage, AsyncQueriesContexts: AsyncQueriesContexts}
+	return &AsyncQueriesEvictor{ctx: ctx, cancel: cancel, AsyncRequestStorage: AsyncRequestStorage, AsyncQueriesContexts: AsyncQueriesContexts, ScrollContexts: ScrollContexts, PointsInTime: PointsInTime}
 }
 
 func elapsedTime(t time.Time) time.Duration {
@@ -81,16 +187,7 @@ type asyncQueryIdWithTime struct {
 }
 
 func (e *AsyncQueriesEvictor) tryEvictAsyncRequests(timeFun func(time.Time) time.Duration) {
-	var ids []asyncQueryIdWithTime
-	e.AsyncRequestStorage.Range(func(key string, value *AsyncRequestResult) bool {
-		if timeFun(value.added) > EvictionInterval {
-			ids = append(ids, asyncQueryIdWithTime{id: key, time: value.added})
-		}
-		return true
-	})
-	for _, id := range ids {
-		e.AsyncRequestStorage.idToResult.Delete(id.id)
-	}
+	e.AsyncRequestStorage.evict(timeFun)
 	var asyncQueriesContexts []*AsyncQueryContext
 	e.AsyncQueriesContexts.idToContext.Range(func(key string, value *AsyncQueryContext) bool {
 		if timeFun(value.added) > EvictionInterval {
@@ -111,6 +208,9 @@ func (e *AsyncQueriesEvictor) tryEvictAsyncRequests(timeFun func(time.Time) time
 	if len(evictedIds) > 0 {
 		logger.Info().Msgf("Evicted %d async queries : %s", len(evictedIds), strings.Join(evictedIds, ","))
 	}
+	// scroll contexts and points in time have their own keep alive, so they are evicted independently of timeFun
+	e.ScrollContexts.evict(time.Now())
+	e.PointsInTime.evict(time.Now())
 }
 
 func (e *AsyncQueriesEvictor) AsyncQueriesGC() {
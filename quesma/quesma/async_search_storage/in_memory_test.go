@@ -12,7 +12,7 @@ import (
 func TestAsyncQueriesEvictorTimePassed(t *testing.T) {
 	queryContextStorage := NewAsyncQueryContextStorageInMemory()
 	queryContextStorage.idToContext.Store("1", &AsyncQueryContext{})
-	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage)
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage, NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
 	evictor.AsyncRequestStorage.Store("1", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("2", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("3", &AsyncRequestResult{added: time.Now()})
@@ -26,8 +26,7 @@ func TestAsyncQueriesEvictorTimePassed(t *testing.T) {
 func TestAsyncQueriesEvictorStillAlive(t *testing.T) {
 	queryContextStorage := NewAsyncQueryContextStorageInMemory()
 	queryContextStorage.idToContext.Store("1", &AsyncQueryContext{})
-	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), queryContextStorage)
-	evictor.AsyncRequestStorage.idToResult = concurrent.NewMap[string, *AsyncRequestResult]()
+	evictor := NewAsyncQueriesEvictor(AsyncSearchStorageInMemory{idToResult: concurrent.NewMap[string, *AsyncRequestResult]()}, queryContextStorage, NewScrollContextStorageInMemory(), NewPointInTimeStorageInMemory())
 	evictor.AsyncRequestStorage.Store("1", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("2", &AsyncRequestResult{added: time.Now()})
 	evictor.AsyncRequestStorage.Store("3", &AsyncRequestResult{added: time.Now()})
@@ -37,3 +36,21 @@ func TestAsyncQueriesEvictorStillAlive(t *testing.T) {
 
 	assert.Equal(t, 3, evictor.AsyncRequestStorage.Size())
 }
+
+func TestScrollContextsEviction(t *testing.T) {
+	scrollContexts := NewScrollContextStorageInMemory()
+	scrollContexts.Store("expired", ScrollContext{ExpiresAt: time.Now().Add(-time.Second)})
+	scrollContexts.Store("alive", ScrollContext{ExpiresAt: time.Now().Add(time.Minute)})
+
+	_, ok := scrollContexts.Load("expired")
+	assert.False(t, ok)
+
+	evictor := NewAsyncQueriesEvictor(NewAsyncSearchStorageInMemory(), NewAsyncQueryContextStorageInMemory(), scrollContexts, NewPointInTimeStorageInMemory())
+	evictor.tryEvictAsyncRequests(elapsedTime)
+
+	assert.Equal(t, 1, scrollContexts.idToContext.Size())
+	_, ok = scrollContexts.Load("alive")
+	assert.True(t, ok)
+	assert.True(t, scrollContexts.Delete("alive"))
+	assert.False(t, scrollContexts.Delete("alive"))
+}
@@ -4,6 +4,7 @@ package async_search_storage
 
 import (
 	"context"
+	"quesma/quesma/types"
 	"time"
 )
 
@@ -13,6 +14,9 @@ type AsyncRequestResultStorage interface {
 	Load(id string) (*AsyncRequestResult, bool)
 	Delete(id string)
 	Size() int
+	SpaceInUse() int64 // total size of stored response bodies in bytes
+
+	evict(timeFun func(time.Time) time.Duration)
 }
 
 // TODO: maybe merge those 2?
@@ -20,6 +24,22 @@ type AsyncQueryContextStorage interface {
 	Store(id string, context *AsyncQueryContext)
 }
 
+type ScrollContextStorage interface {
+	Store(id string, context ScrollContext)
+	Load(id string) (ScrollContext, bool)
+	Delete(id string) bool
+
+	evict(now time.Time)
+}
+
+type PointInTimeStorage interface {
+	Store(id string, context PointInTimeContext)
+	Load(id string) (PointInTimeContext, bool)
+	Delete(id string) bool
+
+	evict(now time.Time)
+}
+
 type AsyncRequestResult struct {
 	responseBody []byte
 	added        time.Time
@@ -53,3 +73,20 @@ type AsyncQueryContext struct {
 func NewAsyncQueryContext(ctx context.Context, cancel context.CancelFunc, id string) *AsyncQueryContext {
 	return &AsyncQueryContext{ctx: ctx, cancel: cancel, added: time.Now(), id: id}
 }
+
+// ScrollContext is the state of a scroll search (`scroll` parameter), pages are fetched one after another with search_after
+type ScrollContext struct {
+	IndexPattern string     `json:"indexPattern"`
+	Body         types.JSON `json:"body"`        // search request with the sort (and other parameters) used for all pages
+	SearchAfter  []any      `json:"searchAfter"` // sort values of the last returned hit, nil before the first page
+	From         int        `json:"from"`        // number of hits returned so far, pages are fetched with OFFSET if there's no unique sort
+	OpenedAt     time.Time  `json:"openedAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+}
+
+// PointInTimeContext is the state of a point in time (`POST /:index/_pit`), searches within it only see documents up to OpenedAt
+type PointInTimeContext struct {
+	IndexPattern string    `json:"indexPattern"`
+	OpenedAt     time.Time `json:"openedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,411 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"quesma/clickhouse"
+	"quesma/concurrent"
+	"quesma/elasticsearch"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/queryparser"
+	"quesma/queryparser/painless"
+	"quesma/quesma/async_search_storage"
+	"quesma/quesma/errors"
+	"quesma/quesma/recovery"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"quesma/table_resolver"
+	"quesma/util"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// _delete_by_query and _update_by_query are translated to ClickHouse mutations:
+// `DELETE FROM ... WHERE ...` and `ALTER TABLE ... UPDATE ... WHERE ...` respectively.
+// The WHERE clause is the same as the one we would use for _search with the same query.
+// Matching documents are counted before the mutation, that's what we report as deleted/updated.
+// Like other requests modifying documents (e.g. _bulk), the index is resolved with the ingest pipeline,
+// so for indexes written to both ClickHouse and Elasticsearch, the request is also forwarded to Elasticsearch.
+
+type byQueryOperation string
+
+const (
+	deleteByQuery byQueryOperation = "delete"
+	updateByQuery byQueryOperation = "update"
+)
+
+// ByQueryTaskIdPrefix distinguishes our tasks from Elasticsearch ones (which are `<node id>:<number>`)
+const ByQueryTaskIdPrefix = "quesma:"
+
+func (o byQueryOperation) action() string {
+	return fmt.Sprintf("indices:data/write/%s/byquery", o)
+}
+
+type ByQueryRetries struct {
+	Bulk   int `json:"bulk"`
+	Search int `json:"search"`
+}
+
+type ByQueryResponse struct {
+	Took                 int64          `json:"took"`
+	TimedOut             bool           `json:"timed_out"`
+	Total                int64          `json:"total"`
+	Updated              *int64         `json:"updated,omitempty"`
+	Deleted              *int64         `json:"deleted,omitempty"`
+	Batches              int            `json:"batches"`
+	VersionConflicts     int            `json:"version_conflicts"`
+	Noops                int            `json:"noops"`
+	Retries              ByQueryRetries `json:"retries"`
+	ThrottledMillis      int            `json:"throttled_millis"`
+	RequestsPerSecond    float64        `json:"requests_per_second"`
+	ThrottledUntilMillis int            `json:"throttled_until_millis"`
+	Failures             []any          `json:"failures"`
+}
+
+func newByQueryResponse(operation byQueryOperation, total int64, took time.Duration) *ByQueryResponse {
+	response := &ByQueryResponse{
+		Took:              took.Milliseconds(),
+		Total:             total,
+		RequestsPerSecond: -1,
+		Failures:          []any{},
+	}
+	if total > 0 {
+		response.Batches = 1
+	}
+	if operation == deleteByQuery {
+		response.Deleted = &total
+	} else {
+		response.Updated = &total
+	}
+	return response
+}
+
+// byQueryMutation is a prepared (already translated) request
+type byQueryMutation struct {
+	operation   byQueryOperation
+	description string
+	table       *clickhouse.Table
+	countQuery  *model.Query
+	statement   string // empty if there is nothing to mutate, e.g. _update_by_query without script
+	// elasticEndpoint is where the request is forwarded as well (with elasticBody), empty if the index isn't written to Elasticsearch
+	elasticEndpoint string
+	elasticBody     []byte
+}
+
+func (q *QueryRunner) handleDeleteByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error) {
+	if _, ok := body["query"]; !ok {
+		return nil, fmt.Errorf("%w: query is missing", quesma_errors.ErrCouldNotParseRequest())
+	}
+	return q.handleByQuery(ctx, deleteByQuery, indexPattern, body, waitForCompletion)
+}
+
+func (q *QueryRunner) handleUpdateByQuery(ctx context.Context, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error) {
+	return q.handleByQuery(ctx, updateByQuery, indexPattern, body, waitForCompletion)
+}
+
+func (q *QueryRunner) handleByQuery(ctx context.Context, operation byQueryOperation, indexPattern string, body types.JSON, waitForCompletion bool) ([]byte, error) {
+	mutation, err := q.prepareByQueryMutation(ctx, operation, indexPattern, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if waitForCompletion {
+		response, err := q.executeByQueryMutation(ctx, mutation)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(response)
+	}
+
+	task := q.byQueryTasks.start(mutation)
+	go func() {
+		ctx := q.executionCtx
+		defer recovery.LogAndHandlePanic(ctx, func(err error) {
+			q.byQueryTasks.complete(task.id, nil, err)
+		})
+		response, err := q.executeByQueryMutation(ctx, mutation)
+		if err != nil {
+			logger.ErrorWithCtx(ctx).Msgf("%s by query task %s failed: %v", operation, task.id, err)
+		}
+		q.byQueryTasks.complete(task.id, response, err)
+	}()
+	return json.Marshal(map[string]any{"task": task.id})
+}
+
+func (q *QueryRunner) prepareByQueryMutation(ctx context.Context, operation byQueryOperation, indexPattern string, body types.JSON) (*byQueryMutation, error) {
+	mutation := &byQueryMutation{operation: operation, description: fmt.Sprintf("%s-by-query [%s]", operation, indexPattern)}
+
+	clickhouseIndexes, toElastic, err := q.resolveByQueryTarget(indexPattern)
+	if err != nil {
+		return nil, err
+	}
+	if toElastic {
+		mutation.elasticEndpoint = fmt.Sprintf("%s/_%s_by_query", indexPattern, operation)
+		if mutation.elasticBody, err = body.Bytes(); err != nil {
+			return nil, err
+		}
+	}
+	if len(clickhouseIndexes) == 0 {
+		return mutation, nil
+	}
+
+	table, currentSchema, resolvedIndexes, err := q.resolveTableAndSchema(clickhouseIndexes)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvedIndexes) == 0 {
+		return mutation, nil
+	}
+
+	translator := &queryparser.ClickhouseQueryTranslator{ClickhouseLM: q.logManager, Table: table, Ctx: ctx,
+		DateMathRenderer: q.DateMathRenderer, Indexes: resolvedIndexes, Config: q.cfg, Schema: currentSchema}
+
+	whereClause, err := translator.ParseWhereClause(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	queries := []*model.Query{translator.BuildCountQuery(whereClause, 0)}
+
+	// values of updated fields are computed by a SELECT, which we don't run, but it lets
+	// the transformation pipeline map field names to columns, same as in any other query
+	var updatedColumns []string
+	if operation == updateByQuery {
+		fields, err := parseUpdateByQueryScript(body, currentSchema)
+		if err != nil {
+			return nil, err
+		}
+		var values []model.Expr
+		for _, field := range util.MapKeysSorted(fields) {
+			resolvedField, ok := currentSchema.ResolveField(field)
+			if !ok {
+				return nil, fmt.Errorf("%w: field %s can't be updated, it doesn't exist in %s", quesma_errors.ErrCouldNotParseRequest(), field, indexPattern)
+			}
+			updatedColumns = append(updatedColumns, resolvedField.InternalPropertyName.AsString())
+			values = append(values, fields[field])
+		}
+		if len(values) > 0 {
+			valuesQuery := translator.BuildCountQuery(whereClause, 0)
+			valuesQuery.SelectCommand.Columns = values
+			queries = append(queries, valuesQuery)
+		}
+	}
+
+	for _, query := range queries {
+		query.TableName = table.Name
+		query.Indexes = resolvedIndexes
+		query.Schema = currentSchema
+	}
+	if queries, err = q.transformationPipeline.Transform(queries); err != nil {
+		return nil, fmt.Errorf("error transforming queries: %v", err)
+	}
+
+	countQuery := queries[0]
+	from := model.AsString(countQuery.SelectCommand.FromClause)
+	where := "true"
+	if countQuery.SelectCommand.WhereClause != nil {
+		where = model.AsString(countQuery.SelectCommand.WhereClause)
+	}
+
+	switch {
+	case operation == deleteByQuery:
+		mutation.statement = fmt.Sprintf("DELETE FROM %s WHERE %s", from, where)
+	case len(updatedColumns) > 0:
+		valuesQuery := queries[1]
+		if len(valuesQuery.SelectCommand.Columns) < len(updatedColumns) {
+			return nil, fmt.Errorf("unexpected number of updated values: %d", len(valuesQuery.SelectCommand.Columns))
+		}
+		assignments := make([]string, 0, len(updatedColumns))
+		for i, column := range updatedColumns {
+			assignments = append(assignments, fmt.Sprintf(`"%s" = %s`, column, model.AsString(valuesQuery.SelectCommand.Columns[i])))
+		}
+		mutation.statement = fmt.Sprintf("ALTER TABLE %s UPDATE %s WHERE %s", from, strings.Join(assignments, ", "), where)
+	}
+
+	mutation.table = table
+	mutation.countQuery = countQuery
+	return mutation, nil
+}
+
+// resolveByQueryTarget resolves the index pattern with the ingest pipeline, the same way _bulk does. It returns indexes
+// stored in ClickHouse, and whether the request should be forwarded to Elasticsearch too (e.g. for dual-written indexes).
+func (q *QueryRunner) resolveByQueryTarget(indexPattern string) (clickhouseIndexes []string, toElastic bool, err error) {
+	decision := q.tableResolver.Resolve(table_resolver.IngestPipeline, indexPattern)
+	if decision.Err != nil {
+		return nil, false, decision.Err
+	}
+	if decision.IsClosed {
+		return nil, false, quesma_errors.ErrIndexNotExists()
+	}
+	for _, connector := range decision.UseConnectors {
+		switch c := connector.(type) {
+		case *table_resolver.ConnectorDecisionClickhouse:
+			clickhouseIndexes = c.ClickhouseTables
+		case *table_resolver.ConnectorDecisionElastic:
+			toElastic = true
+		}
+	}
+	return clickhouseIndexes, toElastic, nil
+}
+
+// parseUpdateByQueryScript returns new values of fields modified by the request's script (none if there is no script)
+func parseUpdateByQueryScript(body types.JSON, currentSchema schema.Schema) (map[string]model.Expr, error) {
+	var source string
+	var params map[string]any
+	switch script := body["script"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		source = script
+	case map[string]any:
+		source, _ = script["source"].(string)
+		if lang, ok := script["lang"].(string); ok && lang != "painless" {
+			return nil, fmt.Errorf("%w: unsupported script language %s", quesma_errors.ErrCouldNotParseRequest(), lang)
+		}
+		params, _ = script["params"].(map[string]any)
+	default:
+		return nil, fmt.Errorf("%w: invalid script %v", quesma_errors.ErrCouldNotParseRequest(), script)
+	}
+	if source == "" {
+		return nil, fmt.Errorf("%w: script source is missing", quesma_errors.ErrCouldNotParseRequest())
+	}
+	return painless.ParseUpdateScript(source, painless.LiteralParams(params), currentSchema)
+}
+
+func (q *QueryRunner) executeByQueryMutation(ctx context.Context, mutation *byQueryMutation) (*ByQueryResponse, error) {
+	startTime := time.Now()
+	if mutation.elasticEndpoint != "" {
+		if err := q.forwardByQueryToElastic(ctx, mutation); err != nil {
+			return nil, err
+		}
+	}
+	if mutation.countQuery == nil {
+		return newByQueryResponse(mutation.operation, 0, time.Since(startTime)), nil
+	}
+
+	rows, _, err := q.logManager.ProcessQuery(ctx, mutation.table, mutation.countQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error counting documents to %s: %w", mutation.operation, err)
+	}
+	var total int64
+	if len(rows) > 0 && len(rows[0].Cols) > 0 {
+		total = util.ExtractInt64(rows[0].Cols[0].Value)
+	}
+
+	if total > 0 && mutation.statement != "" {
+		if _, err = q.logManager.GetDB().ExecContext(ctx, mutation.statement); err != nil {
+			return nil, fmt.Errorf("error executing %s by query: %w", mutation.operation, err)
+		}
+	}
+	return newByQueryResponse(mutation.operation, total, time.Since(startTime)), nil
+}
+
+// forwardByQueryToElastic runs the same request in Elasticsearch. We report our counts only, as both should be the same.
+func (q *QueryRunner) forwardByQueryToElastic(ctx context.Context, mutation *byQueryMutation) error {
+	esClient := elasticsearch.NewSimpleClient(&q.cfg.Elasticsearch)
+	response, err := esClient.RequestWithHeaders(ctx, "POST", mutation.elasticEndpoint, mutation.elasticBody, http.Header{"Content-Type": {"application/json"}})
+	if err != nil {
+		return fmt.Errorf("error forwarding %s by query to Elasticsearch: %w", mutation.operation, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("error forwarding %s by query to Elasticsearch (%v): %s", mutation.operation, response.StatusCode, responseBody)
+	}
+	return nil
+}
+
+// byQueryTask is a _delete_by_query/_update_by_query request run with wait_for_completion=false
+type byQueryTask struct {
+	id          string
+	number      int64
+	action      string
+	description string
+	startTime   time.Time
+	completed   bool
+	endTime     time.Time
+	response    *ByQueryResponse
+	err         error
+}
+
+// byQueryTasks keeps tasks in memory. Completed tasks are kept for async_search_storage.EvictionInterval.
+type byQueryTasks struct {
+	tasks   *concurrent.Map[string, byQueryTask]
+	counter atomic.Int64
+}
+
+func newByQueryTasks() *byQueryTasks {
+	return &byQueryTasks{tasks: concurrent.NewMap[string, byQueryTask]()}
+}
+
+func (t *byQueryTasks) start(mutation *byQueryMutation) byQueryTask {
+	t.evict()
+	number := t.counter.Add(1)
+	task := byQueryTask{
+		id:          fmt.Sprintf("%s%d", ByQueryTaskIdPrefix, number),
+		number:      number,
+		action:      mutation.operation.action(),
+		description: mutation.description,
+		startTime:   time.Now(),
+	}
+	t.tasks.Store(task.id, task)
+	return task
+}
+
+func (t *byQueryTasks) complete(id string, response *ByQueryResponse, err error) {
+	if task, ok := t.tasks.Load(id); ok {
+		task.completed, task.endTime, task.response, task.err = true, time.Now(), response, err
+		t.tasks.Store(id, task)
+	}
+}
+
+func (t *byQueryTasks) evict() {
+	for id, task := range t.tasks.Snapshot() {
+		if task.completed && time.Since(task.endTime) > async_search_storage.EvictionInterval {
+			t.tasks.Delete(id)
+		}
+	}
+}
+
+var errTaskNotFound = errors.New("task not found")
+
+// handleGetTask returns the task status in the format of Elasticsearch's GET _tasks/<task_id>
+func (q *QueryRunner) handleGetTask(id string) ([]byte, error) {
+	task, ok := q.byQueryTasks.tasks.Load(id)
+	if !ok {
+		return nil, errTaskNotFound
+	}
+
+	runningTime := time.Since(task.startTime)
+	if task.completed {
+		runningTime = task.endTime.Sub(task.startTime)
+	}
+	result := map[string]any{
+		"completed": task.completed,
+		"task": map[string]any{
+			"node":                  strings.TrimSuffix(ByQueryTaskIdPrefix, ":"),
+			"id":                    task.number,
+			"type":                  "transport",
+			"action":                task.action,
+			"description":           task.description,
+			"start_time_in_millis":  task.startTime.UnixMilli(),
+			"running_time_in_nanos": runningTime.Nanoseconds(),
+			"cancellable":           false,
+		},
+	}
+	switch {
+	case task.err != nil:
+		result["error"] = map[string]any{"type": "exception", "reason": task.err.Error()}
+	case task.response != nil:
+		result["response"] = task.response
+	}
+	return json.Marshal(result)
+}
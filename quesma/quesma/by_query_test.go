@@ -0,0 +1,213 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"quesma/ab_testing"
+	"quesma/clickhouse"
+	"quesma/common_table"
+	"quesma/elasticsearch"
+	"quesma/logger"
+	"quesma/quesma/config"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"quesma/quesma/ui"
+	"quesma/schema"
+	"quesma/table_resolver"
+	"quesma/telemetry"
+	"testing"
+	"time"
+)
+
+func newTestQueryRunnerWithMock(t *testing.T) (*QueryRunner, sqlmock.Sqlmock) {
+	fields := map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeKeyword},
+		"count":      {PropertyName: "count", InternalPropertyName: "count", Type: schema.QuesmaTypeLong},
+	}
+	columns := map[string]*clickhouse.Column{
+		"@timestamp": {Name: "@timestamp", Type: clickhouse.NewBaseType("DateTime64")},
+		"message":    {Name: "message", Type: clickhouse.NewBaseType("String")},
+		"count":      {Name: "count", Type: clickhouse.NewBaseType("Int64")},
+	}
+
+	tableMap := clickhouse.NewTableMap()
+	schemaRegistry := schema.StaticRegistry{Tables: map[schema.TableName]schema.Schema{}}
+	for _, name := range []string{"logs", "logs-1", "logs-dual"} {
+		schemaRegistry.Tables[schema.TableName(name)] = schema.Schema{Fields: fields}
+		tableMap.Store(name, &clickhouse.Table{Name: name, Cols: columns, Config: &clickhouse.ChTableConfig{}, SortingKey: []string{"@timestamp", "message"}, VirtualTable: name == "logs-1"})
+	}
+	tableMap.Store(common_table.TableName, &clickhouse.Table{Name: common_table.TableName, Cols: columns, Config: &clickhouse.ChTableConfig{}})
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions["logs"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{
+			ClickhouseTableName: "logs",
+			ClickhouseTables:    []string{"logs"},
+		}},
+	}
+	resolver.Decisions["logs-1"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{
+			ClickhouseTableName: common_table.TableName,
+			ClickhouseTables:    []string{"logs-1"},
+			IsCommonTable:       true,
+		}},
+	}
+
+	// written to both Elasticsearch and ClickHouse
+	resolver.Decisions["logs-dual"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{
+			&table_resolver.ConnectorDecisionElastic{},
+			&table_resolver.ConnectorDecisionClickhouse{ClickhouseTableName: "logs-dual", ClickhouseTables: []string{"logs-dual"}},
+		},
+	}
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.QuesmaConfiguration{IndexConfig: map[string]config.IndexConfiguration{
+		"logs":   {QueryTarget: []string{config.ClickhouseTarget}},
+		"logs-1": {QueryTarget: []string{config.ClickhouseTarget}, UseCommonTable: true},
+	}}
+	indexManagement := elasticsearch.NewFixedIndexManagement()
+	lm := clickhouse.NewLogManagerWithConnection(db, tableMap)
+	managementConsole := ui.NewQuesmaManagementConsole(cfg, nil, indexManagement, make(<-chan logger.LogWithLevel, 50000), telemetry.NewPhoneHomeEmptyAgent(), nil, resolver)
+
+	queryRunner := NewQueryRunner(lm, cfg, indexManagement, managementConsole, &schemaRegistry, ab_testing.NewEmptySender(), resolver)
+	queryRunner.maxParallelQueries = 0
+	return queryRunner, mock
+}
+
+func TestDeleteAndUpdateByQuery(t *testing.T) {
+	tests := []struct {
+		name              string
+		operation         byQueryOperation
+		indexPattern      string
+		body              string
+		expectedCount     string
+		expectedStatement string
+		expectedResponse  string
+	}{
+		{
+			name:              "delete by query",
+			operation:         deleteByQuery,
+			indexPattern:      "logs",
+			body:              `{"query": {"range": {"@timestamp": {"lt": "2024-01-01T00:00:00Z"}}}}`,
+			expectedCount:     `SELECT count(*) FROM logs WHERE "@timestamp"<fromUnixTimestamp64Milli(1704067200000)`,
+			expectedStatement: `DELETE FROM logs WHERE "@timestamp"<fromUnixTimestamp64Milli(1704067200000)`,
+			expectedResponse:  `"deleted":3`,
+		},
+		{
+			name:              "delete by query from common table",
+			operation:         deleteByQuery,
+			indexPattern:      "logs-1",
+			body:              `{"query": {"match_all": {}}}`,
+			expectedCount:     `SELECT count(*) FROM quesma_common_table WHERE "__quesma_index_name"='logs-1'`,
+			expectedStatement: `DELETE FROM quesma_common_table WHERE "__quesma_index_name"='logs-1'`,
+			expectedResponse:  `"deleted":3`,
+		},
+		{
+			name:              "update by query",
+			operation:         updateByQuery,
+			indexPattern:      "logs",
+			body:              `{"query": {"term": {"message": "error"}}, "script": {"source": "ctx._source.count += params.n", "params": {"n": 1}}}`,
+			expectedCount:     `SELECT count(*) FROM logs WHERE "message"='error'`,
+			expectedStatement: `ALTER TABLE logs UPDATE "count" = ("count"+1) WHERE "message"='error'`,
+			expectedResponse:  `"updated":3`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queryRunner, mock := newTestQueryRunnerWithMock(t)
+			mock.ExpectQuery(tt.expectedCount).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(3)))
+			mock.ExpectExec(tt.expectedStatement).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			response, err := queryRunner.handleByQuery(context.Background(), tt.operation, tt.indexPattern, types.MustJSON(tt.body), true)
+			require.NoError(t, err)
+			assert.Contains(t, string(response), tt.expectedResponse)
+			assert.Contains(t, string(response), `"total":3`)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestByQueryDualWrite(t *testing.T) {
+	var forwarded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, r.Method+" "+r.URL.Path+" "+string(body))
+		_, _ = w.Write([]byte(`{"deleted":3}`))
+	}))
+	t.Cleanup(server.Close)
+	serverUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	queryRunner.cfg.Elasticsearch = config.ElasticsearchConfiguration{Url: (*config.Url)(serverUrl)}
+	mock.ExpectQuery(`SELECT count(*) FROM "logs-dual" WHERE "message"='error'`).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(3)))
+	mock.ExpectExec(`DELETE FROM "logs-dual" WHERE "message"='error'`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	response, err := queryRunner.handleDeleteByQuery(context.Background(), "logs-dual", types.MustJSON(`{"query": {"term": {"message": "error"}}}`), true)
+	require.NoError(t, err)
+	assert.Contains(t, string(response), `"deleted":3`)
+	assert.Equal(t, []string{`POST /logs-dual/_delete_by_query {"query":{"term":{"message":"error"}}}`}, forwarded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestByQueryErrors(t *testing.T) {
+	queryRunner, _ := newTestQueryRunnerWithMock(t)
+	ctx := context.Background()
+
+	_, err := queryRunner.handleDeleteByQuery(ctx, "logs", types.MustJSON(`{}`), true)
+	assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+
+	_, err = queryRunner.handleUpdateByQuery(ctx, "logs", types.MustJSON(`{"script": "ctx._source.unknown = 1"}`), true)
+	assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+
+	_, err = queryRunner.handleGetTask(ByQueryTaskIdPrefix + "123")
+	assert.ErrorIs(t, err, errTaskNotFound)
+}
+
+func TestByQueryTask(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	mock.ExpectQuery(`SELECT count(*) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(2)))
+	mock.ExpectExec(`DELETE FROM logs WHERE true`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	response, err := queryRunner.handleDeleteByQuery(context.Background(), "logs", types.MustJSON(`{"query": {"match_all": {}}}`), false)
+	require.NoError(t, err)
+
+	var started struct {
+		Task string `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(response, &started))
+	assert.Equal(t, ByQueryTaskIdPrefix+"1", started.Task)
+
+	var status struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Action string `json:"action"`
+		} `json:"task"`
+		Response ByQueryResponse `json:"response"`
+	}
+	assert.Eventually(t, func() bool {
+		response, err = queryRunner.handleGetTask(started.Task)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(response, &status))
+		return status.Completed
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "indices:data/write/delete/byquery", status.Task.Action)
+	require.NotNil(t, status.Response.Deleted)
+	assert.Equal(t, int64(2), *status.Response.Deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
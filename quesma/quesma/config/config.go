@@ -19,6 +19,11 @@ import (
 const (
 	defaultConfigFileName    = "config.yaml"
 	configFileLocationEnvVar = "QUESMA_CONFIG_FILE"
+
+	// AsyncSearchStorageMemory keeps async search results (and scroll contexts, points in time) in the process memory, they are lost on restart
+	AsyncSearchStorageMemory = "memory"
+	// AsyncSearchStorageElasticsearch keeps async search results (and scroll contexts, points in time) in Elasticsearch indexes shared by all instances
+	AsyncSearchStorageElasticsearch = "elasticsearch"
 )
 
 var (
@@ -49,6 +54,7 @@ type QuesmaConfiguration struct {
 	UseCommonTableForWildcard bool //the meaning of this is to use a common table for wildcard (default) indexes
 	DefaultIngestTarget       []string
 	DefaultQueryTarget        []string
+	AsyncSearchStorage        string // AsyncSearchStorageMemory or AsyncSearchStorageElasticsearch
 }
 
 func (c *QuesmaConfiguration) AliasFields(indexName string) map[string]string {
@@ -257,6 +263,7 @@ Quesma Configuration:
 	UseCommonTableForWildcard: %t,
 	DefaultIngestTarget: %v,
 	DefaultQueryTarget: %v,
+	AsyncSearchStorage: %s,
 `,
 		c.TransparentProxy,
 		elasticUrl,
@@ -278,6 +285,7 @@ Quesma Configuration:
 		c.UseCommonTableForWildcard,
 		c.DefaultIngestTarget,
 		c.DefaultQueryTarget,
+		c.AsyncSearchStorage,
 	)
 }
 
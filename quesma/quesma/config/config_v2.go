@@ -48,6 +48,7 @@ type QuesmaNewConfiguration struct {
 	Processors         []Processor          `koanf:"processors"`
 	Pipelines          []Pipeline           `koanf:"pipelines"`
 	DisableTelemetry   bool                 `koanf:"disableTelemetry"`
+	AsyncSearchStorage string               `koanf:"asyncSearchStorage"`
 }
 
 type LoggingConfiguration struct {
@@ -149,6 +150,7 @@ func (c *QuesmaNewConfiguration) Validate() error {
 	}
 	errAcc = multierror.Append(errAcc, c.validatePipelines())
 	errAcc = multierror.Append(errAcc, c.validateBackendConnectors())
+	errAcc = multierror.Append(errAcc, c.validateAsyncSearchStorage())
 
 	var multiErr *multierror.Error
 	if errors.As(errAcc, &multiErr) {
@@ -160,6 +162,15 @@ func (c *QuesmaNewConfiguration) Validate() error {
 	return nil
 }
 
+func (c *QuesmaNewConfiguration) validateAsyncSearchStorage() error {
+	switch c.AsyncSearchStorage {
+	case "", AsyncSearchStorageMemory, AsyncSearchStorageElasticsearch:
+		return nil
+	default:
+		return fmt.Errorf("invalid async search storage '%s', expected '%s' or '%s'", c.AsyncSearchStorage, AsyncSearchStorageMemory, AsyncSearchStorageElasticsearch)
+	}
+}
+
 func (c *QuesmaNewConfiguration) getFrontendConnectorByName(name string) *FrontendConnector {
 	for _, fc := range c.FrontendConnectors {
 		if fc.Name == name {
@@ -534,6 +545,11 @@ func (c *QuesmaNewConfiguration) TranslateToLegacyConfig() QuesmaConfiguration {
 	conf.InstallationId = c.InstallationId
 	conf.LicenseKey = c.LicenseKey
 
+	conf.AsyncSearchStorage = AsyncSearchStorageMemory
+	if c.AsyncSearchStorage != "" {
+		conf.AsyncSearchStorage = c.AsyncSearchStorage
+	}
+
 	conf.AutodiscoveryEnabled = false
 	conf.Connectors = make(map[string]RelationalDbConfiguration)
 	relDBConn, connType, relationalDBErr := c.getRelationalDBConf()
@@ -118,8 +118,10 @@ func newDualWriteProxy(schemaLoader clickhouse.TableDiscovery, logManager *click
 		logManager:      logManager,
 		publicPort:      config.PublicTcpPort,
 		asyncQueriesEvictor: async_search_storage.NewAsyncQueriesEvictor(
-			queryRunner.AsyncRequestStorage.(async_search_storage.AsyncSearchStorageInMemory),
+			queryRunner.AsyncRequestStorage,
 			queryRunner.AsyncQueriesContexts.(async_search_storage.AsyncQueryContextStorageInMemory),
+			queryRunner.ScrollContexts,
+			queryRunner.pointsInTime.storage,
 		),
 		queryRunner: queryRunner,
 	}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	"io"
 	"net/http"
 	"quesma/clickhouse"
@@ -13,6 +14,7 @@ import (
 	"quesma/end_user_errors"
 	"quesma/ingest"
 	"quesma/logger"
+	"quesma/model"
 	"quesma/queryparser"
 	"quesma/quesma/config"
 	"quesma/quesma/recovery"
@@ -29,6 +31,7 @@ type (
 	BulkRequestEntry struct {
 		operation string
 		index     string
+		id        string
 		document  types.JSON
 		response  *BulkItem
 	}
@@ -71,7 +74,7 @@ func Write(ctx context.Context, defaultIndex *string, bulk types.NDJSON, ip *ing
 	cfg *config.QuesmaConfiguration, phoneHomeAgent telemetry.PhoneHomeAgent, tableResolver table_resolver.TableResolver) (results []BulkItem, err error) {
 	defer recovery.LogPanic()
 
-	bulkSize := len(bulk) / 2 // we divided payload by 2 so that we don't take into account the `action_and_meta_data` line, ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+	bulkSize := bulk.BulkSize() // we don't take into account the `action_and_meta_data` lines, ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
 	maybeLogBatchSize(bulkSize)
 
 	// The returned results should be in the same order as the input request, however splitting the bulk might change the order.
@@ -124,6 +127,7 @@ func splitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, bul
 		entryWithResponse := BulkRequestEntry{
 			operation: operation,
 			index:     index,
+			id:        op.GetId(),
 			document:  document,
 			response:  &results[entryNumber],
 		}
@@ -164,14 +168,7 @@ func splitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, bul
 					Reason: fmt.Sprintf("index %s is not routed to any connector", index),
 				},
 			}
-			switch operation {
-			case "create":
-				entryWithResponse.response.Create = bulkSingleResponse
-
-			case "index":
-				entryWithResponse.response.Index = bulkSingleResponse
-
-			default:
+			if !entryWithResponse.setResponse(bulkSingleResponse) {
 				return fmt.Errorf("unsupported bulk operation type: %s. Document: %v", operation, document)
 			}
 		}
@@ -189,19 +186,22 @@ func splitBulk(ctx context.Context, defaultIndex *string, bulk types.NDJSON, bul
 				elasticRequestBody = append(elasticRequestBody, opBytes...)
 				elasticRequestBody = append(elasticRequestBody, '\n')
 
-				documentBytes, err := document.Bytes()
-				if err != nil {
-					return err
+				// `delete` has no document line
+				if document != nil {
+					documentBytes, err := document.Bytes()
+					if err != nil {
+						return err
+					}
+					elasticRequestBody = append(elasticRequestBody, documentBytes...)
+					elasticRequestBody = append(elasticRequestBody, '\n')
 				}
-				elasticRequestBody = append(elasticRequestBody, documentBytes...)
-				elasticRequestBody = append(elasticRequestBody, '\n')
 
 				elasticBulkEntries = append(elasticBulkEntries, entryWithResponse)
 
 			case *table_resolver.ConnectorDecisionClickhouse:
 
 				// Bulk entry for Clickhouse
-				if operation != "create" && operation != "index" {
+				if operation != "create" && operation != "index" && operation != "update" && operation != "delete" {
 					// Elastic also fails the entire bulk in such case
 					logger.ErrorWithCtxAndReason(ctx, "unsupported bulk operation type").Msgf("unsupported bulk operation type: %s", operation)
 					return fmt.Errorf("unsupported bulk operation type: %s. Operation: %v, Document: %v", operation, rawOp, document)
@@ -257,74 +257,242 @@ func sendToElastic(elasticRequestBody []byte, cfg *config.QuesmaConfiguration, e
 }
 
 func sendToClickhouse(ctx context.Context, clickhouseDocumentsToInsert map[string][]BulkRequestEntry, phoneHomeAgent telemetry.PhoneHomeAgent, cfg *config.QuesmaConfiguration, ip *ingest.IngestProcessor) {
-	for indexName, documents := range clickhouseDocumentsToInsert {
-		phoneHomeAgent.IngestCounters().Add(indexName, int64(len(documents)))
+	for indexName, entries := range clickhouseDocumentsToInsert {
 
-		for _, document := range documents {
-			stats.GlobalStatistics.Process(cfg, indexName, document.document, clickhouse.NestedSeparator)
-		}
+		tableName := indexName
 		// if the index is mapped to specified database table in the configuration, use that table
 		if len(cfg.IndexConfig[indexName].Override) > 0 {
-			indexName = cfg.IndexConfig[indexName].Override
+			tableName = cfg.IndexConfig[indexName].Override
 		}
 
-		inserts := make([]types.JSON, len(documents))
-		for i, document := range documents {
-			inserts[i] = document.document
+		// Operations are applied in the bulk order: each run of consecutive inserts is ingested at once,
+		// and so are runs of `update` and `delete` operations, so e.g. a document can be deleted right after being indexed.
+		for len(entries) > 0 {
+			runLength := 1
+			for runLength < len(entries) && operationKind(entries[runLength].operation) == operationKind(entries[0].operation) {
+				runLength++
+			}
+			run := entries[:runLength]
+			entries = entries[runLength:]
+
+			switch operationKind(run[0].operation) {
+			case "update":
+				applyUpdates(ctx, tableName, run, ip)
+			case "delete":
+				applyDeletes(ctx, tableName, run, ip)
+			default:
+				insertDocuments(ctx, indexName, tableName, run, phoneHomeAgent, cfg, ip)
+			}
 		}
+	}
+}
 
-		err := ip.Ingest(ctx, indexName, inserts)
+// operationKind returns the operation of the entry, treating `create` and `index` as the same one
+func operationKind(operation string) string {
+	if operation == "create" {
+		return "index"
+	}
+	return operation
+}
 
-		for _, document := range documents {
-			bulkSingleResponse := BulkSingleResponse{
-				ID:          "fakeId",
-				Index:       document.index,
-				PrimaryTerm: 1,
-				SeqNo:       0,
-				Shards: BulkShardsResponse{
-					Failed:     0,
-					Successful: 1,
-					Total:      1,
-				},
-				Version: 0,
-				Result:  "created",
-				Status:  201,
-				Type:    "_doc",
-			}
+func insertDocuments(ctx context.Context, indexName, tableName string, documents []BulkRequestEntry, phoneHomeAgent telemetry.PhoneHomeAgent, cfg *config.QuesmaConfiguration, ip *ingest.IngestProcessor) {
+	phoneHomeAgent.IngestCounters().Add(indexName, int64(len(documents)))
 
-			if err != nil {
-				bulkSingleResponse.Result = ""
-				bulkSingleResponse.Status = 400
-				bulkSingleResponse.Shards = BulkShardsResponse{
-					Failed:     1,
-					Successful: 0,
-					Total:      1,
-				}
-				bulkSingleResponse.Error = queryparser.Error{
-					RootCause: []queryparser.RootCause{
-						{
-							Type:   "quesma_error",
-							Reason: err.Error(),
-						},
-					},
-					Type:   "quesma_error",
-					Reason: err.Error(),
-				}
-			}
+	inserts := make([]types.JSON, len(documents))
+	for i := range documents {
+		stats.GlobalStatistics.Process(cfg, indexName, documents[i].document, clickhouse.NestedSeparator)
 
-			// Fill out the response pointer (a pointer to the results array we will return for a bulk)
-			switch document.operation {
-			case "create":
-				document.response.Create = bulkSingleResponse
+		// documents are stored with their ids, so that they can be updated or deleted later
+		if documents[i].id == "" {
+			documents[i].id = uuid.Must(uuid.NewV7()).String()
+		}
+		documents[i].document[model.DocumentIdFieldName] = documents[i].id
+		inserts[i] = documents[i].document
+	}
 
-			case "index":
-				document.response.Index = bulkSingleResponse
+	err := ip.Ingest(ctx, tableName, inserts)
 
-			default:
-				logger.Error().Msgf("unsupported bulk operation type: %s. Document: %v", document.operation, document.document)
+	for _, document := range documents {
+		bulkSingleResponse := newBulkSingleResponse(document, "created", 201, err)
+
+		// Fill out the response pointer (a pointer to the results array we will return for a bulk)
+		if !document.setResponse(bulkSingleResponse) {
+			logger.Error().Msgf("unsupported bulk operation type: %s. Document: %v", document.operation, document.document)
+		}
+	}
+}
+
+// applyUpdates applies `update` operations with a single mutation
+func applyUpdates(ctx context.Context, tableName string, mutations []BulkRequestEntry, ip *ingest.IngestProcessor) {
+	errs := make([]error, len(mutations))
+	var updates []ingest.DocumentUpdate
+
+	for i, mutation := range mutations {
+		if err := validateMutation(mutation); err != nil {
+			errs[i] = err
+		} else if doc, ok := mutation.document["doc"].(map[string]any); ok {
+			updates = append(updates, ingest.DocumentUpdate{Id: mutation.id, Doc: doc})
+		} else {
+			// scripted updates and upserts aren't supported
+			errs[i] = fmt.Errorf("update operation requires a partial document in the doc field")
+		}
+	}
+
+	var found map[string]bool
+	var err error
+	if len(updates) > 0 {
+		found, err = ip.Update(ctx, tableName, updates)
+	}
+
+	for i, mutation := range mutations {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			logger.ErrorWithCtx(ctx).Msgf("error executing bulk update operation of document %s: %v", mutation.id, errs[i])
+			mutation.setResponse(newBulkSingleResponse(mutation, "", 0, errs[i]))
+		} else if !found[mutation.id] {
+			mutation.setResponse(newBulkNotFoundResponse(mutation, "document_missing_exception"))
+		} else {
+			mutation.setResponse(newBulkSingleResponse(mutation, "updated", 200, nil))
+		}
+	}
+}
+
+// applyDeletes applies `delete` operations with a single mutation
+func applyDeletes(ctx context.Context, tableName string, mutations []BulkRequestEntry, ip *ingest.IngestProcessor) {
+	errs := make([]error, len(mutations))
+	var ids []string
+
+	for i, mutation := range mutations {
+		if err := validateMutation(mutation); err != nil {
+			errs[i] = err
+		} else {
+			ids = append(ids, mutation.id)
+		}
+	}
+
+	var found map[string]bool
+	var err error
+	if len(ids) > 0 {
+		found, err = ip.Delete(ctx, tableName, ids)
+	}
+
+	deleted := make(map[string]bool) // a document is deleted only once, even if the bulk deletes it more times
+	for i, mutation := range mutations {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			logger.ErrorWithCtx(ctx).Msgf("error executing bulk delete operation of document %s: %v", mutation.id, errs[i])
+			mutation.setResponse(newBulkSingleResponse(mutation, "", 0, errs[i]))
+		} else if !found[mutation.id] || deleted[mutation.id] {
+			mutation.setResponse(newBulkNotFoundResponse(mutation, ""))
+		} else {
+			deleted[mutation.id] = true
+			mutation.setResponse(newBulkSingleResponse(mutation, "deleted", 200, nil))
+		}
+	}
+}
+
+func validateMutation(mutation BulkRequestEntry) error {
+	if mutation.id == "" {
+		return fmt.Errorf("%s operation requires _id", mutation.operation)
+	}
+	return nil
+}
+
+// newBulkNotFoundResponse is the response for a mutation of a missing document. Like in Elastic, for `delete`
+// it's not an error, just a `not_found` result, for other operations it's an error of the given type.
+func newBulkNotFoundResponse(entry BulkRequestEntry, errorType string) BulkSingleResponse {
+	bulkSingleResponse := newBulkSingleResponse(entry, "not_found", 404, nil)
+	if errorType != "" {
+		reason := fmt.Sprintf("[%s]: document missing", entry.id)
+		bulkSingleResponse.Result = ""
+		bulkSingleResponse.Error = queryparser.Error{
+			RootCause: []queryparser.RootCause{{Type: errorType, Reason: reason}},
+			Type:      errorType,
+			Reason:    reason,
+		}
+	}
+	return bulkSingleResponse
+}
+
+func newBulkSingleResponse(entry BulkRequestEntry, result string, status int, err error) BulkSingleResponse {
+	id := entry.id
+	if id == "" {
+		id = "fakeId"
+	}
+	bulkSingleResponse := BulkSingleResponse{
+		ID:          id,
+		Index:       entry.index,
+		PrimaryTerm: 1,
+		SeqNo:       0,
+		Shards: BulkShardsResponse{
+			Failed:     0,
+			Successful: 1,
+			Total:      1,
+		},
+		Version: 0,
+		Result:  result,
+		Status:  status,
+		Type:    "_doc",
+	}
+
+	if err != nil {
+		bulkSingleResponse.Result = ""
+		bulkSingleResponse.Status = 400
+		bulkSingleResponse.Shards = BulkShardsResponse{
+			Failed:     1,
+			Successful: 0,
+			Total:      1,
+		}
+		bulkSingleResponse.Error = queryparser.Error{
+			RootCause: []queryparser.RootCause{
+				{
+					Type:   "quesma_error",
+					Reason: err.Error(),
+				},
+			},
+			Type:   "quesma_error",
+			Reason: err.Error(),
+		}
+	}
+	return bulkSingleResponse
+}
+
+// HasError returns true if the operation of the item failed
+func (item BulkItem) HasError() bool {
+	for _, response := range []any{item.Create, item.Index, item.Update, item.Delete} {
+		switch r := response.(type) {
+		case BulkSingleResponse:
+			if r.Error != nil {
+				return true
+			}
+		case map[string]any: // response from Elastic
+			if r["error"] != nil {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// setResponse fills out the response pointer with the response of the entry operation, returns false for unknown operations
+func (entry BulkRequestEntry) setResponse(response BulkSingleResponse) bool {
+	switch entry.operation {
+	case "create":
+		entry.response.Create = response
+	case "index":
+		entry.response.Index = response
+	case "update":
+		entry.response.Update = response
+	case "delete":
+		entry.response.Delete = response
+	default:
+		return false
+	}
+	return true
 }
 
 // Global set to keep track of logged batch sizes
@@ -3,8 +3,20 @@
 package bulk
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/ingest"
+	"quesma/persistence"
+	"quesma/quesma/config"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"quesma/table_resolver"
+	"quesma/telemetry"
 	"testing"
 )
 
@@ -43,3 +55,87 @@ func Test_unmarshalElasticResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestBulkItemHasError(t *testing.T) {
+	var fromElastic BulkResponse
+	err := json.Unmarshal([]byte(`{"errors":true,"took":1,"items":[{"delete":{"_index":"a","_id":"1","status":404,"result":"not_found"}},{"update":{"_index":"a","_id":"2","status":400,"error":{"type":"document_missing_exception"}}}]}`), &fromElastic)
+	require.NoError(t, err)
+
+	require.False(t, fromElastic.Items[0].HasError())
+	require.True(t, fromElastic.Items[1].HasError())
+
+	entry := BulkRequestEntry{operation: "delete", index: "a", id: "1", response: &BulkItem{}}
+	entry.setResponse(newBulkSingleResponse(entry, "deleted", 200, nil))
+	require.False(t, entry.response.HasError())
+
+	entry = BulkRequestEntry{operation: "update", index: "a", id: "1", response: &BulkItem{}}
+	entry.setResponse(newBulkSingleResponse(entry, "updated", 200, errors.New("no such column")))
+	require.True(t, entry.response.HasError())
+}
+
+func TestWriteAppliesOperationsInOrder(t *testing.T) {
+	const tableName = "logs"
+
+	cfg := &config.QuesmaConfiguration{}
+	tables := clickhouse.NewTableMap()
+	tables.Store(tableName, &clickhouse.Table{
+		Name: tableName,
+		Cols: map[string]*clickhouse.Column{
+			"@timestamp": {Name: "@timestamp", Type: clickhouse.BaseType{Name: "DateTime64"}},
+			"_id":        {Name: "_id", Type: clickhouse.BaseType{Name: "String"}},
+			"message":    {Name: "message", Type: clickhouse.BaseType{Name: "String"}},
+		},
+		Config:  ingest.NewDefaultCHConfig(),
+		Created: true,
+	})
+
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[tableName] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{
+			ClickhouseTableName: tableName,
+		}}}
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ip := ingest.NewIngestProcessor(cfg, db, telemetry.NewPhoneHomeEmptyAgent(), clickhouse.NewTableDiscoveryWith(cfg, nil, *tables),
+		&schema.StaticRegistry{}, persistence.NewStaticJSONDatabase(), resolver)
+
+	bulk, err := types.ParseNDJSON(`{"index":{"_index":"logs","_id":"1"}}
+{"message":"first"}
+{"delete":{"_index":"logs","_id":"1"}}
+{"delete":{"_index":"logs","_id":"2"}}
+{"index":{"_index":"logs","_id":"3"}}
+{"message":"third"}
+`)
+	require.NoError(t, err)
+
+	// the document is deleted after it's ingested, and the next one is ingested after the deletion
+	mock.ExpectExec(`INSERT INTO "logs" FORMAT JSONEachRow {"_id":"1","message":"first"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT DISTINCT "_id" FROM "logs" WHERE "_id" IN ('1', '2')`).WillReturnRows(sqlmock.NewRows([]string{"_id"}).AddRow("1"))
+	mock.ExpectExec(`DELETE FROM "logs" WHERE "_id" IN ('1')`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "logs" FORMAT JSONEachRow {"_id":"3","message":"third"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	results, err := Write(context.Background(), nil, bulk, ip, cfg, telemetry.NewPhoneHomeEmptyAgent(), resolver)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, results, 4)
+	expected := []struct {
+		response BulkSingleResponse
+		result   string
+		status   int
+	}{
+		{response: results[0].Index.(BulkSingleResponse), result: "created", status: 201},
+		{response: results[1].Delete.(BulkSingleResponse), result: "deleted", status: 200},
+		{response: results[2].Delete.(BulkSingleResponse), result: "not_found", status: 404},
+		{response: results[3].Index.(BulkSingleResponse), result: "created", status: 201},
+	}
+	for i, tt := range expected {
+		assert.Equal(t, tt.result, tt.response.Result, i)
+		assert.Equal(t, tt.status, tt.response.Status, i)
+		assert.False(t, results[i].HasError(), i)
+	}
+	assert.Equal(t, "2", results[2].Delete.(BulkSingleResponse).ID)
+}
@@ -22,6 +22,71 @@ func matchedAgainstAsyncId() mux.RequestMatcher {
 	})
 }
 
+func matchedAgainstByQueryTaskId() mux.RequestMatcher {
+	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
+		if !strings.HasPrefix(req.Params["id"], ByQueryTaskIdPrefix) {
+			logger.Debug().Msgf("task id %s is forwarded to Elasticsearch", req.Params["id"])
+			return mux.MatchResult{Matched: false}
+		}
+		return mux.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstPointInTimeId matches requests with our point in time id in the body:
+// searches (`"pit": {"id": ...}`) and closing the point in time (`"id": ...`)
+func matchedAgainstPointInTimeId() mux.RequestMatcher {
+	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
+		body, ok := req.ParsedBody.(types.JSON)
+		if !ok {
+			return mux.MatchResult{Matched: false}
+		}
+		if id, _ := pointInTimeIdOfSearch(body); id != "" {
+			return mux.MatchResult{Matched: true}
+		}
+		id, _ := body["id"].(string)
+		return mux.MatchResult{Matched: strings.HasPrefix(id, PointInTimeIdPrefix)}
+	})
+}
+
+// matchedAgainstScrollId matches requests with our scroll id in the path or in the body
+func matchedAgainstScrollId() mux.RequestMatcher {
+	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
+		body, _ := req.ParsedBody.(types.JSON)
+		ids := scrollIdsOfRequest(req.Params["scroll_id"], body)
+		if len(ids) == 0 || !strings.HasPrefix(ids[0], ScrollIdPrefix) {
+			logger.Debug().Msgf("scroll ids %v are forwarded to Elasticsearch", ids)
+			return mux.MatchResult{Matched: false}
+		}
+		return mux.MatchResult{Matched: true}
+	})
+}
+
+// matchedAgainstSQLRequest matches SQL queries of indexes handled by Clickhouse and our cursors
+func matchedAgainstSQLRequest(tableResolver table_resolver.TableResolver) mux.RequestMatcher {
+	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
+		body, _ := req.ParsedBody.(types.JSON)
+		if cursor, ok := body["cursor"].(string); ok && cursor != "" {
+			return mux.MatchResult{Matched: strings.HasPrefix(cursor, SQLCursorPrefix)}
+		}
+
+		indexPattern, err := sqlIndexOfRequest(body)
+		if err != nil || indexPattern == "" {
+			// Elasticsearch will report the error
+			return mux.MatchResult{Matched: false}
+		}
+		decision := tableResolver.Resolve(table_resolver.QueryPipeline, indexPattern)
+		if decision.Err != nil {
+			return mux.MatchResult{Matched: false, Decision: decision}
+		}
+		for _, connector := range decision.UseConnectors {
+			if _, ok := connector.(*table_resolver.ConnectorDecisionClickhouse); ok {
+				return mux.MatchResult{Matched: true, Decision: decision}
+			}
+		}
+		return mux.MatchResult{Matched: false, Decision: decision}
+	})
+}
+
 func matchedAgainstBulkBody(configuration *config.QuesmaConfiguration, tableResolver table_resolver.TableResolver) mux.RequestMatcher {
 	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
 		idx := 0
@@ -45,6 +110,11 @@ func matchedAgainstBulkBody(configuration *config.QuesmaConfiguration, tableReso
 						return mux.MatchResult{Matched: true, Decision: decision}
 					}
 				}
+
+				// `delete` has no document line
+				if deleteOperationPattern.MatchString(s) {
+					continue
+				}
 			}
 			idx += 1
 		}
@@ -54,6 +124,45 @@ func matchedAgainstBulkBody(configuration *config.QuesmaConfiguration, tableReso
 	})
 }
 
+// matchedAgainstMultiSearchBody matches only if every _msearch header targets an index handled by Clickhouse.
+// We can't answer searches on Elastic-only indexes, so if there's at least one such search, the whole request goes to Elastic.
+func matchedAgainstMultiSearchBody(tableResolver table_resolver.TableResolver) mux.RequestMatcher {
+	return mux.RequestMatcherFunc(func(req *mux.Request) mux.MatchResult {
+		body, err := types.ExpectNDJSON(req.ParsedBody)
+		if err != nil {
+			return mux.MatchResult{Matched: false}
+		}
+
+		items, err := parseMultiSearchItems(req.Params["index"], body)
+		if err != nil || len(items) == 0 {
+			return mux.MatchResult{Matched: false}
+		}
+
+		var lastDecision *table_resolver.Decision
+		for _, item := range items {
+			if item.indexPattern == "" {
+				return mux.MatchResult{Matched: false}
+			}
+			decision := tableResolver.Resolve(table_resolver.QueryPipeline, item.indexPattern)
+			if decision.Err != nil {
+				return mux.MatchResult{Matched: false, Decision: decision}
+			}
+			usesClickhouse := false
+			for _, connector := range decision.UseConnectors {
+				if _, ok := connector.(*table_resolver.ConnectorDecisionClickhouse); ok {
+					usesClickhouse = true
+				}
+			}
+			if !usesClickhouse {
+				return mux.MatchResult{Matched: false, Decision: decision}
+			}
+			lastDecision = decision
+		}
+
+		return mux.MatchResult{Matched: true, Decision: lastDecision}
+	})
+}
+
 // Query path only (looks at QueryTarget)
 func matchedAgainstPattern(indexRegistry table_resolver.TableResolver) mux.RequestMatcher {
 	return matchAgainstTableResolver(indexRegistry, table_resolver.QueryPipeline)
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"quesma/quesma/mux"
 	"quesma/quesma/types"
+	"quesma/table_resolver"
 	"testing"
 )
 
@@ -400,3 +401,50 @@ func TestMatchAgainstKibanaAlerts(t *testing.T) {
 	}
 
 }
+
+func TestMatchedAgainstMultiSearchBody(t *testing.T) {
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions["logs"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{ClickhouseTableName: "logs"}},
+	}
+	resolver.Decisions["metrics"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionClickhouse{ClickhouseTableName: "metrics"}},
+	}
+	resolver.Decisions["kibana"] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{&table_resolver.ConnectorDecisionElastic{}},
+	}
+
+	tests := []struct {
+		name      string
+		pathIndex string
+		body      string
+		expected  bool
+	}{
+		{"all searches on clickhouse", "", `{"index":"logs"}
+{"size":0}
+{"index":["metrics"]}
+{"size":0}
+`, true},
+		{"one search on elastic", "", `{"index":"logs"}
+{"size":0}
+{"index":"kibana"}
+{"size":0}
+`, false},
+		{"index from path", "logs", `{}
+{"size":0}
+`, true},
+		{"no index at all", "", `{}
+{"size":0}
+`, false},
+		{"unknown index", "", `{"index":"unknown"}
+{"size":0}
+`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &mux.Request{Body: test.body, Params: map[string]string{"index": test.pathIndex}}
+			req.ParsedBody = types.ParseRequestBody(test.body)
+			assert.Equal(t, test.expected, matchedAgainstMultiSearchBody(resolver).Matches(req).Matched)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"quesma/clickhouse"
+	"quesma/kibana"
+	"quesma/model"
+	"quesma/quesma/async_search_storage"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"strings"
+	"time"
+)
+
+// Point in time (`POST /:index/_pit`) pins the index pattern and the moment it was opened.
+// Searches within it only see documents with timestamps up to that moment, so that paging
+// with search_after is stable while new documents are being inserted.
+// Documents inserted later with older timestamps will be visible, we can't do any better without storing insert times.
+// Points in time are kept in the same kind of storage as async search results (memory or Elasticsearch).
+
+const PointInTimeIdPrefix = "quesma_pit_"
+
+var errPointInTimeNotFound = errors.New("point in time not found")
+
+type pointInTime struct {
+	id           string
+	indexPattern string
+	openedAt     time.Time
+	expiresAt    time.Time
+}
+
+type pointsInTime struct {
+	storage async_search_storage.PointInTimeStorage
+}
+
+func newPointsInTime(storage async_search_storage.PointInTimeStorage) *pointsInTime {
+	return &pointsInTime{storage: storage}
+}
+
+func (p *pointsInTime) open(indexPattern string, keepAlive time.Duration) pointInTime {
+	now := time.Now()
+	pit := pointInTime{
+		id:           PointInTimeIdPrefix + uuid.Must(uuid.NewV7()).String(),
+		indexPattern: indexPattern,
+		openedAt:     now,
+		expiresAt:    now.Add(keepAlive),
+	}
+	p.storage.Store(pit.id, pit.context())
+	return pit
+}
+
+// use returns the point in time and extends its keep alive (if it's not 0)
+func (p *pointsInTime) use(id string, keepAlive time.Duration) (pointInTime, error) {
+	context, ok := p.storage.Load(id)
+	if !ok {
+		return pointInTime{}, errPointInTimeNotFound
+	}
+	pit := pointInTime{id: id, indexPattern: context.IndexPattern, openedAt: context.OpenedAt, expiresAt: context.ExpiresAt}
+	if keepAlive > 0 {
+		pit.expiresAt = time.Now().Add(keepAlive)
+		p.storage.Store(id, pit.context())
+	}
+	return pit, nil
+}
+
+func (p *pointsInTime) close(id string) bool {
+	return p.storage.Delete(id)
+}
+
+func (pit *pointInTime) context() async_search_storage.PointInTimeContext {
+	return async_search_storage.PointInTimeContext{IndexPattern: pit.indexPattern, OpenedAt: pit.openedAt, ExpiresAt: pit.expiresAt}
+}
+
+func parseKeepAlive(keepAlive string) (time.Duration, error) {
+	duration, err := kibana.ParseInterval(keepAlive)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: invalid keep_alive: %s", quesma_errors.ErrCouldNotParseRequest(), keepAlive)
+	}
+	return duration, nil
+}
+
+func (q *QueryRunner) handleOpenPointInTime(indexPattern string, keepAlive string) ([]byte, error) {
+	if keepAlive == "" {
+		return nil, fmt.Errorf("%w: keep_alive is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	duration, err := parseKeepAlive(keepAlive)
+	if err != nil {
+		return nil, err
+	}
+	pit := q.pointsInTime.open(indexPattern, duration)
+	return json.Marshal(map[string]any{"id": pit.id})
+}
+
+func (q *QueryRunner) handleClosePointInTime(body types.JSON) ([]byte, error) {
+	id, _ := body["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	freed := 0
+	if q.pointsInTime.close(id) {
+		freed = 1
+	}
+	return json.Marshal(map[string]any{"succeeded": true, "num_freed": freed})
+}
+
+// pointInTimeOfSearch returns the point in time the search request is run in, nil if it doesn't use our point in time
+func (q *QueryRunner) pointInTimeOfSearch(body types.JSON) (*pointInTime, error) {
+	id, keepAlive := pointInTimeIdOfSearch(body)
+	if id == "" {
+		return nil, nil
+	}
+	var duration time.Duration
+	if keepAlive != "" {
+		var err error
+		if duration, err = parseKeepAlive(keepAlive); err != nil {
+			return nil, err
+		}
+	}
+	pit, err := q.pointsInTime.use(id, duration)
+	if err != nil {
+		return nil, err
+	}
+	return &pit, nil
+}
+
+func pointInTimeIdOfSearch(body types.JSON) (id, keepAlive string) {
+	pit, ok := body["pit"].(map[string]any)
+	if !ok {
+		return "", ""
+	}
+	id, _ = pit["id"].(string)
+	keepAlive, _ = pit["keep_alive"].(string)
+	if !strings.HasPrefix(id, PointInTimeIdPrefix) {
+		return "", ""
+	}
+	return id, keepAlive
+}
+
+// pinnedQuery returns the search body with the query limited to documents, which existed when the point in time was opened.
+// Nothing is changed if the table has no timestamp field.
+func (pit *pointInTime) pinnedQuery(body types.JSON, table *clickhouse.Table, currentSchema schema.Schema) types.JSON {
+	timestampField, ok := timestampFieldOf(table, currentSchema)
+	if !ok {
+		return body
+	}
+	pinned := body.Clone()
+	boundary := map[string]any{"range": map[string]any{
+		timestampField: map[string]any{"lte": pit.openedAt.UTC().Format("2006-01-02T15:04:05.000Z")},
+	}}
+	filters := []any{boundary}
+	if query, ok := body["query"]; ok {
+		filters = append(filters, query)
+	}
+	pinned["query"] = map[string]any{"bool": map[string]any{"filter": filters}}
+	return pinned
+}
+
+// timestampFieldOf returns the table's timestamp field: `@timestamp`, if it's in the schema (it may be mapped
+// to another column in the configuration), or else the discovered timestamp column of the table
+func timestampFieldOf(table *clickhouse.Table, currentSchema schema.Schema) (string, bool) {
+	if _, ok := currentSchema.Fields[model.TimestampFieldName]; ok {
+		return model.TimestampFieldName, true
+	}
+	if table != nil && table.DiscoveredTimestampFieldName != nil {
+		if field, ok := currentSchema.ResolveFieldByInternalName(*table.DiscoveredTimestampFieldName); ok {
+			return field.PropertyName.AsString(), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,83 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPointInTime(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+
+	response, err := queryRunner.handleOpenPointInTime("logs", "1m")
+	require.NoError(t, err)
+	var opened struct {
+		Id string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(response, &opened))
+	require.True(t, strings.HasPrefix(opened.Id, PointInTimeIdPrefix))
+
+	pit, ok := queryRunner.pointsInTime.storage.Load(opened.Id)
+	require.True(t, ok)
+	boundary := pit.OpenedAt.UnixMilli()
+
+	// there are no document ids in the table, so all fields are tiebreakers, which make the order total
+	mock.ExpectQuery(fmt.Sprintf(`SELECT "@timestamp", "count", "message" FROM logs WHERE ("@timestamp"<=fromUnixTimestamp64Milli(%d) AND "message"='error') `+
+		`ORDER BY "@timestamp" DESC, "count" ASC, "message" ASC LIMIT 10`, boundary)).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "count", "message"}).AddRow(time.UnixMilli(boundary), 1, "error"))
+
+	body := fmt.Sprintf(`{"pit": {"id": "%s", "keep_alive": "5m"}, "track_total_hits": false,
+		"query": {"term": {"message": "error"}}, "sort": [{"@timestamp": "desc"}]}`, opened.Id)
+	response, err = queryRunner.handleSearch(ctx, "", types.MustJSON(body))
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var searchResponse struct {
+		PitId string `json:"pit_id"`
+	}
+	require.NoError(t, json.Unmarshal(response, &searchResponse))
+	assert.Equal(t, opened.Id, searchResponse.PitId)
+
+	response, err = queryRunner.handleClosePointInTime(types.JSON{"id": opened.Id})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"succeeded": true, "num_freed": 1}`, string(response))
+
+	_, err = queryRunner.handleSearch(ctx, "", types.MustJSON(body))
+	assert.ErrorIs(t, err, errPointInTimeNotFound)
+}
+
+func TestPointInTimePinnedQuery(t *testing.T) {
+	pit := pointInTime{openedAt: time.UnixMilli(1706832000000)}
+	body := types.MustJSON(`{"query": {"term": {"message": "error"}}}`)
+	pinnedBy := func(field string) types.JSON {
+		return types.JSON{"query": map[string]any{"bool": map[string]any{"filter": []any{
+			map[string]any{"range": map[string]any{field: map[string]any{"lte": "2024-02-02T00:00:00.000Z"}}},
+			body["query"],
+		}}}}
+	}
+
+	withTimestamp := schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "ts", Type: schema.QuesmaTypeDate},
+	}}
+	assert.Equal(t, pinnedBy("@timestamp"), pit.pinnedQuery(body, &clickhouse.Table{Name: "logs"}, withTimestamp))
+
+	// without @timestamp, the discovered timestamp column of the table is used
+	discovered := "event_time"
+	table := &clickhouse.Table{Name: "logs", DiscoveredTimestampFieldName: &discovered}
+	withEventTime := schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"event.time": {PropertyName: "event.time", InternalPropertyName: "event_time", Type: schema.QuesmaTypeDate},
+	}}
+	assert.Equal(t, pinnedBy("event.time"), pit.pinnedQuery(body, table, withEventTime))
+
+	assert.Equal(t, body, pit.pinnedQuery(body, &clickhouse.Table{Name: "logs"}, withEventTime))
+}
@@ -29,6 +29,7 @@ import (
 	"quesma/telemetry"
 	"quesma/tracing"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -119,6 +120,62 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 		}
 	})
 
+	router.Register(routes.IndexDeleteByQuery, and(method("POST"), matchedExactIngestPath(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody, err := queryRunner.handleDeleteByQuery(ctx, req.Params["index"], body, req.QueryParams.Get("wait_for_completion") != "false")
+		return byQueryResult(responseBody, err)
+	})
+
+	router.Register(routes.IndexUpdateByQuery, and(method("POST"), matchedExactIngestPath(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody, err := queryRunner.handleUpdateByQuery(ctx, req.Params["index"], body, req.QueryParams.Get("wait_for_completion") != "false")
+		return byQueryResult(responseBody, err)
+	})
+
+	router.Register(routes.TaskIdPath, and(method("GET"), matchedAgainstByQueryTaskId()), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		responseBody, err := queryRunner.handleGetTask(req.Params["id"])
+		if err != nil {
+			if errors.Is(err, errTaskNotFound) {
+				return &mux.Result{StatusCode: http.StatusNotFound}, nil
+			}
+			return nil, err
+		}
+		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+	})
+
+	// searches in a point in time have no index in the path, the index is taken from the point in time.
+	// It must be registered before the other handler of this path, as only the first one matching the path is considered.
+	router.Register(routes.GlobalSearchPath, and(method("GET", "POST"), matchedAgainstPointInTimeId()), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody, err := queryRunner.handleSearch(ctx, "", body)
+		if err != nil {
+			if errors.Is(err, errPointInTimeNotFound) || errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+				return &mux.Result{StatusCode: http.StatusNotFound}, nil
+			} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+				return &mux.Result{
+					Body:       string(queryparser.BadRequestParseError(err)),
+					StatusCode: http.StatusBadRequest,
+				}, nil
+			} else {
+				return nil, err
+			}
+		}
+		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+	})
+
 	// TODO: This endpoint is currently disabled (mux.Never()) as it's pretty much used only by internal Kibana requests,
 	// it's error-prone to detect them in matchAgainstKibanaInternal() and Quesma can't handle well the cases of wildcard
 	// matching many indices either way.
@@ -141,6 +198,77 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
 	})
 
+	router.Register(routes.IndexPointInTimePath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		responseBody, err := queryRunner.handleOpenPointInTime(req.Params["index"], req.QueryParams.Get("keep_alive"))
+		if err != nil {
+			if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+				return &mux.Result{
+					Body:       string(queryparser.BadRequestParseError(err)),
+					StatusCode: http.StatusBadRequest,
+				}, nil
+			}
+			return nil, err
+		}
+		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+	})
+
+	router.Register(routes.PointInTimePath, and(method("DELETE"), matchedAgainstPointInTimeId()), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody, err := queryRunner.handleClosePointInTime(body)
+		if err != nil {
+			return nil, err
+		}
+		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+	})
+
+	scrollHandler := func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, _ := req.ParsedBody.(types.JSON)
+		ids := scrollIdsOfRequest(req.Params["scroll_id"], body)
+		if req.Method == "DELETE" {
+			return scrollResult(queryRunner.handleClearScroll(ids))
+		}
+		keepAlive := req.QueryParams.Get("scroll")
+		if bodyKeepAlive, ok := body["scroll"].(string); ok {
+			keepAlive = bodyKeepAlive
+		}
+		return scrollResult(queryRunner.handleScroll(ctx, ids[0], keepAlive))
+	}
+	router.Register(routes.ScrollPath, and(method("GET", "POST", "DELETE"), matchedAgainstScrollId()), scrollHandler)
+	router.Register(routes.ScrollIdPath, and(method("GET", "POST", "DELETE"), matchedAgainstScrollId()), scrollHandler)
+
+	router.Register(routes.SQLPath, and(method("GET", "POST"), matchedAgainstSQLRequest(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		responseBody, contentType, err := queryRunner.handleSQL(ctx, body, req.QueryParams.Get("format"))
+		result, err := sqlResult(responseBody, err)
+		if result != nil && result.StatusCode == http.StatusOK {
+			result.Meta["Content-Type"] = contentType
+		}
+		return result, err
+	})
+
+	router.Register(routes.SQLTranslatePath, and(method("GET", "POST"), matchedAgainstSQLRequest(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return sqlResult(queryRunner.handleSQLTranslate(body))
+	})
+
+	router.Register(routes.SQLClosePath, and(method("POST"), matchedAgainstSQLRequest(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		body, err := types.ExpectJSON(req.ParsedBody)
+		if err != nil {
+			return nil, err
+		}
+		return sqlResult(queryRunner.handleSQLClose(body))
+	})
+
 	router.Register(routes.IndexSearchPath, and(method("GET", "POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
 
 		body, err := types.ExpectJSON(req.ParsedBody)
@@ -148,7 +276,12 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 			return nil, err
 		}
 
-		responseBody, err := queryRunner.handleSearch(ctx, req.Params["index"], body)
+		var responseBody []byte
+		if keepAlive := req.QueryParams.Get("scroll"); keepAlive != "" {
+			responseBody, err = queryRunner.handleScrollSearch(ctx, req.Params["index"], body, keepAlive)
+		} else {
+			responseBody, err = queryRunner.handleSearch(ctx, req.Params["index"], body)
+		}
 		if err != nil {
 			if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
 				return &mux.Result{StatusCode: http.StatusNotFound}, nil
@@ -163,6 +296,14 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 		}
 		return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
 	})
+	router.Register(routes.MultiSearchPath, and(method("GET", "POST"), matchedAgainstMultiSearchBody(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		return multiSearchResult(ctx, queryRunner, req)
+	})
+
+	router.Register(routes.IndexMultiSearchPath, and(method("GET", "POST"), matchedAgainstMultiSearchBody(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
+		return multiSearchResult(ctx, queryRunner, req)
+	})
+
 	router.Register(routes.IndexAsyncSearchPath, and(method("POST"), matchedAgainstPattern(tableResolver)), func(ctx context.Context, req *mux.Request) (*mux.Result, error) {
 		waitForResultsMs := 1000 // Defaults to 1 second as in docs
 		if v, ok := req.Params["wait_for_completion_timeout"]; ok {
@@ -370,6 +511,51 @@ func configureRouter(cfg *config.QuesmaConfiguration, sr schema.Registry, lm *cl
 	return router
 }
 
+func byQueryResult(responseBody []byte, err error) (*mux.Result, error) {
+	if err != nil {
+		if errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &mux.Result{StatusCode: http.StatusNotFound}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &mux.Result{
+				Body:       string(queryparser.BadRequestParseError(err)),
+				StatusCode: http.StatusBadRequest,
+			}, nil
+		}
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func scrollResult(responseBody []byte, err error) (*mux.Result, error) {
+	if err != nil {
+		if errors.Is(err, errScrollNotFound) || errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &mux.Result{StatusCode: http.StatusNotFound}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &mux.Result{
+				Body:       string(queryparser.BadRequestParseError(err)),
+				StatusCode: http.StatusBadRequest,
+			}, nil
+		}
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
+func sqlResult(responseBody []byte, err error) (*mux.Result, error) {
+	if err != nil {
+		if errors.Is(err, errSQLCursorNotFound) || errors.Is(quesma_errors.ErrIndexNotExists(), err) {
+			return &mux.Result{StatusCode: http.StatusNotFound}, nil
+		} else if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &mux.Result{
+				Body:       string(queryparser.BadRequestParseError(err)),
+				StatusCode: http.StatusBadRequest,
+			}, nil
+		}
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
 func elasticsearchCountResult(body int64, statusCode int) (*mux.Result, error) {
 	var result = countResult{
 		Shards: struct {
@@ -405,6 +591,25 @@ type countResult struct {
 	Count int64 `json:"count"`
 }
 
+func multiSearchResult(ctx context.Context, queryRunner *QueryRunner, req *mux.Request) (*mux.Result, error) {
+	body, err := types.ExpectNDJSON(req.ParsedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := queryRunner.handleMultiSearch(ctx, req.Params["index"], body)
+	if err != nil {
+		if errors.Is(err, quesma_errors.ErrCouldNotParseRequest()) {
+			return &mux.Result{
+				Body:       string(queryparser.BadRequestParseError(err)),
+				StatusCode: http.StatusBadRequest,
+			}, nil
+		}
+		return nil, err
+	}
+	return elasticsearchQueryResult(string(responseBody), http.StatusOK), nil
+}
+
 func elasticsearchQueryResult(body string, statusCode int) *mux.Result {
 	return &mux.Result{Body: body, Meta: map[string]string{
 		// TODO copy paste from the original request
@@ -464,7 +669,7 @@ func bulkInsertResult(ctx context.Context, ops []bulk.BulkItem, err error) (*mux
 	}
 
 	body, err := json.Marshal(bulk.BulkResponse{
-		Errors: false,
+		Errors: slices.ContainsFunc(ops, bulk.BulkItem.HasError),
 		Items:  ops,
 		Took:   42,
 	})
@@ -550,6 +755,7 @@ type (
 )
 
 var indexNamePattern = regexp.MustCompile(`"_index"\s*:\s*"([^"]+)"`)
+var deleteOperationPattern = regexp.MustCompile(`^\s*\{\s*"delete"\s*:`)
 
 func extractIndexName(input string) string {
 	results := indexNamePattern.FindStringSubmatch(input)
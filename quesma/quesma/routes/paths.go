@@ -9,8 +9,13 @@ import (
 const (
 	GlobalSearchPath     = "/_search"
 	IndexSearchPath      = "/:index/_search"
+	MultiSearchPath      = "/_msearch"
+	IndexMultiSearchPath = "/:index/_msearch"
 	IndexAsyncSearchPath = "/:index/_async_search"
 	IndexCountPath       = "/:index/_count"
+	IndexDeleteByQuery   = "/:index/_delete_by_query"
+	IndexUpdateByQuery   = "/:index/_update_by_query"
+	IndexPointInTimePath = "/:index/_pit"
 	IndexDocPath         = "/:index/_doc"
 	IndexRefreshPath     = "/:index/_refresh"
 	IndexBulkPath        = "/:index/_bulk"
@@ -23,6 +28,13 @@ const (
 	BulkPath             = "/_bulk"
 	AsyncSearchIdPrefix  = "/_async_search/"
 	AsyncSearchIdPath    = "/_async_search/:id"
+	TaskIdPath           = "/_tasks/:id"
+	PointInTimePath      = "/_pit"
+	ScrollPath           = "/_search/scroll"
+	ScrollIdPath         = "/_search/scroll/:scroll_id"
+	SQLPath              = "/_sql"
+	SQLTranslatePath     = "/_sql/translate"
+	SQLClosePath         = "/_sql/close"
 	KibanaInternalPrefix = "/.kibana_"
 	IndexPath            = "/:index"
 
@@ -182,5 +182,10 @@ func NewArrayJoinVisitor(resolver arrayTypeResolver) model.ExprVisitor {
 		return e
 	}
 
+	// arrays in ARRAY JOIN (nested aggregation) are already unfolded there
+	visitor.OverrideVisitArrayJoinExpr = func(b *model.BaseExprVisitor, e model.ArrayJoinExpr) interface{} {
+		return model.NewArrayJoinExpr(e.Lhs.Accept(b).(model.Expr), e.Arrays)
+	}
+
 	return visitor
 }
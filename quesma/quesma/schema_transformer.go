@@ -247,6 +247,10 @@ func (s *SchemaCheckPass) applyGeoTransformations(schemaInstance schema.Schema,
 		if query.WhereClause != nil {
 			where = query.WhereClause.Accept(v).(model.Expr)
 		}
+		having := query.HavingClause
+		if query.HavingClause != nil {
+			having = query.HavingClause.Accept(v).(model.Expr)
+		}
 
 		var namedCTEs []*model.CTE
 		if query.NamedCTEs != nil {
@@ -261,7 +265,7 @@ func (s *SchemaCheckPass) applyGeoTransformations(schemaInstance schema.Schema,
 				limitBy = append(limitBy, expr.Accept(v).(model.Expr))
 			}
 		}
-		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, limitBy, query.Limit, query.SampleLimit, query.IsDistinct, namedCTEs)
+		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, having, limitBy, query.Limit, query.Offset, query.SampleLimit, query.IsDistinct, namedCTEs)
 	}
 
 	expr := query.SelectCommand.Accept(visitor)
@@ -408,6 +412,10 @@ func (s *SchemaCheckPass) applyPhysicalFromExpression(currentSchema schema.Schem
 		if selectStm.WhereClause != nil {
 			where = selectStm.WhereClause.Accept(b).(model.Expr)
 		}
+		having := selectStm.HavingClause
+		if selectStm.HavingClause != nil {
+			having = selectStm.HavingClause.Accept(b).(model.Expr)
+		}
 
 		// add filter for common table, if needed
 		if useCommonTable && from == physicalFromExpression {
@@ -434,7 +442,7 @@ func (s *SchemaCheckPass) applyPhysicalFromExpression(currentSchema schema.Schem
 			}
 		}
 
-		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, selectStm.LimitBy, selectStm.Limit, selectStm.SampleLimit, selectStm.IsDistinct, namedCTEs)
+		return model.NewSelectCommand(columns, groupBy, orderBy, from, where, having, selectStm.LimitBy, selectStm.Limit, selectStm.Offset, selectStm.SampleLimit, selectStm.IsDistinct, namedCTEs)
 	}
 
 	expr := query.SelectCommand.Accept(visitor)
@@ -656,12 +664,30 @@ func (s *SchemaCheckPass) applyFieldEncoding(indexSchema schema.Schema, query *m
 	return query, nil
 }
 
+// timestampScriptFieldName is how scripts usually refer to the timestamp field
+const timestampScriptFieldName = "timestamp"
+
 func (s *SchemaCheckPass) applyRuntimeMappings(indexSchema schema.Schema, query *model.Query) (*model.Query, error) {
 
 	if query.RuntimeMappings == nil {
 		return query, nil
 	}
 
+	// Kibana and OpenSearch Dashboards scripts often refer to the timestamp as doc['timestamp'],
+	// so if there's no such field in the schema, we use the canonical timestamp field instead.
+	// TimestampFieldTransformation replaces it later with the actual timestamp column.
+	scriptVisitor := model.NewBaseVisitor()
+	scriptVisitor.OverrideVisitColumnRef = func(b *model.BaseExprVisitor, e model.ColumnRef) interface{} {
+		if _, ok := indexSchema.ResolveField(e.ColumnName); !ok && e.ColumnName == timestampScriptFieldName {
+			return model.NewColumnRef(model.TimestampFieldName)
+		}
+		return e
+	}
+	for name, mapping := range query.RuntimeMappings {
+		mapping.Expr = mapping.Expr.Accept(scriptVisitor).(model.Expr)
+		query.RuntimeMappings[name] = mapping
+	}
+
 	cols := query.SelectCommand.Columns
 
 	// replace column refs with runtime mappings with proper name
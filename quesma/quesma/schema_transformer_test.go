@@ -558,6 +558,39 @@ func Test_arrayType(t *testing.T) {
 				},
 			},
 		},
+
+		//SELECT "nested__products.name", "products.sku", count() FROM "kibana_sample_data_ecommerce" ARRAY JOIN "products.name" AS "nested__products.name" GROUP BY "nested__products.name", "products.sku"
+		//SELECT "nested__products.name", arrayJoin("products.sku"), count() FROM "kibana_sample_data_ecommerce" ARRAY JOIN "products.name" AS "nested__products.name" GROUP BY "nested__products.name", arrayJoin("products.sku")
+
+		{
+			name: "array join of nested objects",
+			query: &model.Query{
+				TableName: "kibana_sample_data_ecommerce",
+				SelectCommand: model.SelectCommand{
+					FromClause: model.NewArrayJoinExpr(model.NewTableRef("kibana_sample_data_ecommerce"),
+						[]model.AliasedExpr{model.NewAliasedExpr(model.NewColumnRef("products_name"), "nested__products.name")}),
+					Columns: []model.Expr{
+						model.NewLiteral(`"nested__products.name"`),
+						model.NewColumnRef("products_sku"),
+						model.NewCountFunc(),
+					},
+					GroupBy: []model.Expr{model.NewLiteral(`"nested__products.name"`), model.NewColumnRef("products_sku")},
+				},
+			},
+			expected: &model.Query{
+				TableName: "kibana_sample_data_ecommerce",
+				SelectCommand: model.SelectCommand{
+					FromClause: model.NewArrayJoinExpr(model.NewTableRef("kibana_sample_data_ecommerce"),
+						[]model.AliasedExpr{model.NewAliasedExpr(model.NewColumnRef("products_name"), "nested__products.name")}),
+					Columns: []model.Expr{
+						model.NewLiteral(`"nested__products.name"`),
+						model.NewFunction("arrayJoin", model.NewColumnRef("products_sku")),
+						model.NewCountFunc(),
+					},
+					GroupBy: []model.Expr{model.NewLiteral(`"nested__products.name"`), model.NewFunction("arrayJoin", model.NewColumnRef("products_sku"))},
+				},
+			},
+		},
 	}
 
 	asString := func(query *model.Query) string {
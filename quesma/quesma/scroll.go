@@ -0,0 +1,201 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"quesma/clickhouse"
+	"quesma/model"
+	"quesma/quesma/async_search_storage"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scroll (`scroll` parameter of search and `/_search/scroll`) is implemented with keyset pagination:
+// hits are sorted by the table's ordering key (after the requested sort, if any) and the document id,
+// and every page continues (search_after) from the sort values of the last hit of the previous one.
+// Keyset pagination needs a unique sort, otherwise hits with the same sort values as the last hit of a page
+// would be skipped. So if the table doesn't store document ids, pages are fetched with OFFSET instead,
+// with all (comparable) fields added to the sort, so that the order of hits is the same for every page.
+// Like point in time, the scroll only sees documents with timestamps up to the moment it was opened.
+
+const ScrollIdPrefix = "quesma_scroll_"
+
+var errScrollNotFound = errors.New("scroll not found")
+
+type scrollSearch struct {
+	id      string
+	context async_search_storage.ScrollContext
+}
+
+func (q *QueryRunner) handleScrollSearch(ctx context.Context, indexPattern string, body types.JSON, keepAlive string) ([]byte, error) {
+	duration, err := parseKeepAlive(keepAlive)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	scroll := &scrollSearch{
+		id: ScrollIdPrefix + uuid.Must(uuid.NewV7()).String(),
+		context: async_search_storage.ScrollContext{
+			IndexPattern: indexPattern,
+			Body:         body.Clone(),
+			OpenedAt:     now,
+			ExpiresAt:    now.Add(duration),
+		},
+	}
+	q.ScrollContexts.Store(scroll.id, scroll.context)
+	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageDefault, scroll)
+}
+
+// handleScroll returns the next page of the scroll, keepAlive (if not empty) extends its expiry
+func (q *QueryRunner) handleScroll(ctx context.Context, scrollId, keepAlive string) ([]byte, error) {
+	scrollContext, ok := q.ScrollContexts.Load(scrollId)
+	if !ok {
+		return nil, errScrollNotFound
+	}
+	if keepAlive != "" {
+		duration, err := parseKeepAlive(keepAlive)
+		if err != nil {
+			return nil, err
+		}
+		scrollContext.ExpiresAt = time.Now().Add(duration)
+		q.ScrollContexts.Store(scrollId, scrollContext)
+	}
+	scroll := &scrollSearch{id: scrollId, context: scrollContext}
+	return q.handleSearchCommon(ctx, scrollContext.IndexPattern, scrollContext.Body, nil, QueryLanguageDefault, scroll)
+}
+
+func (q *QueryRunner) handleClearScroll(scrollIds []string) ([]byte, error) {
+	freed := 0
+	for _, id := range scrollIds {
+		if q.ScrollContexts.Delete(id) {
+			freed++
+		}
+	}
+	return json.Marshal(map[string]any{"succeeded": true, "num_freed": freed})
+}
+
+// advanceScroll remembers the sort values of the last returned hit and the number of returned hits, the next page starts after it
+func (q *QueryRunner) advanceScroll(scrollId string, hits []model.SearchHit) {
+	if len(hits) == 0 {
+		return
+	}
+	scrollContext, ok := q.ScrollContexts.Load(scrollId)
+	if !ok {
+		return
+	}
+	scrollContext.SearchAfter = hits[len(hits)-1].Sort
+	scrollContext.From += len(hits)
+	q.ScrollContexts.Store(scrollId, scrollContext)
+}
+
+// scrollIdsOfRequest returns scroll ids from the path (comma separated) or the body (`"scroll_id"`, a string or an array)
+func scrollIdsOfRequest(pathScrollId string, body types.JSON) []string {
+	if pathScrollId != "" {
+		return strings.Split(pathScrollId, ",")
+	}
+	switch scrollId := body["scroll_id"].(type) {
+	case string:
+		return []string{scrollId}
+	case []any:
+		var ids []string
+		for _, id := range scrollId {
+			if id, ok := id.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// pagedQuery returns the search body of the current page
+func (s *scrollSearch) pagedQuery(body types.JSON, table *clickhouse.Table, currentSchema schema.Schema) (types.JSON, error) {
+	keyFields, unique := scrollKeyFields(table, currentSchema)
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("%w: scroll requires a table with an ordering key or a timestamp field", quesma_errors.ErrCouldNotParseRequest())
+	}
+
+	pit := pointInTime{openedAt: s.context.OpenedAt}
+	paged := pit.pinnedQuery(body, table, currentSchema).Clone()
+	paged["sort"] = scrollSort(body["sort"], keyFields)
+	delete(paged, "from")
+	switch {
+	case !unique:
+		paged["from"] = float64(s.context.From) // as if it was parsed from JSON
+	case s.context.SearchAfter != nil:
+		paged["search_after"] = s.context.SearchAfter
+	}
+	return paged, nil
+}
+
+// scrollKeyFields returns fields of the table's ordering key, which make the order of hits stable between pages,
+// followed by the document id, if the table stores it. Only then the order is unique (true is returned).
+// Otherwise, they're followed by all other comparable fields, so the order is still total: hits equal
+// on all of them are indistinguishable, so their order doesn't matter.
+func scrollKeyFields(table *clickhouse.Table, currentSchema schema.Schema) (fields []string, unique bool) {
+	for _, column := range table.SortingKey {
+		if field, ok := currentSchema.ResolveFieldByInternalName(column); ok {
+			fields = append(fields, field.PropertyName.AsString())
+		}
+	}
+	if len(fields) == 0 {
+		if timestampField, ok := timestampFieldOf(table, currentSchema); ok {
+			fields = append(fields, timestampField)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+	if field, ok := currentSchema.ResolveFieldByInternalName(model.DocumentIdFieldName); ok {
+		return append(fields, field.PropertyName.AsString()), true
+	}
+
+	var tiebreakers []string
+	for _, field := range currentSchema.Fields {
+		if field.Type.IsComparable() && !slices.Contains(fields, field.PropertyName.AsString()) {
+			tiebreakers = append(tiebreakers, field.PropertyName.AsString())
+		}
+	}
+	slices.Sort(tiebreakers)
+	return append(fields, tiebreakers...), false
+}
+
+// scrollSort returns the requested sort followed by key fields, which aren't already there
+func scrollSort(sort any, keyFields []string) []any {
+	var sorts []any
+	switch sort := sort.(type) {
+	case nil:
+	case []any:
+		sorts = append(sorts, sort...)
+	default:
+		sorts = append(sorts, sort)
+	}
+
+	sorted := make(map[string]bool)
+	for i, s := range sorts {
+		switch s := s.(type) {
+		case string:
+			sorts[i] = map[string]any{s: "asc"}
+			sorted[s] = true
+		case map[string]any:
+			for field := range s {
+				sorted[field] = true
+			}
+		}
+	}
+	for _, field := range keyFields {
+		if !sorted[field] {
+			sorts = append(sorts, map[string]any{field: "asc"})
+		}
+	}
+	return sorts
+}
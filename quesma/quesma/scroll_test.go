@@ -0,0 +1,111 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/clickhouse"
+	"quesma/model"
+	"quesma/quesma/async_search_storage"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"quesma/schema"
+	"testing"
+	"time"
+)
+
+func TestScroll(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	columns := []string{"@timestamp", "count", "message"}
+	first, second := time.UnixMilli(1706745600000).UTC(), time.UnixMilli(1706745660000).UTC()
+
+	openedAt := time.UnixMilli(1706832000000)
+	boundary := openedAt.UnixMilli()
+	scrollId := ScrollIdPrefix + "test"
+	queryRunner.ScrollContexts.Store(scrollId, async_search_storage.ScrollContext{
+		IndexPattern: "logs",
+		Body:         types.MustJSON(`{"size": 2, "track_total_hits": false}`),
+		OpenedAt:     openedAt,
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+
+	mock.ExpectQuery(fmt.Sprintf(`SELECT "@timestamp", "count", "message" FROM logs WHERE "@timestamp"<=fromUnixTimestamp64Milli(%d) `+
+		`ORDER BY "@timestamp" ASC, "message" ASC, "count" ASC LIMIT 2`, boundary)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(first, 1, "a").AddRow(second, 2, "b"))
+
+	response, err := queryRunner.handleScroll(ctx, scrollId, "")
+	require.NoError(t, err)
+
+	var page model.SearchResp
+	require.NoError(t, json.Unmarshal(response, &page))
+	require.NotNil(t, page.ScrollID)
+	assert.Equal(t, scrollId, *page.ScrollID)
+	assert.Len(t, page.Hits.Hits, 2)
+
+	// there are no document ids in the table, so the sort isn't unique and the next page is fetched with OFFSET,
+	// all fields are in the sort to make the order total
+	mock.ExpectQuery(fmt.Sprintf(`SELECT "@timestamp", "count", "message" FROM logs WHERE "@timestamp"<=fromUnixTimestamp64Milli(%d) `+
+		`ORDER BY "@timestamp" ASC, "message" ASC, "count" ASC LIMIT 2 OFFSET 2`, boundary)).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	response, err = queryRunner.handleScroll(ctx, scrollId, "5m")
+	require.NoError(t, err)
+	page = model.SearchResp{}
+	require.NoError(t, json.Unmarshal(response, &page))
+	assert.Equal(t, scrollId, *page.ScrollID)
+	assert.Empty(t, page.Hits.Hits)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	response, err = queryRunner.handleClearScroll([]string{scrollId, ScrollIdPrefix + "unknown"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"succeeded": true, "num_freed": 1}`, string(response))
+
+	_, err = queryRunner.handleScroll(ctx, scrollId, "")
+	assert.ErrorIs(t, err, errScrollNotFound)
+
+	_, err = queryRunner.handleScrollSearch(ctx, "logs", types.MustJSON(`{}`), "never")
+	assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+}
+
+func TestScrollPagedQuery(t *testing.T) {
+	table := &clickhouse.Table{Name: "logs", SortingKey: []string{"@timestamp"}}
+	currentSchema := schema.Schema{Fields: map[schema.FieldName]schema.Field{
+		"@timestamp": {PropertyName: "@timestamp", InternalPropertyName: "@timestamp", Type: schema.QuesmaTypeDate},
+		"_id":        {PropertyName: "_id", InternalPropertyName: "_id", Type: schema.QuesmaTypeKeyword},
+		"message":    {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+		"host":       {PropertyName: "host", InternalPropertyName: "host", Type: schema.QuesmaTypeObject},
+	}}
+	scroll := &scrollSearch{context: async_search_storage.ScrollContext{
+		OpenedAt:    time.UnixMilli(1706832000000),
+		SearchAfter: []any{float64(1706745660000), "a1"},
+		From:        2,
+	}}
+
+	// document ids make the sort unique, so the next page starts after the last hit
+	paged, err := scroll.pagedQuery(types.MustJSON(`{"size": 2, "from": 10}`), table, currentSchema)
+	require.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"@timestamp": "asc"}, map[string]any{"_id": "asc"}}, paged["sort"])
+	assert.Equal(t, []any{float64(1706745660000), "a1"}, paged["search_after"])
+	assert.NotContains(t, paged, "from")
+
+	// without them, hits are sorted by all comparable fields
+	delete(currentSchema.Fields, "_id")
+	paged, err = scroll.pagedQuery(types.MustJSON(`{"size": 2, "from": 10}`), table, currentSchema)
+	require.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"@timestamp": "asc"}, map[string]any{"message": "asc"}}, paged["sort"])
+	assert.Equal(t, float64(2), paged["from"])
+	assert.NotContains(t, paged, "search_after")
+}
+
+func TestScrollSort(t *testing.T) {
+	keyFields := []string{"@timestamp", "message"}
+	assert.Equal(t, []any{map[string]any{"@timestamp": "asc"}, map[string]any{"message": "asc"}}, scrollSort(nil, keyFields))
+	assert.Equal(t, []any{map[string]any{"_doc": "asc"}, map[string]any{"@timestamp": "asc"}, map[string]any{"message": "asc"}},
+		scrollSort([]any{"_doc"}, keyFields))
+	assert.Equal(t, []any{map[string]any{"message": "desc"}, map[string]any{"@timestamp": "asc"}},
+		scrollSort(map[string]any{"message": "desc"}, keyFields))
+}
@@ -43,6 +43,10 @@ type QueryRunner struct {
 	cancel                  context.CancelFunc
 	AsyncRequestStorage     async_search_storage.AsyncRequestResultStorage
 	AsyncQueriesContexts    async_search_storage.AsyncQueryContextStorage
+	ScrollContexts          async_search_storage.ScrollContextStorage
+	byQueryTasks            *byQueryTasks
+	pointsInTime            *pointsInTime
+	sqlCursors              *sqlCursors
 	logManager              *clickhouse.LogManager
 	cfg                     *config.QuesmaConfiguration
 	im                      elasticsearch.IndexManagement
@@ -75,10 +79,27 @@ func NewQueryRunner(lm *clickhouse.LogManager,
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	var asyncRequestStorage async_search_storage.AsyncRequestResultStorage
+	var scrollContexts async_search_storage.ScrollContextStorage
+	var pointsInTimeStorage async_search_storage.PointInTimeStorage
+	if cfg.AsyncSearchStorage == config.AsyncSearchStorageElasticsearch {
+		asyncRequestStorage = async_search_storage.NewAsyncSearchStorageInElastic(cfg.Elasticsearch, async_search_storage.AsyncSearchElasticIndexName)
+		scrollContexts = async_search_storage.NewScrollContextStorageInElastic(cfg.Elasticsearch, async_search_storage.ScrollContextElasticIndexName)
+		pointsInTimeStorage = async_search_storage.NewPointInTimeStorageInElastic(cfg.Elasticsearch, async_search_storage.PointInTimeElasticIndexName)
+	} else {
+		asyncRequestStorage = async_search_storage.NewAsyncSearchStorageInMemory()
+		scrollContexts = async_search_storage.NewScrollContextStorageInMemory()
+		pointsInTimeStorage = async_search_storage.NewPointInTimeStorageInMemory()
+	}
+
 	return &QueryRunner{logManager: lm, cfg: cfg, im: im, quesmaManagementConsole: qmc,
 		executionCtx: ctx, cancel: cancel,
-		AsyncRequestStorage:  async_search_storage.NewAsyncSearchStorageInMemory(),
+		AsyncRequestStorage:  asyncRequestStorage,
 		AsyncQueriesContexts: async_search_storage.NewAsyncQueryContextStorageInMemory(),
+		ScrollContexts:       scrollContexts,
+		byQueryTasks:         newByQueryTasks(),
+		pointsInTime:         newPointsInTime(pointsInTimeStorage),
+		sqlCursors:           newSQLCursors(),
 		transformationPipeline: TransformationPipeline{
 			transformers: []model.QueryTransformer{
 				&SchemaCheckPass{cfg: cfg},
@@ -115,11 +136,11 @@ func (q *QueryRunner) handleCount(ctx context.Context, indexPattern string) (int
 }
 
 func (q *QueryRunner) handleSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error) {
-	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageDefault)
+	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageDefault, nil)
 }
 
 func (q *QueryRunner) handleEQLSearch(ctx context.Context, indexPattern string, body types.JSON) ([]byte, error) {
-	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageEQL)
+	return q.handleSearchCommon(ctx, indexPattern, body, nil, QueryLanguageEQL, nil)
 }
 
 func (q *QueryRunner) handleAsyncSearch(ctx context.Context, indexPattern string, body types.JSON,
@@ -132,7 +153,7 @@ func (q *QueryRunner) handleAsyncSearch(ctx context.Context, indexPattern string
 	}
 	ctx = context.WithValue(ctx, tracing.AsyncIdCtxKey, async.asyncId)
 	logger.InfoWithCtx(ctx).Msgf("async search request id: %s started", async.asyncId)
-	return q.handleSearchCommon(ctx, indexPattern, body, &async, QueryLanguageDefault)
+	return q.handleSearchCommon(ctx, indexPattern, body, &async, QueryLanguageDefault, nil)
 }
 
 type asyncSearchWithError struct {
@@ -198,6 +219,13 @@ func (q *QueryRunner) runExecutePlanAsync(ctx context.Context, plan *model.Execu
 		}
 
 		searchResponse := queryTranslator.MakeSearchResponse(plan.Queries, results)
+		if plan.PointInTimeId != "" {
+			searchResponse.PitID = &plan.PointInTimeId
+		}
+		if plan.ScrollId != "" {
+			searchResponse.ScrollID = &plan.ScrollId
+			q.advanceScroll(plan.ScrollId, searchResponse.Hits.Hits)
+		}
 
 		doneCh <- asyncSearchWithError{response: searchResponse, translatedQueryBody: translatedQueryBody, err: err}
 	}()
@@ -269,7 +297,15 @@ func (q *QueryRunner) executePlan(ctx context.Context, plan *model.ExecutionPlan
 	}
 }
 
-func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern string, body types.JSON, optAsync *AsyncQuery, queryLanguage QueryLanguage) ([]byte, error) {
+func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern string, body types.JSON, optAsync *AsyncQuery, queryLanguage QueryLanguage, optScroll *scrollSearch) ([]byte, error) {
+
+	pit, err := q.pointInTimeOfSearch(body)
+	if err != nil {
+		return nil, err
+	}
+	if pit != nil {
+		indexPattern = pit.indexPattern
+	}
 
 	decision := q.tableResolver.Resolve(table_resolver.QueryPipeline, indexPattern)
 
@@ -332,17 +368,104 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		}
 	}
 
-	tables, err := q.logManager.GetTableDefinitions()
+	table, currentSchema, resolvedIndexes, err := q.resolveTableAndSchema(clickhouseConnector.ClickhouseTables)
 	if err != nil {
-		return nil, err
+		return []byte{}, err
 	}
 
-	var table *clickhouse.Table // TODO we should use schema here only
-	var currentSchema schema.Schema
-	resolvedIndexes := clickhouseConnector.ClickhouseTables
+	if len(resolvedIndexes) == 0 {
+		if optAsync != nil {
+			return queryparser.EmptyAsyncSearchResponse(optAsync.asyncId, false, 200)
+		} else {
+			return queryparser.EmptySearchResponse(ctx), nil
+		}
+	}
+
+	if pit != nil {
+		body = pit.pinnedQuery(body, table, currentSchema)
+	}
+	if optScroll != nil {
+		if body, err = optScroll.pagedQuery(body, table, currentSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	queryTranslator := NewQueryTranslator(ctx, queryLanguage, currentSchema, table, q.logManager, q.DateMathRenderer, resolvedIndexes, q.cfg)
+
+	plan, err := queryTranslator.ParseQuery(body)
+
+	if err != nil {
+		logger.ErrorWithCtx(ctx).Msgf("parsing error: %v", err)
+		queries := plan.Queries
+		queriesBody := make([]types.TranslatedSQLQuery, len(queries))
+		queriesBodyConcat := ""
+		for i, query := range queries {
+			queriesBody[i].Query = []byte(query.SelectCommand.String())
+			queriesBodyConcat += query.SelectCommand.String() + "\n"
+		}
+		responseBody = []byte(fmt.Sprintf("Invalid Queries: %v, err: %v", queriesBody, err))
+		logger.ErrorWithCtxAndReason(ctx, "Quesma generated invalid SQL query").Msg(queriesBodyConcat)
+		bodyAsBytes, _ := body.Bytes()
+		pushSecondaryInfo(q.quesmaManagementConsole, id, "", path, bodyAsBytes, queriesBody, responseBody, startTime)
+		return responseBody, fmt.Errorf("Invalid Queries: %v, err: %w", queriesBody, err)
+	}
+
+	plan.IndexPattern = indexPattern
+	plan.StartTime = startTime
+	if pit != nil {
+		plan.PointInTimeId = pit.id
+	}
+	if optScroll != nil {
+		plan.ScrollId = optScroll.id
+	}
+	plan.Name = model.MainExecutionPlan
+
+	if decision.EnableABTesting {
+		return q.executeABTesting(ctx, plan, queryTranslator, table, body, optAsync, decision, indexPattern)
+	}
+
+	return q.executePlan(ctx, plan, queryTranslator, table, body, optAsync, nil, true)
+
+}
+
+// resolveClickhouseIndex resolves the index pattern of a request, which isn't a search, to a ClickHouse table.
+// No indexes (and no error) are returned, if the pattern doesn't match any index.
+func (q *QueryRunner) resolveClickhouseIndex(indexPattern string) (table *clickhouse.Table, currentSchema schema.Schema, indexes []string, err error) {
+	decision := q.tableResolver.Resolve(table_resolver.QueryPipeline, indexPattern)
+	if decision.Err != nil {
+		return nil, schema.Schema{}, nil, decision.Err
+	}
+	if decision.IsEmpty {
+		return nil, schema.Schema{}, nil, nil
+	}
+	if decision.IsClosed {
+		return nil, schema.Schema{}, nil, quesma_errors.ErrIndexNotExists()
+	}
+
+	var clickhouseConnector *table_resolver.ConnectorDecisionClickhouse
+	for _, connector := range decision.UseConnectors {
+		if c, ok := connector.(*table_resolver.ConnectorDecisionClickhouse); ok {
+			clickhouseConnector = c
+		}
+	}
+	if clickhouseConnector == nil {
+		return nil, schema.Schema{}, nil, fmt.Errorf("no clickhouse connector")
+	}
+	return q.resolveTableAndSchema(clickhouseConnector.ClickhouseTables)
+}
+
+// resolveTableAndSchema returns the table to query and its schema for the indexes resolved to ClickHouse.
+// Multiple indexes are only supported in the common table, the returned indexes are the ones stored there.
+// No indexes (and no error) are returned, if none of them is stored in the common table.
+func (q *QueryRunner) resolveTableAndSchema(resolvedIndexes []string) (table *clickhouse.Table, currentSchema schema.Schema, indexes []string, err error) {
+
+	tables, err := q.logManager.GetTableDefinitions()
+	if err != nil {
+		return nil, schema.Schema{}, nil, err
+	}
 
 	if len(resolvedIndexes) == 1 {
-		indexName := resolvedIndexes[0] // we got exactly one table here because of the check above
+		indexName := resolvedIndexes[0]
 		resolvedTableName := indexName
 
 		if len(q.cfg.IndexConfig[indexName].Override) > 0 {
@@ -351,12 +474,12 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 
 		resolvedSchema, ok := q.schemaRegistry.FindSchema(schema.TableName(indexName))
 		if !ok {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", resolvedTableName)).Details("Table: %s", resolvedTableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", resolvedTableName)).Details("Table: %s", resolvedTableName)
 		}
 
 		table, _ = tables.Load(resolvedTableName)
 		if table == nil {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", resolvedTableName)).Details("Table: %s", resolvedTableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", resolvedTableName)).Details("Table: %s", resolvedTableName)
 		}
 
 		currentSchema = resolvedSchema
@@ -373,7 +496,7 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 
 			table, _ = tables.Load(tableName)
 			if table == nil {
-				return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", indexName)).Details("Table: %s", indexName)
+				return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", indexName)).Details("Table: %s", indexName)
 			}
 			if table.VirtualTable {
 				virtualOnlyTables = append(virtualOnlyTables, indexName)
@@ -382,16 +505,12 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		resolvedIndexes = virtualOnlyTables
 
 		if len(resolvedIndexes) == 0 {
-			if optAsync != nil {
-				return queryparser.EmptyAsyncSearchResponse(optAsync.asyncId, false, 200)
-			} else {
-				return queryparser.EmptySearchResponse(ctx), nil
-			}
+			return nil, schema.Schema{}, nil, nil
 		}
 
 		commonTable, ok := tables.Load(common_table.TableName)
 		if !ok {
-			return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", common_table.TableName)).Details("Table: %s", common_table.TableName)
+			return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s table", common_table.TableName)).Details("Table: %s", common_table.TableName)
 		}
 
 		// Let's build a  union of schemas
@@ -405,7 +524,7 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		for _, idx := range resolvedIndexes {
 			scm, ok := q.schemaRegistry.FindSchema(schema.TableName(idx))
 			if !ok {
-				return []byte{}, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", idx)).Details("Table: %s", idx)
+				return nil, schema.Schema{}, nil, end_user_errors.ErrNoSuchTable.New(fmt.Errorf("can't load %s schema", idx)).Details("Table: %s", idx)
 			}
 
 			for fieldName := range scm.Fields {
@@ -417,37 +536,7 @@ func (q *QueryRunner) handleSearchCommon(ctx context.Context, indexPattern strin
 		currentSchema = resolvedSchema
 		table = commonTable
 	}
-
-	queryTranslator := NewQueryTranslator(ctx, queryLanguage, currentSchema, table, q.logManager, q.DateMathRenderer, resolvedIndexes, q.cfg)
-
-	plan, err := queryTranslator.ParseQuery(body)
-
-	if err != nil {
-		logger.ErrorWithCtx(ctx).Msgf("parsing error: %v", err)
-		queries := plan.Queries
-		queriesBody := make([]types.TranslatedSQLQuery, len(queries))
-		queriesBodyConcat := ""
-		for i, query := range queries {
-			queriesBody[i].Query = []byte(query.SelectCommand.String())
-			queriesBodyConcat += query.SelectCommand.String() + "\n"
-		}
-		responseBody = []byte(fmt.Sprintf("Invalid Queries: %v, err: %v", queriesBody, err))
-		logger.ErrorWithCtxAndReason(ctx, "Quesma generated invalid SQL query").Msg(queriesBodyConcat)
-		bodyAsBytes, _ := body.Bytes()
-		pushSecondaryInfo(q.quesmaManagementConsole, id, "", path, bodyAsBytes, queriesBody, responseBody, startTime)
-		return responseBody, errors.New(string(responseBody))
-	}
-
-	plan.IndexPattern = indexPattern
-	plan.StartTime = startTime
-	plan.Name = model.MainExecutionPlan
-
-	if decision.EnableABTesting {
-		return q.executeABTesting(ctx, plan, queryTranslator, table, body, optAsync, decision, indexPattern)
-	}
-
-	return q.executePlan(ctx, plan, queryTranslator, table, body, optAsync, nil, true)
-
+	return table, currentSchema, resolvedIndexes, nil
 }
 
 func (q *QueryRunner) storeAsyncSearch(qmc *ui.QuesmaManagementConsole, id, asyncId string,
@@ -490,15 +579,6 @@ func (q *QueryRunner) storeAsyncSearch(qmc *ui.QuesmaManagementConsole, id, asyn
 	return
 }
 
-func (q *QueryRunner) asyncQueriesCumulatedBodySize() int {
-	size := 0
-	q.AsyncRequestStorage.Range(func(key string, value *async_search_storage.AsyncRequestResult) bool {
-		size += len(value.GetResponseBody())
-		return true
-	})
-	return size
-}
-
 func (q *QueryRunner) handlePartialAsyncSearch(ctx context.Context, id string) ([]byte, error) {
 	if !strings.Contains(id, tracing.AsyncIdPrefix) {
 		logger.ErrorWithCtx(ctx).Msgf("non quesma async id: %v", id)
@@ -543,7 +623,7 @@ func (q *QueryRunner) deleteAsyncSearch(id string) ([]byte, error) {
 }
 
 func (q *QueryRunner) reachedQueriesLimit(ctx context.Context, asyncId string, doneCh chan<- asyncSearchWithError) bool {
-	if q.AsyncRequestStorage.Size() < asyncQueriesLimit && q.asyncQueriesCumulatedBodySize() < asyncQueriesLimitBytes {
+	if q.AsyncRequestStorage.Size() < asyncQueriesLimit && q.AsyncRequestStorage.SpaceInUse() < asyncQueriesLimitBytes {
 		return false
 	}
 	err := errors.New("too many async queries")
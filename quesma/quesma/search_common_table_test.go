@@ -150,7 +150,7 @@ func TestSearchCommonTable(t *testing.T) {
         }
 }`,
 			WantedSql: []string{
-				`SELECT countIf("@timestamp"<toInt64(toUnixTimestamp(now()))) AS "range_0__aggr__2__count", countIf(("@timestamp">=toInt64(toUnixTimestamp(toStartOfDay(subDate(now(), INTERVAL 3 week)))) AND "@timestamp"<toInt64(toUnixTimestamp(now())))) AS "range_1__aggr__2__count", countIf("@timestamp">=toInt64(toUnixTimestamp('2024-04-14'))) AS "range_2__aggr__2__count" FROM quesma_common_table WHERE ("__quesma_index_name"='logs-1' OR "__quesma_index_name"='logs-2') -- optimizations: pancake(half)`,
+				`SELECT countIf("@timestamp"<toInt64(toUnixTimestamp(now('Europe/Warsaw')))) AS "range_0__aggr__2__count", countIf(("@timestamp">=toInt64(toUnixTimestamp(toStartOfDay(subDate(now('Europe/Warsaw'), INTERVAL 3 week), 'Europe/Warsaw'))) AND "@timestamp"<toInt64(toUnixTimestamp(now('Europe/Warsaw'))))) AS "range_1__aggr__2__count", countIf("@timestamp">=toInt64(toUnixTimestamp(toDateTime64('2024-04-14 00:00:00.000',3,'Europe/Warsaw')))) AS "range_2__aggr__2__count" FROM quesma_common_table WHERE ("__quesma_index_name"='logs-1' OR "__quesma_index_name"='logs-2') -- optimizations: pancake(half)`,
 				`SELECT "@timestamp", "message", "__quesma_index_name" FROM quesma_common_table WHERE ("__quesma_index_name"='logs-1' OR "__quesma_index_name"='logs-2') LIMIT 10`,
 			},
 			// we need to return some rows, otherwise pancakes will fail
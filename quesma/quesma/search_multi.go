@@ -0,0 +1,141 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"quesma/end_user_errors"
+	"quesma/logger"
+	"quesma/queryparser"
+	"quesma/quesma/errors"
+	"quesma/quesma/recovery"
+	"quesma/quesma/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+// multiSearchItem is a single header/body pair of the _msearch request
+type multiSearchItem struct {
+	indexPattern string
+	body         types.JSON
+}
+
+// parseMultiSearchItems splits the _msearch NDJSON body into header/body pairs.
+// The index from the header takes precedence over the one from the path (defaultIndexPattern).
+func parseMultiSearchItems(defaultIndexPattern string, body types.NDJSON) ([]multiSearchItem, error) {
+	if len(body)%2 != 0 {
+		return nil, fmt.Errorf("%w: _msearch body must consist of header and body pairs, got %d lines", quesma_errors.ErrCouldNotParseRequest(), len(body))
+	}
+
+	items := make([]multiSearchItem, 0, len(body)/2)
+	for i := 0; i+1 < len(body); i += 2 {
+		header, searchBody := body[i], body[i+1]
+
+		indexPattern := defaultIndexPattern
+		switch index := header["index"].(type) {
+		case nil:
+		case string:
+			indexPattern = index
+		case []any:
+			indexes := make([]string, 0, len(index))
+			for _, idx := range index {
+				if idxAsString, ok := idx.(string); ok {
+					indexes = append(indexes, idxAsString)
+				} else {
+					return nil, fmt.Errorf("%w: invalid index %v in _msearch header %d", quesma_errors.ErrCouldNotParseRequest(), idx, i/2)
+				}
+			}
+			indexPattern = strings.Join(indexes, ",")
+		default:
+			return nil, fmt.Errorf("%w: invalid index %v in _msearch header %d", quesma_errors.ErrCouldNotParseRequest(), index, i/2)
+		}
+
+		items = append(items, multiSearchItem{indexPattern: indexPattern, body: searchBody})
+	}
+	return items, nil
+}
+
+func (q *QueryRunner) handleMultiSearch(ctx context.Context, defaultIndexPattern string, body types.NDJSON) ([]byte, error) {
+	startTime := time.Now()
+
+	items, err := parseMultiSearchItems(defaultIndexPattern, body)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]types.JSON, len(items))
+
+	// searches are independent, so we run them in parallel unless parallelism is disabled (e.g. in tests)
+	if q.maxParallelQueries == 0 || len(items) == 1 {
+		for i, item := range items {
+			responses[i] = q.multiSearchItemResponse(ctx, item)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, item := range items {
+			wg.Add(1)
+			go func(i int, item multiSearchItem) {
+				defer wg.Done()
+				defer recovery.LogAndHandlePanic(ctx, func(err error) {
+					responses[i] = multiSearchErrorResponse(ctx, item, err)
+				})
+				responses[i] = q.multiSearchItemResponse(ctx, item)
+			}(i, item)
+		}
+		wg.Wait()
+	}
+
+	response := types.JSON{
+		"took":      time.Since(startTime).Milliseconds(),
+		"responses": responses,
+	}
+	return response.Bytes()
+}
+
+func (q *QueryRunner) multiSearchItemResponse(ctx context.Context, item multiSearchItem) types.JSON {
+	if item.indexPattern == "" {
+		return multiSearchErrorResponse(ctx, item, fmt.Errorf("%w: no index specified in _msearch header", quesma_errors.ErrCouldNotParseRequest()))
+	}
+
+	responseBody, err := q.handleSearch(ctx, item.indexPattern, item.body)
+	if err != nil {
+		return multiSearchErrorResponse(ctx, item, err)
+	}
+
+	response, err := types.ParseJSON(string(responseBody))
+	if err != nil {
+		return multiSearchErrorResponse(ctx, item, err)
+	}
+	response["status"] = http.StatusOK
+	return response
+}
+
+// multiSearchErrorResponse renders an error of a single search, so it doesn't fail the whole _msearch request
+func multiSearchErrorResponse(ctx context.Context, item multiSearchItem, err error) types.JSON {
+	var body []byte
+
+	var endUserError *end_user_errors.EndUserError
+	switch {
+	case errors.Is(err, quesma_errors.ErrIndexNotExists()):
+		body = queryparser.IndexNotFoundError(item.indexPattern)
+	case errors.Is(err, quesma_errors.ErrCouldNotParseRequest()):
+		body = queryparser.BadRequestParseError(err)
+	case errors.As(err, &endUserError):
+		logger.ErrorWithCtxAndReason(ctx, endUserError.Reason()).Msgf("_msearch item for %s failed: %v", item.indexPattern, err)
+		body = queryparser.InternalQuesmaError(endUserError.EndUserErrorMessage())
+	default:
+		// We should not send our error message to the client, as there can be sensitive information in it.
+		logger.ErrorWithCtx(ctx).Msgf("_msearch item for %s failed: %v", item.indexPattern, err)
+		body = queryparser.InternalQuesmaError("Internal Quesma Error")
+	}
+
+	response, parseErr := types.ParseJSON(string(body))
+	if parseErr != nil {
+		return types.JSON{"status": http.StatusInternalServerError}
+	}
+	return response
+}
@@ -0,0 +1,120 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/ab_testing"
+	"quesma/clickhouse"
+	"quesma/logger"
+	"quesma/model"
+	"quesma/quesma/types"
+	"quesma/quesma/ui"
+	"quesma/schema"
+	"quesma/table_resolver"
+	"quesma/telemetry"
+	"quesma/util"
+	"testing"
+)
+
+func TestParseMultiSearchItems(t *testing.T) {
+	body, err := types.ParseNDJSON(`{"index":"logs"}
+{"query":{"match_all":{}}}
+{}
+{"size":1}
+{"index":["logs-1","logs-2"]}
+{}`)
+	require.NoError(t, err)
+
+	items, err := parseMultiSearchItems("default", body)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	assert.Equal(t, "logs", items[0].indexPattern)
+	assert.Equal(t, types.MustJSON(`{"query":{"match_all":{}}}`), items[0].body)
+	assert.Equal(t, "default", items[1].indexPattern)
+	assert.Equal(t, "logs-1,logs-2", items[2].indexPattern)
+}
+
+func TestParseMultiSearchItemsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing body", `{"index":"logs"}`},
+		{"invalid index", `{"index":5}
+{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := types.ParseNDJSON(tt.body)
+			require.NoError(t, err)
+
+			_, err = parseMultiSearchItems("", body)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMultiSearchHandler(t *testing.T) {
+	fields := map[schema.FieldName]schema.Field{
+		"message": {PropertyName: "message", InternalPropertyName: "message", Type: schema.QuesmaTypeText},
+	}
+	s := &schema.StaticRegistry{
+		Tables: map[schema.TableName]schema.Schema{
+			model.SingleTableNamePlaceHolder: schema.NewSchemaWithAliases(fields, map[schema.FieldName]schema.FieldName{}, true, ""),
+		},
+	}
+
+	db, mock := util.InitSqlMockWithPrettyPrint(t, false)
+	defer db.Close()
+
+	lm := clickhouse.NewLogManagerWithConnection(db, table)
+	resolver := table_resolver.NewEmptyTableResolver()
+	resolver.Decisions[tableName] = &table_resolver.Decision{
+		UseConnectors: []table_resolver.ConnectorDecision{
+			&table_resolver.ConnectorDecisionClickhouse{
+				ClickhouseTableName: tableName,
+				ClickhouseTables:    []string{tableName},
+			},
+		},
+	}
+	resolver.Decisions["closed"] = &table_resolver.Decision{IsClosed: true}
+	managementConsole := ui.NewQuesmaManagementConsole(&DefaultConfig, nil, nil, make(<-chan logger.LogWithLevel, 50000), telemetry.NewPhoneHomeEmptyAgent(), nil, resolver)
+
+	mock.ExpectQuery(`SELECT "message" FROM ` + tableName).WillReturnRows(sqlmock.NewRows([]string{"message"}).AddRow("hello"))
+
+	body, err := types.ParseNDJSON(`{}
+{"size":1,"track_total_hits":false,"_source":["message"]}
+{"index":"closed"}
+{"size":1}
+{}`)
+	require.NoError(t, err)
+
+	queryRunner := NewQueryRunner(lm, &DefaultConfig, nil, managementConsole, s, ab_testing.NewEmptySender(), resolver)
+	queryRunner.maxParallelQueries = 0
+	_, err = queryRunner.handleMultiSearch(ctx, tableName, body)
+	assert.Error(t, err, "odd number of lines should be rejected")
+
+	body = body[:4]
+	responseBody, err := queryRunner.handleMultiSearch(ctx, tableName, body)
+	require.NoError(t, err)
+
+	response := types.MustJSON(string(responseBody))
+	responses := response["responses"].([]any)
+	require.Len(t, responses, 2)
+
+	first := responses[0].(map[string]any)
+	assert.Equal(t, 200.0, first["status"])
+	assert.Contains(t, first, "hits")
+
+	second := responses[1].(map[string]any)
+	assert.Equal(t, 404.0, second["status"])
+	assert.Equal(t, "index_not_found_exception", second["error"].(map[string]any)["type"])
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("there were unfulfilled expections:", err)
+	}
+}
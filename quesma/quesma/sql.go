@@ -0,0 +1,368 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"quesma/clickhouse"
+	"quesma/concurrent"
+	"quesma/model"
+	"quesma/queryparser/essql"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"strings"
+	"time"
+)
+
+// Elasticsearch SQL (`/_sql`) queries are parsed by the essql package and translated to a SELECT
+// on the index's table, which goes through the transformation pipeline like any search.
+// Results are returned in pages of fetch_size rows. If there are more rows, the response has
+// a cursor, which keeps the translated query and the offset of the next page.
+
+const SQLCursorPrefix = "quesma_sql_"
+
+const (
+	sqlDefaultFetchSize   = 1000
+	sqlDefaultPageTimeout = 45 * time.Second
+	sqlDateTimeFormat     = "2006-01-02T15:04:05.000Z"
+)
+
+var errSQLCursorNotFound = errors.New("sql cursor not found")
+
+type sqlResponse struct {
+	Columns []essql.Column `json:"columns,omitempty"` // only in the first page
+	Rows    [][]any        `json:"rows"`
+	Cursor  string         `json:"cursor,omitempty"`
+}
+
+type sqlCursor struct {
+	id          string
+	table       *clickhouse.Table
+	query       *model.Query // already transformed
+	columns     []essql.Column
+	fetchSize   int
+	offset      int // of the next page
+	remaining   int // rows left until the statement's LIMIT, essql.NoLimit if there is none
+	pageTimeout time.Duration
+	expiresAt   time.Time
+}
+
+type sqlCursors struct {
+	cursors *concurrent.Map[string, sqlCursor]
+}
+
+func newSQLCursors() *sqlCursors {
+	return &sqlCursors{cursors: concurrent.NewMap[string, sqlCursor]()}
+}
+
+func (c *sqlCursors) store(cursor sqlCursor) {
+	c.evict()
+	cursor.expiresAt = time.Now().Add(cursor.pageTimeout)
+	c.cursors.Store(cursor.id, cursor)
+}
+
+func (c *sqlCursors) load(id string) (sqlCursor, error) {
+	cursor, ok := c.cursors.Load(id)
+	if !ok || time.Now().After(cursor.expiresAt) {
+		return sqlCursor{}, errSQLCursorNotFound
+	}
+	return cursor, nil
+}
+
+func (c *sqlCursors) close(id string) bool {
+	_, ok := c.cursors.LoadAndDelete(id)
+	return ok
+}
+
+func (c *sqlCursors) evict() {
+	now := time.Now()
+	for id, cursor := range c.cursors.Snapshot() {
+		if now.After(cursor.expiresAt) {
+			c.cursors.Delete(id)
+		}
+	}
+}
+
+// sqlIndexOfRequest returns the index the SQL request queries, "" if it's not a query (e.g. it's a cursor)
+func sqlIndexOfRequest(body types.JSON) (string, error) {
+	query, _ := body["query"].(string)
+	if query == "" {
+		return "", nil
+	}
+	params, _ := body["params"].([]any)
+	stmt, err := essql.Parse(query, params)
+	if err != nil {
+		return "", err
+	}
+	return stmt.Index(), nil
+}
+
+// handleSQL runs the query (or returns the next page of the cursor) and returns the response in the given format
+func (q *QueryRunner) handleSQL(ctx context.Context, body types.JSON, format string) (response []byte, contentType string, err error) {
+	switch format {
+	case "", "json", "txt", "csv", "tsv":
+	default:
+		return nil, "", fmt.Errorf("%w: invalid format %s, expected json, txt, csv or tsv", quesma_errors.ErrCouldNotParseRequest(), format)
+	}
+
+	var page *sqlResponse
+	if cursorId, ok := body["cursor"].(string); ok && cursorId != "" {
+		cursor, err := q.sqlCursors.load(cursorId)
+		if err != nil {
+			return nil, "", err
+		}
+		if page, err = q.sqlPage(ctx, cursor); err != nil {
+			return nil, "", err
+		}
+		page.Columns = nil
+	} else {
+		cursor, err := q.prepareSQL(body)
+		if err != nil {
+			return nil, "", err
+		}
+		if page, err = q.sqlPage(ctx, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	return formatSQLResponse(page, format)
+}
+
+// handleSQLTranslate returns the ClickHouse query the request is translated to
+func (q *QueryRunner) handleSQLTranslate(body types.JSON) ([]byte, error) {
+	cursor, err := q.prepareSQL(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{"sql": model.AsString(cursor.query.SelectCommand)})
+}
+
+func (q *QueryRunner) handleSQLClose(body types.JSON) ([]byte, error) {
+	id, _ := body["cursor"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("%w: cursor is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	return json.Marshal(map[string]any{"succeeded": q.sqlCursors.close(id)})
+}
+
+// prepareSQL parses and translates the request, the returned cursor is positioned at the first page
+func (q *QueryRunner) prepareSQL(body types.JSON) (sqlCursor, error) {
+	query, _ := body["query"].(string)
+	if query == "" {
+		return sqlCursor{}, fmt.Errorf("%w: query is required", quesma_errors.ErrCouldNotParseRequest())
+	}
+	if _, ok := body["filter"]; ok {
+		return sqlCursor{}, fmt.Errorf("%w: filter is not supported", quesma_errors.ErrCouldNotParseRequest())
+	}
+	params, _ := body["params"].([]any)
+
+	cursor := sqlCursor{fetchSize: sqlDefaultFetchSize, pageTimeout: sqlDefaultPageTimeout}
+	if fetchSize, ok := body["fetch_size"].(float64); ok {
+		if fetchSize <= 0 {
+			return sqlCursor{}, fmt.Errorf("%w: fetch_size must be positive", quesma_errors.ErrCouldNotParseRequest())
+		}
+		cursor.fetchSize = int(fetchSize)
+	}
+	if pageTimeout, ok := body["page_timeout"].(string); ok {
+		duration, err := parseKeepAlive(pageTimeout)
+		if err != nil {
+			return sqlCursor{}, err
+		}
+		cursor.pageTimeout = duration
+	}
+
+	stmt, err := essql.Parse(query, params)
+	if err != nil {
+		return sqlCursor{}, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+	table, currentSchema, resolvedIndexes, err := q.resolveClickhouseIndex(stmt.Index())
+	if err != nil {
+		return sqlCursor{}, err
+	}
+	if len(resolvedIndexes) == 0 {
+		return sqlCursor{}, quesma_errors.ErrIndexNotExists()
+	}
+	translated, err := stmt.Translate(currentSchema)
+	if err != nil {
+		return sqlCursor{}, fmt.Errorf("%w: %v", quesma_errors.ErrCouldNotParseRequest(), err)
+	}
+
+	queries := []*model.Query{{
+		SelectCommand: *translated.SelectCommand,
+		TableName:     table.Name,
+		Indexes:       resolvedIndexes,
+		Schema:        currentSchema,
+	}}
+	if queries, err = q.transformationPipeline.Transform(queries); err != nil {
+		return sqlCursor{}, fmt.Errorf("error transforming queries: %v", err)
+	}
+
+	cursor.table = table
+	cursor.query = queries[0]
+	cursor.columns = translated.Columns
+	cursor.remaining = translated.Limit
+	return cursor, nil
+}
+
+// sqlPage runs the query of the current page and stores the cursor of the next one, if there are more rows
+func (q *QueryRunner) sqlPage(ctx context.Context, cursor sqlCursor) (*sqlResponse, error) {
+	// we fetch one more row to know if there is a next page
+	limit := cursor.fetchSize + 1
+	if cursor.remaining != essql.NoLimit && cursor.remaining <= cursor.fetchSize {
+		limit = cursor.remaining
+	}
+	page := &sqlResponse{Columns: cursor.columns, Rows: [][]any{}}
+	if limit == 0 {
+		return page, nil
+	}
+
+	query := *cursor.query
+	query.SelectCommand.Limit = limit
+	query.SelectCommand.Offset = cursor.offset
+	rows, _, err := q.logManager.ProcessQuery(ctx, cursor.table, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(rows) > cursor.fetchSize
+	if hasMore {
+		rows = rows[:cursor.fetchSize]
+	}
+	for _, row := range rows {
+		values := make([]any, 0, len(cursor.columns))
+		for i := range cursor.columns {
+			var value any
+			if i < len(row.Cols) {
+				value = sqlValue(row.Cols[i].ExtractValue(ctx))
+			}
+			values = append(values, value)
+		}
+		page.Rows = append(page.Rows, values)
+	}
+
+	if hasMore {
+		if cursor.id == "" {
+			cursor.id = SQLCursorPrefix + uuid.Must(uuid.NewV7()).String()
+		}
+		cursor.offset += len(rows)
+		if cursor.remaining != essql.NoLimit {
+			cursor.remaining -= len(rows)
+		}
+		q.sqlCursors.store(cursor)
+		page.Cursor = cursor.id
+	} else if cursor.id != "" {
+		q.sqlCursors.close(cursor.id)
+	}
+	return page, nil
+}
+
+func sqlValue(value any) any {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(sqlDateTimeFormat)
+	}
+	return value
+}
+
+// formatSQLResponse renders the response in the format of the `format` parameter: json (default), txt, csv or tsv
+func formatSQLResponse(page *sqlResponse, format string) (response []byte, contentType string, err error) {
+	switch format {
+	case "", "json":
+		response, err = json.Marshal(page)
+		return response, "application/json", err
+	case "txt":
+		return formatSQLText(page), "text/plain", nil
+	case "csv", "tsv":
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		contentType = "text/csv"
+		if format == "tsv" {
+			writer.Comma = '\t'
+			contentType = "text/tab-separated-values"
+		}
+		if page.Columns != nil {
+			names := make([]string, 0, len(page.Columns))
+			for _, column := range page.Columns {
+				names = append(names, column.Name)
+			}
+			_ = writer.Write(names)
+		}
+		for _, row := range page.Rows {
+			_ = writer.Write(sqlTextValues(row))
+		}
+		writer.Flush()
+		return buf.Bytes(), contentType, writer.Error()
+	}
+	return nil, "", fmt.Errorf("unknown format %s", format)
+}
+
+// formatSQLText renders a table, like Elasticsearch does: centered column names, a line of dashes and left-aligned values.
+// Continuation pages (without columns) have only rows, which are as wide as the first page ones only if the values fit.
+func formatSQLText(page *sqlResponse) []byte {
+	const minColumnWidth = 15
+
+	rows := make([][]string, 0, len(page.Rows))
+	for _, row := range page.Rows {
+		rows = append(rows, sqlTextValues(row))
+	}
+	var widths []int
+	for _, column := range page.Columns {
+		widths = append(widths, max(minColumnWidth, len(column.Name)))
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if i == len(widths) {
+				widths = append(widths, minColumnWidth)
+			}
+			widths[i] = max(widths[i], len(value))
+		}
+	}
+
+	var sb strings.Builder
+	if page.Columns != nil {
+		for i, column := range page.Columns {
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			left := (widths[i] - len(column.Name)) / 2
+			sb.WriteString(strings.Repeat(" ", left) + column.Name + strings.Repeat(" ", widths[i]-left-len(column.Name)))
+		}
+		sb.WriteString("\n")
+		for i := range page.Columns {
+			if i > 0 {
+				sb.WriteString("+")
+			}
+			sb.WriteString(strings.Repeat("-", widths[i]))
+		}
+		sb.WriteString("\n")
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			sb.WriteString(value + strings.Repeat(" ", widths[i]-len(value)))
+		}
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+func sqlTextValues(row []any) []string {
+	values := make([]string, 0, len(row))
+	for _, value := range row {
+		switch value := value.(type) {
+		case nil:
+			values = append(values, "null")
+		case string:
+			values = append(values, value)
+		default:
+			values = append(values, fmt.Sprint(value))
+		}
+	}
+	return values
+}
@@ -0,0 +1,119 @@
+// Copyright Quesma, licensed under the Elastic License 2.0.
+// SPDX-License-Identifier: Elastic-2.0
+package quesma
+
+import (
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"quesma/quesma/errors"
+	"quesma/quesma/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQL(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	timestamp := time.Date(2024, 2, 1, 12, 30, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT "@timestamp", "message" FROM logs WHERE "count">1 ORDER BY "@timestamp" DESC, "message" ASC LIMIT 3`).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "message"}).
+			AddRow(timestamp, "c").AddRow(timestamp, "b").AddRow(timestamp, "a"))
+	mock.ExpectQuery(`SELECT "@timestamp", "message" FROM logs WHERE "count">1 ORDER BY "@timestamp" DESC, "message" ASC LIMIT 3 OFFSET 2`).
+		WillReturnRows(sqlmock.NewRows([]string{"@timestamp", "message"}).AddRow(timestamp, "a"))
+
+	body := types.MustJSON(`{"query": "SELECT \"@timestamp\", message FROM logs WHERE count > ? ORDER BY @timestamp DESC", "params": [1], "fetch_size": 2}`)
+	response, _, err := queryRunner.handleSQL(ctx, body, "")
+	require.NoError(t, err)
+	var firstPage sqlResponse
+	require.NoError(t, json.Unmarshal(response, &firstPage))
+	assert.Equal(t, `[{"name":"@timestamp","type":"datetime"},{"name":"message","type":"keyword"}]`, string(mustMarshal(t, firstPage.Columns)))
+	assert.Equal(t, [][]any{{"2024-02-01T12:30:00.000Z", "c"}, {"2024-02-01T12:30:00.000Z", "b"}}, firstPage.Rows)
+	require.True(t, strings.HasPrefix(firstPage.Cursor, SQLCursorPrefix))
+
+	response, contentType, err := queryRunner.handleSQL(ctx, types.JSON{"cursor": firstPage.Cursor}, "txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, "2024-02-01T12:30:00.000Z|a              \n", string(response))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// the last page closes the cursor
+	_, _, err = queryRunner.handleSQL(ctx, types.JSON{"cursor": firstPage.Cursor}, "")
+	assert.ErrorIs(t, err, errSQLCursorNotFound)
+}
+
+func TestSQLPagesInTotalOrder(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	// the statement has no ORDER BY and the table no document ids, so all selected columns order the pages
+	const query = `SELECT "message", "count" FROM logs ORDER BY "message" ASC, "count" ASC LIMIT 2`
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"message", "count"}).AddRow("a", int64(1)).AddRow("a", int64(2)))
+	mock.ExpectQuery(query + ` OFFSET 1`).WillReturnRows(sqlmock.NewRows([]string{"message", "count"}).AddRow("a", int64(2)).AddRow("b", int64(1)))
+	mock.ExpectQuery(query + ` OFFSET 2`).WillReturnRows(sqlmock.NewRows([]string{"message", "count"}).AddRow("b", int64(1)))
+
+	response, _, err := queryRunner.handleSQL(ctx, types.MustJSON(`{"query": "SELECT message, count FROM logs", "fetch_size": 1}`), "")
+	require.NoError(t, err)
+	var page sqlResponse
+	require.NoError(t, json.Unmarshal(response, &page))
+	rows := page.Rows
+	cursor := page.Cursor
+	for range 2 {
+		require.NotEmpty(t, cursor)
+		response, _, err = queryRunner.handleSQL(ctx, types.JSON{"cursor": cursor}, "")
+		require.NoError(t, err)
+		page = sqlResponse{}
+		require.NoError(t, json.Unmarshal(response, &page))
+		rows = append(rows, page.Rows...)
+		cursor = page.Cursor
+	}
+	assert.Empty(t, cursor)
+	assert.Equal(t, [][]any{{"a", 1.0}, {"a", 2.0}, {"b", 1.0}}, rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLFormats(t *testing.T) {
+	queryRunner, mock := newTestQueryRunnerWithMock(t)
+	for range 2 {
+		mock.ExpectQuery(`SELECT "message", count(*) AS "c" FROM logs GROUP BY "message" HAVING "c">1 ORDER BY "c" DESC, "message" ASC LIMIT 1001`).
+			WillReturnRows(sqlmock.NewRows([]string{"message", "c"}).AddRow("error", uint64(20)).AddRow("some, \"quoted\" warning", uint64(3)))
+	}
+
+	body := types.MustJSON(`{"query": "SELECT message, COUNT(*) AS c FROM logs GROUP BY message HAVING c > 1 ORDER BY c DESC"}`)
+	response, contentType, err := queryRunner.handleSQL(ctx, body, "txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, ""+
+		"       message        |       c       \n"+
+		"----------------------+---------------\n"+
+		"error                 |20             \n"+
+		"some, \"quoted\" warning|3              \n", string(response))
+
+	response, contentType, err = queryRunner.handleSQL(ctx, body, "csv")
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", contentType)
+	assert.Equal(t, "message,c\nerror,20\n\"some, \"\"quoted\"\" warning\",3\n", string(response))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, _, err = queryRunner.handleSQL(ctx, body, "yaml")
+	assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest())
+}
+
+func TestSQLTranslateAndErrors(t *testing.T) {
+	queryRunner, _ := newTestQueryRunnerWithMock(t)
+
+	response, err := queryRunner.handleSQLTranslate(types.MustJSON(`{"query": "SELECT COUNT(*) FROM \"logs-1\" WHERE message = 'error'"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sql": "SELECT count(*) FROM quesma_common_table WHERE (\"message\"='error' AND \"__quesma_index_name\"='logs-1')"}`, string(response))
+
+	for _, query := range []string{`SELECT FROM logs`, `SELECT unknown FROM logs`, `SELECT * FROM logs WHERE`} {
+		_, _, err = queryRunner.handleSQL(ctx, types.JSON{"query": query}, "")
+		assert.ErrorIs(t, err, quesma_errors.ErrCouldNotParseRequest(), query)
+	}
+}
+
+func mustMarshal(t *testing.T, value any) []byte {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return data
+}
@@ -41,7 +41,7 @@ func ParseNDJSON(body string) (NDJSON, error) {
 
 type DocumentTarget struct {
 	Index *string `json:"_index"`
-	Id    *string `json:"_id"` // document's target id in Elasticsearch, we ignore it when writing to Clickhouse.
+	Id    *string `json:"_id"` // document's id, in Clickhouse it's stored in the _id column (generated, if missing)
 }
 
 type BulkOperation map[string]DocumentTarget
@@ -56,6 +56,16 @@ func (op BulkOperation) GetIndex() string {
 	return ""
 }
 
+func (op BulkOperation) GetId() string {
+	for _, target := range op { // this map contains only 1 element though
+		if target.Id != nil {
+			return *target.Id
+		}
+	}
+
+	return ""
+}
+
 func (op BulkOperation) GetOperation() string {
 	for operation := range op {
 		return operation
@@ -63,17 +73,40 @@ func (op BulkOperation) GetOperation() string {
 	return ""
 }
 
+// BulkSize returns the number of operations in a _bulk request body.
+func (n NDJSON) BulkSize() int {
+	size := 0
+	_ = n.BulkForEach(func(int, BulkOperation, JSON, JSON) error {
+		size++
+		return nil
+	})
+	return size
+}
+
+// BulkForEach iterates over operations in a _bulk request body.
+// `delete` is the only operation without a document line, `doc` is nil for it.
 func (n NDJSON) BulkForEach(f func(entryNumber int, operationParsed BulkOperation, operation JSON, doc JSON) error) error {
 
-	for i := 0; i+1 < len(n); i += 2 {
-		operation := n[i]  // {"create":{"_index":"kibana_sample_data_flights", "_id": 1}}
-		document := n[i+1] // {"FlightNum":"9HY9SWR","DestCountry":"AU","OriginWeather":"Sunny","OriginCityName":"Frankfurt am Main" }
+	entryNumber := 0
+	for i := 0; i < len(n); entryNumber++ {
+		operation := n[i] // {"create":{"_index":"kibana_sample_data_flights", "_id": 1}}
 
 		var operationParsed BulkOperation // operationName (create, index, update, delete) -> DocumentTarget
 
 		_ = operation.Remarshal(&operationParsed) // ignore error, the callback must handle it (it will see an unknown operation)
 
-		err := f(i/2, operationParsed, operation, document)
+		var document JSON // {"FlightNum":"9HY9SWR","DestCountry":"AU","OriginWeather":"Sunny","OriginCityName":"Frankfurt am Main" }
+		if operationParsed.GetOperation() == "delete" {
+			i++
+		} else {
+			if i+1 >= len(n) {
+				break
+			}
+			document = n[i+1]
+			i += 2
+		}
+
+		err := f(entryNumber, operationParsed, operation, document)
 		if err != nil {
 			return err
 		}
@@ -26,3 +26,31 @@ func TestParseNDJSON(t *testing.T) {
 	}
 
 }
+
+func TestBulkForEachWithDelete(t *testing.T) {
+
+	ndjson := `{"index":{"_index":"device_logs"}}
+{"client_id": "123"}
+{"delete":{"_index":"device_logs","_id":"1"}}
+{"update":{"_index":"device_logs","_id":"2"}}
+{"doc":{"client_id": "234"}}`
+
+	bulk, err := ParseNDJSON(ndjson)
+	assert.NoError(t, err)
+
+	var operations, ids []string
+	var documents []JSON
+	err = bulk.BulkForEach(func(entryNumber int, op BulkOperation, _ JSON, doc JSON) error {
+		assert.Equal(t, len(operations), entryNumber)
+		operations = append(operations, op.GetOperation())
+		ids = append(ids, op.GetId())
+		documents = append(documents, doc)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, bulk.BulkSize())
+	assert.Equal(t, []string{"index", "delete", "update"}, operations)
+	assert.Equal(t, []string{"", "1", "2"}, ids)
+	assert.Equal(t, []JSON{{"client_id": "123"}, nil, {"doc": map[string]any{"client_id": "234"}}}, documents)
+}
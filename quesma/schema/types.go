@@ -88,3 +88,12 @@ func ParseQuesmaType(t string) (QuesmaType, bool) {
 		return QuesmaTypeUnknown, false
 	}
 }
+
+// IsComparable returns false for types, which can't be sorted by in ClickHouse or have no order
+func (t QuesmaType) IsComparable() bool {
+	switch t.Name {
+	case QuesmaTypeObject.Name, QuesmaTypeMap.Name, QuesmaTypePoint.Name, QuesmaTypeUnknown.Name:
+		return false
+	}
+	return true
+}
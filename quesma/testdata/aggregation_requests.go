@@ -411,17 +411,17 @@ var AggregationTests = []AggregationTestCase{
 										{
 											"doc_count": 2,
 											"key": 1706871600000,
-											"key_as_string": "2024-02-02T11:00:00.000"
+											"key_as_string": "2024-02-02T12:00:00.000+01:00"
 										},
 										{
 											"doc_count": 27,
 											"key": 1706882400000,
-											"key_as_string": "2024-02-02T14:00:00.000"
+											"key_as_string": "2024-02-02T15:00:00.000+01:00"
 										},
 										{
 											"doc_count": 34,
 											"key": 1706893200000,
-											"key_as_string": "2024-02-02T17:00:00.000"
+											"key_as_string": "2024-02-02T18:00:00.000+01:00"
 										}
 									]
 								},
@@ -434,12 +434,12 @@ var AggregationTests = []AggregationTestCase{
 										{
 											"doc_count": 0,
 											"key": 1706871600000,
-											"key_as_string": "2024-02-02T11:00:00.000"
+											"key_as_string": "2024-02-02T12:00:00.000+01:00"
 										},
 										{
 											"doc_count": 2,
 											"key": 1706882400000,
-											"key_as_string": "2024-02-02T14:00:00.000"
+											"key_as_string": "2024-02-02T15:00:00.000+01:00"
 										}
 									]
 								},
@@ -1715,12 +1715,12 @@ var AggregationTests = []AggregationTestCase{
 										{
 											"doc_count": 22,
 											"key": 1707476400000,
-											"key_as_string": "2024-02-09T11:00:00.000"
+											"key_as_string": "2024-02-09T12:00:00.000+01:00"
 										},
 										{
 											"doc_count": 80,
 											"key": 1707487200000,
-											"key_as_string": "2024-02-09T14:00:00.000"
+											"key_as_string": "2024-02-09T15:00:00.000+01:00"
 										}
 									]
 								},
@@ -1733,12 +1733,12 @@ var AggregationTests = []AggregationTestCase{
 										{
 											"doc_count": 17,
 											"key": 1707476400000,
-											"key_as_string": "2024-02-09T11:00:00.000"
+											"key_as_string": "2024-02-09T12:00:00.000+01:00"
 										},
 										{
 											"doc_count": 32,
 											"key": 1707487200000,
-											"key_as_string": "2024-02-09T14:00:00.000"
+											"key_as_string": "2024-02-09T15:00:00.000+01:00"
 										}
 									]
 								},
@@ -1751,12 +1751,12 @@ var AggregationTests = []AggregationTestCase{
 										{
 											"doc_count": 5,
 											"key": 1707476400000,
-											"key_as_string": "2024-02-09T11:00:00.000"
+											"key_as_string": "2024-02-09T12:00:00.000+01:00"
 										},
 										{
 											"doc_count": 11,
 											"key": 1707487200000,
-											"key_as_string": "2024-02-09T14:00:00.000"
+											"key_as_string": "2024-02-09T15:00:00.000+01:00"
 										}
 									]
 								},
@@ -2021,7 +2021,7 @@ var AggregationTests = []AggregationTestCase{
 											},
 											"doc_count": 2,
 											"key": 1707476400000,
-											"key_as_string": "2024-02-09T11:00:00.000"
+											"key_as_string": "2024-02-09T12:00:00.000+01:00"
 										},
 										{
 											"4": {
@@ -2050,7 +2050,7 @@ var AggregationTests = []AggregationTestCase{
 											},
 											"doc_count": 1,
 											"key": 1707735600000,
-											"key_as_string": "2024-02-12T11:00:00.000"
+											"key_as_string": "2024-02-12T12:00:00.000+01:00"
 										},
 										{
 											"4": {
@@ -2079,7 +2079,7 @@ var AggregationTests = []AggregationTestCase{
 											},
 											"doc_count": 1,
 											"key": 1707778800000,
-											"key_as_string": "2024-02-12T23:00:00.000"
+											"key_as_string": "2024-02-13T00:00:00.000+01:00"
 										}
 									]
 								},
@@ -4387,13 +4387,13 @@ var AggregationTests = []AggregationTestCase{
 			}},
 		},
 		ExpectedPancakeSQL: `
-			SELECT countIf("timestamp"<toInt64(toUnixTimestamp(now()))) AS
+			SELECT countIf("timestamp"<toInt64(toUnixTimestamp(now('Europe/Warsaw')))) AS
 			  "range_0__aggr__2__count",
-			  countIf(("timestamp">=toInt64(toUnixTimestamp(toStartOfDay(subDate(now(),
-			  INTERVAL 3 week)))) AND "timestamp"<toInt64(toUnixTimestamp(now())))) AS
-			  "range_1__aggr__2__count",
-			  countIf("timestamp">=toInt64(toUnixTimestamp('2024-04-14'))) AS
-			  "range_2__aggr__2__count"
+			  countIf(("timestamp">=toInt64(toUnixTimestamp(toStartOfDay(subDate(now(
+			  'Europe/Warsaw'), INTERVAL 3 week), 'Europe/Warsaw'))) AND "timestamp"<toInt64
+			  (toUnixTimestamp(now('Europe/Warsaw'))))) AS "range_1__aggr__2__count",
+			  countIf("timestamp">=toInt64(toUnixTimestamp(toDateTime64(
+			  '2024-04-14 00:00:00.000', 3, 'Europe/Warsaw')))) AS "range_2__aggr__2__count"
 			FROM ` + TableName + ` 
 			WHERE ("timestamp">=fromUnixTimestamp64Milli(1712388530059) AND "timestamp"<=fromUnixTimestamp64Milli(1713288530059))`,
 	},
@@ -4506,7 +4506,21 @@ var AggregationTests = []AggregationTestCase{
 			FROM ` + TableName + `
 			GROUP BY "message" AS "aggr__2__key_0"
 			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 5`,
+			LIMIT 17`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "message" AS "aggr__2__key_0", count(*) AS "aggr__2__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__bg_total"
+			FROM __quesma_table_name
+			WHERE "message" IN (
+			  SELECT "message"
+			  FROM __quesma_table_name
+			  GROUP BY "message"
+			  ORDER BY count(*) DESC, "message" ASC
+			  LIMIT 16)
+			GROUP BY "message"`,
+		},
 	},
 	{ // [24]
 		TestName: "meta field in aggregation",
@@ -4986,6 +5000,18 @@ var AggregationTests = []AggregationTestCase{
 								],
 								"sum_other_doc_count": 0
 							}
+						},
+						{
+							"doc_count": 0,
+							"key": 6000.0
+						},
+						{
+							"doc_count": 0,
+							"key": 8000.0
+						},
+						{
+							"doc_count": 0,
+							"key": 10000.0
 						}
 					]
 				}
@@ -5958,7 +5984,7 @@ var AggregationTests = []AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1716326400000,
-								"key_as_string": "2024-05-21T21:20:00.000"
+								"key_as_string": "2024-05-21T23:20:00.000+02:00"
 							},
 							{	
 								"1": {
@@ -6007,7 +6033,7 @@ var AggregationTests = []AggregationTestCase{
 								},
 								"doc_count": 8,
 								"key": 1716370200000,
-								"key_as_string": "2024-05-22T09:30:00.000"
+								"key_as_string": "2024-05-22T11:30:00.000+02:00"
 							}
 						]
 					}
@@ -161,7 +161,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"hour1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-06-10T13:00:00.000",
+							"key_as_string": "2024-06-10T15:00:00.000+02:00",
 							"key": 1718024400000,
 							"doc_count": 33
 						}
@@ -170,7 +170,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"month1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-05-31T22:00:00.000",
+							"key_as_string": "2024-06-01T00:00:00.000+02:00",
 							"key": 1717192800000,
 							"doc_count": 33
 						}
@@ -179,7 +179,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"week1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-06-09T22:00:00.000",
+							"key_as_string": "2024-06-10T00:00:00.000+02:00",
 							"key": 1717970400000,
 							"doc_count": 33
 						}
@@ -215,12 +215,12 @@ var AggregationTests2 = []AggregationTestCase{
 				"minute1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-06-10T13:24:00.000",
+							"key_as_string": "2024-06-10T15:24:00.000+02:00",
 							"key": 1718025840000,
 							"doc_count": 9
 						},
 						{
-							"key_as_string": "2024-06-10T13:25:00.000",
+							"key_as_string": "2024-06-10T15:25:00.000+02:00",
 							"key": 1718025900000,
 							"doc_count": 24
 						}
@@ -229,7 +229,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"quarter1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-03-31T22:00:00.000",
+							"key_as_string": "2024-04-01T00:00:00.000+02:00",
 							"key": 1711922400000,
 							"doc_count": 33
 						}
@@ -261,7 +261,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"year1": {
 					"buckets": [
 						{
-							"key_as_string": "2023-12-31T23:00:00.000",
+							"key_as_string": "2024-01-01T00:00:00.000+01:00",
 							"key": 1704063600000,
 							"doc_count": 33
 						}
@@ -279,7 +279,7 @@ var AggregationTests2 = []AggregationTestCase{
 				"day1": {
 					"buckets": [
 						{
-							"key_as_string": "2024-06-09T22:00:00.000",
+							"key_as_string": "2024-06-10T00:00:00.000+02:00",
 							"key": 1717970400000,
 							"doc_count": 33
 						}
@@ -433,16 +433,16 @@ var AggregationTests2 = []AggregationTestCase{
 			GROUP BY toInt64(toUnixTimestamp(toStartOfQuarter(toTimezone("@timestamp",'UTC'))))*1000 AS
 			  "aggr__quarter2__key_0"
 			ORDER BY "aggr__quarter2__key_0" ASC`,
-			`SELECT  toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'Europe/Warsaw'))))*1000 AS
+			`SELECT  toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'Europe/Warsaw'),1)))*1000 AS
 			  "aggr__week1__key_0", count(*) AS "aggr__week1__count"
 			FROM ` + TableName + `
-			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'Europe/Warsaw'))))*1000
+			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'Europe/Warsaw'),1)))*1000
 			  AS "aggr__week1__key_0"
 			ORDER BY "aggr__week1__key_0" ASC`,
-			`SELECT toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'UTC'))))*1000 AS
+			`SELECT toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'UTC'),1)))*1000 AS
 			  "aggr__week2__key_0", count(*) AS "aggr__week2__count"
 			FROM ` + TableName + `
-			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'UTC'))))*1000 AS
+			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("@timestamp",'UTC'),1)))*1000 AS
 			  "aggr__week2__key_0"
 			ORDER BY "aggr__week2__key_0" ASC`,
 			`SELECT toInt64(toUnixTimestamp(toStartOfYear(toTimezone("@timestamp",'Europe/Warsaw'))))*1000
@@ -608,7 +608,22 @@ var AggregationTests2 = []AggregationTestCase{
 			WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401475845) AND "timestamp"<=fromUnixTimestamp64Milli(1714697475845))
 			GROUP BY "response" AS "aggr__2__key_0"
 			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 4`,
+			LIMIT 15`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "response" AS "aggr__2__key_0", count(*) AS "aggr__2__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__bg_total"
+			FROM __quesma_table_name
+			WHERE "response" IN (
+			  SELECT "response"
+			  FROM __quesma_table_name
+			  WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401475845) AND "timestamp"<=fromUnixTimestamp64Milli(1714697475845))
+			  GROUP BY "response"
+			  ORDER BY count(*) DESC, "response" ASC
+			  LIMIT 14)
+			GROUP BY "response"`,
+		},
 	},
 	{ // [44]
 		TestName: "2x terms with nulls 1/4, nulls in second aggregation, with missing parameter",
@@ -4091,4 +4106,3342 @@ var AggregationTests2 = []AggregationTestCase{
 			ORDER BY "aggr__interval-2__key_0" ASC`,
 		},
 	},
+	{ // [65]
+		TestName: "composite with terms and date_histogram sources, after and a subaggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"my_buckets": {
+					"composite": {
+						"size": 2,
+						"sources": [
+							{"host": {"terms": {"field": "message"}}},
+							{"hour": {"date_histogram": {"field": "@timestamp", "fixed_interval": "1h"}}}
+						],
+						"after": {"host": "a", "hour": 1706857200000}
+					},
+					"aggs": {
+						"avg_bytes": {
+							"avg": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"my_buckets": {
+					"after_key": {
+						"host": "b",
+						"hour": 1706853600000
+					},
+					"buckets": [
+						{
+							"key": {
+								"host": "a",
+								"hour": 1706860800000
+							},
+							"doc_count": 3,
+							"avg_bytes": {
+								"value": 10.0
+							}
+						},
+						{
+							"key": {
+								"host": "b",
+								"hour": 1706853600000
+							},
+							"doc_count": 1,
+							"avg_bytes": {
+								"value": 7.5
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__my_buckets__key_0", "a"),
+				model.NewQueryResultCol("aggr__my_buckets__key_1", int64(1706860800000/3600000)),
+				model.NewQueryResultCol("aggr__my_buckets__count", int64(3)),
+				model.NewQueryResultCol("metric__my_buckets__avg_bytes_col_0", 10.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__my_buckets__key_0", "b"),
+				model.NewQueryResultCol("aggr__my_buckets__key_1", int64(1706853600000/3600000)),
+				model.NewQueryResultCol("aggr__my_buckets__count", int64(1)),
+				model.NewQueryResultCol("metric__my_buckets__avg_bytes_col_0", 7.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "message" AS "aggr__my_buckets__key_0",
+			  toInt64(toUnixTimestamp64Milli("@timestamp") / 3600000) AS "aggr__my_buckets__key_1",
+			  count(*) AS "aggr__my_buckets__count",
+			  avgOrNull("bytes_gauge") AS "metric__my_buckets__avg_bytes_col_0"
+			FROM __quesma_table_name
+			WHERE (("message" IS NOT NULL AND "@timestamp" IS NOT NULL) AND
+			  tuple("message", toInt64(toUnixTimestamp64Milli("@timestamp") / 3600000))>tuple('a', 474127))
+			GROUP BY "message" AS "aggr__my_buckets__key_0",
+			  toInt64(toUnixTimestamp64Milli("@timestamp") / 3600000) AS "aggr__my_buckets__key_1"
+			ORDER BY "aggr__my_buckets__key_0" ASC, "aggr__my_buckets__key_1" ASC
+			LIMIT 2`,
+	},
+	{ // [66]
+		TestName: "composite with mixed order sources and a sibling metric",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"max_bytes": {
+					"max": {
+						"field": "bytes_gauge"
+					}
+				},
+				"pages": {
+					"composite": {
+						"sources": [
+							{"bytes": {"histogram": {"field": "bytes_gauge", "interval": 100, "order": "desc"}}},
+							{"host": {"terms": {"field": "message"}}}
+						],
+						"after": {"bytes": 500, "host": "x"}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"max_bytes": {
+					"value": 999.0
+				},
+				"pages": {
+					"after_key": {
+						"bytes": 400.0,
+						"host": "a"
+					},
+					"buckets": [
+						{
+							"key": {
+								"bytes": 500.0,
+								"host": "y"
+							},
+							"doc_count": 2
+						},
+						{
+							"key": {
+								"bytes": 400.0,
+								"host": "a"
+							},
+							"doc_count": 5
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__max_bytes_col_0", 999.0),
+			}},
+		},
+		ExpectedAdditionalPancakeResults: [][]model.QueryResultRow{
+			{
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__pages__key_0", 500.0),
+					model.NewQueryResultCol("aggr__pages__key_1", "y"),
+					model.NewQueryResultCol("aggr__pages__count", int64(2)),
+				}},
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__pages__key_0", 400.0),
+					model.NewQueryResultCol("aggr__pages__key_1", "a"),
+					model.NewQueryResultCol("aggr__pages__count", int64(5)),
+				}},
+			},
+		},
+		ExpectedPancakeSQL: `
+			SELECT maxOrNull("bytes_gauge") AS "metric__max_bytes_col_0"
+			FROM __quesma_table_name`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT floor("bytes_gauge"/100)*100 AS "aggr__pages__key_0",
+			  "message" AS "aggr__pages__key_1", count(*) AS "aggr__pages__count"
+			FROM __quesma_table_name
+			WHERE (("bytes_gauge" IS NOT NULL AND "message" IS NOT NULL) AND
+			  (floor("bytes_gauge"/100)*100<500 OR (floor("bytes_gauge"/100)*100=500 AND "message">'x')))
+			GROUP BY floor("bytes_gauge"/100)*100 AS "aggr__pages__key_0",
+			  "message" AS "aggr__pages__key_1"
+			ORDER BY "aggr__pages__key_0" DESC, "aggr__pages__key_1" ASC
+			LIMIT 10`,
+		},
+	},
+	{ // [67]
+		TestName: "significant_terms scored with background frequencies, with background_filter and a subaggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"sig": {
+					"significant_terms": {
+						"field": "message",
+						"size": 2,
+						"background_filter": {
+							"term": {"service.name": "api"}
+						}
+					},
+					"aggs": {
+						"avg_bytes": {
+							"avg": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				}
+			},
+			"query": {
+				"term": {"host.name": "prod"}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"sig": {
+					"doc_count": 100,
+					"bg_count": 1000,
+					"buckets": [
+						{
+							"key": "error",
+							"doc_count": 30,
+							"score": 1.95,
+							"bg_count": 40,
+							"avg_bytes": {
+								"value": 7.0
+							}
+						},
+						{
+							"key": "warn",
+							"doc_count": 50,
+							"score": 0.33333333333333337,
+							"bg_count": 300,
+							"avg_bytes": {
+								"value": 5.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__sig__parent_count", int64(100)),
+				model.NewQueryResultCol("aggr__sig__key_0", "warn"),
+				model.NewQueryResultCol("aggr__sig__count", int64(50)),
+				model.NewQueryResultCol("metric__sig__avg_bytes_col_0", 5.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__sig__parent_count", int64(100)),
+				model.NewQueryResultCol("aggr__sig__key_0", "error"),
+				model.NewQueryResultCol("aggr__sig__count", int64(30)),
+				model.NewQueryResultCol("metric__sig__avg_bytes_col_0", 7.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__sig__parent_count", int64(100)),
+				model.NewQueryResultCol("aggr__sig__key_0", "info"),
+				model.NewQueryResultCol("aggr__sig__count", int64(20)),
+				model.NewQueryResultCol("metric__sig__avg_bytes_col_0", 1.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__sig__parent_count",
+			  "message" AS "aggr__sig__key_0", count(*) AS "aggr__sig__count",
+			  avgOrNull("bytes_gauge") AS "metric__sig__avg_bytes_col_0"
+			FROM __quesma_table_name
+			WHERE "host.name"='prod'
+			GROUP BY "message" AS "aggr__sig__key_0"
+			ORDER BY "aggr__sig__count" DESC, "aggr__sig__key_0" ASC
+			LIMIT 14`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "message" AS "aggr__sig__key_0", count(*) AS "aggr__sig__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name
+			  WHERE "service.name"='api') AS "aggr__sig__bg_total"
+			FROM __quesma_table_name
+			WHERE ("service.name"='api' AND "message" IN (
+			  SELECT "message"
+			  FROM __quesma_table_name
+			  WHERE "host.name"='prod'
+			  GROUP BY "message"
+			  ORDER BY count(*) DESC, "message" ASC
+			  LIMIT 13))
+			GROUP BY "message"`,
+		},
+		ExpectedAdditionalPancakeResults: [][]model.QueryResultRow{
+			{
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__sig__key_0", "error"),
+					model.NewQueryResultCol("aggr__sig__bg_count", int64(40)),
+					model.NewQueryResultCol("aggr__sig__bg_total", int64(1000)),
+				}},
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__sig__key_0", "info"),
+					model.NewQueryResultCol("aggr__sig__bg_count", int64(660)),
+					model.NewQueryResultCol("aggr__sig__bg_total", int64(1000)),
+				}},
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__sig__key_0", "warn"),
+					model.NewQueryResultCol("aggr__sig__bg_count", int64(300)),
+					model.NewQueryResultCol("aggr__sig__bg_total", int64(1000)),
+				}},
+			},
+		},
+	},
+	{ // [68]
+		TestName: "bucket_selector with a metric and _count in buckets_path",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"hosts": {
+					"terms": {
+						"field": "message",
+						"size": 10
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"big_hosts": {
+							"bucket_selector": {
+								"buckets_path": {
+									"totalBytes": "sum_bytes",
+									"count": "_count"
+								},
+								"script": "params.totalBytes > 200 && params.count > 1"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"hosts": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "a",
+							"doc_count": 5,
+							"sum_bytes": {
+								"value": 500.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(10)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "a"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(5)),
+				model.NewQueryResultCol("metric__hosts__sum_bytes_col_0", 500.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(10)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "c"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(4)),
+				model.NewQueryResultCol("metric__hosts__sum_bytes_col_0", 100.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(10)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "b"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(1)),
+				model.NewQueryResultCol("metric__hosts__sum_bytes_col_0", 300.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__hosts__parent_count",
+			  "message" AS "aggr__hosts__key_0", count(*) AS "aggr__hosts__count",
+			  sumOrNull("bytes_gauge") AS "metric__hosts__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY "message" AS "aggr__hosts__key_0"
+			ORDER BY "aggr__hosts__count" DESC, "aggr__hosts__key_0" ASC
+			LIMIT 11`,
+	},
+	{ // [69]
+		TestName: "bucket_sort by a metric with from and size",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"bytes": {
+					"histogram": {
+						"field": "bytes_gauge",
+						"interval": 100
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"sorted": {
+							"bucket_sort": {
+								"sort": [
+									{"sum_bytes": {"order": "desc"}}
+								],
+								"from": 1,
+								"size": 2
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"bytes": {
+					"buckets": [
+						{
+							"key": 200.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 250.0
+							}
+						},
+						{
+							"key": 100.0,
+							"doc_count": 2,
+							"sum_bytes": {
+								"value": 240.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 0.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(3)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 90.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 100.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(2)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 240.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 200.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 250.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 300.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 300.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0",
+			  count(*) AS "aggr__bytes__count",
+			  sumOrNull("bytes_gauge") AS "metric__bytes__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0"
+			ORDER BY "aggr__bytes__key_0" ASC`,
+	},
+	{ // [70]
+		TestName: "moving_fn and moving_avg over histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"bytes": {
+					"histogram": {
+						"field": "bytes_gauge",
+						"interval": 100
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"avg_of_previous": {
+							"moving_fn": {
+								"buckets_path": "sum_bytes",
+								"window": 2,
+								"script": "MovingFunctions.unweightedAvg(values)"
+							}
+						},
+						"max_with_current": {
+							"moving_fn": {
+								"buckets_path": "sum_bytes",
+								"window": 2,
+								"shift": 1,
+								"script": {
+									"source": "return MovingFunctions.max(values);"
+								}
+							}
+						},
+						"ewma": {
+							"moving_avg": {
+								"buckets_path": "sum_bytes",
+								"model": "ewma",
+								"settings": {
+									"alpha": 0.5
+								}
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"bytes": {
+					"buckets": [
+						{
+							"key": 0.0,
+							"doc_count": 3,
+							"sum_bytes": {
+								"value": 90.0
+							},
+							"avg_of_previous": {
+								"value": null
+							},
+							"max_with_current": {
+								"value": 90.0
+							},
+							"ewma": {
+								"value": null
+							}
+						},
+						{
+							"key": 100.0,
+							"doc_count": 2,
+							"sum_bytes": {
+								"value": 240.0
+							},
+							"avg_of_previous": {
+								"value": 90.0
+							},
+							"max_with_current": {
+								"value": 240.0
+							},
+							"ewma": {
+								"value": 90.0
+							}
+						},
+						{
+							"key": 200.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 250.0
+							},
+							"avg_of_previous": {
+								"value": 165.0
+							},
+							"max_with_current": {
+								"value": 250.0
+							},
+							"ewma": {
+								"value": 165.0
+							}
+						},
+						{
+							"key": 300.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 300.0
+							},
+							"avg_of_previous": {
+								"value": 245.0
+							},
+							"max_with_current": {
+								"value": 300.0
+							},
+							"ewma": {
+								"value": 207.5
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 0.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(3)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 90.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 100.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(2)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 240.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 200.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 250.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 300.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 300.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0",
+			  count(*) AS "aggr__bytes__count",
+			  sumOrNull("bytes_gauge") AS "metric__bytes__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0"
+			ORDER BY "aggr__bytes__key_0" ASC`,
+	},
+	{ // [71]
+		TestName: "moving_percentiles over date_histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"by_day": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"fixed_interval": "1d"
+					},
+					"aggs": {
+						"latency": {
+							"percentiles": {
+								"field": "bytes_gauge",
+								"percents": [1, 99]
+							}
+						},
+						"moving_latency": {
+							"moving_percentiles": {
+								"buckets_path": "latency",
+								"window": 2,
+								"shift": 1
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"by_day": {
+					"buckets": [
+						{
+							"key": 1706054400000,
+							"key_as_string": "2024-01-24T00:00:00.000",
+							"doc_count": 3,
+							"latency": {
+								"values": {
+									"1.0": 10.0,
+									"99.0": 30.0
+								}
+							},
+							"moving_latency": {
+								"values": {
+									"1.0": 10.0,
+									"99.0": 30.0
+								}
+							}
+						},
+						{
+							"key": 1706140800000,
+							"key_as_string": "2024-01-25T00:00:00.000",
+							"doc_count": 2,
+							"latency": {
+								"values": {
+									"1.0": 50.0,
+									"99.0": 60.0
+								}
+							},
+							"moving_latency": {
+								"values": {
+									"1.0": 10.0,
+									"99.0": 60.0
+								}
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706054400000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(3)),
+				model.NewQueryResultCol("metric__by_day__latency_col_0", []float64{10.0}),
+				model.NewQueryResultCol("metric__by_day__latency_col_1", []float64{30.0}),
+				model.NewQueryResultCol("metric__by_day__moving_latency_col_0", []float64{10.0}),
+				model.NewQueryResultCol("metric__by_day__moving_latency_col_1", []float64{30.0}),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706140800000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(2)),
+				model.NewQueryResultCol("metric__by_day__latency_col_0", []float64{50.0}),
+				model.NewQueryResultCol("metric__by_day__latency_col_1", []float64{60.0}),
+				model.NewQueryResultCol("metric__by_day__moving_latency_col_0", []float64{10.0}),
+				model.NewQueryResultCol("metric__by_day__moving_latency_col_1", []float64{60.0}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0", count(*) AS "aggr__by_day__count",
+			  quantiles(0.010000)("bytes_gauge") AS "metric__by_day__latency_col_0",
+			  quantiles(0.990000)("bytes_gauge") AS "metric__by_day__latency_col_1",
+			  quantilesMerge(0.010000)(quantilesState(0.010000)("bytes_gauge")) OVER (ORDER
+			  BY "aggr__by_day__key_0" ASC ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) AS
+			  "metric__by_day__moving_latency_col_0",
+			  quantilesMerge(0.990000)(quantilesState(0.990000)("bytes_gauge")) OVER (ORDER
+			  BY "aggr__by_day__key_0" ASC ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) AS
+			  "metric__by_day__moving_latency_col_1"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0"
+			ORDER BY "aggr__by_day__key_0" ASC`,
+	},
+	{ // [72]
+		TestName: "stats_bucket, extended_stats_bucket and percentiles_bucket over histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"bytes": {
+					"histogram": {
+						"field": "bytes_gauge",
+						"interval": 100
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				},
+				"stats_bytes": {
+					"stats_bucket": {
+						"buckets_path": "bytes>sum_bytes"
+					}
+				},
+				"extended_stats_bytes": {
+					"extended_stats_bucket": {
+						"buckets_path": "bytes>sum_bytes",
+						"sigma": 1
+					}
+				},
+				"percentiles_bytes": {
+					"percentiles_bucket": {
+						"buckets_path": "bytes>sum_bytes",
+						"percents": [25, 50, 99]
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"bytes": {
+					"buckets": [
+						{
+							"key": 0.0,
+							"doc_count": 3,
+							"sum_bytes": {
+								"value": 90.0
+							}
+						},
+						{
+							"key": 100.0,
+							"doc_count": 2,
+							"sum_bytes": {
+								"value": 240.0
+							}
+						},
+						{
+							"key": 200.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 250.0
+							}
+						},
+						{
+							"key": 300.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 300.0
+							}
+						}
+					]
+				},
+				"stats_bytes": {
+					"count": 4,
+					"min": 90.0,
+					"max": 300.0,
+					"avg": 220.0,
+					"sum": 880.0
+				},
+				"extended_stats_bytes": {
+					"count": 4,
+					"min": 90.0,
+					"max": 300.0,
+					"avg": 220.0,
+					"sum": 880.0,
+					"sum_of_squares": 218200.0,
+					"variance": 6150.0,
+					"variance_population": 6150.0,
+					"variance_sampling": 8200.0,
+					"std_deviation": 78.4219357067906,
+					"std_deviation_population": 78.4219357067906,
+					"std_deviation_sampling": 90.55385138137417,
+					"std_deviation_bounds": {
+						"upper": 298.4219357067906,
+						"lower": 141.5780642932094,
+						"upper_population": 298.4219357067906,
+						"lower_population": 141.5780642932094,
+						"upper_sampling": 310.55385138137416,
+						"lower_sampling": 129.44614861862584
+					}
+				},
+				"percentiles_bytes": {
+					"values": {
+						"25.0": 240.0,
+						"50.0": 250.0,
+						"99.0": 300.0
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 0.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(3)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 90.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 100.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(2)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 240.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 200.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 250.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 300.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 300.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0",
+			  count(*) AS "aggr__bytes__count",
+			  sumOrNull("bytes_gauge") AS "metric__bytes__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0"
+			ORDER BY "aggr__bytes__key_0" ASC`,
+	},
+	{ // [73]
+		TestName: "stats_bucket with insert_zeros gap policy and non-keyed percentiles_bucket",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"hosts": {
+					"terms": {
+						"field": "host.name",
+						"size": 3
+					},
+					"aggs": {
+						"avg_bytes": {
+							"avg": {
+								"field": "bytes_gauge"
+							}
+						}
+					}
+				},
+				"stats_bytes": {
+					"stats_bucket": {
+						"buckets_path": "hosts>avg_bytes",
+						"gap_policy": "insert_zeros"
+					}
+				},
+				"percentiles_bytes": {
+					"percentiles_bucket": {
+						"buckets_path": "hosts>avg_bytes",
+						"keyed": false
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"hosts": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "a",
+							"doc_count": 5,
+							"avg_bytes": {
+								"value": 10.0
+							}
+						},
+						{
+							"key": "b",
+							"doc_count": 4,
+							"avg_bytes": {
+								"value": null
+							}
+						},
+						{
+							"key": "c",
+							"doc_count": 3,
+							"avg_bytes": {
+								"value": 30.0
+							}
+						}
+					]
+				},
+				"stats_bytes": {
+					"count": 3,
+					"min": 0.0,
+					"max": 30.0,
+					"avg": 13.333333333333334,
+					"sum": 40.0
+				},
+				"percentiles_bytes": {
+					"values": [
+						{"key": 1.0, "value": 10.0},
+						{"key": 5.0, "value": 10.0},
+						{"key": 25.0, "value": 10.0},
+						{"key": 50.0, "value": 30.0},
+						{"key": 75.0, "value": 30.0},
+						{"key": 95.0, "value": 30.0},
+						{"key": 99.0, "value": 30.0}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(12)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "a"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(5)),
+				model.NewQueryResultCol("metric__hosts__avg_bytes_col_0", 10.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(12)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "b"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(4)),
+				model.NewQueryResultCol("metric__hosts__avg_bytes_col_0", nil),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hosts__parent_count", int64(12)),
+				model.NewQueryResultCol("aggr__hosts__key_0", "c"),
+				model.NewQueryResultCol("aggr__hosts__count", int64(3)),
+				model.NewQueryResultCol("metric__hosts__avg_bytes_col_0", 30.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__hosts__parent_count",
+			  "host.name" AS "aggr__hosts__key_0", count(*) AS "aggr__hosts__count",
+			  avgOrNull("bytes_gauge") AS "metric__hosts__avg_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY "host.name" AS "aggr__hosts__key_0"
+			ORDER BY "aggr__hosts__count" DESC, "aggr__hosts__key_0" ASC
+			LIMIT 4`,
+	},
+	{ // [74]
+		TestName: "cumulative_cardinality and derivative with unit over date_histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"by_day": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"fixed_interval": "1d"
+					},
+					"aggs": {
+						"users": {
+							"cardinality": {
+								"field": "user.id"
+							}
+						},
+						"total_users": {
+							"cumulative_cardinality": {
+								"buckets_path": "users"
+							}
+						},
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"bytes_per_hour": {
+							"derivative": {
+								"buckets_path": "sum_bytes",
+								"unit": "1h"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"by_day": {
+					"buckets": [
+						{
+							"key": 1706054400000,
+							"key_as_string": "2024-01-24T00:00:00.000",
+							"doc_count": 5,
+							"users": {
+								"value": 3
+							},
+							"total_users": {
+								"value": 3
+							},
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"bytes_per_hour": {
+								"value": null,
+								"normalized_value": null
+							}
+						},
+						{
+							"key": 1706140800000,
+							"key_as_string": "2024-01-25T00:00:00.000",
+							"doc_count": 2,
+							"users": {
+								"value": 2
+							},
+							"total_users": {
+								"value": 4
+							},
+							"sum_bytes": {
+								"value": 340.0
+							},
+							"bytes_per_hour": {
+								"value": 240.0,
+								"normalized_value": 10.0
+							}
+						},
+						{
+							"key": 1706227200000,
+							"key_as_string": "2024-01-26T00:00:00.000",
+							"doc_count": 6,
+							"users": {
+								"value": 4
+							},
+							"total_users": {
+								"value": 6
+							},
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"bytes_per_hour": {
+								"value": -240.0,
+								"normalized_value": -10.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706054400000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(5)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 100.0),
+				model.NewQueryResultCol("metric__by_day__users_col_0", uint64(3)),
+				model.NewQueryResultCol("metric__by_day__total_users_col_0", uint64(3)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706140800000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(2)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 340.0),
+				model.NewQueryResultCol("metric__by_day__users_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__by_day__total_users_col_0", uint64(4)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706227200000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(6)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 100.0),
+				model.NewQueryResultCol("metric__by_day__users_col_0", uint64(4)),
+				model.NewQueryResultCol("metric__by_day__total_users_col_0", uint64(6)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0", count(*) AS "aggr__by_day__count",
+			  sumOrNull("bytes_gauge") AS "metric__by_day__sum_bytes_col_0",
+			  uniq("user.id") AS "metric__by_day__users_col_0",
+			  uniqMerge(uniqState("user.id")) OVER (ORDER BY "aggr__by_day__key_0" ASC ROWS
+			  BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS
+			  "metric__by_day__total_users_col_0"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0"
+			ORDER BY "aggr__by_day__key_0" ASC`,
+	},
+	{ // [75]
+		TestName: "normalize with different methods over histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"bytes": {
+					"histogram": {
+						"field": "bytes_gauge",
+						"interval": 100
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"percent_of_bytes": {
+							"normalize": {
+								"buckets_path": "sum_bytes",
+								"method": "percent_of_sum"
+							}
+						},
+						"rescaled": {
+							"normalize": {
+								"buckets_path": "sum_bytes",
+								"method": "rescale_0_100"
+							}
+						},
+						"z_score": {
+							"normalize": {
+								"buckets_path": "sum_bytes",
+								"method": "z-score"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"bytes": {
+					"buckets": [
+						{
+							"key": 0.0,
+							"doc_count": 3,
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"percent_of_bytes": {
+								"value": 0.125
+							},
+							"rescaled": {
+								"value": 0.0
+							},
+							"z_score": {
+								"value": -1.0
+							}
+						},
+						{
+							"key": 100.0,
+							"doc_count": 2,
+							"sum_bytes": {
+								"value": 300.0
+							},
+							"percent_of_bytes": {
+								"value": 0.375
+							},
+							"rescaled": {
+								"value": 100.0
+							},
+							"z_score": {
+								"value": 1.0
+							}
+						},
+						{
+							"key": 200.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"percent_of_bytes": {
+								"value": 0.125
+							},
+							"rescaled": {
+								"value": 0.0
+							},
+							"z_score": {
+								"value": -1.0
+							}
+						},
+						{
+							"key": 300.0,
+							"doc_count": 1,
+							"sum_bytes": {
+								"value": 300.0
+							},
+							"percent_of_bytes": {
+								"value": 0.375
+							},
+							"rescaled": {
+								"value": 100.0
+							},
+							"z_score": {
+								"value": 1.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 0.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(3)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 100.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 100.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(2)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 300.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 200.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 100.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__bytes__key_0", 300.0),
+				model.NewQueryResultCol("aggr__bytes__count", int64(1)),
+				model.NewQueryResultCol("metric__bytes__sum_bytes_col_0", 300.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0",
+			  count(*) AS "aggr__bytes__count",
+			  sumOrNull("bytes_gauge") AS "metric__bytes__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY floor("bytes_gauge"/100)*100 AS "aggr__bytes__key_0"
+			ORDER BY "aggr__bytes__key_0" ASC`,
+	},
+	{ // [76]
+		TestName: "ip_range with from/to, mask and custom key, keyed",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"ip_ranges": {
+					"ip_range": {
+						"field": "clientip",
+						"ranges": [
+							{ "to": "10.0.0.5" },
+							{ "from": "10.0.0.5", "key": "upper" },
+							{ "mask": "10.0.0.0/25" },
+							{ "mask": "2001:db8::/32" }
+						],
+						"keyed": true
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"ip_ranges": {
+					"buckets": {
+						"*-10.0.0.5": {
+							"to": "10.0.0.5",
+							"doc_count": 10
+						},
+						"upper": {
+							"from": "10.0.0.5",
+							"doc_count": 260
+						},
+						"10.0.0.0/25": {
+							"from": "10.0.0.0",
+							"to": "10.0.0.128",
+							"doc_count": 128
+						},
+						"2001:db8::/32": {
+							"from": "2001:db8::",
+							"to": "2001:db9::",
+							"doc_count": 7
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("range_0__aggr__ip_ranges__count", int64(10)),
+				model.NewQueryResultCol("range_1__aggr__ip_ranges__count", int64(260)),
+				model.NewQueryResultCol("range_2__aggr__ip_ranges__count", int64(128)),
+				model.NewQueryResultCol("range_3__aggr__ip_ranges__count", int64(7)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf(toIPv6OrNull("clientip")<toIPv6('10.0.0.5')) AS
+			  "range_0__aggr__ip_ranges__count",
+			  countIf(toIPv6OrNull("clientip")>=toIPv6('10.0.0.5')) AS
+			  "range_1__aggr__ip_ranges__count",
+			  countIf(isIPAddressInRange("clientip", '10.0.0.0/25')) AS
+			  "range_2__aggr__ip_ranges__count",
+			  countIf(isIPAddressInRange("clientip", '2001:db8::/32')) AS
+			  "range_3__aggr__ip_ranges__count"
+			FROM __quesma_table_name`,
+	},
+	{ // [77]
+		TestName: "ip_prefix, IPv4 with append_prefix_length and a sub-aggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"ipv4-subnets": {
+					"ip_prefix": {
+						"field": "clientip",
+						"prefix_length": 24,
+						"append_prefix_length": true
+					},
+					"aggs": {
+						"avg_bytes": {
+							"avg": {
+								"field": "bytes"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"ipv4-subnets": {
+					"buckets": [
+						{
+							"key": "10.0.0.0/24",
+							"is_ipv6": false,
+							"prefix_length": 24,
+							"netmask": "255.255.255.0",
+							"doc_count": 3,
+							"avg_bytes": {
+								"value": 100.0
+							}
+						},
+						{
+							"key": "192.168.1.0/24",
+							"is_ipv6": false,
+							"prefix_length": 24,
+							"netmask": "255.255.255.0",
+							"doc_count": 2,
+							"avg_bytes": {
+								"value": 250.5
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__ipv4-subnets__key_0", uint32(167772160)),
+				model.NewQueryResultCol("aggr__ipv4-subnets__count", int64(3)),
+				model.NewQueryResultCol("metric__ipv4-subnets__avg_bytes_col_0", 100.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__ipv4-subnets__key_0", uint32(3232235776)),
+				model.NewQueryResultCol("aggr__ipv4-subnets__count", int64(2)),
+				model.NewQueryResultCol("metric__ipv4-subnets__avg_bytes_col_0", 250.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT bitAnd(toUInt32(toIPv4OrNull("clientip")), 4294967040) AS
+			  "aggr__ipv4-subnets__key_0", count(*) AS "aggr__ipv4-subnets__count",
+			  avgOrNull("bytes") AS "metric__ipv4-subnets__avg_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY bitAnd(toUInt32(toIPv4OrNull("clientip")), 4294967040) AS
+			  "aggr__ipv4-subnets__key_0"
+			ORDER BY "aggr__ipv4-subnets__key_0" ASC`,
+	},
+	{ // [78]
+		TestName: "ip_prefix, IPv6 keyed",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"ipv6-subnets": {
+					"ip_prefix": {
+						"field": "clientip",
+						"prefix_length": 64,
+						"is_ipv6": true,
+						"keyed": true
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"ipv6-subnets": {
+					"buckets": {
+						"2001:db8:a4f8:112a::": {
+							"is_ipv6": true,
+							"prefix_length": 64,
+							"doc_count": 2
+						},
+						"2001:db8:a4f8:112c::": {
+							"is_ipv6": true,
+							"prefix_length": 64,
+							"doc_count": 1
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__ipv6-subnets__key_0", "20010DB8A4F8112A0000000000000000"),
+				model.NewQueryResultCol("aggr__ipv6-subnets__count", int64(2)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__ipv6-subnets__key_0", "20010DB8A4F8112C0000000000000000"),
+				model.NewQueryResultCol("aggr__ipv6-subnets__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT hex(tupleElement(IPv6CIDRToRange(toIPv6OrNull("clientip"), 64), 1)) AS
+			  "aggr__ipv6-subnets__key_0", count(*) AS "aggr__ipv6-subnets__count"
+			FROM __quesma_table_name
+			GROUP BY hex(tupleElement(IPv6CIDRToRange(toIPv6OrNull("clientip"), 64), 1)) AS
+			  "aggr__ipv6-subnets__key_0"
+			ORDER BY "aggr__ipv6-subnets__key_0" ASC`,
+	},
+	{ // [79]
+		TestName: "geohash_grid with precision as distance, and geo_bounds",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"grid": {
+					"geohash_grid": {
+						"field": "OriginLocation",
+						"precision": "5km",
+						"size": 2
+					}
+				},
+				"viewport": {
+					"geo_bounds": {
+						"field": "OriginLocation"
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"grid": {
+					"buckets": [
+						{
+							"key": "u173zq",
+							"doc_count": 21
+						},
+						{
+							"key": "u09tvw",
+							"doc_count": 7
+						}
+					]
+				},
+				"viewport": {
+					"bounds": {
+						"top_left": {
+							"lat": 52.374081,
+							"lon": 2.352222
+						},
+						"bottom_right": {
+							"lat": 48.856613,
+							"lon": 4.909069
+						}
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__viewport_col_0", 52.374081),
+				model.NewQueryResultCol("metric__viewport_col_1", 48.856613),
+				model.NewQueryResultCol("metric__viewport_col_2", 2.352222),
+				model.NewQueryResultCol("metric__viewport_col_3", 4.909069),
+				model.NewQueryResultCol("metric__viewport_col_4", nil),
+				model.NewQueryResultCol("metric__viewport_col_5", nil),
+				model.NewQueryResultCol("aggr__grid__key_0", "u173zq"),
+				model.NewQueryResultCol("aggr__grid__count", int64(21)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__viewport_col_0", 52.374081),
+				model.NewQueryResultCol("metric__viewport_col_1", 48.856613),
+				model.NewQueryResultCol("metric__viewport_col_2", 2.352222),
+				model.NewQueryResultCol("metric__viewport_col_3", 4.909069),
+				model.NewQueryResultCol("metric__viewport_col_4", nil),
+				model.NewQueryResultCol("metric__viewport_col_5", nil),
+				model.NewQueryResultCol("aggr__grid__key_0", "u09tvw"),
+				model.NewQueryResultCol("aggr__grid__count", int64(7)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT maxOrNull(maxOrNull(toFloat64(__quesma_geo_lat("originlocation")))) OVER
+			  () AS "metric__viewport_col_0",
+			  minOrNull(minOrNull(toFloat64(__quesma_geo_lat("originlocation")))) OVER () AS
+			  "metric__viewport_col_1",
+			  minOrNull(minOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64
+			  (__quesma_geo_lon("originlocation"))>=0)) OVER () AS "metric__viewport_col_2",
+			  maxOrNull(maxOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64
+			  (__quesma_geo_lon("originlocation"))>=0)) OVER () AS "metric__viewport_col_3",
+			  minOrNull(minOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64
+			  (__quesma_geo_lon("originlocation"))<0)) OVER () AS "metric__viewport_col_4",
+			  maxOrNull(maxOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64
+			  (__quesma_geo_lon("originlocation"))<0)) OVER () AS "metric__viewport_col_5",
+			  geohashEncode(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lat("originlocation")), 6) AS "aggr__grid__key_0",
+			  count(*) AS "aggr__grid__count"
+			FROM __quesma_table_name
+			GROUP BY geohashEncode(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lat("originlocation")), 6) AS "aggr__grid__key_0"
+			ORDER BY "aggr__grid__count" DESC, "aggr__grid__key_0" ASC
+			LIMIT 3`,
+	},
+	{ // [80]
+		TestName: "geohex_grid with geo_bounds crossing the dateline",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"hexes": {
+					"geohex_grid": {
+						"field": "OriginLocation",
+						"precision": 2
+					},
+					"aggs": {
+						"bounds": {
+							"geo_bounds": {
+								"field": "OriginLocation"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"hexes": {
+					"buckets": [
+						{
+							"key": "82bb9ffffffffff",
+							"doc_count": 3,
+							"bounds": {
+								"bounds": {
+									"top_left": {
+										"lat": -16.5,
+										"lon": 177.5
+									},
+									"bottom_right": {
+										"lat": -18.1,
+										"lon": -179.2
+									}
+								}
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__hexes__key_0", "82bb9ffffffffff"),
+				model.NewQueryResultCol("aggr__hexes__count", int64(3)),
+				model.NewQueryResultCol("metric__hexes__bounds_col_0", -16.5),
+				model.NewQueryResultCol("metric__hexes__bounds_col_1", -18.1),
+				model.NewQueryResultCol("metric__hexes__bounds_col_2", 177.5),
+				model.NewQueryResultCol("metric__hexes__bounds_col_3", 178.4),
+				model.NewQueryResultCol("metric__hexes__bounds_col_4", -179.9),
+				model.NewQueryResultCol("metric__hexes__bounds_col_5", -179.2),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT h3ToString(geoToH3(toFloat64(__quesma_geo_lon("originlocation")),
+			  toFloat64(__quesma_geo_lat("originlocation")), 2)) AS "aggr__hexes__key_0",
+			  count(*) AS "aggr__hexes__count",
+			  maxOrNull(toFloat64(__quesma_geo_lat("originlocation"))) AS
+			  "metric__hexes__bounds_col_0",
+			  minOrNull(toFloat64(__quesma_geo_lat("originlocation"))) AS
+			  "metric__hexes__bounds_col_1",
+			  minOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lon("originlocation"))>=0) AS "metric__hexes__bounds_col_2",
+			  maxOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lon("originlocation"))>=0) AS "metric__hexes__bounds_col_3",
+			  minOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lon("originlocation"))<0) AS "metric__hexes__bounds_col_4",
+			  maxOrNullIf(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lon("originlocation"))<0) AS "metric__hexes__bounds_col_5"
+			FROM __quesma_table_name
+			GROUP BY h3ToString(geoToH3(toFloat64(__quesma_geo_lon("originlocation")),
+			  toFloat64(__quesma_geo_lat("originlocation")), 2)) AS "aggr__hexes__key_0"
+			ORDER BY "aggr__hexes__count" DESC, "aggr__hexes__key_0" ASC
+			LIMIT 10001`,
+	},
+	{ // [81]
+		TestName: "geo_distance aggregation (distance rings) with origin in WKT and unit in km",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"rings": {
+					"geo_distance": {
+						"field": "OriginLocation",
+						"origin": "POINT (4.894 52.3760)",
+						"unit": "km",
+						"ranges": [
+							{ "to": 100 },
+							{ "from": 100, "to": 300 },
+							{ "from": 300 }
+						]
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"rings": {
+					"buckets": [
+						{
+							"key": "*-100.0",
+							"from": 0.0,
+							"to": 100.0,
+							"doc_count": 3
+						},
+						{
+							"key": "100.0-300.0",
+							"from": 100.0,
+							"to": 300.0,
+							"doc_count": 1
+						},
+						{
+							"key": "300.0-*",
+							"from": 300.0,
+							"doc_count": 7
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("range_0__aggr__rings__count", int64(3)),
+				model.NewQueryResultCol("range_1__aggr__rings__count", int64(1)),
+				model.NewQueryResultCol("range_2__aggr__rings__count", int64(7)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf(geoDistance(toFloat64(__quesma_geo_lon("originlocation")),
+			  toFloat64(__quesma_geo_lat("originlocation")), 4.894, 52.376)/1000<100) AS
+			  "range_0__aggr__rings__count",
+			  countIf((geoDistance(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lat("originlocation")), 4.894, 52.376)/1000>=100 AND geoDistance(
+			  toFloat64(__quesma_geo_lon("originlocation")), toFloat64(__quesma_geo_lat(
+			  "originlocation")), 4.894, 52.376)/1000<300)) AS
+			  "range_1__aggr__rings__count",
+			  countIf(geoDistance(toFloat64(__quesma_geo_lon("originlocation")), toFloat64(
+			  __quesma_geo_lat("originlocation")), 4.894, 52.376)/1000>=300) AS
+			  "range_2__aggr__rings__count"
+			FROM __quesma_table_name`,
+	},
+	{ // [82]
+		TestName: "boxplot, median_absolute_deviation and weighted_avg with missing weight",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"grade_boxplot": {
+					"boxplot": {
+						"field": "grade"
+					}
+				},
+				"grade_mad": {
+					"median_absolute_deviation": {
+						"field": "grade"
+					}
+				},
+				"weighted_grade": {
+					"weighted_avg": {
+						"value": {
+							"field": "grade"
+						},
+						"weight": {
+							"field": "weight",
+							"missing": 1
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"grade_boxplot": {
+					"min": 1.0,
+					"max": 10.0,
+					"q1": 2.0,
+					"q2": 4.0,
+					"q3": 6.0,
+					"lower": 1.0,
+					"upper": 10.0
+				},
+				"grade_mad": {
+					"value": 2.0
+				},
+				"weighted_grade": {
+					"value": 4.5
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__grade_boxplot_col_0", 1.0),
+				model.NewQueryResultCol("metric__grade_boxplot_col_1", 10.0),
+				model.NewQueryResultCol("metric__grade_boxplot_col_2", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__grade_mad_col_0", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__weighted_grade_col_0", 4.5),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT minOrNull("grade") AS "metric__grade_boxplot_col_0",
+			  maxOrNull("grade") AS "metric__grade_boxplot_col_1",
+			  quantilesTDigest(` + digestLevels() + `)("grade") AS "metric__grade_boxplot_col_2",
+			  quantilesTDigest(` + digestLevels() + `)("grade") AS "metric__grade_mad_col_0",
+			  avgWeightedOrNull("grade", COALESCE("weight", 1)) AS
+			  "metric__weighted_grade_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [83]
+		TestName: "string_stats with distribution",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"message_stats": {
+					"string_stats": {
+						"field": "message",
+						"show_distribution": true
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"message_stats": {
+					"count": 2,
+					"min_length": 2,
+					"max_length": 3,
+					"avg_length": 2.5,
+					"entropy": 0.9709505944546686,
+					"distribution": {
+						"a": 0.6,
+						"b": 0.4
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__message_stats_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__message_stats_col_1", uint64(2)),
+				model.NewQueryResultCol("metric__message_stats_col_2", uint64(3)),
+				model.NewQueryResultCol("metric__message_stats_col_3", 2.5),
+				model.NewQueryResultCol("metric__message_stats_col_4", []any{[]string{"a", "b"}, []uint64{3, 2}}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT count("message") AS "metric__message_stats_col_0",
+			  minOrNull(lengthUTF8("message")) AS "metric__message_stats_col_1",
+			  maxOrNull(lengthUTF8("message")) AS "metric__message_stats_col_2",
+			  avgOrNull(lengthUTF8("message")) AS "metric__message_stats_col_3",
+			  sumMap(ngrams(COALESCE("message", ''), 1), arrayWithConstant(lengthUTF8(
+			  COALESCE("message", '')), 1)) AS "metric__message_stats_col_4"
+			FROM __quesma_table_name`,
+	},
+	{ // [84]
+		TestName: "rate: per year over monthly buckets, and sum of field per day",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"by_month": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"calendar_interval": "month"
+					},
+					"aggs": {
+						"sales_per_year": {
+							"rate": {
+								"unit": "year"
+							}
+						},
+						"price_per_day": {
+							"rate": {
+								"field": "price",
+								"unit": "day"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"by_month": {
+					"buckets": [
+						{
+							"key": 1706745600000,
+							"key_as_string": "2024-02-01T00:00:00.000",
+							"doc_count": 3,
+							"sales_per_year": {
+								"value": 36.0
+							},
+							"price_per_day": {
+								"value": 10.0
+							}
+						},
+						{
+							"key": 1709251200000,
+							"key_as_string": "2024-03-01T00:00:00.000",
+							"doc_count": 1,
+							"sales_per_year": {
+								"value": 12.0
+							},
+							"price_per_day": {
+								"value": 1.0
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_month__key_0", int64(1706745600000)),
+				model.NewQueryResultCol("aggr__by_month__count", int64(3)),
+				model.NewQueryResultCol("metric__by_month__price_per_day_col_0", 290.0),
+				model.NewQueryResultCol("metric__by_month__price_per_day_col_1", time.UnixMilli(1707132000000).UTC()),
+				model.NewQueryResultCol("metric__by_month__sales_per_year_col_0", int64(3)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_month__key_0", int64(1709251200000)),
+				model.NewQueryResultCol("aggr__by_month__count", int64(1)),
+				model.NewQueryResultCol("metric__by_month__price_per_day_col_0", 31.0),
+				model.NewQueryResultCol("metric__by_month__price_per_day_col_1", time.UnixMilli(1709251200000).UTC()),
+				model.NewQueryResultCol("metric__by_month__sales_per_year_col_0", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp(toStartOfMonth(toTimezone("@timestamp", 'UTC'))))
+			  *1000 AS "aggr__by_month__key_0", count(*) AS "aggr__by_month__count",
+			  sumOrNull("price") AS "metric__by_month__price_per_day_col_0",
+			  minOrNull("@timestamp") AS "metric__by_month__price_per_day_col_1",
+			  count(*) AS "metric__by_month__sales_per_year_col_0"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp(toStartOfMonth(toTimezone("@timestamp", 'UTC'))
+			  ))*1000 AS "aggr__by_month__key_0"
+			ORDER BY "aggr__by_month__key_0" ASC`,
+	},
+	{ // [85]
+		TestName: "rare_terms with max_doc_count and a subaggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"genres": {
+					"rare_terms": {
+						"field": "genre",
+						"max_doc_count": 2
+					},
+					"aggs": {
+						"avg_price": {
+							"avg": {
+								"field": "price"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"genres": {
+					"buckets": [
+						{
+							"key": "jazz",
+							"doc_count": 1,
+							"avg_price": {
+								"value": 10.0
+							}
+						},
+						{
+							"key": "blues",
+							"doc_count": 2,
+							"avg_price": {
+								"value": 15.5
+							}
+						},
+						{
+							"key": "swing",
+							"doc_count": 2,
+							"avg_price": {
+								"value": null
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__genres__key_0", "jazz"),
+				model.NewQueryResultCol("aggr__genres__count", int64(1)),
+				model.NewQueryResultCol("metric__genres__avg_price_col_0", 10.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__genres__key_0", "blues"),
+				model.NewQueryResultCol("aggr__genres__count", int64(2)),
+				model.NewQueryResultCol("metric__genres__avg_price_col_0", 15.5),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__genres__key_0", "swing"),
+				model.NewQueryResultCol("aggr__genres__count", int64(2)),
+				model.NewQueryResultCol("metric__genres__avg_price_col_0", nil),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "genre" AS "aggr__genres__key_0", count(*) AS "aggr__genres__count",
+			  avgOrNull("price") AS "metric__genres__avg_price_col_0"
+			FROM __quesma_table_name
+			GROUP BY "genre" AS "aggr__genres__key_0" HAVING "aggr__genres__count"<=2
+			ORDER BY "aggr__genres__count" ASC, "aggr__genres__key_0" ASC`,
+	},
+	{ // [86]
+		TestName: "missing with a subaggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"products_without_a_price": {
+					"missing": {
+						"field": "price"
+					},
+					"aggs": {
+						"max_stock": {
+							"max": {
+								"field": "stock"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"products_without_a_price": {
+					"doc_count": 7,
+					"max_stock": {
+						"value": 40.0
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__products_without_a_price__count", int64(7)),
+				model.NewQueryResultCol("metric__products_without_a_price__max_stock_col_0", 40.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf("price" IS NULL) AS "aggr__products_without_a_price__count",
+			  maxOrNullIf("stock", "price" IS NULL) AS
+			  "metric__products_without_a_price__max_stock_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [87]
+		TestName: "adjacency_matrix: empty intersections are omitted",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"interactions": {
+					"adjacency_matrix": {
+						"filters": {
+							"grpA": { "terms": { "accounts": ["hillary", "sidney"] } },
+							"grpB": { "terms": { "accounts": ["donald", "mitt"] } },
+							"grpC": { "terms": { "accounts": ["vladimir", "nigel"] } }
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"interactions": {
+					"buckets": [
+						{
+							"key": "grpA",
+							"doc_count": 2
+						},
+						{
+							"key": "grpA&grpB",
+							"doc_count": 1
+						},
+						{
+							"key": "grpB",
+							"doc_count": 2
+						},
+						{
+							"key": "grpB&grpC",
+							"doc_count": 1
+						},
+						{
+							"key": "grpC",
+							"doc_count": 1
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("filter_0__aggr__interactions__count", int64(2)),
+				model.NewQueryResultCol("filter_1__aggr__interactions__count", int64(1)),
+				model.NewQueryResultCol("filter_2__aggr__interactions__count", int64(0)),
+				model.NewQueryResultCol("filter_3__aggr__interactions__count", int64(2)),
+				model.NewQueryResultCol("filter_4__aggr__interactions__count", int64(1)),
+				model.NewQueryResultCol("filter_5__aggr__interactions__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT countIf("accounts" IN ('hillary', 'sidney')) AS
+			  "filter_0__aggr__interactions__count",
+			  countIf(("accounts" IN ('hillary', 'sidney') AND "accounts" IN ('donald',
+			  'mitt'))) AS "filter_1__aggr__interactions__count",
+			  countIf(("accounts" IN ('hillary', 'sidney') AND "accounts" IN ('vladimir',
+			  'nigel'))) AS "filter_2__aggr__interactions__count",
+			  countIf("accounts" IN ('donald', 'mitt')) AS
+			  "filter_3__aggr__interactions__count",
+			  countIf(("accounts" IN ('donald', 'mitt') AND "accounts" IN ('vladimir',
+			  'nigel'))) AS "filter_4__aggr__interactions__count",
+			  countIf("accounts" IN ('vladimir', 'nigel')) AS
+			  "filter_5__aggr__interactions__count"
+			FROM __quesma_table_name`,
+	},
+	{ // [88]
+		TestName: "global ignores the query, its sibling metric doesn't",
+		QueryRequestJson: `
+		{
+			"query": {
+				"term": {
+					"type": "t-shirt"
+				}
+			},
+			"aggs": {
+				"all_products": {
+					"global": {},
+					"aggs": {
+						"avg_price": {
+							"avg": {
+								"field": "price"
+							}
+						}
+					}
+				},
+				"t_shirts": {
+					"avg": {
+						"field": "price"
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"all_products": {
+					"doc_count": 7,
+					"avg_price": {
+						"value": 140.71428571428572
+					}
+				},
+				"t_shirts": {
+					"value": 128.33333333333334
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__t_shirts_col_0", 128.33333333333334),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT avgOrNull("price") AS "metric__t_shirts_col_0"
+			FROM __quesma_table_name
+			WHERE "type"='t-shirt'`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT count(*) AS "aggr__all_products__count",
+			  avgOrNull("price") AS "metric__all_products__avg_price_col_0"
+			FROM __quesma_table_name`,
+		},
+		ExpectedAdditionalPancakeResults: [][]model.QueryResultRow{
+			{
+				{Cols: []model.QueryResultCol{
+					model.NewQueryResultCol("aggr__all_products__count", int64(7)),
+					model.NewQueryResultCol("metric__all_products__avg_price_col_0", 140.71428571428572),
+				}},
+			},
+		},
+	},
+	{ // [89]
+		TestName: "rare_terms with terms subaggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"rare_hosts": {
+					"rare_terms": {
+						"field": "host"
+					},
+					"aggs": {
+						"users": {
+							"terms": {
+								"field": "user",
+								"size": 3
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"rare_hosts": {
+					"buckets": [
+						{
+							"key": "host-7",
+							"doc_count": 1,
+							"users": {
+								"doc_count_error_upper_bound": 0,
+								"sum_other_doc_count": 0,
+								"buckets": [
+									{
+										"key": "root",
+										"doc_count": 1
+									}
+								]
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__rare_hosts__key_0", "host-7"),
+				model.NewQueryResultCol("aggr__rare_hosts__count", int64(1)),
+				model.NewQueryResultCol("aggr__rare_hosts__users__parent_count", int64(1)),
+				model.NewQueryResultCol("aggr__rare_hosts__users__key_0", "root"),
+				model.NewQueryResultCol("aggr__rare_hosts__users__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "aggr__rare_hosts__key_0", "aggr__rare_hosts__count",
+			  "aggr__rare_hosts__users__parent_count", "aggr__rare_hosts__users__key_0",
+			  "aggr__rare_hosts__users__count"
+			FROM (
+			  SELECT "aggr__rare_hosts__key_0", "aggr__rare_hosts__count",
+			    "aggr__rare_hosts__users__parent_count", "aggr__rare_hosts__users__key_0",
+			    "aggr__rare_hosts__users__count",
+			    dense_rank() OVER (ORDER BY "aggr__rare_hosts__count" ASC,
+			    "aggr__rare_hosts__key_0" ASC) AS "aggr__rare_hosts__order_1_rank",
+			    dense_rank() OVER (PARTITION BY "aggr__rare_hosts__key_0" ORDER BY
+			    "aggr__rare_hosts__users__count" DESC, "aggr__rare_hosts__users__key_0" ASC)
+			    AS "aggr__rare_hosts__users__order_1_rank"
+			  FROM (
+			    SELECT "host" AS "aggr__rare_hosts__key_0",
+			      sum(count(*)) OVER (PARTITION BY "aggr__rare_hosts__key_0") AS
+			      "aggr__rare_hosts__count",
+			      sum(count(*)) OVER (PARTITION BY "aggr__rare_hosts__key_0") AS
+			      "aggr__rare_hosts__users__parent_count",
+			      "user" AS "aggr__rare_hosts__users__key_0",
+			      count(*) AS "aggr__rare_hosts__users__count"
+			    FROM __quesma_table_name
+			    GROUP BY "host" AS "aggr__rare_hosts__key_0",
+			      "user" AS "aggr__rare_hosts__users__key_0"))
+			WHERE ("aggr__rare_hosts__users__order_1_rank"<=4 AND "aggr__rare_hosts__count"
+			  <=1)
+			ORDER BY "aggr__rare_hosts__order_1_rank" ASC,
+			  "aggr__rare_hosts__users__order_1_rank" ASC`,
+	},
+	{ // [90]
+		TestName: "nested aggregation with metric and terms subaggregations",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"resellers": {
+					"nested": {
+						"path": "resellers"
+					},
+					"aggs": {
+						"min_price": {
+							"min": {
+								"field": "resellers.price"
+							}
+						},
+						"top_resellers": {
+							"terms": {
+								"field": "resellers.name",
+								"size": 2
+							}
+						}
+					}
+				}
+			},
+			"query": {
+				"term": {
+					"name": "led tv"
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"resellers": {
+					"doc_count": 5,
+					"min_price": {
+						"value": 350.0
+					},
+					"top_resellers": {
+						"doc_count_error_upper_bound": 0,
+						"sum_other_doc_count": 1,
+						"buckets": [
+							{
+								"key": "companyA",
+								"doc_count": 3
+							},
+							{
+								"key": "companyB",
+								"doc_count": 1
+							}
+						]
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__resellers__count", int64(5)),
+				model.NewQueryResultCol("metric__resellers__min_price_col_0", 350.0),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__parent_count", int64(5)),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__key_0", "companyA"),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__count", int64(3)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__resellers__count", int64(5)),
+				model.NewQueryResultCol("metric__resellers__min_price_col_0", 350.0),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__parent_count", int64(5)),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__key_0", "companyB"),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__resellers__count",
+			  minOrNull(minOrNull(tupleElement("nested__resellers", 1))) OVER () AS
+			  "metric__resellers__min_price_col_0",
+			  sum(count(*)) OVER () AS "aggr__resellers__top_resellers__parent_count",
+			  tupleElement("nested__resellers", 2) AS
+			  "aggr__resellers__top_resellers__key_0",
+			  count(*) AS "aggr__resellers__top_resellers__count"
+			FROM __quesma_table_name ARRAY JOIN arrayZip(arrayResize("resellers.price",
+			  greatest(length("resellers.price"), length("resellers.name")), NULL),
+			  arrayResize("resellers.name", greatest(length("resellers.price"), length(
+			  "resellers.name")), NULL)) AS "nested__resellers"
+			WHERE "name"='led tv'
+			GROUP BY tupleElement("nested__resellers", 2) AS
+			  "aggr__resellers__top_resellers__key_0"
+			ORDER BY "aggr__resellers__top_resellers__count" DESC,
+			  "aggr__resellers__top_resellers__key_0" ASC
+			LIMIT 3`,
+	},
+	{ // [91]
+		TestName: "reverse_nested inside nested aggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"comments": {
+					"nested": {
+						"path": "comments"
+					},
+					"aggs": {
+						"users": {
+							"terms": {
+								"field": "comments.username",
+								"size": 2
+							},
+							"aggs": {
+								"issues": {
+									"reverse_nested": {},
+									"aggs": {
+										"tags": {
+											"terms": {
+												"field": "tags",
+												"size": 2
+											}
+										}
+									}
+								}
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"comments": {
+					"doc_count": 4,
+					"users": {
+						"doc_count_error_upper_bound": 0,
+						"sum_other_doc_count": 0,
+						"buckets": [
+							{
+								"key": "alice",
+								"doc_count": 3,
+								"issues": {
+									"doc_count": 2,
+									"tags": {
+										"doc_count_error_upper_bound": 0,
+										"sum_other_doc_count": 0,
+										"buckets": [
+											{
+												"key": "bug",
+												"doc_count": 1
+											},
+											{
+												"key": "ui",
+												"doc_count": 1
+											}
+										]
+									}
+								}
+							},
+							{
+								"key": "bob",
+								"doc_count": 1,
+								"issues": {
+									"doc_count": 1,
+									"tags": {
+										"doc_count_error_upper_bound": 0,
+										"sum_other_doc_count": 0,
+										"buckets": [
+											{
+												"key": "bug",
+												"doc_count": 1
+											}
+										]
+									}
+								}
+							}
+						]
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__comments__count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__parent_count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__key_0", "alice"),
+				model.NewQueryResultCol("aggr__comments__users__count", int64(3)),
+				model.NewQueryResultCol("aggr__comments__users__issues__count", int64(2)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__parent_count", int64(2)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__key_0", "bug"),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__count", int64(1)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__comments__count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__parent_count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__key_0", "alice"),
+				model.NewQueryResultCol("aggr__comments__users__count", int64(3)),
+				model.NewQueryResultCol("aggr__comments__users__issues__count", int64(2)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__parent_count", int64(2)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__key_0", "ui"),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__count", int64(1)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__comments__count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__parent_count", int64(4)),
+				model.NewQueryResultCol("aggr__comments__users__key_0", "bob"),
+				model.NewQueryResultCol("aggr__comments__users__count", int64(1)),
+				model.NewQueryResultCol("aggr__comments__users__issues__count", int64(1)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__parent_count", int64(1)),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__key_0", "bug"),
+				model.NewQueryResultCol("aggr__comments__users__issues__tags__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "aggr__comments__count", "aggr__comments__users__parent_count",
+			  "aggr__comments__users__key_0", "aggr__comments__users__count",
+			  "aggr__comments__users__issues__count",
+			  "aggr__comments__users__issues__tags__parent_count",
+			  "aggr__comments__users__issues__tags__key_0",
+			  "aggr__comments__users__issues__tags__count"
+			FROM (
+			  SELECT "aggr__comments__count", "aggr__comments__users__parent_count",
+			    "aggr__comments__users__key_0", "aggr__comments__users__count",
+			    "aggr__comments__users__issues__count",
+			    "aggr__comments__users__issues__tags__parent_count",
+			    "aggr__comments__users__issues__tags__key_0",
+			    "aggr__comments__users__issues__tags__count",
+			    dense_rank() OVER (ORDER BY "aggr__comments__users__count" DESC,
+			    "aggr__comments__users__key_0" ASC) AS "aggr__comments__users__order_1_rank"
+			    ,
+			    dense_rank() OVER (PARTITION BY "aggr__comments__users__key_0" ORDER BY
+			    "aggr__comments__users__issues__tags__count" DESC,
+			    "aggr__comments__users__issues__tags__key_0" ASC) AS
+			    "aggr__comments__users__issues__tags__order_1_rank"
+			  FROM (
+			    SELECT sum(count(*)) OVER () AS "aggr__comments__count",
+			      sum(count(*)) OVER () AS "aggr__comments__users__parent_count",
+			      "nested__comments.username" AS "aggr__comments__users__key_0",
+			      sum(count(*)) OVER (PARTITION BY "aggr__comments__users__key_0") AS
+			      "aggr__comments__users__count",
+			      uniqExactMerge(uniqExactState(tuple(_part, _part_offset))) OVER (PARTITION
+			      BY "aggr__comments__users__key_0") AS
+			      "aggr__comments__users__issues__count",
+			      uniqExactMerge(uniqExactState(tuple(_part, _part_offset))) OVER (PARTITION
+			      BY "aggr__comments__users__key_0") AS
+			      "aggr__comments__users__issues__tags__parent_count",
+			      "tags" AS "aggr__comments__users__issues__tags__key_0",
+			      uniqExact(tuple(_part, _part_offset)) AS
+			      "aggr__comments__users__issues__tags__count"
+			    FROM __quesma_table_name ARRAY JOIN "comments.username" AS
+			      "nested__comments.username"
+			    GROUP BY "nested__comments.username" AS "aggr__comments__users__key_0",
+			      "tags" AS "aggr__comments__users__issues__tags__key_0"))
+			WHERE ("aggr__comments__users__order_1_rank"<=3 AND
+			  "aggr__comments__users__issues__tags__order_1_rank"<=3)
+			ORDER BY "aggr__comments__users__order_1_rank" ASC,
+			  "aggr__comments__users__issues__tags__order_1_rank" ASC`,
+	}, { // [92]
+		TestName: "histogram with offset and extended_bounds",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"prices": {
+					"histogram": {
+						"field": "price",
+						"interval": 10,
+						"offset": 5,
+						"min_doc_count": 0,
+						"extended_bounds": {
+							"min": 0,
+							"max": 50
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": true
+		}`,
+		ExpectedResponse: `
+		{
+			"completion_time_in_millis": 1707486436398,
+			"expiration_time_in_millis": 1707486496397,
+			"is_partial": false,
+			"is_running": false,
+			"response": {
+				"_shards": {
+					"failed": 0,
+					"skipped": 0,
+					"successful": 1,
+					"total": 1
+				},
+				"aggregations": {
+					"prices": {
+						"buckets": [
+							{
+								"key": -5.0,
+								"doc_count": 0
+							},
+							{
+								"key": 5.0,
+								"doc_count": 0
+							},
+							{
+								"key": 15.0,
+								"doc_count": 2
+							},
+							{
+								"key": 25.0,
+								"doc_count": 0
+							},
+							{
+								"key": 35.0,
+								"doc_count": 1
+							},
+							{
+								"key": 45.0,
+								"doc_count": 0
+							}
+						]
+					}
+				},
+				"hits": {
+					"hits": [],
+					"max_score": null,
+					"total": {
+						"relation": "eq",
+						"value": 3
+					}
+				},
+				"timed_out": false,
+				"took": 1
+			},
+			"start_time_in_millis": 1707486436397
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", 15.0),
+				model.NewQueryResultCol("aggr__prices__count", int64(2)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", 35.0),
+				model.NewQueryResultCol("aggr__prices__count", int64(1)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT floor(("price"-5)/10)*10+5 AS "aggr__prices__key_0",
+			  count(*) AS "aggr__prices__count"
+			FROM __quesma_table_name
+			GROUP BY floor(("price"-5)/10)*10+5 AS "aggr__prices__key_0"
+			ORDER BY "aggr__prices__key_0" ASC`,
+	},
+	{ // [93]
+		TestName: "histogram with hard_bounds and min_doc_count",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"prices": {
+					"histogram": {
+						"field": "price",
+						"interval": 10,
+						"min_doc_count": 2,
+						"hard_bounds": {
+							"min": 10,
+							"max": 30
+						}
+					},
+					"aggs": {
+						"avg_quantity": {
+							"avg": {
+								"field": "quantity"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": true
+		}`,
+		ExpectedResponse: `
+		{
+			"completion_time_in_millis": 1707486436398,
+			"expiration_time_in_millis": 1707486496397,
+			"is_partial": false,
+			"is_running": false,
+			"response": {
+				"_shards": {
+					"failed": 0,
+					"skipped": 0,
+					"successful": 1,
+					"total": 1
+				},
+				"aggregations": {
+					"prices": {
+						"buckets": [
+							{
+								"key": 10.0,
+								"doc_count": 3,
+								"avg_quantity": {
+									"value": 5.0
+								}
+							},
+							{
+								"key": 30.0,
+								"doc_count": 2,
+								"avg_quantity": {
+									"value": 7.0
+								}
+							}
+						]
+					}
+				},
+				"hits": {
+					"hits": [],
+					"max_score": null,
+					"total": {
+						"relation": "eq",
+						"value": 10
+					}
+				},
+				"timed_out": false,
+				"took": 1
+			},
+			"start_time_in_millis": 1707486436397
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", 10.0),
+				model.NewQueryResultCol("aggr__prices__count", int64(3)),
+				model.NewQueryResultCol("metric__prices__avg_quantity_col_0", 5.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", 20.0),
+				model.NewQueryResultCol("aggr__prices__count", int64(1)),
+				model.NewQueryResultCol("metric__prices__avg_quantity_col_0", 2.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", 30.0),
+				model.NewQueryResultCol("aggr__prices__count", int64(2)),
+				model.NewQueryResultCol("metric__prices__avg_quantity_col_0", 7.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__prices__key_0", nil),
+				model.NewQueryResultCol("aggr__prices__count", int64(4)),
+				model.NewQueryResultCol("metric__prices__avg_quantity_col_0", 1.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT if((floor("price"/10)*10>=10 AND floor("price"/10)*10<=30), floor("price"
+			  /10)*10, NULL) AS "aggr__prices__key_0", count(*) AS "aggr__prices__count",
+			  avgOrNull("quantity") AS "metric__prices__avg_quantity_col_0"
+			FROM __quesma_table_name
+			GROUP BY if((floor("price"/10)*10>=10 AND floor("price"/10)*10<=30), floor(
+			  "price"/10)*10, NULL) AS "aggr__prices__key_0"
+			ORDER BY "aggr__prices__key_0" ASC`,
+	},
+	{ // [94]
+		TestName: "variable_width_histogram",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"prices": {
+					"variable_width_histogram": {
+						"field": "price",
+						"buckets": 3
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": true
+		}`,
+		ExpectedResponse: `
+		{
+			"completion_time_in_millis": 1707486436398,
+			"expiration_time_in_millis": 1707486496397,
+			"is_partial": false,
+			"is_running": false,
+			"response": {
+				"_shards": {
+					"failed": 0,
+					"skipped": 0,
+					"successful": 1,
+					"total": 1
+				},
+				"aggregations": {
+					"prices": {
+						"buckets": [
+							{
+								"min": 1.0,
+								"key": 2.0,
+								"max": 3.0,
+								"doc_count": 2
+							},
+							{
+								"min": 3.0,
+								"key": 6.5,
+								"max": 10.0,
+								"doc_count": 5
+							},
+							{
+								"min": 10.0,
+								"key": 15.0,
+								"max": 20.0,
+								"doc_count": 1
+							}
+						]
+					}
+				},
+				"hits": {
+					"hits": [],
+					"max_score": null,
+					"total": {
+						"relation": "eq",
+						"value": 8
+					}
+				},
+				"timed_out": false,
+				"took": 1
+			},
+			"start_time_in_millis": 1707486436397
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("metric__prices_col_0", [][]any{{1.0, 3.0, 2.0}, {3.0, 10.0, 4.7}, {10.0, 20.0, 1.0}}),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT histogram(3)("price") AS "metric__prices_col_0"
+			FROM __quesma_table_name`,
+	},
+	{ // [95]
+		TestName: "date_histogram with calendar_interval month, time_zone, offset, format and extended_bounds across DST",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"monthly": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"calendar_interval": "month",
+						"time_zone": "Europe/Warsaw",
+						"offset": "+6h",
+						"format": "yyyy-MM-dd HH:mm",
+						"min_doc_count": 0,
+						"extended_bounds": {
+							"min": 1703030400000,
+							"max": 1717977600000
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": true
+		}`,
+		ExpectedResponse: `
+		{
+			"completion_time_in_millis": 1707486436398,
+			"expiration_time_in_millis": 1707486496397,
+			"is_partial": false,
+			"is_running": false,
+			"response": {
+				"_shards": {
+					"failed": 0,
+					"skipped": 0,
+					"successful": 1,
+					"total": 1
+				},
+				"aggregations": {
+					"monthly": {
+						"buckets": [
+							{
+								"key_as_string": "2024-01-01 06:00",
+								"key": 1704085200000,
+								"doc_count": 0
+							},
+							{
+								"key_as_string": "2024-02-01 06:00",
+								"key": 1706763600000,
+								"doc_count": 10
+							},
+							{
+								"key_as_string": "2024-03-01 06:00",
+								"key": 1709269200000,
+								"doc_count": 0
+							},
+							{
+								"key_as_string": "2024-04-01 06:00",
+								"key": 1711944000000,
+								"doc_count": 0
+							},
+							{
+								"key_as_string": "2024-05-01 06:00",
+								"key": 1714536000000,
+								"doc_count": 5
+							},
+							{
+								"key_as_string": "2024-06-01 06:00",
+								"key": 1717214400000,
+								"doc_count": 0
+							}
+						]
+					}
+				},
+				"hits": {
+					"hits": [],
+					"max_score": null,
+					"total": {
+						"relation": "eq",
+						"value": 15
+					}
+				},
+				"timed_out": false,
+				"took": 1
+			},
+			"start_time_in_millis": 1707486436397
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__monthly__key_0", int64(1706767200000)),
+				model.NewQueryResultCol("aggr__monthly__count", int64(10)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__monthly__key_0", int64(1714543200000)),
+				model.NewQueryResultCol("aggr__monthly__count", int64(5)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp(toStartOfMonth(toTimezone(subtractSeconds(
+			  "@timestamp", 21600), 'Europe/Warsaw'))))*1000+21600000 AS
+			  "aggr__monthly__key_0", count(*) AS "aggr__monthly__count"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp(toStartOfMonth(toTimezone(subtractSeconds(
+			  "@timestamp", 21600), 'Europe/Warsaw'))))*1000+21600000 AS
+			  "aggr__monthly__key_0"
+			ORDER BY "aggr__monthly__key_0" ASC`,
+	},
+	{ // [96]
+		TestName: "date_histogram with calendar_interval week and offset, gap filled across DST change",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"weekly": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"calendar_interval": "week",
+						"time_zone": "Europe/Warsaw",
+						"offset": "-1d",
+						"min_doc_count": 0
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": true
+		}`,
+		ExpectedResponse: `
+		{
+			"completion_time_in_millis": 1707486436398,
+			"expiration_time_in_millis": 1707486496397,
+			"is_partial": false,
+			"is_running": false,
+			"response": {
+				"_shards": {
+					"failed": 0,
+					"skipped": 0,
+					"successful": 1,
+					"total": 1
+				},
+				"aggregations": {
+					"weekly": {
+						"buckets": [
+							{
+								"key_as_string": "2024-03-24T00:00:00.000+01:00",
+								"key": 1711234800000,
+								"doc_count": 3
+							},
+							{
+								"key_as_string": "2024-03-31T00:00:00.000+01:00",
+								"key": 1711839600000,
+								"doc_count": 0
+							},
+							{
+								"key_as_string": "2024-04-07T00:00:00.000+02:00",
+								"key": 1712440800000,
+								"doc_count": 4
+							}
+						]
+					}
+				},
+				"hits": {
+					"hits": [],
+					"max_score": null,
+					"total": {
+						"relation": "eq",
+						"value": 7
+					}
+				},
+				"timed_out": false,
+				"took": 1
+			},
+			"start_time_in_millis": 1707486436397
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__weekly__key_0", int64(1711238400000)),
+				model.NewQueryResultCol("aggr__weekly__count", int64(3)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__weekly__key_0", int64(1712448000000)),
+				model.NewQueryResultCol("aggr__weekly__count", int64(4)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp(toStartOfWeek(toTimezone(addSeconds(
+			  "@timestamp", 86400), 'Europe/Warsaw'), 1)))*1000-86400000 AS
+			  "aggr__weekly__key_0", count(*) AS "aggr__weekly__count"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone(addSeconds(
+			  "@timestamp", 86400), 'Europe/Warsaw'), 1)))*1000-86400000 AS
+			  "aggr__weekly__key_0"
+			ORDER BY "aggr__weekly__key_0" ASC`,
+	},
+	{ // [97]
+		TestName: "max_bucket over derivative with unit",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"by_day": {
+					"date_histogram": {
+						"field": "@timestamp",
+						"fixed_interval": "1d"
+					},
+					"aggs": {
+						"sum_bytes": {
+							"sum": {
+								"field": "bytes_gauge"
+							}
+						},
+						"bytes_per_hour": {
+							"derivative": {
+								"buckets_path": "sum_bytes",
+								"unit": "1h"
+							}
+						}
+					}
+				},
+				"max_bytes_per_hour": {
+					"max_bucket": {
+						"buckets_path": "by_day>bytes_per_hour"
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"by_day": {
+					"buckets": [
+						{
+							"key": 1706054400000,
+							"key_as_string": "2024-01-24T00:00:00.000",
+							"doc_count": 5,
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"bytes_per_hour": {
+								"value": null,
+								"normalized_value": null
+							}
+						},
+						{
+							"key": 1706140800000,
+							"key_as_string": "2024-01-25T00:00:00.000",
+							"doc_count": 2,
+							"sum_bytes": {
+								"value": 340.0
+							},
+							"bytes_per_hour": {
+								"value": 240.0,
+								"normalized_value": 10.0
+							}
+						},
+						{
+							"key": 1706227200000,
+							"key_as_string": "2024-01-26T00:00:00.000",
+							"doc_count": 6,
+							"sum_bytes": {
+								"value": 100.0
+							},
+							"bytes_per_hour": {
+								"value": -240.0,
+								"normalized_value": -10.0
+							}
+						}
+					]
+				},
+				"max_bytes_per_hour": {
+					"keys": [
+						"2024-01-25T00:00:00.000"
+					],
+					"value": 240.0
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706054400000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(5)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 100.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706140800000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(2)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 340.0),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_day__key_0", int64(1706227200000/86400000)),
+				model.NewQueryResultCol("aggr__by_day__count", int64(6)),
+				model.NewQueryResultCol("metric__by_day__sum_bytes_col_0", 100.0),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0", count(*) AS "aggr__by_day__count",
+			  sumOrNull("bytes_gauge") AS "metric__by_day__sum_bytes_col_0"
+			FROM __quesma_table_name
+			GROUP BY toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+			  "aggr__by_day__key_0"
+			ORDER BY "aggr__by_day__key_0" ASC`,
+	},
+	{ // [98]
+		TestName: "boxplot, median_absolute_deviation and string_stats next to a deeper bucket aggregation",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"by_user": {
+					"terms": {
+						"field": "user"
+					},
+					"aggs": {
+						"grade_boxplot": {
+							"boxplot": {
+								"field": "grade"
+							}
+						},
+						"grade_mad": {
+							"median_absolute_deviation": {
+								"field": "grade"
+							}
+						},
+						"message_stats": {
+							"string_stats": {
+								"field": "message"
+							}
+						},
+						"by_day": {
+							"date_histogram": {
+								"field": "@timestamp",
+								"fixed_interval": "1d"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"by_user": {
+					"doc_count_error_upper_bound": 0,
+					"sum_other_doc_count": 0,
+					"buckets": [
+						{
+							"key": "alice",
+							"doc_count": 9,
+							"grade_boxplot": {
+								"min": 1.0,
+								"max": 10.0,
+								"q1": 2.0,
+								"q2": 4.0,
+								"q3": 6.0,
+								"lower": 1.0,
+								"upper": 10.0
+							},
+							"grade_mad": {
+								"value": 2.0
+							},
+							"message_stats": {
+								"count": 2,
+								"min_length": 2,
+								"max_length": 3,
+								"avg_length": 2.5,
+								"entropy": 0.9709505944546686
+							},
+							"by_day": {
+								"buckets": [
+									{
+										"key": 1706054400000,
+										"key_as_string": "2024-01-24T00:00:00.000",
+										"doc_count": 4
+									},
+									{
+										"key": 1706140800000,
+										"key_as_string": "2024-01-25T00:00:00.000",
+										"doc_count": 5
+									}
+								]
+							}
+						}
+					]
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(9)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "alice"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(9)),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_0", 1.0),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_1", 10.0),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_2", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__by_user__grade_mad_col_0", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_1", uint64(2)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_2", uint64(3)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_3", 2.5),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_4", []any{[]string{"a", "b"}, []uint64{3, 2}}),
+				model.NewQueryResultCol("aggr__by_user__by_day__key_0", int64(1706054400000/86400000)),
+				model.NewQueryResultCol("aggr__by_user__by_day__count", int64(4)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__by_user__parent_count", int64(9)),
+				model.NewQueryResultCol("aggr__by_user__key_0", "alice"),
+				model.NewQueryResultCol("aggr__by_user__count", int64(9)),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_0", 1.0),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_1", 10.0),
+				model.NewQueryResultCol("metric__by_user__grade_boxplot_col_2", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__by_user__grade_mad_col_0", digestQuantilesOf(1, 2, 2, 4, 4, 4, 6, 6, 10)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_0", uint64(2)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_1", uint64(2)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_2", uint64(3)),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_3", 2.5),
+				model.NewQueryResultCol("metric__by_user__message_stats_col_4", []any{[]string{"a", "b"}, []uint64{3, 2}}),
+				model.NewQueryResultCol("aggr__by_user__by_day__key_0", int64(1706140800000/86400000)),
+				model.NewQueryResultCol("aggr__by_user__by_day__count", int64(5)),
+			}},
+		},
+		ExpectedPancakeSQL: `
+			SELECT "aggr__by_user__parent_count", "aggr__by_user__key_0",
+			  "aggr__by_user__count", "metric__by_user__grade_boxplot_col_0",
+			  "metric__by_user__grade_boxplot_col_1",
+			  "metric__by_user__grade_boxplot_col_2", "metric__by_user__grade_mad_col_0",
+			  "metric__by_user__message_stats_col_0",
+			  "metric__by_user__message_stats_col_1",
+			  "metric__by_user__message_stats_col_2",
+			  "metric__by_user__message_stats_col_3",
+			  "metric__by_user__message_stats_col_4", "aggr__by_user__by_day__key_0",
+			  "aggr__by_user__by_day__count"
+			FROM (
+			  SELECT "aggr__by_user__parent_count", "aggr__by_user__key_0",
+				"aggr__by_user__count", "metric__by_user__grade_boxplot_col_0",
+				"metric__by_user__grade_boxplot_col_1",
+				"metric__by_user__grade_boxplot_col_2", "metric__by_user__grade_mad_col_0",
+				"metric__by_user__message_stats_col_0",
+				"metric__by_user__message_stats_col_1",
+				"metric__by_user__message_stats_col_2",
+				"metric__by_user__message_stats_col_3",
+				"metric__by_user__message_stats_col_4", "aggr__by_user__by_day__key_0",
+				"aggr__by_user__by_day__count",
+				dense_rank() OVER (ORDER BY "aggr__by_user__count" DESC,
+				"aggr__by_user__key_0" ASC) AS "aggr__by_user__order_1_rank",
+				dense_rank() OVER (PARTITION BY "aggr__by_user__key_0" ORDER BY
+				"aggr__by_user__by_day__key_0" ASC) AS "aggr__by_user__by_day__order_1_rank"
+			  FROM (
+				SELECT sum(count(*)) OVER () AS "aggr__by_user__parent_count",
+				  "user" AS "aggr__by_user__key_0",
+				  sum(count(*)) OVER (PARTITION BY "aggr__by_user__key_0") AS
+				  "aggr__by_user__count",
+				  minOrNull(minOrNull("grade")) OVER (PARTITION BY "aggr__by_user__key_0")
+				  AS "metric__by_user__grade_boxplot_col_0",
+				  maxOrNull(maxOrNull("grade")) OVER (PARTITION BY "aggr__by_user__key_0")
+				  AS "metric__by_user__grade_boxplot_col_1",
+				  quantilesTDigestMerge(` + digestLevels() + `)(quantilesTDigestState(` + digestLevels() + `)(
+				  "grade")) OVER (PARTITION BY "aggr__by_user__key_0") AS
+				  "metric__by_user__grade_boxplot_col_2",
+				  quantilesTDigestMerge(` + digestLevels() + `)(quantilesTDigestState(` + digestLevels() + `)(
+				  "grade")) OVER (PARTITION BY "aggr__by_user__key_0") AS
+				  "metric__by_user__grade_mad_col_0",
+				  sum(count("message")) OVER (PARTITION BY "aggr__by_user__key_0") AS
+				  "metric__by_user__message_stats_col_0",
+				  minOrNull(minOrNull(lengthUTF8("message"))) OVER (PARTITION BY
+				  "aggr__by_user__key_0") AS "metric__by_user__message_stats_col_1",
+				  maxOrNull(maxOrNull(lengthUTF8("message"))) OVER (PARTITION BY
+				  "aggr__by_user__key_0") AS "metric__by_user__message_stats_col_2",
+				  avgOrNullMerge(avgOrNullState(lengthUTF8("message"))) OVER (PARTITION BY
+				  "aggr__by_user__key_0") AS "metric__by_user__message_stats_col_3",
+				  sumMapMerge(sumMapState(ngrams(COALESCE("message", ''), 1),
+				  arrayWithConstant(lengthUTF8(COALESCE("message", '')), 1))) OVER (
+				  PARTITION BY "aggr__by_user__key_0") AS
+				  "metric__by_user__message_stats_col_4",
+				  toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+				  "aggr__by_user__by_day__key_0",
+				  count(*) AS "aggr__by_user__by_day__count"
+				FROM __quesma_table_name
+				GROUP BY "user" AS "aggr__by_user__key_0",
+				  toInt64(toUnixTimestamp64Milli("@timestamp") / 86400000) AS
+				  "aggr__by_user__by_day__key_0"))
+			WHERE "aggr__by_user__order_1_rank"<=11
+			ORDER BY "aggr__by_user__order_1_rank" ASC,
+			  "aggr__by_user__by_day__order_1_rank" ASC`,
+	},
+	{ // [99]
+		TestName: "nested aggregation over arrays of different lengths (some nested objects miss a field)",
+		QueryRequestJson: `
+		{
+			"aggs": {
+				"resellers": {
+					"nested": {
+						"path": "resellers"
+					},
+					"aggs": {
+						"avg_price": {
+							"avg": {
+								"field": "resellers.price"
+							}
+						},
+						"top_resellers": {
+							"terms": {
+								"field": "resellers.name"
+							}
+						}
+					}
+				}
+			},
+			"size": 0,
+			"track_total_hits": false
+		}`,
+		ExpectedResponse: `
+		{
+			"aggregations": {
+				"resellers": {
+					"doc_count": 3,
+					"avg_price": {
+						"value": 375.0
+					},
+					"top_resellers": {
+						"doc_count_error_upper_bound": 0,
+						"sum_other_doc_count": 0,
+						"buckets": [
+							{
+								"key": "companyA",
+								"doc_count": 1
+							},
+							{
+								"key": "companyB",
+								"doc_count": 1
+							},
+							{
+								"key": "companyC",
+								"doc_count": 1
+							}
+						]
+					}
+				}
+			}
+		}`,
+		ExpectedPancakeResults: []model.QueryResultRow{
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__resellers__count", int64(3)),
+				model.NewQueryResultCol("metric__resellers__avg_price_col_0", 375.0),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__parent_count", int64(3)),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__key_0", "companyA"),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__count", int64(1)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__resellers__count", int64(3)),
+				model.NewQueryResultCol("metric__resellers__avg_price_col_0", 375.0),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__parent_count", int64(3)),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__key_0", "companyB"),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__count", int64(1)),
+			}},
+			{Cols: []model.QueryResultCol{
+				model.NewQueryResultCol("aggr__resellers__count", int64(3)),
+				model.NewQueryResultCol("metric__resellers__avg_price_col_0", 375.0),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__parent_count", int64(3)),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__key_0", "companyC"),
+				model.NewQueryResultCol("aggr__resellers__top_resellers__count", int64(1)),
+			}},
+		},
+		// resellers.price is shorter than resellers.name, it's padded with NULLs, which avgOrNull skips
+		ExpectedPancakeSQL: `
+			SELECT sum(count(*)) OVER () AS "aggr__resellers__count",
+			  avgOrNullMerge(avgOrNullState(tupleElement("nested__resellers", 1))) OVER ()
+			  AS "metric__resellers__avg_price_col_0",
+			  sum(count(*)) OVER () AS "aggr__resellers__top_resellers__parent_count",
+			  tupleElement("nested__resellers", 2) AS
+			  "aggr__resellers__top_resellers__key_0",
+			  count(*) AS "aggr__resellers__top_resellers__count"
+			FROM __quesma_table_name ARRAY JOIN arrayZip(arrayResize("resellers.price",
+			  greatest(length("resellers.price"), length("resellers.name")), NULL),
+			  arrayResize("resellers.name", greatest(length("resellers.price"), length(
+			  "resellers.name")), NULL)) AS "nested__resellers"
+			GROUP BY tupleElement("nested__resellers", 2) AS
+			  "aggr__resellers__top_resellers__key_0"
+			ORDER BY "aggr__resellers__top_resellers__count" DESC,
+			  "aggr__resellers__top_resellers__key_0" ASC
+			LIMIT 11`,
+	},
 }
@@ -91,7 +91,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										},
 										"doc_count": 319,
 										"key": 1728856800000,
-										"key_as_string": "2024-10-13T22:00:00.000"
+										"key_as_string": "2024-10-14T00:00:00.000+02:00"
 									}
 								]
 							}
@@ -107,7 +107,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										},
 										"doc_count": 12,
 										"key": 1726264800000,
-										"key_as_string": "2024-09-13T22:00:00.000"
+										"key_as_string": "2024-09-14T00:00:00.000+02:00"
 									},
 									{
 										"2": {
@@ -115,7 +115,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										},
 										"doc_count": 301,
 										"key": 1728856800000,
-										"key_as_string": "2024-10-13T22:00:00.000"
+										"key_as_string": "2024-10-14T00:00:00.000+02:00"
 									}
 								]
 							}
@@ -1022,7 +1022,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 442,
 											"key": 1726351200000,
-											"key_as_string": "2024-09-14T22:00:00.000",
+											"key_as_string": "2024-09-15T00:00:00.000+02:00",
 											"sum(count)": {
 												"value": 442
 											}
@@ -1030,7 +1030,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 0,
 											"key": 1726353000000,
-											"key_as_string": "2024-09-14T22:30:00.000",
+											"key_as_string": "2024-09-15T00:30:00.000+02:00",
 											"sum(count)": {
 												"value": null
 											}
@@ -1038,7 +1038,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 0,
 											"key": 1726354800000,
-											"key_as_string": "2024-09-14T23:00:00.000",
+											"key_as_string": "2024-09-15T01:00:00.000+02:00",
 											"sum(count)": {
 												"value": null
 											}
@@ -1046,7 +1046,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 0,
 											"key": 1726356600000,
-											"key_as_string": "2024-09-14T23:30:00.000",
+											"key_as_string": "2024-09-15T01:30:00.000+02:00",
 											"sum(count)": {
 												"value": null
 											}
@@ -1054,7 +1054,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 0,
 											"key": 1726358400000,
-											"key_as_string": "2024-09-15T00:00:00.000",
+											"key_as_string": "2024-09-15T02:00:00.000+02:00",
 											"sum(count)": {
 												"value": null
 											}
@@ -1062,7 +1062,7 @@ var CloverTests = []testdata.AggregationTestCase{
 										{
 											"doc_count": 1,
 											"key": 1726360200000,
-											"key_as_string": "2024-09-15T00:30:00.000",
+											"key_as_string": "2024-09-15T02:30:00.000+02:00",
 											"sum(count)": {
 												"value": 1
 											}
@@ -1178,7 +1178,7 @@ var CloverTests = []testdata.AggregationTestCase{
 							"time": {
 								"buckets": [
 									{
-										"key_as_string": "2024-10-13T10:00:00.000",
+										"key_as_string": "2024-10-13T12:00:00.000+02:00",
 										"key": 1728813600000,
 										"doc_count": 319,
 										"cardinality(a.b.keyword)": {
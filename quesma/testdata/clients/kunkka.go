@@ -283,7 +283,7 @@ var KunkkaTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 2,
 								"key": 1718787600000,
-								"key_as_string": "2024-06-19T09:00:00.000"
+								"key_as_string": "2024-06-19T11:00:00.000+02:00"
 							},
 							{
 								"1": {
@@ -297,7 +297,7 @@ var KunkkaTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 3,
 								"key": 1718791200000,
-								"key_as_string": "2024-06-19T10:00:00.000"
+								"key_as_string": "2024-06-19T12:00:00.000+02:00"
 							},
 							{
 								"1": {
@@ -311,7 +311,7 @@ var KunkkaTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 2,
 								"key": 1718794800000,
-								"key_as_string": "2024-06-19T11:00:00.000"
+								"key_as_string": "2024-06-19T13:00:00.000+02:00"
 							}
 						]
 					}
@@ -331,20 +331,273 @@ var AggregationTests = []testdata.AggregationTestCase{
 										},
 										"doc_count": 8,
 										"key": 1.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 2
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 2.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 3
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 3.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 8
 									}
 								]
 							},
 							"doc_count": 167,
 							"key": 1713957330000,
-							"key_as_string": "2024-04-24T11:15:30.000"
+							"key_as_string": "2024-04-24T13:15:30.000+02:00"
 						},
 						{
 							"1": {
-								"buckets": []
+								"buckets": [
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 1
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 1.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 2
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 2.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 3
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 3.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 8
+									}
+								]
 							},
 							"doc_count": 0,
 							"key": 1713957360000,
-							"key_as_string": "2024-04-24T11:16:00.000"
+							"key_as_string": "2024-04-24T13:16:00.000+02:00"
 						},
 						{
 							"1": {
@@ -393,12 +646,102 @@ var AggregationTests = []testdata.AggregationTestCase{
 										},
 										"doc_count": 5,
 										"key": 3
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 3.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 4.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 5.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 6.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 7.5
+									},
+									{
+										"2": {
+											"values": {
+												"95.0": null
+											}
+										},
+										"doc_count": 0,
+										"key": 8
 									}
 								]
 							},
 							"doc_count": 78,
 							"key": 1713957390000,
-							"key_as_string": "2024-04-24T11:16:30.000"
+							"key_as_string": "2024-04-24T13:16:30.000+02:00"
 						}
 					]
 				}
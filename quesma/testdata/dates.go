@@ -53,28 +53,28 @@ var AggregationTestsWithDates = []AggregationTestCase{
 							"buckets": [
 								{
 									"doc_count": 442,
-									"key": 1726358400000,
-									"key_as_string": "2024-09-15T00:00:00.000"
+									"key": 1726444800000,
+									"key_as_string": "2024-09-16T00:00:00.000"
 								},
 								{
 									"doc_count": 0,
-									"key": 1726963200000,
-									"key_as_string": "2024-09-22T00:00:00.000"
+									"key": 1727049600000,
+									"key_as_string": "2024-09-23T00:00:00.000"
 								},
 								{
 									"doc_count": 0,
-									"key": 1727568000000,
-									"key_as_string": "2024-09-29T00:00:00.000"
+									"key": 1727654400000,
+									"key_as_string": "2024-09-30T00:00:00.000"
 								},
 								{
 									"doc_count": 0,
-									"key": 1728172800000,
-									"key_as_string": "2024-10-06T00:00:00.000"
+									"key": 1728259200000,
+									"key_as_string": "2024-10-07T00:00:00.000"
 								},
 								{
 									"doc_count": 1,
-									"key": 1728777600000,
-									"key_as_string": "2024-10-13T00:00:00.000"
+									"key": 1728864000000,
+									"key_as_string": "2024-10-14T00:00:00.000"
 								}
 							]
 						}
@@ -96,26 +96,26 @@ var AggregationTestsWithDates = []AggregationTestCase{
 		ExpectedPancakeResults: []model.QueryResultRow{
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__sampler__count", int64(4675)),
-				model.NewQueryResultCol("aggr__sampler__eventRate__key_0", int64(1726358400000)),
+				model.NewQueryResultCol("aggr__sampler__eventRate__key_0", int64(1726444800000)),
 				model.NewQueryResultCol("aggr__sampler__eventRate__count", int64(442)),
 			}},
 			{Cols: []model.QueryResultCol{
 				model.NewQueryResultCol("aggr__sampler__count", int64(4675)),
-				model.NewQueryResultCol("aggr__sampler__eventRate__key_0", int64(1728777600000)),
+				model.NewQueryResultCol("aggr__sampler__eventRate__key_0", int64(1728864000000)),
 				model.NewQueryResultCol("aggr__sampler__eventRate__count", int64(1)),
 			}},
 		},
 		ExpectedPancakeSQL: `
 			SELECT sum(count(*)) OVER () AS "aggr__sampler__count",
-			  toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("order_date", 'UTC'))))*1000
+			  toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("order_date", 'UTC'), 1)))*1000
 			  AS "aggr__sampler__eventRate__key_0",
 			  count(*) AS "aggr__sampler__eventRate__count"
 			FROM (
 			  SELECT "order_date"
 			  FROM __quesma_table_name
 			  LIMIT 20000)
-			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("order_date", 'UTC')))
-			  )*1000 AS "aggr__sampler__eventRate__key_0"
+			GROUP BY toInt64(toUnixTimestamp(toStartOfWeek(toTimezone("order_date", 'UTC'),
+			  1)))*1000 AS "aggr__sampler__eventRate__key_0"
 			ORDER BY "aggr__sampler__eventRate__key_0" ASC`,
 	},
 	{ // [1]
@@ -203,7 +203,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370420000,
-								"key_as_string": "2024-10-31T10:27:00.000"
+								"key_as_string": "2024-10-31T11:27:00.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -211,7 +211,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370430000,
-								"key_as_string": "2024-10-31T10:27:10.000"
+								"key_as_string": "2024-10-31T11:27:10.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -219,7 +219,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370440000,
-								"key_as_string": "2024-10-31T10:27:20.000"
+								"key_as_string": "2024-10-31T11:27:20.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -227,7 +227,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370450000,
-								"key_as_string": "2024-10-31T10:27:30.000"
+								"key_as_string": "2024-10-31T11:27:30.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -235,7 +235,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1730370460000,
-								"key_as_string": "2024-10-31T10:27:40.000"
+								"key_as_string": "2024-10-31T11:27:40.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -243,7 +243,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370470000,
-								"key_as_string": "2024-10-31T10:27:50.000"
+								"key_as_string": "2024-10-31T11:27:50.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -251,7 +251,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370480000,
-								"key_as_string": "2024-10-31T10:28:00.000"
+								"key_as_string": "2024-10-31T11:28:00.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -259,7 +259,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370490000,
-								"key_as_string": "2024-10-31T10:28:10.000"
+								"key_as_string": "2024-10-31T11:28:10.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -267,7 +267,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370500000,
-								"key_as_string": "2024-10-31T10:28:20.000"
+								"key_as_string": "2024-10-31T11:28:20.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -275,7 +275,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1730370510000,
-								"key_as_string": "2024-10-31T10:28:30.000"
+								"key_as_string": "2024-10-31T11:28:30.000+01:00"
 							}
 						],
 						"meta": {
@@ -408,7 +408,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1730370460000,
-								"key_as_string": "2024-10-31T10:27:40.000"
+								"key_as_string": "2024-10-31T11:27:40.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -416,7 +416,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370470000,
-								"key_as_string": "2024-10-31T10:27:50.000"
+								"key_as_string": "2024-10-31T11:27:50.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -424,7 +424,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370480000,
-								"key_as_string": "2024-10-31T10:28:00.000"
+								"key_as_string": "2024-10-31T11:28:00.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -432,7 +432,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370490000,
-								"key_as_string": "2024-10-31T10:28:10.000"
+								"key_as_string": "2024-10-31T11:28:10.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -440,7 +440,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370500000,
-								"key_as_string": "2024-10-31T10:28:20.000"
+								"key_as_string": "2024-10-31T11:28:20.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -448,7 +448,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1730370510000,
-								"key_as_string": "2024-10-31T10:28:30.000"
+								"key_as_string": "2024-10-31T11:28:30.000+01:00"
 							},
 							{
 								"c4a48962-08e6-4791-ae9e-b50f1b111488": {
@@ -456,7 +456,7 @@ var AggregationTestsWithDates = []AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1730370520000,
-								"key_as_string": "2024-10-31T10:28:40.000"
+								"key_as_string": "2024-10-31T11:28:40.000+01:00"
 							}
 						],
 						"meta": {
@@ -131,7 +131,7 @@ var AggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 4,
 								"key": 1716827010000,
-								"key_as_string": "2024-05-27T16:23:30.000"
+								"key_as_string": "2024-05-27T18:23:30.000+02:00"
 							},
 							{
 								"1": {
@@ -158,7 +158,7 @@ var AggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 16,
 								"key": 1716827070000,
-								"key_as_string": "2024-05-27T16:24:30.000"
+								"key_as_string": "2024-05-27T18:24:30.000+02:00"
 							}
 						]
 					}
@@ -937,6 +937,33 @@ var AggregationTests = []testdata.AggregationTestCase{
 											},
 											"key": 0,
 											"doc_count": 908
+										},
+										{
+											"2": {
+												"values": {
+													"95.0": null
+												}
+											},
+											"key": 5000,
+											"doc_count": 0
+										},
+										{
+											"2": {
+												"values": {
+													"95.0": null
+												}
+											},
+											"key": 10000,
+											"doc_count": 0
+										},
+										{
+											"2": {
+												"values": {
+													"95.0": null
+												}
+											},
+											"key": 15000,
+											"doc_count": 0
 										}
 									]
 								},
@@ -968,6 +995,24 @@ var AggregationTests = []testdata.AggregationTestCase{
 											},
 											"key": 5000,
 											"doc_count": 186
+										},
+										{
+											"2": {
+												"values": {
+													"95.0": null
+												}
+											},
+											"key": 10000,
+											"doc_count": 0
+										},
+										{
+											"2": {
+												"values": {
+													"95.0": null
+												}
+											},
+											"key": 15000,
+											"doc_count": 0
 										}
 									]
 								},
@@ -117,13 +117,13 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 											},
 											"doc_count": 140,
 											"key": 1727042400000,
-											"key_as_string": "2024-09-22T22:00:00.000"
+											"key_as_string": "2024-09-23T00:00:00.000+02:00"
 										}
 									]
 								},
 								"doc_count": 140,
 								"key": 1727042400000,
-								"key_as_string": "2024-09-22T22:00:00.000"
+								"key_as_string": "2024-09-23T00:00:00.000+02:00"
 							},
 							{
 								"1": {
@@ -138,13 +138,13 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 											},
 											"doc_count": 178,
 											"key": 1727085600000,
-											"key_as_string": "2024-09-23T10:00:00.000"
+											"key_as_string": "2024-09-23T12:00:00.000+02:00"
 										}
 									]
 								},
 								"doc_count": 178,
 								"key": 1727085600000,
-								"key_as_string": "2024-09-23T10:00:00.000"
+								"key_as_string": "2024-09-23T12:00:00.000+02:00"
 							}
 						]
 					}
@@ -277,7 +277,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1728144300000,
-								"key_as_string": "2024-10-05T16:05:00.000"
+								"key_as_string": "2024-10-05T18:05:00.000+02:00"
 							},
 							{
 								"1": {
@@ -288,7 +288,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1728144360000,
-								"key_as_string": "2024-10-05T16:06:00.000"
+								"key_as_string": "2024-10-05T18:06:00.000+02:00"
 							},
 							{
 								"1": {
@@ -299,7 +299,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 0,
 								"key": 1728144420000,
-								"key_as_string": "2024-10-05T16:07:00.000"
+								"key_as_string": "2024-10-05T18:07:00.000+02:00"
 							},
 							{
 								"1": {
@@ -310,7 +310,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 1,
 								"key": 1728144480000,
-								"key_as_string": "2024-10-05T16:08:00.000"
+								"key_as_string": "2024-10-05T18:08:00.000+02:00"
 							},
 							{
 								"1": {
@@ -321,7 +321,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"doc_count": 2,
 								"key": 1728144540000,
-								"key_as_string": "2024-10-05T16:09:00.000"
+								"key_as_string": "2024-10-05T18:09:00.000+02:00"
 							}
 						]
 					}
@@ -446,7 +446,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"3": {
 									"keys": [
-										"2024-09-22T22:00:00.000"
+										"2024-09-23T00:00:00.000+02:00"
 									],
 									"value": 131.0
 								},
@@ -458,13 +458,13 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 											},
 											"doc_count": 140,
 											"key": 1727042400000,
-											"key_as_string": "2024-09-22T22:00:00.000"
+											"key_as_string": "2024-09-23T00:00:00.000+02:00"
 										}
 									]
 								},
 								"doc_count": 140,
 								"key": 1727042400000,
-								"key_as_string": "2024-09-22T22:00:00.000"
+								"key_as_string": "2024-09-23T00:00:00.000+02:00"
 							},
 							{
 								"1": {
@@ -475,7 +475,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 								},
 								"3": {
 									"keys": [
-										"2024-09-23T10:00:00.000"
+										"2024-09-23T12:00:00.000+02:00"
 									],
 									"value": 165.0
 								},
@@ -487,13 +487,13 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 											},
 											"doc_count": 178,
 											"key": 1727085600000,
-											"key_as_string": "2024-09-23T10:00:00.000"
+											"key_as_string": "2024-09-23T12:00:00.000+02:00"
 										}
 									]
 								},
 								"doc_count": 178,
 								"key": 1727085600000,
-								"key_as_string": "2024-09-23T10:00:00.000"
+								"key_as_string": "2024-09-23T12:00:00.000+02:00"
 							}
 						]
 					}
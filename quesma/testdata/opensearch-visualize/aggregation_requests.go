@@ -775,7 +775,22 @@ var AggregationTests = []testdata.AggregationTestCase{
 			  fromUnixTimestamp64Milli(1714697399517))
 			GROUP BY "response" AS "aggr__2__key_0"
 			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 4`,
+			LIMIT 15`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "response" AS "aggr__2__key_0", count(*) AS "aggr__2__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__bg_total"
+			FROM __quesma_table_name
+			WHERE "response" IN (
+			  SELECT "response"
+			  FROM __quesma_table_name
+			  WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401399517) AND "timestamp"<=fromUnixTimestamp64Milli(1714697399517))
+			  GROUP BY "response"
+			  ORDER BY count(*) DESC, "response" ASC
+			  LIMIT 14)
+			GROUP BY "response"`,
+		},
 	},
 	{ // [5]
 		TestName: "Min on DateTime field. Reproduce: Visualize -> Line: Metrics -> Min @timestamp, Buckets: Add X-Asis, Aggregation: Significant Terms",
@@ -919,7 +934,22 @@ var AggregationTests = []testdata.AggregationTestCase{
 			  fromUnixTimestamp64Milli(1714697460471))
 			GROUP BY "response" AS "aggr__2__key_0"
 			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 4`,
+			LIMIT 15`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "response" AS "aggr__2__key_0", count(*) AS "aggr__2__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__bg_total"
+			FROM __quesma_table_name
+			WHERE "response" IN (
+			  SELECT "response"
+			  FROM __quesma_table_name
+			  WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401460471) AND "timestamp"<=fromUnixTimestamp64Milli(1714697460471))
+			  GROUP BY "response"
+			  ORDER BY count(*) DESC, "response" ASC
+			  LIMIT 14)
+			GROUP BY "response"`,
+		},
 	},
 	{ // [6]
 		TestName: "Percentiles on DateTime field. Reproduce: Visualize -> Line: Metrics -> Percentiles (or Median, it's the same aggregation) @timestamp, Buckets: Add X-Asis, Aggregation: Significant Terms",
@@ -1096,7 +1126,22 @@ var AggregationTests = []testdata.AggregationTestCase{
 			  fromUnixTimestamp64Milli(1714697475845))
 			GROUP BY "response" AS "aggr__2__key_0"
 			ORDER BY "aggr__2__count" DESC, "aggr__2__key_0" ASC
-			LIMIT 4`,
+			LIMIT 15`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "response" AS "aggr__2__key_0", count(*) AS "aggr__2__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__2__bg_total"
+			FROM __quesma_table_name
+			WHERE "response" IN (
+			  SELECT "response"
+			  FROM __quesma_table_name
+			  WHERE ("timestamp">=fromUnixTimestamp64Milli(1713401475845) AND "timestamp"<=fromUnixTimestamp64Milli(1714697475845))
+			  GROUP BY "response"
+			  ORDER BY count(*) DESC, "response" ASC
+			  LIMIT 14)
+			GROUP BY "response"`,
+		},
 	},
 	{ // [7]
 		TestName: "Percentile_ranks keyed=false. Reproduce: Visualize -> Line -> Metrics: Percentile Ranks, Buckets: X-Asis Date Histogram",
@@ -1185,7 +1230,7 @@ var AggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 9,
 							"key": 1714852800000,
-							"key_as_string": "2024-05-04T20:00:00.000"
+							"key_as_string": "2024-05-04T22:00:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1202,7 +1247,7 @@ var AggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 12,
 							"key": 1714856400000,
-							"key_as_string": "2024-05-04T21:00:00.000"
+							"key_as_string": "2024-05-04T23:00:00.000+02:00"
 						}
 					]
 				}
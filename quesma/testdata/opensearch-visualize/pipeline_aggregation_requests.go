@@ -1819,7 +1819,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 2,
 							"key": 1714870200000,
-							"key_as_string": "2024-05-05T00:50:00.000"
+							"key_as_string": "2024-05-05T02:50:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1830,7 +1830,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 0,
 							"key": 1714870800000,
-							"key_as_string": "2024-05-05T01:00:00.000"
+							"key_as_string": "2024-05-05T03:00:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1841,7 +1841,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 0,
 							"key": 1714871400000,
-							"key_as_string": "2024-05-05T01:10:00.000"
+							"key_as_string": "2024-05-05T03:10:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1852,7 +1852,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 2,
 							"key": 1714872000000,
-							"key_as_string": "2024-05-05T01:20:00.000"
+							"key_as_string": "2024-05-05T03:20:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1863,7 +1863,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 6,
 							"key": 1714872600000,
-							"key_as_string": "2024-05-05T01:30:00.000"
+							"key_as_string": "2024-05-05T03:30:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1874,7 +1874,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 2,
 							"key": 1714873200000,
-							"key_as_string": "2024-05-05T01:40:00.000"
+							"key_as_string": "2024-05-05T03:40:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1885,7 +1885,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 2,
 							"key": 1714873800000,
-							"key_as_string": "2024-05-05T01:50:00.000"
+							"key_as_string": "2024-05-05T03:50:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1896,7 +1896,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 0,
 							"key": 1714874400000,
-							"key_as_string": "2024-05-05T02:00:00.000"
+							"key_as_string": "2024-05-05T04:00:00.000+02:00"
 						},
 						{
 							"1": {
@@ -1907,7 +1907,7 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 							},
 							"doc_count": 2,
 							"key": 1714875000000,
-							"key_as_string": "2024-05-05T02:10:00.000"
+							"key_as_string": "2024-05-05T04:10:00.000+02:00"
 						}
 					]
 				}
@@ -4481,7 +4481,21 @@ var PipelineAggregationTests = []testdata.AggregationTestCase{
 			FROM __quesma_table_name
 			GROUP BY "extension" AS "aggr__1-bucket__key_0"
 			ORDER BY "aggr__1-bucket__count" DESC, "aggr__1-bucket__key_0" ASC
-			LIMIT 6`,
+			LIMIT 18`,
+		ExpectedAdditionalPancakeSQLs: []string{`
+			SELECT "extension" AS "aggr__1-bucket__key_0", count(*) AS "aggr__1-bucket__bg_count",
+			  (
+			  SELECT count(*)
+			  FROM __quesma_table_name) AS "aggr__1-bucket__bg_total"
+			FROM __quesma_table_name
+			WHERE "extension" IN (
+			  SELECT "extension"
+			  FROM __quesma_table_name
+			  GROUP BY "extension"
+			  ORDER BY count(*) DESC, "extension" ASC
+			  LIMIT 17)
+			GROUP BY "extension"`,
+		},
 	},
 	{ // [25]
 		TestName: "complex sum_bucket. Reproduce: Visualize -> Vertical Bar: Metrics: Sum Bucket (Bucket: Date Histogram, Metric: Average), Buckets: X-Asis: Histogram",
@@ -2326,6 +2326,124 @@ var TestsSearch = []SearchTestCase{
 		},
 		[]string{},
 	},
+	{ // [40]
+		"Geo distance query",
+		`{
+			"query": {
+				"bool": {
+					"filter": {
+						"geo_distance": {
+							"distance": "12km",
+							"location": { "lat": 40, "lon": -70 }
+						}
+					}
+				}
+			},
+			"track_total_hits": false
+		}`,
+		[]string{`geoDistance(toFloat64(__quesma_geo_lon("location")),toFloat64(__quesma_geo_lat("location")),-70,40)<=12000`},
+		model.ListAllFields,
+		[]string{
+			`SELECT "message" ` +
+				`FROM ` + TableName + ` ` +
+				`WHERE geoDistance(toFloat64(__quesma_geo_lon("location")),toFloat64(__quesma_geo_lat("location")),-70,40)<=12000 ` +
+				`LIMIT 10`,
+		},
+		[]string{},
+	},
+	{ // [41]
+		"Geo polygon query",
+		`{
+			"query": {
+				"bool": {
+					"filter": {
+						"geo_polygon": {
+							"person.location": {
+								"points": [
+									{ "lat": 40, "lon": -70 },
+									[ -80, 30 ],
+									"20, -90"
+								]
+							}
+						}
+					}
+				}
+			},
+			"track_total_hits": false
+		}`,
+		[]string{`pointInPolygon(tuple(toFloat64(__quesma_geo_lon("person_location")),toFloat64(__quesma_geo_lat("person_location"))),[(-70, 40), (-80, 30), (-90, 20)])`},
+		model.ListAllFields,
+		[]string{
+			`SELECT "message" ` +
+				`FROM ` + TableName + ` ` +
+				`WHERE pointInPolygon(tuple(toFloat64(__quesma_geo_lon("person_location")),toFloat64(__quesma_geo_lat("person_location"))),[(-70, 40), (-80, 30), (-90, 20)]) ` +
+				`LIMIT 10`,
+		},
+		[]string{},
+	},
+	{ // [42]
+		"Geo shape query: envelope crossing the dateline",
+		`{
+			"query": {
+				"bool": {
+					"filter": {
+						"geo_shape": {
+							"location": {
+								"shape": {
+									"type": "envelope",
+									"coordinates": [ [ 170.0, 53.0 ], [ -170.0, 52.0 ] ]
+								},
+								"relation": "within"
+							}
+						}
+					}
+				}
+			},
+			"track_total_hits": false
+		}`,
+		[]string{`((toFloat64(__quesma_geo_lat("location"))>=52 AND toFloat64(__quesma_geo_lat("location"))<=53) AND (toFloat64(__quesma_geo_lon("location"))>=170 OR toFloat64(__quesma_geo_lon("location"))<=-170))`},
+		model.ListAllFields,
+		[]string{
+			`SELECT "message" ` +
+				`FROM ` + TableName + ` ` +
+				`WHERE ((toFloat64(__quesma_geo_lat("location"))>=52 AND toFloat64(__quesma_geo_lat("location"))<=53) AND (toFloat64(__quesma_geo_lon("location"))>=170 OR toFloat64(__quesma_geo_lon("location"))<=-170)) ` +
+				`LIMIT 10`,
+		},
+		[]string{},
+	},
+	{ // [43]
+		"Geo shape query: disjoint with polygon with a hole",
+		`{
+			"query": {
+				"bool": {
+					"filter": {
+						"geo_shape": {
+							"location": {
+								"shape": {
+									"type": "Polygon",
+									"coordinates": [
+										[ [ 0, 0 ], [ 10, 0 ], [ 10, 10 ], [ 0, 10 ], [ 0, 0 ] ],
+										[ [ 2, 2 ], [ 8, 2 ], [ 8, 8 ], [ 2, 8 ], [ 2, 2 ] ]
+									]
+								},
+								"relation": "disjoint"
+							}
+						}
+					}
+				}
+			},
+			"track_total_hits": false
+		}`,
+		[]string{`NOT (pointInPolygon(tuple(toFloat64(__quesma_geo_lon("location")),toFloat64(__quesma_geo_lat("location"))),[(0, 0), (10, 0), (10, 10), (0, 10), (0, 0)],[(2, 2), (8, 2), (8, 8), (2, 8), (2, 2)]))`},
+		model.ListAllFields,
+		[]string{
+			`SELECT "message" ` +
+				`FROM ` + TableName + ` ` +
+				`WHERE NOT (pointInPolygon(tuple(toFloat64(__quesma_geo_lon("location")),toFloat64(__quesma_geo_lat("location"))),[(0, 0), (10, 0), (10, 10), (0, 10), (0, 0)],[(2, 2), (8, 2), (8, 8), (2, 8), (2, 2)])) ` +
+				`LIMIT 10`,
+		},
+		[]string{},
+	},
 }
 
 var TestSearchRuntimeMappings = []SearchTestCase{
@@ -6,25 +6,6 @@ import "quesma/quesma/ui"
 
 var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 	// bucket:
-	{ // [0]
-		TestName:  "bucket aggregation: adjacency_matrix",
-		QueryType: "adjacency_matrix",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs" : {
-				"interactions" : {
-					"adjacency_matrix" : {
-						"filters" : {
-							"grpA" : { "terms" : { "accounts" : ["hillary", "sidney"] }},
-							"grpB" : { "terms" : { "accounts" : ["donald", "mitt"] }},
-							"grpC" : { "terms" : { "accounts" : ["vladimir", "nigel"] }}
-						}
-					}
-				}
-			}
-		}`,
-	},
 	{ // [2]
 		TestName:  "bucket aggregation: categorize_text",
 		QueryType: "categorize_text",
@@ -70,23 +51,6 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 		}`,
 	},
 	{ // [4]
-		TestName:  "bucket aggregation: composite",
-		QueryType: "composite",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"my_buckets": {
-					"composite": {
-						"sources": [
-							{ "product": { "terms": { "field": "product" } } }
-						]
-					}
-				}
-			}
-		}`,
-	},
-	{ // [5]
 		TestName:  "bucket aggregation: diversified_sampler",
 		QueryType: "diversified_sampler",
 		QueryRequestJson: `
@@ -114,7 +78,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [6]
+	{ // [5]
 		TestName:  "bucket aggregation: frequent_item_sets",
 		QueryType: "frequent_item_sets",
 		QueryRequestJson: `
@@ -139,158 +103,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [7]
-		TestName:  "bucket aggregation: geo_distance",
-		QueryType: "geo_distance",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"rings": {
-					"geo_distance": {
-						"field": "location",
-						"origin": "POINT (4.894 52.3760)",
-						"unit": "km", 
-						"ranges": [
-							{ "to": 100 },
-							{ "from": 100, "to": 300 },
-							{ "from": 300 }
-						]
-					}
-				}
-			}
-		}`,
-	},
-	{ // [8]
-		TestName:  "bucket aggregation: geohash_grid",
-		QueryType: "geohash_grid",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"zoomed-in": {
-					"aggs": {
-						"zoom1": {
-							"geohash_grid": {
-								"field": "location",
-								"precision": 8
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [9]
-		TestName:  "bucket aggregation: geohex_grid",
-		QueryType: "geohex_grid",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"zoomed-in": {
-					"aggs": {
-						"zoom1": {
-							"geohex_grid": {
-								"field": "location",
-								"precision": 12
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [11]
-		TestName:  "bucket aggregation: global",
-		QueryType: "global",
-		QueryRequestJson: `
-		{
-			"query": {
-				"match": { "type": "t-shirt" }
-			},
-			"aggs": {
-				"all_products": {
-					"global": {}, 
-					"aggs": {     
-						"avg_price": { "avg": { "field": "price" } }
-					}
-				},
-				"t_shirts": { "avg": { "field": "price" } }
-			}
-		}`,
-	},
-	{ // [12]
-		TestName:  "bucket aggregation: ip_prefix",
-		QueryType: "ip_prefix",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"ipv4-subnets": {
-					"ip_prefix": {
-						"field": "ipv4",
-						"prefix_length": 24
-					}
-				}
-			}
-		}`,
-	},
-	{ // [13]
-		TestName:  "bucket aggregation: ip_range",
-		QueryType: "ip_range",
-		QueryRequestJson: `
-		{
-			"size": 10,
-			"aggs": {
-				"ip_ranges": {
-					"ip_range": {
-						"field": "ip",
-						"ranges": [
-							{ "to": "10.0.0.5" },
-							{ "from": "10.0.0.5" }
-						]
-					}
-				}
-			}
-		}`,
-	},
-	{ // [14]
-		TestName:  "bucket aggregation: missing",
-		QueryType: "missing",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"products_without_a_price": {
-					"missing": { "field": "price" }
-				}
-			}
-		}`,
-	},
 	{ // [16]
-		TestName:  "bucket aggregation: nested",
-		QueryType: "nested",
-		QueryRequestJson: `
-		{
-			"query": {
-				"match": {
-					"name": "led tv"
-				}
-			},
-			"aggs": {
-				"resellers": {
-					"nested": {
-						"path": "resellers"
-					},
-					"aggs": {
-						"min_price": {
-							"min": {
-								"field": "resellers.price"
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [17]
 		TestName:  "bucket aggregation: parent",
 		QueryType: "parent",
 		QueryRequestJson: `
@@ -320,54 +133,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [18]
-		TestName:  "bucket aggregation: rare_terms",
-		QueryType: "rare_terms",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"genres": {
-					"rare_terms": {
-						"field": "genre"
-					}
-				}
-			}
-		}`,
-	},
 	{ // [19]
-		TestName:  "bucket aggregation: reverse_nested",
-		QueryType: "reverse_nested",
-		QueryRequestJson: `
-		{
-			"query": {
-				"match_all": {}
-			},
-			"aggs": {
-				"comments": {
-					"aggs": {
-						"top_usernames": {
-							"terms": {
-								"field": "comments.username"
-							},
-							"aggs": {
-								"comment_to_issue": {
-									"reverse_nested": {}, 
-									"aggs": {
-										"top_tags_per_comment": {
-											"terms": {
-												"field": "tags"
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [20]
 		TestName:  "bucket aggregation: significant_text",
 		QueryType: "significant_text",
 		QueryRequestJson: `
@@ -389,7 +155,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [21]
+	{ // [20]
 		TestName:  "bucket aggregation: time_series",
 		QueryType: "time_series",
 		QueryRequestJson: `
@@ -401,52 +167,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [22]
-		TestName:  "bucket aggregation: variable_width_histogram",
-		QueryType: "variable_width_histogram",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"prices": {
-					"variable_width_histogram": {
-						"field": "price",
-						"buckets": 2
-					}
-				}
-			}
-		}`,
-	},
-	// metrics:
-	{ // [23]
-		TestName:  "metrics aggregation: boxplot",
-		QueryType: "boxplot",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"load_time_boxplot": {
-					"boxplot": {
-						"field": "load_time" 
-					}
-				}
-			}
-		}`,
-	},
-	{ // [25]
-		TestName:  "metrics aggregation: geo_bounds",
-		QueryType: "geo_bounds",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"viewport": {
-					"geo_bounds": {
-						"field": "geometry"
-					}
-				}
-			}
-		}`,
-	},
-	{ // [27]
+	{ // [26]
 		TestName:  "metrics aggregation: geo_line",
 		QueryType: "geo_line",
 		QueryRequestJson: `
@@ -461,7 +182,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [28]
+	{ // [27]
 		TestName:  "metrics aggregation: cartesian_bounds",
 		QueryType: "cartesian_bounds",
 		QueryRequestJson: `
@@ -478,7 +199,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [29]
+	{ // [28]
 		TestName:  "metrics aggregation: cartesian_centroid",
 		QueryType: "cartesian_centroid",
 		QueryRequestJson: `
@@ -492,7 +213,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [30]
+	{ // [29]
 		TestName:  "metrics aggregation: matrix_stats",
 		QueryType: "matrix_stats",
 		QueryRequestJson: `
@@ -506,50 +227,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [31]
-		TestName:  "metrics aggregation: median_absolute_deviation",
-		QueryType: "median_absolute_deviation",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"review_average": {
-					"avg": {
-						"field": "rating"
-					}
-				},
-				"review_variability": {
-					"median_absolute_deviation": {
-						"field": "rating" 
-					}
-				}
-			}
-		}`,
-	},
 	{ // [32]
-		TestName:  "metrics aggregation: rate",
-		QueryType: "rate",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"by_date": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"  
-					},
-					"aggs": {
-						"my_rate": {
-							"rate": {
-								"unit": "year"  
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [33]
 		TestName:  "metrics aggregation: scripted_metric",
 		QueryType: "scripted_metric",
 		QueryRequestJson: `
@@ -570,16 +248,6 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 		}`,
 	},
 	{ // [34]
-		TestName:  "metrics aggregation: string_stats",
-		QueryType: "string_stats",
-		QueryRequestJson: `
-		{
-			"aggs": {
-				"message_stats": { "string_stats": { "field": "message.keyword" } }
-			}
-		}`,
-	},
-	{ // [35]
 		TestName:  "metrics aggregation: t_test",
 		QueryType: "t_test",
 		QueryRequestJson: `
@@ -596,29 +264,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [36]
-		TestName:  "metrics aggregation: weighted_avg",
-		QueryType: "weighted_avg",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"weighted_grade": {
-					"weighted_avg": {
-						"value": {
-							"field": "grade"
-						},
-						"weight": {
-							"field": "weight"
-						}
-					}
-				}
-			}
-		}`,
-	},
-
-	// pipeline:
-	{ // [38]
+	{ // [37]
 		TestName:  "pipeline aggregation: bucket_count_ks_test",
 		QueryType: "bucket_count_ks_test",
 		QueryRequestJson: `
@@ -650,7 +296,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [39]
+	{ // [38]
 		TestName:  "pipeline aggregation: bucket_correlation",
 		QueryType: "bucket_correlation",
 		QueryRequestJson: `
@@ -691,69 +337,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [40]
-		TestName:  "pipeline aggregation: bucket_selector",
-		QueryType: "bucket_selector",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"total_sales": {
-							"sum": {
-								"field": "price"
-							}
-						},
-						"sales_bucket_filter": {
-							"bucket_selector": {
-								"buckets_path": {
-									"totalSales": "total_sales"
-								},
-								"script": "params.totalSales > 200"
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
 	{ // [41]
-		TestName:  "pipeline aggregation: bucket_sort",
-		QueryType: "bucket_sort",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"total_sales": {
-							"sum": {
-								"field": "price"
-							}
-						},
-						"sales_bucket_sort": {
-							"bucket_sort": {
-								"sort": [
-				  					{ "total_sales": { "order": "desc" } } 
-								],
-								"size": 3                                
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [42]
 		TestName:  "pipeline aggregation: change_point",
 		QueryType: "change_point",
 		QueryRequestJson: `
@@ -780,63 +364,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [43]
-		TestName:  "pipeline aggregation: cumulative_cardinality",
-		QueryType: "cumulative_cardinality",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"users_per_day": {
-					"date_histogram": {
-						"field": "timestamp",
-						"calendar_interval": "day"
-					},
-					"aggs": {
-						"distinct_users": {
-							"cardinality": {
-								"field": "user_id"
-							}
-						},
-						"total_new_users": {
-							"cumulative_cardinality": {
-								"buckets_path": "distinct_users" 
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
 	{ // [46]
-		TestName:  "pipeline aggregation: extended_stats_bucket",
-		QueryType: "extended_stats_bucket",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"sales": {
-							"sum": {
-								"field": "price"
-							}
-						}
-					}
-				},
-				"stats_monthly_sales": {
-					"extended_stats_bucket": {
-						"buckets_path": "sales_per_month>sales" 
-					}
-				}
-			}
-		}`,
-	},
-	{ // [47]
 		TestName:  "pipeline aggregation: inference",
 		QueryType: "inference",
 		QueryRequestJson: `
@@ -911,153 +439,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [50]
-		TestName:  "pipeline aggregation: moving_fn",
-		QueryType: "moving_fn",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"my_date_histo": {                  
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "1M"
-					},
-					"aggs": {
-						"the_sum": {
-							"sum": { "field": "price" }   
-						},
-						"the_movfn": {
-							"moving_fn": {
-								"buckets_path": "the_sum",  
-								"window": 10,
-								"script": "MovingFunctions.unweightedAvg(values)"
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [51]
-		TestName:  "pipeline aggregation: moving_percentiles",
-		QueryType: "moving_percentiles",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"my_date_histo": {                          
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "1M"
-					},
-					"aggs": {
-						"the_percentile": {                     
-							"percentiles": {
-								"field": "price",
-								"percents": [ 1.0, 99.0 ]
-							}
-						},
-						"the_movperc": {
-							"moving_percentiles": {
-								"buckets_path": "the_percentile",   
-								"window": 10
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [52]
-		TestName:  "pipeline aggregation: normalize",
-		QueryType: "normalize",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"sales": {
-							"sum": {
-								"field": "price"
-							}
-						},
-						"percent_of_total_sales": {
-							"normalize": {
-								"buckets_path": "sales",          
-								"method": "percent_of_sum",       
-								"format": "00.00%"                
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [53]
-		TestName:  "pipeline aggregation: percentiles_bucket",
-		QueryType: "percentiles_bucket",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"sales": {
-							"sum": {
-								"field": "price"
-							}
-						}
-					}
-				},
-				"percentiles_monthly_sales": {
-					"percentiles_bucket": {
-						"buckets_path": "sales_per_month>sales", 
-						"percents": [ 25.0, 50.0, 75.0 ]         
-					}
-				}
-			}
-		}`,
-	},
-	{ // [55]
-		TestName:  "pipeline aggregation: stats_bucket",
-		QueryType: "stats_bucket",
-		QueryRequestJson: `
-		{
-			"size": 0,
-			"aggs": {
-				"sales_per_month": {
-					"date_histogram": {
-						"field": "date",
-						"calendar_interval": "month"
-					},
-					"aggs": {
-						"sales": {
-							"sum": {
-								"field": "price"
-							}
-						}
-					}
-				},
-				"stats_monthly_sales": {
-					"stats_bucket": {
-						"buckets_path": "sales_per_month>sales" 
-					}
-				}
-			}
-		}`,
-	},
-	// random non-existing aggregation:
-	{ // [57]
+	{ // [56]
 		TestName:  "non-existing aggregation: Augustus_Caesar",
 		QueryType: ui.UnrecognizedQueryType,
 		QueryRequestJson: `
@@ -1081,7 +463,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 	},
 
 	// Query DSL Tests:
-	{ // [58]
+	{ // [57]
 		TestName:  "Compound query: boosting",
 		QueryType: "boosting",
 		QueryRequestJson: `
@@ -1103,7 +485,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [60]
+	{ // [59]
 		TestName:  "Compound query: disjunction_max",
 		QueryType: "dis_max",
 		QueryRequestJson: `
@@ -1119,7 +501,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [61]
+	{ // [60]
 		TestName:  "Compound query: function score",
 		QueryType: "function_score",
 		QueryRequestJson: `
@@ -1134,7 +516,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [62]
+	{ // [61]
 		TestName:  "Full text queries: intervals",
 		QueryType: "intervals",
 		QueryRequestJson: `
@@ -1167,7 +549,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [63]
+	{ // [62]
 		TestName:  "Full text queries: match_bool_prefix",
 		QueryType: "match_bool_prefix",
 		QueryRequestJson: `
@@ -1179,7 +561,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [64]
+	{ // [63]
 		TestName:  "Full text queries: match_phrase_prefix",
 		QueryType: "match_phrase_prefix",
 		QueryRequestJson: `
@@ -1193,7 +575,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [65]
+	{ // [64]
 		TestName:  "Full text queries: combined fields",
 		QueryType: "combined_fields",
 		QueryRequestJson: `
@@ -1207,7 +589,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [67]
+	{ // [66]
 		TestName:  "Geo queries: Geo-grid",
 		QueryType: "geo_grid",
 		QueryRequestJson: `
@@ -1221,57 +603,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [68]
-		TestName:  "Geo queries: Geo-polygon",
-		QueryType: "geo_polygon",
-		QueryRequestJson: `
-		{
-			"query": {
-				"bool": {
-					"must": {
-						"match_all": {}
-					},
-					"filter": {
-						"geo_polygon": {
-							"person.location": {
-								"points": [
-									{ "lat": 40, "lon": -70 },
-									{ "lat": 30, "lon": -80 },
-									{ "lat": 20, "lon": -90 }
-								]
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
 	{ // [69]
-		TestName:  "Geo queries: geoshape",
-		QueryType: "geo_shape",
-		QueryRequestJson: `
-		{
-			"query": {
-				"bool": {
-					"must": {
-						"match_all": {}
-					},
-					"filter": {
-						"geo_shape": {
-							"location": {
-								"shape": {
-									"type": "envelope",
-									"coordinates": [ [ 13.0, 53.0 ], [ 14.0, 52.0 ] ]
-								},
-								"relation": "within"
-							}
-						}
-					}
-				}
-			}
-		}`,
-	},
-	{ // [70]
 		TestName:  "Shape",
 		QueryType: "shape",
 		QueryRequestJson: `
@@ -1289,7 +621,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [71]
+	{ // [70]
 		TestName:  "Joining queries: Has child",
 		QueryType: "has_child",
 		QueryRequestJson: `
@@ -1307,7 +639,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [72]
+	{ // [71]
 		TestName:  "Joining queries: Has parent",
 		QueryType: "has_parent",
 		QueryRequestJson: `
@@ -1326,7 +658,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [73]
+	{ // [72]
 		TestName:  "Joining queries: Parent id",
 		QueryType: "parent_id",
 		QueryRequestJson: `
@@ -1339,7 +671,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [74]
+	{ // [73]
 		TestName:  "Span queries: Span containing",
 		QueryType: "span_containing",
 		QueryRequestJson: `
@@ -1363,7 +695,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [75]
+	{ // [74]
 		TestName:  "Span queries: Span field masking",
 		QueryType: "span_field_masking",
 		QueryRequestJson: `
@@ -1386,7 +718,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [76]
+	{ // [75]
 		TestName:  "Span queries: Span first",
 		QueryType: "span_first",
 		QueryRequestJson: `
@@ -1401,7 +733,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [77]
+	{ // [76]
 		TestName:  "Span queries: Span multi-term",
 		QueryType: "span_multi",
 		QueryRequestJson: `
@@ -1415,7 +747,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [78]
+	{ // [77]
 		TestName:  "Span queries: Span near",
 		QueryType: "span_near",
 		QueryRequestJson: `
@@ -1433,7 +765,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [79]
+	{ // [78]
 		TestName:  "Span queries: Span not",
 		QueryType: "span_not",
 		QueryRequestJson: `
@@ -1457,7 +789,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [80]
+	{ // [79]
 		TestName:  "Span queries: Span or",
 		QueryType: "span_or",
 		QueryRequestJson: `
@@ -1473,7 +805,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [81]
+	{ // [80]
 		TestName:  "Span queries: Span term",
 		QueryType: "span_term",
 		QueryRequestJson: `
@@ -1483,7 +815,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [82]
+	{ // [81]
 		TestName:  "Span queries: Span within",
 		QueryType: "span_within",
 		QueryRequestJson: `
@@ -1507,7 +839,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [83]
+	{ // [82]
 		TestName:  "Specialized queries: Distance feature",
 		QueryType: "distance_feature",
 		QueryRequestJson: `
@@ -1531,7 +863,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [84]
+	{ // [83]
 		TestName:  "Specialized queries: More like this",
 		QueryType: "more_like_this",
 		QueryRequestJson: `
@@ -1556,7 +888,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [85]
+	{ // [84]
 		TestName:  "Specialized queries: Percolate",
 		QueryType: "percolate",
 		QueryRequestJson: `
@@ -1571,7 +903,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [86]
+	{ // [85]
 		TestName:  "Specialized queries: Knn",
 		QueryType: "knn",
 		QueryRequestJson: `
@@ -1586,7 +918,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [87]
+	{ // [86]
 		TestName:  "Specialized queries: Rank feature",
 		QueryType: "rank_feature",
 		QueryRequestJson: `
@@ -1612,7 +944,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [88]
+	{ // [87]
 		TestName:  "Specialized queries: Script",
 		QueryType: "script",
 		QueryRequestJson: `
@@ -1634,7 +966,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [89]
+	{ // [88]
 		TestName:  "Specialized queries: Script score",
 		QueryType: "script_score",
 		QueryRequestJson: `
@@ -1651,7 +983,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [90]
+	{ // [89]
 		TestName:  "Specialized queries: Wrapper",
 		QueryType: "wrapper",
 		QueryRequestJson: `
@@ -1663,7 +995,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [91]
+	{ // [90]
 		TestName:  "Specialized queries: Pinned query",
 		QueryType: "pinned",
 		QueryRequestJson: `
@@ -1680,7 +1012,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [92]
+	{ // [91]
 		TestName:  "Specialized queries: Rule",
 		QueryType: "rule_query",
 		QueryRequestJson: `
@@ -1700,7 +1032,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [93]
+	{ // [92]
 		TestName:  "Specialized queries: Weighted tokens",
 		QueryType: "weighted_tokens",
 		QueryRequestJson: `
@@ -1719,7 +1051,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	{ // [94]
+	{ // [93]
 		TestName:  "Term-level queries: Fuzzy",
 		QueryType: "fuzzy",
 		QueryRequestJson: `
@@ -1733,7 +1065,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 			}
 		}`,
 	},
-	//{ // [95]
+	//{ // [94]
 	//	The query is partially supported, doesn't blow up,
 	// 	but the response is not as expected due to the nature of the backend (ClickHouse).
 	//	TestName:  "Term-level queries: IDs",
@@ -1747,7 +1079,7 @@ var UnsupportedQueriesTests = []UnsupportedQueryTestCase{
 	//		}
 	//	}`,
 	//},
-	{ // [97]
+	{ // [96]
 		TestName:  "Term-level queries: Terms set",
 		QueryType: "terms_set",
 		QueryRequestJson: `
@@ -3,6 +3,7 @@
 package testdata
 
 import (
+	"math"
 	"quesma/model"
 	"strconv"
 	"strings"
@@ -55,3 +56,22 @@ func EscapeBrackets(s string) string {
 func EscapeWildcard(s string) string {
 	return strings.ReplaceAll(s, "*", `\*`)
 }
+
+// digestQuantilesOf returns what quantilesTDigest(0, 0.01, ..., 1) returns for (sorted) values,
+// if the digest is exact (it is for a small number of values)
+func digestQuantilesOf(sortedValues ...float64) []float64 {
+	quantiles := make([]float64, 0, 101)
+	for i := 0; i <= 100; i++ {
+		quantiles = append(quantiles, sortedValues[int(math.Round(float64(i)*float64(len(sortedValues)-1)/100))])
+	}
+	return quantiles
+}
+
+// digestLevels returns "0, 0.01, ..., 1": levels of quantilesTDigest we select for boxplot and median_absolute_deviation
+func digestLevels() string {
+	levels := make([]string, 0, 101)
+	for i := 0; i <= 100; i++ {
+		levels = append(levels, strconv.FormatFloat(float64(i)/100, 'f', -1, 64))
+	}
+	return strings.Join(levels, ", ")
+}